@@ -0,0 +1,571 @@
+package appdash
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The default size and number of the buckets of time that an
+// AggregateStore aggregates the root spans by, so that it keeps the
+// aggregations of the last 72 hours, per minute.
+const (
+	DefaultAggregateBucketSize = time.Minute
+	DefaultAggregateBuckets    = 72 * 60
+)
+
+// DefaultAggregateExemplars is the number of exemplar traces that an
+// AggregateStore keeps per root span name and bucket, by default.
+const DefaultAggregateExemplars = 5
+
+// An ExemplarStrategy selects the exemplar traces of the aggregations of
+// an AggregateStore, which traceapp links to (see
+// AggregatedResult.Slowest).
+type ExemplarStrategy int
+
+const (
+	// SlowestExemplars selects the slowest traces.
+	SlowestExemplars ExemplarStrategy = iota
+
+	// ErrorExemplars selects the most recent traces whose root span
+	// failed (see IsError).
+	ErrorExemplars
+
+	// RandomExemplars selects a uniform random sample of the traces.
+	RandomExemplars
+)
+
+func (s ExemplarStrategy) String() string {
+	switch s {
+	case SlowestExemplars:
+		return "slowest"
+	case ErrorExemplars:
+		return "error"
+	case RandomExemplars:
+		return "random"
+	}
+	return fmt.Sprintf("ExemplarStrategy(%d)", int(s))
+}
+
+// An AggregateStore is a store that aggregates the durations of the root
+// spans collected (by span name, and by the bucket of time that they
+// started in), for the dashboard of traceapp (see Aggregator and
+// SeriesAggregator). The collections are passed to the underlying Store as
+// they are.
+//
+// The duration of a root span is that of its timespan events (see
+// Trace.TimespanEvent), so it is aggregated when it is collected with
+// them, and with its name (as a Recorder does when the span finishes).
+// The percentiles of the durations are estimated with
+// a LatencySketch, so that the memory used per name and bucket is bounded.
+//
+// The aggregation state is kept as the annotations of the spans of
+// MemoryStore (one trace per name and bucket), so that it can be persisted
+// like any MemoryStore, for example with PersistEvery, and read back with
+// ReadFile, before the first call to Collect or Aggregate. The
+// aggregations updated by Collect are saved to MemoryStore at most once
+// per aggregateSaveInterval, and by Flush, which must be called before
+// MemoryStore is persisted for the last time.
+type AggregateStore struct {
+	// Store is the underlying store, which the collections are passed to.
+	Store
+
+	// MemoryStore holds the aggregation state.
+	MemoryStore *MemoryStore
+
+	// BucketSize is the duration of the buckets of time that the root
+	// spans are aggregated by, and Buckets is the number of the most
+	// recent buckets that are kept: the older ones are dropped as the
+	// current bucket rotates, and the root spans that started before them
+	// aren't aggregated. They must be set before the first call to
+	// Collect or Aggregate; the aggregations of another bucket size read
+	// from MemoryStore are dropped.
+	//
+	// NewAggregateStore sets BucketSize = DefaultAggregateBucketSize and
+	// Buckets = DefaultAggregateBuckets.
+	BucketSize time.Duration
+	Buckets    int
+
+	// Exemplars is the number of exemplar traces kept per name and bucket,
+	// which are reported in AggregatedResult.Slowest, and
+	// ExemplarStrategy is how they are selected. The exemplars that are
+	// no longer in the underlying store (because they were evicted or
+	// deleted from it) are pruned when their aggregation is reported, by
+	// Aggregate or AggregateSeries.
+	//
+	// NewAggregateStore sets Exemplars = DefaultAggregateExemplars, and
+	// the default ExemplarStrategy is SlowestExemplars.
+	Exemplars        int
+	ExemplarStrategy ExemplarStrategy
+
+	mu     sync.Mutex                       // guards groups, last, dirty and saved
+	groups map[aggregateKey]*aggregateEvent // nil until loaded from MemoryStore
+	last   time.Time                        // the last bucket that groups were evicted at
+	dirty  map[aggregateKey]bool            // the groups not saved to MemoryStore since they were updated
+	saved  time.Time                        // the last time that the dirty groups were saved
+}
+
+// aggregateSaveInterval is the minimum interval at which Collect saves the
+// aggregations that it updated to AggregateStore.MemoryStore, so that
+// they aren't marshaled again for each root span.
+const aggregateSaveInterval = time.Second
+
+// NewAggregateStore returns an AggregateStore that passes the collections
+// to s, with an empty MemoryStore.
+func NewAggregateStore(s Store) *AggregateStore {
+	return &AggregateStore{
+		Store:       s,
+		MemoryStore: NewMemoryStore(),
+		BucketSize:  DefaultAggregateBucketSize,
+		Buckets:     DefaultAggregateBuckets,
+		Exemplars:   DefaultAggregateExemplars,
+	}
+}
+
+// bucketSize returns BucketSize, or DefaultAggregateBucketSize if it isn't
+// set.
+func (as *AggregateStore) bucketSize() time.Duration {
+	if as.BucketSize <= 0 {
+		return DefaultAggregateBucketSize
+	}
+	return as.BucketSize
+}
+
+// oldest returns the start of the oldest bucket that is kept at time now.
+func (as *AggregateStore) oldest(now time.Time) time.Time {
+	n := as.Buckets
+	if n <= 0 {
+		n = DefaultAggregateBuckets
+	}
+	size := as.bucketSize()
+	return now.Truncate(size).Add(-time.Duration(n-1) * size)
+}
+
+// aggregateKey is the key of the aggregation of the root spans with a name
+// that started within a bucket.
+type aggregateKey struct {
+	name  string
+	start int64 // Unix time of the start of the bucket, in nanoseconds
+}
+
+// spanID returns the ID of the span of AggregateStore.MemoryStore that
+// holds the aggregation.
+func (k aggregateKey) spanID() SpanID {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s\x00%d", k.name, k.start)
+	id := ID(h.Sum64())
+	if id == 0 {
+		id = 1
+	}
+	return SpanID{Trace: id, Span: id}
+}
+
+// aggregateEvent is the aggregation of the root spans with a name that
+// started within a bucket, as recorded in AggregateStore.MemoryStore.
+type aggregateEvent struct {
+	Name      string
+	Start     time.Time     // the start of the bucket
+	Size      time.Duration // the size of the bucket
+	Count     int64
+	Sum       time.Duration
+	SumSq     float64 // sum of the squares of the durations, in seconds²
+	Min, Max  time.Duration
+	Exemplars []exemplar // in the order of the ExemplarStrategy
+	Sketch    LatencySketch
+}
+
+// exemplar is an exemplar trace of an aggregation (see ExemplarStrategy).
+type exemplar struct {
+	Trace    uint64 // not ID, which isn't unmarshaled from its String form
+	Duration int64  // in nanoseconds, since the types of the durations in slices aren't recorded
+	Start    time.Time
+	Weight   float64 // the number of traces it was sampled from (RandomExemplars)
+}
+
+func (aggregateEvent) Schema() string { return "aggregate" }
+
+// add adds the duration of the root span of a trace to the aggregation.
+func (e *aggregateEvent) add(x exemplar, failed bool, n int, strategy ExemplarStrategy) {
+	d := time.Duration(x.Duration)
+	if e.Count == 0 || d < e.Min {
+		e.Min = d
+	}
+	if d > e.Max {
+		e.Max = d
+	}
+	e.Count++
+	e.Sum += d
+	e.SumSq += d.Seconds() * d.Seconds()
+	e.Sketch.Add(d)
+
+	switch strategy {
+	case SlowestExemplars:
+		e.Exemplars = selectExemplars(append(e.Exemplars, x), n, strategy)
+	case ErrorExemplars:
+		if failed {
+			e.Exemplars = selectExemplars(append(e.Exemplars, x), n, strategy)
+		}
+	case RandomExemplars:
+		// Reservoir sampling: each of the traces is kept with the
+		// probability n/Count.
+		if len(e.Exemplars) < n {
+			e.Exemplars = append(e.Exemplars, x)
+		} else if i := rand.Int63n(e.Count); i < int64(n) {
+			e.Exemplars[i] = x
+		}
+		for i := range e.Exemplars {
+			e.Exemplars[i].Weight = float64(e.Count) / float64(len(e.Exemplars))
+		}
+	}
+}
+
+// selectExemplars returns the n exemplars selected among xs by the
+// strategy, in its order.
+func selectExemplars(xs []exemplar, n int, strategy ExemplarStrategy) []exemplar {
+	switch strategy {
+	case SlowestExemplars:
+		sort.SliceStable(xs, func(i, j int) bool { return xs[i].Duration > xs[j].Duration })
+	case ErrorExemplars:
+		sort.SliceStable(xs, func(i, j int) bool { return xs[i].Start.After(xs[j].Start) })
+	case RandomExemplars:
+		// Weighted sampling without replacement (Efraimidis and Spirakis),
+		// so that the sample of the merged aggregations is uniform.
+		keys := make(map[uint64]float64, len(xs))
+		for _, x := range xs {
+			w := x.Weight
+			if w <= 0 {
+				w = 1
+			}
+			keys[x.Trace] = math.Pow(rand.Float64(), 1/w)
+		}
+		sort.SliceStable(xs, func(i, j int) bool { return keys[xs[i].Trace] > keys[xs[j].Trace] })
+	}
+	if len(xs) > n {
+		xs = xs[:n]
+	}
+	return xs
+}
+
+// Collect implements the Collector interface by passing the collection to
+// the underlying store, and aggregating the duration of the root spans.
+func (as *AggregateStore) Collect(id SpanID, anns ...Annotation) error {
+	if err := as.Store.Collect(id, anns...); err != nil {
+		return err
+	}
+	if !id.IsRoot() {
+		return nil
+	}
+	ev, err := (&Trace{Span: Span{Annotations: anns}}).TimespanEvent()
+	if err != nil {
+		return nil // not timed
+	}
+	name := Annotations(anns).Get("Name")
+	if len(name) == 0 {
+		return nil
+	}
+	failed := IsError(anns)
+	start := ev.Start()
+	if start.Before(as.oldest(time.Now())) {
+		return nil
+	}
+
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	if err := as.loadLocked(); err != nil {
+		return err
+	}
+	as.evictLocked()
+	size := as.bucketSize()
+	bucket := start.Truncate(size)
+	key := aggregateKey{name: string(name), start: bucket.UnixNano()}
+	e := as.groups[key]
+	if e == nil {
+		e = &aggregateEvent{Name: key.name, Start: bucket.UTC(), Size: size}
+		as.groups[key] = e
+	}
+	e.add(exemplar{Trace: uint64(id.Trace), Duration: int64(EventDuration(ev)), Start: start}, failed, as.Exemplars, as.ExemplarStrategy)
+	as.dirty[key] = true
+	if time.Since(as.saved) < aggregateSaveInterval {
+		return nil
+	}
+	return as.flushLocked()
+}
+
+// Flush saves the aggregations updated since they were last saved to
+// MemoryStore. It must be called before MemoryStore is persisted for the
+// last time (for example, when the program exits), so that the last root
+// spans collected aren't lost.
+func (as *AggregateStore) Flush() error {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	return as.flushLocked()
+}
+
+// flushLocked saves the dirty aggregations to MemoryStore.
+func (as *AggregateStore) flushLocked() error {
+	for key := range as.dirty {
+		if e := as.groups[key]; e != nil {
+			if err := as.saveLocked(key, e); err != nil {
+				return err
+			}
+		}
+		delete(as.dirty, key)
+	}
+	as.saved = time.Now()
+	return nil
+}
+
+// loadLocked loads the aggregations from MemoryStore, the first time it is
+// called, and deletes those of another bucket size.
+func (as *AggregateStore) loadLocked() error {
+	if as.groups != nil {
+		return nil
+	}
+	groups := map[aggregateKey]*aggregateEvent{}
+	var other []ID
+	err := as.MemoryStore.ForEachTrace(func(t *Trace) error {
+		var e aggregateEvent
+		if err := UnmarshalEvent(t.Span.Annotations, &e); err != nil {
+			return fmt.Errorf("appdash: reading aggregation of span %v: %s", t.Span.ID, err)
+		}
+		if e.Size != as.bucketSize() {
+			other = append(other, t.Span.ID.Trace)
+			return nil
+		}
+		groups[aggregateKey{name: e.Name, start: e.Start.UnixNano()}] = &e
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(other) > 0 {
+		if _, err := as.MemoryStore.DeleteTraces(other...); err != nil {
+			return err
+		}
+	}
+	as.groups = groups
+	as.dirty = map[aggregateKey]bool{}
+	return nil
+}
+
+// saveLocked records the aggregation in MemoryStore, replacing the
+// previous one.
+func (as *AggregateStore) saveLocked(key aggregateKey, e *aggregateEvent) error {
+	anns, err := MarshalEvent(*e)
+	if err != nil {
+		return err
+	}
+	span := key.spanID()
+	if _, err := as.MemoryStore.DeleteTraces(span.Trace); err != nil {
+		return err
+	}
+	delete(as.dirty, key)
+	return as.MemoryStore.Collect(span, anns...)
+}
+
+// pruneLocked removes the exemplars of the aggregation that are no longer
+// in the underlying store, and reports whether there were any.
+func (as *AggregateStore) pruneLocked(e *aggregateEvent) bool {
+	kept := e.Exemplars[:0]
+	for _, x := range e.Exemplars {
+		if containsTrace(as.Store, ID(x.Trace)) {
+			kept = append(kept, x)
+		}
+	}
+	pruned := len(kept) < len(e.Exemplars)
+	e.Exemplars = kept
+	return pruned
+}
+
+// evictLocked deletes the aggregations of the buckets older than the last
+// Buckets, when the current bucket rotates.
+func (as *AggregateStore) evictLocked() {
+	now := time.Now()
+	bucket := now.Truncate(as.bucketSize())
+	if !bucket.After(as.last) {
+		return
+	}
+	as.last = bucket
+	oldest := as.oldest(now).UnixNano()
+	for key := range as.groups {
+		if key.start < oldest {
+			delete(as.groups, key)
+			delete(as.dirty, key)
+			as.MemoryStore.DeleteTraces(key.spanID().Trace)
+		}
+	}
+}
+
+// window returns the range of the starts of the buckets that overlap with
+// the given time range (relative to now), in Unix nanoseconds: the buckets
+// that start in (from, to].
+func (as *AggregateStore) window(start, end time.Duration) (from, to int64) {
+	now := time.Now()
+	return now.Add(start).Add(-as.bucketSize()).UnixNano(), now.Add(end).UnixNano()
+}
+
+// Aggregate implements the Aggregator interface, by merging the
+// aggregations of the buckets that overlap with the given time range.
+func (as *AggregateStore) Aggregate(start, end time.Duration) ([]*AggregatedResult, error) {
+	from, to := as.window(start, end)
+
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	if err := as.loadLocked(); err != nil {
+		return nil, err
+	}
+	as.evictLocked()
+	merged := map[string]*aggregateEvent{}
+	for key, e := range as.groups {
+		if key.start <= from || key.start > to {
+			continue
+		}
+		m := merged[key.name]
+		if m == nil {
+			m = &aggregateEvent{Name: key.name}
+			merged[key.name] = m
+		}
+		m.merge(e)
+	}
+	for _, m := range merged {
+		m.Exemplars = selectExemplars(m.Exemplars, as.Exemplars, as.ExemplarStrategy)
+		if as.pruneLocked(m) {
+			// Prune the aggregations of the buckets too, and select the
+			// exemplars again among the remaining ones.
+			if err := as.pruneBucketsLocked(m, from, to); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	results := make([]*AggregatedResult, 0, len(merged))
+	for _, m := range merged {
+		results = append(results, m.result())
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].RootSpanName < results[j].RootSpanName })
+	return results, nil
+}
+
+// AggregateSeries implements the SeriesAggregator interface, by returning
+// the aggregations of the buckets that overlap with the given time range.
+func (as *AggregateStore) AggregateSeries(name string, start, end time.Duration) ([]*AggregatedBucket, error) {
+	from, to := as.window(start, end)
+
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	if err := as.loadLocked(); err != nil {
+		return nil, err
+	}
+	as.evictLocked()
+	var buckets []*AggregatedBucket
+	for key, e := range as.groups {
+		if key.name != name || key.start <= from || key.start > to {
+			continue
+		}
+		if as.pruneLocked(e) {
+			if err := as.saveLocked(key, e); err != nil {
+				return nil, err
+			}
+		}
+		buckets = append(buckets, &AggregatedBucket{
+			Start:            e.Start,
+			Size:             e.Size,
+			AggregatedResult: *e.result(),
+		})
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Start.Before(buckets[j].Start) })
+	return buckets, nil
+}
+
+// merge adds the aggregation e (of another bucket) to the aggregation, with
+// all of its exemplars.
+func (m *aggregateEvent) merge(e *aggregateEvent) {
+	if m.Count == 0 || e.Min < m.Min {
+		m.Min = e.Min
+	}
+	if e.Max > m.Max {
+		m.Max = e.Max
+	}
+	m.Count += e.Count
+	m.Sum += e.Sum
+	m.SumSq += e.SumSq
+	m.Sketch.Merge(e.Sketch)
+	m.Exemplars = append(m.Exemplars, e.Exemplars...)
+}
+
+// pruneBucketsLocked prunes the aggregations of the buckets that start in
+// (from, to] that the merged aggregation m is made of, and selects its
+// exemplars again.
+func (as *AggregateStore) pruneBucketsLocked(m *aggregateEvent, from, to int64) error {
+	m.Exemplars = nil
+	for key, e := range as.groups {
+		if key.name != m.Name || key.start <= from || key.start > to {
+			continue
+		}
+		if as.pruneLocked(e) {
+			if err := as.saveLocked(key, e); err != nil {
+				return err
+			}
+		}
+		m.Exemplars = append(m.Exemplars, e.Exemplars...)
+	}
+	m.Exemplars = selectExemplars(m.Exemplars, as.Exemplars, as.ExemplarStrategy)
+	return nil
+}
+
+// result returns the AggregatedResult of the aggregation.
+func (e *aggregateEvent) result() *AggregatedResult {
+	r := &AggregatedResult{
+		RootSpanName: e.Name,
+		Min:          e.Min,
+		Max:          e.Max,
+		Samples:      e.Count,
+		P50:          e.Sketch.Quantile(0.50),
+		P95:          e.Sketch.Quantile(0.95),
+		P99:          e.Sketch.Quantile(0.99),
+	}
+	if e.Count > 0 {
+		mean := e.Sum.Seconds() / float64(e.Count)
+		r.Average = time.Duration(mean * float64(time.Second))
+		if variance := e.SumSq/float64(e.Count) - mean*mean; variance > 0 {
+			r.StdDev = time.Duration(math.Sqrt(variance) * float64(time.Second))
+		}
+	}
+	for _, x := range e.Exemplars {
+		r.Slowest = append(r.Slowest, ID(x.Trace))
+	}
+	return r
+}
+
+// Traces implements the Queryer interface by calling the underlying store's
+// Traces method. It returns an error if the underlying store does not
+// implement Queryer.
+func (as *AggregateStore) Traces(opts TracesOpts) ([]*Trace, error) {
+	return queryTraces(as.Store, opts)
+}
+
+// NumTraces implements the Counter interface by calling the underlying
+// store's NumTraces method. It returns an error if the underlying store
+// does not implement Counter.
+func (as *AggregateStore) NumTraces() (int, error) {
+	return numTraces(as.Store)
+}
+
+// NumSpans implements the Counter interface by calling the underlying
+// store's NumSpans method. It returns an error if the underlying store does
+// not implement Counter.
+func (as *AggregateStore) NumSpans() (int, error) {
+	return numSpans(as.Store)
+}
+
+// Compile-time "implements" check.
+var _ interface {
+	Store
+	Queryer
+	SeriesAggregator
+	Counter
+} = (*AggregateStore)(nil)
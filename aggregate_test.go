@@ -0,0 +1,276 @@
+package appdash
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAggregateStore(t *testing.T) {
+	as := NewAggregateStore(NewMemoryStore())
+	start := time.Now().Add(-time.Minute)
+	collect := func(trace ID, name string, d time.Duration) {
+		rec := NewRecorder(SpanID{Trace: trace, Span: trace}, as)
+		rec.Name(name)
+		rec.Event(Timespan{S: start, E: start.Add(d)})
+		c := rec.ChildWithName("child")
+		c.Event(Timespan{S: start, E: start.Add(time.Hour)}) // not a root span
+		c.Finish()
+		rec.Finish()
+	}
+	// 1ms to 100ms for "a", so the percentiles are known.
+	for i := 1; i <= 100; i++ {
+		collect(ID(i), "a", time.Duration(i)*time.Millisecond)
+	}
+	collect(101, "b", time.Second)
+	as.Store.Collect(SpanID{Trace: 102, Span: 102}, Annotation{Key: "Name", Value: []byte("untimed")})
+
+	results, err := as.Aggregate(-72*time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].RootSpanName != "a" || results[1].RootSpanName != "b" {
+		t.Fatalf("got results %+v, want a and b", results)
+	}
+	a := results[0]
+	within := func(got, want time.Duration) bool {
+		return got >= want-want/100 && got <= want+want/100
+	}
+	if a.Samples != 100 || a.Min != time.Millisecond || a.Max != 100*time.Millisecond || !within(a.Average, 50500*time.Microsecond) {
+		t.Errorf("got result %+v, want 100 samples from 1ms to 100ms", a)
+	}
+	if !within(a.StdDev, 28866*time.Microsecond) {
+		t.Errorf("got standard deviation %s, want 28.866ms", a.StdDev)
+	}
+	for _, p := range []struct{ got, want time.Duration }{{a.P50, 50 * time.Millisecond}, {a.P95, 95 * time.Millisecond}, {a.P99, 99 * time.Millisecond}} {
+		if !within(p.got, p.want) {
+			t.Errorf("got percentile %s, want %s", p.got, p.want)
+		}
+	}
+	if want := []ID{100, 99, 98, 97, 96}; !reflect.DeepEqual(a.Slowest, want) {
+		t.Errorf("got slowest traces %v, want %v", a.Slowest, want)
+	}
+
+	// Outside of the time range.
+	if results, err := as.Aggregate(-72*time.Hour, -2*time.Hour); err != nil || len(results) != 0 {
+		t.Errorf("got results %+v and error %v, want none", results, err)
+	}
+	// The state is kept across restarts (of the aggregation, with the same
+	// underlying store of traces) by persisting the MemoryStore.
+	if err := as.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := as.MemoryStore.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	restarted := NewAggregateStore(as.Store)
+	if _, err := restarted.MemoryStore.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := restarted.Aggregate(-72*time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, results) {
+		t.Errorf("got results after restart\n%+v\nwant\n%+v", got[0], results[0])
+	}
+}
+
+// collectRoot collects a root span with the name and duration, which
+// failed or not.
+func collectRoot(as *AggregateStore, trace ID, name string, start time.Time, d time.Duration, failed bool) {
+	rec := NewRecorder(SpanID{Trace: trace, Span: trace}, as)
+	rec.Name(name)
+	rec.Event(Timespan{S: start, E: start.Add(d)})
+	if failed {
+		rec.Error(errors.New("failed"))
+	}
+	rec.Finish()
+}
+
+func TestAggregateStore_exemplarStrategies(t *testing.T) {
+	start := time.Now().Add(-time.Minute)
+	tests := []struct {
+		strategy ExemplarStrategy
+		check    func(ids []ID) bool
+		want     string
+	}{
+		{SlowestExemplars, func(ids []ID) bool { return reflect.DeepEqual(ids, []ID{20, 19, 18}) }, "the 3 slowest"},
+		{ErrorExemplars, func(ids []ID) bool { return reflect.DeepEqual(ids, []ID{15, 10, 5}) }, "the 3 most recent errors"},
+		{RandomExemplars, func(ids []ID) bool {
+			seen := map[ID]bool{}
+			for _, id := range ids {
+				if id < 1 || id > 20 || seen[id] {
+					return false
+				}
+				seen[id] = true
+			}
+			return len(ids) == 3
+		}, "3 distinct traces"},
+	}
+	for _, test := range tests {
+		as := NewAggregateStore(NewMemoryStore())
+		as.Exemplars = 3
+		as.ExemplarStrategy = test.strategy
+		for i := 1; i <= 20; i++ {
+			// Trace 5 is the slowest of the errors and the oldest.
+			collectRoot(as, ID(i), "a", start.Add(time.Duration(i)*time.Second), time.Duration(i)*time.Millisecond, i%5 == 0 && i != 20)
+		}
+		results, err := as.Aggregate(-72*time.Hour, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || !test.check(results[0].Slowest) {
+			t.Errorf("%s: got exemplars %v, want %s", test.strategy, results[0].Slowest, test.want)
+		}
+	}
+}
+
+func TestAggregateStore_pruneExemplars(t *testing.T) {
+	ms := NewMemoryStore()
+	as := NewAggregateStore(ms)
+	as.Exemplars = 2
+	now := time.Now()
+	lastBucket := now.Add(-time.Minute)
+	collectRoot(as, 1, "a", lastBucket, 3*time.Second, false)
+	collectRoot(as, 2, "a", lastBucket, 2*time.Second, false)
+	collectRoot(as, 3, "a", now, 4*time.Second, false)
+	collectRoot(as, 4, "a", now, time.Second, false)
+
+	exemplars := func(bucket time.Time) []uint64 {
+		t.Helper()
+		// Read the persisted state, as after a restart.
+		if err := as.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		restarted := NewAggregateStore(ms)
+		restarted.MemoryStore = as.MemoryStore
+		restarted.mu.Lock()
+		defer restarted.mu.Unlock()
+		if err := restarted.loadLocked(); err != nil {
+			t.Fatal(err)
+		}
+		var ids []uint64
+		for _, x := range restarted.groups[aggregateKey{name: "a", start: bucket.Truncate(time.Minute).UnixNano()}].Exemplars {
+			ids = append(ids, x.Trace)
+		}
+		return ids
+	}
+
+	// The traces are evicted from the underlying store. The exemplars
+	// aren't pruned when the root spans are collected.
+	if _, err := ms.DeleteTraces(1, 3); err != nil {
+		t.Fatal(err)
+	}
+	collectRoot(as, 5, "a", now, 500*time.Millisecond, false)
+	collectRoot(as, 6, "a", now, 5*time.Second, false)
+	if got, want := exemplars(now), []uint64{6, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got exemplars %v of this bucket, want %v (not pruned yet)", got, want)
+	}
+	if got, want := exemplars(lastBucket), []uint64{1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got exemplars %v of the last bucket, want %v (not pruned yet)", got, want)
+	}
+
+	// They are pruned when they are reported.
+	results, err := as.Aggregate(-72*time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []ID{6, 2}; len(results) != 1 || !reflect.DeepEqual(results[0].Slowest, want) {
+		t.Errorf("got results %+v, want exemplars %v", results, want)
+	}
+	if got, want := exemplars(now), []uint64{6}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got exemplars %v of this bucket, want %v", got, want)
+	}
+	if got, want := exemplars(lastBucket), []uint64{2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got exemplars %v of the last bucket, want %v", got, want)
+	}
+	if results[0].Samples != 6 {
+		t.Errorf("got %d samples, want 6 (pruning doesn't change the aggregation)", results[0].Samples)
+	}
+}
+
+func TestAggregateStore_series(t *testing.T) {
+	as := NewAggregateStore(NewMemoryStore())
+	as.Buckets = 10
+	cur := time.Now().Truncate(time.Minute)
+	collectRoot(as, 1, "a", cur, 3*time.Second, false)
+	collectRoot(as, 2, "a", cur, time.Second, false)
+	collectRoot(as, 3, "a", cur.Add(-2*time.Minute), 2*time.Second, false)
+	collectRoot(as, 4, "b", cur.Add(-time.Minute), time.Second, false)
+	collectRoot(as, 5, "a", cur.Add(-20*time.Minute), time.Second, false) // before the oldest bucket
+
+	series, err := as.AggregateSeries("a", -time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 2 {
+		t.Fatalf("got %d buckets, want 2", len(series))
+	}
+	if b := series[0]; !b.Start.Equal(cur.Add(-2*time.Minute)) || b.Size != time.Minute || b.Samples != 1 || b.Max != 2*time.Second {
+		t.Errorf("got first bucket %+v, want 1 sample of 2s 2 minutes ago", b)
+	}
+	if b := series[1]; !b.Start.Equal(cur) || b.Samples != 2 || b.Min != time.Second || b.Max != 3*time.Second || !reflect.DeepEqual(b.Slowest, []ID{1, 2}) {
+		t.Errorf("got last bucket %+v, want 2 samples of 1s and 3s", b)
+	}
+	if results, err := as.Aggregate(-time.Hour, 0); err != nil || len(results) != 2 || results[0].Samples != 3 {
+		t.Errorf("got results %+v and error %v, want 3 samples of a (and b)", results, err)
+	}
+
+	// The oldest buckets are dropped when the current bucket rotates.
+	as.Buckets = 2
+	as.last = time.Time{}
+	series, err = as.AggregateSeries("a", -time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 1 || !series[0].Start.Equal(cur) {
+		t.Errorf("got buckets %+v, want only the current one", series)
+	}
+	if n := as.MemoryStore.Usage().Traces; n > 2 {
+		t.Errorf("got %d aggregations, want at most 2", n)
+	}
+
+	// The aggregations of another bucket size are dropped.
+	restarted := NewAggregateStore(as.Store)
+	restarted.MemoryStore = as.MemoryStore
+	restarted.BucketSize = time.Hour
+	if results, err := restarted.Aggregate(-time.Hour, 0); err != nil || len(results) != 0 {
+		t.Errorf("got results %+v and error %v, want none", results, err)
+	}
+}
+
+func TestAggregateStore_flush(t *testing.T) {
+	as := NewAggregateStore(NewMemoryStore())
+	start := time.Now()
+	count := func() int64 {
+		t.Helper()
+		var e aggregateEvent
+		span := aggregateKey{name: "a", start: start.Truncate(time.Minute).UnixNano()}.spanID()
+		tr, err := as.MemoryStore.Trace(span.Trace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := UnmarshalEvent(tr.Span.Annotations, &e); err != nil {
+			t.Fatal(err)
+		}
+		return e.Count
+	}
+
+	// The first aggregation is saved, and the next ones aren't until the
+	// save interval elapses or they are flushed.
+	collectRoot(as, 1, "a", start, time.Second, false)
+	collectRoot(as, 2, "a", start, time.Second, false)
+	if n := count(); n != 1 {
+		t.Errorf("got %d samples saved, want 1", n)
+	}
+	if err := as.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 2 {
+		t.Errorf("got %d samples saved after Flush, want 2", n)
+	}
+}
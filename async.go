@@ -0,0 +1,164 @@
+package appdash
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// NewAsyncCollector returns a collector that passes the collections to c
+// in the background, using a pool of workers, so that Collect doesn't
+// block on the network or the disk (e.g. when c is a RemoteCollector or a
+// Store). At most queueSize collections are queued; what happens to the
+// others is determined by BlockWhenFull.
+//
+// Call Close to send the queued collections and stop the workers.
+func NewAsyncCollector(c Collector, workers, queueSize int) *AsyncCollector {
+	if workers < 1 {
+		workers = 1
+	}
+	return &AsyncCollector{c: c, workers: workers, queueSize: queueSize}
+}
+
+// An AsyncCollector passes collections to its underlying collector in the
+// background. See NewAsyncCollector.
+//
+// The collections of a span may be sent in a different order than they
+// were collected in, since they are sent by several workers, unless
+// ShardBySpan is true.
+type AsyncCollector struct {
+	c                  Collector
+	workers, queueSize int
+
+	// BlockWhenFull is whether Collect waits for room in the queue when it
+	// is full. Otherwise, the collection is dropped, and Collect returns
+	// ErrQueueFull.
+	BlockWhenFull bool
+
+	// ShardBySpan is whether each span is assigned to a single worker, so
+	// that its collections are sent in order. Each worker then has its own
+	// share of the queue.
+	ShardBySpan bool
+
+	// mu guards the fields below. Collect holds a read lock while queuing,
+	// so that Close doesn't close the queues under it.
+	mu      sync.RWMutex
+	started bool
+	closed  bool
+	queues  []chan queuedSpan // a single one, unless ShardBySpan
+	wg      sync.WaitGroup    // the workers
+
+	// The last error from the underlying Collector's Collect method, if
+	// any. It is returned to the next caller of Collect.
+	errMu   sync.Mutex
+	lastErr error
+
+	dropped uint64 // accessed atomically
+}
+
+// Collect implements the Collector interface by queuing the collection, to
+// be passed to the underlying collector by a worker. It returns the error
+// of a previous collection, if any.
+func (ac *AsyncCollector) Collect(span SpanID, anns ...Annotation) error {
+	ac.mu.RLock()
+	if !ac.started {
+		ac.mu.RUnlock()
+		ac.start()
+		ac.mu.RLock()
+	}
+	defer ac.mu.RUnlock()
+	if ac.closed {
+		return ErrCollectorClosed
+	}
+
+	q := ac.queues[0]
+	if len(ac.queues) > 1 {
+		q = ac.queues[traceHash(span.Span)%uint64(len(ac.queues))]
+	}
+	if ac.BlockWhenFull {
+		q <- queuedSpan{span, anns}
+	} else {
+		select {
+		case q <- queuedSpan{span, anns}:
+		default:
+			atomic.AddUint64(&ac.dropped, 1)
+			return ErrQueueFull
+		}
+	}
+
+	ac.errMu.Lock()
+	defer ac.errMu.Unlock()
+	err := ac.lastErr
+	ac.lastErr = nil
+	return err
+}
+
+// start creates the queues and starts the workers, unless it was already
+// done.
+func (ac *AsyncCollector) start() {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	if ac.started {
+		return
+	}
+	ac.started = true
+
+	shared := make(chan queuedSpan, ac.queueSize)
+	for i := 0; i < ac.workers; i++ {
+		q := shared
+		if ac.ShardBySpan {
+			size := ac.queueSize / ac.workers
+			if size < 1 {
+				size = 1
+			}
+			q = make(chan queuedSpan, size)
+			ac.queues = append(ac.queues, q)
+		}
+		ac.wg.Add(1)
+		go ac.work(q)
+	}
+	if !ac.ShardBySpan {
+		ac.queues = []chan queuedSpan{shared}
+	}
+}
+
+// work passes the collections of q to the underlying collector, until q is
+// closed.
+func (ac *AsyncCollector) work(q <-chan queuedSpan) {
+	defer ac.wg.Done()
+	for s := range q {
+		if err := ac.c.Collect(s.span, s.anns...); err != nil {
+			ac.errMu.Lock()
+			ac.lastErr = err
+			ac.errMu.Unlock()
+		}
+	}
+}
+
+// Dropped returns the number of collections that were dropped because the
+// queue was full.
+func (ac *AsyncCollector) Dropped() uint64 {
+	return atomic.LoadUint64(&ac.dropped)
+}
+
+// Close stops accepting collections, and waits until the queued ones are
+// passed to the underlying collector. It returns the last error of the
+// underlying collector that wasn't returned by Collect, if any.
+func (ac *AsyncCollector) Close() error {
+	ac.mu.Lock()
+	if ac.closed {
+		ac.mu.Unlock()
+		return nil
+	}
+	ac.closed = true
+	for _, q := range ac.queues {
+		close(q)
+	}
+	ac.mu.Unlock()
+	ac.wg.Wait()
+
+	ac.errMu.Lock()
+	defer ac.errMu.Unlock()
+	err := ac.lastErr
+	ac.lastErr = nil
+	return err
+}
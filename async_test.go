@@ -0,0 +1,105 @@
+package appdash
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestAsyncCollector(t *testing.T) {
+	const (
+		goroutines = 50
+		collects   = 100
+	)
+	var (
+		mu   sync.Mutex
+		seqs = map[SpanID][]int{}
+	)
+	ac := NewAsyncCollector(collectorFunc(func(span SpanID, anns ...Annotation) error {
+		seq, err := strconv.Atoi(string(anns[0].Value))
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		seqs[span] = append(seqs[span], seq)
+		return nil
+	}), 8, 64)
+	ac.BlockWhenFull = true
+	ac.ShardBySpan = true
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			span := NewRootSpanID()
+			for i := 0; i < collects; i++ {
+				if err := ac.Collect(span, Annotation{Key: "seq", Value: []byte(strconv.Itoa(i))}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if err := ac.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(seqs) != goroutines {
+		t.Fatalf("got %d spans, want %d", len(seqs), goroutines)
+	}
+	for span, s := range seqs {
+		if len(s) != collects {
+			t.Errorf("span %v: got %d collections, want %d", span, len(s), collects)
+			continue
+		}
+		for i, seq := range s {
+			if seq != i {
+				t.Errorf("span %v: got collection %d at position %d, want them in order", span, seq, i)
+				break
+			}
+		}
+	}
+	if err := ac.Collect(NewRootSpanID()); err != ErrCollectorClosed {
+		t.Errorf("got error %v after Close, want ErrCollectorClosed", err)
+	}
+}
+
+func TestAsyncCollector_drop(t *testing.T) {
+	release := make(chan struct{})
+	var (
+		mu        sync.Mutex
+		collected int
+	)
+	ac := NewAsyncCollector(collectorFunc(func(span SpanID, anns ...Annotation) error {
+		<-release
+		mu.Lock()
+		defer mu.Unlock()
+		collected++
+		return nil
+	}), 1, 2)
+
+	// The worker takes (at most) one collection and the queue holds 2 more,
+	// so most of them are dropped.
+	var full int
+	for i := 0; i < 100; i++ {
+		if err := ac.Collect(NewRootSpanID()); err == ErrQueueFull {
+			full++
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if full < 97 || uint64(full) != ac.Dropped() {
+		t.Errorf("got %d ErrQueueFull and %d dropped, want at least 97 of each", full, ac.Dropped())
+	}
+
+	close(release)
+	if err := ac.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if collected != 100-full {
+		t.Errorf("got %d collections sent by Close, want %d", collected, 100-full)
+	}
+}
@@ -0,0 +1,137 @@
+package appdash
+
+import (
+	"fmt"
+	"sort"
+)
+
+// BaggagePrefix is the prefix of the keys of the annotations that hold the
+// baggage items of a span (see Recorder.SetBaggageItem). For example, the
+// baggage item "tenant" is recorded as the annotation "Baggage.tenant".
+const BaggagePrefix = "Baggage."
+
+// The default limits of the baggage items of a Recorder (see
+// Recorder.MaxBaggageItems and Recorder.MaxBaggageSize).
+const (
+	DefaultMaxBaggageItems = 16
+	DefaultMaxBaggageSize  = 4 << 10 // 4 KiB
+)
+
+// SetBaggageItem sets a baggage item, a key-value pair (such as a tenant or
+// request ID) that is recorded as an annotation (see BaggagePrefix) on the
+// span and on all of its descendants' spans, as the recorders created with
+// Child (and the httptrace and opentracing integrations, across process
+// boundaries) carry the baggage items of their parents.
+//
+// If the item would exceed MaxBaggageItems or MaxBaggageSize, it isn't set,
+// and an error is reported instead.
+func (r *Recorder) SetBaggageItem(key, value string) {
+	a := Annotation{Key: BaggagePrefix + EscapeKey(key), Value: []byte(value)}
+
+	r.mu.Lock()
+	if err := r.checkBaggageItemLocked(key, value); err != nil {
+		r.mu.Unlock()
+		r.error("SetBaggageItem", err)
+		return
+	}
+	if r.baggage == nil {
+		r.baggage = map[string]string{}
+	}
+	r.baggage[key] = value
+	if !r.finished {
+		r.setBaggageAnnotationLocked(a)
+		r.mu.Unlock()
+		return
+	}
+	finishedAt := r.finishedAt
+	r.mu.Unlock()
+
+	// The item is still carried by the children, but it can only be
+	// recorded on r's span as an event recorded after Finish would be.
+	if r.AllowEventsAfterFinish {
+		r.annotate([]Annotation{a}, true)
+		return
+	}
+	r.error("SetBaggageItem", fmt.Errorf("%w (baggage item %q not recorded, finished at %s)", errEventAfterFinish, key, finishedAt))
+}
+
+// setBaggageAnnotationLocked buffers the annotation of a baggage item,
+// replacing that of its previous value (set by SetBaggageItem, or carried
+// from the parent by Child), if any, so that the span records each item
+// once. r.mu must be held, and r must not be finished.
+func (r *Recorder) setBaggageAnnotationLocked(a Annotation) {
+	for i := range r.annotations {
+		if r.annotations[i].Key == a.Key {
+			r.annotations[i] = a
+			return
+		}
+	}
+	r.annotations = append(r.annotations, a)
+}
+
+// checkBaggageItemLocked returns an error if setting the baggage item would
+// exceed MaxBaggageItems or MaxBaggageSize. r.mu must be held.
+func (r *Recorder) checkBaggageItemLocked(key, value string) error {
+	items, size := len(r.baggage)+1, len(key)+len(value)
+	for k, v := range r.baggage {
+		if k == key {
+			items-- // replaced
+			continue
+		}
+		size += len(k) + len(v)
+	}
+
+	maxItems := r.MaxBaggageItems
+	if maxItems == 0 {
+		maxItems = DefaultMaxBaggageItems
+	}
+	if maxItems > 0 && items > maxItems {
+		return fmt.Errorf("baggage item %q exceeds MaxBaggageItems (%d)", key, maxItems)
+	}
+	maxSize := r.MaxBaggageSize
+	if maxSize == 0 {
+		maxSize = DefaultMaxBaggageSize
+	}
+	if maxSize > 0 && size > maxSize {
+		return fmt.Errorf("baggage item %q exceeds MaxBaggageSize (%d bytes)", key, maxSize)
+	}
+	return nil
+}
+
+// BaggageItem returns the value of the baggage item with the given key, or
+// "" if there is none.
+func (r *Recorder) BaggageItem(key string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.baggage[key]
+}
+
+// Baggage returns a copy of the baggage items, by key, or nil if there are
+// none.
+func (r *Recorder) Baggage() map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.baggage) == 0 {
+		return nil
+	}
+	baggage := make(map[string]string, len(r.baggage))
+	for k, v := range r.baggage {
+		baggage[k] = v
+	}
+	return baggage
+}
+
+// baggageAnnotations returns the annotations of the baggage items, sorted
+// by key.
+func baggageAnnotations(baggage map[string]string) []Annotation {
+	keys := make([]string, 0, len(baggage))
+	for k := range baggage {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	as := make([]Annotation, len(keys))
+	for i, k := range keys {
+		as[i] = Annotation{Key: BaggagePrefix + EscapeKey(k), Value: []byte(baggage[k])}
+	}
+	return as
+}
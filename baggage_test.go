@@ -0,0 +1,116 @@
+package appdash
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRecorder_SetBaggageItem(t *testing.T) {
+	ms := NewMemoryStore()
+	root := NewRecorder(SpanID{Trace: 1, Span: 2, Parent: 0}, ms)
+	root.SetBaggageItem("tenant", "acme")
+	root.SetBaggageItem("request", "r1")
+
+	child := root.Child()
+	grandchild := child.ChildWithName("grandchild")
+	child.SetBaggageItem("request", "r2") // only for child's descendants
+	greatGrandchild := child.Child()
+
+	for _, r := range []*Recorder{greatGrandchild, grandchild, child, root} {
+		r.Finish()
+	}
+
+	want := map[*Recorder]map[string]string{
+		root:            {"tenant": "acme", "request": "r1"},
+		child:           {"tenant": "acme", "request": "r2"},
+		grandchild:      {"tenant": "acme", "request": "r1"},
+		greatGrandchild: {"tenant": "acme", "request": "r2"},
+	}
+	for r, want := range want {
+		if got := r.Baggage(); !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: got baggage %v, want %v", r.SpanID, got, want)
+		}
+		if got := r.BaggageItem("tenant"); got != "acme" {
+			t.Errorf("%v: got tenant %q, want acme", r.SpanID, got)
+		}
+
+		// Each item is recorded once, with its current value.
+		trace, err := ms.Trace(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		span := trace.FindSpan(r.Span)
+		if span == nil {
+			t.Fatalf("span %v not collected", r.SpanID)
+		}
+		got := map[string]string{}
+		for _, a := range span.Annotations {
+			if strings.HasPrefix(a.Key, BaggagePrefix) {
+				key := strings.TrimPrefix(a.Key, BaggagePrefix)
+				if _, dup := got[key]; dup {
+					t.Errorf("%v: got baggage item %q recorded more than once", r.SpanID, key)
+				}
+				got[key] = string(a.Value)
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: got baggage annotations %v, want %v", r.SpanID, got, want)
+		}
+	}
+	if grandchild.Parent != child.Span || greatGrandchild.Parent != child.Span {
+		t.Errorf("got parents %v and %v, want %v", grandchild.Parent, greatGrandchild.Parent, child.Span)
+	}
+}
+
+func TestRecorder_SetBaggageItem_twice(t *testing.T) {
+	ms := NewMemoryStore()
+	r := NewRecorder(SpanID{Trace: 1, Span: 2}, ms)
+	r.SetBaggageItem("tenant", "acme")
+	r.Name("op")
+	r.SetBaggageItem("tenant", "globex")
+	r.Finish()
+
+	trace, err := ms.Trace(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []Annotation
+	for _, a := range trace.Annotations {
+		if strings.HasPrefix(a.Key, BaggagePrefix) {
+			got = append(got, a)
+		}
+	}
+	want := []Annotation{{Key: BaggagePrefix + "tenant", Value: []byte("globex")}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got baggage annotations %v, want %v", got, want)
+	}
+}
+
+func TestRecorder_SetBaggageItem_limits(t *testing.T) {
+	r := NewRecorder(SpanID{Trace: 1, Span: 2, Parent: 0}, collectorFunc(func(SpanID, ...Annotation) error { return nil }))
+	r.MaxBaggageItems = 2
+	r.MaxBaggageSize = 10
+
+	r.SetBaggageItem("a", "1")
+	r.SetBaggageItem("b", "2")
+	r.SetBaggageItem("b", "3") // replaces b
+	if errs := r.Errors(); len(errs) != 0 {
+		t.Fatalf("got errors %v, want none", errs)
+	}
+	r.SetBaggageItem("c", "4")         // too many items
+	r.SetBaggageItem("a", "123456789") // too large
+	if errs := r.Errors(); len(errs) != 2 {
+		t.Errorf("got errors %v, want 2", errs)
+	}
+	if got, want := r.Baggage(), map[string]string{"a": "1", "b": "3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got baggage %v, want %v", got, want)
+	}
+
+	// Negative limits disable them.
+	r.MaxBaggageItems, r.MaxBaggageSize = -1, -1
+	r.SetBaggageItem("c", strings.Repeat("x", DefaultMaxBaggageSize))
+	if errs := r.Errors(); len(errs) != 0 {
+		t.Errorf("got errors %v, want none", errs)
+	}
+}
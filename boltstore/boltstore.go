@@ -0,0 +1,320 @@
+// Package boltstore implements an appdash.Store backed by a bbolt database
+// file, for durable single-binary deployments.
+//
+// Spans are stored in one bucket per trace (keyed by trace ID), which
+// contains a sub-bucket per span (keyed by span ID). A span's bucket holds
+// its parent ID and its annotations, keyed by a per-span sequence number so
+// that annotation order and duplicate keys are preserved. A separate time
+// index bucket orders traces by the time they were first collected, which is
+// used to list the most recent traces.
+//
+// Because bbolt commits every write transaction atomically, a store opened
+// after an unclean shutdown contains exactly the spans whose Collect call
+// returned.
+package boltstore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"sourcegraph.com/sourcegraph/appdash"
+	"sourcegraph.com/sourcegraph/appdash/internal/tracetree"
+)
+
+var (
+	tracesBucket = []byte("traces") // trace ID -> span ID -> span data
+	timeBucket   = []byte("time")   // first-collected time + trace ID -> nil
+
+	parentKey = []byte("p") // key of the parent ID in a span bucket
+	timeKey   = []byte("t") // key of the time index key in a trace bucket
+)
+
+// Store is an appdash.Store and appdash.Queryer backed by a bbolt database.
+type Store struct {
+	db *bolt.DB
+}
+
+// Compile-time "implements" check.
+var _ interface {
+	appdash.DeleteStore
+	appdash.Queryer
+	appdash.TraceIterator
+} = (*Store)(nil)
+
+// Open opens (creating if needed) the bbolt database at path and returns a
+// store backed by it. The store should be closed when no longer needed.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	s, err := New(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// New returns a store backed by an already opened bbolt database, creating
+// the buckets it needs if they do not exist.
+func New(db *bolt.DB) (*Store, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(tracesBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(timeBucket)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the underlying database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Collect implements the appdash.Collector interface. Concurrent calls are
+// batched into a single database transaction.
+func (s *Store) Collect(id appdash.SpanID, as ...appdash.Annotation) error {
+	now := time.Now()
+	return s.db.Batch(func(tx *bolt.Tx) error {
+		traces := tx.Bucket(tracesBucket)
+		tb := traces.Bucket(idKey(id.Trace))
+		if tb == nil {
+			var err error
+			tb, err = traces.CreateBucket(idKey(id.Trace))
+			if err != nil {
+				return err
+			}
+
+			// Index the new trace by the time it was first collected.
+			tk := make([]byte, 16)
+			binary.BigEndian.PutUint64(tk, uint64(now.UnixNano()))
+			binary.BigEndian.PutUint64(tk[8:], uint64(id.Trace))
+			if err := tx.Bucket(timeBucket).Put(tk, nil); err != nil {
+				return err
+			}
+			if err := tb.Put(timeKey, tk); err != nil {
+				return err
+			}
+		}
+
+		sb, err := tb.CreateBucketIfNotExists(idKey(id.Span))
+		if err != nil {
+			return err
+		}
+		if err := sb.Put(parentKey, idKey(id.Parent)); err != nil {
+			return err
+		}
+		for _, a := range as {
+			seq, err := sb.NextSequence()
+			if err != nil {
+				return err
+			}
+			if err := sb.Put(idKey(appdash.ID(seq)), encodeAnnotation(a)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Trace implements the appdash.Store interface.
+func (s *Store) Trace(id appdash.ID) (*appdash.Trace, error) {
+	var t *appdash.Trace
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		t, err = readTrace(tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Traces implements the appdash.Queryer interface. Traces are returned most
+// recently collected first. If opts.Timespan is set, only traces first
+// collected within it are returned. The Matchers and MinDuration filters
+// aren't supported.
+func (s *Store) Traces(opts appdash.TracesOpts) ([]*appdash.Trace, error) {
+	if err := appdash.UnsupportedFilters(opts); err != nil {
+		return nil, err
+	}
+	var traces []*appdash.Trace
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if len(opts.TraceIDs) > 0 {
+			for _, id := range opts.TraceIDs {
+				t, err := readTrace(tx, id)
+				if err == appdash.ErrTraceNotFound {
+					continue
+				} else if err != nil {
+					return err
+				}
+				traces = append(traces, t)
+				if opts.Limit > 0 && len(traces) >= opts.Limit {
+					break
+				}
+			}
+			return nil
+		}
+
+		var start, end int64
+		if !opts.Timespan.S.IsZero() {
+			start = opts.Timespan.S.UnixNano()
+		}
+		if !opts.Timespan.E.IsZero() {
+			end = opts.Timespan.E.UnixNano()
+		}
+		c := tx.Bucket(timeBucket).Cursor()
+		for k, _ := c.Last(); k != nil; k, _ = c.Prev() {
+			collected := int64(binary.BigEndian.Uint64(k))
+			if end != 0 && collected > end {
+				continue
+			}
+			if collected < start {
+				break
+			}
+			t, err := readTrace(tx, appdash.ID(binary.BigEndian.Uint64(k[8:])))
+			if err != nil {
+				return err
+			}
+			traces = append(traces, t)
+			if opts.Limit > 0 && len(traces) >= opts.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return traces, nil
+}
+
+// ForEachTrace implements the appdash.TraceIterator interface. Traces are
+// read one at a time, in order of trace ID, from a single read-only
+// transaction, so f sees a consistent view of the store. Because that
+// transaction is open while f is called, f must not write to the store.
+func (s *Store) ForEachTrace(f func(*appdash.Trace) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(tracesBucket).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if v != nil {
+				continue // not a trace bucket
+			}
+			t, err := readTrace(tx, appdash.ID(binary.BigEndian.Uint64(k)))
+			if err == appdash.ErrTraceNotFound {
+				continue
+			} else if err != nil {
+				return err
+			}
+			if err := f(t); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Delete implements the appdash.DeleteStore interface.
+func (s *Store) Delete(traces ...appdash.ID) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(tracesBucket)
+		for _, id := range traces {
+			tb := b.Bucket(idKey(id))
+			if tb == nil {
+				continue
+			}
+			if tk := tb.Get(timeKey); tk != nil {
+				if err := tx.Bucket(timeBucket).Delete(tk); err != nil {
+					return err
+				}
+			}
+			if err := b.DeleteBucket(idKey(id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// readTrace reads and assembles the trace with the given ID.
+func readTrace(tx *bolt.Tx, id appdash.ID) (*appdash.Trace, error) {
+	tb := tx.Bucket(tracesBucket).Bucket(idKey(id))
+	if tb == nil {
+		return nil, appdash.ErrTraceNotFound
+	}
+
+	var spans []appdash.Span
+	err := tb.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return nil // not a span bucket
+		}
+		span := appdash.Span{ID: appdash.SpanID{Trace: id, Span: appdash.ID(binary.BigEndian.Uint64(k))}}
+		sb := tb.Bucket(k)
+		if p := sb.Get(parentKey); p != nil {
+			span.ID.Parent = appdash.ID(binary.BigEndian.Uint64(p))
+		}
+		err := sb.ForEach(func(k, v []byte) error {
+			if bytes.Equal(k, parentKey) {
+				return nil
+			}
+			a, err := decodeAnnotation(v)
+			if err != nil {
+				return err
+			}
+			span.Annotations = append(span.Annotations, a)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		spans = append(spans, span)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(spans) == 0 {
+		return nil, appdash.ErrTraceNotFound
+	}
+	return tracetree.Build(spans), nil
+}
+
+// idKey returns the big-endian encoding of id, so that keys sort by ID.
+func idKey(id appdash.ID) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(id))
+	return b
+}
+
+// encodeAnnotation encodes a as the uvarint length of its key, followed by
+// the key and then the value.
+func encodeAnnotation(a appdash.Annotation) []byte {
+	b := make([]byte, binary.MaxVarintLen64+len(a.Key)+len(a.Value))
+	n := binary.PutUvarint(b, uint64(len(a.Key)))
+	n += copy(b[n:], a.Key)
+	n += copy(b[n:], a.Value)
+	return b[:n]
+}
+
+func decodeAnnotation(b []byte) (appdash.Annotation, error) {
+	keyLen, n := binary.Uvarint(b)
+	if n <= 0 || uint64(len(b)-n) < keyLen {
+		return appdash.Annotation{}, errors.New("boltstore: corrupt annotation")
+	}
+	a := appdash.Annotation{Key: string(b[n : n+int(keyLen)])}
+	if v := b[n+int(keyLen):]; len(v) > 0 {
+		a.Value = append([]byte(nil), v...)
+	}
+	return a, nil
+}
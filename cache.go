@@ -0,0 +1,149 @@
+package appdash
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// A CachingStore is a Store that caches the traces read from a slow
+// backend store in a MemoryStore.
+//
+// Collecting a span through the CachingStore invalidates the cached copy of
+// its trace. Spans collected into the backend by other means (e.g. by
+// another process) are not seen until the cached trace expires, so reads may
+// be stale for up to the cache's TTL.
+type CachingStore struct {
+	backend Store
+	cache   *MemoryStore
+	ttl     time.Duration
+
+	mu        sync.Mutex
+	cached    map[ID]time.Time // trace ID -> time the trace was cached
+	gen       uint64           // incremented whenever a trace is invalidated
+	lastPurge time.Time        // last time expired traces were purged
+}
+
+// NewCachingStore returns a store that reads traces from backend, caching
+// them in cache for up to ttl. The cache should not be used by anything
+// else; its size can be bounded with its SetMaxSpans and SetMaxBytes
+// methods.
+func NewCachingStore(backend Store, cache *MemoryStore, ttl time.Duration) *CachingStore {
+	return &CachingStore{
+		backend:   backend,
+		cache:     cache,
+		ttl:       ttl,
+		cached:    map[ID]time.Time{},
+		lastPurge: time.Now(),
+	}
+}
+
+// Compile-time "implements" check.
+var _ interface {
+	DeleteStore
+	Queryer
+} = (*CachingStore)(nil)
+
+// Collect implements the Collector interface by collecting the span into the
+// backend and invalidating the cached copy of its trace.
+func (cs *CachingStore) Collect(id SpanID, anns ...Annotation) error {
+	err := cs.backend.Collect(id, anns...)
+	cs.invalidate(id.Trace)
+	return err
+}
+
+// Trace implements the Store interface by returning the cached trace, or
+// reading it from the backend and caching it if it is not cached or has
+// expired.
+func (cs *CachingStore) Trace(id ID) (*Trace, error) {
+	cs.mu.Lock()
+	at, ok := cs.cached[id]
+	gen := cs.gen
+	cs.mu.Unlock()
+	if ok && time.Since(at) < cs.ttl {
+		t, err := cs.cache.Trace(id)
+		if err == nil {
+			return t, nil
+		}
+		// Evicted from the cache (e.g. due to its size limits).
+	}
+
+	t, err := cs.backend.Trace(id)
+	if err != nil {
+		return nil, err
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.gen != gen {
+		// A trace was invalidated while reading from the backend, so t
+		// may already be stale; don't cache it.
+		return t, nil
+	}
+	cs.cache.Delete(id)
+	if err := collectTree(cs.cache, t); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	cs.cached[id] = now
+	if now.Sub(cs.lastPurge) > cs.ttl {
+		cs.purgeNoLock(now)
+	}
+	return t, nil
+}
+
+// Traces implements the Queryer interface by calling the backend's Traces
+// method, bypassing the cache. It returns an error if the backend does not
+// implement Queryer.
+func (cs *CachingStore) Traces(opts TracesOpts) ([]*Trace, error) {
+	return queryTraces(cs.backend, opts)
+}
+
+// Delete implements the DeleteStore interface by deleting the traces from
+// the backend and the cache. It returns an error if the backend does not
+// implement DeleteStore.
+func (cs *CachingStore) Delete(traces ...ID) error {
+	ds, ok := cs.backend.(DeleteStore)
+	if !ok {
+		return fmt.Errorf("appdash: %T does not implement DeleteStore", cs.backend)
+	}
+	err := ds.Delete(traces...)
+	cs.invalidate(traces...)
+	return err
+}
+
+// invalidate removes the given traces from the cache.
+func (cs *CachingStore) invalidate(traces ...ID) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.gen++
+	for _, id := range traces {
+		if _, ok := cs.cached[id]; ok {
+			delete(cs.cached, id)
+			cs.cache.Delete(id)
+		}
+	}
+}
+
+// purgeNoLock removes expired traces from the cache. The cs.mu lock must be
+// held while calling purgeNoLock.
+func (cs *CachingStore) purgeNoLock(now time.Time) {
+	cs.lastPurge = now
+	var expired []ID
+	for id, at := range cs.cached {
+		if now.Sub(at) >= cs.ttl {
+			expired = append(expired, id)
+			delete(cs.cached, id)
+		}
+	}
+	if len(expired) > 0 {
+		cs.cache.DeleteTraces(expired...)
+	}
+}
+
+// collectTree collects all of the spans of the trace t into c.
+func collectTree(c Collector, t *Trace) error {
+	return t.Walk(func(t *Trace) error {
+		return c.Collect(t.Span.ID, t.Span.Annotations...)
+	})
+}
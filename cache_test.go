@@ -0,0 +1,61 @@
+package appdash
+
+import (
+	"testing"
+	"time"
+)
+
+// countingStore counts the calls to its Trace method.
+type countingStore struct {
+	*MemoryStore
+	reads int
+}
+
+func (s *countingStore) Trace(id ID) (*Trace, error) {
+	s.reads++
+	return s.MemoryStore.Trace(id)
+}
+
+func TestCachingStore(t *testing.T) {
+	backend := &countingStore{MemoryStore: NewMemoryStore()}
+	cs := NewCachingStore(backend, NewMemoryStore(), 20*time.Millisecond)
+	s := storeT{t, cs}
+
+	s.MustCollect(SpanID{Trace: 1, Span: 1, Parent: 0}, Annotation{Key: "k", Value: []byte("v")})
+	s.MustCollect(SpanID{Trace: 1, Span: 2, Parent: 1})
+
+	s.MustTrace(1)
+	tr := s.MustTrace(1)
+	if backend.reads != 1 {
+		t.Errorf("got %d backend reads, want 1 (cached)", backend.reads)
+	}
+	if len(tr.Sub) != 1 || len(tr.Annotations) != 1 {
+		t.Errorf("got cached trace %v, want root with annotation and 1 child", tr)
+	}
+
+	// Collecting through the store invalidates the cached trace.
+	s.MustCollect(SpanID{Trace: 1, Span: 3, Parent: 1})
+	if tr := s.MustTrace(1); len(tr.Sub) != 2 {
+		t.Errorf("got %d children after Collect, want 2", len(tr.Sub))
+	}
+	if backend.reads != 2 {
+		t.Errorf("got %d backend reads, want 2", backend.reads)
+	}
+
+	// Direct backend writes are seen once the cached trace expires.
+	backend.Collect(SpanID{Trace: 1, Span: 4, Parent: 1})
+	if tr := s.MustTrace(1); len(tr.Sub) != 2 {
+		t.Errorf("got %d children before expiry, want 2 (stale)", len(tr.Sub))
+	}
+	time.Sleep(30 * time.Millisecond)
+	if tr := s.MustTrace(1); len(tr.Sub) != 3 {
+		t.Errorf("got %d children after expiry, want 3", len(tr.Sub))
+	}
+
+	if err := cs.Delete(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cs.Trace(1); err != ErrTraceNotFound {
+		t.Errorf("got error %v after Delete, want ErrTraceNotFound", err)
+	}
+}
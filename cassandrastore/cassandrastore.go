@@ -0,0 +1,318 @@
+// Package cassandrastore implements an appdash.Store backed by Cassandra (or
+// ScyllaDB), for high span volumes.
+//
+// Spans are stored in a table partitioned by trace ID and clustered by span
+// ID, with each span's annotations in a list that is appended to by every
+// Collect. Root spans are additionally indexed in a table partitioned by
+// hour, which is used to list recent traces. All rows are written with a TTL,
+// so retention needs no separate cleanup.
+//
+// Collect is asynchronous: spans are queued in memory and written in
+// unlogged batches by a background goroutine. Use Flush to wait for queued
+// spans to be written, and Close to flush and stop the background goroutine.
+//
+// Reads tolerate eventually consistent results, such as children that are
+// visible before their root span; such traces are assembled in the same way
+// as MemoryStore assembles traces whose root has not been collected yet.
+package cassandrastore
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+
+	"sourcegraph.com/sourcegraph/appdash"
+	"sourcegraph.com/sourcegraph/appdash/internal/tracetree"
+)
+
+// Schema is the CQL schema used by the store, created by New in the
+// session's keyspace if it doesn't exist.
+var Schema = []string{
+	`CREATE TABLE IF NOT EXISTS appdash_spans (
+		trace_id    bigint,
+		span_id     bigint,
+		parent_id   bigint,
+		annotations list<frozen<tuple<text, blob>>>,
+		PRIMARY KEY ((trace_id), span_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS appdash_recent_traces (
+		bucket    text,
+		collected timestamp,
+		trace_id  bigint,
+		PRIMARY KEY ((bucket), collected, trace_id)
+	) WITH CLUSTERING ORDER BY (collected DESC, trace_id ASC)`,
+}
+
+const (
+	// DefaultTTL is the default time for which spans are retained.
+	DefaultTTL = 72 * time.Hour
+
+	// DefaultBatchSize is the default maximum number of spans written in a
+	// single batch.
+	DefaultBatchSize = 100
+
+	// DefaultFlushInterval is the default interval at which queued spans
+	// are written.
+	DefaultFlushInterval = 500 * time.Millisecond
+
+	// bucketFormat is the time format of appdash_recent_traces buckets.
+	bucketFormat = "2006010215"
+)
+
+// Store is an appdash.Store and appdash.Queryer backed by Cassandra.
+type Store struct {
+	// TTL is the time for which spans are retained.
+	TTL time.Duration
+
+	// BatchSize is the maximum number of spans written in a single batch.
+	BatchSize int
+
+	// Log is used to log errors writing queued spans, which are not returned
+	// by Collect. If nil, the standard logger is used.
+	Log *log.Logger
+
+	session *gocql.Session
+
+	mu      sync.Mutex // protects queue
+	queue   []queuedSpan
+	flushMu sync.Mutex // serializes Flush
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// annotation is the tuple<text, blob> representation of an annotation.
+type annotation struct {
+	Key   string
+	Value []byte
+}
+
+type queuedSpan struct {
+	id   appdash.SpanID
+	anns appdash.Annotations
+	at   time.Time
+}
+
+// Compile-time "implements" check.
+var _ interface {
+	appdash.DeleteStore
+	appdash.Queryer
+} = (*Store)(nil)
+
+// New creates the store's tables if needed and returns a store using the
+// given session, which flushes queued spans every flushInterval (or
+// DefaultFlushInterval, if zero).
+func New(session *gocql.Session, flushInterval time.Duration) (*Store, error) {
+	for _, stmt := range Schema {
+		if err := session.Query(stmt).Exec(); err != nil {
+			return nil, fmt.Errorf("cassandrastore: creating schema: %s", err)
+		}
+	}
+	if flushInterval == 0 {
+		flushInterval = DefaultFlushInterval
+	}
+	s := &Store{
+		TTL:       DefaultTTL,
+		BatchSize: DefaultBatchSize,
+		session:   session,
+		stop:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	go s.flushEvery(flushInterval)
+	return s, nil
+}
+
+// Collect implements the appdash.Collector interface by queueing the span to
+// be written asynchronously.
+func (s *Store) Collect(id appdash.SpanID, as ...appdash.Annotation) error {
+	s.mu.Lock()
+	s.queue = append(s.queue, queuedSpan{id: id, anns: as, at: time.Now()})
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Store) flushEvery(interval time.Duration) {
+	defer close(s.stopped)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if err := s.Flush(); err != nil {
+				s.logf("cassandrastore: writing spans: %s", err)
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *Store) logf(format string, args ...interface{}) {
+	if s.Log != nil {
+		s.Log.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// Flush writes all queued spans, returning the first error that occurred.
+func (s *Store) Flush() error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	queue := s.queue
+	s.queue = nil
+	s.mu.Unlock()
+
+	batchSize := s.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	ttl := int(s.TTL / time.Second)
+
+	var firstErr error
+	for len(queue) > 0 {
+		n := batchSize
+		if n > len(queue) {
+			n = len(queue)
+		}
+		b := s.session.NewBatch(gocql.UnloggedBatch)
+		for _, sp := range queue[:n] {
+			anns := make([]annotation, len(sp.anns))
+			for i, a := range sp.anns {
+				anns[i] = annotation{Key: a.Key, Value: a.Value}
+			}
+			b.Query(`UPDATE appdash_spans USING TTL ? SET parent_id = ?, annotations = annotations + ? WHERE trace_id = ? AND span_id = ?`,
+				ttl, int64(sp.id.Parent), anns, int64(sp.id.Trace), int64(sp.id.Span))
+			if sp.id.IsRoot() {
+				b.Query(`INSERT INTO appdash_recent_traces (bucket, collected, trace_id) VALUES (?, ?, ?) USING TTL ?`,
+					sp.at.UTC().Format(bucketFormat), sp.at, int64(sp.id.Trace), ttl)
+			}
+		}
+		if err := s.session.ExecuteBatch(b); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		queue = queue[n:]
+	}
+	return firstErr
+}
+
+// Close flushes any queued spans and stops the background flushing
+// goroutine. It does not close the session.
+func (s *Store) Close() error {
+	close(s.stop)
+	<-s.stopped
+	return s.Flush()
+}
+
+// Trace implements the appdash.Store interface.
+func (s *Store) Trace(id appdash.ID) (*appdash.Trace, error) {
+	iter := s.session.Query(`SELECT span_id, parent_id, annotations FROM appdash_spans WHERE trace_id = ?`, int64(id)).Iter()
+	var (
+		spans            []appdash.Span
+		spanID, parentID int64
+		anns             []annotation
+	)
+	for iter.Scan(&spanID, &parentID, &anns) {
+		span := appdash.Span{ID: appdash.SpanID{Trace: id, Span: appdash.ID(spanID), Parent: appdash.ID(parentID)}}
+		for _, a := range anns {
+			if len(a.Value) == 0 {
+				a.Value = nil
+			}
+			span.Annotations = append(span.Annotations, appdash.Annotation{Key: a.Key, Value: a.Value})
+		}
+		spans = append(spans, span)
+		anns = nil
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	if len(spans) == 0 {
+		return nil, appdash.ErrTraceNotFound
+	}
+	return tracetree.Build(spans), nil
+}
+
+// Traces implements the appdash.Queryer interface. Traces are returned by
+// the time their root span was collected, most recent first, looking back no
+// further than the store's TTL. If opts.Timespan is set, only traces whose
+// root span was collected within it are returned. The Matchers and
+// MinDuration filters aren't supported.
+func (s *Store) Traces(opts appdash.TracesOpts) ([]*appdash.Trace, error) {
+	if err := appdash.UnsupportedFilters(opts); err != nil {
+		return nil, err
+	}
+	ids := opts.TraceIDs
+	if len(ids) == 0 {
+		end := time.Now()
+		if !opts.Timespan.E.IsZero() && opts.Timespan.E.Before(end) {
+			end = opts.Timespan.E
+		}
+		start := end.Add(-s.TTL)
+		if !opts.Timespan.S.IsZero() && opts.Timespan.S.After(start) {
+			start = opts.Timespan.S
+		}
+
+		seen := map[appdash.ID]bool{}
+	buckets:
+		for _, bucket := range buckets(start, end) {
+			iter := s.session.Query(`SELECT trace_id FROM appdash_recent_traces WHERE bucket = ? AND collected >= ? AND collected <= ?`,
+				bucket, start, end).Iter()
+			var id int64
+			for iter.Scan(&id) {
+				if seen[appdash.ID(id)] {
+					continue // root span collected more than once
+				}
+				seen[appdash.ID(id)] = true
+				ids = append(ids, appdash.ID(id))
+				if opts.Limit > 0 && len(ids) >= opts.Limit {
+					iter.Close()
+					break buckets
+				}
+			}
+			if err := iter.Close(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var traces []*appdash.Trace
+	for _, id := range ids {
+		t, err := s.Trace(id)
+		if err == appdash.ErrTraceNotFound {
+			continue // expired
+		} else if err != nil {
+			return nil, err
+		}
+		traces = append(traces, t)
+		if opts.Limit > 0 && len(traces) >= opts.Limit {
+			break
+		}
+	}
+	return traces, nil
+}
+
+// buckets returns the appdash_recent_traces buckets covering the given time
+// range, most recent first.
+func buckets(start, end time.Time) []string {
+	var bs []string
+	start = start.UTC().Truncate(time.Hour)
+	for t := end.UTC().Truncate(time.Hour); !t.Before(start); t = t.Add(-time.Hour) {
+		bs = append(bs, t.Format(bucketFormat))
+	}
+	return bs
+}
+
+// Delete implements the appdash.DeleteStore interface. Index entries of
+// deleted traces are left to expire.
+func (s *Store) Delete(traces ...appdash.ID) error {
+	for _, id := range traces {
+		if err := s.session.Query(`DELETE FROM appdash_spans WHERE trace_id = ?`, int64(id)).Exec(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
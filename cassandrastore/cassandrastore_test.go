@@ -0,0 +1,77 @@
+package cassandrastore
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+
+	"sourcegraph.com/sourcegraph/appdash"
+	"sourcegraph.com/sourcegraph/appdash/internal/storetest"
+)
+
+// syncStore makes Collect synchronous, so that the conformance tests can read
+// spans back immediately.
+type syncStore struct {
+	*Store
+}
+
+func (s syncStore) Collect(id appdash.SpanID, as ...appdash.Annotation) error {
+	if err := s.Store.Collect(id, as...); err != nil {
+		return err
+	}
+	return s.Store.Flush()
+}
+
+// TestStore runs the conformance tests against the cluster given by the
+// APPDASH_TEST_CASSANDRA environment variable (a comma-separated list of
+// hosts), in the appdash_test keyspace, or is skipped if it is not set.
+func TestStore(t *testing.T) {
+	hosts := os.Getenv("APPDASH_TEST_CASSANDRA")
+	if hosts == "" {
+		t.Skip("APPDASH_TEST_CASSANDRA not set")
+	}
+
+	cluster := gocql.NewCluster(strings.Split(hosts, ",")...)
+	session, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = session.Query(`CREATE KEYSPACE IF NOT EXISTS appdash_test WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}`).Exec()
+	session.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cluster.Keyspace = "appdash_test"
+	cluster.Consistency = gocql.Quorum
+	session, err = cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+
+	storetest.Test(t, func(t *testing.T) appdash.Store {
+		for _, table := range []string{"appdash_spans", "appdash_recent_traces"} {
+			if err := session.Query(`TRUNCATE ` + table).Exec(); err != nil && !strings.Contains(err.Error(), "unconfigured table") {
+				t.Fatal(err)
+			}
+		}
+		s, err := New(session, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return syncStore{s}
+	})
+}
+
+func TestBuckets(t *testing.T) {
+	end := time.Date(2016, 6, 1, 2, 30, 0, 0, time.UTC)
+	got := buckets(end.Add(-2*time.Hour), end)
+	want := []string{"2016060102", "2016060101", "2016060100"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got buckets %v, want %v", got, want)
+	}
+}
@@ -126,8 +126,11 @@ func (a *demoApp) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 <li><a href="/api-calls">Visit a page that issues some API calls</a></li>
 </ul>`)
 	case "/api-calls":
+		// Group the API calls under a child span of the request's span.
+		rec := appdash.NewRecorder(span, a.collector).ChildWithName("API calls")
+		start := time.Now()
 		httpClient := &http.Client{
-			Transport: &httptrace.Transport{Recorder: appdash.NewRecorder(span, a.collector), SetName: true},
+			Transport: &httptrace.Transport{Recorder: rec, SetName: true},
 		}
 		resp, err := httpClient.Get(a.baseURL.ResolveReference(&url.URL{Path: "/endpoint-A"}).String())
 		if err == nil {
@@ -141,6 +144,8 @@ func (a *demoApp) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		if err == nil {
 			defer resp.Body.Close()
 		}
+		rec.Event(appdash.Timespan{S: start, E: time.Now()})
+		rec.Finish()
 		io.WriteString(w, `<a href="/">Home</a><br><br><p>I just made 3 API calls. Check the trace below to see them!</p>`)
 	case "/endpoint-A":
 		time.Sleep(250 * time.Millisecond)
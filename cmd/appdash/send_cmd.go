@@ -23,9 +23,15 @@ func init() {
 // SendCmd is the command for running Appdash in sender mode, where it sends
 // sample data to a remote collector.
 type SendCmd struct {
-	CollectorAddr  string `short:"c" long:"collector" description:"collector listen address" default:":7701"`
-	CollectorProto string `short:"p" long:"proto" description:"collector protocol (tcp or tls)" default:"tcp"`
+	CollectorAddr  string `short:"c" long:"collector" description:"collector address (host:port, or unix:///path/to/socket; a URL for http)" default:":7701"`
+	CollectorProto string `short:"p" long:"proto" description:"collector protocol (tcp, tls, http or udp)" default:"tcp"`
 	ServerName     string `short:"s" long:"server-name" description:"server name (required for TLS)"`
+	TLSCert        string `long:"tls-cert" description:"TLS client certificate file (for servers that require client certificates)"`
+	TLSKey         string `long:"tls-key" description:"TLS client key file (for servers that require client certificates)"`
+	TLSCA          string `long:"tls-ca" description:"CA certificate file to verify the server's certificate against (default: system CAs)"`
+	Compression    string `long:"compression" description:"compression to offer to the collector server (gzip)"`
+	HTTPAuth       string `long:"http-auth" description:"Authorization header to send to the HTTP collector (e.g. 'Bearer token')"`
+	Token          string `long:"token" env:"APPDASH_COLLECTOR_TOKEN" description:"shared secret to authenticate with the collector server (tcp and tls)"`
 	Debug          bool   `short:"d" long:"debug" description:"debug log"`
 }
 
@@ -34,30 +40,61 @@ var sendCmd SendCmd
 // Execute execudes the commands with the given arguments and returns an error,
 // if any.
 func (c *SendCmd) Execute(args []string) error {
+	var collector appdash.Collector
 	var rc *appdash.RemoteCollector
 	switch c.CollectorProto {
 	case "tcp":
 		rc = appdash.NewRemoteCollector(c.CollectorAddr)
 	case "tls":
-		rc = appdash.NewTLSRemoteCollector(c.CollectorAddr, &tls.Config{ServerName: c.ServerName})
+		tc := &tls.Config{ServerName: c.ServerName}
+		if c.TLSCert != "" || c.TLSKey != "" {
+			cert, err := tls.LoadX509KeyPair(c.TLSCert, c.TLSKey)
+			if err != nil {
+				return err
+			}
+			tc.Certificates = []tls.Certificate{cert}
+		}
+		if c.TLSCA != "" {
+			pool, err := loadCertPool(c.TLSCA)
+			if err != nil {
+				return err
+			}
+			tc.RootCAs = pool
+		}
+		rc = appdash.NewTLSRemoteCollector(c.CollectorAddr, tc)
+	case "http":
+		hc := appdash.NewHTTPCollector(c.CollectorAddr)
+		hc.Authorization = c.HTTPAuth
+		hc.Compression = c.Compression
+		hc.BatchSize = 100
+		hc.Debug = c.Debug
+		collector = hc
+	case "udp":
+		collector = appdash.NewUDPCollector(c.CollectorAddr)
 	default:
 		return fmt.Errorf("unknown proto: %q", c.CollectorProto)
 	}
-	rc.Debug = c.Debug
+	if rc != nil {
+		rc.Debug = c.Debug
+		rc.Compression = c.Compression
+		rc.Token = c.Token
+		collector = rc
+	}
 
 	rcc := &appdash.ChunkedCollector{
-		Collector:   rc,
+		Collector:   collector,
 		MinInterval: time.Second,
 	}
 
 	log.Println("Sending sample data...")
-	if err := sampleData(rc); err != nil {
+	if err := sampleData(rcc); err != nil {
+		rcc.Stop()
 		return err
 	}
 	log.Println("Done sending sample data.")
 
 	log.Println("Flushing chunked collector...")
-	if err := rcc.Flush(); err != nil {
+	if err := rcc.Close(); err != nil {
 		return err
 	}
 	log.Println("Done flushing chunked collector.")
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"crypto/subtle"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"fmt"
 	"io/ioutil"
@@ -11,6 +13,9 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
 	"strings"
@@ -38,17 +43,48 @@ type ServeCmd struct {
 	HTTPAddr      string `long:"http" description:"HTTP listen address" default:":7700"`
 	SampleData    bool   `long:"sample-data" description:"add sample data"`
 
-	StoreFile       string        `short:"f" long:"store-file" description:"persisted store file" default:"/tmp/appdash.gob"`
-	PersistInterval time.Duration `short:"p" long:"persist-interval" description:"interval between persisting store to file" default:"2s"`
+	StoreFile        string        `short:"f" long:"store-file" description:"persisted store file" default:"/tmp/appdash.gob"`
+	PersistInterval  time.Duration `short:"p" long:"persist-interval" description:"interval between persisting store to file" default:"2s"`
+	StoreCompression int           `long:"store-compression" description:"gzip compression level of the persisted store file (0 to disable, -1 for default level)" default:"0"`
+	StoreStrict      bool          `long:"store-strict" description:"fail to start if the persisted store file is corrupt, instead of falling back to the previous snapshot"`
+	PersistJournal   bool          `long:"persist-journal" description:"persist the store as a snapshot plus an append-only journal of collected spans, instead of rewriting the store file every persist-interval"`
 
 	Debug bool `short:"d" long:"debug" description:"debug log"`
 	Trace bool `long:"trace" description:"trace log"`
 
 	DeleteAfter time.Duration `long:"delete-after" description:"delete traces after a certain age (0 to disable)" default:"30m"`
 
+	AggregateBucket  time.Duration `long:"aggregate-bucket" description:"size of the buckets of time that the dashboard aggregates the traces by" default:"1m"`
+	AggregateBuckets int           `long:"aggregate-buckets" description:"number of the most recent aggregation buckets that are kept" default:"4320"`
+
+	ShutdownTimeout time.Duration `long:"shutdown-timeout" description:"on SIGTERM or interrupt, how long to wait for the collector to finish receiving spans" default:"10s"`
+
 	TLSCert string `long:"tls-cert" description:"TLS certificate file (if set, enables TLS)"`
 	TLSKey  string `long:"tls-key" description:"TLS key file (if set, enables TLS)"`
 
+	Compression bool `long:"compression" description:"accept compressed connections from collector clients that offer it"`
+
+	TLSClientCA string `long:"tls-client-ca" description:"CA certificate file (if set, collector clients must present a TLS certificate signed by it)"`
+
+	CollectorTokens            []string `long:"collector-token" env:"APPDASH_COLLECTOR_TOKENS" env-delim:"," description:"if set, collector clients must authenticate with one of these shared secrets (may be repeated)"`
+	CollectorRequireSecureAuth bool     `long:"collector-require-secure-auth" description:"reject collector clients that connect over plaintext TCP when collector tokens are set"`
+
+	CollectorRateLimit     float64 `long:"collector-rate-limit" description:"maximum number of spans per second accepted from each collector client (0 for unlimited)" default:"0"`
+	CollectorRateBurst     int     `long:"collector-rate-burst" description:"number of spans a collector client may send at once above the rate limit (default: the rate limit)"`
+	CollectorRateLimitDrop bool    `long:"collector-rate-limit-drop" description:"drop the spans over the rate limit, instead of throttling the client"`
+
+	CollectorIdleTimeout time.Duration `long:"collector-idle-timeout" description:"close collector client connections that send nothing for this long" default:"1h"`
+	CollectorMaxConns    int           `long:"collector-max-conns" description:"maximum number of concurrent collector client connections" default:"10000"`
+	CollectorQueueConns  bool          `long:"collector-queue-conns" description:"wait for a connection to close before accepting more than collector-max-conns, instead of refusing them"`
+
+	CollectorSocket     string `long:"collector-socket" description:"if set, also accept collector clients on this unix socket (e.g. /var/run/appdash.sock), for clients on the same host"`
+	CollectorSocketMode string `long:"collector-socket-mode" description:"permissions of the collector unix socket, in octal" default:"0660"`
+
+	CollectorUDPAddr string `long:"collector-udp" description:"if set, also receive spans sent by UDP collector clients on this address (e.g. :7701)"`
+
+	HTTPCollector     string `long:"http-collector" description:"if set, also accept spans POSTed by HTTP collector clients at this path of the HTTP server (e.g. /collect)"`
+	HTTPCollectorAuth string `long:"http-collector-auth" description:"if set, the Authorization header that HTTP collector clients must send (e.g. 'Bearer token')"`
+
 	BasicAuth string `long:"basic-auth" description:"if set to 'user:passwd', require HTTP Basic Auth for web app"`
 }
 
@@ -63,38 +99,74 @@ func (c *ServeCmd) Execute(args []string) error {
 		Queryer  = memStore
 	)
 
-	if c.StoreFile != "" {
-		f, err := os.Open(c.StoreFile)
-		if err != nil && !os.IsNotExist(err) {
+	if err := memStore.SetCompressionLevel(c.StoreCompression); err != nil {
+		return err
+	}
+
+	var deleteStore appdash.DeleteStore = memStore
+	var closeStore func() error // persists the store on shutdown
+	if c.StoreFile != "" && c.PersistJournal {
+		js, err := appdash.OpenJournalStore(memStore, c.StoreFile, nil)
+		if err != nil {
 			return err
 		}
-		if f != nil {
-			if n, err := memStore.ReadFrom(f); err == nil {
-				log.Printf("Read %d traces from file %s", n, c.StoreFile)
-			} else if err != nil {
-				f.Close()
-				return err
-			}
-			if err := f.Close(); err != nil {
-				return err
-			}
+		log.Printf("Read %d traces from file %s and its journal", memStore.Usage().Traces, c.StoreFile)
+		Store, deleteStore = js, js
+		closeStore = js.Close
+	} else if c.StoreFile != "" {
+		n, err := appdash.ReadFile(memStore, c.StoreFile, c.StoreStrict)
+		if err != nil {
+			return err
 		}
+		log.Printf("Read %d traces from file %s", n, c.StoreFile)
 		if c.PersistInterval != 0 {
 			go func() {
 				if err := appdash.PersistEvery(memStore, c.PersistInterval, c.StoreFile); err != nil {
 					log.Fatal(err)
 				}
 			}()
+			closeStore = func() error { return appdash.WriteFile(memStore, c.StoreFile) }
 		}
 	}
 
 	if c.DeleteAfter > 0 {
-		Store = &appdash.RecentStore{
-			MinEvictAge: c.DeleteAfter,
-			DeleteStore: memStore,
-			Debug:       true,
+		recentStore := appdash.NewRecentStore(deleteStore, c.DeleteAfter)
+		recentStore.EvictInterval = appdash.DefaultRecentEvictInterval
+		recentStore.Debug = true
+		Store = recentStore
+	}
+
+	// Aggregate the durations of the traces for the dashboard, persisted
+	// next to the store file.
+	aggStore := appdash.NewAggregateStore(Store)
+	aggStore.BucketSize = c.AggregateBucket
+	aggStore.Buckets = c.AggregateBuckets
+	if c.StoreFile != "" {
+		aggFile := c.StoreFile + ".aggregate"
+		if _, err := appdash.ReadFile(aggStore.MemoryStore, aggFile, c.StoreStrict); err != nil {
+			return err
+		}
+		if c.PersistInterval != 0 {
+			go func() {
+				if err := appdash.PersistEvery(aggStore.MemoryStore, c.PersistInterval, aggFile); err != nil {
+					log.Fatal(err)
+				}
+			}()
+			closeStoreData := closeStore
+			closeStore = func() error {
+				if closeStoreData != nil {
+					if err := closeStoreData(); err != nil {
+						return err
+					}
+				}
+				if err := aggStore.Flush(); err != nil {
+					return err
+				}
+				return appdash.WriteFile(aggStore.MemoryStore, aggFile)
+			}
 		}
 	}
+	Store = aggStore
 
 	url, err := c.urlOrDefault()
 	if err != nil {
@@ -106,6 +178,7 @@ func (c *ServeCmd) Execute(args []string) error {
 	}
 	app.Store = Store
 	app.Queryer = Queryer
+	app.Aggregator = aggStore
 
 	var h http.Handler
 	if c.BasicAuth != "" {
@@ -123,6 +196,19 @@ func (c *ServeCmd) Execute(args []string) error {
 		h = app
 	}
 
+	if c.HTTPCollector != "" {
+		// The collector handler is mounted outside of the Basic Auth
+		// handler, since it has its own authorization.
+		ch := appdash.NewCollectorHandler(appdash.NewLocalCollector(Store))
+		ch.Authorization = c.HTTPCollectorAuth
+		ch.Debug = c.Debug
+		mux := http.NewServeMux()
+		mux.Handle(c.HTTPCollector, ch)
+		mux.Handle("/", h)
+		h = mux
+		log.Printf("appdash HTTP collector accepting spans at %s", c.HTTPCollector)
+	}
+
 	if c.SampleData {
 		sampleData(Store)
 	}
@@ -145,11 +231,20 @@ func (c *ServeCmd) Execute(args []string) error {
 			log.Fatal(err)
 		}
 		tc.Certificates = []tls.Certificate{cert}
+		proto = fmt.Sprintf("TLS cert %s, key %s", c.TLSCert, c.TLSKey)
+		if c.TLSClientCA != "" {
+			pool, err := loadCertPool(c.TLSClientCA)
+			if err != nil {
+				log.Fatal(err)
+			}
+			tc.ClientAuth = tls.RequireAndVerifyClientCert
+			tc.ClientCAs = pool
+			proto += fmt.Sprintf(", client CA %s", c.TLSClientCA)
+		}
 		l, err = tls.Listen("tcp", c.CollectorAddr, &tc)
 		if err != nil {
 			log.Fatal(err)
 		}
-		proto = fmt.Sprintf("TLS cert %s, key %s", c.TLSCert, c.TLSKey)
 	} else {
 		var err error
 		l, err = net.Listen("tcp", c.CollectorAddr)
@@ -158,11 +253,63 @@ func (c *ServeCmd) Execute(args []string) error {
 		}
 		proto = "plaintext TCP (no security)"
 	}
+	if len(c.CollectorTokens) > 0 {
+		proto += fmt.Sprintf(", %d collector tokens", len(c.CollectorTokens))
+	}
 	log.Printf("appdash collector listening on %s (%s)", c.CollectorAddr, proto)
 	cs := appdash.NewServer(l, appdash.NewLocalCollector(Store))
 	cs.Debug = c.Debug
 	cs.Trace = c.Trace
+	cs.Compression = c.Compression
+	cs.Tokens = c.CollectorTokens
+	cs.RequireSecureAuth = c.CollectorRequireSecureAuth
+	cs.RateLimit = c.CollectorRateLimit
+	cs.RateBurst = c.CollectorRateBurst
+	cs.DropOverLimit = c.CollectorRateLimitDrop
+	cs.IdleTimeout = c.CollectorIdleTimeout
+	cs.MaxConns = c.CollectorMaxConns
+	cs.QueueConns = c.CollectorQueueConns
 	go cs.Start()
+	servers := []*appdash.CollectorServer{cs}
+
+	if c.CollectorSocket != "" {
+		mode, err := strconv.ParseUint(c.CollectorSocketMode, 8, 32)
+		if err != nil {
+			return fmt.Errorf("invalid collector socket mode %q: %s", c.CollectorSocketMode, err)
+		}
+		ul, err := appdash.ListenUnix(c.CollectorSocket, os.FileMode(mode))
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("appdash collector listening on unix socket %s", c.CollectorSocket)
+		us := appdash.NewServer(ul, appdash.NewLocalCollector(Store))
+		us.Debug = c.Debug
+		us.Trace = c.Trace
+		us.Compression = c.Compression
+		us.Tokens = c.CollectorTokens
+		us.RequireSecureAuth = c.CollectorRequireSecureAuth
+		us.RateLimit = c.CollectorRateLimit
+		us.RateBurst = c.CollectorRateBurst
+		us.DropOverLimit = c.CollectorRateLimitDrop
+		us.IdleTimeout = c.CollectorIdleTimeout
+		us.MaxConns = c.CollectorMaxConns
+		us.QueueConns = c.CollectorQueueConns
+		go us.Start()
+		servers = append(servers, us)
+	}
+	go c.shutdownOnSignal(closeStore, servers...)
+
+	if c.CollectorUDPAddr != "" {
+		pc, err := net.ListenPacket("udp", c.CollectorUDPAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		us := appdash.NewUDPServer(pc, appdash.NewLocalCollector(Store))
+		us.Debug = c.Debug
+		us.Trace = c.Trace
+		go us.Start()
+		log.Printf("appdash UDP collector listening on %s", c.CollectorUDPAddr)
+	}
 
 	if c.TLSCert != "" || c.TLSKey != "" {
 		log.Printf("appdash HTTPS server listening on %s (TLS cert %s, key %s)", c.HTTPAddr, c.TLSCert, c.TLSKey)
@@ -173,6 +320,29 @@ func (c *ServeCmd) Execute(args []string) error {
 	return http.ListenAndServe(c.HTTPAddr, h)
 }
 
+// shutdownOnSignal waits for SIGTERM or an interrupt, and then shuts down
+// the collector servers, persists the store (if closeStore is non-nil) and
+// exits.
+func (c *ServeCmd) shutdownOnSignal(closeStore func() error, servers ...*appdash.CollectorServer) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	log.Printf("Received %s, shutting down", <-sig)
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.ShutdownTimeout)
+	defer cancel()
+	for _, cs := range servers {
+		if err := cs.Shutdown(ctx); err != nil {
+			log.Printf("Shutting down collector: %s", err)
+		}
+	}
+	if closeStore != nil {
+		if err := closeStore(); err != nil {
+			log.Fatalf("Persisting store: %s", err)
+		}
+	}
+	os.Exit(0)
+}
+
 // urlOrDefault returns c.URL if non-empty, otherwise it returns c.HTTPAddr
 // with localhost" as the default host (if not specified in c.HTTPAddr).
 func (c *ServeCmd) urlOrDefault() (*url.URL, error) {
@@ -220,3 +390,16 @@ func (h *basicAuthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("WWW-Authenticate", `Basic realm="appdash"`)
 	http.Error(w, "unauthorized", http.StatusUnauthorized)
 }
+
+// loadCertPool returns a pool of the PEM-encoded certificates in file.
+func loadCertPool(file string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", file)
+	}
+	return pool, nil
+}
@@ -1,26 +1,71 @@
 package appdash
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
 	"crypto/tls"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
+	"math/rand"
 	"net"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	pio "github.com/gogo/protobuf/io"
+	"github.com/gogo/protobuf/proto"
 	"sourcegraph.com/sourcegraph/appdash/internal/wire"
 )
 
-// maxMessageSize is the maximum buffer size for delimited protobuf messages.
-// Effectively, the client may request the server to allocate a buffer of up to
-// maxMessageSize -- so choose carefully.
+// DefaultMaxMessageSize is the default maximum size of the delimited protobuf
+// messages sent to and received by a collector server (see
+// CollectorServer.MaxMessageSize). Effectively, a client may request the
+// server to allocate a buffer of up to this size -- so choose carefully.
 //
 // We use 1 MB here.
-const maxMessageSize = 1 * 1024 * 1024
+const DefaultMaxMessageSize = 1 * 1024 * 1024
+
+// ErrMessageTooLarge is the error returned by RemoteCollector.Collect when
+// the collection would be sent in a message larger than its MaxMessageSize.
+var ErrMessageTooLarge = errors.New("appdash: collect packet exceeds maximum message size")
+
+// The version of the collector protocol implemented by this package.
+// Servers accept clients with the same or an older major version (with any
+// minor version), including clients that don't send a version at all
+// (version 0, the unversioned protocol of older clients). Clients work with
+// servers of any version.
+//
+// Version 1.1 adds batch frames, which carry many packets at once, version
+// 1.2 adds heartbeat frames, version 1.3 adds the high 64 bits of
+// 128-bit trace IDs to span IDs (which servers of older versions ignore,
+// keeping the low 64 bits), and version 1.4 adds the flags of span IDs
+// (which servers of older versions ignore).
+const (
+	ProtocolMajor = 1
+	ProtocolMinor = 4
+)
+
+// CompressionGzip is the name of gzip compression in the collector protocol
+// (see RemoteCollector.Compression).
+const CompressionGzip = "gzip"
+
+// Upper bounds of the size of the wire encoding of a CollectPacket's span
+// ID, and of one of its annotations on top of the size of its key and value.
+const (
+	maxSpanIDWireSize     = 2 + 5*(2+binary.MaxVarintLen64)
+	maxAnnotationOverhead = 4 + 2*binary.MaxVarintLen64
+)
 
 // A Collector collects events that occur in spans.
 type Collector interface {
@@ -47,6 +92,37 @@ func newCollectPacket(s SpanID, as Annotations) *wire.CollectPacket {
 // been subsequently dropped.
 var ErrQueueDropped = errors.New("ChunkedCollector queue entirely dropped (trace data will be missing)")
 
+// ErrQueueFull is the error returned by ChunkedCollector.Collect when the
+// collection was dropped because the queue was full (see OverflowPolicy).
+var ErrQueueFull = errors.New("ChunkedCollector queue full (collection dropped)")
+
+// ErrCollectorClosed is the error returned by ChunkedCollector.Collect after
+// the collector has been stopped or closed.
+var ErrCollectorClosed = errors.New("ChunkedCollector is closed")
+
+// An OverflowPolicy determines what a ChunkedCollector does when a
+// collection would make its queue exceed MaxQueueSize.
+type OverflowPolicy int
+
+const (
+	// QueueDropAll drops the entire queue, and Collect returns
+	// ErrQueueDropped.
+	QueueDropAll OverflowPolicy = iota
+
+	// QueueDropNewest drops the new collection, and Collect returns
+	// ErrQueueFull.
+	QueueDropNewest
+
+	// QueueDropOldest drops the queued spans that were first collected
+	// longest ago until the new collection fits.
+	QueueDropOldest
+
+	// QueueBlock makes Collect wait up to BlockTimeout for a flush to make
+	// room in the queue. If there still isn't room, the new collection is
+	// dropped and Collect returns ErrQueueFull.
+	QueueBlock
+)
+
 // ChunkedCollector groups annotations together that have the same span and
 // calls its underlying collector's Collect method with the chunked data
 // periodically, instead of immediately. This is more efficient, especially in
@@ -64,20 +140,33 @@ var ErrQueueDropped = errors.New("ChunkedCollector queue entirely dropped (trace
 // The flow of a ChunkedCollector is that:
 //
 //  - It receives a collection.
-//    - If the queue size exceeds MaxQueueSize in bytes, the pending queue is
-//      entirely dropped and ErrQueueDropped is returned.
+//    - If the queue size would exceed MaxQueueSize in bytes, the Overflow
+//      policy is applied: by default, the pending queue is entirely dropped
+//      and ErrQueueDropped is returned.
 //    - Otherwise, if the queue would not exceed that size, the collection is
 //      added to the queue.
 //  - After MinInterval (or if Flush is called manually), all queued collections
-//    are passed off to the underlying collector. If the overall Flush time
-//    measured after each underlying Collect call exceeds FlushTimeout, the
-//    pending queue is entirely dropped and ErrQueueDropped is returned.
+//    are passed off to the underlying collector, merged into one collection
+//    per span (in the order the spans were first collected). If the overall
+//    Flush time measured after each underlying Collect call exceeds
+//    FlushTimeout, the pending queue is entirely dropped and ErrQueueDropped
+//    is returned.
 //  - If the queue has been entirely dropped as a result of one of the above
 //    cases, entire traces and/or parts of their data will be missing. For this
-//    reason, you may specify a Log for debugging purposes.
+//    reason, you may specify a Log for debugging purposes, and Dropped reports
+//    the number of collections dropped.
+//
+// If a SpillDir is set, the queue is instead spilled to disk when it is full
+// or when the underlying collector fails, and the spilled collections are
+// sent in order (before any newer ones) once the underlying collector
+// succeeds again. This lets a ChunkedCollector ride out outages of a remote
+// collector without losing trace data, at the cost of disk space.
 //
 type ChunkedCollector struct {
-	// Collector is the underlying collector that spans are sent to.
+	// Collector is the underlying collector that spans are sent to. If it
+	// has a Flush method (like HTTPCollector), it is called at the end of
+	// each flush. A RemoteCollector (or RemoteCollectorPool) is sent the
+	// whole queue at once, in batch frames if the server supports them.
 	Collector
 
 	// MinInterval specifies the minimum interval at which to call Flush
@@ -95,13 +184,59 @@ type ChunkedCollector struct {
 	FlushTimeout time.Duration
 
 	// MaxQueueSize, if non-zero, is the maximum size in bytes that the pending
-	// queue of collections may grow to before being entirely dropped (trace data
-	// lost). In the event that the queue is dropped, Collect will return
-	// ErrQueueDropped.
+	// queue of collections may grow to. What happens to a collection that
+	// would exceed it is determined by Overflow; by default, the queue is
+	// entirely dropped (trace data lost) and Collect returns ErrQueueDropped.
 	//
 	// Default MaxQueueSize = 32 * 1024 * 1024 (32 MB).
 	MaxQueueSize uint64
 
+	// Overflow is what Collect does when a collection would make the queue
+	// exceed MaxQueueSize. A collection that is larger than MaxQueueSize on
+	// its own is always dropped (unless Overflow is QueueDropAll).
+	//
+	// Default Overflow = QueueDropAll.
+	Overflow OverflowPolicy
+
+	// BlockTimeout is how long Collect waits for room in the queue when
+	// Overflow is QueueBlock.
+	//
+	// Default BlockTimeout = MinInterval.
+	BlockTimeout time.Duration
+
+	// MaxMessageSize, if non-zero, is the maximum size in bytes of the
+	// message that a single collection of the underlying collector results
+	// in (see RemoteCollector.MaxMessageSize). The annotations of spans that
+	// would exceed it are split over several collections, each below the
+	// limit (unless a single annotation exceeds it).
+	//
+	// Default MaxMessageSize = DefaultMaxMessageSize.
+	MaxMessageSize int
+
+	// CloseTimeout, if non-zero, is used instead of FlushTimeout for the
+	// final flush performed by Close, which may need to send more spans than
+	// usual.
+	CloseTimeout time.Duration
+
+	// SpillDir, if non-empty, is the directory (created if needed) where
+	// collections are written instead of being dropped when the queue is
+	// full, when the underlying collector fails, or when a flush times out.
+	// The spilled collections are sent by the following flushes, oldest
+	// first, once the underlying collector succeeds again, and the ones left
+	// when the process exits are sent by the next ChunkedCollector that uses
+	// the same directory. A collection may be sent more than once if the
+	// process exits while spilled collections are being sent.
+	//
+	// The directory must not be shared by several ChunkedCollectors at once.
+	SpillDir string
+
+	// MaxSpillSize is the maximum size in bytes of the collections spilled
+	// to SpillDir. Collections that would exceed it are dropped, and Flush
+	// (or Collect) returns ErrSpillFull.
+	//
+	// Default MaxSpillSize = DefaultMaxSpillSize.
+	MaxSpillSize int64
+
 	// Log, if non-nil, is used to log warnings like when the queue is entirely
 	// dropped (and hence trace data was lost).
 	Log *log.Logger
@@ -114,38 +249,79 @@ type ChunkedCollector struct {
 	// It is primarily used for debugging purposes.
 	OnFlush func(queueSize int)
 
+	// OnCompact, if non-nil, is invoked at the start of each Flush (after
+	// OnFlush) with the number of queued collections that were merged into
+	// an earlier collection of the same span, instead of being sent as
+	// separate packets.
+	//
+	// It is primarily used for debugging purposes.
+	OnCompact func(merged int)
+
+	// AfterFlush, if non-nil, is invoked after each Flush operation that is
+	// performed by this collector, with the number of spans that Flush tried
+	// to send and the error it returned (nil if all of them were sent). It is
+	// called without any of the collector's locks held, so it may safely call
+	// back into the collector.
+	//
+	// It is primarily used to log or count failed flushes, which are
+	// otherwise only reported to the next caller of Collect.
+	AfterFlush func(spans int, err error)
+
 	// The last error from the underlying Collector's Collect method,
 	// if any. It will be returned to the next caller of Collect and
 	// this field will be set to nil.
 	lastErr error
 
+	// The error returned by the most recent Flush, as returned by
+	// LastError.
+	lastFlushErr error
+
 	started, stopped bool
 	stopChan         chan struct{}
 
 	queueSizeBytes  uint64
-	pendingBySpanID map[SpanID]Annotations
+	pendingBySpanID map[SpanID]*pendingSpan
+	pendingOrder    []SpanID // span IDs in the order they were first queued
+
+	spill *spillQueue // the queue in SpillDir, once started (nil if disabled)
 
-	// mu protects pendingBySpanID, lastErr, started, stopped, and stopChan.
+	// flushed, if non-nil, is closed when the queue is next emptied by
+	// Flush, to wake up Collect calls waiting for room (see QueueBlock).
+	flushed chan struct{}
+
+	dropped uint64 // number of collections dropped
+
+	// mu protects pendingBySpanID, pendingOrder, spill, queueSizeBytes,
+	// flushed, dropped, lastErr, lastFlushErr, started, stopped, and stopChan.
 	mu sync.Mutex
 }
 
+// pendingSpan is the queued data of a span.
+type pendingSpan struct {
+	anns        Annotations
+	size        uint64 // approximate size in bytes
+	collections int    // number of collections queued
+}
+
 // NewChunkedCollector is shorthand for:
 //
 // 	c := &ChunkedCollector{
-// 		Collector:    c,
-// 		MinInterval:  500 * time.Millisecond,
-// 		FlushTimeout: 2 * time.Second,
-// 		MaxQueueSize: 32 * 1024 * 1024, // 32 MB
-// 		Log:          log.New(os.Stderr, "appdash: ", log.LstdFlags),
+// 		Collector:      c,
+// 		MinInterval:    500 * time.Millisecond,
+// 		FlushTimeout:   2 * time.Second,
+// 		MaxQueueSize:   32 * 1024 * 1024, // 32 MB
+// 		MaxMessageSize: DefaultMaxMessageSize,
+// 		Log:            log.New(os.Stderr, "appdash: ", log.LstdFlags),
 // 	}
 //
 func NewChunkedCollector(c Collector) *ChunkedCollector {
 	return &ChunkedCollector{
-		Collector:    c,
-		MinInterval:  500 * time.Millisecond,
-		FlushTimeout: 2 * time.Second,
-		MaxQueueSize: 32 * 1024 * 1024, // 32 MB
-		Log:          log.New(os.Stderr, "appdash: ", log.LstdFlags),
+		Collector:      c,
+		MinInterval:    500 * time.Millisecond,
+		FlushTimeout:   2 * time.Second,
+		MaxQueueSize:   32 * 1024 * 1024, // 32 MB
+		MaxMessageSize: DefaultMaxMessageSize,
+		Log:            log.New(os.Stderr, "appdash: ", log.LstdFlags),
 	}
 }
 
@@ -157,7 +333,7 @@ func (cc *ChunkedCollector) Collect(span SpanID, anns ...Annotation) error {
 	defer cc.mu.Unlock()
 
 	if cc.stopped {
-		return errors.New("ChunkedCollector is stopped")
+		return ErrCollectorClosed
 	}
 	if !cc.started {
 		cc.start()
@@ -172,28 +348,34 @@ func (cc *ChunkedCollector) Collect(span SpanID, anns ...Annotation) error {
 		collectionSize += uint64(len(ann.Value))
 	}
 
-	// If the queue would become too large, drop it.
+	// If the queue would become too large, apply the overflow policy.
 	if cc.MaxQueueSize != 0 && cc.queueSizeBytes+collectionSize > cc.MaxQueueSize {
-		if cc.Log != nil {
-			cc.Log.Println("ChunkedCollector: queue entirely dropped (trace data will be missing)")
-			cc.Log.Printf("ChunkedCollector: queueSize:%v queueSizeBytes:%v + collectionSize:%v\n", len(cc.pendingBySpanID), cc.queueSizeBytes, collectionSize)
+		if !cc.spillNoLock(collectionSize) {
+			if err := cc.overflowNoLock(collectionSize); err != nil {
+				return err
+			}
 		}
-		cc.pendingBySpanID = nil
-		cc.queueSizeBytes = 0
-		return ErrQueueDropped
 	}
 	cc.queueSizeBytes += collectionSize
 
 	if cc.pendingBySpanID == nil {
-		cc.pendingBySpanID = make(map[SpanID]Annotations)
+		cc.pendingBySpanID = make(map[SpanID]*pendingSpan)
+	}
+	p, present := cc.pendingBySpanID[span]
+	if !present {
+		p = &pendingSpan{}
+		cc.pendingBySpanID[span] = p
+		cc.pendingOrder = append(cc.pendingOrder, span)
 	}
-	if p, present := cc.pendingBySpanID[span]; present {
-		if len(anns) > 0 {
-			cc.pendingBySpanID[span] = append(p, anns...)
+	if len(anns) > 0 {
+		if p.anns == nil {
+			p.anns = anns
+		} else {
+			p.anns = append(p.anns, anns...)
 		}
-	} else {
-		cc.pendingBySpanID[span] = anns
 	}
+	p.size += collectionSize
+	p.collections++
 
 	if err := cc.lastErr; err != nil {
 		cc.lastErr = nil
@@ -202,50 +384,396 @@ func (cc *ChunkedCollector) Collect(span SpanID, anns ...Annotation) error {
 	return nil
 }
 
+// Sampled implements the SamplingCollector interface by asking the
+// underlying collector, if it is a SamplingCollector.
+func (cc *ChunkedCollector) Sampled(span SpanID) (keep, ok bool) {
+	return sampled(cc.Collector, span)
+}
+
+// spillNoLock spills the whole queue to disk to make room for a collection
+// of the given size, and reports whether it did. The cc.mu lock must be held
+// while calling spillNoLock.
+func (cc *ChunkedCollector) spillNoLock(collectionSize uint64) bool {
+	if cc.spill == nil || collectionSize > cc.MaxQueueSize {
+		return false
+	}
+	// The spilled collections that can't be written are counted as dropped
+	// by the spill queue.
+	if err := cc.spill.spill(pendingSpans(cc.pendingBySpanID, cc.pendingOrder)); err != nil {
+		if cc.Log != nil {
+			cc.Log.Printf("ChunkedCollector: spilling queue: %s", err)
+		}
+		cc.lastErr = err
+	}
+	cc.pendingBySpanID = nil
+	cc.pendingOrder = nil
+	cc.queueSizeBytes = 0
+	return true
+}
+
+// pendingSpans returns the pending spans, in the given order.
+func pendingSpans(pending map[SpanID]*pendingSpan, order []SpanID) []queuedSpan {
+	spans := make([]queuedSpan, 0, len(order))
+	for _, span := range order {
+		if p, ok := pending[span]; ok {
+			spans = append(spans, queuedSpan{span: span, anns: p.anns})
+		}
+	}
+	return spans
+}
+
+// overflowNoLock applies the overflow policy when a collection of the given
+// size doesn't fit in the queue. If it returns nil, there is now room for
+// the collection. The cc.mu lock must be held while calling overflowNoLock;
+// it is released while waiting for room under QueueBlock.
+func (cc *ChunkedCollector) overflowNoLock(collectionSize uint64) error {
+	fits := func() bool { return cc.queueSizeBytes+collectionSize <= cc.MaxQueueSize }
+	if cc.Overflow != QueueDropAll && collectionSize > cc.MaxQueueSize {
+		// Would never fit.
+		cc.dropped++
+		return ErrQueueFull
+	}
+
+	switch cc.Overflow {
+	case QueueDropNewest:
+		cc.dropped++
+		return ErrQueueFull
+
+	case QueueDropOldest:
+		for !fits() && len(cc.pendingOrder) > 0 {
+			old := cc.pendingOrder[0]
+			cc.pendingOrder = cc.pendingOrder[1:]
+			if p, ok := cc.pendingBySpanID[old]; ok {
+				delete(cc.pendingBySpanID, old)
+				cc.queueSizeBytes -= p.size
+				cc.dropped += uint64(p.collections)
+			}
+		}
+		return nil
+
+	case QueueBlock:
+		timeout := cc.BlockTimeout
+		if timeout == 0 {
+			timeout = cc.MinInterval
+		}
+		deadline := time.Now().Add(timeout)
+		for !fits() {
+			remaining := deadline.Sub(time.Now())
+			if cc.stopped {
+				cc.dropped++
+				return ErrCollectorClosed
+			}
+			if remaining <= 0 {
+				cc.dropped++
+				return ErrQueueFull
+			}
+			if cc.flushed == nil {
+				cc.flushed = make(chan struct{})
+			}
+			flushed := cc.flushed
+			cc.mu.Unlock()
+			t := time.NewTimer(remaining)
+			select {
+			case <-flushed:
+			case <-t.C:
+			}
+			t.Stop()
+			cc.mu.Lock()
+		}
+		return nil
+
+	default: // QueueDropAll
+		if cc.Log != nil {
+			cc.Log.Println("ChunkedCollector: queue entirely dropped (trace data will be missing)")
+			cc.Log.Printf("ChunkedCollector: queueSize:%v queueSizeBytes:%v + collectionSize:%v\n", len(cc.pendingBySpanID), cc.queueSizeBytes, collectionSize)
+		}
+		for _, p := range cc.pendingBySpanID {
+			cc.dropped += uint64(p.collections)
+		}
+		cc.dropped++ // the new collection
+		cc.pendingBySpanID = nil
+		cc.pendingOrder = nil
+		cc.queueSizeBytes = 0
+		return ErrQueueDropped
+	}
+}
+
+// Dropped returns the number of collections that have been dropped, either
+// because the queue (or SpillDir) was full or because a flush timed out.
+func (cc *ChunkedCollector) Dropped() uint64 {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.spill != nil {
+		return cc.dropped + cc.spill.droppedCount()
+	}
+	return cc.dropped
+}
+
 // Flush immediately sends all pending spans to the underlying
 // collector.
 func (cc *ChunkedCollector) Flush() error {
+	return cc.flush(cc.FlushTimeout)
+}
+
+// flush sends all pending spans to the underlying collector, dropping (or
+// spilling) the rest of them once timeout (if non-zero) has elapsed.
+func (cc *ChunkedCollector) flush(timeout time.Duration) error {
 	start := time.Now()
+	timedOut := func() bool { return timeout != 0 && time.Since(start) > timeout }
 
 	cc.mu.Lock()
 	pendingBySpanID := cc.pendingBySpanID
+	pendingOrder := cc.pendingOrder
 	queueSizeBytes := cc.queueSizeBytes
+	spill := cc.spill
 	cc.pendingBySpanID = nil
+	cc.pendingOrder = nil
 	cc.queueSizeBytes = 0
+	if cc.flushed != nil {
+		close(cc.flushed)
+		cc.flushed = nil
+	}
 	cc.mu.Unlock()
 
+	queueSize := len(pendingBySpanID)
 	if cc.OnFlush != nil {
-		cc.OnFlush(len(pendingBySpanID))
+		cc.OnFlush(queueSize)
+	}
+	merged := compactPending(pendingBySpanID)
+	if cc.OnCompact != nil {
+		cc.OnCompact(merged)
 	}
 
-	var errs []error
-	for spanID, p := range pendingBySpanID {
-		if err := cc.Collector.Collect(spanID, p...); err != nil {
+	var (
+		errs   []error
+		unsent []queuedSpan // spans to spill
+	)
+	if spill != nil {
+		if err := spill.drain(cc.Collector, timedOut); err != nil {
 			errs = append(errs, err)
 		}
-		if cc.FlushTimeout != 0 && time.Since(start) > cc.FlushTimeout {
-			cc.mu.Lock()
-			if cc.Log != nil {
-				cc.Log.Println("ChunkedCollector: queue entirely dropped (trace data will be missing)")
-				cc.Log.Printf("ChunkedCollector: queueSize:%v queueSizeBytes:%v\n", len(pendingBySpanID), queueSizeBytes)
+		if !spill.empty() {
+			// Queue the pending spans behind the spilled ones, so that
+			// they are sent in order.
+			unsent = pendingSpans(pendingBySpanID, pendingOrder)
+			pendingBySpanID, pendingOrder = nil, nil
+		}
+	}
+	if bc, ok := cc.Collector.(batchCollector); ok && len(pendingOrder) > 0 {
+		var batch []queuedSpan
+		for _, spanID := range pendingOrder {
+			if p, ok := pendingBySpanID[spanID]; ok {
+				for _, anns := range splitAnnotations(p.anns, cc.MaxMessageSize) {
+					batch = append(batch, queuedSpan{span: spanID, anns: anns})
+				}
 			}
-			cc.mu.Unlock()
+		}
+		failed, err := bc.collectBatch(batch)
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		// The spans that the batch failed to send are handled like those
+		// of other collectors: they are sent one at a time below, unless
+		// the flush has already timed out, in which case they are spilled
+		// or dropped.
+		pendingBySpanID, pendingOrder = failedSpans(pendingBySpanID, failed)
+		if timedOut() && len(pendingOrder) > 0 {
+			if spill != nil {
+				unsent = append(unsent, pendingSpans(pendingBySpanID, pendingOrder)...)
+			} else {
+				cc.dropTimedOut(pendingBySpanID, queueSize, queueSizeBytes)
+				errs = append(errs, ErrQueueDropped)
+			}
+			pendingOrder = nil
+		}
+	}
+	for _, spanID := range pendingOrder {
+		p, ok := pendingBySpanID[spanID]
+		if !ok {
+			continue
+		}
+		var failed bool
+		for _, anns := range splitAnnotations(p.anns, cc.MaxMessageSize) {
+			if err := cc.Collector.Collect(spanID, anns...); err != nil {
+				errs = append(errs, err)
+				failed = true
+			}
+		}
+		if failed && spill != nil {
+			unsent = append(unsent, queuedSpan{span: spanID, anns: p.anns})
+		}
+		delete(pendingBySpanID, spanID)
+		if timedOut() && spill != nil {
+			// Spill the rest instead of dropping it.
+			unsent = append(unsent, pendingSpans(pendingBySpanID, pendingOrder)...)
+			break
+		}
+		if timedOut() {
+			cc.dropTimedOut(pendingBySpanID, queueSize, queueSizeBytes)
 			errs = append(errs, ErrQueueDropped)
 			break
 		}
 	}
+	if spill != nil {
+		if err := spill.spill(unsent); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if f, ok := cc.Collector.(flusher); ok {
+		// Send the collections that the underlying collector batches
+		// (e.g. an HTTPCollector).
+		if err := f.Flush(); err != nil {
+			errs = append(errs, err)
+		}
+	}
 
+	var err error
 	if len(errs) == 1 {
-		return errs[0]
+		err = errs[0]
 	} else if len(errs) > 1 {
-		return fmt.Errorf("ChunkedCollector: multiple errors: %v", errs)
+		err = fmt.Errorf("ChunkedCollector: multiple errors: %v", errs)
 	}
-	return nil
+
+	cc.mu.Lock()
+	cc.lastFlushErr = err
+	cc.mu.Unlock()
+	if cc.AfterFlush != nil {
+		cc.AfterFlush(queueSize, err)
+	}
+	return err
+}
+
+// dropTimedOut counts the pending spans that a flush that timed out didn't
+// send as dropped. queueSize and queueSizeBytes are those of the queue that
+// was flushed, for logging.
+func (cc *ChunkedCollector) dropTimedOut(pending map[SpanID]*pendingSpan, queueSize int, queueSizeBytes uint64) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.Log != nil {
+		cc.Log.Println("ChunkedCollector: queue entirely dropped (trace data will be missing)")
+		cc.Log.Printf("ChunkedCollector: queueSize:%v queueSizeBytes:%v\n", queueSize, queueSizeBytes)
+	}
+	for _, p := range pending {
+		cc.dropped += uint64(p.collections) // not sent
+	}
+}
+
+// failedSpans returns the pending spans that a batchCollector failed to
+// send (see collectBatch), in the order of the failed collections, and
+// with only their annotations that weren't sent.
+func failedSpans(pending map[SpanID]*pendingSpan, failed []queuedSpan) (map[SpanID]*pendingSpan, []SpanID) {
+	failedBySpanID := make(map[SpanID]*pendingSpan, len(failed))
+	var order []SpanID
+	for _, s := range failed {
+		p, ok := failedBySpanID[s.span]
+		if !ok {
+			p = &pendingSpan{collections: pending[s.span].collections}
+			failedBySpanID[s.span] = p
+			order = append(order, s.span)
+		}
+		p.anns = append(p.anns, s.anns...)
+	}
+	return failedBySpanID, order
+}
+
+// compactPending merges the annotations of the spans that were collected
+// several times, so that each of their keys appears once, in the position of
+// its first appearance and with the value of its last one (like
+// Annotations.StringMap). It returns the number of collections that were
+// merged into earlier ones.
+func compactPending(pending map[SpanID]*pendingSpan) (merged int) {
+	for _, p := range pending {
+		if p.collections > 1 {
+			p.anns = compactAnnotations(p.anns)
+			merged += p.collections - 1
+		}
+	}
+	return merged
+}
+
+// compactAnnotations returns anns without duplicate keys, keeping each key
+// where it first appears with the value of its last appearance. It doesn't
+// modify anns.
+func compactAnnotations(anns Annotations) Annotations {
+	index := make(map[string]int, len(anns))
+	compacted := make(Annotations, 0, len(anns))
+	for _, a := range anns {
+		if i, ok := index[a.Key]; ok {
+			compacted[i].Value = a.Value
+			continue
+		}
+		index[a.Key] = len(compacted)
+		compacted = append(compacted, a)
+	}
+	return compacted
+}
+
+// A flusher is a collector that batches collections until it is flushed.
+type flusher interface {
+	Flush() error
+}
+
+// A batchCollector is a collector that can send many collections at once
+// more cheaply than one at a time (e.g. a RemoteCollector). ChunkedCollector
+// sends its whole queue to it when flushing, and then the collections that
+// it failed to send one at a time.
+type batchCollector interface {
+	// collectBatch sends the spans, and returns the ones that it failed to
+	// send (other than those too large to ever be sent), along with the
+	// first error that occurred.
+	collectBatch([]queuedSpan) (failed []queuedSpan, err error)
+}
+
+// LastError returns the error returned by the most recent Flush (whether it
+// was performed automatically or called manually), or nil if it succeeded.
+// Unlike the errors returned by Collect, it is not reset by reading it.
+func (cc *ChunkedCollector) LastError() error {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.lastFlushErr
+}
+
+// splitAnnotations splits anns into groups that can each be sent in a
+// message of at most maxSize bytes. If maxSize is zero, anns is not split.
+func splitAnnotations(anns Annotations, maxSize int) []Annotations {
+	if maxSize <= 0 {
+		return []Annotations{anns}
+	}
+	var (
+		groups []Annotations
+		start  int
+		size   = maxSpanIDWireSize
+	)
+	for i, a := range anns {
+		n := maxAnnotationOverhead + len(a.Key) + len(a.Value)
+		if size+n > maxSize && i > start {
+			groups = append(groups, anns[start:i])
+			start, size = i, maxSpanIDWireSize
+		}
+		size += n
+	}
+	return append(groups, anns[start:])
 }
 
 func (cc *ChunkedCollector) start() {
 	cc.stopChan = make(chan struct{})
 	cc.started = true
+	if cc.SpillDir != "" {
+		maxSize := cc.MaxSpillSize
+		if maxSize == 0 {
+			maxSize = DefaultMaxSpillSize
+		}
+		spill, err := openSpillQueue(cc.SpillDir, maxSize)
+		if err != nil {
+			if cc.Log != nil {
+				cc.Log.Printf("ChunkedCollector: opening spill directory: %s", err)
+			}
+			cc.lastErr = err
+		} else {
+			cc.spill = spill
+		}
+	}
 	go func() {
 		for {
 			t := time.After(cc.MinInterval)
@@ -264,46 +792,193 @@ func (cc *ChunkedCollector) start() {
 }
 
 // Stop stops the collector. After stopping, no more data will be sent
-// to the underlying collector and calls to Collect will fail.
+// to the underlying collector and calls to Collect will fail with
+// ErrCollectorClosed. Pending spans are discarded; use Close to send them.
 func (cc *ChunkedCollector) Stop() {
 	cc.mu.Lock()
 	defer cc.mu.Unlock()
-	close(cc.stopChan)
+	cc.stopNoLock()
+}
+
+// Close stops the collector like Stop, and then sends all pending spans to
+// the underlying collector, waiting at most CloseTimeout (or FlushTimeout,
+// if zero) for them to be sent. It returns the error of this final flush.
+//
+// Close should be called when the process shuts down, so that the spans
+// recorded just before are not lost. Calling Close more than once, or after
+// Stop, has no further effect and returns nil.
+func (cc *ChunkedCollector) Close() error {
+	cc.mu.Lock()
+	stopped := cc.stopped
+	cc.stopNoLock()
+	cc.mu.Unlock()
+	if stopped {
+		return nil
+	}
+
+	timeout := cc.CloseTimeout
+	if timeout == 0 {
+		timeout = cc.FlushTimeout
+	}
+	return cc.flush(timeout)
+}
+
+// stopNoLock stops the background flushing goroutine, if it was started.
+// The cc.mu lock must be held while calling stopNoLock.
+func (cc *ChunkedCollector) stopNoLock() {
+	if cc.stopped {
+		return
+	}
+	if cc.started {
+		close(cc.stopChan)
+	}
 	cc.stopped = true
 }
 
+// ErrReconnecting is the error returned by RemoteCollector.Collect while it
+// is waiting to reconnect to the collector server (see
+// RemoteCollector.BufferSize).
+var ErrReconnecting = errors.New("RemoteCollector: reconnecting to collector server (collection dropped)")
+
+const (
+	// DefaultMinBackoff is the default RemoteCollector.MinBackoff.
+	DefaultMinBackoff = 100 * time.Millisecond
+
+	// DefaultMaxBackoff is the default RemoteCollector.MaxBackoff.
+	DefaultMaxBackoff = 30 * time.Second
+
+	// DefaultDialTimeout is the default RemoteCollector.DialTimeout.
+	DefaultDialTimeout = 5 * time.Second
+
+	// DefaultWriteTimeout is the default RemoteCollector.WriteTimeout.
+	DefaultWriteTimeout = 10 * time.Second
+)
+
 // NewRemoteCollector creates a collector that sends data to a
 // collector server (created with NewServer). It sends data
 // immediately when Collect is called. To send data in chunks, use a
 // ChunkedCollector.
+//
+// addr is either a TCP address ("host:port"), or the path of a unix socket
+// prefixed with "unix://" (e.g. "unix:///var/run/appdash.sock"), for a
+// server on the same host (see ListenUnix).
 func NewRemoteCollector(addr string) *RemoteCollector {
-	return &RemoteCollector{
-		addr: addr,
-		dial: func() (net.Conn, error) {
-			return net.Dial("tcp", addr)
-		},
+	network, address := "tcp", addr
+	if strings.HasPrefix(addr, unixAddrPrefix) {
+		network, address = "unix", strings.TrimPrefix(addr, unixAddrPrefix)
 	}
+	rc := &RemoteCollector{addr: addr}
+	rc.dial = func() (net.Conn, error) {
+		d := net.Dialer{Timeout: rc.dialTimeout()}
+		return d.Dial(network, address)
+	}
+	return rc
 }
 
-// NewTLSRemoteCollector creates a RemoteCollector that uses TLS.
+// unixAddrPrefix is the prefix of the unix socket addresses accepted by
+// NewRemoteCollector.
+const unixAddrPrefix = "unix://"
+
+// NewTLSRemoteCollector creates a RemoteCollector that uses TLS. If the
+// server requires clients to authenticate with a certificate (see
+// NewTLSServer), set it in tlsConfig.Certificates.
 func NewTLSRemoteCollector(addr string, tlsConfig *tls.Config) *RemoteCollector {
-	return &RemoteCollector{
-		addr: addr,
-		dial: func() (net.Conn, error) {
-			return tls.Dial("tcp", addr, tlsConfig)
-		},
+	rc := &RemoteCollector{addr: addr}
+	rc.dial = func() (net.Conn, error) {
+		// The dial timeout includes the TLS handshake.
+		d := &net.Dialer{Timeout: rc.dialTimeout()}
+		return tls.DialWithDialer(d, "tcp", addr, tlsConfig)
 	}
+	return rc
 }
 
 // A RemoteCollector sends data to a collector server (created with
 // NewServer).
+//
+// If the connection to the server fails, Collect reconnects immediately.
+// If that fails too (e.g. because the server is restarting), a single
+// background goroutine keeps trying to reconnect, waiting between
+// MinBackoff and MaxBackoff (doubling after each failure, with random
+// jitter) between attempts. In the meantime, collections are either
+// buffered or dropped, according to BufferSize.
 type RemoteCollector struct {
 	addr string
 
 	dial func() (net.Conn, error)
 
-	mu    sync.Mutex      // guards pconn
-	pconn pio.WriteCloser // delimited-protobuf remote connection
+	// MinBackoff and MaxBackoff are the minimum and maximum time to wait
+	// between attempts to reconnect to the server.
+	//
+	// Default MinBackoff = DefaultMinBackoff, MaxBackoff = DefaultMaxBackoff.
+	MinBackoff, MaxBackoff time.Duration
+
+	// DialTimeout is the maximum time to wait for a connection to the
+	// server (including the TLS handshake, for TLS connections) to be
+	// established. A negative DialTimeout disables it.
+	//
+	// Default DialTimeout = DefaultDialTimeout.
+	DialTimeout time.Duration
+
+	// WriteTimeout is the maximum time to wait for each frame to be written
+	// to the connection, so that a server that stopped reading (or a
+	// black-holed route) doesn't block Collect. A timed out write is
+	// handled like any other failure: the client reconnects. A negative
+	// WriteTimeout disables it.
+	//
+	// Default WriteTimeout = DefaultWriteTimeout.
+	WriteTimeout time.Duration
+
+	// BufferSize is the maximum number of collections that are buffered
+	// while reconnecting, to be sent once the connection is reestablished.
+	// When the buffer is full, the oldest collections are dropped.
+	//
+	// If zero, Collect fails fast with ErrReconnecting while reconnecting.
+	BufferSize int
+
+	// Compression, if non-empty, is the compression algorithm to offer to
+	// the server (only CompressionGzip is supported). If the server accepts
+	// it, the connection is compressed after the first collection. Servers
+	// that don't support compression ignore the offer.
+	Compression string
+
+	// Token, if non-empty, is the shared secret that the client sends in
+	// the handshake to authenticate with servers that require one (see
+	// CollectorServer.Tokens). Since it is sent as is, it should only be
+	// used over TLS or unix socket connections. It is never logged.
+	Token string
+
+	// MaxMessageSize is the maximum size in bytes of the message sent for a
+	// collection; Collect returns ErrMessageTooLarge, without sending
+	// anything, for collections that exceed it. It should not exceed the
+	// server's MaxMessageSize. To split large collections, use a
+	// ChunkedCollector.
+	//
+	// Default MaxMessageSize = DefaultMaxMessageSize.
+	MaxMessageSize int
+
+	// HeartbeatInterval, if non-zero, is how long the connection may stay
+	// idle before a heartbeat frame is sent over it, which keeps it open
+	// through NATs and firewalls that drop idle connections. If the server
+	// doesn't acknowledge a heartbeat within HeartbeatInterval (or it can't
+	// be sent), the connection is considered dead and is closed, so that
+	// the next collection reconnects instead of failing. Heartbeats are
+	// only sent to servers that support them (version 1.2 or later of the
+	// protocol).
+	HeartbeatInterval time.Duration
+
+	mu           sync.Mutex            // guards conn, pconn, gz, batch, heartbeat, handshaken, switched, reply, lastWrite, reconnecting, stopRecon, and buffer
+	conn         net.Conn              // the connection to the server
+	pconn        pio.WriteCloser       // delimited-protobuf remote connection
+	gz           *gzip.Writer          // compressor of conn, if compressed
+	batch        bool                  // whether batch frames are sent over conn
+	heartbeat    bool                  // whether heartbeat frames are sent over conn
+	handshaken   bool                  // whether the handshake was sent over conn
+	switched     bool                  // whether the options accepted in the reply are used
+	reply        *serverReply          // the server's reply to the handshake
+	lastWrite    time.Time             // when conn was last written to
+	reconnecting bool                  // whether a reconnect goroutine is running
+	stopRecon    chan struct{}         // closed to stop the reconnect goroutine
+	buffer       []*wire.CollectPacket // collections waiting to be sent after reconnecting
 
 	// Log is the logger to use for errors and warnings. If nil, a new
 	// logger is created.
@@ -330,58 +1005,596 @@ func (rc *RemoteCollector) connect() error {
 
 	c, err := rc.dial()
 	if err == nil {
-		// Create a protobuf delimited writer wrapping the connection. When the
-		// writer is closed, it also closes the underlying connection (see
-		// source code for details).
-		rc.pconn = pio.NewDelimitedWriter(c)
+		rc.setConnNoLock(c)
 	}
 	return err
 }
 
-// Close closes the connection to the server.
-func (rc *RemoteCollector) Close() error {
-	rc.mu.Lock()
-	defer rc.mu.Unlock()
-
-	if rc.pconn != nil {
-		err := rc.pconn.Close()
-		rc.pconn = nil
-		return err
+// setConnNoLock starts using the new connection c. It must be called with
+// rc.mu held.
+func (rc *RemoteCollector) setConnNoLock(c net.Conn) {
+	// Create a protobuf delimited writer wrapping the connection. When the
+	// writer is closed, it also closes the underlying connection (see
+	// source code for details).
+	rc.conn = c
+	rc.pconn = pio.NewDelimitedWriter(c)
+	rc.gz = nil
+	rc.batch = false
+	rc.heartbeat = false
+	rc.handshaken = false
+	rc.switched = false
+	rc.reply = &serverReply{done: make(chan struct{})}
+	rc.lastWrite = time.Now()
+	go rc.readReply(c, rc.reply)
+	if rc.HeartbeatInterval > 0 {
+		go rc.sendHeartbeats(c, rc.reply, rc.HeartbeatInterval)
 	}
-	return nil
 }
 
-func (rc *RemoteCollector) collectAndRetry(p *wire.CollectPacket) error {
-	rc.mu.Lock()
-	defer rc.mu.Unlock()
+// serverReply is the server's reply to the handshake sent over a
+// connection.
+type serverReply struct {
+	done chan struct{} // closed once msg is set
+	msg  *wire.CollectReply
+	acks uint64 // number of heartbeats acknowledged (accessed atomically)
+}
 
-	if rc.pconn != nil {
-		if err := rc.collect(p); err == nil {
-			return nil
+// readReply reads the server's reply to the handshake sent over c, and
+// then the acknowledgments of heartbeats. Servers that use version 0 of the
+// protocol never reply. It closes c once the server closes it (see
+// closeConnNoLock).
+func (rc *RemoteCollector) readReply(c net.Conn, r *serverReply) {
+	defer c.Close()
+
+	// The reply is read without read-ahead, since the acknowledgments
+	// follow it.
+	br := bufio.NewReader(c)
+	msg := &wire.CollectReply{}
+	if err := readDelimited(br, msg, DefaultMaxMessageSize); err == nil {
+		r.msg = msg
+		close(r.done)
+		if msg.Error != nil {
+			rc.log().Printf("Server rejected the connection: %s", msg.GetError())
+		} else if rc.Debug {
+			rc.log().Printf("Server uses protocol version %d.%d", msg.GetMajor(), msg.GetMinor())
 		}
-		if rc.Debug {
-			rc.log().Printf("Reconnecting to send %v", spanIDFromWire(p.Spanid))
+
+		// Each heartbeat is acknowledged with a zero-length frame.
+		for {
+			b, err := br.ReadByte()
+			if err != nil {
+				return
+			}
+			if b == 0 {
+				atomic.AddUint64(&r.acks, 1)
+			}
 		}
 	}
-	if err := rc.connect(); err != nil {
+	// Keep reading, so that closing the connection doesn't reset it.
+	io.Copy(ioutil.Discard, br)
+}
+
+// readDelimited reads a length-delimited message of at most maxSize bytes
+// from br into msg.
+func readDelimited(br *bufio.Reader, msg proto.Message, maxSize int) error {
+	length, err := binary.ReadUvarint(br)
+	if err != nil {
 		return err
 	}
-	return rc.collect(p)
+	if length > uint64(maxSize) {
+		return fmt.Errorf("message of %d bytes exceeds maximum size (%d)", length, maxSize)
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(br, buf); err != nil {
+		return err
+	}
+	return proto.Unmarshal(buf, msg)
 }
 
-func (rc *RemoteCollector) collect(p *wire.CollectPacket) error {
-	if rc.Debug {
-		rc.log().Printf("Sending %v", spanIDFromWire(p.Spanid))
+// sendHeartbeats sends a heartbeat over c whenever it has been idle for
+// interval, once the server has accepted them, until c is closed or
+// replaced. It closes c if a heartbeat can't be sent or isn't
+// acknowledged in time.
+func (rc *RemoteCollector) sendHeartbeats(c net.Conn, r *serverReply, interval time.Duration) {
+	t := time.NewTicker(interval / 2)
+	defer t.Stop()
+	var (
+		sent   uint64    // number of heartbeats sent
+		sentAt time.Time // when the last one was sent
+	)
+	for range t.C {
+		rc.mu.Lock()
+		if rc.conn != c || rc.pconn == nil {
+			rc.mu.Unlock()
+			return
+		}
+		err := rc.switchNoLock()
+		if err == nil && rc.switched && !rc.heartbeat {
+			// The server doesn't support heartbeats.
+			rc.mu.Unlock()
+			return
+		}
+		now := time.Now()
+		if err == nil && rc.heartbeat {
+			if atomic.LoadUint64(&r.acks) < sent {
+				if now.Sub(sentAt) >= interval {
+					err = errors.New("heartbeat not acknowledged")
+				}
+			} else if now.Sub(rc.lastWrite) >= interval {
+				if err = rc.writeHeartbeatNoLock(interval); err == nil {
+					sent++
+					sentAt = now
+				}
+			}
+		}
+		if err != nil {
+			// Reconnect with the next collection.
+			if rc.Debug {
+				rc.log().Printf("Closing connection to %s: %s", rc.addr, err)
+			}
+			rc.pconn.Close()
+			rc.pconn = nil
+			rc.mu.Unlock()
+			return
+		}
+		rc.mu.Unlock()
 	}
+}
 
-	// Send our message, close writer.
-	if err := rc.pconn.WriteMsg(p); err != nil {
+// writeHeartbeatNoLock sends a heartbeat frame, failing if it can't be
+// written within timeout. It must be called with rc.mu held, once the
+// server has accepted heartbeats.
+func (rc *RemoteCollector) writeHeartbeatNoLock(timeout time.Duration) error {
+	rc.conn.SetWriteDeadline(time.Now().Add(timeout))
+	if rc.gz != nil {
+		if _, err := rc.gz.Write([]byte{0}); err != nil {
+			return err
+		}
+		if err := rc.gz.Flush(); err != nil {
+			return err
+		}
+	} else if _, err := rc.conn.Write([]byte{0}); err != nil {
 		return err
 	}
-
-	if rc.Debug {
-		rc.log().Printf("Sent %v", spanIDFromWire(p.Spanid))
-	}
+	rc.lastWrite = time.Now()
+	return nil
+}
+
+// rejectedNoLock returns an error if the server rejected the current
+// connection. It must be called with rc.mu held.
+func (rc *RemoteCollector) rejectedNoLock() error {
+	select {
+	case <-rc.reply.done:
+		if msg := rc.reply.msg; msg.Error != nil {
+			return fmt.Errorf("appdash: collector server rejected connection: %s", msg.GetError())
+		}
+	default:
+	}
+	return nil
+}
+
+// gzipConn is a connection whose writes are compressed.
+type gzipConn struct {
+	*gzip.Writer
+	conn net.Conn
+}
+
+// Close closes the compressed stream and the connection.
+func (c gzipConn) Close() error {
+	c.Writer.Close()
+	return c.conn.Close()
+}
+
+// Close closes the connection to the server, stops reconnecting to it and
+// discards the buffered collections. A later call to Collect connects to
+// the server again.
+func (rc *RemoteCollector) Close() error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if rc.reconnecting {
+		close(rc.stopRecon)
+		rc.reconnecting = false
+		rc.buffer = nil
+	}
+	if rc.pconn != nil {
+		err := rc.closeConnNoLock()
+		rc.pconn = nil
+		return err
+	}
+	return nil
+}
+
+// closeTimeout is how long a RemoteCollector waits for the server to close
+// a connection that it closed (see closeConnNoLock).
+const closeTimeout = 5 * time.Second
+
+// closeConnNoLock closes the connection to the server. If it can, it only
+// closes the writes, and readReply closes the connection once the server
+// closes it too: closing it while a reply is still unread would reset it,
+// and the server would discard the collections that it hasn't read yet.
+// It must be called with rc.mu held.
+func (rc *RemoteCollector) closeConnNoLock() error {
+	cw, ok := rc.conn.(interface{ CloseWrite() error })
+	if !ok {
+		return rc.pconn.Close()
+	}
+	rc.setWriteDeadlineNoLock()
+	if rc.gz != nil {
+		if err := rc.gz.Close(); err != nil {
+			rc.conn.Close()
+			return err
+		}
+	}
+	rc.conn.SetReadDeadline(time.Now().Add(closeTimeout))
+	return cw.CloseWrite()
+}
+
+// dialTimeout returns rc.DialTimeout, or its default (0 if disabled).
+func (rc *RemoteCollector) dialTimeout() time.Duration {
+	switch {
+	case rc.DialTimeout < 0:
+		return 0
+	case rc.DialTimeout == 0:
+		return DefaultDialTimeout
+	}
+	return rc.DialTimeout
+}
+
+// setWriteDeadlineNoLock sets the deadline of the next write to conn,
+// according to rc.WriteTimeout. It must be called with rc.mu held.
+func (rc *RemoteCollector) setWriteDeadlineNoLock() {
+	timeout := rc.WriteTimeout
+	if timeout == 0 {
+		timeout = DefaultWriteTimeout
+	}
+	var deadline time.Time // none if disabled
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	rc.conn.SetWriteDeadline(deadline)
+}
+
+// maxMessageSize returns rc.MaxMessageSize, or its default.
+func (rc *RemoteCollector) maxMessageSize() int {
+	if rc.MaxMessageSize <= 0 {
+		return DefaultMaxMessageSize
+	}
+	return rc.MaxMessageSize
+}
+
+func (rc *RemoteCollector) collectAndRetry(p *wire.CollectPacket) error {
+	maxSize := rc.maxMessageSize()
+	if size := proto.Size(p); size > maxSize {
+		if rc.Debug {
+			rc.log().Printf("Not sending %v: message of %d bytes exceeds MaxMessageSize (%d)", spanIDFromWire(p.Spanid), size, maxSize)
+		}
+		return ErrMessageTooLarge
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if rc.reconnecting {
+		return rc.bufferNoLock(p)
+	}
+
+	if rc.pconn != nil {
+		if err := rc.rejectedNoLock(); err != nil {
+			// Try again later (e.g. once the server has been upgraded).
+			rc.pconn.Close()
+			rc.pconn = nil
+			rc.startReconnectNoLock()
+			return err
+		}
+		if err := rc.collect(p); err == nil {
+			return nil
+		}
+		if rc.Debug {
+			rc.log().Printf("Reconnecting to send %v", spanIDFromWire(p.Spanid))
+		}
+	}
+	if err := rc.connect(); err != nil {
+		if rc.Debug {
+			rc.log().Printf("Connecting to %s: %s (reconnecting in the background)", rc.addr, err)
+		}
+		rc.startReconnectNoLock()
+		if rc.BufferSize > 0 {
+			return rc.bufferNoLock(p)
+		}
+		return err
+	}
+	return rc.collect(p)
+}
+
+// bufferNoLock buffers p to be sent once reconnected, or returns
+// ErrReconnecting if buffering is disabled. It must be called with rc.mu
+// held.
+func (rc *RemoteCollector) bufferNoLock(p *wire.CollectPacket) error {
+	if rc.BufferSize <= 0 {
+		return ErrReconnecting
+	}
+	if len(rc.buffer) >= rc.BufferSize {
+		n := len(rc.buffer) - rc.BufferSize + 1
+		if rc.Debug {
+			rc.log().Printf("Buffer full, dropping %d collections", n)
+		}
+		rc.buffer = append(rc.buffer[:0], rc.buffer[n:]...)
+	}
+	rc.buffer = append(rc.buffer, p)
+	return nil
+}
+
+// startReconnectNoLock starts the goroutine that reconnects to the server
+// in the background. It must be called with rc.mu held.
+func (rc *RemoteCollector) startReconnectNoLock() {
+	rc.reconnecting = true
+	rc.stopRecon = make(chan struct{})
+	go rc.reconnect(rc.stopRecon)
+}
+
+// reconnect tries to reconnect to the server with exponential backoff until
+// it succeeds or stop is closed, and then sends the buffered collections.
+func (rc *RemoteCollector) reconnect(stop chan struct{}) {
+	minBackoff, maxBackoff := rc.MinBackoff, rc.MaxBackoff
+	if minBackoff <= 0 {
+		minBackoff = DefaultMinBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultMaxBackoff
+	}
+	if maxBackoff < minBackoff {
+		maxBackoff = minBackoff
+	}
+
+	backoff := minBackoff
+	for {
+		// Wait between backoff/2 and backoff, so that many clients of a
+		// restarted server don't all reconnect at once.
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-stop:
+			t.Stop()
+			return
+		}
+
+		c, err := rc.dial()
+		if err == nil {
+			if rc.finishReconnect(stop, c) {
+				return
+			}
+		} else if rc.Debug {
+			rc.log().Printf("Reconnecting to %s: %s", rc.addr, err)
+		}
+
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// finishReconnect starts using the new connection c and sends the buffered
+// collections over it. It returns false if they could not be sent, in
+// which case reconnecting continues.
+func (rc *RemoteCollector) finishReconnect(stop chan struct{}, c net.Conn) bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	select {
+	case <-stop:
+		// Closed while dialing.
+		c.Close()
+		return true
+	default:
+	}
+
+	rc.setConnNoLock(c)
+	for len(rc.buffer) > 0 {
+		if err := rc.collect(rc.buffer[0]); err != nil {
+			rc.pconn.Close()
+			rc.pconn = nil
+			return false
+		}
+		rc.buffer[0] = nil
+		rc.buffer = rc.buffer[1:]
+	}
+	rc.buffer = nil
+	rc.reconnecting = false
+	if rc.Debug {
+		rc.log().Printf("Reconnected to %s", rc.addr)
+	}
+	return true
+}
+
+func (rc *RemoteCollector) collect(p *wire.CollectPacket) error {
+	if rc.Debug {
+		rc.log().Printf("Sending %v", spanIDFromWire(p.Spanid))
+	}
+
+	if !rc.handshaken {
+		// Send the handshake with the first packet, so that servers that
+		// use version 0 of the protocol (which ignore it) still collect
+		// the packet.
+		p.Handshake = &wire.CollectPacket_Handshake{
+			Major: proto.Uint32(ProtocolMajor),
+			Minor: proto.Uint32(ProtocolMinor),
+			Batch: proto.Bool(true),
+		}
+		if rc.HeartbeatInterval > 0 {
+			p.Handshake.Heartbeat = proto.Bool(true)
+		}
+		if rc.Compression != "" {
+			p.Handshake.Compression = []string{rc.Compression}
+		}
+		if rc.Token != "" {
+			p.Handshake.Token = proto.String(rc.Token)
+		}
+		defer func() { p.Handshake = nil }()
+		rc.handshaken = true
+	} else if err := rc.switchNoLock(); err != nil {
+		return err
+	}
+
+	if rc.batch {
+		return rc.writeBatchNoLock([]*wire.CollectPacket{p})
+	}
+
+	// Send our message, close writer.
+	rc.setWriteDeadlineNoLock()
+	if err := rc.pconn.WriteMsg(p); err != nil {
+		return err
+	}
+	if rc.gz != nil {
+		if err := rc.gz.Flush(); err != nil {
+			return err
+		}
+	}
+	rc.lastWrite = time.Now()
+
+	if rc.Debug {
+		rc.log().Printf("Sent %v", spanIDFromWire(p.Spanid))
+	}
+	return nil
+}
+
+// switchNoLock starts using the options that the server accepted in its
+// reply to the handshake (compression, batch frames and heartbeats), once
+// the reply is received, telling the server with a zero-length frame. It
+// must be called with rc.mu held.
+func (rc *RemoteCollector) switchNoLock() error {
+	if rc.switched || !rc.handshaken {
+		return nil
+	}
+	select {
+	case <-rc.reply.done:
+	default:
+		return nil
+	}
+	rc.switched = true
+
+	msg := rc.reply.msg
+	compress := rc.Compression != "" && msg.GetCompression() == rc.Compression
+	heartbeat := rc.HeartbeatInterval > 0 && msg.GetHeartbeat()
+	if !compress && !msg.GetBatch() && !heartbeat {
+		return nil
+	}
+	rc.setWriteDeadlineNoLock()
+	if _, err := rc.conn.Write([]byte{0}); err != nil {
+		return err
+	}
+	if compress {
+		// The rest of the connection is compressed.
+		rc.gz = gzip.NewWriter(rc.conn)
+		rc.pconn = pio.NewDelimitedWriter(gzipConn{rc.gz, rc.conn})
+		if rc.Debug {
+			rc.log().Printf("Compressing with %s", rc.Compression)
+		}
+	}
+	rc.batch = msg.GetBatch()
+	rc.heartbeat = heartbeat
+	return nil
+}
+
+// collectBatch implements batchCollector by sending the spans in as few
+// batch frames as possible if the server accepts them (with a single write
+// to the connection), and one at a time (like Collect) otherwise.
+func (rc *RemoteCollector) collectBatch(spans []queuedSpan) ([]queuedSpan, error) {
+	maxSize := rc.maxMessageSize()
+	packets := make([]*wire.CollectPacket, 0, len(spans))
+	sendable := make([]queuedSpan, 0, len(spans)) // the spans of the packets
+	var tooLarge error
+	for _, s := range spans {
+		p := newCollectPacket(s.span, s.anns)
+		if size := proto.Size(p); size > maxSize {
+			if rc.Debug {
+				rc.log().Printf("Not sending %v: message of %d bytes exceeds MaxMessageSize (%d)", s.span, size, maxSize)
+			}
+			tooLarge = ErrMessageTooLarge
+			continue
+		}
+		packets = append(packets, p)
+		sendable = append(sendable, s)
+	}
+
+	rc.mu.Lock()
+	var sent bool
+	if rc.pconn != nil && !rc.reconnecting {
+		if err := rc.switchNoLock(); err == nil && rc.batch {
+			if err := rc.writeBatchNoLock(packets); err == nil {
+				sent = true
+			} else if rc.Debug {
+				rc.log().Printf("Sending batch of %d spans: %s", len(packets), err)
+			}
+		}
+	}
+	rc.mu.Unlock()
+	if sent {
+		return nil, tooLarge
+	}
+
+	// Send them one at a time, which connects (or reconnects) if needed.
+	var (
+		failed   []queuedSpan
+		firstErr error
+	)
+	for i, p := range packets {
+		if err := rc.collectAndRetry(p); err != nil {
+			failed = append(failed, sendable[i])
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	if firstErr != nil {
+		return failed, firstErr
+	}
+	return failed, tooLarge
+}
+
+// writeBatchNoLock sends the packets in batch frames of at most
+// MaxMessageSize bytes each, with a single write to the connection. It must
+// be called with rc.mu held, once the server accepted batch frames.
+func (rc *RemoteCollector) writeBatchNoLock(packets []*wire.CollectPacket) error {
+	maxSize := rc.maxMessageSize()
+	var buf bytes.Buffer
+	w := pio.NewDelimitedWriter(&buf)
+	frames := 0
+	for len(packets) > 0 {
+		n, size := 0, 0
+		for ; n < len(packets); n++ {
+			// The size of the packet as a field of the CollectBatch.
+			ps := proto.Size(packets[n])
+			ps += 1 + proto.SizeVarint(uint64(ps))
+			if n > 0 && size+ps > maxSize {
+				break
+			}
+			size += ps
+		}
+		if err := w.WriteMsg(&wire.CollectBatch{Packet: packets[:n]}); err != nil {
+			return err
+		}
+		packets = packets[n:]
+		frames++
+	}
+
+	rc.setWriteDeadlineNoLock()
+	if rc.gz != nil {
+		if _, err := rc.gz.Write(buf.Bytes()); err != nil {
+			return err
+		}
+		if err := rc.gz.Flush(); err != nil {
+			return err
+		}
+	} else if _, err := rc.conn.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	rc.lastWrite = time.Now()
+
+	if rc.Debug {
+		rc.log().Printf("Sent %d batch frames (%d bytes)", frames, buf.Len())
+	}
 	return nil
 }
 
@@ -394,16 +1607,145 @@ func (rc *RemoteCollector) log() *log.Logger {
 	return rc.Log
 }
 
+// A RemoteCollectorPool sends data to a collector server over several
+// connections in parallel, each managed by its own RemoteCollector, for
+// higher throughput than a single connection allows.
+//
+// Spans are distributed over the connections by trace ID, so all of the
+// spans of a trace are sent over the same connection, in the order in which
+// they were collected. A failed connection is reconnected by its
+// RemoteCollector without affecting the others.
+type RemoteCollectorPool struct {
+	collectors []*RemoteCollector
+}
+
+// NewRemoteCollectorPool creates a pool of n connections, each managed by a
+// RemoteCollector returned by newCollector. For example:
+//
+//	pool := appdash.NewRemoteCollectorPool(4, func() *appdash.RemoteCollector {
+//		return appdash.NewRemoteCollector("localhost:7701")
+//	})
+func NewRemoteCollectorPool(n int, newCollector func() *RemoteCollector) *RemoteCollectorPool {
+	if n < 1 {
+		n = 1
+	}
+	p := &RemoteCollectorPool{collectors: make([]*RemoteCollector, n)}
+	for i := range p.collectors {
+		p.collectors[i] = newCollector()
+	}
+	return p
+}
+
+// Collect implements the Collector interface by sending the span over the
+// connection that its trace is assigned to.
+func (p *RemoteCollectorPool) Collect(span SpanID, anns ...Annotation) error {
+	return p.collectors[uint64(span.Trace)%uint64(len(p.collectors))].Collect(span, anns...)
+}
+
+// collectBatch implements batchCollector by sending the spans of each
+// connection in a batch.
+func (p *RemoteCollectorPool) collectBatch(spans []queuedSpan) ([]queuedSpan, error) {
+	batches := make([][]queuedSpan, len(p.collectors))
+	for _, s := range spans {
+		i := uint64(s.span.Trace) % uint64(len(p.collectors))
+		batches[i] = append(batches[i], s)
+	}
+	var (
+		failed   []queuedSpan
+		firstErr error
+	)
+	for i, batch := range batches {
+		if len(batch) == 0 {
+			continue
+		}
+		f, err := p.collectors[i].collectBatch(batch)
+		failed = append(failed, f...)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return failed, firstErr
+}
+
+// Close closes all of the connections, returning the first error that
+// occurs.
+func (p *RemoteCollectorPool) Close() error {
+	var firstErr error
+	for _, c := range p.collectors {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+const (
+	// DefaultIdleTimeout is the default CollectorServer.IdleTimeout.
+	DefaultIdleTimeout = time.Hour
+
+	// DefaultMaxConns is the default CollectorServer.MaxConns.
+	DefaultMaxConns = 10000
+
+	// DefaultClientIdleTime is the default CollectorServer.ClientIdleTime.
+	DefaultClientIdleTime = 10 * time.Minute
+)
+
 // NewServer creates and starts a new server that listens for
 // spans and annotations on l and adds them to the collector c.
 //
 // Call the CollectorServer's Start method to start listening and
 // serving.
 func NewServer(l net.Listener, c Collector) *CollectorServer {
-	cs := &CollectorServer{c: c, l: l}
+	cs := &CollectorServer{c: c, l: l, now: time.Now, sleep: time.Sleep, done: make(chan struct{})}
 	return cs
 }
 
+// ListenUnix listens on the unix socket at path, for a collector server
+// (see NewServer) that clients on the same host connect to with a
+// "unix://" address. The socket file's permissions are set to perm, which
+// must grant write permission to the users of the clients.
+//
+// A stale socket file, left behind by a server that didn't shut down
+// cleanly, is removed first. ListenUnix fails if another server is
+// listening on path, or if path exists and is not a socket. The socket
+// file is removed when the listener is closed.
+func ListenUnix(path string, perm os.FileMode) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("appdash: %s exists and is not a unix socket", path)
+		}
+		if c, err := net.Dial("unix", path); err == nil {
+			c.Close()
+			return nil, fmt.Errorf("appdash: another server is listening on %s", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, perm); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// NewTLSServer creates a server like NewServer, which accepts TLS
+// connections on l using tlsConfig.
+//
+// To only accept clients that present a certificate signed by a trusted CA
+// (mutual TLS), set tlsConfig.ClientAuth to tls.RequireAndVerifyClientCert
+// and tlsConfig.ClientCAs to the pool of trusted CAs. Connections from
+// clients that fail verification are logged and closed, without affecting
+// other clients.
+func NewTLSServer(l net.Listener, tlsConfig *tls.Config, c Collector) *CollectorServer {
+	return NewServer(tls.NewListener(l, tlsConfig), c)
+}
+
 // A CollectorServer listens for spans and annotations and adds them
 // to a local collector.
 type CollectorServer struct {
@@ -420,58 +1762,871 @@ type CollectorServer struct {
 
 	// Trace is whether to log all data that is received.
 	Trace bool
+
+	// MaxMessageSize is the maximum size in bytes of the messages that the
+	// server accepts. Connections over which a larger message (or a
+	// message that can't be decoded) is received are closed, and the
+	// message is counted as rejected (see Rejected).
+	//
+	// Default MaxMessageSize = DefaultMaxMessageSize.
+	MaxMessageSize int
+
+	// Compression is whether to accept compressed connections from
+	// clients that offer it (see RemoteCollector.Compression).
+	Compression bool
+
+	// Tokens, if non-empty, are the shared secrets accepted from clients
+	// (see RemoteCollector.Token). Clients that don't send one of them in
+	// the handshake (including clients that use version 0 of the
+	// protocol, which has no handshake) are rejected before any of their
+	// spans are collected, and their connection is closed. Tokens are
+	// compared in constant time, and are never logged.
+	Tokens []string
+
+	// RequireSecureAuth is whether to reject all of the clients that
+	// connect over plaintext TCP when Tokens is set, so that tokens are
+	// only accepted over TLS (see NewTLSServer) or unix socket
+	// connections.
+	RequireSecureAuth bool
+
+	// RateLimit, if non-zero, is the maximum rate in spans per second at
+	// which the server accepts spans from each client. Clients are
+	// identified by their token if Tokens is set, and by their IP address
+	// otherwise, so that all of the connections of a client share its
+	// limit. Spans over the limit are dropped if DropOverLimit is set, and
+	// are otherwise read more slowly, which throttles the client.
+	RateLimit float64
+
+	// RateBurst is the number of spans that a client may send at once,
+	// before RateLimit applies.
+	//
+	// Default RateBurst = RateLimit (rounded up), and at least 1.
+	RateBurst int
+
+	// DropOverLimit is whether to drop the spans that exceed RateLimit
+	// (counting them, see ClientStats), instead of throttling the client.
+	DropOverLimit bool
+
+	// IdleTimeout is how long the server waits for the next complete
+	// packet or heartbeat from a client (or for the TLS handshake) before
+	// closing the connection, so that the connections of crashed clients
+	// don't linger.
+	// A negative IdleTimeout disables it.
+	//
+	// Default IdleTimeout = DefaultIdleTimeout.
+	IdleTimeout time.Duration
+
+	// MaxConns is the maximum number of open connections. What happens to
+	// the connections beyond it is determined by QueueConns. A negative
+	// MaxConns disables it.
+	//
+	// Default MaxConns = DefaultMaxConns.
+	MaxConns int
+
+	// QueueConns is whether to stop accepting connections while MaxConns
+	// connections are open, leaving the new ones waiting in the listener's
+	// backlog, instead of closing them as soon as they are accepted.
+	QueueConns bool
+
+	// ClientIdleTime is how long the server keeps the state of a client
+	// (its rate limit and counters, see ClientStats) once it has no open
+	// connections, so that the clients that come and go don't accumulate.
+	// It should be long enough for the rate limit of a client to be
+	// replenished, so that forgetting it doesn't loosen the limit.
+	//
+	// Default ClientIdleTime = DefaultClientIdleTime.
+	ClientIdleTime time.Duration
+
+	rejected uint64 // number of rejected messages (accessed atomically)
+
+	// Counters of Stats (accessed atomically).
+	packets, spans, bytesRead, decodeErrors, storeErrors uint64
+	refusedConns, idleClosedConns, heartbeats            uint64
+	activeConns                                          int64
+
+	now   func() time.Time    // returns the current time (for tests)
+	sleep func(time.Duration) // waits for the given duration (for tests)
+
+	mu           sync.Mutex        // guards conns, shuttingDown, clients, idleClients, lastSweep and errorHandler
+	conns        map[net.Conn]bool // open connections -> whether they are idle
+	shuttingDown bool
+	done         chan struct{}                      // closed when shutting down
+	handlers     sync.WaitGroup                     // running connection handlers
+	clients      map[string]*clientState            // clients by ID (see ClientStats)
+	idleClients  ClientStats                        // counters of the forgotten clients
+	lastSweep    time.Time                          // when the idle clients were last forgotten
+	errorHandler func(err error, remoteAddr string) // see SetErrorHandler
 }
 
-// Start starts the server.
+// A ServerErrorKind is the category of a ServerError.
+type ServerErrorKind int
+
+const (
+	// ServerNetworkError is a failure to accept a connection, or to read
+	// from or write to one.
+	ServerNetworkError ServerErrorKind = iota
+
+	// ServerDecodeError is a message that exceeds MaxMessageSize or can't
+	// be decoded.
+	ServerDecodeError
+
+	// ServerStoreError is a failure of the server's collector to collect a
+	// span.
+	ServerStoreError
+
+	// ServerRejectedError is a client that was rejected, because it failed
+	// to authenticate (or TLS verification) or uses an unsupported version
+	// of the protocol.
+	ServerRejectedError
+)
+
+func (k ServerErrorKind) String() string {
+	switch k {
+	case ServerNetworkError:
+		return "network"
+	case ServerDecodeError:
+		return "decode"
+	case ServerStoreError:
+		return "store"
+	case ServerRejectedError:
+		return "rejected"
+	}
+	return fmt.Sprintf("ServerErrorKind(%d)", int(k))
+}
+
+// A ServerError is an error that made a CollectorServer close a client's
+// connection (or fail to accept one), as passed to its error handler (see
+// SetErrorHandler).
+type ServerError struct {
+	Kind ServerErrorKind
+	Err  error
+}
+
+func (e *ServerError) Error() string { return e.Err.Error() }
+
+// Unwrap returns the underlying error (e.g. the error of the server's
+// collector, for a ServerStoreError).
+func (e *ServerError) Unwrap() error { return e.Err }
+
+// serverError returns a ServerError of the given kind, whose error is
+// formatted like fmt.Errorf.
+func serverError(kind ServerErrorKind, format string, args ...interface{}) error {
+	return &ServerError{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+// SetErrorHandler sets the function that is called with each error that
+// makes the server close a client's connection (or fail to accept one),
+// and the address of the client ("" for errors accepting connections).
+// The errors are *ServerError values, whose Kind is their category. If h is
+// nil (the default), they are logged to Log.
+//
+// The handler is called on the goroutine that handles the connection (or
+// accepts them), which waits for it to return, so it should return
+// promptly: for example, by handing the error off to another goroutine if
+// it does anything slow. Panics in the handler are recovered and logged.
+func (cs *CollectorServer) SetErrorHandler(h func(err error, remoteAddr string)) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.errorHandler = h
+}
+
+// handleError passes err to the error handler, or logs it if there is
+// none.
+func (cs *CollectorServer) handleError(err error, remoteAddr string) {
+	cs.mu.Lock()
+	h := cs.errorHandler
+	cs.mu.Unlock()
+	if h == nil {
+		if remoteAddr == "" {
+			cs.log().Print(err)
+		} else {
+			cs.log().Printf("Client %s: %s", remoteAddr, err)
+		}
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			cs.log().Printf("Error handler panicked handling %q: %v", err, r)
+		}
+	}()
+	h(err, remoteAddr)
+}
+
+// ClientStats are the counters of the spans that a CollectorServer
+// received from a client.
+type ClientStats struct {
+	Accepted uint64 // number of spans collected
+	Dropped  uint64 // number of spans dropped for exceeding the rate limit
+}
+
+// IdleClientsID is the client ID under which ClientStats reports the sum
+// of the counters of the clients that were forgotten after being idle for
+// longer than CollectorServer.ClientIdleTime.
+const IdleClientsID = "idle"
+
+// clientState is the state of a client of a CollectorServer, shared by
+// all of its connections.
+type clientState struct {
+	accepted, dropped uint64 // accessed atomically
+
+	conns     int       // number of open connections (guarded by the server's mu)
+	idleSince time.Time // when conns dropped to 0 (guarded by the server's mu)
+
+	mu      sync.Mutex   // guards limiter
+	limiter *rateLimiter // nil if the server has no rate limit
+}
+
+// Start starts the server. It returns after Shutdown is called.
 func (cs *CollectorServer) Start() {
+	// A connection holds a slot while it is open, if MaxConns is enabled.
+	var slots chan struct{}
+	if maxConns := cs.MaxConns; maxConns >= 0 {
+		if maxConns == 0 {
+			maxConns = DefaultMaxConns
+		}
+		slots = make(chan struct{}, maxConns)
+	}
+
 	for {
+		if slots != nil && cs.QueueConns {
+			select {
+			case slots <- struct{}{}:
+			case <-cs.done:
+				return
+			}
+		}
+
 		conn, err := cs.l.Accept()
 		if err != nil {
-			cs.log().Printf("Accept: %s", err)
+			if cs.isShuttingDown() {
+				return
+			}
+			cs.handleError(serverError(ServerNetworkError, "Accept: %s", err), "")
+			if slots != nil && cs.QueueConns {
+				<-slots
+			}
 			continue
 		}
 
+		if slots != nil && !cs.QueueConns {
+			select {
+			case slots <- struct{}{}:
+			default:
+				atomic.AddUint64(&cs.refusedConns, 1)
+				if cs.Debug {
+					cs.log().Printf("Client %s refused (MaxConns connections are open)", conn.RemoteAddr())
+				}
+				conn.Close()
+				continue
+			}
+		}
+
+		if !cs.trackConn(conn) {
+			conn.Close()
+			return
+		}
+
 		if cs.Debug {
 			cs.log().Printf("Client %s connected", conn.RemoteAddr())
 		}
 
-		go cs.handleConn(conn)
+		go func() {
+			defer cs.untrackConn(conn)
+			if slots != nil {
+				defer func() { <-slots }()
+			}
+			cs.handleConn(conn)
+		}()
 	}
 }
 
+// Shutdown gracefully shuts down the server: it stops accepting
+// connections, closes the idle ones, and waits for the others to finish
+// reading and collecting the packets they have started to receive. If ctx is done
+// first, the remaining connections are closed and ctx.Err() is returned.
+func (cs *CollectorServer) Shutdown(ctx context.Context) error {
+	cs.mu.Lock()
+	if !cs.shuttingDown {
+		close(cs.done)
+	}
+	cs.shuttingDown = true
+	cs.l.Close()
+	for conn, idle := range cs.conns {
+		if idle {
+			conn.Close()
+		}
+	}
+	cs.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		cs.handlers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		cs.mu.Lock()
+		for conn := range cs.conns {
+			conn.Close()
+		}
+		cs.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (cs *CollectorServer) isShuttingDown() bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.shuttingDown
+}
+
+// trackConn registers a newly accepted connection. It returns false if the
+// server is shutting down.
+func (cs *CollectorServer) trackConn(conn net.Conn) bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.shuttingDown {
+		return false
+	}
+	if cs.conns == nil {
+		cs.conns = make(map[net.Conn]bool)
+	}
+	cs.conns[conn] = false
+	cs.handlers.Add(1)
+	atomic.AddInt64(&cs.activeConns, 1)
+	return true
+}
+
+func (cs *CollectorServer) untrackConn(conn net.Conn) {
+	cs.mu.Lock()
+	delete(cs.conns, conn)
+	cs.mu.Unlock()
+	atomic.AddInt64(&cs.activeConns, -1)
+	cs.handlers.Done()
+}
+
+// setIdle records whether conn is idle (waiting for the next packet). It
+// returns false if the server is shutting down, in which case the
+// connection should be closed.
+func (cs *CollectorServer) setIdle(conn net.Conn, idle bool) bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.conns[conn] = idle
+	return !cs.shuttingDown
+}
+
 func (cs *CollectorServer) handleConn(conn net.Conn) (err error) {
 	defer func() {
-		if err != nil {
-			cs.log().Printf("Client %s: %s", conn.RemoteAddr(), err)
+		if err != nil && !cs.isShuttingDown() {
+			cs.handleError(err, conn.RemoteAddr().String())
 		}
 	}()
 	defer conn.Close()
 
-	rdr := pio.NewDelimitedReader(conn, maxMessageSize)
-	defer rdr.Close()
+	// Each complete packet must be received within the idle timeout after
+	// the previous one.
+	idleTimeout := cs.IdleTimeout
+	if idleTimeout == 0 {
+		idleTimeout = DefaultIdleTimeout
+	}
+	resetIdleTimeout := func() {
+		if idleTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		}
+	}
+	// idle reports whether a read error is due to the idle timeout, in
+	// which case the connection is closed without logging an error.
+	idle := func(err error) bool {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			atomic.AddUint64(&cs.idleClosedConns, 1)
+			if cs.Debug {
+				cs.log().Printf("Client %s: closing idle connection", conn.RemoteAddr())
+			}
+			return true
+		}
+		return false
+	}
+	resetIdleTimeout()
+
+	// Perform the TLS handshake (if any) now, so that clients that fail
+	// verification are rejected before anything is read from them.
+	tc, secure := conn.(*tls.Conn)
+	if secure {
+		if err = tc.Handshake(); err != nil {
+			if idle(err) {
+				return nil
+			}
+			return serverError(ServerRejectedError, "TLS handshake: %s", err)
+		}
+	} else {
+		_, secure = conn.(*net.UnixConn)
+	}
+	if len(cs.Tokens) > 0 && cs.RequireSecureAuth && !secure {
+		atomic.AddUint64(&cs.rejected, 1)
+		err = serverError(ServerRejectedError, "authentication requires TLS")
+		// The writer isn't closed, since that would close conn.
+		pio.NewDelimitedWriter(conn).WriteMsg(&wire.CollectReply{
+			Major: proto.Uint32(ProtocolMajor),
+			Minor: proto.Uint32(ProtocolMinor),
+			Error: proto.String(err.Error()),
+		})
+		return err
+	}
+
+	maxSize := cs.MaxMessageSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxMessageSize
+	}
+
+	// Packets are read through br (which reads from raw until the
+	// connection is compressed), so br.Buffered and raw.Buffered tell
+	// whether part of the next packet has been received.
+	raw := bufio.NewReader(countingReader{conn, &cs.bytesRead})
+	br := raw
+	var (
+		length      uint64
+		buf         []byte
+		compression string       // compression accepted by the server
+		batch       bool         // whether batch frames were accepted
+		heartbeat   bool         // whether heartbeats were accepted
+		switched    bool         // whether the accepted options are used
+		first       = true       // whether the next packet is the first one
+		client      *clientState // set once the first packet is read
+	)
+	defer func() {
+		if client != nil {
+			cs.releaseClient(client)
+		}
+	}()
 	for {
-		p := &wire.CollectPacket{}
-		if err = rdr.ReadMsg(p); err != nil {
-			if err == io.EOF {
+		resetIdleTimeout()
+		if br.Buffered() == 0 && raw.Buffered() == 0 {
+			// Wait for the next packet, letting Shutdown close the
+			// connection in the meantime.
+			if !cs.setIdle(conn, true) {
 				return nil
 			}
-			return fmt.Errorf("ReadMsg: %s", err)
+			if _, err = br.Peek(1); err != nil {
+				if err == io.EOF || idle(err) {
+					return nil
+				}
+				return serverError(ServerNetworkError, "ReadMsg: %s", err)
+			}
+			cs.setIdle(conn, false)
 		}
 
-		spanID := spanIDFromWire(p.Spanid)
-		if cs.Debug || cs.Trace {
-			cs.log().Printf("Client %s: received span %v with %d annotations", conn.RemoteAddr(), spanID, len(p.Annotation))
+		// Read the length-delimited packet, checking its length before
+		// allocating anything.
+		length, err = binary.ReadUvarint(br)
+		if err != nil {
+			if err == io.EOF || idle(err) {
+				return nil
+			}
+			return serverError(ServerNetworkError, "ReadMsg: %s", err)
+		}
+		if length == 0 && switched && heartbeat {
+			// Acknowledge the heartbeat. The connection is no longer idle,
+			// since the idle timeout is reset.
+			atomic.AddUint64(&cs.heartbeats, 1)
+			if _, err = conn.Write([]byte{0}); err != nil {
+				return serverError(ServerNetworkError, "heartbeat: %s", err)
+			}
+			continue
 		}
-		if cs.Trace {
-			for i, ann := range p.Annotation {
-				cs.log().Printf("Client %s: span %v: annotation %d: %s=%q", conn.RemoteAddr(), p.Spanid.Span, i, *ann.Key, ann.Value)
+		if length == 0 && (compression != "" || batch || heartbeat) && !switched {
+			// The client now uses the options accepted in the reply.
+			switched = true
+			if compression != "" {
+				// The rest of the connection is compressed.
+				gz, err := gzip.NewReader(raw)
+				if err != nil {
+					return serverError(ServerDecodeError, "ReadMsg: %s", err)
+				}
+				br = bufio.NewReader(gz)
 			}
+			continue
 		}
+		if length > uint64(maxSize) {
+			atomic.AddUint64(&cs.packets, 1)
+			atomic.AddUint64(&cs.rejected, 1)
+			atomic.AddUint64(&cs.decodeErrors, 1)
+			return serverError(ServerDecodeError, "ReadMsg: rejected message of %d bytes (MaxMessageSize is %d)", length, maxSize)
+		}
+		if uint64(cap(buf)) < length {
+			buf = make([]byte, length)
+		}
+		buf = buf[:length]
+		if _, err = io.ReadFull(br, buf); err != nil {
+			if idle(err) {
+				return nil
+			}
+			return serverError(ServerNetworkError, "ReadMsg: %s", err)
+		}
+		var packets []*wire.CollectPacket
+		if switched && batch {
+			b := &wire.CollectBatch{}
+			err = proto.Unmarshal(buf, b)
+			packets = b.Packet
+		} else {
+			p := &wire.CollectPacket{}
+			err = proto.Unmarshal(buf, p)
+			packets = []*wire.CollectPacket{p}
+		}
+		if err != nil {
+			atomic.AddUint64(&cs.packets, 1)
+			atomic.AddUint64(&cs.rejected, 1)
+			atomic.AddUint64(&cs.decodeErrors, 1)
+			return serverError(ServerDecodeError, "ReadMsg: %s", err)
+		}
+		atomic.AddUint64(&cs.packets, uint64(len(packets)))
 
-		if err = cs.c.Collect(spanID, annotationsFromWire(p.Annotation)...); err != nil {
-			return fmt.Errorf("Collect %v: %s", spanID, err)
+		var reply *wire.CollectReply
+		if first {
+			// The first frame is always a single packet.
+			p := packets[0]
+			first = false
+			if p.Handshake == nil && len(cs.Tokens) > 0 {
+				atomic.AddUint64(&cs.rejected, 1)
+				return serverError(ServerRejectedError, "authentication failed: no handshake")
+			}
+			id := clientID(conn)
+			if p.Handshake != nil {
+				var token int
+				if reply, token, err = cs.handshake(conn, p.Handshake); err != nil {
+					// The writer isn't closed, since that would close conn.
+					pio.NewDelimitedWriter(conn).WriteMsg(reply)
+					return &ServerError{Kind: ServerRejectedError, Err: err}
+				}
+				compression = reply.GetCompression()
+				batch = reply.GetBatch()
+				heartbeat = reply.GetHeartbeat()
+				if token != 0 {
+					id = fmt.Sprintf("token %d", token)
+				}
+			}
+			client = cs.client(id)
 		}
+
+		for _, p := range packets {
+			spanID := spanIDFromWire(p.Spanid)
+			if cs.Debug || cs.Trace {
+				cs.log().Printf("Client %s: received span %v with %d annotations", conn.RemoteAddr(), spanID, len(p.Annotation))
+			}
+			if cs.Trace {
+				for i, ann := range p.Annotation {
+					cs.log().Printf("Client %s: span %v: annotation %d: %s=%q", conn.RemoteAddr(), p.Spanid.Span, i, *ann.Key, ann.Value)
+				}
+			}
+
+			if cs.admit(client) {
+				if err = cs.c.Collect(spanID, annotationsFromWire(p.Annotation)...); err != nil {
+					atomic.AddUint64(&cs.storeErrors, 1)
+					return serverError(ServerStoreError, "Collect %v: %w", spanID, err)
+				}
+				atomic.AddUint64(&cs.spans, 1)
+				atomic.AddUint64(&client.accepted, 1)
+			} else if cs.Debug {
+				cs.log().Printf("Client %s: dropped span %v (over rate limit)", conn.RemoteAddr(), spanID)
+			}
+		}
+
+		if reply != nil {
+			// Reply after collecting the packet, in case the client
+			// doesn't wait for the reply. If it fails, the connection is
+			// broken, which the next read reports.
+			pio.NewDelimitedWriter(conn).WriteMsg(reply)
+		}
+	}
+}
+
+// handshake returns the reply to the handshake sent by a client in its
+// first packet, the number (starting at 1) of the token it authenticated
+// with in cs.Tokens (or 0 if cs.Tokens is empty), and an error if the
+// client uses an unsupported version of the protocol or failed to
+// authenticate.
+func (cs *CollectorServer) handshake(conn net.Conn, h *wire.CollectPacket_Handshake) (*wire.CollectReply, int, error) {
+	reply := &wire.CollectReply{
+		Major: proto.Uint32(ProtocolMajor),
+		Minor: proto.Uint32(ProtocolMinor),
+	}
+	if h.GetMajor() > ProtocolMajor {
+		err := fmt.Errorf("unsupported protocol version %d.%d (server supports versions up to %d.x)", h.GetMajor(), h.GetMinor(), ProtocolMajor)
+		reply.Error = proto.String(err.Error())
+		atomic.AddUint64(&cs.rejected, 1)
+		return reply, 0, err
+	}
+	var token int
+	if len(cs.Tokens) > 0 {
+		if token = cs.tokenNumber(h.GetToken()); token == 0 {
+			err := errors.New("authentication failed")
+			reply.Error = proto.String(err.Error())
+			atomic.AddUint64(&cs.rejected, 1)
+			return reply, 0, err
+		}
+	}
+	if cs.Compression {
+		for _, c := range h.Compression {
+			if c == CompressionGzip {
+				reply.Compression = proto.String(c)
+				break
+			}
+		}
+	}
+	if h.GetBatch() {
+		reply.Batch = proto.Bool(true)
+	}
+	if h.GetHeartbeat() {
+		reply.Heartbeat = proto.Bool(true)
 	}
+	if cs.Debug {
+		cs.log().Printf("Client %s: protocol version %d.%d, compression %q, batch frames %v, heartbeats %v", conn.RemoteAddr(), h.GetMajor(), h.GetMinor(), reply.GetCompression(), reply.GetBatch(), reply.GetHeartbeat())
+	}
+	return reply, token, nil
+}
+
+// tokenNumber returns the number (starting at 1) of token in cs.Tokens, or
+// 0 if it isn't one of them. The tokens are hashed before they are
+// compared, so that neither their contents nor their lengths can be
+// timed, and all of them are compared.
+func (cs *CollectorServer) tokenNumber(token string) int {
+	h := sha256.Sum256([]byte(token))
+	var n int
+	for i, t := range cs.Tokens {
+		ht := sha256.Sum256([]byte(t))
+		n |= subtle.ConstantTimeSelect(subtle.ConstantTimeCompare(h[:], ht[:]), i+1, 0)
+	}
+	return n
+}
+
+// clientID returns the ID of the client connected over conn, when it
+// didn't authenticate: its IP address, or "unix" for unix sockets.
+func clientID(conn net.Conn) string {
+	addr := conn.RemoteAddr()
+	if addr == nil || addr.Network() == "unix" {
+		return "unix"
+	}
+	if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+		return host
+	}
+	return addr.String()
+}
+
+// client returns the state of the client with the given ID, creating it
+// if needed, for a new connection of the client (see releaseClient).
+func (cs *CollectorServer) client(id string) *clientState {
+	now := cs.now()
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	c, ok := cs.clients[id]
+	if !ok {
+		if cs.clients == nil {
+			cs.clients = make(map[string]*clientState)
+		}
+		cs.forgetIdleClientsNoLock(now)
+		c = &clientState{}
+		if cs.RateLimit > 0 {
+			c.limiter = newRateLimiter(cs.RateLimit, cs.RateBurst, now)
+		}
+		cs.clients[id] = c
+	}
+	c.conns++
+	return c
+}
+
+// releaseClient records that a connection of the client was closed.
+func (cs *CollectorServer) releaseClient(c *clientState) {
+	now := cs.now()
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if c.conns--; c.conns == 0 {
+		c.idleSince = now
+	}
+}
+
+// forgetIdleClientsNoLock forgets the clients that have been idle for
+// longer than ClientIdleTime, adding their counters to cs.idleClients. It
+// looks for them at most once per ClientIdleTime. The cs.mu lock must be
+// held.
+func (cs *CollectorServer) forgetIdleClientsNoLock(now time.Time) {
+	idleTime := cs.ClientIdleTime
+	if idleTime <= 0 {
+		idleTime = DefaultClientIdleTime
+	}
+	if now.Sub(cs.lastSweep) < idleTime {
+		return
+	}
+	cs.lastSweep = now
+	for id, c := range cs.clients {
+		if c.conns == 0 && now.Sub(c.idleSince) >= idleTime {
+			cs.idleClients.Accepted += atomic.LoadUint64(&c.accepted)
+			cs.idleClients.Dropped += atomic.LoadUint64(&c.dropped)
+			delete(cs.clients, id)
+		}
+	}
+}
+
+// admit applies the rate limit of client to its next span, and reports
+// whether to collect it. Unless cs.DropOverLimit is set, it waits until
+// the span is within the limit, and always returns true.
+func (cs *CollectorServer) admit(client *clientState) bool {
+	if client.limiter == nil {
+		return true
+	}
+	client.mu.Lock()
+	if cs.DropOverLimit {
+		ok := client.limiter.allow(cs.now())
+		client.mu.Unlock()
+		if !ok {
+			atomic.AddUint64(&client.dropped, 1)
+		}
+		return ok
+	}
+	wait := client.limiter.reserve(cs.now())
+	client.mu.Unlock()
+	if wait > 0 {
+		cs.sleep(wait)
+	}
+	return true
+}
+
+// CollectorServerStats are the counters and gauges of a CollectorServer
+// (see CollectorServer.Stats).
+type CollectorServerStats struct {
+	// Packets is the number of packets received, including the ones that
+	// were rejected or dropped.
+	Packets uint64
+
+	// Spans is the number of spans collected.
+	Spans uint64
+
+	// Bytes is the number of bytes read from connections (before
+	// decompression, for compressed connections).
+	Bytes uint64
+
+	// DecodeErrors is the number of packets that exceeded MaxMessageSize
+	// or could not be decoded.
+	DecodeErrors uint64
+
+	// StoreErrors is the number of spans that the server's collector
+	// failed to collect.
+	StoreErrors uint64
+
+	// Rejected is the number of rejected messages (see Rejected).
+	Rejected uint64
+
+	// ActiveConns is the number of open connections.
+	ActiveConns int64
+
+	// RefusedConns is the number of connections closed as soon as they
+	// were accepted, because MaxConns connections were open.
+	RefusedConns uint64
+
+	// IdleClosedConns is the number of connections closed because of the
+	// idle timeout.
+	IdleClosedConns uint64
+
+	// Heartbeats is the number of heartbeat frames received (see
+	// RemoteCollector.HeartbeatInterval).
+	Heartbeats uint64
+}
+
+// Stats returns the server's counters (since it was created) and gauges.
+func (cs *CollectorServer) Stats() CollectorServerStats {
+	return CollectorServerStats{
+		Packets:      atomic.LoadUint64(&cs.packets),
+		Spans:        atomic.LoadUint64(&cs.spans),
+		Bytes:        atomic.LoadUint64(&cs.bytesRead),
+		DecodeErrors: atomic.LoadUint64(&cs.decodeErrors),
+		StoreErrors:  atomic.LoadUint64(&cs.storeErrors),
+		Rejected:     atomic.LoadUint64(&cs.rejected),
+		ActiveConns:  atomic.LoadInt64(&cs.activeConns),
+
+		RefusedConns:    atomic.LoadUint64(&cs.refusedConns),
+		IdleClosedConns: atomic.LoadUint64(&cs.idleClosedConns),
+		Heartbeats:      atomic.LoadUint64(&cs.heartbeats),
+	}
+}
+
+// PublishStats publishes each of the server's stats (see Stats) with
+// publish, as a variable named prefix followed by the stat's name in
+// snake case (e.g. "decode_errors"), whose String method returns its
+// current value. For example, to publish them with package expvar:
+//
+//	cs.PublishStats("appdash_collector_", func(name string, v fmt.Stringer) {
+//		expvar.Publish(name, v)
+//	})
+func (cs *CollectorServer) PublishStats(prefix string, publish func(name string, v fmt.Stringer)) {
+	stats := []struct {
+		name string
+		v    *uint64
+	}{
+		{"packets", &cs.packets},
+		{"spans", &cs.spans},
+		{"bytes", &cs.bytesRead},
+		{"decode_errors", &cs.decodeErrors},
+		{"store_errors", &cs.storeErrors},
+		{"rejected", &cs.rejected},
+		{"refused_conns", &cs.refusedConns},
+		{"idle_closed_conns", &cs.idleClosedConns},
+		{"heartbeats", &cs.heartbeats},
+	}
+	for _, stat := range stats {
+		v := stat.v
+		publish(prefix+stat.name, statFunc(func() int64 { return int64(atomic.LoadUint64(v)) }))
+	}
+	publish(prefix+"active_conns", statFunc(func() int64 { return atomic.LoadInt64(&cs.activeConns) }))
+}
+
+// A statFunc is a published stat, whose String method returns the value
+// returned by the function.
+type statFunc func() int64
+
+func (f statFunc) String() string { return strconv.FormatInt(f(), 10) }
+
+// countingReader is a reader that counts the bytes read through it in n
+// (atomically).
+type countingReader struct {
+	r io.Reader
+	n *uint64
+}
+
+func (r countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	atomic.AddUint64(r.n, uint64(n))
+	return n, err
+}
+
+// ClientStats returns the counters of the spans received from each client
+// since the server started, by client ID: the client's IP address, "unix"
+// for unix socket clients, or "token N" for clients that authenticated
+// with the Nth token of Tokens. The counters of the clients that were
+// forgotten (see ClientIdleTime) are summed under IdleClientsID, so that
+// the counters still add up to all of the spans received; a forgotten
+// client that reconnects starts again from zero.
+func (cs *CollectorServer) ClientStats() map[string]ClientStats {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	stats := make(map[string]ClientStats, len(cs.clients)+1)
+	if cs.idleClients != (ClientStats{}) {
+		stats[IdleClientsID] = cs.idleClients
+	}
+	for id, c := range cs.clients {
+		stats[id] = ClientStats{
+			Accepted: atomic.LoadUint64(&c.accepted),
+			Dropped:  atomic.LoadUint64(&c.dropped),
+		}
+	}
+	return stats
+}
+
+// Rejected returns the number of messages that the server rejected because
+// they exceeded MaxMessageSize, could not be decoded, or came from a client
+// that uses an unsupported version of the protocol or failed to
+// authenticate.
+func (cs *CollectorServer) Rejected() uint64 {
+	return atomic.LoadUint64(&cs.rejected)
 }
 
 func (cs *CollectorServer) log() *log.Logger {
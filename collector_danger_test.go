@@ -46,7 +46,7 @@ func BenchmarkChunkedCollector1mil(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		for c := 0; c < nCollections; c++ {
 			x++
-			err := cc.Collect(SpanID{x, x + 1, x + 2}, anns...)
+			err := cc.Collect(SpanID{Trace: x, Span: x + 1, Parent: x + 2}, anns...)
 			if err != nil {
 				b.Fatal(err)
 			}
@@ -1,18 +1,35 @@
 package appdash
 
 import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/big"
 	"net"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"sort"
 
+	pio "github.com/gogo/protobuf/io"
+	"github.com/gogo/protobuf/proto"
 	"sourcegraph.com/sourcegraph/appdash/internal/wire"
 )
 
@@ -40,8 +57,8 @@ func TestCollectorServer(t *testing.T) {
 	cc := &collectorT{t, NewRemoteCollector(l.Addr().String())}
 
 	collectPackets := []*wire.CollectPacket{
-		newCollectPacket(SpanID{1, 2, 3}, Annotations{{"k1", []byte("v1")}}),
-		newCollectPacket(SpanID{2, 3, 4}, Annotations{{"k2", []byte("v2")}}),
+		newCollectPacket(SpanID{Trace: 1, Span: 2, Parent: 3}, Annotations{{"k1", []byte("v1")}}),
+		newCollectPacket(SpanID{Trace: 2, Span: 3, Parent: 4}, Annotations{{"k2", []byte("v2")}}),
 	}
 	for _, p := range collectPackets {
 		cc.MustCollect(spanIDFromWire(p.Spanid), annotationsFromWire(p.Annotation)...)
@@ -56,6 +73,1381 @@ func TestCollectorServer(t *testing.T) {
 	}
 }
 
+func TestCollectorServer_Shutdown(t *testing.T) {
+	store := NewMemoryStore()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := NewServer(l, store)
+	started := make(chan struct{})
+	go func() {
+		cs.Start()
+		close(started)
+	}()
+
+	// An idle connection, which Shutdown closes right away.
+	idle := NewRemoteCollector(l.Addr().String())
+	if err := idle.Collect(SpanID{Trace: 1, Span: 1, Parent: 0}); err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Close()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		if _, err := store.Trace(1); err == nil {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+	}
+
+	// A connection over which a packet is only partially written when
+	// Shutdown is called.
+	var buf bytes.Buffer
+	if err := pio.NewDelimitedWriter(&buf).WriteMsg(newCollectPacket(SpanID{Trace: 2, Span: 2, Parent: 0}, Annotations{{"k", []byte("v")}})); err != nil {
+		t.Fatal(err)
+	}
+	packet := buf.Bytes()
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.Write(packet[:3]); err != nil {
+		t.Fatal(err)
+	}
+
+	// Wait until the partial packet has started to be read.
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the connections")
+		}
+		cs.mu.Lock()
+		busy := 0
+		for _, idle := range cs.conns {
+			if !idle {
+				busy++
+			}
+		}
+		n := len(cs.conns)
+		cs.mu.Unlock()
+		if n == 2 && busy == 1 {
+			break
+		}
+	}
+
+	shutdown := make(chan error)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdown <- cs.Shutdown(ctx)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if _, err := c.Write(packet[3:]); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start did not return after Shutdown")
+	}
+
+	for _, id := range []ID{1, 2} {
+		if _, err := store.Trace(id); err != nil {
+			t.Errorf("trace %v: %s", id, err)
+		}
+	}
+	if _, err := net.Dial("tcp", l.Addr().String()); err == nil {
+		t.Error("server still accepts connections after Shutdown")
+	}
+}
+
+func TestCollectorServer_MaxMessageSize(t *testing.T) {
+	store := NewMemoryStore()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := NewServer(l, store)
+	cs.MaxMessageSize = 1024
+	cs.Log = log.New(ioutil.Discard, "", 0)
+	go cs.Start()
+	defer cs.Shutdown(context.Background())
+
+	uvarint := func(x uint64) []byte {
+		b := make([]byte, binary.MaxVarintLen64)
+		return b[:binary.PutUvarint(b, x)]
+	}
+	inputs := map[string][]byte{
+		"huge length":      uvarint(1 << 40),
+		"too large":        append(uvarint(1025), make([]byte, 1025)...),
+		"overlong length":  bytes.Repeat([]byte{0xff}, 11),
+		"truncated length": {0xff, 0xff},
+		"truncated body":   append(uvarint(100), make([]byte, 10)...),
+		"garbage body":     append(uvarint(10), bytes.Repeat([]byte{0xff}, 10)...),
+	}
+	for i := 0; i < 200; i++ {
+		b := make([]byte, 1+i%64)
+		if _, err := rand.Read(b); err != nil {
+			t.Fatal(err)
+		}
+		inputs[fmt.Sprintf("random %d", i)] = b
+	}
+	for name, input := range inputs {
+		c, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		c.Write(input)
+		c.Close()
+	}
+
+	// The server must still be serving other clients.
+	rc := NewRemoteCollector(l.Addr().String())
+	defer rc.Close()
+	if err := rc.Collect(SpanID{Trace: 1, Span: 1, Parent: 0}); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		_, err := store.Trace(1)
+		if err == nil && cs.Rejected() >= 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d rejected messages, want at least 3 (trace error: %v)", cs.Rejected(), err)
+		}
+	}
+}
+
+func TestRemoteCollector_MaxMessageSize(t *testing.T) {
+	store := NewMemoryStore()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := NewServer(l, store)
+	go cs.Start()
+	defer cs.Shutdown(context.Background())
+
+	rc := NewRemoteCollector(l.Addr().String())
+	rc.MaxMessageSize = 1024
+	defer rc.Close()
+	if err := rc.Collect(SpanID{Trace: 1, Span: 1, Parent: 0}, Annotation{"k", make([]byte, 1024)}); err != ErrMessageTooLarge {
+		t.Errorf("got error %v, want %v", err, ErrMessageTooLarge)
+	}
+	if err := rc.Collect(SpanID{Trace: 2, Span: 2, Parent: 0}, Annotation{"k", make([]byte, 512)}); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		if _, err := store.Trace(2); err == nil {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+	}
+	if _, err := store.Trace(1); err != ErrTraceNotFound {
+		t.Errorf("got error %v for the oversized trace, want %v", err, ErrTraceNotFound)
+	}
+}
+
+func TestCollectorServer_Compression(t *testing.T) {
+	const nSpans = 50
+	value := bytes.Repeat([]byte(`{"method":"GET","url":"/foo/bar","status":200}`), 10)
+
+	sent := map[bool]int64{} // bytes sent, by whether the connection was compressed
+	for _, clientCompression := range []string{"", CompressionGzip} {
+		for _, serverCompression := range []bool{false, true} {
+			name := fmt.Sprintf("client %q, server %v", clientCompression, serverCompression)
+
+			store := NewMemoryStore()
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			cs := NewServer(l, store)
+			cs.Compression = serverCompression
+			go cs.Start()
+
+			var written int64
+			rc := NewRemoteCollector(l.Addr().String())
+			rc.Compression = clientCompression
+			dial := rc.dial
+			rc.dial = func() (net.Conn, error) {
+				c, err := dial()
+				return &countingConn{Conn: c, written: &written}, err
+			}
+			for i := 1; i <= nSpans; i++ {
+				if err := rc.Collect(SpanID{Trace: ID(i), Span: ID(i), Parent: 0}, Annotation{"k", value}); err != nil {
+					t.Fatalf("%s: %s", name, err)
+				}
+				if i == 1 {
+					// Give the server's reply time to arrive, so that the
+					// rest of the connection is compressed.
+					time.Sleep(20 * time.Millisecond)
+				}
+			}
+			if err := rc.Close(); err != nil {
+				t.Errorf("%s: %s", name, err)
+			}
+			for deadline := time.Now().Add(5 * time.Second); store.Usage().Traces < nSpans && time.Now().Before(deadline); {
+				time.Sleep(5 * time.Millisecond)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := cs.Shutdown(ctx); err != nil {
+				t.Errorf("%s: %s", name, err)
+			}
+			cancel()
+			if u := store.Usage(); u.Traces != nSpans {
+				t.Errorf("%s: got %d traces, want %d", name, u.Traces, nSpans)
+			}
+			compressed := clientCompression != "" && serverCompression
+			sent[compressed] = atomic.LoadInt64(&written)
+		}
+	}
+	if sent[true]*2 > sent[false] {
+		t.Errorf("sent %d bytes compressed, %d uncompressed; want compression", sent[true], sent[false])
+	}
+}
+
+// countingConn is a net.Conn that counts the bytes written to it, and the
+// calls to Write if writes is non-nil.
+type countingConn struct {
+	net.Conn
+	written, writes *int64
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	atomic.AddInt64(c.written, int64(n))
+	if c.writes != nil {
+		atomic.AddInt64(c.writes, 1)
+	}
+	return n, err
+}
+
+func TestCollectorServer_v0Client(t *testing.T) {
+	store := NewMemoryStore()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := NewServer(l, store)
+	cs.Compression = true
+	go cs.Start()
+	defer cs.Shutdown(context.Background())
+
+	// A client of version 0 of the protocol sends packets without a
+	// handshake, and never reads from the connection.
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	w := pio.NewDelimitedWriter(c)
+	for _, id := range []ID{1, 2} {
+		if err := w.WriteMsg(newCollectPacket(SpanID{Trace: id, Span: id, Parent: 0}, nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for deadline := time.Now().Add(5 * time.Second); store.Usage().Traces < 2; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d traces, want 2", store.Usage().Traces)
+		}
+	}
+
+	// The server must not have written anything.
+	c.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if n, err := c.Read(make([]byte, 1)); n != 0 {
+		t.Errorf("server wrote to a version 0 client (read error: %v)", err)
+	}
+}
+
+func TestRemoteCollector_v0Server(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// A server of version 0 of the protocol, which doesn't know about the
+	// handshake and never writes to the connection.
+	received := make(chan SpanID)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		r := pio.NewDelimitedReader(c, DefaultMaxMessageSize)
+		for {
+			p := &v0CollectPacket{}
+			if err := r.ReadMsg(p); err != nil {
+				close(received)
+				return
+			}
+			received <- spanIDFromWire(p.Spanid)
+		}
+	}()
+
+	rc := NewRemoteCollector(l.Addr().String())
+	rc.Compression = CompressionGzip
+	for _, id := range []ID{1, 2, 3} {
+		if id == 3 {
+			// Batches are sent as single packets.
+			_, err = rc.collectBatch([]queuedSpan{{span: SpanID{Trace: id, Span: id, Parent: 0}}})
+		} else {
+			err = rc.Collect(SpanID{Trace: id, Span: id, Parent: 0})
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case got := <-received:
+			if want := (SpanID{Trace: id, Span: id, Parent: 0}); got != want {
+				t.Errorf("got span %v, want %v", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("span %v not received", id)
+		}
+	}
+	if err := rc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-received; ok {
+		t.Error("server received an unexpected packet")
+	}
+}
+
+// v0CollectPacket is the CollectPacket message of version 0 of the
+// protocol.
+type v0CollectPacket struct {
+	Spanid           *wire.CollectPacket_SpanID       `protobuf:"group,1,req,name=SpanID" json:"spanid,omitempty"`
+	Annotation       []*wire.CollectPacket_Annotation `protobuf:"group,5,rep,name=Annotation" json:"annotation,omitempty"`
+	XXX_unrecognized []byte                           `json:"-"`
+}
+
+func (m *v0CollectPacket) Reset()         { *m = v0CollectPacket{} }
+func (m *v0CollectPacket) String() string { return proto.CompactTextString(m) }
+func (*v0CollectPacket) ProtoMessage()    {}
+
+func TestChunkedCollector_RemoteBatch(t *testing.T) {
+	for _, compression := range []string{"", CompressionGzip} {
+		store := NewMemoryStore()
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cs := NewServer(l, store)
+		cs.Compression = true
+		go cs.Start()
+
+		var written, writes int64
+		rc := NewRemoteCollector(l.Addr().String())
+		rc.Compression = compression
+		rc.MaxMessageSize = 1000 // several frames per flush
+		dial := rc.dial
+		rc.dial = func() (net.Conn, error) {
+			c, err := dial()
+			return &countingConn{Conn: c, written: &written, writes: &writes}, err
+		}
+		cc := &ChunkedCollector{Collector: rc, MinInterval: time.Hour, MaxMessageSize: rc.MaxMessageSize}
+
+		var trace ID
+		flush := func(n int) int64 {
+			before := atomic.LoadInt64(&writes)
+			for i := 0; i < n; i++ {
+				trace++
+				if err := cc.Collect(SpanID{Trace: trace, Span: trace, Parent: 0}, Annotation{"k", bytes.Repeat([]byte("v"), 100)}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := cc.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			return atomic.LoadInt64(&writes) - before
+		}
+
+		// The first flush sends the handshake.
+		flush(1)
+		rc.mu.Lock()
+		reply := rc.reply
+		rc.mu.Unlock()
+		<-reply.done
+
+		// The next ones are sent in a single write (after the zero-length
+		// frame that starts the batch frames), or in a few with gzip, which
+		// writes each compressed block.
+		flush(100)
+		want := int64(1)
+		if compression != "" {
+			want = 10
+		}
+		if got := flush(100); got > want {
+			t.Errorf("compression %q: got %d writes for a flush, want at most %d", compression, got, want)
+		}
+
+		stats := waitForServerStats(cs, func(s CollectorServerStats) bool { return s.Spans == 201 })
+		if stats.Spans != 201 || stats.Packets != 201 {
+			t.Errorf("compression %q: got %d packets and %d spans, want 201", compression, stats.Packets, stats.Spans)
+		}
+		if u := store.Usage(); u.Traces != 201 {
+			t.Errorf("compression %q: got %d traces, want 201", compression, u.Traces)
+		}
+		cc.Stop()
+		rc.Close()
+		if err := cs.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCollectorServer_protocolVersion(t *testing.T) {
+	store := NewMemoryStore()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := NewServer(l, store)
+	cs.Log = log.New(ioutil.Discard, "", 0)
+	go cs.Start()
+	defer cs.Shutdown(context.Background())
+
+	tests := []struct {
+		major, minor uint32
+		accept       bool
+	}{
+		{ProtocolMajor, ProtocolMinor, true},
+		{ProtocolMajor, ProtocolMinor + 7, true}, // newer minor version
+		{ProtocolMajor + 1, 0, false},
+	}
+	for i, test := range tests {
+		c, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		trace := ID(i + 1)
+		p := newCollectPacket(SpanID{Trace: trace, Span: trace, Parent: 0}, nil)
+		p.Handshake = &wire.CollectPacket_Handshake{Major: proto.Uint32(test.major), Minor: proto.Uint32(test.minor)}
+		if err := pio.NewDelimitedWriter(c).WriteMsg(p); err != nil {
+			t.Fatal(err)
+		}
+		c.SetReadDeadline(time.Now().Add(5 * time.Second))
+		reply := &wire.CollectReply{}
+		if err := pio.NewDelimitedReader(c, DefaultMaxMessageSize).ReadMsg(reply); err != nil {
+			t.Fatalf("version %d.%d: reading reply: %s", test.major, test.minor, err)
+		}
+		c.Close()
+		if reply.GetMajor() != ProtocolMajor || reply.GetMinor() != ProtocolMinor {
+			t.Errorf("version %d.%d: got server version %d.%d", test.major, test.minor, reply.GetMajor(), reply.GetMinor())
+		}
+		if accepted := reply.Error == nil; accepted != test.accept {
+			t.Errorf("version %d.%d: got accepted == %v (error %q), want %v", test.major, test.minor, accepted, reply.GetError(), test.accept)
+		}
+		if _, err := store.Trace(trace); (err == nil) != test.accept {
+			t.Errorf("version %d.%d: got trace error %v", test.major, test.minor, err)
+		}
+	}
+	if got := cs.Rejected(); got != 1 {
+		t.Errorf("got %d rejected messages, want 1", got)
+	}
+}
+
+func TestCollectorServer_Tokens(t *testing.T) {
+	store := NewMemoryStore()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logBuf syncBuffer
+	cs := NewServer(l, store)
+	cs.Log = log.New(&logBuf, "", 0)
+	cs.Debug, cs.Trace = true, true
+	cs.Tokens = []string{"s3cret", "0ther-s3cret"}
+	go cs.Start()
+	defer cs.Shutdown(context.Background())
+
+	tests := []struct {
+		name   string
+		token  *string
+		accept bool
+	}{
+		{"no handshake", nil, false},
+		{"no token", proto.String(""), false},
+		{"wrong token", proto.String("s3cre"), false},
+		{"valid token", proto.String("s3cret"), true},
+		{"other valid token", proto.String("0ther-s3cret"), true},
+	}
+	for i, test := range tests {
+		c, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		trace := ID(i + 1)
+		p := newCollectPacket(SpanID{Trace: trace, Span: trace, Parent: 0}, Annotations{{Key: "k", Value: []byte("v")}})
+		if test.token != nil {
+			p.Handshake = &wire.CollectPacket_Handshake{Major: proto.Uint32(ProtocolMajor), Token: test.token}
+		}
+		if err := pio.NewDelimitedWriter(c).WriteMsg(p); err != nil {
+			t.Fatal(err)
+		}
+		c.SetReadDeadline(time.Now().Add(5 * time.Second))
+		reply := &wire.CollectReply{}
+		err = pio.NewDelimitedReader(c, DefaultMaxMessageSize).ReadMsg(reply)
+		c.Close()
+		if test.token == nil {
+			// Clients without a handshake aren't replied to.
+			if err != io.EOF {
+				t.Errorf("%s: got error %v, want the connection closed", test.name, err)
+			}
+		} else if err != nil {
+			t.Fatalf("%s: reading reply: %s", test.name, err)
+		} else if accepted := reply.Error == nil; accepted != test.accept {
+			t.Errorf("%s: got accepted == %v (error %q), want %v", test.name, accepted, reply.GetError(), test.accept)
+		}
+		if _, err := store.Trace(trace); (err == nil) != test.accept {
+			t.Errorf("%s: got trace error %v", test.name, err)
+		}
+	}
+	if got := cs.Rejected(); got != 3 {
+		t.Errorf("got %d rejected messages, want 3", got)
+	}
+	if logs := logBuf.String(); strings.Contains(logs, "s3cre") {
+		t.Errorf("a token was logged; log:\n%s", logs)
+	}
+	wantStats := map[string]ClientStats{"token 1": {Accepted: 1}, "token 2": {Accepted: 1}}
+	if stats := cs.ClientStats(); !reflect.DeepEqual(stats, wantStats) {
+		t.Errorf("got client stats %+v, want %+v", stats, wantStats)
+	}
+
+	// A RemoteCollector with a valid token is accepted.
+	rc := NewRemoteCollector(l.Addr().String())
+	rc.Token = "s3cret"
+	rc.Log = log.New(ioutil.Discard, "", 0)
+	collectorT{t, rc}.MustCollect(SpanID{Trace: 100, Span: 100, Parent: 0})
+	if err := rc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		if _, err := store.Trace(100); err == nil {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCollectorServer_RequireSecureAuth(t *testing.T) {
+	now := time.Now()
+	ca := newTestCert(t, nil, "test CA", now.Add(-time.Hour), now.Add(time.Hour))
+	serverCert := newTestCert(t, ca, "127.0.0.1", now.Add(-time.Hour), now.Add(time.Hour))
+	caPool := x509.NewCertPool()
+	caPool.AddCert(ca.Leaf)
+
+	received := make(chan SpanID, 10)
+	mc := collectorFunc(func(span SpanID, anns ...Annotation) error {
+		received <- span
+		return nil
+	})
+	startServer := func(l net.Listener) *CollectorServer {
+		cs := NewServer(l, mc)
+		cs.Log = log.New(ioutil.Discard, "", 0)
+		cs.Tokens = []string{"s3cret"}
+		cs.RequireSecureAuth = true
+		go cs.Start()
+		return cs
+	}
+
+	// Plaintext TCP clients are rejected before anything is read.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := startServer(l)
+	defer cs.Shutdown(context.Background())
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reply := &wire.CollectReply{}
+	if err := pio.NewDelimitedReader(c, DefaultMaxMessageSize).ReadMsg(reply); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	if want := "authentication requires TLS"; reply.GetError() != want {
+		t.Errorf("got error %q, want %q", reply.GetError(), want)
+	}
+	if got := cs.Rejected(); got != 1 {
+		t.Errorf("got %d rejected messages, want 1", got)
+	}
+
+	// TLS and unix socket clients are accepted.
+	tl, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcs := startServer(tls.NewListener(tl, &tls.Config{Certificates: []tls.Certificate{*serverCert}}))
+	defer tcs.Shutdown(context.Background())
+	dir, err := ioutil.TempDir("", "appdash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ul, err := ListenUnix(filepath.Join(dir, "collector.sock"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ucs := startServer(ul)
+	defer ucs.Shutdown(context.Background())
+
+	collectors := []*RemoteCollector{
+		NewTLSRemoteCollector(tl.Addr().String(), &tls.Config{RootCAs: caPool, ServerName: "127.0.0.1"}),
+		NewRemoteCollector("unix://" + ul.Addr().String()),
+	}
+	for i, rc := range collectors {
+		rc.Token = "s3cret"
+		rc.Log = log.New(ioutil.Discard, "", 0)
+		span := SpanID{Trace: ID(i + 1), Span: 1, Parent: 0}
+		collectorT{t, rc}.MustCollect(span)
+		select {
+		case got := <-received:
+			if got != span {
+				t.Errorf("got span %v, want %v", got, span)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("span %v not received", span)
+		}
+		rc.Close()
+	}
+}
+
+func TestCollectorServer_Stats(t *testing.T) {
+	mc := collectorFunc(func(span SpanID, anns ...Annotation) error {
+		if span.Trace == 3 {
+			return errors.New("store error")
+		}
+		return nil
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := NewServer(l, mc)
+	cs.Log = log.New(ioutil.Discard, "", 0)
+	go cs.Start()
+	defer cs.Shutdown(context.Background())
+
+	published := map[string]fmt.Stringer{}
+	cs.PublishStats("collector_", func(name string, v fmt.Stringer) { published[name] = v })
+
+	waitForStats := func(done func(CollectorServerStats) bool) CollectorServerStats {
+		return waitForServerStats(cs, done)
+	}
+
+	var written int64
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := pio.NewDelimitedWriter(&countingConn{Conn: c, written: &written})
+	for _, trace := range []ID{1, 2} {
+		if err := w.WriteMsg(newCollectPacket(SpanID{Trace: trace, Span: 1, Parent: 0}, Annotations{{Key: "k"}})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats := waitForStats(func(s CollectorServerStats) bool { return s.Spans == 2 })
+	if want := (CollectorServerStats{Packets: 2, Spans: 2, Bytes: uint64(written), ActiveConns: 1}); stats != want {
+		t.Errorf("got stats %+v, want %+v", stats, want)
+	}
+	if got, want := published["collector_bytes"].String(), fmt.Sprint(written); got != want {
+		t.Errorf("got published bytes %s, want %s", got, want)
+	}
+	if got := published["collector_active_conns"].String(); got != "1" {
+		t.Errorf("got published active_conns %s, want 1", got)
+	}
+
+	// A store error and a decode error, which both close the connection.
+	if err := w.WriteMsg(newCollectPacket(SpanID{Trace: 3, Span: 1, Parent: 0}, nil)); err != nil {
+		t.Fatal(err)
+	}
+	c2, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2.Write([]byte{3, 0xff, 0xff, 0xff})
+	stats = waitForStats(func(s CollectorServerStats) bool { return s.DecodeErrors == 1 && s.StoreErrors == 1 && s.ActiveConns == 0 })
+	c.Close()
+	c2.Close()
+	if want := (CollectorServerStats{Packets: 4, Spans: 2, Bytes: uint64(written) + 4, DecodeErrors: 1, StoreErrors: 1, Rejected: 1}); stats != want {
+		t.Errorf("got stats %+v, want %+v", stats, want)
+	}
+	if len(published) != 10 {
+		t.Errorf("got %d published stats, want 10", len(published))
+	}
+}
+
+// waitForServerStats waits (for up to 5 seconds) until done returns true
+// for the stats of cs, and returns them.
+func waitForServerStats(cs *CollectorServer, done func(CollectorServerStats) bool) CollectorServerStats {
+	var stats CollectorServerStats
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if stats = cs.Stats(); done(stats) {
+			break
+		}
+	}
+	return stats
+}
+
+func TestCollectorServer_IdleTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := NewServer(l, NewMemoryStore())
+	cs.Log = log.New(ioutil.Discard, "", 0)
+	cs.IdleTimeout = 200 * time.Millisecond
+	go cs.Start()
+	defer cs.Shutdown(context.Background())
+
+	// A client that sends nothing, and one that sends a packet more often
+	// than the idle timeout.
+	idle, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Close()
+	active, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer active.Close()
+	w := pio.NewDelimitedWriter(active)
+	for i := 0; i < 10; i++ {
+		if err := w.WriteMsg(newCollectPacket(SpanID{Trace: 1, Span: ID(i + 1), Parent: 0}, nil)); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	stats := waitForServerStats(cs, func(s CollectorServerStats) bool { return s.IdleClosedConns == 1 && s.Spans == 10 })
+	if stats.IdleClosedConns != 1 || stats.ActiveConns != 1 {
+		t.Errorf("got %d idle-closed and %d active connections, want 1 and 1", stats.IdleClosedConns, stats.ActiveConns)
+	}
+	idle.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := idle.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("got read error %v on the idle connection, want io.EOF", err)
+	}
+}
+
+func TestRemoteCollector_Heartbeat(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := NewServer(l, NewMemoryStore())
+	cs.Log = log.New(ioutil.Discard, "", 0)
+	cs.IdleTimeout = 200 * time.Millisecond
+	go cs.Start()
+	defer cs.Shutdown(context.Background())
+
+	rc := NewRemoteCollector(l.Addr().String())
+	rc.HeartbeatInterval = 50 * time.Millisecond
+	defer rc.Close()
+	if err := rc.Collect(SpanID{Trace: 1, Span: 1, Parent: 0}); err != nil {
+		t.Fatal(err)
+	}
+	rc.mu.Lock()
+	conn := rc.conn
+	rc.mu.Unlock()
+
+	// The heartbeats keep the idle connection open.
+	stats := waitForServerStats(cs, func(s CollectorServerStats) bool { return s.Heartbeats >= 8 })
+	if stats.Heartbeats < 8 || stats.IdleClosedConns != 0 {
+		t.Errorf("got %d heartbeats and %d idle-closed connections, want at least 8 and 0", stats.Heartbeats, stats.IdleClosedConns)
+	}
+	if stats.Spans != 1 {
+		t.Errorf("got %d spans, want 1", stats.Spans)
+	}
+	if err := rc.Collect(SpanID{Trace: 2, Span: 2, Parent: 0}); err != nil {
+		t.Fatal(err)
+	}
+	rc.mu.Lock()
+	reconnected := rc.conn != conn
+	rc.mu.Unlock()
+	if reconnected {
+		t.Error("got reconnected, want the same connection")
+	}
+}
+
+func TestRemoteCollector_HeartbeatDeadPeer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// A server that accepts heartbeats, but stops reading after the first
+	// packet of each connection, like a connection dropped by a NAT.
+	received := make(chan SpanID, 2)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+			p := &wire.CollectPacket{}
+			if err := pio.NewDelimitedReader(c, DefaultMaxMessageSize).ReadMsg(p); err != nil {
+				return
+			}
+			pio.NewDelimitedWriter(c).WriteMsg(&wire.CollectReply{
+				Major:     proto.Uint32(ProtocolMajor),
+				Minor:     proto.Uint32(ProtocolMinor),
+				Heartbeat: proto.Bool(true),
+			})
+			received <- spanIDFromWire(p.Spanid)
+		}
+	}()
+
+	rc := NewRemoteCollector(l.Addr().String())
+	rc.HeartbeatInterval = 20 * time.Millisecond
+	defer rc.Close()
+	if err := rc.Collect(SpanID{Trace: 1, Span: 1, Parent: 0}); err != nil {
+		t.Fatal(err)
+	}
+	<-received
+
+	// The unacknowledged heartbeat closes the connection...
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		rc.mu.Lock()
+		closed := rc.pconn == nil
+		rc.mu.Unlock()
+		if closed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("connection to the dead server not closed")
+		}
+	}
+
+	// ...so that the next collection is sent over a new one.
+	if err := rc.Collect(SpanID{Trace: 2, Span: 2, Parent: 0}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-received:
+		if want := (SpanID{Trace: 2, Span: 2, Parent: 0}); got != want {
+			t.Errorf("got span %v, want %v", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("span not received over a new connection")
+	}
+}
+
+func TestCollectorServer_MaxConns(t *testing.T) {
+	for _, queue := range []bool{false, true} {
+		ms := NewMemoryStore()
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cs := NewServer(l, ms)
+		cs.Log = log.New(ioutil.Discard, "", 0)
+		cs.MaxConns = 1
+		cs.QueueConns = queue
+		go cs.Start()
+
+		c1, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitForServerStats(cs, func(s CollectorServerStats) bool { return s.ActiveConns == 1 })
+
+		c2, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := pio.NewDelimitedWriter(c2).WriteMsg(newCollectPacket(SpanID{Trace: 2, Span: 2, Parent: 0}, nil)); err != nil {
+			t.Fatal(err)
+		}
+		if !queue {
+			stats := waitForServerStats(cs, func(s CollectorServerStats) bool { return s.RefusedConns == 1 })
+			if stats.RefusedConns != 1 || stats.ActiveConns != 1 {
+				t.Errorf("got %d refused and %d active connections, want 1 and 1", stats.RefusedConns, stats.ActiveConns)
+			}
+		} else {
+			// The second connection is only accepted once the first is
+			// closed.
+			time.Sleep(50 * time.Millisecond)
+			if _, err := ms.Trace(2); err != ErrTraceNotFound {
+				t.Errorf("got trace 2 collected (err %v) while the first connection is open", err)
+			}
+			c1.Close()
+			stats := waitForServerStats(cs, func(s CollectorServerStats) bool { return s.Spans == 1 })
+			if stats.Spans != 1 || stats.RefusedConns != 0 {
+				t.Errorf("got %d spans and %d refused connections, want 1 and 0", stats.Spans, stats.RefusedConns)
+			}
+		}
+		c1.Close()
+		c2.Close()
+		if err := cs.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCollectorServer_ErrorHandler(t *testing.T) {
+	errDiskFull := errors.New("disk full")
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := NewServer(l, collectorFunc(func(span SpanID, anns ...Annotation) error {
+		if span.Trace == 1 {
+			return errDiskFull
+		}
+		return nil
+	}))
+	cs.Log = log.New(ioutil.Discard, "", 0)
+	type handledError struct {
+		err        error
+		remoteAddr string
+	}
+	handled := make(chan handledError, 1)
+	cs.SetErrorHandler(func(err error, remoteAddr string) {
+		handled <- handledError{err, remoteAddr}
+	})
+	go cs.Start()
+	defer cs.Shutdown(context.Background())
+
+	send := func(data []byte) net.Conn {
+		c, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	marshal := func(span SpanID) []byte {
+		var buf bytes.Buffer
+		pio.NewDelimitedWriter(&buf).WriteMsg(newCollectPacket(span, nil))
+		return buf.Bytes()
+	}
+
+	tests := []struct {
+		data []byte
+		kind ServerErrorKind
+	}{
+		{marshal(SpanID{Trace: 1, Span: 1, Parent: 0}), ServerStoreError},
+		{[]byte{3, 0xff, 0xff, 0xff}, ServerDecodeError},
+	}
+	for _, test := range tests {
+		c := send(test.data)
+		select {
+		case h := <-handled:
+			var serr *ServerError
+			if !errors.As(h.err, &serr) || serr.Kind != test.kind {
+				t.Errorf("got error %v (%T), want a %s error", h.err, h.err, test.kind)
+			}
+			if test.kind == ServerStoreError && !errors.Is(h.err, errDiskFull) {
+				t.Errorf("got error %v, want it to wrap %v", h.err, errDiskFull)
+			}
+			if h.remoteAddr != c.LocalAddr().String() {
+				t.Errorf("got remote address %q, want %q", h.remoteAddr, c.LocalAddr())
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s error not handled", test.kind)
+		}
+		c.Close()
+	}
+
+	// A panicking handler doesn't affect the server.
+	cs.SetErrorHandler(func(error, string) { panic("boom") })
+	send(marshal(SpanID{Trace: 1, Span: 1, Parent: 0})).Close()
+	c := send(marshal(SpanID{Trace: 2, Span: 2, Parent: 0}))
+	defer c.Close()
+	stats := waitForServerStats(cs, func(s CollectorServerStats) bool { return s.Spans == 1 && s.StoreErrors == 2 })
+	if stats.Spans != 1 || stats.StoreErrors != 2 {
+		t.Errorf("got %d spans and %d store errors, want 1 and 2", stats.Spans, stats.StoreErrors)
+	}
+}
+
+// fakeClock is a clock for CollectorServer.now and sleep, which only
+// advances when told to.
+type fakeClock struct {
+	mu     sync.Mutex
+	t      time.Time
+	sleeps []time.Duration
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) sleep(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sleeps = append(c.sleeps, d)
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+func TestCollectorServer_RateLimit(t *testing.T) {
+	for _, drop := range []bool{true, false} {
+		clock := &fakeClock{t: time.Unix(1000, 0)}
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cs := NewServer(l, NewMemoryStore())
+		cs.Log = log.New(ioutil.Discard, "", 0)
+		cs.now, cs.sleep = clock.now, clock.sleep
+		cs.RateLimit = 10
+		cs.RateBurst = 2
+		cs.DropOverLimit = drop
+		go cs.Start()
+
+		c, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := pio.NewDelimitedWriter(c)
+		send := func(n int) {
+			for i := 0; i < n; i++ {
+				if err := w.WriteMsg(newCollectPacket(NewRootSpanID(), nil)); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		waitForStats := func(want ClientStats) {
+			var got ClientStats
+			for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+				if got = cs.ClientStats()["127.0.0.1"]; got == want {
+					return
+				}
+			}
+			t.Fatalf("drop %v: got client stats %+v, want %+v", drop, got, want)
+		}
+
+		send(5)
+		if drop {
+			// The burst is accepted, and the rest is dropped.
+			waitForStats(ClientStats{Accepted: 2, Dropped: 3})
+			clock.advance(100 * time.Millisecond)
+			send(2)
+			waitForStats(ClientStats{Accepted: 3, Dropped: 4})
+		} else {
+			// Everything is accepted, after waiting for the tokens.
+			waitForStats(ClientStats{Accepted: 5})
+			clock.mu.Lock()
+			sleeps := clock.sleeps
+			clock.mu.Unlock()
+			if want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond}; !reflect.DeepEqual(sleeps, want) {
+				t.Errorf("got sleeps %v, want %v", sleeps, want)
+			}
+		}
+		c.Close()
+		cs.Shutdown(context.Background())
+	}
+}
+
+func TestCollectorServer_idleClients(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	cs := NewServer(nil, NewMemoryStore())
+	cs.now = clock.now
+	cs.ClientIdleTime = time.Minute
+
+	// A client with an open connection is kept, however long it is idle.
+	a, b := cs.client("10.0.0.1"), cs.client("10.0.0.2")
+	atomic.AddUint64(&a.accepted, 2)
+	atomic.AddUint64(&b.accepted, 3)
+	atomic.AddUint64(&b.dropped, 1)
+	cs.releaseClient(b)
+	clock.advance(time.Minute)
+	cs.client("10.0.0.3")
+
+	want := map[string]ClientStats{
+		"10.0.0.1":    {Accepted: 2},
+		"10.0.0.3":    {},
+		IdleClientsID: {Accepted: 3, Dropped: 1},
+	}
+	if stats := cs.ClientStats(); !reflect.DeepEqual(stats, want) {
+		t.Errorf("got client stats %+v, want %+v", stats, want)
+	}
+
+	// A forgotten client starts again from zero when it reconnects.
+	cs.client("10.0.0.2")
+	want["10.0.0.2"] = ClientStats{}
+	if stats := cs.ClientStats(); !reflect.DeepEqual(stats, want) {
+		t.Errorf("got client stats %+v, want %+v", stats, want)
+	}
+}
+
+func TestRemoteCollector_reconnect(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received = map[ID]bool{}
+	)
+	mc := collectorFunc(func(span SpanID, anns ...Annotation) error {
+		mu.Lock()
+		defer mu.Unlock()
+		received[span.Trace] = true
+		return nil
+	})
+	waitFor := func(trace ID) bool {
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			mu.Lock()
+			ok := received[trace]
+			mu.Unlock()
+			if ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	kl := &killableListener{Listener: l}
+	go NewServer(kl, mc).Start()
+
+	rc := NewRemoteCollector(addr)
+	rc.MinBackoff = 5 * time.Millisecond
+	rc.MaxBackoff = 20 * time.Millisecond
+	var dialing, maxDialing int32
+	dial := rc.dial
+	rc.dial = func() (net.Conn, error) {
+		n := atomic.AddInt32(&dialing, 1)
+		defer atomic.AddInt32(&dialing, -1)
+		if n > atomic.LoadInt32(&maxDialing) {
+			atomic.StoreInt32(&maxDialing, n)
+		}
+		return dial()
+	}
+	defer rc.Close()
+
+	if err := rc.Collect(SpanID{Trace: 1, Span: 1, Parent: 0}); err != nil {
+		t.Fatal(err)
+	}
+	if !waitFor(1) {
+		t.Fatal("span not received before restart")
+	}
+
+	// Kill the server, and collect concurrently while it is down and after
+	// it has restarted.
+	kl.kill()
+	var (
+		next ID = 2
+		wg   sync.WaitGroup
+		done = make(chan struct{})
+	)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				mu.Lock()
+				id := next
+				next++
+				mu.Unlock()
+				rc.Collect(SpanID{Trace: id, Span: id, Parent: 0})
+				time.Sleep(time.Millisecond)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	restart := next
+	mu.Unlock()
+
+	l, err = net.Listen("tcp", addr)
+	if err != nil {
+		close(done)
+		wg.Wait()
+		t.Fatal(err)
+	}
+	kl = &killableListener{Listener: l}
+	defer kl.kill()
+	go NewServer(kl, mc).Start()
+
+	resumed := false
+	for deadline := time.Now().Add(5 * time.Second); !resumed && time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		mu.Lock()
+		for id := range received {
+			if id >= restart {
+				resumed = true
+			}
+		}
+		mu.Unlock()
+	}
+	close(done)
+	wg.Wait()
+	if !resumed {
+		t.Fatal("spans did not resume flowing after the server restarted")
+	}
+	if n := atomic.LoadInt32(&maxDialing); n != 1 {
+		t.Errorf("got %d concurrent dials, want 1", n)
+	}
+}
+
+func TestRemoteCollector_BufferSize(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []SpanID
+	)
+	mc := collectorFunc(func(span SpanID, anns ...Annotation) error {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, span)
+		return nil
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kl := &killableListener{Listener: l}
+	defer kl.kill()
+	go NewServer(kl, mc).Start()
+
+	var up int32
+	rc := NewRemoteCollector(l.Addr().String())
+	rc.MinBackoff = time.Millisecond
+	rc.MaxBackoff = time.Millisecond
+	rc.BufferSize = 2
+	dial := rc.dial
+	rc.dial = func() (net.Conn, error) {
+		if atomic.LoadInt32(&up) == 0 {
+			return nil, errors.New("server down")
+		}
+		return dial()
+	}
+	defer rc.Close()
+
+	// The oldest collection is dropped when the buffer is full.
+	for i := ID(1); i <= 3; i++ {
+		if err := rc.Collect(SpanID{Trace: i, Span: i, Parent: 0}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	atomic.StoreInt32(&up, 1)
+
+	want := []SpanID{{Trace: 2, Span: 2, Parent: 0}, {Trace: 3, Span: 3, Parent: 0}}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		mu.Lock()
+		n := len(received)
+		mu.Unlock()
+		if n >= len(want) {
+			break
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(received, want) {
+		t.Errorf("got spans %v, want %v", received, want)
+	}
+}
+
+func TestRemoteCollector_WriteTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// A server that accepts connections, but never reads from them.
+	var accepted int64
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, c := range conns {
+				c.Close()
+			}
+		}()
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt64(&accepted, 1)
+			conns = append(conns, c)
+		}
+	}()
+
+	rc := NewRemoteCollector(l.Addr().String())
+	rc.WriteTimeout = 100 * time.Millisecond
+	defer rc.Close()
+
+	// Once the socket buffers are full, writes time out, and the client
+	// reconnects instead of hanging.
+	value := bytes.Repeat([]byte("v"), 512*1024)
+	for i := 0; i < 128 && atomic.LoadInt64(&accepted) < 2; i++ {
+		start := time.Now()
+		rc.Collect(SpanID{Trace: 1, Span: ID(i + 1), Parent: 0}, Annotation{"k", value})
+		if d := time.Since(start); d > 2*time.Second {
+			t.Fatalf("Collect took %s, want it bounded by the write timeout", d)
+		}
+	}
+	if atomic.LoadInt64(&accepted) < 2 {
+		t.Error("got no reconnection after a write timed out")
+	}
+}
+
+// killableListener is a net.Listener whose connections can all be closed
+// at once, to simulate a server crash.
+type killableListener struct {
+	net.Listener
+
+	mu     sync.Mutex
+	conns  []net.Conn
+	killed bool
+}
+
+func (l *killableListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	l.mu.Lock()
+	killed := l.killed
+	if err == nil && !killed {
+		l.conns = append(l.conns, c)
+	}
+	l.mu.Unlock()
+	if err != nil || killed {
+		if c != nil {
+			c.Close()
+		}
+		select {} // block CollectorServer.Start forever, instead of spinning
+	}
+	return c, nil
+}
+
+func (l *killableListener) kill() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.killed = true
+	l.Listener.Close()
+	for _, c := range l.conns {
+		c.Close()
+	}
+}
+
 func TestCollectorServer_stress(t *testing.T) {
 	if testing.Short() {
 		t.Skip()
@@ -102,21 +1494,127 @@ func TestCollectorServer_stress(t *testing.T) {
 		want[id] = struct{}{}
 		cc.MustCollect(id)
 	}
-	if err := cc.Collector.(*RemoteCollector).Close(); err != nil {
-		t.Error(err)
+	if err := cc.Collector.(*RemoteCollector).Close(); err != nil {
+		t.Error(err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	var missing []string
+	for spanID := range want {
+		if _, present := packets[spanID]; !present {
+			missing = append(missing, fmt.Sprintf("span %v was not collected", spanID))
+		}
+	}
+	if len(missing) > allowFailures {
+		for _, missing := range missing {
+			t.Error(missing)
+		}
+	}
+}
+
+func TestRemoteCollector_unix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "appdash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "collector.sock")
+
+	store := NewMemoryStore()
+	l, err := ListenUnix(path, 0660)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if perm := fi.Mode().Perm(); perm != 0660 {
+		t.Errorf("got socket permissions %o, want 660", perm)
+	}
+	cs := NewServer(l, store)
+	go cs.Start()
+
+	rc := NewRemoteCollector("unix://" + path)
+	rc.MinBackoff = 5 * time.Millisecond
+	rc.MaxBackoff = 20 * time.Millisecond
+	rc.BufferSize = 10
+	defer rc.Close()
+	if err := rc.Collect(SpanID{Trace: 1, Span: 1, Parent: 0}); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); store.Usage().Traces < 1; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("span not received before restart")
+		}
+	}
+
+	// Restart the server, leaving a stale socket file behind like a
+	// crashed server would. Spans collected in the meantime are sent once
+	// the collector has reconnected.
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := cs.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("socket file removed: %s", err)
+	}
+	for i := 0; i < 100; i++ {
+		// The first collections may fail, before the collector notices
+		// that the connection is closed.
+		rc.Collect(SpanID{Trace: 2, Span: 2, Parent: 0})
+		rc.mu.Lock()
+		reconnecting := rc.reconnecting
+		rc.mu.Unlock()
+		if reconnecting {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	l, err = ListenUnix(path, 0660)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs = NewServer(l, store)
+	go cs.Start()
+	defer cs.Shutdown(context.Background())
+
+	for deadline := time.Now().Add(5 * time.Second); store.Usage().Traces < 2; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d traces, want 2", store.Usage().Traces)
+		}
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "appdash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A server is already listening.
+	path := filepath.Join(dir, "collector.sock")
+	l, err := ListenUnix(path, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ListenUnix(path, 0600); err == nil {
+		t.Error("got no error listening on a socket that is in use")
+	}
+	l.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket file not removed on close (stat error: %v)", err)
 	}
 
-	time.Sleep(20 * time.Millisecond)
-	var missing []string
-	for spanID := range want {
-		if _, present := packets[spanID]; !present {
-			missing = append(missing, fmt.Sprintf("span %v was not collected", spanID))
-		}
+	// Files that aren't sockets are never removed.
+	file := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(file, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
 	}
-	if len(missing) > allowFailures {
-		for _, missing := range missing {
-			t.Error(missing)
-		}
+	if _, err := ListenUnix(file, 0600); err == nil {
+		t.Error("got no error listening on a regular file")
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Error(err)
 	}
 }
 
@@ -156,6 +1654,143 @@ func BenchmarkRemoteCollector1000(b *testing.B) {
 	}
 }
 
+func TestRemoteCollectorPool(t *testing.T) {
+	// Each connection of the pool goes to a different server, to see which
+	// connection the spans were sent over.
+	const n = 3
+	var (
+		mu       sync.Mutex
+		received [n]map[SpanID]bool
+		servers  [n]*killableListener
+	)
+	for i := range servers {
+		i := i
+		received[i] = map[SpanID]bool{}
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		servers[i] = &killableListener{Listener: l}
+		defer servers[i].kill()
+		go NewServer(servers[i], collectorFunc(func(span SpanID, anns ...Annotation) error {
+			mu.Lock()
+			defer mu.Unlock()
+			received[i][span] = true
+			return nil
+		})).Start()
+	}
+	var next int
+	p := NewRemoteCollectorPool(n, func() *RemoteCollector {
+		rc := NewRemoteCollector(servers[next].Addr().String())
+		rc.MinBackoff = time.Hour // don't reconnect in the background
+		next++
+		return rc
+	})
+	defer p.Close()
+
+	// waitFor waits until the servers have received want spans in total.
+	waitFor := func(want int) {
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			mu.Lock()
+			got := 0
+			for _, r := range received {
+				got += len(r)
+			}
+			mu.Unlock()
+			if got >= want {
+				return
+			}
+		}
+		t.Fatalf("timed out waiting for %d spans", want)
+	}
+
+	for trace := ID(1); trace <= 6; trace++ {
+		for span := ID(1); span <= 3; span++ {
+			if err := p.Collect(SpanID{Trace: trace, Span: span, Parent: 0}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	waitFor(18)
+
+	// All spans of a trace must have been sent over the same connection,
+	// and all connections must have been used.
+	mu.Lock()
+	traceConn := map[ID]int{}
+	for i, r := range received {
+		if len(r) == 0 {
+			t.Errorf("connection %d was not used", i)
+		}
+		for span := range r {
+			if c, ok := traceConn[span.Trace]; ok && c != i {
+				t.Errorf("trace %v: spans sent over connections %d and %d", span.Trace, c, i)
+			}
+			traceConn[span.Trace] = i
+		}
+	}
+	mu.Unlock()
+
+	// The failure of one connection must not affect the others.
+	dead := traceConn[1]
+	servers[dead].kill()
+	for trace := ID(1); trace <= 6; trace++ {
+		p.Collect(SpanID{Trace: trace, Span: 4, Parent: 0})
+	}
+	for trace := ID(1); trace <= 6; trace++ {
+		if traceConn[trace] == dead {
+			continue
+		}
+		id := SpanID{Trace: trace, Span: 4, Parent: 0}
+		ok := false
+		for deadline := time.Now().Add(5 * time.Second); !ok && time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			mu.Lock()
+			ok = received[traceConn[trace]][id]
+			mu.Unlock()
+		}
+		if !ok {
+			t.Errorf("span %v was not received after connection %d failed", id, dead)
+		}
+	}
+}
+
+func BenchmarkRemoteCollectorPool(b *testing.B) {
+	for _, conns := range []int{1, 4} {
+		b.Run(fmt.Sprintf("conns=%d", conns), func(b *testing.B) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				b.Fatal(err)
+			}
+			kl := &killableListener{Listener: l}
+			defer kl.kill()
+			cs := NewServer(kl, collectorFunc(func(span SpanID, anns ...Annotation) error {
+				return nil
+			}))
+			cs.Log = log.New(ioutil.Discard, "", 0)
+			go cs.Start()
+
+			p := NewRemoteCollectorPool(conns, func() *RemoteCollector {
+				return NewRemoteCollector(l.Addr().String())
+			})
+			anns := make([]Annotation, 10)
+			for a := range anns {
+				anns[a] = Annotation{"k1", []byte("v1")}
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if err := p.Collect(NewRootSpanID(), anns...); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+			b.StopTimer()
+			if err := p.Close(); err != nil {
+				b.Error(err)
+			}
+		})
+	}
+}
+
 func TestTLSCollectorServer(t *testing.T) {
 	var numPackets int
 	mc := collectorFunc(func(span SpanID, anns ...Annotation) error {
@@ -173,8 +1808,8 @@ func TestTLSCollectorServer(t *testing.T) {
 	go cs.Start()
 
 	cc := &collectorT{t, NewTLSRemoteCollector(l.Addr().String(), &localhostTLSConfig)}
-	cc.MustCollect(SpanID{1, 2, 3})
-	cc.MustCollect(SpanID{2, 3, 4})
+	cc.MustCollect(SpanID{Trace: 1, Span: 2, Parent: 3})
+	cc.MustCollect(SpanID{Trace: 2, Span: 3, Parent: 4})
 	if err := cc.Collector.(*RemoteCollector).Close(); err != nil {
 		t.Error(err)
 	}
@@ -185,6 +1820,151 @@ func TestTLSCollectorServer(t *testing.T) {
 	}
 }
 
+func TestTLSServer_clientCert(t *testing.T) {
+	now := time.Now()
+	ca := newTestCert(t, nil, "test CA", now.Add(-time.Hour), now.Add(time.Hour))
+	otherCA := newTestCert(t, nil, "other CA", now.Add(-time.Hour), now.Add(time.Hour))
+	serverCert := newTestCert(t, ca, "127.0.0.1", now.Add(-time.Hour), now.Add(time.Hour))
+	caPool := x509.NewCertPool()
+	caPool.AddCert(ca.Leaf)
+
+	var (
+		mu       sync.Mutex
+		received = map[ID]bool{}
+		logBuf   syncBuffer
+	)
+	mc := collectorFunc(func(span SpanID, anns ...Annotation) error {
+		mu.Lock()
+		defer mu.Unlock()
+		received[span.Trace] = true
+		return nil
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kl := &killableListener{Listener: l}
+	defer kl.kill()
+	cs := NewTLSServer(kl, &tls.Config{
+		Certificates: []tls.Certificate{*serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    caPool,
+	}, mc)
+	cs.Log = log.New(&logBuf, "", 0)
+	go cs.Start()
+
+	tests := []struct {
+		name   string
+		cert   *tls.Certificate
+		accept bool
+	}{
+		{"no cert", nil, false},
+		{"untrusted", newTestCert(t, otherCA, "client", now.Add(-time.Hour), now.Add(time.Hour)), false},
+		{"expired", newTestCert(t, ca, "client", now.Add(-2*time.Hour), now.Add(-time.Hour)), false},
+		{"valid", newTestCert(t, ca, "client", now.Add(-time.Hour), now.Add(time.Hour)), true},
+	}
+	for i, test := range tests {
+		config := &tls.Config{RootCAs: caPool, ServerName: "127.0.0.1"}
+		if test.cert != nil {
+			config.Certificates = []tls.Certificate{*test.cert}
+		}
+		rc := NewTLSRemoteCollector(l.Addr().String(), config)
+		rc.MinBackoff = time.Hour // don't reconnect in the background
+		err := rc.Collect(SpanID{Trace: ID(i + 1), Span: 1, Parent: 0})
+		if test.accept && err != nil {
+			t.Errorf("%s: %s", test.name, err)
+		}
+		// Depending on the TLS version, a rejected client may only notice
+		// after sending, so Collect may return nil.
+		rc.Close()
+	}
+
+	// Wait for the accepted span and for all rejections to be logged.
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		mu.Lock()
+		ok := received[ID(len(tests))]
+		mu.Unlock()
+		if ok && strings.Count(logBuf.String(), "TLS handshake") >= len(tests)-1 {
+			break
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i, test := range tests {
+		if got := received[ID(i+1)]; got != test.accept {
+			t.Errorf("%s: got span received == %v, want %v", test.name, got, test.accept)
+		}
+	}
+	logs := logBuf.String()
+	if n := strings.Count(logs, "TLS handshake"); n != len(tests)-1 {
+		t.Errorf("got %d handshake failures logged, want %d; log:\n%s", n, len(tests)-1, logs)
+	}
+	if !strings.Contains(logs, "Client 127.0.0.1:") {
+		t.Errorf("handshake failures were logged without the client address; log:\n%s", logs)
+	}
+}
+
+// newTestCert returns a certificate (and its key) for name, valid between
+// notBefore and notAfter, signed by parent. If parent is nil, it returns a
+// self-signed CA certificate.
+func newTestCert(t *testing.T, parent *tls.Certificate, name string, notBefore, notAfter time.Time) *tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if ip := net.ParseIP(name); ip != nil {
+		tmpl.IPAddresses = []net.IP{ip}
+	}
+	signer, signerKey := tmpl, interface{}(key)
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// syncBuffer is a bytes.Buffer that is safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
 func TestChunkedCollector(t *testing.T) {
 	var packets []*wire.CollectPacket
 	mc := collectorFunc(func(span SpanID, anns ...Annotation) error {
@@ -196,10 +1976,10 @@ func TestChunkedCollector(t *testing.T) {
 		Collector:   mc,
 		MinInterval: time.Millisecond * 10,
 	}
-	cc.Collect(SpanID{1, 2, 3}, Annotation{"k1", []byte("v1")})
-	cc.Collect(SpanID{1, 2, 3}, Annotation{"k2", []byte("v2")})
-	cc.Collect(SpanID{2, 3, 4}, Annotation{"k3", []byte("v3")})
-	cc.Collect(SpanID{1, 2, 3}, Annotation{"k4", []byte("v4")})
+	cc.Collect(SpanID{Trace: 1, Span: 2, Parent: 3}, Annotation{"k1", []byte("v1")})
+	cc.Collect(SpanID{Trace: 1, Span: 2, Parent: 3}, Annotation{"k2", []byte("v2")})
+	cc.Collect(SpanID{Trace: 2, Span: 3, Parent: 4}, Annotation{"k3", []byte("v3")})
+	cc.Collect(SpanID{Trace: 1, Span: 2, Parent: 3}, Annotation{"k4", []byte("v4")})
 
 	// Check before the MinInterval has elapsed.
 	if len(packets) != 0 {
@@ -210,8 +1990,8 @@ func TestChunkedCollector(t *testing.T) {
 
 	// Check after the MinInterval has elapsed.
 	want := []*wire.CollectPacket{
-		newCollectPacket(SpanID{1, 2, 3}, Annotations{{"k1", []byte("v1")}, {"k2", []byte("v2")}, {"k4", []byte("v4")}}),
-		newCollectPacket(SpanID{2, 3, 4}, Annotations{{"k3", []byte("v3")}}),
+		newCollectPacket(SpanID{Trace: 1, Span: 2, Parent: 3}, Annotations{{"k1", []byte("v1")}, {"k2", []byte("v2")}, {"k4", []byte("v4")}}),
+		newCollectPacket(SpanID{Trace: 2, Span: 3, Parent: 4}, Annotations{{"k3", []byte("v3")}}),
 	}
 	sort.Sort(byTraceID(packets))
 	sort.Sort(byTraceID(want))
@@ -222,7 +2002,7 @@ func TestChunkedCollector(t *testing.T) {
 	// Check that Stop stops it.
 	lenBeforeStop := len(packets)
 	cc.Stop()
-	cc.Collect(SpanID{1, 2, 3}, Annotation{"k5", []byte("v5")})
+	cc.Collect(SpanID{Trace: 1, Span: 2, Parent: 3}, Annotation{"k5", []byte("v5")})
 	time.Sleep(cc.MinInterval * 2)
 	if len(packets) != lenBeforeStop {
 		t.Errorf("after Stop: got len(packets) == %d, want %d", len(packets), lenBeforeStop)
@@ -254,6 +2034,322 @@ func TestChunkedCollectorFlushTimeout(t *testing.T) {
 	}
 }
 
+func TestChunkedCollector_batchFailed(t *testing.T) {
+	var mu sync.Mutex
+	collected := map[SpanID]int{}
+	bc := &batchCollectorFunc{
+		Collector: collectorFunc(func(span SpanID, anns ...Annotation) error {
+			mu.Lock()
+			defer mu.Unlock()
+			collected[span]++
+			return nil
+		}),
+	}
+	cc := &ChunkedCollector{Collector: bc, MinInterval: time.Hour}
+	defer cc.Stop()
+
+	// The spans that the batch fails to send are sent one at a time.
+	errBatch := errors.New("batch failed")
+	bc.batch = func(spans []queuedSpan) ([]queuedSpan, error) {
+		for _, s := range spans[1:] {
+			bc.Collect(s.span, s.anns...)
+		}
+		return spans[:1], errBatch
+	}
+	for i := ID(1); i <= 3; i++ {
+		cc.Collect(SpanID{Trace: i, Span: i})
+	}
+	if err := cc.Flush(); err != errBatch {
+		t.Errorf("got error %v, want %v", err, errBatch)
+	}
+	for i := ID(1); i <= 3; i++ {
+		if n := collected[SpanID{Trace: i, Span: i}]; n != 1 {
+			t.Errorf("got span %d collected %d times, want once", i, n)
+		}
+	}
+
+	// They are dropped once the flush has timed out.
+	cc.FlushTimeout = time.Millisecond
+	bc.batch = func(spans []queuedSpan) ([]queuedSpan, error) {
+		time.Sleep(10 * time.Millisecond)
+		return spans, errBatch
+	}
+	for i := ID(4); i <= 6; i++ {
+		cc.Collect(SpanID{Trace: i, Span: i})
+		cc.Collect(SpanID{Trace: i, Span: i}, Annotation{Key: "k"})
+	}
+	if err := cc.Flush(); err == nil || !strings.Contains(err.Error(), ErrQueueDropped.Error()) {
+		t.Errorf("got error %v, want %v", err, ErrQueueDropped)
+	}
+	if got, want := cc.Dropped(), uint64(6); got != want {
+		t.Errorf("got %d dropped collections, want %d", got, want)
+	}
+	if len(collected) != 3 {
+		t.Errorf("got %d spans collected, want 3", len(collected))
+	}
+}
+
+func TestChunkedCollector_Overflow(t *testing.T) {
+	for _, policy := range []OverflowPolicy{QueueDropAll, QueueDropNewest, QueueDropOldest, QueueBlock} {
+		// A black hole: the first flush never completes, so the queue is
+		// never drained again.
+		blackHole := make(chan struct{})
+		cc := &ChunkedCollector{
+			Collector: collectorFunc(func(span SpanID, anns ...Annotation) error {
+				<-blackHole
+				return nil
+			}),
+			MinInterval:  time.Millisecond,
+			MaxQueueSize: 1000,
+			Overflow:     policy,
+			BlockTimeout: time.Millisecond,
+		}
+		for i := 0; i < 1000; i++ {
+			err := cc.Collect(NewRootSpanID(), Annotation{"k", []byte("v")})
+			if err != nil && err != ErrQueueDropped && err != ErrQueueFull {
+				t.Fatalf("policy %d: %s", policy, err)
+			}
+
+			cc.mu.Lock()
+			size := cc.queueSizeBytes
+			cc.mu.Unlock()
+			if size > cc.MaxQueueSize {
+				t.Fatalf("policy %d: got queue size %d, want at most %d", policy, size, cc.MaxQueueSize)
+			}
+		}
+		if cc.Dropped() < 900 {
+			t.Errorf("policy %d: got %d collections dropped, want at least 900", policy, cc.Dropped())
+		}
+		cc.Stop()
+		close(blackHole)
+	}
+}
+
+func TestChunkedCollector_QueueDropOldest(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		spans []SpanID
+	)
+	cc := &ChunkedCollector{
+		Collector: collectorFunc(func(span SpanID, anns ...Annotation) error {
+			mu.Lock()
+			defer mu.Unlock()
+			spans = append(spans, span)
+			return nil
+		}),
+		MinInterval:  time.Hour,
+		MaxQueueSize: 3 * 3 * 8, // 3 spans without annotations
+		Overflow:     QueueDropOldest,
+	}
+	for i := ID(1); i <= 5; i++ {
+		if err := cc.Collect(SpanID{Trace: i, Span: i, Parent: 0}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	sort.Sort(spanIDsByTrace(spans))
+	if want := []SpanID{{Trace: 3, Span: 3, Parent: 0}, {Trace: 4, Span: 4, Parent: 0}, {Trace: 5, Span: 5, Parent: 0}}; !reflect.DeepEqual(spans, want) {
+		t.Errorf("got spans %v, want %v", spans, want)
+	}
+	if got := cc.Dropped(); got != 2 {
+		t.Errorf("got %d collections dropped, want 2", got)
+	}
+}
+
+type spanIDsByTrace []SpanID
+
+func (s spanIDsByTrace) Len() int           { return len(s) }
+func (s spanIDsByTrace) Less(i, j int) bool { return s[i].Trace < s[j].Trace }
+func (s spanIDsByTrace) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func TestChunkedCollector_QueueBlock(t *testing.T) {
+	cc := &ChunkedCollector{
+		Collector:    collectorFunc(func(span SpanID, anns ...Annotation) error { return nil }),
+		MinInterval:  5 * time.Millisecond,
+		MaxQueueSize: 3 * 8,
+		Overflow:     QueueBlock,
+		BlockTimeout: time.Second,
+	}
+	defer cc.Stop()
+
+	// Each collection waits for the previous one to be flushed.
+	for i := ID(1); i <= 3; i++ {
+		if err := cc.Collect(SpanID{Trace: i, Span: i, Parent: 0}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := cc.Dropped(); got != 0 {
+		t.Errorf("got %d collections dropped, want 0", got)
+	}
+}
+
+func TestChunkedCollector_AfterFlush(t *testing.T) {
+	errCollect := errors.New("collect failed")
+	type flush struct {
+		spans int
+		err   error
+	}
+	var flushes []flush
+	var cc *ChunkedCollector
+	cc = &ChunkedCollector{
+		Collector: collectorFunc(func(span SpanID, anns ...Annotation) error {
+			if span.Trace == 1 {
+				return errCollect
+			}
+			return nil
+		}),
+		MinInterval: time.Hour,
+		AfterFlush: func(spans int, err error) {
+			flushes = append(flushes, flush{spans, err})
+			cc.LastError() // must not deadlock
+		},
+	}
+	defer cc.Stop()
+
+	cc.Collect(SpanID{Trace: 1, Span: 1, Parent: 0})
+	cc.Collect(SpanID{Trace: 2, Span: 2, Parent: 0})
+	if err := cc.Flush(); err != errCollect {
+		t.Fatalf("got Flush error %v, want %v", err, errCollect)
+	}
+	if err := cc.LastError(); err != errCollect {
+		t.Errorf("got LastError %v, want %v", err, errCollect)
+	}
+
+	cc.Collect(SpanID{Trace: 2, Span: 2, Parent: 0})
+	if err := cc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cc.LastError(); err != nil {
+		t.Errorf("got LastError %v, want nil", err)
+	}
+
+	want := []flush{{2, errCollect}, {1, nil}}
+	if !reflect.DeepEqual(flushes, want) {
+		t.Errorf("got flushes %v, want %v", flushes, want)
+	}
+}
+
+func TestChunkedCollector_Compact(t *testing.T) {
+	var packets []*wire.CollectPacket
+	var merged []int
+	cc := &ChunkedCollector{
+		Collector: collectorFunc(func(span SpanID, anns ...Annotation) error {
+			packets = append(packets, newCollectPacket(span, anns))
+			return nil
+		}),
+		MinInterval: time.Hour,
+		OnCompact:   func(n int) { merged = append(merged, n) },
+	}
+	defer cc.Stop()
+
+	cc.Collect(SpanID{Trace: 2, Span: 2, Parent: 0}, Annotation{"progress", []byte("1")}, Annotation{"name", []byte("a")})
+	cc.Collect(SpanID{Trace: 1, Span: 1, Parent: 0}, Annotation{"k", []byte("v")})
+	cc.Collect(SpanID{Trace: 2, Span: 2, Parent: 0}, Annotation{"progress", []byte("2")})
+	cc.Collect(SpanID{Trace: 2, Span: 2, Parent: 0}, Annotation{"done", nil}, Annotation{"progress", []byte("3")})
+	if err := cc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The later values win, and the keys and spans stay in the order they
+	// first appeared in.
+	want := []*wire.CollectPacket{
+		newCollectPacket(SpanID{Trace: 2, Span: 2, Parent: 0}, Annotations{{"progress", []byte("3")}, {"name", []byte("a")}, {"done", nil}}),
+		newCollectPacket(SpanID{Trace: 1, Span: 1, Parent: 0}, Annotations{{"k", []byte("v")}}),
+	}
+	if !reflect.DeepEqual(packets, want) {
+		t.Errorf("got packets %v, want %v", packets, want)
+	}
+	if want := []int{2}; !reflect.DeepEqual(merged, want) {
+		t.Errorf("got merged %v, want %v", merged, want)
+	}
+}
+
+func TestChunkedCollector_Close(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		spans []SpanID
+	)
+	cc := &ChunkedCollector{
+		Collector: collectorFunc(func(span SpanID, anns ...Annotation) error {
+			mu.Lock()
+			defer mu.Unlock()
+			spans = append(spans, span)
+			return nil
+		}),
+		MinInterval: time.Hour,
+	}
+	for i := ID(1); i <= 3; i++ {
+		if err := cc.Collect(SpanID{Trace: i, Span: i, Parent: 0}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The spans recorded before Close must have been sent.
+	sort.Sort(spanIDsByTrace(spans))
+	if want := []SpanID{{Trace: 1, Span: 1, Parent: 0}, {Trace: 2, Span: 2, Parent: 0}, {Trace: 3, Span: 3, Parent: 0}}; !reflect.DeepEqual(spans, want) {
+		t.Errorf("got spans %v, want %v", spans, want)
+	}
+
+	if err := cc.Collect(SpanID{Trace: 4, Span: 4, Parent: 0}); err != ErrCollectorClosed {
+		t.Errorf("got Collect error %v after Close, want %v", err, ErrCollectorClosed)
+	}
+	if err := cc.Close(); err != nil {
+		t.Errorf("got error %v from second Close, want nil", err)
+	}
+	cc.Stop() // must not panic
+}
+
+func TestChunkedCollector_StopUnstarted(t *testing.T) {
+	cc := &ChunkedCollector{Collector: collectorFunc(func(SpanID, ...Annotation) error { return nil })}
+	cc.Stop()
+	cc.Stop()
+	if err := cc.Collect(SpanID{Trace: 1, Span: 1, Parent: 0}); err != ErrCollectorClosed {
+		t.Errorf("got Collect error %v after Stop, want %v", err, ErrCollectorClosed)
+	}
+}
+
+func TestChunkedCollector_MaxMessageSize(t *testing.T) {
+	const maxSize = 200
+	var got Annotations
+	collections := 0
+	cc := &ChunkedCollector{
+		Collector: collectorFunc(func(span SpanID, anns ...Annotation) error {
+			if size := proto.Size(newCollectPacket(span, anns)); size > maxSize {
+				t.Errorf("got message of %d bytes, want at most %d", size, maxSize)
+			}
+			got = append(got, anns...)
+			collections++
+			return nil
+		}),
+		MinInterval:    time.Hour,
+		MaxMessageSize: maxSize,
+	}
+	defer cc.Stop()
+
+	var want Annotations
+	for i := 0; i < 20; i++ {
+		a := Annotation{fmt.Sprintf("k%d", i), bytes.Repeat([]byte{'v'}, 40)}
+		want = append(want, a)
+		if err := cc.Collect(SpanID{Trace: 1, Span: 1, Parent: 0}, a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if collections < 2 {
+		t.Errorf("got %d collections, want the annotations to be split", collections)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got annotations %v, want %v", got, want)
+	}
+}
+
 // collectorFunc implements the Collector interface by calling the function.
 type collectorFunc func(SpanID, ...Annotation) error
 
@@ -262,6 +2358,17 @@ func (c collectorFunc) Collect(id SpanID, as ...Annotation) error {
 	return c(id, as...)
 }
 
+// batchCollectorFunc is a batchCollector whose collectBatch method calls
+// batch.
+type batchCollectorFunc struct {
+	Collector
+	batch func([]queuedSpan) ([]queuedSpan, error)
+}
+
+func (c *batchCollectorFunc) collectBatch(spans []queuedSpan) ([]queuedSpan, error) {
+	return c.batch(spans)
+}
+
 type collectorT struct {
 	t *testing.T
 	Collector
@@ -337,7 +2444,7 @@ func BenchmarkChunkedCollector500(b *testing.B) {
 				anns[i] = Annotation{Key: "k", Value: []byte{'v'}}
 			}
 			x++
-			err := cc.Collect(SpanID{x, x + 1, x + 2}, anns...)
+			err := cc.Collect(SpanID{Trace: x, Span: x + 1, Parent: x + 2}, anns...)
 			if err != nil {
 				b.Fatal(err)
 			}
@@ -345,6 +2452,78 @@ func BenchmarkChunkedCollector500(b *testing.B) {
 	}
 }
 
+// BenchmarkChunkedCollector_RemoteFlush compares flushing a ChunkedCollector
+// to a RemoteCollector with batch frames (in a single write) and without them
+// (one packet, and one write, at a time).
+func BenchmarkChunkedCollector_RemoteFlush(b *testing.B) {
+	const (
+		nCollections = 500
+		nAnnotations = 10
+	)
+	for _, batch := range []bool{false, true} {
+		b.Run(fmt.Sprintf("batch=%v", batch), func(b *testing.B) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				b.Fatal(err)
+			}
+			cs := NewServer(l, collectorFunc(func(span SpanID, anns ...Annotation) error {
+				return nil
+			}))
+			go cs.Start()
+			defer cs.Shutdown(context.Background())
+
+			var written, writes int64
+			rc := NewRemoteCollector(l.Addr().String())
+			dial := rc.dial
+			rc.dial = func() (net.Conn, error) {
+				c, err := dial()
+				return &countingConn{Conn: c, written: &written, writes: &writes}, err
+			}
+			defer rc.Close()
+			cc := &ChunkedCollector{Collector: rc, MinInterval: time.Hour}
+			if !batch {
+				// Hide collectBatch.
+				cc.Collector = collectorFunc(rc.Collect)
+			}
+			defer cc.Stop()
+
+			anns := make([]Annotation, nAnnotations)
+			for i := range anns {
+				anns[i] = Annotation{Key: fmt.Sprintf("k%d", i), Value: []byte("value")}
+			}
+			var x ID
+			flush := func() {
+				for c := 0; c < nCollections; c++ {
+					x++
+					if err := cc.Collect(SpanID{Trace: x, Span: x, Parent: 0}, anns...); err != nil {
+						b.Fatal(err)
+					}
+				}
+				if err := cc.Flush(); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			// Complete the handshake first.
+			flush()
+			rc.mu.Lock()
+			reply := rc.reply
+			rc.mu.Unlock()
+			<-reply.done
+			flush()
+
+			b.ResetTimer()
+			before := atomic.LoadInt64(&writes)
+			for i := 0; i < b.N; i++ {
+				flush()
+			}
+			b.StopTimer()
+			b.ReportMetric(float64(atomic.LoadInt64(&writes)-before)/float64(b.N), "writes/flush")
+			b.ReportMetric(float64(nCollections*b.N)/b.Elapsed().Seconds(), "spans/s")
+		})
+	}
+}
+
 type byTraceID []*wire.CollectPacket
 
 func (bt byTraceID) Len() int           { return len(bt) }
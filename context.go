@@ -0,0 +1,89 @@
+package appdash
+
+import "context"
+
+// contextKey is the type of the keys of the values that this package
+// stores in a context.Context.
+type contextKey int
+
+const (
+	recorderKey contextKey = iota // the current *Recorder
+	spanIDKey                     // the current SpanID
+)
+
+// DefaultCollector is the collector of the spans started by
+// StartSpanFromContext when there is no Recorder in the context. If nil,
+// those spans aren't collected.
+var DefaultCollector Collector
+
+// NewContextWithRecorder returns a copy of ctx whose current span is that
+// of the recorder: RecorderFromContext returns r, and SpanIDFromContext
+// returns its SpanID. The integrations (such as httptrace and sqltrace)
+// use it, so that the spans that they record nest correctly.
+func NewContextWithRecorder(ctx context.Context, r *Recorder) context.Context {
+	ctx = context.WithValue(ctx, recorderKey, r)
+	return context.WithValue(ctx, spanIDKey, r.SpanID)
+}
+
+// RecorderFromContext returns the recorder of the current span of ctx, if
+// any (see NewContextWithRecorder). It returns false if the current span
+// was set by NewContextWithSpanID afterwards, so that it isn't recorded on
+// by mistake.
+func RecorderFromContext(ctx context.Context) (*Recorder, bool) {
+	r, ok := ctx.Value(recorderKey).(*Recorder)
+	if !ok || r == nil {
+		return nil, false
+	}
+	if span, ok := SpanIDFromContext(ctx); !ok || span != r.SpanID {
+		return nil, false
+	}
+	return r, true
+}
+
+// NewContextWithSpanID returns a copy of ctx whose current span is span,
+// for when there is no Recorder for it (for example, when the span was
+// received from another process).
+func NewContextWithSpanID(ctx context.Context, span SpanID) context.Context {
+	return context.WithValue(ctx, spanIDKey, span)
+}
+
+// SpanIDFromContext returns the SpanID of the current span of ctx, if any
+// (see NewContextWithSpanID and NewContextWithRecorder).
+func SpanIDFromContext(ctx context.Context) (SpanID, bool) {
+	span, ok := ctx.Value(spanIDKey).(SpanID)
+	return span, ok
+}
+
+// StartSpanFromContext starts a span with the given name, which is a child
+// of the current span of ctx, or a root span if there is none, and returns
+// its recorder and a copy of ctx whose current span it is. The caller must
+// finish the span:
+//
+//	rec, ctx := appdash.StartSpanFromContext(ctx, "fetch")
+//	defer rec.Finish()
+//
+// If there is a Recorder in ctx, the span is its child (see
+// Recorder.Child). Otherwise, the span is collected by DefaultCollector.
+func StartSpanFromContext(ctx context.Context, name string) (*Recorder, context.Context) {
+	var rec *Recorder
+	if parent, ok := RecorderFromContext(ctx); ok {
+		rec = parent.ChildWithName(name)
+	} else {
+		c := DefaultCollector
+		if c == nil {
+			c = discardCollector{}
+		}
+		span := NewRootSpanID()
+		if parent, ok := SpanIDFromContext(ctx); ok {
+			span = NewSpanID(parent)
+		}
+		rec = NewRecorder(span, c)
+		rec.Name(name)
+	}
+	return rec, NewContextWithRecorder(ctx, rec)
+}
+
+// discardCollector is a Collector that drops the collections.
+type discardCollector struct{}
+
+func (discardCollector) Collect(SpanID, ...Annotation) error { return nil }
@@ -0,0 +1,76 @@
+package appdash
+
+import (
+	"context"
+	"testing"
+)
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	if _, ok := RecorderFromContext(ctx); ok {
+		t.Error("got a recorder from an empty context")
+	}
+	if _, ok := SpanIDFromContext(ctx); ok {
+		t.Error("got a SpanID from an empty context")
+	}
+
+	rec := NewRecorder(SpanID{Trace: 1, Span: 2}, NewMemoryStore())
+	ctx = NewContextWithRecorder(ctx, rec)
+	if got, ok := RecorderFromContext(ctx); !ok || got != rec {
+		t.Errorf("got recorder %v, %v, want %v", got, ok, rec)
+	}
+	if got, ok := SpanIDFromContext(ctx); !ok || got != rec.SpanID {
+		t.Errorf("got SpanID %v, %v, want %v", got, ok, rec.SpanID)
+	}
+
+	// A later SpanID supersedes the recorder.
+	span := SpanID{Trace: 1, Span: 3, Parent: 2}
+	ctx = NewContextWithSpanID(ctx, span)
+	if got, ok := RecorderFromContext(ctx); ok {
+		t.Errorf("got recorder %v of a superseded span", got)
+	}
+	if got, ok := SpanIDFromContext(ctx); !ok || got != span {
+		t.Errorf("got SpanID %v, %v, want %v", got, ok, span)
+	}
+}
+
+func TestStartSpanFromContext(t *testing.T) {
+	ms := NewMemoryStore()
+	defer func(c Collector) { DefaultCollector = c }(DefaultCollector)
+	DefaultCollector = ms
+
+	root, ctx := StartSpanFromContext(context.Background(), "root")
+	child, childCtx := StartSpanFromContext(ctx, "child")
+	grandchild, _ := StartSpanFromContext(childCtx, "grandchild")
+	remote, _ := StartSpanFromContext(NewContextWithSpanID(context.Background(), SpanID{Trace: 7, Span: 8}), "remote")
+	for _, r := range []*Recorder{grandchild, child, root, remote} {
+		r.Finish()
+	}
+
+	if root.Parent != 0 {
+		t.Errorf("got root span %v, want a root span", root.SpanID)
+	}
+	if child.Trace != root.Trace || child.Parent != root.Span {
+		t.Errorf("got child span %v, want a child of %v", child.SpanID, root.SpanID)
+	}
+	if grandchild.Trace != root.Trace || grandchild.Parent != child.Span {
+		t.Errorf("got grandchild span %v, want a child of %v", grandchild.SpanID, child.SpanID)
+	}
+	if remote.Trace != 7 || remote.Parent != 8 {
+		t.Errorf("got span %v, want a child of the span from the context", remote.SpanID)
+	}
+
+	trace, err := ms.Trace(root.Trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for r, name := range map[*Recorder]string{root: "root", child: "child", grandchild: "grandchild"} {
+		span := trace.FindSpan(r.Span)
+		if span == nil {
+			t.Fatalf("span %v not collected", r.SpanID)
+		}
+		if got := span.Name(); got != name {
+			t.Errorf("got span name %q, want %q", got, name)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package appdash
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NewDebugCollector returns a DebugCollector that writes the collected
+// spans to w.
+func NewDebugCollector(w io.Writer) *DebugCollector {
+	return &DebugCollector{w: w}
+}
+
+// A DebugCollector is a collector that writes each collection to an
+// io.Writer in a human-readable format, which makes it useful in examples,
+// tests and while developing. It is safe for concurrent use.
+//
+// Each call to Collect writes one block, with the span's trace, span and
+// parent IDs, followed by the events that the annotations decode into (span
+// names, timespans and log messages) and the remaining annotations.
+type DebugCollector struct {
+	// Color is whether the output is colorized using ANSI escape
+	// sequences (for terminals).
+	Color bool
+
+	// JSON is whether each collection is instead written as a single line
+	// holding a JSON object (see DebugSpan), for processing with tools
+	// such as jq.
+	JSON bool
+
+	mu sync.Mutex // guards w
+	w  io.Writer
+}
+
+// DebugSpan is the JSON representation of a collection written by a
+// DebugCollector in JSON mode.
+type DebugSpan struct {
+	Trace, Span ID
+	Parent      ID `json:",omitempty"`
+
+	Name    string `json:",omitempty"`
+	Service string `json:",omitempty"` // see Recorder.WithService
+
+	// Start and End are the times of the span's timespan event, if any,
+	// and Duration is the time between them (in nanoseconds).
+	Start    *time.Time    `json:",omitempty"`
+	End      *time.Time    `json:",omitempty"`
+	Duration time.Duration `json:",omitempty"`
+
+	Logs []DebugLog `json:",omitempty"`
+
+	// Annotations holds the annotations that were not decoded into any of
+	// the above.
+	Annotations map[string]string `json:",omitempty"`
+}
+
+// DebugLog is a log or message event of a DebugSpan. Time is nil for
+// message events, and Level is empty for the events without a level.
+type DebugLog struct {
+	Time  *time.Time `json:",omitempty"`
+	Level string     `json:",omitempty"`
+	Msg   string
+}
+
+// ANSI escape sequences used by DebugCollector.Color.
+const (
+	debugColorReset = "\x1b[0m"
+	debugColorID    = "\x1b[1;36m" // bold cyan
+	debugColorName  = "\x1b[1m"    // bold
+	debugColorKey   = "\x1b[33m"   // yellow
+)
+
+// Collect implements the Collector interface by writing the collection to
+// the underlying writer.
+func (dc *DebugCollector) Collect(span SpanID, anns ...Annotation) error {
+	ds := newDebugSpan(span, anns)
+
+	var buf bytes.Buffer
+	if dc.JSON {
+		if err := json.NewEncoder(&buf).Encode(ds); err != nil {
+			return err
+		}
+	} else {
+		dc.format(&buf, ds)
+	}
+
+	// Write each block at once, so that concurrent collections aren't
+	// interleaved.
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	_, err := dc.w.Write(buf.Bytes())
+	return err
+}
+
+// newDebugSpan decodes the annotations of a collection into a DebugSpan.
+func newDebugSpan(span SpanID, anns Annotations) *DebugSpan {
+	ds := &DebugSpan{Trace: span.Trace, Span: span.Span, Parent: span.Parent}
+
+	var events []Event
+	UnmarshalEvents(anns, &events)
+	decoded := map[string]bool{} // keys of the decoded annotations
+
+	// decodedRepeated marks the annotations of all of the repeated events
+	// of the schema (see RepeatedEvent) as decoded.
+	decodedRepeated := func(schema string) {
+		for _, a := range anns {
+			if strings.HasPrefix(a.Key, schema+".") {
+				decoded[a.Key] = true
+			}
+		}
+		decoded[SchemaPrefix+schema] = true
+	}
+	for _, e := range events {
+		switch e := e.(type) {
+		case SpanNameEvent:
+			ds.Name = e.Name
+		case TimespanEvent:
+			start, end := e.Start(), e.End()
+			ds.Start, ds.End, ds.Duration = &start, &end, EventDuration(e)
+		case logEvent:
+			t := e.Time
+			ds.Logs = append(ds.Logs, DebugLog{Time: &t, Msg: e.Msg})
+		case msgEvent:
+			ds.Logs = append(ds.Logs, DebugLog{Msg: e.Msg})
+		case LogLevelEvent:
+			t := e.Time
+			ds.Logs = append(ds.Logs, DebugLog{Time: &t, Level: e.Level.String(), Msg: e.Msg})
+			decodedRepeated(e.Schema())
+			continue
+		case LogFieldsEvent:
+			t := e.Time
+			keys := make([]string, 0, len(e.Fields))
+			for k := range e.Fields {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			fields := make([]string, len(keys))
+			for i, k := range keys {
+				fields[i] = fmt.Sprintf("%s=%q", k, e.Fields[k])
+			}
+			ds.Logs = append(ds.Logs, DebugLog{Time: &t, Msg: strings.Join(fields, " ")})
+			decodedRepeated(e.Schema())
+			continue
+		default:
+			continue // leave its annotations as they are
+		}
+		if eanns, err := MarshalEvent(e); err == nil {
+			for _, a := range eanns {
+				decoded[a.Key] = true
+			}
+		}
+	}
+
+	if service := anns.Get(ServiceKey); service != nil {
+		ds.Service = string(service)
+		decoded[ServiceKey] = true
+	}
+
+	for _, a := range anns {
+		if decoded[a.Key] {
+			continue
+		}
+		if ds.Annotations == nil {
+			ds.Annotations = map[string]string{}
+		}
+		ds.Annotations[a.Key] = string(a.Value)
+	}
+	return ds
+}
+
+// format writes ds to buf in the text format.
+func (dc *DebugCollector) format(buf *bytes.Buffer, ds *DebugSpan) {
+	color := func(c, s string) string {
+		if !dc.Color {
+			return s
+		}
+		return c + s + debugColorReset
+	}
+	field := func(key, format string, args ...interface{}) {
+		fmt.Fprintf(buf, "  %s %s\n", color(debugColorKey, fmt.Sprintf("%-9s", key)), fmt.Sprintf(format, args...))
+	}
+
+	id := SpanID{Trace: ds.Trace, Span: ds.Span, Parent: ds.Parent}
+	fmt.Fprintf(buf, "span %s", color(debugColorID, id.String()))
+	if ds.Name != "" {
+		fmt.Fprintf(buf, " %s", color(debugColorName, ds.Name))
+	}
+	buf.WriteString("\n")
+	field("trace", "%s", ds.Trace)
+	field("span", "%s", ds.Span)
+	if ds.Parent != 0 {
+		field("parent", "%s", ds.Parent)
+	}
+	if ds.Service != "" {
+		field("service", "%s", ds.Service)
+	}
+	if ds.Start != nil {
+		field("timespan", "%s (%s)", ds.Start.Format(time.RFC3339Nano), ds.Duration)
+	}
+	for _, l := range ds.Logs {
+		if l.Time != nil && l.Level != "" {
+			field("log", "%s %s %s", l.Time.Format(time.RFC3339Nano), strings.ToUpper(l.Level), l.Msg)
+		} else if l.Time != nil {
+			field("log", "%s %s", l.Time.Format(time.RFC3339Nano), l.Msg)
+		} else {
+			field("msg", "%s", l.Msg)
+		}
+	}
+	var keys []string
+	for k := range ds.Annotations {
+		if !strings.HasPrefix(k, SchemaPrefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		field(k, "%q", ds.Annotations[k])
+	}
+	buf.WriteString("\n")
+}
@@ -0,0 +1,75 @@
+package appdash
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDebugCollector(t *testing.T) {
+	var buf bytes.Buffer
+	dc := NewDebugCollector(&buf)
+
+	span := SpanID{Trace: 1, Span: 2, Parent: 3}
+	start := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	var anns Annotations
+	for _, e := range []Event{SpanName("GET /"), timespanEvent{S: start, E: start.Add(1500 * time.Millisecond)}, LogWithTimestamp("hello", start)} {
+		eanns, err := MarshalEvent(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		anns = append(anns, eanns...)
+	}
+	anns = append(anns, Annotation{Key: "User", Value: []byte("alice")})
+	if err := dc.Collect(span, anns...); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `span 0000000000000001/0000000000000002/0000000000000003 GET /
+  trace     0000000000000001
+  span      0000000000000002
+  parent    0000000000000003
+  timespan  2016-01-02T03:04:05Z (1.5s)
+  log       2016-01-02T03:04:05Z hello
+  User      "alice"
+
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got output\n%s\nwant\n%s", got, want)
+	}
+
+	// In JSON mode, each collection is a line.
+	buf.Reset()
+	dc.JSON = true
+	if err := dc.Collect(span, anns...); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := MarshalEvent(Msg("world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dc.Collect(SpanID{Trace: 1, Span: 1}, msg...); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), buf.String())
+	}
+	var ds DebugSpan
+	if err := json.Unmarshal([]byte(lines[0]), &ds); err != nil {
+		t.Fatal(err)
+	}
+	if ds.Span != 2 || ds.Name != "GET /" || ds.Duration != 1500*time.Millisecond || len(ds.Logs) != 1 || ds.Annotations["User"] != "alice" || len(ds.Annotations) != 1 {
+		t.Errorf("got %+v", ds)
+	}
+	ds = DebugSpan{}
+	if err := json.Unmarshal([]byte(lines[1]), &ds); err != nil {
+		t.Fatal(err)
+	}
+	if want := []DebugLog{{Msg: "world"}}; ds.Parent != 0 || !reflect.DeepEqual(ds.Logs, want) || ds.Annotations != nil {
+		t.Errorf("got %+v, want logs %+v", ds, want)
+	}
+}
@@ -0,0 +1,556 @@
+// Package elasticstore implements an appdash.Store backed by Elasticsearch,
+// which supports full-text search over annotation values (see Store.Search).
+//
+// Every Collect call is indexed as a document holding the span's IDs, its
+// collection time and the annotations collected in that call; Trace merges
+// the documents of each span back together. Documents are written to daily
+// indices (e.g. "appdash-2016.06.01"), so retention is a matter of deleting
+// old indices (see Store.DeleteIndicesBefore). The mapping, installed by New
+// as an index template, keeps IDs as keywords so that they are only ever
+// matched exactly, while annotation values are analyzed for full-text search.
+//
+// Collect is asynchronous: documents are queued in memory and written with
+// the bulk API by a background goroutine. Use Flush to wait for queued
+// documents to be written, and Close to flush and stop the background
+// goroutine.
+//
+// The store talks to Elasticsearch's REST API directly and requires
+// Elasticsearch 7.8 or newer.
+package elasticstore
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"sourcegraph.com/sourcegraph/appdash"
+	"sourcegraph.com/sourcegraph/appdash/internal/tracetree"
+)
+
+const (
+	// DefaultIndexPrefix is the default prefix of the store's index names.
+	DefaultIndexPrefix = "appdash"
+
+	// DefaultFlushInterval is the default interval at which queued
+	// documents are written.
+	DefaultFlushInterval = time.Second
+
+	// DefaultBatchSize is the default maximum number of documents written
+	// in a single bulk request.
+	DefaultBatchSize = 1000
+
+	// indexDateFormat is the time format of the date suffix of index names.
+	indexDateFormat = "2006.01.02"
+
+	// maxResults is the maximum number of documents or traces returned by a
+	// single search request.
+	maxResults = 10000
+)
+
+// Store is an appdash.Store and appdash.Queryer backed by Elasticsearch.
+type Store struct {
+	// BatchSize is the maximum number of documents written in a single bulk
+	// request.
+	BatchSize int
+
+	// Log is used to log errors writing queued documents, which are not
+	// returned by Collect. If nil, the standard logger is used.
+	Log *log.Logger
+
+	// Refresh, if true, makes Flush wait until written documents are visible
+	// to searches. This is mostly useful in tests.
+	Refresh bool
+
+	url    string // base URL of the Elasticsearch cluster
+	prefix string // index name prefix
+	client *http.Client
+
+	mu      sync.Mutex // protects queue
+	queue   []document
+	flushMu sync.Mutex // serializes Flush
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// Options configures a Store.
+type Options struct {
+	// IndexPrefix is the prefix of the store's index names. If empty,
+	// DefaultIndexPrefix is used.
+	IndexPrefix string
+
+	// FlushInterval is the interval at which queued documents are written.
+	// If zero, DefaultFlushInterval is used.
+	FlushInterval time.Duration
+
+	// HTTPClient is the client used to make requests. If nil,
+	// http.DefaultClient is used.
+	HTTPClient *http.Client
+}
+
+// Compile-time "implements" check.
+var _ interface {
+	appdash.DeleteStore
+	appdash.Queryer
+} = (*Store)(nil)
+
+// New installs the store's index template in the Elasticsearch cluster at
+// the given base URL (e.g. "http://localhost:9200") and returns a store using
+// it. If opts is nil, default options are used.
+func New(baseURL string, opts *Options) (*Store, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	s := &Store{
+		BatchSize: DefaultBatchSize,
+		url:       strings.TrimSuffix(baseURL, "/"),
+		prefix:    opts.IndexPrefix,
+		client:    opts.HTTPClient,
+		stop:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	if s.prefix == "" {
+		s.prefix = DefaultIndexPrefix
+	}
+	if s.client == nil {
+		s.client = http.DefaultClient
+	}
+	interval := opts.FlushInterval
+	if interval == 0 {
+		interval = DefaultFlushInterval
+	}
+
+	template := map[string]interface{}{
+		"index_patterns": []string{s.prefix + "-*"},
+		"template": map[string]interface{}{
+			"mappings": map[string]interface{}{
+				"dynamic": "strict",
+				"properties": map[string]interface{}{
+					"trace_id":  map[string]string{"type": "keyword"},
+					"span_id":   map[string]string{"type": "keyword"},
+					"parent_id": map[string]string{"type": "keyword"},
+					"root":      map[string]string{"type": "boolean"},
+					"collected": map[string]string{"type": "date_nanos"},
+					"keys":      map[string]string{"type": "keyword"},
+					"text":      map[string]string{"type": "text"},
+					// Annotations are stored verbatim for Trace, but
+					// searched via keys and text.
+					"annotations": map[string]interface{}{"type": "object", "enabled": false},
+				},
+			},
+		},
+	}
+	if err := s.do("PUT", "/_index_template/"+s.prefix, template, nil); err != nil {
+		return nil, fmt.Errorf("elasticstore: installing index template: %s", err)
+	}
+
+	go s.flushEvery(interval)
+	return s, nil
+}
+
+// document is the Elasticsearch document for a single Collect call.
+type document struct {
+	TraceID     string       `json:"trace_id"`
+	SpanID      string       `json:"span_id"`
+	ParentID    string       `json:"parent_id"`
+	Root        bool         `json:"root"`
+	Collected   time.Time    `json:"collected"`
+	Keys        []string     `json:"keys,omitempty"`
+	Text        []string     `json:"text,omitempty"`
+	Annotations []annotation `json:"annotations,omitempty"`
+}
+
+// annotation is the JSON representation of an appdash.Annotation. Values
+// that are valid UTF-8 are stored as text (Value); other values are stored
+// base64-encoded (Binary).
+type annotation struct {
+	Key    string `json:"k"`
+	Value  string `json:"v,omitempty"`
+	Binary string `json:"b,omitempty"`
+}
+
+func newDocument(id appdash.SpanID, as appdash.Annotations, collected time.Time) document {
+	d := document{
+		TraceID:   id.Trace.String(),
+		SpanID:    id.Span.String(),
+		ParentID:  id.Parent.String(),
+		Root:      id.IsRoot(),
+		Collected: collected,
+	}
+	for _, a := range as {
+		d.Keys = append(d.Keys, a.Key)
+		ja := annotation{Key: a.Key}
+		if utf8.Valid(a.Value) {
+			ja.Value = string(a.Value)
+			if len(a.Value) > 0 {
+				d.Text = append(d.Text, ja.Value)
+			}
+		} else {
+			ja.Binary = base64.StdEncoding.EncodeToString(a.Value)
+		}
+		d.Annotations = append(d.Annotations, ja)
+	}
+	return d
+}
+
+func (d *document) span() (appdash.Span, error) {
+	var (
+		span appdash.Span
+		err  error
+	)
+	if span.ID.Trace, err = appdash.ParseID(d.TraceID); err != nil {
+		return span, err
+	}
+	if span.ID.Span, err = appdash.ParseID(d.SpanID); err != nil {
+		return span, err
+	}
+	if span.ID.Parent, err = appdash.ParseID(d.ParentID); err != nil {
+		return span, err
+	}
+	for _, ja := range d.Annotations {
+		a := appdash.Annotation{Key: ja.Key}
+		switch {
+		case ja.Binary != "":
+			if a.Value, err = base64.StdEncoding.DecodeString(ja.Binary); err != nil {
+				return span, err
+			}
+		case ja.Value != "":
+			a.Value = []byte(ja.Value)
+		}
+		span.Annotations = append(span.Annotations, a)
+	}
+	return span, nil
+}
+
+// Collect implements the appdash.Collector interface by queueing a document
+// to be written asynchronously.
+func (s *Store) Collect(id appdash.SpanID, as ...appdash.Annotation) error {
+	d := newDocument(id, as, time.Now())
+	s.mu.Lock()
+	s.queue = append(s.queue, d)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Store) flushEvery(interval time.Duration) {
+	defer close(s.stopped)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if err := s.Flush(); err != nil {
+				s.logf("elasticstore: writing documents: %s", err)
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *Store) logf(format string, args ...interface{}) {
+	if s.Log != nil {
+		s.Log.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// Flush writes all queued documents using the bulk API, returning the first
+// error that occurred.
+func (s *Store) Flush() error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	queue := s.queue
+	s.queue = nil
+	s.mu.Unlock()
+
+	batchSize := s.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	path := "/_bulk"
+	if s.Refresh {
+		path += "?refresh=wait_for"
+	}
+
+	var firstErr error
+	for len(queue) > 0 {
+		n := batchSize
+		if n > len(queue) {
+			n = len(queue)
+		}
+		var body bytes.Buffer
+		enc := json.NewEncoder(&body)
+		for _, d := range queue[:n] {
+			enc.Encode(map[string]interface{}{
+				"index": map[string]string{"_index": s.index(d.Collected)},
+			})
+			enc.Encode(d)
+		}
+		var resp struct {
+			Errors bool `json:"errors"`
+			Items  []map[string]struct {
+				Error json.RawMessage `json:"error"`
+			} `json:"items"`
+		}
+		err := s.doRaw("POST", path, "application/x-ndjson", &body, &resp)
+		if err == nil && resp.Errors {
+			for _, item := range resp.Items {
+				for _, result := range item {
+					if len(result.Error) > 0 {
+						err = fmt.Errorf("bulk index: %s", result.Error)
+						break
+					}
+				}
+				if err != nil {
+					break
+				}
+			}
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		queue = queue[n:]
+	}
+	return firstErr
+}
+
+// Close flushes any queued documents and stops the background flushing
+// goroutine.
+func (s *Store) Close() error {
+	close(s.stop)
+	<-s.stopped
+	return s.Flush()
+}
+
+// index returns the name of the index for documents collected at t.
+func (s *Store) index(t time.Time) string {
+	return s.prefix + "-" + t.UTC().Format(indexDateFormat)
+}
+
+// searchResult is the subset of an Elasticsearch search response used by the
+// store.
+type searchResult struct {
+	Hits struct {
+		Hits []struct {
+			Source document `json:"_source"`
+		} `json:"hits"`
+	} `json:"hits"`
+}
+
+// search runs a search across all of the store's indices.
+func (s *Store) search(query map[string]interface{}) (*searchResult, error) {
+	var res searchResult
+	if err := s.do("POST", "/"+s.prefix+"-*/_search", query, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Trace implements the appdash.Store interface.
+func (s *Store) Trace(id appdash.ID) (*appdash.Trace, error) {
+	res, err := s.search(map[string]interface{}{
+		"size":  maxResults,
+		"query": map[string]interface{}{"term": map[string]string{"trace_id": id.String()}},
+		"sort":  []interface{}{map[string]string{"collected": "asc"}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Hits.Hits) == 0 {
+		return nil, appdash.ErrTraceNotFound
+	}
+	spans := make([]appdash.Span, 0, len(res.Hits.Hits))
+	for _, hit := range res.Hits.Hits {
+		span, err := hit.Source.span()
+		if err != nil {
+			return nil, err
+		}
+		spans = append(spans, span)
+	}
+	return tracetree.Build(spans), nil
+}
+
+// traceIDs runs a search returning the distinct trace IDs of the matching
+// documents, in order.
+func (s *Store) traceIDs(query map[string]interface{}, sortBy interface{}, limit int) ([]appdash.ID, error) {
+	if limit <= 0 || limit > maxResults {
+		limit = maxResults
+	}
+	body := map[string]interface{}{
+		"size":     limit,
+		"query":    query,
+		"collapse": map[string]string{"field": "trace_id"},
+		"_source":  []string{"trace_id"},
+	}
+	if sortBy != nil {
+		body["sort"] = sortBy
+	}
+	res, err := s.search(body)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]appdash.ID, 0, len(res.Hits.Hits))
+	for _, hit := range res.Hits.Hits {
+		id, err := appdash.ParseID(hit.Source.TraceID)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// Traces implements the appdash.Queryer interface. Traces are returned by
+// the time their root span was collected, most recent first. If
+// opts.Timespan is set, only traces whose root span was collected within it
+// are returned. The Matchers and MinDuration filters aren't supported.
+func (s *Store) Traces(opts appdash.TracesOpts) ([]*appdash.Trace, error) {
+	if err := appdash.UnsupportedFilters(opts); err != nil {
+		return nil, err
+	}
+	ids := opts.TraceIDs
+	if len(ids) == 0 {
+		filter := []interface{}{map[string]interface{}{"term": map[string]bool{"root": true}}}
+		if !opts.Timespan.S.IsZero() || !opts.Timespan.E.IsZero() {
+			r := map[string]interface{}{}
+			if !opts.Timespan.S.IsZero() {
+				r["gte"] = opts.Timespan.S
+			}
+			if !opts.Timespan.E.IsZero() {
+				r["lte"] = opts.Timespan.E
+			}
+			filter = append(filter, map[string]interface{}{"range": map[string]interface{}{"collected": r}})
+		}
+		var err error
+		ids, err = s.traceIDs(
+			map[string]interface{}{"bool": map[string]interface{}{"filter": filter}},
+			[]interface{}{map[string]string{"collected": "desc"}},
+			opts.Limit,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var traces []*appdash.Trace
+	for _, id := range ids {
+		t, err := s.Trace(id)
+		if err == appdash.ErrTraceNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		traces = append(traces, t)
+		if opts.Limit > 0 && len(traces) >= opts.Limit {
+			break
+		}
+	}
+	return traces, nil
+}
+
+// Search returns the IDs of up to limit traces containing a span whose
+// annotation values match the given free-text query (all of the query's
+// terms must match), best matches first. The traces themselves can then be
+// fetched with Trace.
+func (s *Store) Search(query string, limit int) ([]appdash.ID, error) {
+	return s.traceIDs(map[string]interface{}{
+		"match": map[string]interface{}{
+			"text": map[string]string{"query": query, "operator": "and"},
+		},
+	}, nil, limit)
+}
+
+// Delete implements the appdash.DeleteStore interface.
+func (s *Store) Delete(traces ...appdash.ID) error {
+	if len(traces) == 0 {
+		return nil
+	}
+	ids := make([]string, len(traces))
+	for i, id := range traces {
+		ids[i] = id.String()
+	}
+	path := "/" + s.prefix + "-*/_delete_by_query"
+	if s.Refresh {
+		path += "?refresh=true"
+	}
+	return s.do("POST", path, map[string]interface{}{
+		"query": map[string]interface{}{"terms": map[string][]string{"trace_id": ids}},
+	}, nil)
+}
+
+// DeleteIndicesBefore deletes the store's daily indices for days before t,
+// which is how old traces are expired.
+func (s *Store) DeleteIndicesBefore(t time.Time) error {
+	var indices []struct {
+		Index string `json:"index"`
+	}
+	if err := s.do("GET", "/_cat/indices/"+s.prefix+"-*?format=json&h=index", nil, &indices); err != nil {
+		return err
+	}
+	cutoff := s.index(t)
+	var old []string
+	for _, idx := range indices {
+		if _, err := time.Parse(indexDateFormat, strings.TrimPrefix(idx.Index, s.prefix+"-")); err != nil {
+			continue // not one of ours
+		}
+		if idx.Index < cutoff {
+			old = append(old, idx.Index)
+		}
+	}
+	if len(old) == 0 {
+		return nil
+	}
+	sort.Strings(old)
+	return s.do("DELETE", "/"+strings.Join(old, ","), nil, nil)
+}
+
+// do makes a JSON request to the Elasticsearch API, decoding the response
+// into resp if non-nil.
+func (s *Store) do(method, path string, body, resp interface{}) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	return s.doRaw(method, path, "application/json", r, resp)
+}
+
+func (s *Store) doRaw(method, path, contentType string, body io.Reader, resp interface{}) error {
+	req, err := http.NewRequest(method, s.url+path, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("elasticstore: %s %s: %s: %s", method, path, res.Status, msg)
+	}
+	if resp == nil {
+		_, err := io.Copy(ioutil.Discard, res.Body)
+		return err
+	}
+	return json.NewDecoder(res.Body).Decode(resp)
+}
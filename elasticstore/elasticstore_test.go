@@ -0,0 +1,230 @@
+package elasticstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"sourcegraph.com/sourcegraph/appdash"
+	"sourcegraph.com/sourcegraph/appdash/internal/storetest"
+)
+
+// syncStore makes Collect synchronous, so that the conformance tests can read
+// spans back immediately.
+type syncStore struct {
+	*Store
+}
+
+func (s syncStore) Collect(id appdash.SpanID, as ...appdash.Annotation) error {
+	if err := s.Store.Collect(id, as...); err != nil {
+		return err
+	}
+	return s.Store.Flush()
+}
+
+// TestStore runs the conformance tests against the Elasticsearch cluster at
+// the URL given by the APPDASH_TEST_ELASTICSEARCH environment variable, using
+// indices prefixed with "appdash-test", or is skipped if it is not set.
+func TestStore(t *testing.T) {
+	u := os.Getenv("APPDASH_TEST_ELASTICSEARCH")
+	if u == "" {
+		t.Skip("APPDASH_TEST_ELASTICSEARCH not set")
+	}
+
+	storetest.Test(t, func(t *testing.T) appdash.Store {
+		s, err := New(u, &Options{IndexPrefix: "appdash-test"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Refresh = true
+		if err := s.DeleteIndicesBefore(time.Now().Add(48 * time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		return syncStore{s}
+	})
+}
+
+func TestDocument_roundTrip(t *testing.T) {
+	id := appdash.SpanID{Trace: 1, Span: 2, Parent: 3}
+	as := appdash.Annotations{
+		{Key: "Name", Value: []byte("GET /users")},
+		{Key: "Empty"},
+		{Key: "Binary", Value: []byte{0xff, 0xfe, 0x00}},
+	}
+	d := newDocument(id, as, time.Now())
+	if want := []string{"Name", "Empty", "Binary"}; !reflect.DeepEqual(d.Keys, want) {
+		t.Errorf("got keys %q, want %q", d.Keys, want)
+	}
+	if want := []string{"GET /users"}; !reflect.DeepEqual(d.Text, want) {
+		t.Errorf("got text %q, want %q", d.Text, want)
+	}
+
+	b, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d2 document
+	if err := json.Unmarshal(b, &d2); err != nil {
+		t.Fatal(err)
+	}
+	span, err := d2.span()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := appdash.Span{ID: id, Annotations: as}
+	if !reflect.DeepEqual(span, want) {
+		t.Errorf("got span %+v, want %+v", span, want)
+	}
+}
+
+// fakeES is a minimal fake of the Elasticsearch API, which records the
+// requests made to it and answers them with canned responses.
+type fakeES struct {
+	mu       sync.Mutex
+	requests []string // "METHOD PATH"
+	bodies   []string
+	response map[string]string // "METHOD PATH" -> response body
+}
+
+func (f *fakeES) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	key := r.Method + " " + r.URL.Path
+	f.mu.Lock()
+	f.requests = append(f.requests, key)
+	f.bodies = append(f.bodies, string(body))
+	resp, ok := f.response[key]
+	f.mu.Unlock()
+	if !ok {
+		resp = "{}"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, resp)
+}
+
+func newFakeStore(t *testing.T, responses map[string]string) (*Store, *fakeES, func()) {
+	f := &fakeES{response: responses}
+	srv := httptest.NewServer(f)
+	s, err := New(srv.URL, &Options{IndexPrefix: "x", FlushInterval: time.Hour})
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	return s, f, func() {
+		s.Close()
+		srv.Close()
+	}
+}
+
+func TestStore_Flush(t *testing.T) {
+	s, f, done := newFakeStore(t, map[string]string{
+		"POST /_bulk": `{"errors": false, "items": []}`,
+	})
+	defer done()
+
+	s.BatchSize = 2
+	for i := 0; i < 3; i++ {
+		if err := s.Collect(appdash.SpanID{Trace: 1, Span: appdash.ID(i + 1)}, appdash.Annotation{Key: "k", Value: []byte("v")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if want := []string{"PUT /_index_template/x", "POST /_bulk", "POST /_bulk"}; !reflect.DeepEqual(f.requests, want) {
+		t.Fatalf("got requests %q, want %q", f.requests, want)
+	}
+	for i, wantDocs := range []int{2, 1} {
+		lines := strings.Split(strings.TrimSuffix(f.bodies[i+1], "\n"), "\n")
+		if len(lines) != 2*wantDocs {
+			t.Errorf("bulk request %d: got %d lines, want %d", i, len(lines), 2*wantDocs)
+			continue
+		}
+		index := "x-" + time.Now().UTC().Format(indexDateFormat)
+		if want := `{"index":{"_index":"` + index + `"}}`; lines[0] != want {
+			t.Errorf("bulk request %d: got action %s, want %s", i, lines[0], want)
+		}
+	}
+}
+
+func TestStore_Flush_error(t *testing.T) {
+	s, _, done := newFakeStore(t, map[string]string{
+		"POST /_bulk": `{"errors": true, "items": [{"index": {"error": {"type": "mapper_parsing_exception"}}}]}`,
+	})
+	defer done()
+
+	if err := s.Collect(appdash.SpanID{Trace: 1, Span: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Flush(); err == nil || !strings.Contains(err.Error(), "mapper_parsing_exception") {
+		t.Errorf("got error %v, want mapper_parsing_exception", err)
+	}
+}
+
+func TestStore_Search(t *testing.T) {
+	s, f, done := newFakeStore(t, map[string]string{
+		"POST /x-*/_search": `{"hits": {"hits": [
+			{"_source": {"trace_id": "0000000000000002"}},
+			{"_source": {"trace_id": "0000000000000001"}}
+		]}}`,
+	})
+	defer done()
+
+	ids, err := s.Search("timeout", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []appdash.ID{2, 1}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("got %v, want %v", ids, want)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var req struct {
+		Size     int
+		Collapse struct{ Field string }
+		Query    struct {
+			Match struct {
+				Text struct{ Query, Operator string }
+			}
+		}
+	}
+	if err := json.Unmarshal([]byte(f.bodies[len(f.bodies)-1]), &req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Size != 5 || req.Collapse.Field != "trace_id" || req.Query.Match.Text.Query != "timeout" {
+		t.Errorf("got search request %+v", req)
+	}
+}
+
+func TestStore_DeleteIndicesBefore(t *testing.T) {
+	s, f, done := newFakeStore(t, map[string]string{
+		"GET /_cat/indices/x-*": `[
+			{"index": "x-2016.06.03"},
+			{"index": "x-2016.06.01"},
+			{"index": "x-2016.06.02"},
+			{"index": "x-other"}
+		]`,
+	})
+	defer done()
+
+	if err := s.DeleteIndicesBefore(time.Date(2016, 6, 3, 12, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if got, want := f.requests[len(f.requests)-1], "DELETE /x-2016.06.01,x-2016.06.02"; got != want {
+		t.Errorf("got request %q, want %q", got, want)
+	}
+}
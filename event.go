@@ -2,7 +2,11 @@ package appdash
 
 import (
 	"fmt"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -21,7 +25,10 @@ type ImportantEvent interface {
 }
 
 // EventMarshaler is the interface implemented by an event that can
-// marshal a representation of itself into annotations.
+// marshal a representation of itself into annotations, instead of being
+// marshaled by reflection (like json.Marshaler). MarshalEvent adds the
+// schema annotation to them (unless they have it), so the event is
+// registered and detected like the others.
 type EventMarshaler interface {
 	// MarshalEvent should marshal this event itself into a set of annotations, or
 	// return an error.
@@ -29,7 +36,12 @@ type EventMarshaler interface {
 }
 
 // EventUnmarshaler is the interface implemented by an event that can
-// unmarshal an annotation representation of itself.
+// unmarshal an annotation representation of itself, instead of being
+// unmarshaled by reflection. UnmarshalEvent (and UnmarshalEvents) only
+// call it with the annotations of a span that has the event's schema, and
+// with their keys unescaped (see UnescapeKey), as the event's
+// MarshalEvent returned them. The annotations may include those of the
+// span's other events, which it should ignore.
 type EventUnmarshaler interface {
 	// UnmarshalEvent should unmarshal the given annotations into a event of the
 	// same type, or return an error.
@@ -39,6 +51,12 @@ type EventUnmarshaler interface {
 const SchemaPrefix = "_schema:"
 
 // MarshalEvent marshals an event into annotations.
+//
+// The entries of the map fields of the event (such as map[string]string or
+// map[string][]byte) are recorded as annotations "<field>.<key>", with
+// their keys escaped so that dots and other awkward characters round-trip
+// (see EscapeMapKey), and an empty map is recorded as a single annotation
+// "<field>" with an empty value, so that it isn't unmarshaled as a nil map.
 func MarshalEvent(e Event) (Annotations, error) {
 	// Handle event marshalers.
 	if v, ok := e.(EventMarshaler); ok {
@@ -46,14 +64,18 @@ func MarshalEvent(e Event) (Annotations, error) {
 		if err != nil {
 			return nil, err
 		}
-		as = append(as, Annotation{Key: SchemaPrefix + e.Schema()})
+		if schemaKey := SchemaPrefix + e.Schema(); !as.Has(schemaKey) {
+			as = append(as, Annotation{Key: schemaKey})
+		}
 		return as, nil
 	}
 
 	var as Annotations
-	flattenValue("", reflect.ValueOf(e), func(k, v string) {
+	if err := flattenValue("", reflect.ValueOf(e), func(k, v string) {
 		as = append(as, Annotation{Key: k, Value: []byte(v)})
-	})
+	}); err != nil {
+		return nil, err
+	}
 	as = append(as, Annotation{Key: SchemaPrefix + e.Schema()})
 	return as, nil
 }
@@ -72,30 +94,45 @@ func (e *EventSchemaUnmarshalError) Error() string {
 
 // UnmarshalEvent unmarshals annotations into an event.
 func UnmarshalEvent(as Annotations, e Event) error {
+	_, err := unmarshalEvent(as, e)
+	return err
+}
+
+// unmarshalEvent is like UnmarshalEvent, but also returns the error (which
+// UnmarshalEvent ignores) of unmarshaling any of the event's fields.
+func unmarshalEvent(as Annotations, e Event) (fieldErr, err error) {
 	aSchemas := as.schemas()
 	schemaOK := false
 	for _, s := range aSchemas {
-		if s == e.Schema() {
+		// Also accept the plain name of a namespaced schema, which the
+		// event may have been recorded with before it was namespaced.
+		if s == e.Schema() || (!strings.Contains(s, "/") && s == schemaName(e.Schema())) {
 			schemaOK = true
 			break
 		}
 	}
 	if !schemaOK {
-		return &EventSchemaUnmarshalError{Found: aSchemas, Target: e.Schema()}
+		return nil, &EventSchemaUnmarshalError{Found: aSchemas, Target: e.Schema()}
 	}
 
 	// Handle event unmarshalers.
 	if v, ok := e.(EventUnmarshaler); ok {
-		ev, err := v.UnmarshalEvent(as)
+		ev, err := v.UnmarshalEvent(unescapeKeys(as))
 		if err != nil {
-			return err
+			return nil, err
+		}
+		target, evv := reflect.Indirect(reflect.ValueOf(e)), reflect.ValueOf(ev)
+		if evv.Kind() == reflect.Ptr && evv.Type().Elem() == target.Type() {
+			evv = evv.Elem()
 		}
-		reflect.Indirect(reflect.ValueOf(e)).Set(reflect.ValueOf(ev))
-		return nil
+		if !evv.IsValid() || evv.Type() != target.Type() {
+			return nil, fmt.Errorf("appdash: %T.UnmarshalEvent returned a %T", e, ev)
+		}
+		target.Set(evv)
+		return nil, nil
 	}
 
-	unflattenValue("", reflect.ValueOf(&e), reflect.TypeOf(&e), mapToKVs(as.StringMap()))
-	return nil
+	return unflattenValue("", reflect.ValueOf(e), mapToKVs(escapedMap(as))), nil
 }
 
 // RegisterEvent registers an event type for use with UnmarshalEvents.
@@ -109,43 +146,31 @@ func UnmarshalEvent(as Annotations, e Event) error {
 //      _ "sourcegraph.com/sourcegraph/appdash/sqltrace"
 //  )
 //
+// RegisterEvent panics if the event's schema is empty or already
+// registered (see EventRegistry.Register).
 func RegisterEvent(e Event) {
-	if _, present := registeredEvents[e.Schema()]; present {
-		panic("event schema is already registered: " + e.Schema())
-	}
-	if e.Schema() == "" {
-		panic("event schema is empty")
+	if err := DefaultEventRegistry.register(e, callerLine(1)); err != nil {
+		panic(err)
 	}
-	registeredEvents[e.Schema()] = e
 }
 
-var registeredEvents = map[string]Event{} // event schema -> event type
-
 func init() {
 	RegisterEvent(SpanNameEvent{})
 	RegisterEvent(logEvent{})
+	RegisterEvent(LogLevelEvent{})
+	RegisterEvent(LogFieldsEvent{})
 	RegisterEvent(msgEvent{})
 	RegisterEvent(timespanEvent{})
 	RegisterEvent(Timespan{})
+	RegisterEvent(ErrorEvent{})
+	RegisterEvent(PanicEvent{})
 }
 
 // UnmarshalEvents unmarshals all events found in anns into
 // events. Any schemas found in anns that were not registered (using
 // RegisterEvent) are ignored; missing a schema is not an error.
 func UnmarshalEvents(anns Annotations, events *[]Event) error {
-	schemas := anns.schemas()
-	for _, schema := range schemas {
-		ev := registeredEvents[schema]
-		if ev == nil {
-			continue
-		}
-		evv := reflect.New(reflect.TypeOf(ev))
-		if err := UnmarshalEvent(anns, evv.Interface().(Event)); err != nil {
-			return err
-		}
-		*events = append(*events, evv.Elem().Interface().(Event))
-	}
-	return nil
+	return DefaultEventRegistry.UnmarshalEvents(anns, events)
 }
 
 // A SpanNameEvent event sets a span's name.
@@ -185,16 +210,64 @@ func (timespanEvent) Schema() string      { return "timespan" }
 func (ev timespanEvent) Start() time.Time { return ev.S }
 func (ev timespanEvent) End() time.Time   { return ev.E }
 
+// A DurationEvent is a TimespanEvent that records its duration explicitly,
+// measured with the monotonic clock, so that it stays correct even if the
+// wall clock (which Start and End are read from) jumps during the span.
+type DurationEvent interface {
+	TimespanEvent
+
+	// Duration returns the recorded duration, or 0 if there is none (as
+	// for events recorded before durations were).
+	Duration() time.Duration
+}
+
+// EventDuration returns the duration of the timespan event: its recorded
+// duration if it is a DurationEvent with one, and otherwise the time
+// between its start and end (or 0, if its end is before its start).
+func EventDuration(e TimespanEvent) time.Duration {
+	if e, ok := e.(DurationEvent); ok {
+		if d := e.Duration(); d > 0 {
+			return d
+		}
+	}
+	if d := e.End().Sub(e.Start()); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// eventEnd returns the end of the timespan event, preferring its start
+// plus its recorded duration (see EventDuration) to its wall-clock end.
+func eventEnd(e TimespanEvent) time.Time {
+	if e, ok := e.(DurationEvent); ok && e.Duration() > 0 {
+		return e.Start().Add(e.Duration())
+	}
+	return e.End()
+}
+
 // Timespan is an event that satisfies the appdash.TimespanEvent interface.
 // This is used to show its beginning and end times of a span.
+//
+// D is the duration of the span. Recorder.Event sets it (if it is zero) to
+// E.Sub(S), which uses the monotonic clock readings of S and E when both
+// come from time.Now, so that the recorded duration is unaffected by
+// wall-clock adjustments made during the span.
 type Timespan struct {
-	S time.Time `trace:"Span.Start"`
-	E time.Time `trace:"Span.End"`
+	S time.Time     `trace:"Span.Start"`
+	E time.Time     `trace:"Span.End"`
+	D time.Duration `trace:"Span.Duration"`
 }
 
-func (s Timespan) Schema() string   { return "Timespan" }
-func (s Timespan) Start() time.Time { return s.S }
-func (s Timespan) End() time.Time   { return s.E }
+func (s Timespan) Schema() string          { return "Timespan" }
+func (s Timespan) Start() time.Time        { return s.S }
+func (s Timespan) End() time.Time          { return s.E }
+func (s Timespan) Duration() time.Duration { return s.D }
+
+// AtTime implements the RetimableEvent interface.
+func (s Timespan) AtTime(t time.Time) Event {
+	d := EventDuration(s)
+	return Timespan{S: t, E: t.Add(d), D: d}
+}
 
 // A TimestampedEvent is an Event with a timestamp.
 type TimestampedEvent interface {
@@ -221,3 +294,142 @@ type logEvent struct {
 func (logEvent) Schema() string { return "log" }
 
 func (e *logEvent) Timestamp() time.Time { return e.Time }
+
+// AtTime implements the RetimableEvent interface.
+func (e logEvent) AtTime(t time.Time) Event { e.Time = t; return e }
+
+// A RawEvent holds the annotations of an event whose schema isn't
+// registered (or that failed to unmarshal), as returned by
+// UnmarshalEventsTolerant, so that they can at least be displayed.
+type RawEvent struct {
+	// SchemaName is the event's schema.
+	SchemaName string
+
+	// Fields holds the annotations (by key) that none of the span's other
+	// events unmarshaled, excluding the schema and type annotations.
+	Fields map[string]string
+}
+
+// Schema implements the Event interface.
+func (e RawEvent) Schema() string { return e.SchemaName }
+
+// MarshalEvent implements the EventMarshaler interface, by marshaling the
+// event back into its original annotations.
+func (e RawEvent) MarshalEvent() (Annotations, error) {
+	keys := make([]string, 0, len(e.Fields))
+	for k := range e.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	as := make(Annotations, len(keys))
+	for i, k := range keys {
+		as[i] = Annotation{Key: k, Value: []byte(e.Fields[k])}
+	}
+	return as, nil
+}
+
+// An ErrorEvent records an error that occurred during a span (see
+// Recorder.Error). Its annotations have the standard keys "Error.Msg",
+// "Error.Type" and "Error.Stack", so that failed spans can be detected
+// uniformly (see IsError).
+type ErrorEvent struct {
+	Msg   string `trace:"Error.Msg"`   // the error message
+	Type  string `trace:"Error.Type"`  // the Go type of the error, e.g. "*os.PathError"
+	Stack string `trace:"Error.Stack"` // the abbreviated stack, if captured
+}
+
+func (ErrorEvent) Schema() string      { return "error" }
+func (ErrorEvent) Important() []string { return []string{"Error.Msg", "Error.Type"} }
+
+// Error returns an ErrorEvent for err, with the stack of its caller if
+// stackDepth (the maximum number of frames) is positive.
+func Error(err error, stackDepth int) ErrorEvent {
+	return newErrorEvent(err, 1, stackDepth)
+}
+
+// newErrorEvent returns an ErrorEvent for err, with the stack starting at
+// the frame skip levels above the function that calls it.
+func newErrorEvent(err error, skip, stackDepth int) ErrorEvent {
+	e := ErrorEvent{Msg: err.Error(), Type: fmt.Sprintf("%T", err)}
+	if stackDepth > 0 {
+		e.Stack = callerStack(skip+1, stackDepth)
+	}
+	return e
+}
+
+// callerStack returns the abbreviated stack (one "function (file:line)"
+// line per frame) of the frame skip levels above the function that calls
+// it, with at most depth frames.
+func callerStack(skip, depth int) string {
+	pcs := make([]uintptr, depth)
+	pcs = pcs[:runtime.Callers(skip+2, pcs)]
+	return formatStack(pcs)
+}
+
+// formatStack returns the abbreviated stack of the program counters, one
+// "function (file:line)" line per frame.
+func formatStack(pcs []uintptr) string {
+	if len(pcs) == 0 {
+		return ""
+	}
+	frames := runtime.CallersFrames(pcs)
+	var lines []string
+	for {
+		f, more := frames.Next()
+		lines = append(lines, formatFrame(f))
+		if !more {
+			break
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatFrame returns the "function (file:line)" line of a stack frame.
+func formatFrame(f runtime.Frame) string {
+	return fmt.Sprintf("%s (%s:%d)", f.Function, filepath.Base(f.File), f.Line)
+}
+
+// IsError reports whether anns hold an ErrorEvent or a PanicEvent, i.e.
+// whether their span failed.
+func IsError(anns Annotations) bool {
+	return anns.Has(SchemaPrefix+ErrorEvent{}.Schema()) ||
+		anns.Has(SchemaPrefix+PanicEvent{}.Schema())
+}
+
+// A PanicEvent records a panic that occurred during a span (see
+// RecordPanic).
+type PanicEvent struct {
+	Value string    `trace:"Panic.Value"` // the recovered value, formatted with %v
+	Stack string    `trace:"Panic.Stack"` // the abbreviated stack of the panicking goroutine
+	Time  time.Time `trace:"Panic.Time"`  // when the panic was recovered
+}
+
+func (PanicEvent) Schema() string         { return "panic" }
+func (PanicEvent) Important() []string    { return []string{"Panic.Value"} }
+func (e PanicEvent) Timestamp() time.Time { return e.Time }
+
+// AtTime implements the RetimableEvent interface.
+func (e PanicEvent) AtTime(t time.Time) Event { e.Time = t; return e }
+
+// panicStack returns the abbreviated stack (with at most depth frames) of
+// a panicking goroutine, starting at the frame that panicked. It must be
+// called by the deferred function that recovered the panic.
+func panicStack(depth int) string {
+	// Skip runtime.Callers, panicStack and the deferred function, and then
+	// the frames of the runtime that handle the panic (runtime.gopanic,
+	// and runtime.sigpanic and the like for run-time errors).
+	pcs := make([]uintptr, depth+16)
+	pcs = pcs[:runtime.Callers(3, pcs)]
+	frames := runtime.CallersFrames(pcs)
+	var lines []string
+	for len(lines) < depth {
+		f, more := frames.Next()
+		if len(lines) > 0 || !strings.HasPrefix(f.Function, "runtime.") {
+			lines = append(lines, formatFrame(f))
+		}
+		if !more {
+			break
+		}
+	}
+	return strings.Join(lines, "\n")
+}
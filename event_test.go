@@ -2,6 +2,7 @@ package appdash
 
 import (
 	"encoding/json"
+	"fmt"
 	"reflect"
 	"sort"
 	"testing"
@@ -83,14 +84,13 @@ func TestUnmarshalEvent(t *testing.T) {
 }
 
 func TestUnmarshalEvents(t *testing.T) {
-	origRegisteredEvents := registeredEvents
-	defer func() {
-		registeredEvents = origRegisteredEvents
-	}()
-	registeredEvents = make(map[string]Event)
-
-	RegisterEvent(dummyEvent{})
-	RegisterEvent(dummyEvent2{})
+	r := NewEventRegistry(nil)
+	if err := r.Register(dummyEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(dummyEvent2{}); err != nil {
+		t.Fatal(err)
+	}
 
 	anns := Annotations{
 		{Key: "A", Value: []byte("a")},
@@ -99,7 +99,7 @@ func TestUnmarshalEvents(t *testing.T) {
 		{Key: "_schema:dummy2"},
 	}
 	var events []Event
-	if err := UnmarshalEvents(anns, &events); err != nil {
+	if err := r.UnmarshalEvents(anns, &events); err != nil {
 		t.Fatal(err)
 	}
 
@@ -112,6 +112,104 @@ func TestUnmarshalEvents(t *testing.T) {
 	}
 }
 
+// pointEvent is an event with a compact custom encoding, as a single
+// "Point" annotation.
+type pointEvent struct{ X, Y int }
+
+func (pointEvent) Schema() string { return "point" }
+
+func (e pointEvent) MarshalEvent() (Annotations, error) {
+	return Annotations{{Key: "Point", Value: []byte(fmt.Sprintf("%d,%d", e.X, e.Y))}}, nil
+}
+
+func (pointEvent) UnmarshalEvent(as Annotations) (Event, error) {
+	var e pointEvent
+	if _, err := fmt.Sscanf(string(as.Get("Point")), "%d,%d", &e.X, &e.Y); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func ExampleEventMarshaler() {
+	as, err := MarshalEvent(pointEvent{X: 3, Y: 4})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Print(as)
+
+	var e pointEvent
+	if err := UnmarshalEvent(as, &e); err != nil {
+		panic(err)
+	}
+	fmt.Printf("%+v\n", e)
+	// Output:
+	// Point="3,4"
+	// _schema:point=""
+	// {X:3 Y:4}
+}
+
+func TestUnmarshalEvents_customAndReflected(t *testing.T) {
+	r := NewEventRegistry(nil)
+	for _, e := range []Event{pointEvent{}, dummyEvent2{}, LogLevelEvent{}} {
+		if err := r.Register(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The events of a span, as recorded by a Recorder.
+	var anns Annotations
+	rec := NewRecorder(SpanID{Trace: 1, Span: 2}, collectorFunc(func(_ SpanID, as ...Annotation) error {
+		anns = append(anns, as...)
+		return nil
+	}))
+	rec.Event(dummyEvent2{A: "a", X: "x"})
+	rec.Event(pointEvent{X: 1, Y: -2})
+	rec.Warnf("careful")
+	rec.Finish()
+
+	var events []Event
+	if err := r.UnmarshalEvents(anns, &events); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("got %d events %v, want 3", len(events), events)
+	}
+	if want := (dummyEvent2{A: "a", X: "x"}); events[0] != want {
+		t.Errorf("got reflected event %+v, want %+v", events[0], want)
+	}
+	if want := (pointEvent{X: 1, Y: -2}); events[1] != want {
+		t.Errorf("got custom event %+v, want %+v", events[1], want)
+	}
+	if e, ok := events[2].(LogLevelEvent); !ok || e.Msg != "careful" {
+		t.Errorf("got repeated event %+v, want the warning", events[2])
+	}
+
+	// A custom encoding that includes the schema annotation isn't given
+	// another.
+	as, err := MarshalEvent(RawEvent{SchemaName: "raw", Fields: map[string]string{SchemaPrefix + "raw": ""}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(as) != 1 {
+		t.Errorf("got annotations %v, want only the schema annotation", as)
+	}
+}
+
+// badUnmarshalEvent is an event whose UnmarshalEvent returns an event of
+// another type.
+type badUnmarshalEvent struct{}
+
+func (badUnmarshalEvent) Schema() string { return "bad" }
+
+func (badUnmarshalEvent) UnmarshalEvent(Annotations) (Event, error) { return pointEvent{}, nil }
+
+func TestUnmarshalEvent_customWrongType(t *testing.T) {
+	var e badUnmarshalEvent
+	if err := UnmarshalEvent(Annotations{{Key: SchemaPrefix + "bad"}}, &e); err == nil {
+		t.Error("got no error for an UnmarshalEvent that returns another type")
+	}
+}
+
 func TestSpanName(t *testing.T) {
 	e := SpanNameEvent{"foo"}
 
@@ -227,3 +325,122 @@ func BenchmarkUnmarshalEvents(b *testing.B) {
 		}
 	}
 }
+
+func TestTimespan_duration(t *testing.T) {
+	var as Annotations
+	r := NewRecorder(SpanID{Trace: 1, Span: 2, Parent: 0}, collectorFunc(func(_ SpanID, anns ...Annotation) error {
+		as = append(as, anns...)
+		return nil
+	}))
+	start := time.Now()
+	r.Event(Timespan{S: start, E: start.Add(1500 * time.Millisecond)})
+	r.Finish()
+
+	// The duration is recorded as its own annotation.
+	if got, want := string(as.Get("Span.Duration")), "1500"; got != want {
+		t.Errorf("got Span.Duration %q, want %q", got, want)
+	}
+
+	tests := map[string]struct {
+		anns    Annotations
+		wantEnd time.Time
+		wantDur time.Duration
+	}{
+		"recorded duration": {
+			// The wall clock was set back an hour during the span.
+			anns:    mustMarshalEvent(t, Timespan{S: start, E: start.Add(-time.Hour), D: time.Second}),
+			wantEnd: start.Add(time.Second),
+			wantDur: time.Second,
+		},
+		"no recorded duration": {
+			// Recorded by a client that predates recorded durations.
+			anns:    mustMarshalEvent(t, timespanEvent{S: start, E: start.Add(2 * time.Second)}),
+			wantEnd: start.Add(2 * time.Second),
+			wantDur: 2 * time.Second,
+		},
+		"negative": {
+			anns:    mustMarshalEvent(t, timespanEvent{S: start, E: start.Add(-time.Hour)}),
+			wantEnd: start.Add(-time.Hour),
+			wantDur: 0,
+		},
+	}
+	for label, test := range tests {
+		var events []Event
+		if err := UnmarshalEvents(test.anns, &events); err != nil || len(events) != 1 {
+			t.Fatalf("%s: got events %v and error %v", label, events, err)
+		}
+		if got := EventDuration(events[0].(TimespanEvent)); got != test.wantDur {
+			t.Errorf("%s: got duration %v, want %v", label, got, test.wantDur)
+		}
+		ev, err := (&Trace{Span: Span{Annotations: test.anns}}).TimespanEvent()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ev.End(); !got.Equal(test.wantEnd) {
+			t.Errorf("%s: got trace end %v, want %v", label, got, test.wantEnd)
+		}
+	}
+}
+
+// mapEvent is an event with map fields, for TestMarshalEvent_mapFields.
+type mapEvent struct {
+	Strings map[string]string
+	Bytes   map[string][]byte
+	Empty   map[string]string
+	Absent  map[string]string
+}
+
+func (mapEvent) Schema() string { return "map" }
+
+func TestMarshalEvent_mapFields(t *testing.T) {
+	e := mapEvent{
+		Strings: map[string]string{
+			"a.b":    "dots",
+			"":       "empty key",
+			"héllo":  "unicode",
+			"x=y:z":  "illegal",
+			"100%2E": "escape-like",
+			"plain":  "plain",
+		},
+		Bytes: map[string][]byte{"k.1": {0, 1, 0xff}, "k": []byte("v")},
+		Empty: map[string]string{},
+	}
+	as := mustMarshalEvent(t, e)
+	for _, a := range as {
+		if !recordedKey(a.Key) {
+			t.Errorf("got invalid key %q", a.Key)
+		}
+	}
+	if got := string(as.Get("Strings.a%2Eb")); got != "dots" {
+		t.Errorf("got %q for the escaped key with a dot, want %q", got, "dots")
+	}
+
+	// Directly, and through a Recorder.
+	var collected Annotations
+	r := NewRecorder(SpanID{Trace: 1, Span: 2}, collectorFunc(func(_ SpanID, anns ...Annotation) error {
+		collected = append(collected, anns...)
+		return nil
+	}))
+	r.Event(e)
+	r.Finish()
+	for _, as := range []Annotations{as, collected} {
+		var got mapEvent
+		if err := UnmarshalEvent(as, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, e) {
+			t.Errorf("got %#v, want %#v", got, e)
+		}
+		if got.Empty == nil || got.Absent != nil {
+			t.Errorf("got Empty %#v and Absent %#v, want an empty and a nil map", got.Empty, got.Absent)
+		}
+	}
+}
+
+func mustMarshalEvent(t *testing.T, e Event) Annotations {
+	as, err := MarshalEvent(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return as
+}
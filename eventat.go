@@ -0,0 +1,58 @@
+package appdash
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// A RetimableEvent is an event that can be moved to another time, so that
+// it can be recorded as if it happened then (see Recorder.EventAt).
+type RetimableEvent interface {
+	Event
+
+	// AtTime returns a copy of the event that happened at t: whose
+	// timestamp is t, or, for a TimespanEvent, whose timespan starts at t
+	// and lasts as long.
+	AtTime(t time.Time) Event
+}
+
+var (
+	errZeroEventTime = errors.New("zero event time")
+	errNotRetimable  = errors.New("event can't be recorded at a given time (it isn't a RetimableEvent)")
+)
+
+// EventAt records the event as if it had happened at t, for example when
+// importing the spans of a batch job, or of another tracing system: a
+// RetimableEvent is moved to t (see RetimableEvent.AtTime), and the events
+// without a time (like Msg and SpanName) are recorded as is. The
+// annotations are the same as those the event would have been recorded
+// with by Event, had it happened at t (with its times in the local time
+// zone, like those of time.Now).
+//
+// If t is the zero time, or if e is a TimespanEvent or TimestampedEvent
+// that isn't a RetimableEvent, the event is dropped, and an error is
+// reported.
+func (r *Recorder) EventAt(e Event, t time.Time) {
+	if !r.recording() {
+		return
+	}
+	if t.IsZero() {
+		r.error("EventAt", fmt.Errorf("%w (%s event dropped)", errZeroEventTime, e.Schema()))
+		return
+	}
+	switch ev := e.(type) {
+	case RetimableEvent:
+		e = ev.AtTime(t.Round(0).Local())
+	case TimespanEvent, TimestampedEvent:
+		r.error("EventAt", fmt.Errorf("%w (%s event dropped)", errNotRetimable, e.Schema()))
+		return
+	}
+	r.Event(e)
+}
+
+// LogAt records a Log event with the message, as if it had been recorded
+// at t (see EventAt).
+func (r *Recorder) LogAt(msg string, t time.Time) {
+	r.EventAt(logEvent{Msg: msg}, t)
+}
@@ -0,0 +1,148 @@
+package appdash
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// recordAnnotations returns the annotations that a Recorder collects when
+// record is called with it.
+func recordAnnotations(t *testing.T, record func(*Recorder)) Annotations {
+	var anns Annotations
+	r := NewRecorder(SpanID{Trace: 1, Span: 2}, collectorFunc(func(_ SpanID, as ...Annotation) error {
+		anns = append(anns, as...)
+		return nil
+	}))
+	record(r)
+	r.Finish()
+	if errs := r.Errors(); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	return anns
+}
+
+func TestRecorder_EventAt_sameAsRealTime(t *testing.T) {
+	now := time.Now()
+	end := now.Add(1500 * time.Millisecond)
+	realTime := recordAnnotations(t, func(r *Recorder) {
+		r.Event(Timespan{S: now, E: end})
+		r.Event(logEvent{Msg: "log", Time: now})
+		r.Event(LogLevelEvent{Level: LevelWarn, Msg: "warn", Time: now})
+	})
+
+	// The same events, at the same instant given in another time zone and
+	// without its monotonic clock reading.
+	at := now.Round(0).UTC()
+	imported := recordAnnotations(t, func(r *Recorder) {
+		r.EventAt(Timespan{S: time.Unix(0, 0), E: time.Unix(1, 5e8)}, at)
+		r.LogAt("log", at)
+		r.EventAt(LogLevelEvent{Level: LevelWarn, Msg: "warn"}, at)
+	})
+	// Marshaling doesn't guarantee the order of the annotations.
+	if got, want := sortedAnnotations(imported), sortedAnnotations(realTime); !reflect.DeepEqual(got, want) {
+		t.Errorf("got annotations\n%v\nwant\n%v", got, want)
+	}
+}
+
+// sortedAnnotations returns a copy of as, sorted by key and then value.
+func sortedAnnotations(as Annotations) Annotations {
+	as = append(Annotations(nil), as...)
+	sort.Slice(as, func(i, j int) bool {
+		if as[i].Key != as[j].Key {
+			return as[i].Key < as[j].Key
+		}
+		return string(as[i].Value) < string(as[j].Value)
+	})
+	return as
+}
+
+// timeOnlyEvent is a TimestampedEvent that isn't a RetimableEvent.
+type timeOnlyEvent struct{ T time.Time }
+
+func (timeOnlyEvent) Schema() string         { return "timeonly" }
+func (e timeOnlyEvent) Timestamp() time.Time { return e.T }
+
+func TestRecorder_EventAt_errors(t *testing.T) {
+	r := NewRecorder(SpanID{Trace: 1, Span: 2}, collectorFunc(func(SpanID, ...Annotation) error { return nil }))
+	r.LogAt("zero", time.Time{})
+	r.EventAt(timeOnlyEvent{}, time.Now())
+	r.EventAt(Msg("untimed"), time.Now())
+
+	errs := r.Errors()
+	if len(errs) != 2 || !errors.Is(errs[0], errZeroEventTime) || !errors.Is(errs[1], errNotRetimable) {
+		t.Errorf("got errors %v, want %v and %v", errs, errZeroEventTime, errNotRetimable)
+	}
+	if len(r.annotations) == 0 {
+		t.Error("the event without a time wasn't recorded")
+	}
+}
+
+func TestRecorder_EventAt_import(t *testing.T) {
+	// A historical trace, imported out of order: a 10s job, whose 2 steps
+	// started 1s and 4s in, with logs.
+	ms := NewMemoryStore()
+	base := time.Date(2016, 5, 4, 3, 2, 1, 0, time.UTC)
+	root := NewRecorder(SpanID{Trace: 1, Span: 2}, ms)
+	step2 := root.ChildWithName("step 2")
+	step2.EventAt(Timespan{E: time.Unix(0, 0).Add(5 * time.Second), S: time.Unix(0, 0)}, base.Add(4*time.Second))
+	step2.EventAt(LogLevelEvent{Level: LevelInfo, Msg: "second"}, base.Add(6*time.Second))
+	step2.EventAt(LogLevelEvent{Level: LevelWarn, Msg: "first"}, base.Add(5*time.Second))
+	step1 := root.ChildWithName("step 1")
+	step1.EventAt(Timespan{S: time.Unix(0, 0), E: time.Unix(2, 0)}, base.Add(time.Second))
+	root.Name("job")
+	root.EventAt(Timespan{S: time.Unix(0, 0), E: time.Unix(10, 0)}, base)
+	for _, r := range []*Recorder{step2, step1, root} {
+		r.Finish()
+	}
+
+	trace, err := ms.Trace(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subs := append([]*Trace(nil), trace.Sub...)
+	starts := map[*Trace]time.Time{}
+	for _, sub := range subs {
+		e, err := sub.TimespanEvent()
+		if err != nil {
+			t.Fatal(err)
+		}
+		starts[sub] = e.Start()
+	}
+	sort.Slice(subs, func(i, j int) bool { return starts[subs[i]].Before(starts[subs[j]]) })
+
+	for i, want := range []struct {
+		tr       *Trace
+		name     string
+		start    time.Duration // since base
+		duration time.Duration
+	}{
+		{trace, "job", 0, 10 * time.Second},
+		{subs[0], "step 1", time.Second, 2 * time.Second},
+		{subs[1], "step 2", 4 * time.Second, 5 * time.Second},
+	} {
+		e, err := want.tr.TimespanEvent()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name := want.tr.Span.Name(); name != want.name {
+			t.Errorf("%d: got span %q, want %q", i, name, want.name)
+		}
+		if start := e.Start().Sub(base); start != want.start {
+			t.Errorf("%s: got start %s after the job's, want %s", want.name, start, want.start)
+		}
+		if d := EventDuration(e); d != want.duration {
+			t.Errorf("%s: got duration %s, want %s", want.name, d, want.duration)
+		}
+	}
+
+	var msgs []string
+	for _, l := range subs[1].Span.Annotations.Logs() {
+		msgs = append(msgs, l.Msg)
+	}
+	if want := []string{"first", "second"}; !reflect.DeepEqual(msgs, want) {
+		t.Errorf("got logs %v, want %v", msgs, want)
+	}
+}
@@ -105,12 +105,17 @@ func Home(w http.ResponseWriter, r *http.Request) {
 	// the span.Trace ID and link directly to the trace on the web-page itself!
 	span := context.Get(r, CtxSpanID).(appdash.SpanID)
 
-	// We're going to make some API requests, so we create a HTTP client using
-	// a appdash/httptrace transport here. The transport will inform Appdash of
-	// the HTTP events occuring.
+	// We're going to make some API requests, which we group under a child
+	// span of the request's span.
+	rec := appdash.NewRecorder(span, collector).ChildWithName("API requests")
+	start := time.Now()
+
+	// We create a HTTP client using a appdash/httptrace transport here. The
+	// transport will inform Appdash of the HTTP events occuring, in child
+	// spans of rec's span.
 	httpClient := &http.Client{
 		Transport: &httptrace.Transport{
-			Recorder: appdash.NewRecorder(span, collector),
+			Recorder: rec,
 			SetName:  true,
 		},
 	}
@@ -124,6 +129,8 @@ func Home(w http.ResponseWriter, r *http.Request) {
 		}
 		resp.Body.Close()
 	}
+	rec.Event(appdash.Timespan{S: start, E: time.Now()})
+	rec.Finish()
 
 	// Render the page.
 	fmt.Fprintf(w, `<p>Three API requests have been made!</p>`)
@@ -0,0 +1,185 @@
+package appdash
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// jsonExportVersion is the version of the format written by ExportJSON.
+const jsonExportVersion = 1
+
+// jsonExport is the JSON document written by ExportJSON.
+type jsonExport struct {
+	Version int          `json:"version"`
+	Traces  []*jsonTrace `json:"traces"`
+}
+
+type jsonTrace struct {
+	ID    ID          `json:"id"`
+	Spans []*jsonSpan `json:"spans"`
+}
+
+type jsonSpan struct {
+	ID          string           `json:"id"`
+	Annotations []jsonAnnotation `json:"annotations,omitempty"`
+}
+
+type jsonAnnotation struct {
+	Key    string  `json:"key"`
+	Value  *string `json:"value,omitempty"`
+	Base64 *string `json:"base64,omitempty"`
+}
+
+// ExportJSON writes the traces with the given IDs (or, if none are given,
+// all traces) to w in a stable JSON format that can be read back with
+// ImportJSON, e.g. to share traces in a bug report or load test fixtures.
+// Traces are written one at a time. If one of the given traces does not
+// exist, ErrTraceNotFound is returned.
+//
+// The format is:
+//
+//	{
+//	  "version": 1,
+//	  "traces": [
+//	    {
+//	      "id": "0000000000000001",
+//	      "spans": [
+//	        {
+//	          "id": "0000000000000001/0000000000000002",
+//	          "annotations": [
+//	            {"key": "Name", "value": "GET /"},
+//	            {"key": "Data", "base64": "AAEC"}
+//	          ]
+//	        }
+//	      ]
+//	    }
+//	  ]
+//	}
+//
+// Trace IDs are hex strings and span IDs are formatted as by SpanID.String.
+// The spans of a trace are listed parents first. An annotation's value is
+// given as a string in "value" if it is valid UTF-8, or base64-encoded in
+// "base64" otherwise; a nil value has neither.
+func (ms *MemoryStore) ExportJSON(w io.Writer, ids ...ID) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "{\n  \"version\": %d,\n  \"traces\": [", jsonExportVersion)
+	first := true
+	write := func(t *Trace) error {
+		data, err := json.MarshalIndent(exportTrace(t), "    ", "  ")
+		if err != nil {
+			return err
+		}
+		if !first {
+			bw.WriteString(",")
+		}
+		first = false
+		bw.WriteString("\n    ")
+		_, err = bw.Write(data)
+		return err
+	}
+
+	if len(ids) == 0 {
+		if err := ms.ForEachTrace(write); err != nil {
+			return err
+		}
+	}
+	for _, id := range ids {
+		t, ok := ms.copyTrace(id)
+		if !ok {
+			return ErrTraceNotFound
+		}
+		if err := write(t); err != nil {
+			return err
+		}
+	}
+	if !first {
+		bw.WriteString("\n  ")
+	}
+	bw.WriteString("]\n}\n")
+	return bw.Flush()
+}
+
+// exportTrace returns the JSON representation of t.
+func exportTrace(t *Trace) *jsonTrace {
+	jt := &jsonTrace{ID: t.Span.ID.Trace}
+	t.Walk(func(t *Trace) error {
+		js := &jsonSpan{ID: t.Span.ID.String()}
+		for _, a := range t.Span.Annotations {
+			ja := jsonAnnotation{Key: a.Key}
+			if a.Value != nil {
+				if utf8.Valid(a.Value) {
+					v := string(a.Value)
+					ja.Value = &v
+				} else {
+					v := base64.StdEncoding.EncodeToString(a.Value)
+					ja.Base64 = &v
+				}
+			}
+			js.Annotations = append(js.Annotations, ja)
+		}
+		jt.Spans = append(jt.Spans, js)
+		return nil
+	})
+	return jt
+}
+
+// ImportJSON reads traces written by ExportJSON from r and collects them
+// into ms, keeping their IDs. Traces and spans that already exist in ms are
+// merged with the imported ones, as if their spans had been collected
+// again. The data is validated before anything is collected, so nothing is
+// imported if it is malformed.
+func (ms *MemoryStore) ImportJSON(r io.Reader) error {
+	return importJSON(ms, r)
+}
+
+// importJSON reads traces written by ExportJSON from r, and collects them
+// into c once they are all validated (see MemoryStore.ImportJSON).
+func importJSON(c Collector, r io.Reader) error {
+	var data jsonExport
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return err
+	}
+	if data.Version != jsonExportVersion {
+		return fmt.Errorf("appdash: unsupported JSON export version %d", data.Version)
+	}
+
+	var spans []Span
+	for _, jt := range data.Traces {
+		for _, js := range jt.Spans {
+			id, err := ParseSpanID(js.ID)
+			if err != nil {
+				return fmt.Errorf("appdash: importing span %q: %s", js.ID, err)
+			}
+			if id.Trace != jt.ID {
+				return fmt.Errorf("appdash: importing span %q: not in trace %s", js.ID, jt.ID)
+			}
+			span := Span{ID: *id}
+			for _, ja := range js.Annotations {
+				a := Annotation{Key: ja.Key}
+				switch {
+				case ja.Value != nil && ja.Base64 != nil:
+					return fmt.Errorf("appdash: importing span %q: annotation %q has both a value and a base64 value", js.ID, ja.Key)
+				case ja.Value != nil:
+					a.Value = []byte(*ja.Value)
+				case ja.Base64 != nil:
+					if a.Value, err = base64.StdEncoding.DecodeString(*ja.Base64); err != nil {
+						return fmt.Errorf("appdash: importing span %q: annotation %q: %s", js.ID, ja.Key, err)
+					}
+				}
+				span.Annotations = append(span.Annotations, a)
+			}
+			spans = append(spans, span)
+		}
+	}
+
+	for _, span := range spans {
+		if err := c.Collect(span.ID, span.Annotations...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package appdash
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMemoryStore_ExportJSON_ImportJSON(t *testing.T) {
+	s := NewMemoryStore()
+	ms := storeT{t, s}
+	ms.MustCollect(SpanID{Trace: 1, Span: 1, Parent: 0}, Annotation{Key: "Name", Value: []byte("GET /")})
+	ms.MustCollect(SpanID{Trace: 1, Span: 2, Parent: 1}, Annotation{Key: "bin", Value: []byte{0, 0xff, 0xfe}})
+	ms.MustCollect(SpanID{Trace: 1, Span: 3, Parent: 2}, Annotation{Key: "nil"}, Annotation{Key: "empty", Value: []byte{}})
+	ms.MustCollect(SpanID{Trace: 1, Span: 3, Parent: 2}, Annotation{Key: "nil"})
+	ms.MustCollect(SpanID{Trace: 0xffffffffffffffff, Span: 0x8000000000000000, Parent: 0})
+
+	var buf bytes.Buffer
+	if err := s.ExportJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"id": "0000000000000001/0000000000000002/0000000000000001"`) {
+		t.Errorf("span IDs not formatted as strings:\n%s", buf.String())
+	}
+
+	s2 := NewMemoryStore()
+	if err := s2.ImportJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []ID{1, 0xffffffffffffffff} {
+		want, got := ms.MustTrace(id), storeT{t, s2}.MustTrace(id)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("trace %v: got %v, want %v", id, got, want)
+		}
+	}
+	if u := s2.Usage(); u.Traces != 2 || u.Spans != 4 {
+		t.Errorf("got %d traces and %d spans, want 2 and 4", u.Traces, u.Spans)
+	}
+}
+
+func TestMemoryStore_ExportJSON_ids(t *testing.T) {
+	s := NewMemoryStore()
+	ms := storeT{t, s}
+	ms.MustCollect(SpanID{Trace: 1, Span: 1, Parent: 0})
+	ms.MustCollect(SpanID{Trace: 2, Span: 2, Parent: 0})
+
+	var buf bytes.Buffer
+	if err := s.ExportJSON(&buf, 2); err != nil {
+		t.Fatal(err)
+	}
+	s2 := NewMemoryStore()
+	ms2 := storeT{t, s2}
+	ms2.MustCollect(SpanID{Trace: 3, Span: 3, Parent: 0})
+	if err := s2.ImportJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// Merged with the existing trace.
+	ms2.MustTrace(2)
+	ms2.MustTrace(3)
+	if _, err := s2.Trace(1); err != ErrTraceNotFound {
+		t.Errorf("got error %v for trace that wasn't exported, want ErrTraceNotFound", err)
+	}
+
+	if err := s.ExportJSON(&buf, 4); err != ErrTraceNotFound {
+		t.Errorf("got error %v exporting a missing trace, want ErrTraceNotFound", err)
+	}
+}
+
+func TestMemoryStore_ImportJSON_invalid(t *testing.T) {
+	tests := []string{
+		`{"version": 2, "traces": []}`,
+		`{"version": 1, "traces": [{"id": "0000000000000001", "spans": [{"id": "x"}]}]}`,
+		`{"version": 1, "traces": [{"id": "0000000000000001", "spans": [{"id": "0000000000000002/0000000000000001"}]}]}`,
+		`{"version": 1, "traces": [{"id": "0000000000000001", "spans": [{"id": "0000000000000001/0000000000000001", "annotations": [{"key": "k", "base64": "!"}]}]}]}`,
+	}
+	for _, test := range tests {
+		s := NewMemoryStore()
+		if err := s.ImportJSON(strings.NewReader(test)); err == nil {
+			t.Errorf("%s: got no error", test)
+		}
+		if u := s.Usage(); u.Spans != 0 {
+			t.Errorf("%s: got %d spans imported, want none", test, u.Spans)
+		}
+	}
+}
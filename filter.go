@@ -0,0 +1,252 @@
+package appdash
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// NewFilterCollector returns a collector that passes the collections for
+// which keep returns true to c, and silently drops the others. For example,
+// to never trace cache pings:
+//
+//	c := appdash.NewFilterCollector(collector, func(span appdash.SpanID, anns appdash.Annotations) bool {
+//		return anns.StringMap()["Name"] != "cache.Ping"
+//	})
+//
+// Dropping the collections of a span but not the ones of its children
+// leaves orphaned spans in the trace, which are shown as if their parent
+// were missing. See FilterCollector.DropDescendants.
+func NewFilterCollector(c Collector, keep func(SpanID, Annotations) bool) *FilterCollector {
+	return &FilterCollector{c: c, keep: keep, now: time.Now}
+}
+
+// A FilterCollector passes the collections that match a predicate to its
+// underlying collector. See NewFilterCollector.
+type FilterCollector struct {
+	c    Collector
+	keep func(SpanID, Annotations) bool
+
+	// DropDescendants is whether to also drop the collections of the
+	// descendants of the dropped spans (and the later collections of the
+	// dropped spans themselves), by remembering whether each span was
+	// dropped. Since a Recorder collects a span when it is finished, i.e.
+	// usually after its children, the collections of the spans whose
+	// parent hasn't been seen yet are held back until it is (see
+	// MaxPendingSpans and MaxPendingTime). Call Close to pass on the
+	// collections that are still held back, for example when the program
+	// exits.
+	DropDescendants bool
+
+	// CacheSize is the maximum number of span IDs remembered when
+	// DropDescendants is true. The span that was least recently seen is
+	// forgotten first.
+	//
+	// Default CacheSize = DefaultSamplerCacheSize.
+	CacheSize int
+
+	// MaxPendingSpans is the maximum number of collections held back until
+	// the parent of their span is seen, when DropDescendants is true. When
+	// it is exceeded, the collection that has been held back the longest
+	// is filtered as if its parent was kept (which is also how the spans
+	// whose parent is recorded by another process end up being filtered).
+	//
+	// Default MaxPendingSpans = DefaultMaxPendingSpans.
+	MaxPendingSpans int
+
+	// MaxPendingTime is the maximum time for which a collection is held
+	// back until the parent of its span is seen. The collections held back
+	// for longer are filtered like when MaxPendingSpans is exceeded, by
+	// Collect and by Flush.
+	//
+	// Default MaxPendingTime = DefaultMaxPendingTime.
+	MaxPendingTime time.Duration
+
+	now func() time.Time // the clock (for tests)
+
+	mu        sync.Mutex             // guards the fields below
+	decisions *idLRU                 // span ID -> whether the span is kept (only if DropDescendants)
+	pending   *list.List             // *heldSpan, held back the longest first
+	pendingBy map[ID][]*list.Element // parent span ID -> its children held back
+
+	numDropped uint64 // accessed atomically
+}
+
+// A heldSpan is a collection held back until the parent of its span is
+// seen.
+type heldSpan struct {
+	queuedSpan
+	held time.Time // when it was held back
+}
+
+// Collect implements the Collector interface by passing the collection to
+// the underlying collector if it matches the predicate (and, if
+// DropDescendants is true, if none of its ancestors were dropped).
+func (fc *FilterCollector) Collect(span SpanID, anns ...Annotation) error {
+	if !fc.DropDescendants {
+		if !fc.keep(span, anns) {
+			atomic.AddUint64(&fc.numDropped, 1)
+			return nil
+		}
+		return fc.c.Collect(span, anns...)
+	}
+
+	now := fc.now()
+	fc.mu.Lock()
+	fc.initNoLock()
+	var kept []queuedSpan
+	if keep, ok := fc.parentKeptNoLock(span); !ok {
+		e := fc.pending.PushBack(&heldSpan{queuedSpan{span, anns}, now})
+		fc.pendingBy[span.Parent] = append(fc.pendingBy[span.Parent], e)
+
+		max := fc.MaxPendingSpans
+		if max <= 0 {
+			max = DefaultMaxPendingSpans
+		}
+		for fc.pending.Len() > max {
+			kept = fc.filterNoLock(fc.removePendingNoLock(fc.pending.Front()), true, kept)
+		}
+	} else {
+		kept = fc.filterNoLock(queuedSpan{span, anns}, keep, kept)
+	}
+	kept = fc.filterPendingNoLock(now, false, kept)
+	fc.mu.Unlock()
+
+	return fc.collect(kept)
+}
+
+// initNoLock initializes the decisions and the collections held back, on
+// first use. The fc.mu lock must be held.
+func (fc *FilterCollector) initNoLock() {
+	if fc.decisions != nil {
+		return
+	}
+	size := fc.CacheSize
+	if size <= 0 {
+		size = DefaultSamplerCacheSize
+	}
+	fc.decisions = newIDLRU(size)
+	fc.pending = list.New()
+	fc.pendingBy = map[ID][]*list.Element{}
+}
+
+// parentKeptNoLock reports whether the parent of the span was kept, and
+// false if it hasn't been seen (or was forgotten). A root span's parent is
+// considered kept. The fc.mu lock must be held.
+func (fc *FilterCollector) parentKeptNoLock(span SpanID) (keep, ok bool) {
+	if span.IsRoot() {
+		return true, true
+	}
+	return fc.decisions.get(span.Parent)
+}
+
+// filterNoLock filters a collection whose parent was kept (or dropped, if
+// parentKept is false), remembers whether its span is kept, and does the
+// same for the collections of its children that were held back. It
+// returns kept with the collections to pass on appended. The fc.mu lock
+// must be held.
+func (fc *FilterCollector) filterNoLock(s queuedSpan, parentKept bool, kept []queuedSpan) []queuedSpan {
+	keep := parentKept
+	if prev, ok := fc.decisions.get(s.span.Span); ok && !prev {
+		keep = false // a later collection of a dropped span
+	}
+	if keep {
+		keep = fc.keep(s.span, s.anns)
+	}
+	fc.decisions.add(s.span.Span, keep)
+	if keep {
+		kept = append(kept, s)
+	} else {
+		atomic.AddUint64(&fc.numDropped, 1)
+	}
+
+	children := fc.pendingBy[s.span.Span]
+	delete(fc.pendingBy, s.span.Span)
+	for _, e := range children {
+		kept = fc.filterNoLock(fc.pending.Remove(e).(*heldSpan).queuedSpan, keep, kept)
+	}
+	return kept
+}
+
+// filterPendingNoLock filters the collections held back for longer than
+// MaxPendingTime, or all of them if all is true, as if their parent was
+// kept. The fc.mu lock must be held.
+func (fc *FilterCollector) filterPendingNoLock(now time.Time, all bool, kept []queuedSpan) []queuedSpan {
+	maxTime := fc.MaxPendingTime
+	if maxTime <= 0 {
+		maxTime = DefaultMaxPendingTime
+	}
+	for fc.pending.Len() > 0 {
+		e := fc.pending.Front()
+		if !all && now.Sub(e.Value.(*heldSpan).held) < maxTime {
+			break
+		}
+		kept = fc.filterNoLock(fc.removePendingNoLock(e), true, kept)
+	}
+	return kept
+}
+
+// removePendingNoLock stops holding back a collection. The fc.mu lock must
+// be held.
+func (fc *FilterCollector) removePendingNoLock(e *list.Element) queuedSpan {
+	s := fc.pending.Remove(e).(*heldSpan)
+	siblings := fc.pendingBy[s.span.Parent]
+	for i, sibling := range siblings {
+		if sibling == e {
+			siblings = append(siblings[:i], siblings[i+1:]...)
+			break
+		}
+	}
+	if len(siblings) == 0 {
+		delete(fc.pendingBy, s.span.Parent)
+	} else {
+		fc.pendingBy[s.span.Parent] = siblings
+	}
+	return s.queuedSpan
+}
+
+// collect passes the kept collections to the underlying collector, and
+// returns the first error.
+func (fc *FilterCollector) collect(kept []queuedSpan) error {
+	var firstErr error
+	for _, s := range kept {
+		if err := fc.c.Collect(s.span, s.anns...); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Flush filters the collections held back for longer than MaxPendingTime
+// as if their parent was kept, passing the kept ones to the underlying
+// collector.
+func (fc *FilterCollector) Flush() error {
+	return fc.flush(false)
+}
+
+// Close filters all of the collections that are still held back as if
+// their parent was kept, passing the kept ones to the underlying
+// collector.
+func (fc *FilterCollector) Close() error {
+	return fc.flush(true)
+}
+
+// flush filters the collections held back for too long, or all of them if
+// all is true.
+func (fc *FilterCollector) flush(all bool) error {
+	if !fc.DropDescendants {
+		return nil
+	}
+	now := fc.now()
+	fc.mu.Lock()
+	fc.initNoLock()
+	kept := fc.filterPendingNoLock(now, all, nil)
+	fc.mu.Unlock()
+	return fc.collect(kept)
+}
+
+// Dropped returns the number of collections that were dropped.
+func (fc *FilterCollector) Dropped() uint64 {
+	return atomic.LoadUint64(&fc.numDropped)
+}
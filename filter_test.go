@@ -0,0 +1,134 @@
+package appdash
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFilterCollector(t *testing.T) {
+	for _, dropDescendants := range []bool{false, true} {
+		var kept []SpanID
+		fc := NewFilterCollector(collectorFunc(func(span SpanID, anns ...Annotation) error {
+			kept = append(kept, span)
+			return nil
+		}), func(span SpanID, anns Annotations) bool {
+			return anns.StringMap()["Name"] != "ping"
+		})
+		fc.DropDescendants = dropDescendants
+
+		root := SpanID{Trace: 1, Span: 1, Parent: 0}
+		ping := SpanID{Trace: 1, Span: 2, Parent: 1}
+		pingChild := SpanID{Trace: 1, Span: 3, Parent: 2}
+		pingGrandchild := SpanID{Trace: 1, Span: 4, Parent: 3}
+		other := SpanID{Trace: 1, Span: 5, Parent: 1}
+		fc.Collect(root, Annotation{Key: "Name", Value: []byte("request")})
+		fc.Collect(ping, Annotation{Key: "Name", Value: []byte("ping")})
+		fc.Collect(pingChild, Annotation{Key: "Name", Value: []byte("send")})
+		fc.Collect(pingGrandchild)
+		fc.Collect(ping) // a later collection of the dropped span
+		fc.Collect(other)
+
+		want := []SpanID{root, pingChild, pingGrandchild, ping, other}
+		wantDropped := uint64(1)
+		if dropDescendants {
+			want = []SpanID{root, other}
+			wantDropped = 4
+		}
+		if !reflect.DeepEqual(kept, want) {
+			t.Errorf("dropDescendants %v: got kept spans %v, want %v", dropDescendants, kept, want)
+		}
+		if got := fc.Dropped(); got != wantDropped {
+			t.Errorf("dropDescendants %v: got %d dropped, want %d", dropDescendants, got, wantDropped)
+		}
+	}
+}
+
+func TestFilterCollector_DropDescendants_recorder(t *testing.T) {
+	var kept []string
+	fc := NewFilterCollector(collectorFunc(func(span SpanID, anns ...Annotation) error {
+		kept = append(kept, Annotations(anns).StringMap()["Name"])
+		return nil
+	}), func(span SpanID, anns Annotations) bool {
+		return anns.StringMap()["Name"] != "ping"
+	})
+	fc.DropDescendants = true
+
+	// The spans are finished (and so collected) before their parents.
+	root := NewRecorder(NewRootSpanID(), fc)
+	root.Name("request")
+	ping := root.ChildWithName("ping")
+	send := ping.ChildWithName("send")
+	recv := send.ChildWithName("recv")
+	other := root.ChildWithName("other")
+	recv.Finish()
+	send.Finish()
+	ping.Finish()
+	other.Finish()
+	if len(kept) != 0 {
+		t.Errorf("got kept spans %v before the root span was collected, want none", kept)
+	}
+	root.Finish()
+
+	if want := []string{"request", "other"}; !reflect.DeepEqual(kept, want) {
+		t.Errorf("got kept spans %v, want %v", kept, want)
+	}
+	if got := fc.Dropped(); got != 3 {
+		t.Errorf("got %d dropped, want 3", got)
+	}
+
+	// A later child of a kept span is passed on at once, and one of a
+	// dropped span is dropped.
+	kept = nil
+	late := other.ChildWithName("late")
+	late.Finish()
+	ping.ChildWithName("late ping").Finish()
+	if want := []string{"late"}; !reflect.DeepEqual(kept, want) {
+		t.Errorf("got kept spans %v, want %v", kept, want)
+	}
+}
+
+func TestFilterCollector_pending(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	var kept []ID
+	fc := NewFilterCollector(collectorFunc(func(span SpanID, anns ...Annotation) error {
+		kept = append(kept, span.Span)
+		return nil
+	}), func(span SpanID, anns Annotations) bool {
+		return span.Span != 3
+	})
+	fc.DropDescendants = true
+	fc.MaxPendingSpans = 3
+	fc.now = clock.now
+
+	// The parents are recorded by another process, so they are never seen.
+	fc.Collect(SpanID{Trace: 1, Span: 2, Parent: 1})
+	fc.Collect(SpanID{Trace: 1, Span: 3, Parent: 1})
+	fc.Collect(SpanID{Trace: 1, Span: 4, Parent: 3})
+	if len(kept) != 0 {
+		t.Fatalf("got kept spans %v, want none yet", kept)
+	}
+	fc.Collect(SpanID{Trace: 2, Span: 5, Parent: 1})
+	if want := []ID{2}; !reflect.DeepEqual(kept, want) {
+		t.Errorf("got kept spans %v when MaxPendingSpans is exceeded, want %v", kept, want)
+	}
+
+	clock.advance(DefaultMaxPendingTime)
+	if err := fc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []ID{2, 5}; !reflect.DeepEqual(kept, want) {
+		t.Errorf("got kept spans %v after MaxPendingTime, want %v (and 3 and its child dropped)", kept, want)
+	}
+
+	fc.Collect(SpanID{Trace: 3, Span: 7, Parent: 6})
+	if err := fc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []ID{2, 5, 7}; !reflect.DeepEqual(kept, want) {
+		t.Errorf("got kept spans %v after Close, want %v", kept, want)
+	}
+	if got := fc.Dropped(); got != 2 {
+		t.Errorf("got %d dropped, want 2", got)
+	}
+}
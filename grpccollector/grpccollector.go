@@ -0,0 +1,159 @@
+// Package grpccollector provides a collector client and server that speak
+// the collector protocol over gRPC, as an alternative to appdash's own TCP
+// protocol (see appdash.RemoteCollector and appdash.CollectorServer). gRPC
+// provides multiplexing, deadlines, TLS and load balancing.
+//
+// On the client side, the collector is typically wrapped in a
+// ChunkedCollector:
+//
+//	conn, err := grpc.Dial("collector.example.com:7702", grpc.WithTransportCredentials(creds))
+//	if err != nil {
+//		// handle error
+//	}
+//	collector := appdash.NewChunkedCollector(grpccollector.NewGRPCCollector(conn))
+//
+// On the server side:
+//
+//	s := grpc.NewServer()
+//	grpccollector.RegisterCollectorServer(s, store)
+//	go s.Serve(l)
+package grpccollector
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	"sourcegraph.com/sourcegraph/appdash"
+	"sourcegraph.com/sourcegraph/appdash/internal/grpcwire"
+	"sourcegraph.com/sourcegraph/appdash/internal/packet"
+)
+
+// NewGRPCCollector creates a collector that sends data to a collector
+// service (registered with RegisterCollectorServer) over conn. It sends
+// data immediately when Collect is called. To send data in chunks, use an
+// appdash.ChunkedCollector.
+func NewGRPCCollector(conn *grpc.ClientConn) *GRPCCollector {
+	return &GRPCCollector{client: grpcwire.NewCollectorServiceClient(conn)}
+}
+
+// A GRPCCollector sends data to a collector service over a single
+// client-streaming Collect RPC, which is opened by the first call to
+// Collect and closed by Close.
+//
+// If the stream fails (e.g. because the server restarted), Collect opens a
+// new one. Like with appdash.RemoteCollector, collections sent just before
+// a failure may be lost; call Close to make sure that all of them were
+// received.
+type GRPCCollector struct {
+	client grpcwire.CollectorServiceClient
+
+	// Log is the logger to use for errors and warnings. If nil, a new
+	// logger is created.
+	Log   *log.Logger
+	logMu sync.Mutex
+
+	// Debug is whether to log debug messages.
+	Debug bool
+
+	mu     sync.Mutex                              // guards stream and cancel
+	stream grpcwire.CollectorService_CollectClient // the open Collect stream, if any
+	cancel context.CancelFunc                      // cancels stream
+}
+
+// Collect implements the appdash.Collector interface by sending the events
+// that occured in the span to the collector service.
+func (gc *GRPCCollector) Collect(span appdash.SpanID, anns ...appdash.Annotation) error {
+	p := packet.New(span, anns)
+
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+
+	if gc.stream != nil {
+		err := gc.stream.Send(p)
+		if err == nil {
+			return nil
+		}
+		if gc.Debug {
+			gc.log().Printf("Sending %v: %s (opening a new stream)", span, err)
+		}
+		gc.cancel()
+		gc.stream = nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := gc.client.Collect(ctx)
+	if err != nil {
+		cancel()
+		return err
+	}
+	gc.stream, gc.cancel = stream, cancel
+	return gc.stream.Send(p)
+}
+
+// Close closes the stream to the collector service, waiting until the
+// service has received all of the collections sent over it. A later call
+// to Collect opens a new stream. The underlying gRPC connection is not
+// closed.
+func (gc *GRPCCollector) Close() error {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+
+	if gc.stream == nil {
+		return nil
+	}
+	resp, err := gc.stream.CloseAndRecv()
+	gc.cancel()
+	gc.stream = nil
+	if err != nil {
+		return err
+	}
+	if gc.Debug {
+		gc.log().Printf("Closed stream (%d spans collected)", resp.GetCollected())
+	}
+	return nil
+}
+
+func (gc *GRPCCollector) log() *log.Logger {
+	gc.logMu.Lock()
+	defer gc.logMu.Unlock()
+	if gc.Log == nil {
+		gc.Log = log.New(os.Stderr, "GRPCCollector: ", log.LstdFlags|log.Lmicroseconds)
+	}
+	return gc.Log
+}
+
+// RegisterCollectorServer registers the collector service with s, so that
+// the data sent by GRPCCollectors is added to the collector c (typically
+// an appdash.Store).
+func RegisterCollectorServer(s *grpc.Server, c appdash.Collector) {
+	grpcwire.RegisterCollectorServiceServer(s, &collectorServer{c: c})
+}
+
+// collectorServer implements the collector service.
+type collectorServer struct {
+	c appdash.Collector
+}
+
+// Collect implements grpcwire.CollectorServiceServer.
+func (s *collectorServer) Collect(stream grpcwire.CollectorService_CollectServer) error {
+	var n uint64
+	for {
+		p, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&grpcwire.CollectResponse{Collected: &n})
+		} else if err != nil {
+			return err
+		}
+		span := packet.SpanID(p)
+		if err := s.c.Collect(span, packet.Annotations(p)...); err != nil {
+			return fmt.Errorf("Collect %v: %s", span, err)
+		}
+		n++
+	}
+}
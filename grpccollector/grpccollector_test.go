@@ -0,0 +1,161 @@
+package grpccollector
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"sourcegraph.com/sourcegraph/appdash"
+)
+
+// startServer starts a gRPC server with the collector service that adds
+// to c, and returns a connection to it.
+func startServer(t *testing.T, c appdash.Collector) (*grpc.ClientConn, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	RegisterCollectorServer(s, c)
+	go s.Serve(l)
+
+	conn, err := grpc.Dial(l.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, func() {
+		conn.Close()
+		s.Stop()
+	}
+}
+
+func TestGRPCCollector(t *testing.T) {
+	store := appdash.NewMemoryStore()
+	conn, stop := startServer(t, store)
+	defer stop()
+
+	gc := NewGRPCCollector(conn)
+	cc := appdash.NewChunkedCollector(gc)
+	cc.Log = nil
+	want := map[appdash.SpanID]appdash.Annotations{}
+	for i := appdash.ID(1); i <= 10; i++ {
+		span := appdash.SpanID{Trace: i, Span: i + 100, Parent: 0}
+		anns := appdash.Annotations{{Key: "k", Value: []byte(strings.Repeat("v", int(i)))}, {Key: "empty"}}
+		want[span] = anns
+		if err := cc.Collect(span, anns...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for span, anns := range want {
+		trace, err := store.Trace(span.Trace)
+		if err != nil {
+			t.Errorf("trace %v: %s", span.Trace, err)
+			continue
+		}
+		if trace.Span.ID != span {
+			t.Errorf("got span %v, want %v", trace.Span.ID, span)
+		}
+		if !reflect.DeepEqual(trace.Annotations, anns) {
+			t.Errorf("span %v: got annotations %v, want %v", span, trace.Annotations, anns)
+		}
+	}
+}
+
+func TestGRPCCollector_error(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		spans []appdash.SpanID
+		fail  = true
+	)
+	c := collectorFunc(func(span appdash.SpanID, anns ...appdash.Annotation) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			fail = false
+			return errors.New("fake error")
+		}
+		spans = append(spans, span)
+		return nil
+	})
+	conn, stop := startServer(t, c)
+	defer stop()
+
+	// The error fails the stream, which Close reports.
+	gc := NewGRPCCollector(conn)
+	if err := gc.Collect(appdash.SpanID{Trace: 1, Span: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := gc.Close(); err == nil || !strings.Contains(err.Error(), "fake error") {
+		t.Errorf("got error %v, want fake error", err)
+	}
+
+	// A new stream is opened for the next collection.
+	if err := gc.Collect(appdash.SpanID{Trace: 2, Span: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := gc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []appdash.SpanID{{Trace: 2, Span: 2}}; !reflect.DeepEqual(spans, want) {
+		t.Errorf("got spans %v, want %v", spans, want)
+	}
+}
+
+func TestGRPCCollector_reopen(t *testing.T) {
+	store := appdash.NewMemoryStore()
+	conn, stop := startServer(t, store)
+	defer stop()
+
+	gc := NewGRPCCollector(conn)
+	if err := gc.Collect(appdash.SpanID{Trace: 1, Span: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cancel the stream, like a broken connection would. Collect opens a
+	// new stream once sending over the old one fails.
+	gc.mu.Lock()
+	old := gc.stream
+	gc.cancel()
+	gc.mu.Unlock()
+	deadline := time.Now().Add(5 * time.Second)
+	var last appdash.SpanID
+	for i := appdash.ID(2); ; i++ {
+		if time.Now().After(deadline) {
+			t.Fatal("no new stream opened after the stream was canceled")
+		}
+		last = appdash.SpanID{Trace: i, Span: i}
+		gc.Collect(last)
+		gc.mu.Lock()
+		reopened := gc.stream != old
+		gc.mu.Unlock()
+		if reopened {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := gc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Trace(last.Trace); err != nil {
+		t.Errorf("span sent over the new stream: %s", err)
+	}
+}
+
+type collectorFunc func(appdash.SpanID, ...appdash.Annotation) error
+
+func (c collectorFunc) Collect(span appdash.SpanID, anns ...appdash.Annotation) error {
+	return c(span, anns...)
+}
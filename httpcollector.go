@@ -0,0 +1,383 @@
+package appdash
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	pio "github.com/gogo/protobuf/io"
+	"github.com/gogo/protobuf/proto"
+	"sourcegraph.com/sourcegraph/appdash/internal/wire"
+)
+
+// HTTPContentType is the content type of the request bodies sent by an
+// HTTPCollector: a sequence of length-delimited protobuf CollectPackets,
+// exactly as they are sent over a connection to a CollectorServer.
+const HTTPContentType = "application/x-appdash-collect-packets"
+
+const (
+	// DefaultHTTPTimeout is the default timeout of the requests sent by an
+	// HTTPCollector (see NewHTTPCollector).
+	DefaultHTTPTimeout = 10 * time.Second
+
+	// DefaultMaxRequestSize is the default CollectorHandler.MaxRequestSize.
+	DefaultMaxRequestSize = 32 * 1024 * 1024 // 32 MB
+)
+
+// NewHTTPCollector creates a collector that POSTs collections to url,
+// where a CollectorHandler is listening. It sends each collection
+// immediately; to send them in batches, set BatchSize.
+func NewHTTPCollector(url string) *HTTPCollector {
+	return &HTTPCollector{
+		URL:        url,
+		Client:     &http.Client{Timeout: DefaultHTTPTimeout},
+		MaxRetries: 3,
+	}
+}
+
+// An HTTPCollector sends data to a collector server over HTTP(S), for
+// environments where the raw collector protocol (see RemoteCollector)
+// can't be used. The collector server receives it with a CollectorHandler.
+//
+// Requests that fail with a network error or a 5xx status are retried up
+// to MaxRetries times, waiting MinBackoff (doubling after each failure)
+// between attempts. Other failures are returned immediately.
+type HTTPCollector struct {
+	// URL is the URL of the collector server's CollectorHandler.
+	URL string
+
+	// Client is the HTTP client used to send requests; its Timeout
+	// bounds how long each attempt may take.
+	//
+	// Default Client = http.DefaultClient.
+	Client *http.Client
+
+	// Authorization, if non-empty, is sent as the Authorization header
+	// of each request (see CollectorHandler.Authorization).
+	Authorization string
+
+	// Compression, if non-empty, is the compression of the request bodies
+	// (only CompressionGzip is supported).
+	Compression string
+
+	// BatchSize, if greater than one, is the number of collections sent in
+	// each request. Collect queues collections until BatchSize of them are
+	// queued, and Flush sends them earlier. When the HTTPCollector is the
+	// underlying collector of a ChunkedCollector, the ChunkedCollector
+	// calls Flush after each of its flushes.
+	BatchSize int
+
+	// MaxRetries is the number of times a failed request is retried.
+	MaxRetries int
+
+	// MinBackoff is the time to wait before retrying a failed request for
+	// the first time.
+	//
+	// Default MinBackoff = DefaultMinBackoff.
+	MinBackoff time.Duration
+
+	// Log is the logger to use for errors and warnings. If nil, a new
+	// logger is created.
+	Log   *log.Logger
+	logMu sync.Mutex
+
+	// Debug is whether to log debug messages.
+	Debug bool
+
+	mu    sync.Mutex            // guards batch
+	batch []*wire.CollectPacket // collections waiting to be sent
+}
+
+// Collect implements the Collector interface by sending the events that
+// occured in the span to the collector server, in a batch if BatchSize is
+// set.
+func (hc *HTTPCollector) Collect(span SpanID, anns ...Annotation) error {
+	p := newCollectPacket(span, anns)
+	if hc.BatchSize <= 1 {
+		return hc.send([]*wire.CollectPacket{p})
+	}
+
+	hc.mu.Lock()
+	hc.batch = append(hc.batch, p)
+	var batch []*wire.CollectPacket
+	if len(hc.batch) >= hc.BatchSize {
+		batch = hc.batch
+		hc.batch = nil
+	}
+	hc.mu.Unlock()
+
+	if batch == nil {
+		return nil
+	}
+	return hc.send(batch)
+}
+
+// Flush sends the queued collections, if any.
+func (hc *HTTPCollector) Flush() error {
+	hc.mu.Lock()
+	batch := hc.batch
+	hc.batch = nil
+	hc.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+	return hc.send(batch)
+}
+
+// Close sends the queued collections, if any. The HTTPCollector may still
+// be used afterwards.
+func (hc *HTTPCollector) Close() error {
+	return hc.Flush()
+}
+
+// send POSTs the batch of collections, retrying if the request fails with
+// a network error or a 5xx status.
+func (hc *HTTPCollector) send(batch []*wire.CollectPacket) error {
+	var body bytes.Buffer
+	var w io.Writer = &body
+	var gz *gzip.Writer
+	switch hc.Compression {
+	case "":
+	case CompressionGzip:
+		gz = gzip.NewWriter(&body)
+		w = gz
+	default:
+		return fmt.Errorf("HTTPCollector: unsupported compression %q", hc.Compression)
+	}
+	pw := pio.NewDelimitedWriter(w)
+	for _, p := range batch {
+		if err := pw.WriteMsg(p); err != nil {
+			return err
+		}
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return err
+		}
+	}
+
+	backoff := hc.MinBackoff
+	if backoff <= 0 {
+		backoff = DefaultMinBackoff
+	}
+	for attempt := 0; ; attempt++ {
+		retry, err := hc.post(body.Bytes())
+		if err == nil {
+			if hc.Debug {
+				hc.log().Printf("Sent %d collections (%d bytes)", len(batch), body.Len())
+			}
+			return nil
+		}
+		if !retry || attempt >= hc.MaxRetries {
+			return err
+		}
+		if hc.Debug {
+			hc.log().Printf("%s (retrying in %s)", err, backoff)
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post sends a single request with the given body. It returns whether the
+// request may be retried if it failed.
+func (hc *HTTPCollector) post(body []byte) (retry bool, err error) {
+	req, err := http.NewRequest("POST", hc.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", HTTPContentType)
+	if hc.Compression != "" {
+		req.Header.Set("Content-Encoding", hc.Compression)
+	}
+	if hc.Authorization != "" {
+		req.Header.Set("Authorization", hc.Authorization)
+	}
+
+	client := hc.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("HTTPCollector: %s", err)
+	}
+	defer resp.Body.Close()
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	err = fmt.Errorf("HTTPCollector: POST %s: %s: %s", hc.URL, resp.Status, bytes.TrimSpace(msg))
+	return resp.StatusCode/100 == 5, err
+}
+
+func (hc *HTTPCollector) log() *log.Logger {
+	hc.logMu.Lock()
+	defer hc.logMu.Unlock()
+	if hc.Log == nil {
+		hc.Log = log.New(os.Stderr, fmt.Sprintf("HTTPCollector[%s]: ", hc.URL), log.LstdFlags|log.Lmicroseconds)
+	}
+	return hc.Log
+}
+
+// NewCollectorHandler creates an HTTP handler that receives collections
+// POSTed by HTTPCollectors and adds them to the collector c. It may be
+// mounted alongside the web UI, and used alongside a CollectorServer.
+func NewCollectorHandler(c Collector) *CollectorHandler {
+	return &CollectorHandler{c: c}
+}
+
+// A CollectorHandler is an HTTP handler that receives collections POSTed
+// by HTTPCollectors and adds them to a local collector.
+//
+// It responds with 204 No Content once all of the collections of a request
+// have been collected. If a request fails partway, the collections before
+// the failure have been collected, and may be collected again if the
+// client retries the request.
+type CollectorHandler struct {
+	c Collector
+
+	// Authorization, if non-empty, is the value that the Authorization
+	// header of requests must have. Other requests are rejected with 401
+	// Unauthorized.
+	Authorization string
+
+	// MaxMessageSize is the maximum size in bytes of each collection in a
+	// request, like CollectorServer.MaxMessageSize.
+	//
+	// Default MaxMessageSize = DefaultMaxMessageSize.
+	MaxMessageSize int
+
+	// MaxRequestSize is the maximum size in bytes of the (uncompressed)
+	// body of a request.
+	//
+	// Default MaxRequestSize = DefaultMaxRequestSize.
+	MaxRequestSize int64
+
+	// Log is the logger to use for errors and warnings. If nil, a new
+	// logger is created.
+	Log   *log.Logger
+	logMu sync.Mutex
+
+	// Debug is whether to log debug messages.
+	Debug bool
+}
+
+// ServeHTTP implements http.Handler.
+func (ch *CollectorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if ch.Authorization != "" {
+		// Constant time comparison to avoid timing attack.
+		got := r.Header.Get("Authorization")
+		if len(got) != len(ch.Authorization) || subtle.ConstantTimeCompare([]byte(got), []byte(ch.Authorization)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	var body io.Reader = r.Body
+	switch enc := r.Header.Get("Content-Encoding"); enc {
+	case "", "identity":
+	case CompressionGzip:
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		body = gz
+	default:
+		http.Error(w, fmt.Sprintf("unsupported content encoding %q", enc), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	n, status, err := ch.collect(body)
+	if err != nil {
+		ch.log().Printf("Client %s: %s", r.RemoteAddr, err)
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if ch.Debug {
+		ch.log().Printf("Client %s: collected %d spans", r.RemoteAddr, n)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// collect reads the collections in body and adds them to the collector. It
+// returns the number of collections added, and an error and the status to
+// respond with if it failed.
+func (ch *CollectorHandler) collect(body io.Reader) (n int, status int, err error) {
+	maxSize := ch.MaxMessageSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxMessageSize
+	}
+	maxRequestSize := ch.MaxRequestSize
+	if maxRequestSize <= 0 {
+		maxRequestSize = DefaultMaxRequestSize
+	}
+
+	br := bufio.NewReader(body)
+	var (
+		buf  []byte
+		read int64 // bytes of body read so far
+	)
+	for ; ; n++ {
+		length, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			return n, 0, nil
+		} else if err != nil {
+			return n, http.StatusBadRequest, err
+		}
+		if length > uint64(maxSize) {
+			return n, http.StatusRequestEntityTooLarge, fmt.Errorf("message of %d bytes exceeds MaxMessageSize (%d)", length, maxSize)
+		}
+		if read += int64(uvarintSize(length)) + int64(length); read > maxRequestSize {
+			return n, http.StatusRequestEntityTooLarge, fmt.Errorf("request body exceeds MaxRequestSize (%d)", maxRequestSize)
+		}
+		if uint64(cap(buf)) < length {
+			buf = make([]byte, length)
+		}
+		buf = buf[:length]
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return n, http.StatusBadRequest, err
+		}
+		p := &wire.CollectPacket{}
+		if err := proto.Unmarshal(buf, p); err != nil {
+			return n, http.StatusBadRequest, err
+		}
+		spanID := spanIDFromWire(p.Spanid)
+		if err := ch.c.Collect(spanID, annotationsFromWire(p.Annotation)...); err != nil {
+			return n, http.StatusInternalServerError, fmt.Errorf("Collect %v: %s", spanID, err)
+		}
+	}
+}
+
+// uvarintSize returns the size of the uvarint encoding of x.
+func uvarintSize(x uint64) int {
+	var buf [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(buf[:], x)
+}
+
+func (ch *CollectorHandler) log() *log.Logger {
+	ch.logMu.Lock()
+	defer ch.logMu.Unlock()
+	if ch.Log == nil {
+		ch.Log = log.New(os.Stderr, "CollectorHandler: ", log.LstdFlags|log.Lmicroseconds)
+	}
+	return ch.Log
+}
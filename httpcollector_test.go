@@ -0,0 +1,199 @@
+package appdash
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	pio "github.com/gogo/protobuf/io"
+)
+
+func TestHTTPCollector(t *testing.T) {
+	tests := []struct {
+		compression string
+		batchSize   int
+		requests    int
+	}{
+		{"", 0, 5},
+		{"", 2, 3},
+		{CompressionGzip, 0, 5},
+		{CompressionGzip, 10, 1},
+	}
+	for _, test := range tests {
+		store := NewMemoryStore()
+		ch := NewCollectorHandler(store)
+		ch.Authorization = "Bearer s3cret"
+		var (
+			mu       sync.Mutex
+			requests int
+		)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			requests++
+			mu.Unlock()
+			if got := r.Header.Get("Content-Encoding"); got != test.compression {
+				t.Errorf("%q: got Content-Encoding %q", test.compression, got)
+			}
+			ch.ServeHTTP(w, r)
+		}))
+
+		hc := NewHTTPCollector(srv.URL)
+		hc.Authorization = "Bearer s3cret"
+		hc.Compression = test.compression
+		hc.BatchSize = test.batchSize
+		want := map[ID]Annotations{}
+		for i := ID(1); i <= 5; i++ {
+			anns := Annotations{{Key: "k", Value: bytes.Repeat([]byte{'v'}, int(i))}}
+			want[i] = anns
+			if err := hc.Collect(SpanID{Trace: i, Span: i, Parent: 0}, anns...); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := hc.Close(); err != nil {
+			t.Fatal(err)
+		}
+		srv.Close()
+
+		for id, anns := range want {
+			trace, err := store.Trace(id)
+			if err != nil {
+				t.Errorf("%+v: trace %v: %s", test, id, err)
+				continue
+			}
+			if !reflect.DeepEqual(trace.Annotations, anns) {
+				t.Errorf("%+v: trace %v: got annotations %v, want %v", test, id, trace.Annotations, anns)
+			}
+		}
+		if requests != test.requests {
+			t.Errorf("%+v: got %d requests, want %d", test, requests, test.requests)
+		}
+	}
+}
+
+func TestHTTPCollector_retry(t *testing.T) {
+	store := NewMemoryStore()
+	ch := NewCollectorHandler(store)
+	var (
+		mu       sync.Mutex
+		attempts int
+		failures = 2
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts++
+		fail := attempts <= failures
+		mu.Unlock()
+		if fail {
+			http.Error(w, "restarting", http.StatusServiceUnavailable)
+			return
+		}
+		ch.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	hc := NewHTTPCollector(srv.URL)
+	hc.MinBackoff = time.Millisecond
+	if err := hc.Collect(SpanID{Trace: 1, Span: 1, Parent: 0}); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 3 {
+		t.Errorf("got %d attempts, want 3", attempts)
+	}
+	if _, err := store.Trace(1); err != nil {
+		t.Error(err)
+	}
+
+	// Give up after MaxRetries.
+	attempts, failures = 0, 10
+	if err := hc.Collect(SpanID{Trace: 2, Span: 2, Parent: 0}); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("got error %v, want 503 error", err)
+	}
+	if want := 1 + hc.MaxRetries; attempts != want {
+		t.Errorf("got %d attempts, want %d", attempts, want)
+	}
+}
+
+func TestCollectorHandler_errors(t *testing.T) {
+	store := NewMemoryStore()
+	ch := NewCollectorHandler(store)
+	ch.Authorization = "Bearer s3cret"
+	ch.MaxMessageSize = 100
+	ch.MaxRequestSize = 1000
+	ch.Log = log.New(ioutil.Discard, "", 0)
+	srv := httptest.NewServer(ch)
+	defer srv.Close()
+
+	packets := func(n, valueSize int) []byte {
+		var buf bytes.Buffer
+		w := pio.NewDelimitedWriter(&buf)
+		for i := 0; i < n; i++ {
+			w.WriteMsg(newCollectPacket(SpanID{Trace: 1, Span: 1, Parent: 0}, Annotations{{Key: "k", Value: make([]byte, valueSize)}}))
+		}
+		return buf.Bytes()
+	}
+	tests := []struct {
+		method, auth string
+		body         []byte
+		status       int
+	}{
+		{"POST", "Bearer s3cret", packets(10, 10), http.StatusNoContent},
+		{"GET", "Bearer s3cret", nil, http.StatusMethodNotAllowed},
+		{"POST", "", packets(1, 10), http.StatusUnauthorized},
+		{"POST", "Bearer guess", packets(1, 10), http.StatusUnauthorized},
+		{"POST", "Bearer s3cret", packets(1, 200), http.StatusRequestEntityTooLarge},
+		{"POST", "Bearer s3cret", packets(100, 10), http.StatusRequestEntityTooLarge},
+		{"POST", "Bearer s3cret", []byte{5, 1, 2}, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest(test.method, srv.URL, bytes.NewReader(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.auth != "" {
+			req.Header.Set("Authorization", test.auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("%s with %d-byte body (auth %q): got status %d, want %d", test.method, len(test.body), test.auth, resp.StatusCode, test.status)
+		}
+	}
+
+	// Client errors are returned to the caller.
+	hc := NewHTTPCollector(srv.URL)
+	hc.Log = log.New(ioutil.Discard, "", 0)
+	if err := hc.Collect(SpanID{Trace: 2, Span: 2, Parent: 0}); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("got error %v, want 401 error", err)
+	}
+}
+
+func TestChunkedCollector_flushesHTTPCollector(t *testing.T) {
+	store := NewMemoryStore()
+	srv := httptest.NewServer(NewCollectorHandler(store))
+	defer srv.Close()
+
+	hc := NewHTTPCollector(srv.URL)
+	hc.BatchSize = 100
+	cc := NewChunkedCollector(hc)
+	cc.Log = nil
+	for i := ID(1); i <= 3; i++ {
+		collectorT{t, cc}.MustCollect(SpanID{Trace: i, Span: i, Parent: 0})
+	}
+	if err := cc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.Usage().Traces; got != 3 {
+		t.Errorf("got %d traces, want 3", got)
+	}
+	cc.Stop()
+}
@@ -54,6 +54,10 @@ type ClientEvent struct {
 	Response   ResponseInfo `trace:"Client.Response"`
 	ClientSend time.Time    `trace:"Client.Send"`
 	ClientRecv time.Time    `trace:"Client.Recv"`
+
+	// D is the duration of the request, measured with the monotonic clock
+	// (see appdash.Timespan), or 0 if it wasn't.
+	D time.Duration `trace:"Client.Duration"`
 }
 
 // Schema returns the constant "HTTPClient".
@@ -74,6 +78,15 @@ func (e ClientEvent) Start() time.Time { return e.ClientSend }
 // End implements the appdash TimespanEvent interface.
 func (e ClientEvent) End() time.Time { return e.ClientRecv }
 
+// Duration implements the appdash DurationEvent interface.
+func (e ClientEvent) Duration() time.Duration { return e.D }
+
+// AtTime implements the appdash RetimableEvent interface.
+func (e ClientEvent) AtTime(t time.Time) appdash.Event {
+	e.ClientSend, e.ClientRecv = t, t.Add(e.ClientRecv.Sub(e.ClientSend))
+	return e
+}
+
 var (
 	redacted = []string{"REDACTED"}
 )
@@ -115,7 +128,10 @@ func isRedacted(name string) bool {
 // same trace.
 type Transport struct {
 	// Recorder is the current span's recorder. A new child Recorder
-	// (with a new child SpanID) is created for each HTTP roundtrip.
+	// (with a new child SpanID) is created for each HTTP roundtrip. If the
+	// request's context has a Recorder (see appdash.RecorderFromContext),
+	// its child is created instead, and if neither is set, the request
+	// isn't traced.
 	*appdash.Recorder
 
 	// Transport is the underlying HTTP transport to use when making
@@ -138,17 +154,28 @@ func (t *Transport) RoundTrip(original *http.Request) (*http.Response, error) {
 	t.setCloneRequest(original, req)
 	defer t.setCloneRequest(original, nil)
 
-	child := t.Recorder.Child()
+	parent := t.Recorder
+	if rec, ok := appdash.RecorderFromContext(req.Context()); ok {
+		parent = rec
+	}
+	if parent == nil {
+		return t.getTransport().RoundTrip(req)
+	}
+
+	var child *appdash.Recorder
 	if t.SetName {
-		child.Name("Request " + req.URL.Host)
+		child = parent.ChildWithName("Request " + req.URL.Host)
+	} else {
+		child = parent.Child()
 	}
 
 	// New child span is created and set as HTTP header instead of using `child`
 	// in order to have a single span recording operation per httptrace event
 	// (HTTPClient or HTTPServer).
-	span := appdash.NewSpanID(t.Recorder.SpanID)
+	span := appdash.NewSpanID(parent.SpanID)
 
 	SetSpanIDHeader(req.Header, span)
+	SetBaggageHeader(req.Header, child.Baggage())
 
 	e := NewClientEvent(req)
 	e.ClientSend = time.Now()
@@ -158,6 +185,7 @@ func (t *Transport) RoundTrip(original *http.Request) (*http.Response, error) {
 	resp, err := transport.RoundTrip(req)
 
 	e.ClientRecv = time.Now()
+	e.D = e.ClientRecv.Sub(e.ClientSend)
 	if err == nil {
 		e.Response = responseInfo(resp)
 	} else {
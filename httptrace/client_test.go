@@ -54,6 +54,7 @@ func TestNewClientEvent(t *testing.T) {
 		"Client.Response.ContentLength":        "0",
 		"Client.Send":                          "0001-01-01T00:00:00Z",
 		"Client.Recv":                          "0001-01-01T00:00:00Z",
+		"Client.Duration":                      "0",
 	}
 	if !reflect.DeepEqual(anns.StringMap(), expected) {
 		t.Errorf("got %#v, want %#v", anns.StringMap(), expected)
@@ -62,7 +63,7 @@ func TestNewClientEvent(t *testing.T) {
 
 func TestTransport(t *testing.T) {
 	ms := appdash.NewMemoryStore()
-	rec := appdash.NewRecorder(appdash.SpanID{1, 2, 3}, appdash.NewLocalCollector(ms))
+	rec := appdash.NewRecorder(appdash.SpanID{Trace: 1, Span: 2, Parent: 3}, appdash.NewLocalCollector(ms))
 
 	req, _ := http.NewRequest("GET", "http://example.com/foo", nil)
 	req.Header.Set("X-Req-Header", "a")
@@ -87,7 +88,7 @@ func TestTransport(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if want := (appdash.SpanID{1, spanID.Span, 2}); *spanID != want {
+	if want := (appdash.SpanID{Trace: 1, Span: spanID.Span, Parent: 2}); *spanID != want {
 		t.Errorf("got Span-ID in header %+v, want %+v", *spanID, want)
 	}
 
@@ -115,9 +116,13 @@ func TestTransport(t *testing.T) {
 			Headers:       map[string]string{"X-Resp-Header": "b"},
 		},
 	}
+	if e.D <= 0 {
+		t.Errorf("got duration %v, want the measured duration of the request", e.D)
+	}
 	delete(e.Request.Headers, "Span-Id")
 	e.ClientSend = time.Time{}
 	e.ClientRecv = time.Time{}
+	e.D = 0
 	if !reflect.DeepEqual(e, wantEvent) {
 		t.Errorf("got ClientEvent %+v, want %+v", e, wantEvent)
 	}
@@ -125,7 +130,7 @@ func TestTransport(t *testing.T) {
 
 func TestCancelRequest(t *testing.T) {
 	ms := appdash.NewMemoryStore()
-	rec := appdash.NewRecorder(appdash.SpanID{1, 2, 3}, appdash.NewLocalCollector(ms))
+	rec := appdash.NewRecorder(appdash.SpanID{Trace: 1, Span: 2, Parent: 3}, appdash.NewLocalCollector(ms))
 	req, _ := http.NewRequest("GET", "http://example.com/foo", nil)
 	transport := &Transport{
 		Recorder: rec,
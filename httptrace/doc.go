@@ -47,6 +47,17 @@
 //  // Connect to a remote collection server.
 //  collector := appdash.NewRemoteCollector(":7701")
 //
+// To avoid a network round trip for every request, the remote collector can be
+// wrapped in a ChunkedCollector, which sends spans in batches. It should be
+// closed when the app shuts down, so that the spans still queued are sent:
+//
+//  chunked := appdash.NewChunkedCollector(collector)
+//  defer func() {
+//      if err := chunked.Close(); err != nil {
+//          log.Println("appdash:", err)
+//      }
+//  }()
+//
 // And a basic middleware:
 //
 //  // Create a httptrace middleware.
@@ -1,14 +1,19 @@
 package httptrace
 
 import (
+	"fmt"
 	"net/http"
+	"net/url"
+	"sort"
+	"strings"
 
 	"sourcegraph.com/sourcegraph/appdash"
 )
 
 const (
 	// HeaderSpanID is the name of the HTTP header by which the trace
-	// and span IDs are passed along.
+	// and span IDs are passed along, along with the flags of the trace
+	// (see appdash.SpanID.String), such as whether it is sampled.
 	HeaderSpanID = "Span-ID"
 
 	// HeaderParentSpanID is the name of the HTTP header by which the
@@ -18,6 +23,11 @@ const (
 	// easily pass along an existing parent span ID but not create a
 	// new child span ID).
 	HeaderParentSpanID = "Parent-Span-ID"
+
+	// HeaderBaggage is the name of the HTTP header by which the baggage
+	// items of the span (see appdash.Recorder.SetBaggageItem) are passed
+	// along, as a comma-separated list of URL-escaped key=value pairs.
+	HeaderBaggage = "Span-Baggage"
 )
 
 // SetSpanIDHeader sets the Span-ID header.
@@ -74,3 +84,45 @@ func getSpanIDHeader(h http.Header, key string) (*appdash.SpanID, error) {
 	}
 	return appdash.ParseSpanID(s)
 }
+
+// SetBaggageHeader sets the Span-Baggage header to the given baggage items,
+// or removes it if there are none.
+func SetBaggageHeader(h http.Header, baggage map[string]string) {
+	if len(baggage) == 0 {
+		h.Del(HeaderBaggage)
+		return
+	}
+	items := make([]string, 0, len(baggage))
+	for k, v := range baggage {
+		items = append(items, url.QueryEscape(k)+"="+url.QueryEscape(v))
+	}
+	sort.Strings(items)
+	h.Set(HeaderBaggage, strings.Join(items, ","))
+}
+
+// GetBaggage returns the baggage items in the Span-Baggage header, or nil
+// if there are none. It returns an error if the header is malformed.
+func GetBaggage(h http.Header) (map[string]string, error) {
+	s := h.Get(HeaderBaggage)
+	if s == "" {
+		return nil, nil
+	}
+	baggage := map[string]string{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		eq := strings.Index(item, "=")
+		if eq == -1 {
+			return nil, fmt.Errorf("malformed baggage item %q", item)
+		}
+		k, err := url.QueryUnescape(item[:eq])
+		if err != nil {
+			return nil, err
+		}
+		v, err := url.QueryUnescape(item[eq+1:])
+		if err != nil {
+			return nil, err
+		}
+		baggage[k] = v
+	}
+	return baggage, nil
+}
@@ -2,6 +2,7 @@ package httptrace
 
 import (
 	"net/http"
+	"reflect"
 	"testing"
 
 	"sourcegraph.com/sourcegraph/appdash"
@@ -78,3 +79,29 @@ func TestGetSpanID_hasSpanIDAndParentSpanID(t *testing.T) {
 		t.Errorf("unexpected span ID: %+v", id)
 	}
 }
+
+func TestBaggageHeader(t *testing.T) {
+	baggage := map[string]string{"tenant": "acme", "odd key": "a=b,c"}
+	h := make(http.Header)
+	SetBaggageHeader(h, baggage)
+	if got, want := h.Get(HeaderBaggage), "odd+key=a%3Db%2Cc,tenant=acme"; got != want {
+		t.Errorf("got header %q, want %q", got, want)
+	}
+	got, err := GetBaggage(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, baggage) {
+		t.Errorf("got baggage %v, want %v", got, baggage)
+	}
+
+	h.Set(HeaderBaggage, "tenant")
+	if _, err := GetBaggage(h); err == nil {
+		t.Error("got no error for a malformed header")
+	}
+
+	SetBaggageHeader(h, nil)
+	if got, err := GetBaggage(h); got != nil || err != nil {
+		t.Errorf("got baggage %v and error %v, want none", got, err)
+	}
+}
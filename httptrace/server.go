@@ -3,6 +3,7 @@ package httptrace
 import (
 	"log"
 	"net/http"
+	"sort"
 	"time"
 
 	"sourcegraph.com/sourcegraph/appdash"
@@ -46,6 +47,10 @@ type ServerEvent struct {
 	User       string       `trace:"Server.User"`
 	ServerRecv time.Time    `trace:"Server.Recv"`
 	ServerSend time.Time    `trace:"Server.Send"`
+
+	// D is the duration of the request handling, measured with the
+	// monotonic clock (see appdash.Timespan), or 0 if it wasn't.
+	D time.Duration `trace:"Server.Duration"`
 }
 
 // Schema returns the constant "HTTPServer".
@@ -62,15 +67,36 @@ func (e ServerEvent) Start() time.Time { return e.ServerRecv }
 // End implements the appdash TimespanEvent interface.
 func (e ServerEvent) End() time.Time { return e.ServerSend }
 
+// Duration implements the appdash DurationEvent interface.
+func (e ServerEvent) Duration() time.Duration { return e.D }
+
+// AtTime implements the appdash RetimableEvent interface.
+func (e ServerEvent) AtTime(t time.Time) appdash.Event {
+	e.ServerRecv, e.ServerSend = t, t.Add(e.ServerSend.Sub(e.ServerRecv))
+	return e
+}
+
 // Middleware creates a new http.Handler middleware
 // (negroni-compliant) that records incoming HTTP requests to the
 // collector c as "HTTPServer"-schema events.
+//
+// The request passed to the next handler has the span's Recorder in its
+// context (see appdash.RecorderFromContext), so that the spans started
+// from it (e.g. with appdash.StartSpanFromContext) are its children. If
+// the request has no span ID header, but its context has a current span,
+// the request's span is a child of it.
 func Middleware(c appdash.Collector, conf *MiddlewareConfig) func(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
 	return func(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
 		spanID, spanFromHeader, err := getSpanID(r.Header)
 		if err != nil {
 			log.Printf("Warning: invalid %s header: %s. (Continuing with request handling.)", spanFromHeader, err)
 		}
+		if spanFromHeader == "" {
+			if parent, ok := appdash.SpanIDFromContext(r.Context()); ok {
+				childID := appdash.NewSpanID(parent)
+				spanID = &childID
+			}
+		}
 		usingProvidedSpanID := (spanFromHeader == HeaderSpanID)
 
 		if conf.SetContextSpan != nil {
@@ -81,29 +107,58 @@ func Middleware(c appdash.Collector, conf *MiddlewareConfig) func(rw http.Respon
 		e.ServerRecv = time.Now()
 
 		rr := &responseInfoRecorder{ResponseWriter: rw}
-		next(rr, r)
-		SetSpanIDHeader(rr.Header(), *spanID)
+		rec := appdash.NewRecorder(*spanID, c)
 
-		if !usingProvidedSpanID {
-			e.Request = requestInfo(r)
+		// Record the baggage items of the client's span, which the handlers
+		// can read with GetBaggage.
+		baggage, err := GetBaggage(r.Header)
+		if err != nil {
+			log.Printf("Warning: invalid %s header: %s. (Continuing with request handling.)", HeaderBaggage, err)
+		}
+		keys := make([]string, 0, len(baggage))
+		for k := range baggage {
+			keys = append(keys, k)
 		}
-		if conf.RouteName != nil {
-			e.Route = conf.RouteName(r)
+		sort.Strings(keys)
+		for _, k := range keys {
+			rec.SetBaggageItem(k, baggage[k])
 		}
-		if conf.CurrentUser != nil {
-			e.User = conf.CurrentUser(r)
+		r = r.WithContext(appdash.NewContextWithRecorder(r.Context(), rec))
+		finish := func() {
+			SetSpanIDHeader(rr.Header(), *spanID)
+
+			if !usingProvidedSpanID {
+				e.Request = requestInfo(r)
+			}
+			if conf.RouteName != nil {
+				e.Route = conf.RouteName(r)
+			}
+			if conf.CurrentUser != nil {
+				e.User = conf.CurrentUser(r)
+			}
+			e.Response = responseInfo(rr.partialResponse())
+			e.ServerSend = time.Now()
+			e.D = e.ServerSend.Sub(e.ServerRecv)
+
+			if e.Route != "" {
+				rec.Name("Serve " + e.Route)
+			} else {
+				rec.Name("Serve " + r.URL.Host + r.URL.Path)
+			}
+			rec.Event(e)
+			rec.Finish()
 		}
-		e.Response = responseInfo(rr.partialResponse())
-		e.ServerSend = time.Now()
 
-		rec := appdash.NewRecorder(*spanID, c)
-		if e.Route != "" {
-			rec.Name("Serve " + e.Route)
-		} else {
-			rec.Name("Serve " + r.URL.Host + r.URL.Path)
+		if conf.RecordPanics {
+			// If next panics, the panic is recorded, and then the span is
+			// finished before the panic propagates.
+			defer finish()
+			defer appdash.RecordPanic(rec)
+			next(rr, r)
+			return
 		}
-		rec.Event(e)
-		rec.Finish()
+		next(rr, r)
+		finish()
 	}
 }
 
@@ -122,6 +177,12 @@ type MiddlewareConfig struct {
 	// the HTTP request context, so it may be used by other parts of
 	// the handling process.
 	SetContextSpan func(*http.Request, appdash.SpanID)
+
+	// RecordPanics is whether a panic of the next handler is recorded on
+	// the span (see appdash.RecordPanic), which is then collected before
+	// the panic propagates. Otherwise, the span of a panicking request
+	// isn't collected.
+	RecordPanics bool
 }
 
 // responseInfoRecorder is an http.ResponseWriter that records a
@@ -56,6 +56,7 @@ func TestNewServerEvent(t *testing.T) {
 		"Server.Route":                         "",
 		"Server.Send":                          "0001-01-01T00:00:00Z",
 		"Server.Recv":                          "0001-01-01T00:00:00Z",
+		"Server.Duration":                      "0",
 	}
 	if !reflect.DeepEqual(anns.StringMap(), expected) {
 		t.Errorf("got %#v, want %#v", anns.StringMap(), expected)
@@ -69,7 +70,7 @@ func TestMiddleware_useSpanFromHeaders(t *testing.T) {
 	req, _ := http.NewRequest("GET", "http://example.com/foo", nil)
 	req.Header.Set("X-Req-Header", "a")
 
-	spanID := appdash.SpanID{1, 2, 3}
+	spanID := appdash.SpanID{Trace: 1, Span: 2, Parent: 3}
 	SetSpanIDHeader(req.Header, spanID)
 
 	var setContextSpan appdash.SpanID
@@ -112,14 +113,45 @@ func TestMiddleware_useSpanFromHeaders(t *testing.T) {
 		Route: "r",
 	}
 
+	if e.D <= 0 {
+		t.Errorf("got duration %v, want the measured duration of the request", e.D)
+	}
 	delete(e.Request.Headers, "Span-Id")
 	e.ServerRecv = time.Time{}
 	e.ServerSend = time.Time{}
+	e.D = 0
 	if !reflect.DeepEqual(e, wantEvent) {
 		t.Errorf("got ServerEvent %+v, want %+v", e, wantEvent)
 	}
 }
 
+func TestMiddleware_unsampledSpan(t *testing.T) {
+	ms := appdash.NewMemoryStore()
+	c := appdash.NewLocalCollector(ms)
+
+	req, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	spanID := appdash.SpanID{Trace: 1, Span: 2, Parent: 3, Flags: appdash.FlagSamplingDecided}
+	SetSpanIDHeader(req.Header, spanID)
+
+	var setContextSpan appdash.SpanID
+	mw := Middleware(c, &MiddlewareConfig{
+		SetContextSpan: func(r *http.Request, id appdash.SpanID) { setContextSpan = id },
+	})
+
+	w := httptest.NewRecorder()
+	mw(w, req, func(http.ResponseWriter, *http.Request) {})
+
+	if setContextSpan != spanID {
+		t.Errorf("set context span to %v, want %v", setContextSpan, spanID)
+	}
+	if got, want := w.Header().Get(HeaderSpanID), spanID.String(); got != want {
+		t.Errorf("got Span-ID response header %q, want %q", got, want)
+	}
+	if _, err := ms.Trace(1); err != appdash.ErrTraceNotFound {
+		t.Errorf("got error %v for the trace of an unsampled span, want %v", err, appdash.ErrTraceNotFound)
+	}
+}
+
 func TestMiddleware_createNewSpan(t *testing.T) {
 	ms := appdash.NewMemoryStore()
 	c := appdash.NewLocalCollector(ms)
@@ -134,7 +166,7 @@ func TestMiddleware_createNewSpan(t *testing.T) {
 	w := httptest.NewRecorder()
 	mw(w, req, func(http.ResponseWriter, *http.Request) {})
 
-	if setContextSpan == (appdash.SpanID{0, 0, 0}) {
+	if setContextSpan == (appdash.SpanID{Trace: 0, Span: 0, Parent: 0}) {
 		t.Errorf("context span is zero, want it to be set")
 	}
 
@@ -150,24 +182,68 @@ func TestMiddleware_createNewSpan(t *testing.T) {
 
 	wantEvent := ServerEvent{
 		Request: RequestInfo{
-			Method: "GET",
-			Proto:  "HTTP/1.1",
-			URI:    "/foo",
-			Host:   "example.com",
+			Method:  "GET",
+			Proto:   "HTTP/1.1",
+			URI:     "/foo",
+			Host:    "example.com",
+			Headers: map[string]string{},
 		},
 		Response: ResponseInfo{
 			StatusCode: 200,
 			Headers:    map[string]string{"Span-Id": setContextSpan.String()},
 		},
 	}
+	if e.D <= 0 {
+		t.Errorf("got duration %v, want the measured duration of the request", e.D)
+	}
 	delete(e.Request.Headers, "Span-Id")
 	e.ServerRecv = time.Time{}
 	e.ServerSend = time.Time{}
+	e.D = 0
 	if !reflect.DeepEqual(e, wantEvent) {
 		t.Errorf("got ServerEvent %+v, want %+v", e, wantEvent)
 	}
 }
 
+func TestMiddleware_recordPanics(t *testing.T) {
+	ms := appdash.NewMemoryStore()
+	c := appdash.NewLocalCollector(ms)
+
+	req, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+
+	var setContextSpan appdash.SpanID
+	mw := Middleware(c, &MiddlewareConfig{
+		SetContextSpan: func(r *http.Request, id appdash.SpanID) { setContextSpan = id },
+		RecordPanics:   true,
+	})
+
+	w := httptest.NewRecorder()
+	func() {
+		defer func() {
+			if v := recover(); v != "boom" {
+				t.Errorf("got %v recovered, want the handler's panic", v)
+			}
+		}()
+		mw(w, req, func(http.ResponseWriter, *http.Request) { panic("boom") })
+	}()
+
+	trace, err := ms.Trace(setContextSpan.Trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e ServerEvent
+	if err := appdash.UnmarshalEvent(trace.Span.Annotations, &e); err != nil {
+		t.Fatal(err)
+	}
+	var pe appdash.PanicEvent
+	if err := appdash.UnmarshalEvent(trace.Span.Annotations, &pe); err != nil {
+		t.Fatal(err)
+	}
+	if pe.Value != "boom" {
+		t.Errorf("got panic value %q, want boom", pe.Value)
+	}
+}
+
 func TestServerEvent_unmarshal(t *testing.T) {
 	m := map[string]string{
 		"":                                "/foo",
@@ -221,3 +297,38 @@ func mapToAnnotations(m map[string]string) appdash.Annotations {
 	}
 	return anns
 }
+
+func TestMiddleware_contextRecorder(t *testing.T) {
+	ms := appdash.NewMemoryStore()
+	c := appdash.NewLocalCollector(ms)
+
+	req, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	req.Header.Set(HeaderSpanID, appdash.SpanID{Trace: 1, Span: 2}.String())
+
+	mt := &mockTransport{resp: &http.Response{StatusCode: 200}}
+	var child appdash.SpanID
+	mw := Middleware(c, &MiddlewareConfig{})
+	mw(httptest.NewRecorder(), req, func(w http.ResponseWriter, r *http.Request) {
+		rec, ctx := appdash.StartSpanFromContext(r.Context(), "handler")
+		defer rec.Finish()
+		child = rec.SpanID
+
+		// The client requests made with the context are children of the
+		// handler's span, even though the transport has no Recorder.
+		out, _ := http.NewRequest("GET", "http://example.com/bar", nil)
+		if _, err := (&Transport{Transport: mt}).RoundTrip(out.WithContext(ctx)); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if child.Trace != 1 || child.Parent != 2 {
+		t.Errorf("got handler span %v, want a child of the request's span", child)
+	}
+	out, err := appdash.ParseSpanID(mt.req.Header.Get(HeaderSpanID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Trace != 1 || out.Parent != child.Span {
+		t.Errorf("got client request span %v, want a child of the handler's span %v", out, child)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"strconv"
+	"strings"
 	"sync"
 	"unsafe"
 )
@@ -50,6 +51,49 @@ func ParseID(s string) (ID, error) {
 	return ID(i), nil
 }
 
+// ParseIDLenient parses the given string as an ID, like ParseID, but also
+// accepts the forms in which IDs are commonly copied out of other systems
+// and logs, for use by user-facing surfaces (such as traceapp's URLs):
+//
+//	s                         ID
+//	"00000000000000ff"        0xff (the canonical form, as String returns)
+//	"ff", "FF"                0xff (unpadded, either case)
+//	"0xff", "0XFF"            0xff (prefixed)
+//	" ff "                    0xff (surrounding space is ignored)
+//	"000000000000000000ff"    0xff (zero-padded beyond 16 digits, e.g. the
+//	                          low half of a 128-bit ID with no high bits)
+//	"255"                     0x255 (ambiguous, so hex is preferred)
+//	"18446744073709551615"    0xffffffffffffffff if decimal is true (too
+//	                          long to be hex), and an error otherwise
+//	"0x255" with decimal      0x255 (prefixed input is always hex)
+//
+// That is, if decimal is true, input that consists only of decimal digits
+// is parsed as decimal only when it can't be a 64-bit hex ID (i.e. has
+// more than 16 significant digits). Callers that know that an input is
+// decimal should use strconv.ParseUint instead.
+func ParseIDLenient(s string, decimal bool) (ID, error) {
+	s = strings.TrimSpace(s)
+	hex := s
+	prefixed := strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X")
+	if prefixed {
+		hex = s[2:]
+	}
+	if trimmed := strings.TrimLeft(hex, "0"); len(hex) > 16 && len(trimmed) <= 16 {
+		hex = "0" + trimmed // zero-padded
+	}
+	if hex != "" && len(hex) <= 16 {
+		if i, err := strconv.ParseUint(hex, 16, 64); err == nil {
+			return ID(i), nil
+		}
+	}
+	if decimal && !prefixed && s != "" && strings.Trim(s, "0123456789") == "" {
+		if i, err := strconv.ParseUint(s, 10, 64); err == nil {
+			return ID(i), nil
+		}
+	}
+	return 0, fmt.Errorf("%q is not a valid ID", s)
+}
+
 // generateID returns a randomly-generated 64-bit ID. This function is
 // thread-safe.  IDs are produced by consuming an AES-CTR-128 keystream in
 // 64-bit chunks. The AES key is randomly generated on initialization, as is the
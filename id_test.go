@@ -90,6 +90,52 @@ func TestParseIDError(t *testing.T) {
 	}
 }
 
+func TestParseIDLenient(t *testing.T) {
+	tests := []struct {
+		s       string
+		decimal bool
+		want    ID
+		wantErr bool
+	}{
+		{s: "00000000000000ff", want: 0xff},
+		{s: "ff", want: 0xff},
+		{s: "FF", want: 0xff},
+		{s: "0xff", want: 0xff},
+		{s: "0XFF", want: 0xff},
+		{s: " ff\n", want: 0xff},
+		{s: "000000000000000000ff", want: 0xff},
+		{s: "00000000000000000000000000000000", want: 0},
+		{s: "ffffffffffffffff", want: 0xffffffffffffffff},
+		{s: "255", want: 0x255},
+		{s: "255", decimal: true, want: 0x255},
+		{s: "0x255", decimal: true, want: 0x255},
+		{s: "18446744073709551615", decimal: true, want: 0xffffffffffffffff},
+		{s: "18446744073709551615", wantErr: true},
+		{s: "18446744073709551616", decimal: true, wantErr: true},
+		{s: "10000000000000000ff", wantErr: true},
+		{s: "0x", wantErr: true},
+		{s: "", wantErr: true},
+		{s: "-1", decimal: true, wantErr: true},
+		{s: "xyz", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := ParseIDLenient(test.s, test.decimal)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%q (decimal %v): got %v, want an error", test.s, test.decimal, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q (decimal %v): %s", test.s, test.decimal, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%q (decimal %v): got %v, want %v", test.s, test.decimal, got, test.want)
+		}
+	}
+}
+
 func BenchmarkIDGeneration(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		generateID()
@@ -0,0 +1,85 @@
+package appdash
+
+// An Interceptor processes each event recorded on a span (see
+// Recorder.UseInterceptor), before it is marshaled into annotations. It
+// returns the event to record, which may be e itself or another event, and
+// false to drop the event instead.
+type Interceptor func(span SpanID, e Event) (Event, bool)
+
+// UseInterceptor adds f to the interceptors of the Recorder, which are
+// called in the order they were added with each event recorded on the span
+// (by Event and the methods that use it, and LazyEvent), each with the
+// event returned by the previous one. Once one of them drops the event,
+// the others aren't called. The raw annotations recorded by Annotation
+// aren't intercepted.
+//
+// The children of the Recorder (see Child) inherit its interceptors, as of
+// the time they are created. Adding interceptors to the child doesn't add
+// them to r.
+func (r *Recorder) UseInterceptor(f Interceptor) {
+	r.mu.Lock()
+	r.interceptors = append(r.interceptors, f)
+	r.mu.Unlock()
+}
+
+// intercept passes e through the interceptors of the Recorder, and returns
+// the event to record, and false if it was dropped.
+func (r *Recorder) intercept(e Event) (Event, bool) {
+	r.mu.Lock()
+	interceptors := r.interceptors
+	r.mu.Unlock()
+	for _, f := range interceptors {
+		var ok bool
+		if e, ok = f(r.SpanID, e); !ok || e == nil {
+			return nil, false
+		}
+	}
+	return e, true
+}
+
+// AddAnnotations returns an Interceptor that records the annotations on
+// each span along with its events, for example to tag every span with the
+// host it ran on:
+//
+//	rec.UseInterceptor(appdash.AddAnnotations(appdash.Annotation{Key: "Host", Value: []byte(host)}))
+//
+// The annotations are recorded once per span, with its first event. The
+// interceptors added after it get events of another type (with the same
+// schema) than the original ones, so it should be added last.
+func AddAnnotations(as ...Annotation) Interceptor {
+	as = append(Annotations(nil), as...)
+	return func(_ SpanID, e Event) (Event, bool) {
+		return annotatedEvent{Event: e, as: as}, true
+	}
+}
+
+// annotatedEvent is an event recorded along with other annotations (see
+// AddAnnotations).
+type annotatedEvent struct {
+	Event
+	as Annotations
+}
+
+// MarshalEvent implements the EventMarshaler interface. The Recorder
+// doesn't use it, but marshals the annotations once per span instead.
+func (e annotatedEvent) MarshalEvent() (Annotations, error) {
+	as, err := MarshalEvent(e.Event)
+	if err != nil {
+		return nil, err
+	}
+	return append(as, e.as...), nil
+}
+
+// DropEvents returns an Interceptor that drops the events with any of the
+// given schemas, for example to not record the SQL queries:
+//
+//	rec.UseInterceptor(appdash.DropEvents(sqltrace.SQLEvent{}.Schema()))
+func DropEvents(schemas ...string) Interceptor {
+	drop := make(map[string]bool, len(schemas))
+	for _, s := range schemas {
+		drop[s] = true
+	}
+	return func(_ SpanID, e Event) (Event, bool) {
+		return e, !drop[e.Schema()]
+	}
+}
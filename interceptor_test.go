@@ -0,0 +1,139 @@
+package appdash
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecorder_UseInterceptor(t *testing.T) {
+	ms := NewMemoryStore()
+	r := NewRecorder(SpanID{Trace: 1, Span: 2}, ms)
+	var calls []string
+	r.UseInterceptor(func(span SpanID, e Event) (Event, bool) {
+		calls = append(calls, "first "+e.Schema())
+		if span != r.SpanID {
+			t.Errorf("got span %v, want %v", span, r.SpanID)
+		}
+		return e, e.Schema() != "msg"
+	})
+	r.UseInterceptor(func(_ SpanID, e Event) (Event, bool) {
+		calls = append(calls, "second "+e.Schema())
+		if log, ok := e.(LogLevelEvent); ok {
+			log.Msg = strings.ToUpper(log.Msg)
+			return log, true
+		}
+		return e, true
+	})
+	r.Name("s")
+	r.Msg("dropped")
+	r.Infof("hello")
+	r.LazyEvent(func() Event { return LogLevelEvent{Level: LevelWarn, Msg: "lazy", Time: time.Now()} })
+	r.Annotation(Annotation{Key: "Raw", Value: []byte("v")})
+	r.Finish()
+
+	wantCalls := []string{"first name", "second name", "first msg", "first leveledlog", "second leveledlog", "first leveledlog", "second leveledlog"}
+	if !reflect.DeepEqual(calls, wantCalls) {
+		t.Errorf("got calls %q, want %q", calls, wantCalls)
+	}
+	trace, err := ms.Trace(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	as := trace.Span.Annotations
+	if as.Has(SchemaPrefix + "msg") {
+		t.Error("the dropped Msg event was recorded")
+	}
+	if !as.Has("Raw") {
+		t.Error("the raw annotation wasn't recorded")
+	}
+	var msgs []string
+	for _, l := range as.Logs() {
+		msgs = append(msgs, l.Msg)
+	}
+	if want := []string{"HELLO", "LAZY"}; !reflect.DeepEqual(msgs, want) {
+		t.Errorf("got logs %q, want %q", msgs, want)
+	}
+}
+
+func TestRecorder_UseInterceptor_child(t *testing.T) {
+	ms := NewMemoryStore()
+	r := NewRecorder(SpanID{Trace: 1, Span: 2}, ms)
+	r.UseInterceptor(DropEvents("msg"))
+	c := r.ChildWithName("child")
+	c.UseInterceptor(DropEvents("log"))
+	for _, rec := range []*Recorder{r, c} {
+		rec.Msg("m")
+		rec.Log("l")
+		rec.Finish()
+	}
+
+	trace, err := ms.Trace(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, log := SchemaPrefix+"msg", SchemaPrefix+"log"
+	if as := trace.Span.Annotations; as.Has(msg) || !as.Has(log) {
+		t.Errorf("got parent annotations %v, want the Log event only", as)
+	}
+	if as := trace.Sub[0].Span.Annotations; as.Has(msg) || as.Has(log) {
+		t.Errorf("got child annotations %v, want neither the Msg nor the Log event", as)
+	}
+}
+
+func TestAddAnnotations(t *testing.T) {
+	var anns Annotations
+	r := NewRecorder(SpanID{Trace: 1, Span: 2}, collectorFunc(func(_ SpanID, as ...Annotation) error {
+		anns = append(anns, as...)
+		return nil
+	}))
+	r.UseInterceptor(DropEvents("msg"))
+	r.UseInterceptor(AddAnnotations(Annotation{Key: "Host", Value: []byte("h1")}))
+	r.Msg("dropped")
+	r.Name("s")
+	r.Infof("a")
+	r.Infof("b")
+	r.Finish()
+
+	var n int
+	for _, a := range anns {
+		if a.Key == "Host" {
+			n++
+		}
+	}
+	if n != 1 || string(anns.Get("Host")) != "h1" {
+		t.Errorf("got %d Host annotations in %v, want 1", n, anns)
+	}
+	if got := len(anns.Logs()); got != 2 {
+		t.Errorf("got %d logs, want 2 (the annotated events are still repeated)", got)
+	}
+	if anns.Has(SchemaPrefix + "msg") {
+		t.Error("the dropped Msg event was recorded")
+	}
+}
+
+func TestAddAnnotations_timespan(t *testing.T) {
+	var anns Annotations
+	r := NewRecorder(SpanID{Trace: 1, Span: 2}, collectorFunc(func(_ SpanID, as ...Annotation) error {
+		anns = append(anns, as...)
+		return nil
+	}))
+	r.UseInterceptor(AddAnnotations(Annotation{Key: "Host", Value: []byte("h1")}))
+	start := time.Now()
+	r.Event(Timespan{S: start, E: start.Add(1500 * time.Millisecond)})
+	r.Finish()
+
+	if string(anns.Get("Host")) != "h1" {
+		t.Errorf("got annotations %v, want the Host annotation", anns)
+	}
+	var events []Event
+	if err := UnmarshalEvents(anns, &events); err != nil || len(events) != 1 {
+		t.Fatalf("got events %v and error %v", events, err)
+	}
+	// The duration is recorded even though the event was wrapped by the
+	// interceptor.
+	if got, want := events[0].(Timespan).D, 1500*time.Millisecond; got != want {
+		t.Errorf("got recorded duration %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,3 @@
+package grpcwire
+
+//go:generate protoc --proto_path=$GOPATH/src:$GOPATH/src/github.com/gogo/protobuf/protobuf/google/protobuf:. --gogo_out=plugins=grpc,Msourcegraph.com/sourcegraph/appdash/internal/wire/collector.proto=sourcegraph.com/sourcegraph/appdash/internal/wire:. service.proto
@@ -0,0 +1,163 @@
+// Code generated by protoc-gen-gogo.
+// source: service.proto
+// DO NOT EDIT!
+
+/*
+Package grpcwire is a generated protocol buffer package.
+
+It is generated from these files:
+	service.proto
+
+It has these top-level messages:
+	CollectResponse
+*/
+package grpcwire
+
+import proto "github.com/gogo/protobuf/proto"
+import fmt "fmt"
+import math "math"
+import wire "sourcegraph.com/sourcegraph/appdash/internal/wire"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// CollectResponse is the reply to a Collect stream.
+type CollectResponse struct {
+	// collected is the number of packets that were collected.
+	Collected        *uint64 `protobuf:"varint,1,opt,name=collected" json:"collected,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *CollectResponse) Reset()         { *m = CollectResponse{} }
+func (m *CollectResponse) String() string { return proto.CompactTextString(m) }
+func (*CollectResponse) ProtoMessage()    {}
+
+func (m *CollectResponse) GetCollected() uint64 {
+	if m != nil && m.Collected != nil {
+		return *m.Collected
+	}
+	return 0
+}
+
+func init() {
+	proto.RegisterType((*CollectResponse)(nil), "grpcwire.CollectResponse")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// Client API for CollectorService service
+
+type CollectorServiceClient interface {
+	// Collect receives a stream of collect packets (without handshakes,
+	// which gRPC makes unnecessary), and replies once the client closes
+	// the stream.
+	Collect(ctx context.Context, opts ...grpc.CallOption) (CollectorService_CollectClient, error)
+}
+
+type collectorServiceClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewCollectorServiceClient(cc *grpc.ClientConn) CollectorServiceClient {
+	return &collectorServiceClient{cc}
+}
+
+func (c *collectorServiceClient) Collect(ctx context.Context, opts ...grpc.CallOption) (CollectorService_CollectClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_CollectorService_serviceDesc.Streams[0], c.cc, "/grpcwire.CollectorService/Collect", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &collectorServiceCollectClient{stream}
+	return x, nil
+}
+
+type CollectorService_CollectClient interface {
+	Send(*wire.CollectPacket) error
+	CloseAndRecv() (*CollectResponse, error)
+	grpc.ClientStream
+}
+
+type collectorServiceCollectClient struct {
+	grpc.ClientStream
+}
+
+func (x *collectorServiceCollectClient) Send(m *wire.CollectPacket) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *collectorServiceCollectClient) CloseAndRecv() (*CollectResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(CollectResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Server API for CollectorService service
+
+type CollectorServiceServer interface {
+	// Collect receives a stream of collect packets (without handshakes,
+	// which gRPC makes unnecessary), and replies once the client closes
+	// the stream.
+	Collect(CollectorService_CollectServer) error
+}
+
+func RegisterCollectorServiceServer(s *grpc.Server, srv CollectorServiceServer) {
+	s.RegisterService(&_CollectorService_serviceDesc, srv)
+}
+
+func _CollectorService_Collect_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(CollectorServiceServer).Collect(&collectorServiceCollectServer{stream})
+}
+
+type CollectorService_CollectServer interface {
+	SendAndClose(*CollectResponse) error
+	Recv() (*wire.CollectPacket, error)
+	grpc.ServerStream
+}
+
+type collectorServiceCollectServer struct {
+	grpc.ServerStream
+}
+
+func (x *collectorServiceCollectServer) SendAndClose(m *CollectResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *collectorServiceCollectServer) Recv() (*wire.CollectPacket, error) {
+	m := new(wire.CollectPacket)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+var _CollectorService_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "grpcwire.CollectorService",
+	HandlerType: (*CollectorServiceServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Collect",
+			Handler:       _CollectorService_Collect_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "service.proto",
+}
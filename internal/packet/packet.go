@@ -0,0 +1,90 @@
+// Package packet converts spans to and from the collect packets of the
+// collector protocol, for the collector transports that live outside of
+// package appdash.
+package packet
+
+import (
+	"github.com/gogo/protobuf/proto"
+
+	"sourcegraph.com/sourcegraph/appdash"
+	"sourcegraph.com/sourcegraph/appdash/internal/wire"
+)
+
+// New returns the collect packet of a span and its annotations.
+func New(s appdash.SpanID, as appdash.Annotations) *wire.CollectPacket {
+	p := &wire.CollectPacket{
+		Spanid: &wire.CollectPacket_SpanID{
+			Trace:  (*uint64)(&s.Trace),
+			Span:   (*uint64)(&s.Span),
+			Parent: (*uint64)(&s.Parent),
+		},
+	}
+	if s.TraceHigh != 0 {
+		// Omitted otherwise, as by the collectors of package appdash.
+		p.Spanid.TraceHigh = (*uint64)(&s.TraceHigh)
+	}
+	if s.Flags != 0 {
+		p.Spanid.Flags = proto.Uint32(uint32(s.Flags))
+	}
+	for _, a := range as {
+		// Make a copy of a that we can retain a pointer to.
+		cpy := a
+		p.Annotation = append(p.Annotation, &wire.CollectPacket_Annotation{
+			Key:   &cpy.Key,
+			Value: cpy.Value,
+		})
+	}
+	return p
+}
+
+// Split returns the collect packets of a span and its annotations, with
+// the annotations split over as many packets as needed for each of them to
+// encode to at most maxSize bytes. A packet that holds a single annotation
+// may still exceed maxSize. If maxSize is zero, a single packet is
+// returned.
+func Split(s appdash.SpanID, as appdash.Annotations, maxSize int) []*wire.CollectPacket {
+	p := New(s, nil)
+	if maxSize <= 0 {
+		p.Annotation = New(s, as).Annotation
+		return []*wire.CollectPacket{p}
+	}
+	var (
+		ps   []*wire.CollectPacket
+		base = proto.Size(p)
+		size = base
+	)
+	for _, a := range New(s, as).Annotation {
+		n := proto.Size(a)
+		n += 1 + proto.SizeVarint(uint64(n)) // field tag and length
+		if size+n > maxSize && len(p.Annotation) > 0 {
+			ps = append(ps, p)
+			p, size = New(s, nil), base
+		}
+		p.Annotation = append(p.Annotation, a)
+		size += n
+	}
+	return append(ps, p)
+}
+
+// SpanID returns the span ID of a collect packet.
+func SpanID(p *wire.CollectPacket) appdash.SpanID {
+	return appdash.SpanID{
+		Trace:     appdash.ID(p.GetSpanid().GetTrace()),
+		TraceHigh: appdash.ID(p.GetSpanid().GetTraceHigh()),
+		Span:      appdash.ID(p.GetSpanid().GetSpan()),
+		Parent:    appdash.ID(p.GetSpanid().GetParent()),
+		Flags:     appdash.SpanFlags(p.GetSpanid().GetFlags()),
+	}
+}
+
+// Annotations returns the annotations of a collect packet.
+func Annotations(p *wire.CollectPacket) appdash.Annotations {
+	var as appdash.Annotations
+	for _, a := range p.Annotation {
+		as = append(as, appdash.Annotation{
+			Key:   a.GetKey(),
+			Value: a.Value,
+		})
+	}
+	return as
+}
@@ -0,0 +1,36 @@
+package packet
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+
+	"sourcegraph.com/sourcegraph/appdash"
+	"sourcegraph.com/sourcegraph/appdash/internal/wire"
+)
+
+func TestRoundTrip(t *testing.T) {
+	as := appdash.Annotations{{Key: "k", Value: []byte("v")}}
+	for _, id := range []appdash.SpanID{
+		{Trace: 1, Span: 2, Parent: 3},
+		{Trace: 1, TraceHigh: 4, Span: 2, Parent: 3},
+		{Trace: 1, Span: 2, Parent: 3, Flags: appdash.FlagSampled | appdash.FlagSamplingDecided},
+		{Trace: 1, TraceHigh: 4, Span: 2, Parent: 3, Flags: appdash.FlagSamplingDecided},
+	} {
+		b, err := proto.Marshal(New(id, as))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var p wire.CollectPacket
+		if err := proto.Unmarshal(b, &p); err != nil {
+			t.Fatal(err)
+		}
+		if got := SpanID(&p); got != id {
+			t.Errorf("got span %v, want %v", got, id)
+		}
+		if got := Annotations(&p); !reflect.DeepEqual(got, as) {
+			t.Errorf("got annotations %v, want %v", got, as)
+		}
+	}
+}
@@ -0,0 +1,391 @@
+// Package storetest implements a conformance test suite that is shared by the
+// appdash.Store implementations in this repository.
+package storetest
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"sourcegraph.com/sourcegraph/appdash"
+)
+
+// Test runs the conformance tests against stores created by newStore, which
+// is called once per test. Tests of the optional appdash.Queryer,
+// appdash.DeleteStore, appdash.TraceIterator and appdash.Counter interfaces
+// are skipped if the store does not implement them. The queries with the
+// filters that the store doesn't support (see appdash.ErrUnsupportedFilter)
+// are skipped too.
+//
+// Stores are not required to preserve the collection order of sibling spans,
+// so children are compared ordered by span ID.
+func Test(t *testing.T, newStore func(t *testing.T) appdash.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s appdash.Store)
+	}{
+		{"notFound", testNotFound},
+		{"collectOne", testCollectOne},
+		{"collectSameChildTwice", testCollectSameChildTwice},
+		{"childCollectedBeforeRoot", testChildCollectedBeforeRoot},
+		{"tree", testTree},
+		{"concurrentCollect", testConcurrentCollect},
+		{"traces", testTraces},
+		{"tracesFilters", testTracesFilters},
+		{"delete", testDelete},
+		{"forEachTrace", testForEachTrace},
+		{"counts", testCounts},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			test.fn(t, newStore(t))
+		})
+	}
+}
+
+func mustCollect(t *testing.T, s appdash.Store, id appdash.SpanID, as ...appdash.Annotation) {
+	if err := s.Collect(id, as...); err != nil {
+		t.Fatalf("Collect(%+v, %v): %s", id, as, err)
+	}
+}
+
+func mustTrace(t *testing.T, s appdash.Store, id appdash.ID) *appdash.Trace {
+	tr, err := s.Trace(id)
+	if err != nil {
+		t.Fatalf("Trace(%v): %s", id, err)
+	}
+	return tr
+}
+
+// checkTrace compares the trace with the given ID against want, ignoring the
+// order of children.
+func checkTrace(t *testing.T, s appdash.Store, id appdash.ID, want *appdash.Trace) {
+	x := mustTrace(t, s, id)
+	sortSub(x)
+	sortSub(want)
+	if !reflect.DeepEqual(x, want) {
+		t.Errorf("Trace(%v): got trace\n%s\n\nwant trace\n%s", id, x, want)
+	}
+}
+
+func sortSub(t *appdash.Trace) {
+	sort.Sort(bySpanID(t.Sub))
+	for _, sub := range t.Sub {
+		sortSub(sub)
+	}
+}
+
+type bySpanID []*appdash.Trace
+
+func (t bySpanID) Len() int           { return len(t) }
+func (t bySpanID) Less(i, j int) bool { return t[i].Span.ID.Span < t[j].Span.ID.Span }
+func (t bySpanID) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+
+func testNotFound(t *testing.T, s appdash.Store) {
+	if x, err := s.Trace(123); err != appdash.ErrTraceNotFound {
+		t.Errorf("Trace(123): got trace %+v and err %#v, want ErrTraceNotFound", x, err)
+	}
+}
+
+func testCollectOne(t *testing.T, s appdash.Store) {
+	as := appdash.Annotations{{Key: "k1", Value: []byte("v1")}, {Key: "k2", Value: []byte("v2")}}
+	mustCollect(t, s, appdash.SpanID{Trace: 1, Span: 1}, as...)
+	checkTrace(t, s, 1, &appdash.Trace{Span: appdash.Span{ID: appdash.SpanID{Trace: 1, Span: 1}, Annotations: as}})
+}
+
+func testCollectSameChildTwice(t *testing.T, s appdash.Store) {
+	mustCollect(t, s, appdash.SpanID{Trace: 1, Span: 1})
+	mustCollect(t, s, appdash.SpanID{Trace: 1, Span: 2, Parent: 1}, appdash.Annotation{Key: "k1"})
+	mustCollect(t, s, appdash.SpanID{Trace: 1, Span: 2, Parent: 1}, appdash.Annotation{Key: "k2"})
+	checkTrace(t, s, 1, &appdash.Trace{
+		Span: appdash.Span{ID: appdash.SpanID{Trace: 1, Span: 1}},
+		Sub: []*appdash.Trace{
+			{Span: appdash.Span{ID: appdash.SpanID{Trace: 1, Span: 2, Parent: 1}, Annotations: appdash.Annotations{{Key: "k1"}, {Key: "k2"}}}},
+		},
+	})
+}
+
+func testChildCollectedBeforeRoot(t *testing.T, s appdash.Store) {
+	mustCollect(t, s, appdash.SpanID{Trace: 1, Span: 2, Parent: 1})
+	checkTrace(t, s, 1, &appdash.Trace{Span: appdash.Span{ID: appdash.SpanID{Trace: 1, Span: 2, Parent: 1}}})
+
+	mustCollect(t, s, appdash.SpanID{Trace: 1, Span: 1})
+	checkTrace(t, s, 1, &appdash.Trace{
+		Span: appdash.Span{ID: appdash.SpanID{Trace: 1, Span: 1}},
+		Sub: []*appdash.Trace{
+			{Span: appdash.Span{ID: appdash.SpanID{Trace: 1, Span: 2, Parent: 1}}},
+		},
+	})
+}
+
+func testTree(t *testing.T, s appdash.Store) {
+	// Collected deepest-first, to exercise reattachment of children.
+	mustCollect(t, s, appdash.SpanID{Trace: 1, Span: 4, Parent: 3})
+	mustCollect(t, s, appdash.SpanID{Trace: 1, Span: 5, Parent: 2})
+	mustCollect(t, s, appdash.SpanID{Trace: 1, Span: 3, Parent: 2})
+	mustCollect(t, s, appdash.SpanID{Trace: 1, Span: 2, Parent: 1})
+	mustCollect(t, s, appdash.SpanID{Trace: 1, Span: 1})
+	checkTrace(t, s, 1, &appdash.Trace{
+		Span: appdash.Span{ID: appdash.SpanID{Trace: 1, Span: 1}},
+		Sub: []*appdash.Trace{{
+			Span: appdash.Span{ID: appdash.SpanID{Trace: 1, Span: 2, Parent: 1}},
+			Sub: []*appdash.Trace{
+				{
+					Span: appdash.Span{ID: appdash.SpanID{Trace: 1, Span: 3, Parent: 2}},
+					Sub: []*appdash.Trace{
+						{Span: appdash.Span{ID: appdash.SpanID{Trace: 1, Span: 4, Parent: 3}}},
+					},
+				},
+				{Span: appdash.Span{ID: appdash.SpanID{Trace: 1, Span: 5, Parent: 2}}},
+			},
+		}},
+	})
+}
+
+func testConcurrentCollect(t *testing.T, s appdash.Store) {
+	const (
+		goroutines = 8
+		spans      = 25
+	)
+	mustCollect(t, s, appdash.SpanID{Trace: 1, Span: 1})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, goroutines*spans)
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < spans; i++ {
+				id := appdash.SpanID{Trace: 1, Span: appdash.ID(2 + g*spans + i), Parent: 1}
+				if err := s.Collect(id, appdash.Annotation{Key: "g", Value: []byte(fmt.Sprint(g))}); err != nil {
+					errs <- err
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	if x := mustTrace(t, s, 1); len(x.Sub) != goroutines*spans {
+		t.Errorf("got %d children, want %d", len(x.Sub), goroutines*spans)
+	}
+}
+
+func testTraces(t *testing.T, s appdash.Store) {
+	q, ok := s.(appdash.Queryer)
+	if !ok {
+		t.Skip("store does not implement appdash.Queryer")
+	}
+
+	mustCollect(t, s, appdash.SpanID{Trace: 1, Span: 1})
+	mustCollect(t, s, appdash.SpanID{Trace: 2, Span: 1})
+	mustCollect(t, s, appdash.SpanID{Trace: 2, Span: 2, Parent: 1})
+	mustCollect(t, s, appdash.SpanID{Trace: 3, Span: 1})
+
+	traces, err := q.Traces(appdash.TracesOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for _, tr := range traces {
+		ids = append(ids, int(tr.Span.ID.Trace))
+		if tr.Span.ID.Trace == 2 && len(tr.Sub) != 1 {
+			t.Errorf("trace 2: got %d children, want %d", len(tr.Sub), 1)
+		}
+	}
+	sort.Ints(ids)
+	if want := []int{1, 2, 3}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("Traces: got trace IDs %v, want %v", ids, want)
+	}
+
+	traces, err = q.Traces(appdash.TracesOpts{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(traces) != 2 {
+		t.Errorf("Traces with Limit 2: got %d traces, want %d", len(traces), 2)
+	}
+}
+
+func testTracesFilters(t *testing.T, s appdash.Store) {
+	q, ok := s.(appdash.Queryer)
+	if !ok {
+		t.Skip("store does not implement appdash.Queryer")
+	}
+
+	// Traces 1, 2 and 3 started 3, 2 and 1 minutes ago, and lasted 1, 2
+	// and 3 seconds. Trace 2 has a child with an annotation.
+	now := time.Now().Truncate(time.Second)
+	for i := 1; i <= 3; i++ {
+		start := now.Add(time.Duration(i-4) * time.Minute)
+		as, err := appdash.MarshalEvent(appdash.Timespan{S: start, E: start.Add(time.Duration(i) * time.Second)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		mustCollect(t, s, appdash.SpanID{Trace: appdash.ID(i), Span: 1}, as...)
+	}
+	mustCollect(t, s, appdash.SpanID{Trace: 2, Span: 2, Parent: 1}, appdash.Annotation{Key: "User", Value: []byte("alice")})
+
+	tests := []struct {
+		name string
+		opts appdash.TracesOpts
+		want []appdash.ID
+
+		unordered bool // the order of TraceIDs isn't specified
+	}{
+		{"all", appdash.TracesOpts{}, []appdash.ID{3, 2, 1}, false},
+		{"Limit", appdash.TracesOpts{Limit: 2}, []appdash.ID{3, 2}, false},
+		{"TraceIDs", appdash.TracesOpts{TraceIDs: []appdash.ID{1, 3}}, []appdash.ID{3, 1}, true},
+		{"Matchers", appdash.TracesOpts{Matchers: []appdash.AnnotationMatcher{{Key: "User", Value: "alice"}}}, []appdash.ID{2}, false},
+		{"Matchers value", appdash.TracesOpts{Matchers: []appdash.AnnotationMatcher{{Key: "User", Value: "bob"}}}, nil, false},
+		{"MinDuration", appdash.TracesOpts{MinDuration: 2 * time.Second}, []appdash.ID{3, 2}, false},
+		{"MinDuration and Limit", appdash.TracesOpts{MinDuration: 2 * time.Second, Limit: 1}, []appdash.ID{3}, false},
+	}
+	for _, test := range tests {
+		traces, err := q.Traces(test.opts)
+		if errors.Is(err, appdash.ErrUnsupportedFilter) {
+			t.Logf("%s: %s", test.name, err)
+			continue
+		} else if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		var ids []appdash.ID
+		for _, tr := range traces {
+			ids = append(ids, tr.Span.ID.Trace)
+		}
+		if test.unordered {
+			sort.Slice(ids, func(i, j int) bool { return ids[i] > ids[j] })
+		}
+		if !reflect.DeepEqual(ids, test.want) {
+			t.Errorf("%s: got trace IDs %v, want %v", test.name, ids, test.want)
+		}
+	}
+}
+
+func testDelete(t *testing.T, s appdash.Store) {
+	ds, ok := s.(appdash.DeleteStore)
+	if !ok {
+		t.Skip("store does not implement appdash.DeleteStore")
+	}
+
+	mustCollect(t, s, appdash.SpanID{Trace: 1, Span: 1})
+	mustCollect(t, s, appdash.SpanID{Trace: 1, Span: 2, Parent: 1})
+	mustCollect(t, s, appdash.SpanID{Trace: 2, Span: 1})
+	if err := ds.Delete(1, 3); err != nil {
+		t.Fatal(err)
+	}
+	if x, err := s.Trace(1); err != appdash.ErrTraceNotFound {
+		t.Errorf("Trace(1): got trace %+v and err %#v, want ErrTraceNotFound", x, err)
+	}
+	mustTrace(t, s, 2)
+
+	if q, ok := s.(appdash.Queryer); ok {
+		traces, err := q.Traces(appdash.TracesOpts{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(traces) != 1 {
+			t.Errorf("Traces: got %d traces after delete, want %d", len(traces), 1)
+		}
+	}
+}
+
+func testForEachTrace(t *testing.T, s appdash.Store) {
+	it, ok := s.(appdash.TraceIterator)
+	if !ok {
+		t.Skip("store does not implement appdash.TraceIterator")
+	}
+
+	if err := it.ForEachTrace(func(tr *appdash.Trace) error {
+		t.Errorf("got trace %v from empty store", tr.Span.ID.Trace)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// More traces than some stores read at a time.
+	const n = 150
+	for i := 1; i <= n; i++ {
+		mustCollect(t, s, appdash.SpanID{Trace: appdash.ID(i), Span: 1})
+	}
+	mustCollect(t, s, appdash.SpanID{Trace: 1, Span: 2, Parent: 1})
+	seen := map[appdash.ID]bool{}
+	err := it.ForEachTrace(func(tr *appdash.Trace) error {
+		if seen[tr.Span.ID.Trace] {
+			t.Errorf("trace %v seen twice", tr.Span.ID.Trace)
+		}
+		seen[tr.Span.ID.Trace] = true
+		if tr.Span.ID.Trace == 1 && len(tr.Sub) != 1 {
+			t.Errorf("trace 1: got %d children, want 1", len(tr.Sub))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != n {
+		t.Errorf("got %d traces, want %d", len(seen), n)
+	}
+
+	// An error returned by f stops iteration.
+	errStop := errors.New("stop")
+	var calls int
+	err = it.ForEachTrace(func(*appdash.Trace) error {
+		calls++
+		return errStop
+	})
+	if err != errStop {
+		t.Errorf("got error %v, want %v", err, errStop)
+	}
+	if calls != 1 {
+		t.Errorf("got %d calls after error, want 1", calls)
+	}
+}
+
+func testCounts(t *testing.T, s appdash.Store) {
+	c, ok := s.(appdash.Counter)
+	if !ok {
+		t.Skip("store does not implement appdash.Counter")
+	}
+	check := func(step string, traces, spans int) {
+		t.Helper()
+		if n, err := c.NumTraces(); err != nil || n != traces {
+			t.Errorf("%s: NumTraces: got %d and err %v, want %d", step, n, err, traces)
+		}
+		if n, err := c.NumSpans(); err != nil || n != spans {
+			t.Errorf("%s: NumSpans: got %d and err %v, want %d", step, n, err, spans)
+		}
+	}
+
+	check("empty", 0, 0)
+	mustCollect(t, s, appdash.SpanID{Trace: 1, Span: 1})
+	mustCollect(t, s, appdash.SpanID{Trace: 1, Span: 2, Parent: 1})
+	mustCollect(t, s, appdash.SpanID{Trace: 2, Span: 3, Parent: 1}) // before its root
+	check("collected", 2, 3)
+	mustCollect(t, s, appdash.SpanID{Trace: 1, Span: 2, Parent: 1}, appdash.Annotation{Key: "k", Value: []byte("v")})
+	mustCollect(t, s, appdash.SpanID{Trace: 2, Span: 1})
+	check("collected again", 2, 4)
+
+	ds, ok := s.(appdash.DeleteStore)
+	if !ok {
+		return
+	}
+	if err := ds.Delete(1, 3); err != nil {
+		t.Fatal(err)
+	}
+	check("deleted", 1, 2)
+	mustCollect(t, s, appdash.SpanID{Trace: 1, Span: 1})
+	check("collected after delete", 2, 3)
+	if err := ds.Delete(1, 2); err != nil {
+		t.Fatal(err)
+	}
+	check("all deleted", 0, 0)
+}
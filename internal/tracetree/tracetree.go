@@ -0,0 +1,106 @@
+// Package tracetree assembles trace trees from the flat lists of spans read
+// back from persistent stores.
+package tracetree
+
+import (
+	"sort"
+
+	"sourcegraph.com/sourcegraph/appdash"
+)
+
+// Build assembles the given spans, which must all belong to the same trace,
+// into a trace tree. Children are ordered by span ID.
+//
+// If the root span is missing (e.g. it has not been collected yet), the span
+// with the lowest ID among those whose parent is missing is used as a
+// temporary root. Spans whose parent is missing are attached to the (possibly
+// temporary) root, just as MemoryStore does. Build returns nil if spans is
+// empty.
+func Build(spans []appdash.Span) *appdash.Trace {
+	if len(spans) == 0 {
+		return nil
+	}
+
+	nodes := make(map[appdash.ID]*appdash.Trace, len(spans))
+	ordered := make([]*appdash.Trace, 0, len(spans))
+	for _, s := range spans {
+		if t, ok := nodes[s.ID.Span]; ok {
+			// Duplicate span; merge annotations.
+			t.Annotations = append(t.Annotations, s.Annotations...)
+			continue
+		}
+		t := &appdash.Trace{Span: s}
+		nodes[s.ID.Span] = t
+		ordered = append(ordered, t)
+	}
+	sort.Sort(bySpanID(ordered))
+
+	// Find the root, or a temporary root if the real one is missing.
+	var root *appdash.Trace
+	for _, t := range ordered {
+		if t.Span.ID.IsRoot() {
+			root = t
+			break
+		}
+	}
+	if root == nil {
+		for _, t := range ordered {
+			if _, ok := nodes[t.Span.ID.Parent]; !ok {
+				root = t
+				break
+			}
+		}
+	}
+	if root == nil {
+		// Every span has a parent, i.e. there is a cycle. Break it at the
+		// lowest span ID.
+		root = ordered[0]
+	}
+
+	for _, t := range ordered {
+		if t == root {
+			continue
+		}
+		parent, ok := nodes[t.Span.ID.Parent]
+		if !ok || parent == t || t.Span.ID.IsRoot() {
+			parent = root
+		}
+		parent.Sub = append(parent.Sub, t)
+	}
+
+	// Spans that are only reachable through a cycle are unreachable from
+	// the root; attach them to the root so they are not lost.
+	reachable := make(map[*appdash.Trace]bool, len(ordered))
+	var walk func(t *appdash.Trace)
+	walk = func(t *appdash.Trace) {
+		if reachable[t] {
+			return
+		}
+		reachable[t] = true
+		for _, sub := range t.Sub {
+			walk(sub)
+		}
+	}
+	walk(root)
+	for _, t := range ordered {
+		if !reachable[t] {
+			for _, p := range ordered {
+				for i, sub := range p.Sub {
+					if sub == t {
+						p.Sub = append(p.Sub[:i], p.Sub[i+1:]...)
+						break
+					}
+				}
+			}
+			root.Sub = append(root.Sub, t)
+			walk(t)
+		}
+	}
+	return root
+}
+
+type bySpanID []*appdash.Trace
+
+func (t bySpanID) Len() int           { return len(t) }
+func (t bySpanID) Less(i, j int) bool { return t[i].Span.ID.Span < t[j].Span.ID.Span }
+func (t bySpanID) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
@@ -10,6 +10,8 @@ It is generated from these files:
 
 It has these top-level messages:
 	CollectPacket
+	CollectBatch
+	CollectReply
 */
 package wire
 
@@ -25,9 +27,14 @@ var _ = math.Inf
 // CollectPacket is the message sent to a remote collector server by one of
 // it's clients.
 type CollectPacket struct {
-	Spanid           *CollectPacket_SpanID       `protobuf:"group,1,req,name=SpanID" json:"spanid,omitempty"`
-	Annotation       []*CollectPacket_Annotation `protobuf:"group,5,rep,name=Annotation" json:"annotation,omitempty"`
-	XXX_unrecognized []byte                      `json:"-"`
+	Spanid     *CollectPacket_SpanID       `protobuf:"group,1,req,name=SpanID" json:"spanid,omitempty"`
+	Annotation []*CollectPacket_Annotation `protobuf:"group,5,rep,name=Annotation" json:"annotation,omitempty"`
+	// Handshake is only set on the first packet sent over a connection (by
+	// clients that support version 1 or later of the protocol). A server
+	// replies to it with a CollectReply; clients whose first packet has no
+	// handshake use version 0 of the protocol, and are never replied to.
+	Handshake        *CollectPacket_Handshake `protobuf:"group,8,opt,name=Handshake" json:"handshake,omitempty"`
+	XXX_unrecognized []byte                   `json:"-"`
 }
 
 func (m *CollectPacket) Reset()         { *m = CollectPacket{} }
@@ -48,6 +55,13 @@ func (m *CollectPacket) GetAnnotation() []*CollectPacket_Annotation {
 	return nil
 }
 
+func (m *CollectPacket) GetHandshake() *CollectPacket_Handshake {
+	if m != nil {
+		return m.Handshake
+	}
+	return nil
+}
+
 // SpanID is the group of information which can uniquely identify the exact
 // span being collected.
 type CollectPacket_SpanID struct {
@@ -57,7 +71,14 @@ type CollectPacket_SpanID struct {
 	// span is an ID that probabilistically uniquely identifies this span.
 	Span *uint64 `protobuf:"fixed64,3,req,name=span" json:"span,omitempty"`
 	// parent is the ID of the parent span, if any.
-	Parent           *uint64 `protobuf:"fixed64,4,opt,name=parent" json:"parent,omitempty"`
+	Parent *uint64 `protobuf:"fixed64,4,opt,name=parent" json:"parent,omitempty"`
+	// trace_high is the high 64 bits of 128-bit trace IDs (since
+	// version 1.3 of the protocol). It is omitted for 64-bit trace IDs.
+	TraceHigh *uint64 `protobuf:"fixed64,15,opt,name=trace_high" json:"trace_high,omitempty"`
+	// flags are the flags of the trace, such as whether it is sampled
+	// (since version 1.4 of the protocol). They are omitted if none are
+	// set.
+	Flags            *uint32 `protobuf:"varint,16,opt,name=flags" json:"flags,omitempty"`
 	XXX_unrecognized []byte  `json:"-"`
 }
 
@@ -86,6 +107,20 @@ func (m *CollectPacket_SpanID) GetParent() uint64 {
 	return 0
 }
 
+func (m *CollectPacket_SpanID) GetTraceHigh() uint64 {
+	if m != nil && m.TraceHigh != nil {
+		return *m.TraceHigh
+	}
+	return 0
+}
+
+func (m *CollectPacket_SpanID) GetFlags() uint32 {
+	if m != nil && m.Flags != nil {
+		return *m.Flags
+	}
+	return 0
+}
+
 // Annotation is any number of annotations for the span to be collected.
 type CollectPacket_Annotation struct {
 	// key is the annotation's key.
@@ -114,3 +149,165 @@ func (m *CollectPacket_Annotation) GetValue() []byte {
 	}
 	return nil
 }
+
+// Handshake is only set on the first packet sent over a connection (by
+// clients that support version 1 or later of the protocol). A server
+// replies to it with a CollectReply; clients whose first packet has no
+// handshake use version 0 of the protocol, and are never replied to.
+type CollectPacket_Handshake struct {
+	// major and minor are the version of the protocol used by the
+	// client. Servers reject clients with a major version they don't
+	// support.
+	Major *uint32 `protobuf:"varint,9,req,name=major" json:"major,omitempty"`
+	Minor *uint32 `protobuf:"varint,10,opt,name=minor" json:"minor,omitempty"`
+	// compression is the list of compression algorithms supported by
+	// the client. If the server accepts one of them (see
+	// CollectReply), the client sends a zero-length frame, after which
+	// the rest of the connection is compressed.
+	Compression []string `protobuf:"bytes,11,rep,name=compression" json:"compression,omitempty"`
+	// token is the shared secret that authenticates the client, for
+	// servers that require one.
+	Token *string `protobuf:"bytes,12,opt,name=token" json:"token,omitempty"`
+	// batch is whether the client supports batch frames (since version
+	// 1.1 of the protocol). If the server accepts them (see
+	// CollectReply), the client sends a zero-length frame (the same
+	// one as for compression), after which every frame is a
+	// CollectBatch.
+	Batch *bool `protobuf:"varint,13,opt,name=batch" json:"batch,omitempty"`
+	// heartbeat is whether the client sends heartbeat frames (since
+	// version 1.2 of the protocol): zero-length frames, after the one
+	// that starts using the accepted options, that the server
+	// acknowledges by writing a zero-length frame back.
+	Heartbeat        *bool  `protobuf:"varint,14,opt,name=heartbeat" json:"heartbeat,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *CollectPacket_Handshake) Reset()         { *m = CollectPacket_Handshake{} }
+func (m *CollectPacket_Handshake) String() string { return proto.CompactTextString(m) }
+func (*CollectPacket_Handshake) ProtoMessage()    {}
+
+func (m *CollectPacket_Handshake) GetMajor() uint32 {
+	if m != nil && m.Major != nil {
+		return *m.Major
+	}
+	return 0
+}
+
+func (m *CollectPacket_Handshake) GetMinor() uint32 {
+	if m != nil && m.Minor != nil {
+		return *m.Minor
+	}
+	return 0
+}
+
+func (m *CollectPacket_Handshake) GetCompression() []string {
+	if m != nil {
+		return m.Compression
+	}
+	return nil
+}
+
+func (m *CollectPacket_Handshake) GetToken() string {
+	if m != nil && m.Token != nil {
+		return *m.Token
+	}
+	return ""
+}
+
+func (m *CollectPacket_Handshake) GetBatch() bool {
+	if m != nil && m.Batch != nil {
+		return *m.Batch
+	}
+	return false
+}
+
+func (m *CollectPacket_Handshake) GetHeartbeat() bool {
+	if m != nil && m.Heartbeat != nil {
+		return *m.Heartbeat
+	}
+	return false
+}
+
+// CollectBatch is a frame that carries many packets at once, sent instead of
+// single packets once the server has accepted batch frames.
+type CollectBatch struct {
+	Packet           []*CollectPacket `protobuf:"bytes,1,rep,name=packet" json:"packet,omitempty"`
+	XXX_unrecognized []byte           `json:"-"`
+}
+
+func (m *CollectBatch) Reset()         { *m = CollectBatch{} }
+func (m *CollectBatch) String() string { return proto.CompactTextString(m) }
+func (*CollectBatch) ProtoMessage()    {}
+
+func (m *CollectBatch) GetPacket() []*CollectPacket {
+	if m != nil {
+		return m.Packet
+	}
+	return nil
+}
+
+// CollectReply is the message sent by a collector server in reply to a
+// client's handshake.
+type CollectReply struct {
+	// major and minor are the version of the protocol used by the server.
+	Major *uint32 `protobuf:"varint,1,req,name=major" json:"major,omitempty"`
+	Minor *uint32 `protobuf:"varint,2,opt,name=minor" json:"minor,omitempty"`
+	// compression is the compression algorithm accepted by the server, if
+	// any.
+	Compression *string `protobuf:"bytes,3,opt,name=compression" json:"compression,omitempty"`
+	// error, if set, is the reason why the server rejected the client, after
+	// which it closes the connection.
+	Error *string `protobuf:"bytes,4,opt,name=error" json:"error,omitempty"`
+	// batch is whether the server accepts batch frames from the client.
+	Batch *bool `protobuf:"varint,5,opt,name=batch" json:"batch,omitempty"`
+	// heartbeat is whether the server accepts (and acknowledges) heartbeat
+	// frames from the client.
+	Heartbeat        *bool  `protobuf:"varint,6,opt,name=heartbeat" json:"heartbeat,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *CollectReply) Reset()         { *m = CollectReply{} }
+func (m *CollectReply) String() string { return proto.CompactTextString(m) }
+func (*CollectReply) ProtoMessage()    {}
+
+func (m *CollectReply) GetMajor() uint32 {
+	if m != nil && m.Major != nil {
+		return *m.Major
+	}
+	return 0
+}
+
+func (m *CollectReply) GetMinor() uint32 {
+	if m != nil && m.Minor != nil {
+		return *m.Minor
+	}
+	return 0
+}
+
+func (m *CollectReply) GetCompression() string {
+	if m != nil && m.Compression != nil {
+		return *m.Compression
+	}
+	return ""
+}
+
+func (m *CollectReply) GetError() string {
+	if m != nil && m.Error != nil {
+		return *m.Error
+	}
+	return ""
+}
+
+func (m *CollectReply) GetBatch() bool {
+	if m != nil && m.Batch != nil {
+		return *m.Batch
+	}
+	return false
+}
+
+func (m *CollectReply) GetHeartbeat() bool {
+	if m != nil && m.Heartbeat != nil {
+		return *m.Heartbeat
+	}
+	return false
+}
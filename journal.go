@@ -0,0 +1,677 @@
+package appdash
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// DefaultMaxJournalSize is the default journal size, in bytes, above which a
+// JournalStore starts a new journal and writes a fresh snapshot.
+const DefaultMaxJournalSize = 64 << 20
+
+// JournalOptions configures a JournalStore.
+type JournalOptions struct {
+	// MaxJournalSize is the size of the journal, in bytes, above which the
+	// store is compacted by starting a new, empty journal and writing a
+	// fresh snapshot in the background. If zero, DefaultMaxJournalSize is
+	// used.
+	MaxJournalSize int64
+
+	// Sync is whether to fsync the journal after every appended record. This
+	// protects against data loss on power failure (rather than just process
+	// crashes), at a significant cost in Collect latency.
+	Sync bool
+}
+
+// A JournalStore is a MemoryStore that is durably persisted to disk as a
+// snapshot file plus an append-only journal of the spans collected (and
+// traces deleted) since that snapshot was written. Unlike PersistEvery, it
+// does not need to rewrite the entire store to persist each new span.
+//
+// Journal records are length-prefixed and checksummed; a partially written
+// record at the end of the journal (e.g. after a crash mid-append) is
+// discarded when the store is opened.
+//
+// When the journal grows beyond MaxJournalSize, the store is compacted:
+// the journal is rotated to a new one (in snapshotFile + ".journal.next"),
+// and the snapshot of the store at that point is written in the
+// background, so that Collect doesn't wait for it. The old journal is only
+// replaced by the new one once the snapshot has been written, and both are
+// replayed if the store is opened before that.
+//
+// Evictions performed by the MemoryStore itself (see SetMaxAge and
+// SetMaxSpans) are not journaled; they are persisted by the next snapshot.
+type JournalStore struct {
+	*MemoryStore
+
+	snapshotFile, journalFile string
+	nextJournalFile           string // the journal rotated to by a compaction
+	opts                      JournalOptions
+
+	mu         sync.Mutex    // protects the fields below and serializes appends
+	epoch      uint64        // epoch of the current journal
+	journal    *os.File      // the current journal
+	size       int64         // size of the journal file
+	rotated    bool          // whether the current journal is nextJournalFile
+	compacting chan struct{} // closed once the snapshot being written in the background is done
+}
+
+var (
+	snapshotMagic = []byte("appdash-snapshot\n")
+	journalMagic  = []byte("appdash-journal\n")
+)
+
+const (
+	journalCollect byte = iota + 1
+	journalDelete
+)
+
+// OpenJournalStore loads the snapshot stored in snapshotFile (if it exists)
+// into ms, replays the journal stored alongside it (in snapshotFile +
+// ".journal") and returns a store that appends to the journal on every
+// Collect and Delete. A snapshotFile written by PersistEvery is loaded as
+// well. If opts is nil, default options are used.
+//
+// If the store was closed (or crashed) while it was being compacted, the
+// journal it was rotated to is replayed as well, and a fresh snapshot is
+// written before OpenJournalStore returns.
+func OpenJournalStore(ms *MemoryStore, snapshotFile string, opts *JournalOptions) (*JournalStore, error) {
+	js := &JournalStore{
+		MemoryStore:     ms,
+		snapshotFile:    snapshotFile,
+		journalFile:     snapshotFile + ".journal",
+		nextJournalFile: snapshotFile + ".journal.next",
+	}
+	if opts != nil {
+		js.opts = *opts
+	}
+	if js.opts.MaxJournalSize == 0 {
+		js.opts.MaxJournalSize = DefaultMaxJournalSize
+	}
+
+	if err := js.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	f, size, err := js.replayJournal(js.journalFile, js.epoch)
+	if err != nil {
+		return nil, err
+	}
+
+	// The next journal follows the snapshot if the snapshot of its
+	// compaction was written, and the journal otherwise.
+	nextEpoch := js.epoch
+	if f != nil {
+		nextEpoch = js.epoch + 1
+	}
+	next, _, err := js.replayJournal(js.nextJournalFile, js.epoch, nextEpoch)
+	if err != nil {
+		if f != nil {
+			f.Close()
+		}
+		return nil, err
+	}
+	if next != nil {
+		next.Close()
+		if f != nil {
+			f.Close()
+		}
+		js.epoch = nextEpoch
+		if err := js.snapshotNoLock(); err != nil {
+			return nil, err
+		}
+		return js, nil
+	}
+	if f == nil {
+		if err := js.resetJournal(); err != nil {
+			return nil, err
+		}
+		return js, nil
+	}
+	js.journal, js.size = f, size
+	if err := os.Remove(js.nextJournalFile); err != nil && !os.IsNotExist(err) {
+		js.journal.Close()
+		return nil, err
+	}
+	return js, nil
+}
+
+// loadSnapshot loads the snapshot file into the MemoryStore and records its
+// epoch.
+func (js *JournalStore) loadSnapshot() error {
+	f, err := os.Open(js.snapshotFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	if magic, err := r.Peek(len(snapshotMagic)); err == nil && bytes.Equal(magic, snapshotMagic) {
+		if _, err := r.Discard(len(snapshotMagic)); err != nil {
+			return err
+		}
+		if err := binary.Read(r, binary.BigEndian, &js.epoch); err != nil {
+			return fmt.Errorf("appdash: reading snapshot %s: %s", js.snapshotFile, err)
+		}
+	}
+	// Otherwise, it is a plain MemoryStore file as written by PersistEvery.
+	if _, err := js.MemoryStore.ReadFrom(r); err != nil {
+		return fmt.Errorf("appdash: reading snapshot %s: %s", js.snapshotFile, err)
+	}
+	return nil
+}
+
+// replayJournal applies the records of the journal file to the MemoryStore,
+// if it belongs to one of the given epochs, truncates any trailing partial
+// record and returns it open for appending, along with its size. It
+// returns a nil file if the journal doesn't exist or belongs to another
+// epoch (for example, if we crashed after writing a new snapshot but
+// before resetting the journal, so that its contents are already part of
+// the snapshot).
+func (js *JournalStore) replayJournal(name string, epochs ...uint64) (*os.File, int64, error) {
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	} else if err != nil {
+		return nil, 0, err
+	}
+
+	r := bufio.NewReader(f)
+	header := make([]byte, journalHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil || !bytes.Equal(header[:len(journalMagic)], journalMagic) {
+		// Empty or not a journal at all; start over.
+		f.Close()
+		return nil, 0, nil
+	}
+	epoch, current := binary.BigEndian.Uint64(header[len(journalMagic):]), false
+	for _, e := range epochs {
+		current = current || epoch == e
+	}
+	if !current {
+		f.Close()
+		return nil, 0, nil
+	}
+
+	offset := int64(len(header))
+	for {
+		rec, err := readJournalRecord(r)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			log.Printf("JournalStore: discarding journal %s after offset %d: %s", name, offset, err)
+			if err := f.Truncate(offset); err != nil {
+				f.Close()
+				return nil, 0, err
+			}
+			break
+		}
+		if err := js.apply(rec); err != nil {
+			f.Close()
+			return nil, 0, err
+		}
+		offset += int64(journalRecordHeaderSize + len(rec))
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, offset, nil
+}
+
+// journalHeaderSize is the size of the magic and epoch that start each
+// journal.
+var journalHeaderSize = len(journalMagic) + 8
+
+// createJournal atomically replaces the named file with an empty journal
+// for the epoch, and returns it open for appending.
+func createJournal(name string, epoch uint64) (*os.File, error) {
+	tmp, err := ioutil.TempFile(filepath.Dir(name), "appdash-journal")
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, journalHeaderSize)
+	copy(header, journalMagic)
+	binary.BigEndian.PutUint64(header[len(journalMagic):], epoch)
+	if _, err := tmp.Write(header); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	return tmp, nil
+}
+
+// resetJournal atomically replaces the journal with an empty one for the
+// current epoch, opens it for appending, and removes the next journal of
+// an unfinished compaction, if any.
+func (js *JournalStore) resetJournal() error {
+	if js.journal != nil {
+		js.journal.Close()
+		js.journal = nil
+	}
+
+	f, err := createJournal(js.journalFile, js.epoch)
+	if err != nil {
+		return err
+	}
+	js.journal, js.size, js.rotated = f, int64(journalHeaderSize), false
+	if err := os.Remove(js.nextJournalFile); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// apply applies a single journal record to the MemoryStore.
+func (js *JournalStore) apply(rec []byte) error {
+	if len(rec) == 0 {
+		return errors.New("appdash: empty journal record")
+	}
+	switch kind, r := rec[0], bytes.NewReader(rec[1:]); kind {
+	case journalCollect:
+		id, as, err := decodeJournalCollect(r)
+		if err != nil {
+			return err
+		}
+		return js.MemoryStore.Collect(id, as...)
+	case journalDelete:
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return err
+		}
+		if n > uint64(r.Len()/8) {
+			return errors.New("appdash: invalid journal trace count")
+		}
+		ids := make([]ID, n)
+		if err := binary.Read(r, binary.BigEndian, ids); err != nil {
+			return err
+		}
+		return js.MemoryStore.Delete(ids...)
+	default:
+		return fmt.Errorf("appdash: unknown journal record kind %d", kind)
+	}
+}
+
+// Collect implements the Collector interface by appending the span to the
+// journal and then collecting it in memory.
+func (js *JournalStore) Collect(id SpanID, as ...Annotation) error {
+	var buf bytes.Buffer
+	buf.WriteByte(journalCollect)
+	encodeJournalCollect(&buf, id, as)
+
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	if err := js.appendNoLock(buf.Bytes()); err != nil {
+		return err
+	}
+	return js.MemoryStore.Collect(id, as...)
+}
+
+// Delete implements the DeleteStore interface by appending the deletion to
+// the journal and then deleting the traces from memory.
+func (js *JournalStore) Delete(traces ...ID) error {
+	_, err := js.DeleteTraces(traces...)
+	return err
+}
+
+// DeleteTraces implements the BatchDeleteStore interface like Delete (so
+// that the traces evicted by a RecentStore stay deleted after a restart),
+// and returns the number of traces deleted.
+func (js *JournalStore) DeleteTraces(traces ...ID) (deleted int, err error) {
+	var buf bytes.Buffer
+	buf.WriteByte(journalDelete)
+	writeUvarint(&buf, uint64(len(traces)))
+	binary.Write(&buf, binary.BigEndian, traces)
+
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	if err := js.appendNoLock(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return js.MemoryStore.DeleteTraces(traces...)
+}
+
+// ImportJSON is like MemoryStore.ImportJSON, but it appends the imported
+// spans to the journal, as if they were collected with Collect.
+func (js *JournalStore) ImportJSON(r io.Reader) error {
+	return importJSON(js, r)
+}
+
+// ReadFrom is like MemoryStore.ReadFrom: it replaces the contents of the
+// store with the data read from r. The journal can't record that, so it
+// then writes a fresh snapshot and starts a new journal (see Snapshot).
+func (js *JournalStore) ReadFrom(r io.Reader) (int64, error) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	js.waitNoLock()
+	if js.journal == nil {
+		return 0, errors.New("appdash: JournalStore is closed")
+	}
+	n, err := js.MemoryStore.ReadFrom(r)
+	if err != nil {
+		return n, err
+	}
+	return n, js.snapshotNoLock()
+}
+
+// Compile-time "implements" check.
+var _ interface {
+	BatchDeleteStore
+	PersistentStore
+} = (*JournalStore)(nil)
+
+// appendNoLock appends a record to the journal, compacting it first if it
+// has grown beyond the maximum size. The js.mu lock must be held.
+func (js *JournalStore) appendNoLock(rec []byte) error {
+	if js.journal == nil {
+		return errors.New("appdash: JournalStore is closed")
+	}
+	if js.size >= js.opts.MaxJournalSize && js.compacting == nil {
+		compact := js.rotateNoLock
+		if js.rotated {
+			// The last compaction failed, and its journals are still
+			// needed: write the snapshot before starting another one.
+			compact = js.snapshotNoLock
+		}
+		if err := compact(); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(journalRecordHeaderSize + len(rec))
+	writeJournalRecord(&buf, rec)
+	n, err := js.journal.Write(buf.Bytes())
+	js.size += int64(n)
+	if err != nil {
+		return err
+	}
+	if js.opts.Sync {
+		return js.journal.Sync()
+	}
+	return nil
+}
+
+// rotateNoLock starts the next journal, with the next epoch, and writes
+// the snapshot of the store as of the end of the current journal in the
+// background (see compact). The js.mu lock must be held.
+func (js *JournalStore) rotateNoLock() error {
+	epoch := js.epoch + 1
+	next, err := createJournal(js.nextJournalFile, epoch)
+	if err != nil {
+		return err
+	}
+	// Copy the traces now, since the spans collected from here on are
+	// appended to the next journal.
+	traces := js.MemoryStore.copyTraces()
+	js.journal.Close()
+	js.journal, js.size, js.epoch, js.rotated = next, int64(journalHeaderSize), epoch, true
+
+	done := make(chan struct{})
+	js.compacting = done
+	go js.compact(traces, epoch, done)
+	return nil
+}
+
+// compact writes the snapshot of the traces for the epoch, and then
+// replaces the journal with the next one, which follows it. If the
+// snapshot can't be written, both journals are kept, so that the store can
+// still be opened, and the next compaction writes the snapshot before
+// rotating the journal again.
+func (js *JournalStore) compact(traces []*Trace, epoch uint64, done chan struct{}) {
+	err := js.writeSnapshot(epoch, func(f func(*Trace) error) error {
+		for _, t := range traces {
+			if err := f(t); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	if err == nil {
+		err = os.Rename(js.nextJournalFile, js.journalFile)
+	}
+	if err != nil {
+		log.Printf("JournalStore: compacting %s: %s", js.snapshotFile, err)
+	} else {
+		js.rotated = false
+	}
+	js.compacting = nil
+	close(done)
+}
+
+// waitNoLock waits for the snapshot being written in the background (if
+// any) to be done. The js.mu lock must be held, and is released while
+// waiting.
+func (js *JournalStore) waitNoLock() {
+	for js.compacting != nil {
+		done := js.compacting
+		js.mu.Unlock()
+		<-done
+		js.mu.Lock()
+	}
+}
+
+// Snapshot writes a fresh snapshot of the store and starts a new, empty
+// journal. It waits for the snapshot being written in the background by
+// a compaction, if any.
+func (js *JournalStore) Snapshot() error {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	js.waitNoLock()
+	return js.snapshotNoLock()
+}
+
+// snapshotNoLock is the same as Snapshot, but it doesn't grab the lock or
+// wait for a compaction. Its epoch follows that of the current journal,
+// so that all of the journals are older than the snapshot.
+func (js *JournalStore) snapshotNoLock() error {
+	epoch := js.epoch + 1
+	if err := js.writeSnapshot(epoch, js.MemoryStore.ForEachTrace); err != nil {
+		return err
+	}
+
+	// The new snapshot contains everything in the old journals, so a
+	// crash from here on is safe: their epochs no longer match.
+	js.epoch = epoch
+	return js.resetJournal()
+}
+
+// writeSnapshot atomically replaces the snapshot file with the traces
+// iterated over by forEach (see TraceIterator), for the epoch.
+func (js *JournalStore) writeSnapshot(epoch uint64, forEach func(func(*Trace) error) error) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(js.snapshotFile), "appdash-snapshot")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	w.Write(snapshotMagic)
+	binary.Write(w, binary.BigEndian, epoch)
+	if _, err := js.MemoryStore.writeTraces(w, forEach); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), js.snapshotFile)
+}
+
+// Close closes the journal, once the snapshot being written in the
+// background (if any) is done, and stops the eviction sweeper of the
+// MemoryStore (see MemoryStore.Close). The store must not be written to
+// afterwards.
+func (js *JournalStore) Close() error {
+	js.MemoryStore.Close()
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	js.waitNoLock()
+	if js.journal == nil {
+		return nil
+	}
+	err := js.journal.Close()
+	js.journal = nil
+	return err
+}
+
+// journalRecordHeaderSize is the size of the length and CRC-32 checksum that
+// precede each journal record.
+const journalRecordHeaderSize = 8
+
+// maxJournalRecordSize bounds the size of a single journal record, so that a
+// corrupted length prefix doesn't cause a huge allocation.
+const maxJournalRecordSize = 64 << 20
+
+// writeJournalRecord writes rec to buf, preceded by its length and
+// checksum.
+func writeJournalRecord(buf *bytes.Buffer, rec []byte) {
+	var header [journalRecordHeaderSize]byte
+	binary.BigEndian.PutUint32(header[0:4], uint32(len(rec)))
+	binary.BigEndian.PutUint32(header[4:8], crc32.ChecksumIEEE(rec))
+	buf.Write(header[:])
+	buf.Write(rec)
+}
+
+// readJournalRecord reads a single record from the journal. It returns
+// io.EOF only if there are no more records; a partial or corrupted record
+// results in a different error.
+func readJournalRecord(r io.Reader) ([]byte, error) {
+	var header [journalRecordHeaderSize]byte
+	if n, err := io.ReadFull(r, header[:]); err == io.EOF {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, fmt.Errorf("partial record header (%d bytes)", n)
+	}
+	size := binary.BigEndian.Uint32(header[0:4])
+	if size > maxJournalRecordSize {
+		return nil, fmt.Errorf("record size %d too large", size)
+	}
+	rec := make([]byte, size)
+	if n, err := io.ReadFull(r, rec); err != nil {
+		return nil, fmt.Errorf("partial record (%d of %d bytes)", n, size)
+	}
+	if sum := crc32.ChecksumIEEE(rec); sum != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, errors.New("record checksum mismatch")
+	}
+	return rec, nil
+}
+
+// encodeJournalCollect encodes a collected span: its trace, span and
+// parent IDs, its annotations, and then the high bits of its trace ID
+// (see SpanID.TraceHigh) and its flags, only if they are set (the high
+// bits, possibly zero, if only the flags are). The records of the spans
+// with 64-bit trace IDs and no flags are thus the same as before TraceHigh
+// and Flags were added, and decodeJournalCollect tells them apart by their
+// length.
+func encodeJournalCollect(buf *bytes.Buffer, id SpanID, as Annotations) {
+	binary.Write(buf, binary.BigEndian, [3]uint64{uint64(id.Trace), uint64(id.Span), uint64(id.Parent)})
+	writeUvarint(buf, uint64(len(as)))
+	for _, a := range as {
+		writeUvarint(buf, uint64(len(a.Key)))
+		buf.WriteString(a.Key)
+		writeUvarint(buf, uint64(len(a.Value)))
+		buf.Write(a.Value)
+	}
+	if id.TraceHigh != 0 || id.Flags != 0 {
+		binary.Write(buf, binary.BigEndian, uint64(id.TraceHigh))
+	}
+	if id.Flags != 0 {
+		buf.WriteByte(byte(id.Flags))
+	}
+}
+
+func decodeJournalCollect(r *bytes.Reader) (SpanID, Annotations, error) {
+	var ids [3]uint64
+	if err := binary.Read(r, binary.BigEndian, &ids); err != nil {
+		return SpanID{}, nil, err
+	}
+	id := SpanID{Trace: ID(ids[0]), Span: ID(ids[1]), Parent: ID(ids[2])}
+
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return SpanID{}, nil, err
+	}
+	if n > uint64(r.Len()) {
+		return SpanID{}, nil, errors.New("appdash: invalid journal annotation count")
+	}
+	var as Annotations
+	if n > 0 {
+		as = make(Annotations, n)
+	}
+	for i := range as {
+		key, err := readJournalBytes(r)
+		if err != nil {
+			return SpanID{}, nil, err
+		}
+		value, err := readJournalBytes(r)
+		if err != nil {
+			return SpanID{}, nil, err
+		}
+		as[i] = Annotation{Key: string(key), Value: value}
+	}
+	if r.Len() >= 8 {
+		var high uint64
+		if err := binary.Read(r, binary.BigEndian, &high); err != nil {
+			return SpanID{}, nil, err
+		}
+		id.TraceHigh = ID(high)
+	}
+	if r.Len() >= 1 {
+		flags, _ := r.ReadByte()
+		id.Flags = SpanFlags(flags)
+	}
+	return id, as, nil
+}
+
+// readJournalBytes reads a uvarint length-prefixed byte slice. A zero length
+// yields a nil slice, matching how annotations without values are collected.
+func readJournalBytes(r *bytes.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(r.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+	return b, err
+}
+
+func writeUvarint(buf *bytes.Buffer, v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
@@ -0,0 +1,294 @@
+package appdash
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func openJournalStoreT(t *testing.T, file string, opts *JournalOptions) (*JournalStore, storeT) {
+	js, err := OpenJournalStore(NewMemoryStore(), file, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return js, storeT{t, js}
+}
+
+func TestJournalStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "appdash-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "store")
+
+	js, s := openJournalStoreT(t, file, nil)
+	s.MustCollect(SpanID{Trace: 1, Span: 1, Parent: 0}, Annotation{Key: "k1", Value: []byte("v1")})
+	s.MustCollect(SpanID{Trace: 1, Span: 2, Parent: 1}, Annotation{Key: "k2"})
+	s.MustCollect(SpanID{Trace: 2, Span: 1, Parent: 0})
+	if err := js.Delete(2); err != nil {
+		t.Fatal(err)
+	}
+	want1 := s.MustTrace(1)
+	if err := js.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopening replays the journal.
+	js, s = openJournalStoreT(t, file, nil)
+	if x := s.MustTrace(1); !reflect.DeepEqual(x, want1) {
+		t.Errorf("Trace(1): got trace %+v, want %+v", x, want1)
+	}
+	if x, err := js.Trace(2); err != ErrTraceNotFound {
+		t.Errorf("Trace(2): got trace %+v and err %#v, want ErrTraceNotFound", x, err)
+	}
+
+	// Reopening after a snapshot must not apply the journal twice.
+	if err := js.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	s.MustCollect(SpanID{Trace: 3, Span: 1, Parent: 0})
+	js.Close()
+	js, s = openJournalStoreT(t, file, nil)
+	if x := s.MustTrace(1); !reflect.DeepEqual(x, want1) {
+		t.Errorf("Trace(1): got trace %+v, want %+v", x, want1)
+	}
+	s.MustTrace(3)
+	js.Close()
+}
+
+func TestJournalStore_partialRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "appdash-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "store")
+
+	js, s := openJournalStoreT(t, file, nil)
+	s.MustCollect(SpanID{Trace: 1, Span: 1, Parent: 0})
+	s.MustCollect(SpanID{Trace: 2, Span: 1, Parent: 0}, Annotation{Key: "k", Value: []byte("v")})
+	js.Close()
+
+	// Simulate a crash in the middle of appending the last record.
+	fi, err := os.Stat(js.journalFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(js.journalFile, fi.Size()-3); err != nil {
+		t.Fatal(err)
+	}
+
+	js, s = openJournalStoreT(t, file, nil)
+	s.MustTrace(1)
+	if x, err := js.Trace(2); err != ErrTraceNotFound {
+		t.Errorf("Trace(2): got trace %+v and err %#v, want ErrTraceNotFound", x, err)
+	}
+
+	// New records are appended after the last complete record.
+	s.MustCollect(SpanID{Trace: 3, Span: 1, Parent: 0})
+	js.Close()
+	js, s = openJournalStoreT(t, file, nil)
+	s.MustTrace(1)
+	s.MustTrace(3)
+	js.Close()
+}
+
+func TestJournalStore_compaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "appdash-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "store")
+
+	js, s := openJournalStoreT(t, file, &JournalOptions{MaxJournalSize: 256})
+	for i := ID(1); i <= 50; i++ {
+		s.MustCollect(SpanID{Trace: 1, Span: i, Parent: 0}, Annotation{Key: "k", Value: []byte("v")})
+	}
+	want := s.MustTrace(1)
+	js.Close()
+	if js.epoch == 0 {
+		t.Error("journal was never compacted into a snapshot")
+	}
+	if _, err := os.Stat(js.nextJournalFile); !os.IsNotExist(err) {
+		t.Errorf("got next journal after compaction (err %v)", err)
+	}
+
+	js, s = openJournalStoreT(t, file, nil)
+	if x := s.MustTrace(1); !reflect.DeepEqual(x, want) {
+		t.Errorf("Trace(1): got trace %+v, want %+v", x, want)
+	}
+	js.Close()
+}
+
+func TestJournalStore_interruptedCompaction(t *testing.T) {
+	for _, snapshotWritten := range []bool{false, true} {
+		dir, err := ioutil.TempDir("", "appdash-journal")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		file := filepath.Join(dir, "store")
+
+		js, s := openJournalStoreT(t, file, nil)
+		s.MustCollect(SpanID{Trace: 1, Span: 1}, Annotation{Key: "k", Value: []byte("v")})
+		journal, err := ioutil.ReadFile(js.journalFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		js.mu.Lock()
+		if err := js.rotateNoLock(); err != nil {
+			t.Fatal(err)
+		}
+		js.waitNoLock()
+		js.mu.Unlock()
+		s.MustCollect(SpanID{Trace: 1, Span: 2, Parent: 1}, Annotation{Key: "k2"})
+		s.MustCollect(SpanID{Trace: 2, Span: 1})
+		want1, want2 := s.MustTrace(1), s.MustTrace(2)
+		js.Close()
+
+		// Simulate a crash before the old journal was replaced by the
+		// next one, and possibly before the snapshot was written.
+		if err := os.Rename(js.journalFile, js.nextJournalFile); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(js.journalFile, journal, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if !snapshotWritten {
+			if err := os.Remove(js.snapshotFile); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Both journals are replayed, once.
+		js, s = openJournalStoreT(t, file, nil)
+		if x := s.MustTrace(1); !reflect.DeepEqual(x, want1) {
+			t.Errorf("snapshot written %v: Trace(1): got trace %+v, want %+v", snapshotWritten, x, want1)
+		}
+		if x := s.MustTrace(2); !reflect.DeepEqual(x, want2) {
+			t.Errorf("snapshot written %v: Trace(2): got trace %+v, want %+v", snapshotWritten, x, want2)
+		}
+		if _, err := os.Stat(js.nextJournalFile); !os.IsNotExist(err) {
+			t.Errorf("snapshot written %v: got next journal after reopening (err %v)", snapshotWritten, err)
+		}
+		js.Close()
+	}
+}
+
+func TestJournalStore_recentStoreEviction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "appdash-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "store")
+
+	const age = 10 * time.Millisecond
+	js, _ := openJournalStoreT(t, file, nil)
+	evicted := make(chan []ID, 1)
+	rs := storeT{t, &RecentStore{
+		DeleteStore: js,
+		MinEvictAge: age,
+		OnEvict:     func(ids []ID, _ []*Trace) { evicted <- ids },
+	}}
+	rs.MustCollect(SpanID{Trace: 1, Span: 1})
+	time.Sleep(2 * age)
+	rs.MustCollect(SpanID{Trace: 2, Span: 1}) // evicts trace 1
+	select {
+	case ids := <-evicted:
+		if !reflect.DeepEqual(ids, []ID{1}) {
+			t.Fatalf("got evicted traces %v, want [1]", ids)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("trace 1 wasn't evicted")
+	}
+	js.Close()
+
+	// The eviction (with DeleteTraces) was journaled.
+	js, s := openJournalStoreT(t, file, nil)
+	defer js.Close()
+	if x, err := js.Trace(1); err != ErrTraceNotFound {
+		t.Errorf("Trace(1): got trace %+v and err %#v, want ErrTraceNotFound", x, err)
+	}
+	s.MustTrace(2)
+}
+
+func TestJournalStore_importAndReadFrom(t *testing.T) {
+	dir, err := ioutil.TempDir("", "appdash-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "store")
+
+	ms := NewMemoryStore()
+	storeT{t, ms}.MustCollect(SpanID{Trace: 1, Span: 1}, Annotation{Key: "k", Value: []byte("v")})
+	var exported, persisted bytes.Buffer
+	if err := ms.ExportJSON(&exported); err != nil {
+		t.Fatal(err)
+	}
+	storeT{t, ms}.MustCollect(SpanID{Trace: 2, Span: 1})
+	if err := ms.Write(&persisted); err != nil {
+		t.Fatal(err)
+	}
+
+	js, s := openJournalStoreT(t, file, nil)
+	if err := js.ImportJSON(&exported); err != nil {
+		t.Fatal(err)
+	}
+	js.Close()
+	js, s = openJournalStoreT(t, file, nil)
+	want1 := s.MustTrace(1)
+	if err := js.Delete(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := js.ReadFrom(&persisted); err != nil {
+		t.Fatal(err)
+	}
+	js.Close()
+
+	// ReadFrom replaced the store, including the deleted trace 1.
+	js, s = openJournalStoreT(t, file, nil)
+	defer js.Close()
+	if x := s.MustTrace(1); !reflect.DeepEqual(x, want1) {
+		t.Errorf("Trace(1): got trace %+v, want %+v", x, want1)
+	}
+	s.MustTrace(2)
+}
+
+func TestJournalCollect_roundTrip(t *testing.T) {
+	as := Annotations{{Key: "k", Value: []byte("v")}, {Key: "k2"}}
+	for _, id := range []SpanID{
+		{Trace: 1, Span: 2, Parent: 3},
+		{Trace: 1, TraceHigh: 4, Span: 2, Parent: 3},
+		{Trace: 1, Span: 2, Parent: 3, Flags: FlagSampled | FlagSamplingDecided},
+		{Trace: 1, TraceHigh: 4, Span: 2, Parent: 3, Flags: FlagSamplingDecided},
+	} {
+		var buf bytes.Buffer
+		encodeJournalCollect(&buf, id, as)
+		gotID, gotAs, err := decodeJournalCollect(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gotID != id || !reflect.DeepEqual(gotAs, as) {
+			t.Errorf("got span %v with annotations %v, want %v with %v", gotID, gotAs, id, as)
+		}
+	}
+
+	// The records of 64-bit trace IDs without flags are encoded as before
+	// TraceHigh and Flags.
+	var buf, old bytes.Buffer
+	encodeJournalCollect(&buf, SpanID{Trace: 1, Span: 2, Parent: 3}, as)
+	binary.Write(&old, binary.BigEndian, [3]uint64{1, 2, 3})
+	old.Write([]byte{2, 1, 'k', 1, 'v', 2, 'k', '2', 0})
+	if !bytes.Equal(buf.Bytes(), old.Bytes()) {
+		t.Errorf("got record %q, want %q", buf.Bytes(), old.Bytes())
+	}
+}
@@ -0,0 +1,241 @@
+// Package kafkacollector provides a collector that publishes spans to a
+// Kafka topic, and a consumer that reads them from the topic into a store.
+// The topic acts as a durable queue between the applications that record
+// spans and the store, so that spans are not dropped while the store is
+// unavailable.
+//
+// On the producer side:
+//
+//	producer, err := sarama.NewSyncProducer(brokers, kafkacollector.NewConfig())
+//	if err != nil {
+//		// handle error
+//	}
+//	collector := kafkacollector.NewCollector(producer, "appdash")
+//
+// On the consumer side:
+//
+//	group, err := sarama.NewConsumerGroup(brokers, "appdash", kafkacollector.NewConfig())
+//	if err != nil {
+//		// handle error
+//	}
+//	consumer := kafkacollector.NewConsumer(group, "appdash", store)
+//	go consumer.Run(ctx)
+package kafkacollector
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/gogo/protobuf/proto"
+
+	"sourcegraph.com/sourcegraph/appdash"
+	"sourcegraph.com/sourcegraph/appdash/internal/packet"
+	"sourcegraph.com/sourcegraph/appdash/internal/wire"
+)
+
+const (
+	// DefaultMinBackoff is the default delay before a Consumer retries
+	// to add a span to its collector.
+	DefaultMinBackoff = 100 * time.Millisecond
+
+	// DefaultMaxBackoff is the default maximum delay between the retries
+	// of a Consumer.
+	DefaultMaxBackoff = 30 * time.Second
+)
+
+// NewConfig returns a sarama configuration for the producers of Collectors
+// and the consumer groups of Consumers. Producers wait for all in-sync
+// replicas to acknowledge each span, and hash the message keys so that the
+// spans of a trace go to the same partition. Consumer groups that have no
+// committed offsets start at the oldest span in the topic.
+func NewConfig() *sarama.Config {
+	config := sarama.NewConfig()
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Return.Successes = true // required by sarama.SyncProducer
+	config.Producer.Partitioner = sarama.NewHashPartitioner
+	config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	return config
+}
+
+// NewCollector creates a collector that publishes data to a Kafka topic
+// with producer.
+func NewCollector(producer sarama.SyncProducer, topic string) *Collector {
+	return &Collector{producer: producer, topic: topic}
+}
+
+// A Collector publishes each collection to a Kafka topic, as a message
+// whose value is a CollectPacket (without the length prefix of the TCP
+// protocol) and whose key is the trace ID. With a hash partitioner (see
+// NewConfig), the spans of a trace are kept in order within a partition.
+//
+// Collect returns once the message is acknowledged by the brokers (as
+// configured by the producer). To publish data in chunks, use an
+// appdash.ChunkedCollector.
+type Collector struct {
+	producer sarama.SyncProducer
+	topic    string
+}
+
+// Collect implements the appdash.Collector interface by publishing the
+// events that occured in the span to the topic.
+func (c *Collector) Collect(span appdash.SpanID, anns ...appdash.Annotation) error {
+	data, err := proto.Marshal(packet.New(span, anns))
+	if err != nil {
+		return err
+	}
+	_, _, err = c.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: c.topic,
+		Key:   sarama.StringEncoder(span.Trace.String()),
+		Value: sarama.ByteEncoder(data),
+	})
+	return err
+}
+
+// NewConsumer creates a consumer that reads the data published by
+// Collectors to a Kafka topic, as a member of group, and adds it to the
+// collector c (typically an appdash.Store).
+//
+// Call the Consumer's Run method to start consuming.
+func NewConsumer(group sarama.ConsumerGroup, topic string, c appdash.Collector) *Consumer {
+	return &Consumer{group: group, topic: topic, c: c}
+}
+
+// A Consumer reads spans from a Kafka topic and adds them to a local
+// collector, with at-least-once delivery: the offset of a message is only
+// committed once the collector accepted its span. Collect errors (e.g. a
+// store outage) are retried with exponential backoff, and stall the
+// partition until they succeed. Since collecting the same annotations of a
+// span twice is harmless for the appdash stores, the messages redelivered
+// after a rebalance or a restart are collected again.
+//
+// Messages that can't be decoded are counted (see Rejected) and skipped.
+type Consumer struct {
+	group sarama.ConsumerGroup
+	topic string
+	c     appdash.Collector
+
+	// MinBackoff is the delay before the first retry of a failed Collect
+	// call. It doubles after each retry, up to MaxBackoff.
+	//
+	// Default MinBackoff = DefaultMinBackoff.
+	MinBackoff time.Duration
+
+	// MaxBackoff is the maximum delay between the retries of a failed
+	// Collect call.
+	//
+	// Default MaxBackoff = DefaultMaxBackoff.
+	MaxBackoff time.Duration
+
+	// Log is the logger to use for errors and warnings. If nil, a new
+	// logger is created.
+	Log   *log.Logger
+	logMu sync.Mutex
+
+	// Debug is whether to log debug messages.
+	Debug bool
+
+	rejected uint64 // number of rejected messages (accessed atomically)
+}
+
+// Run consumes the topic until ctx is done, in which case it returns
+// ctx.Err(), or until the consumer group fails (e.g. because it was
+// closed). The consumer group is not closed.
+func (c *Consumer) Run(ctx context.Context) error {
+	for {
+		// Consume returns at every rebalance of the group.
+		if err := c.group.Consume(ctx, []string{c.topic}, consumerHandler{c}); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// Rejected returns the number of messages that the consumer skipped
+// because they could not be decoded.
+func (c *Consumer) Rejected() uint64 {
+	return atomic.LoadUint64(&c.rejected)
+}
+
+// collect adds the span to the collector, retrying until it succeeds or
+// ctx is done.
+func (c *Consumer) collect(ctx context.Context, span appdash.SpanID, anns appdash.Annotations) error {
+	backoff := c.MinBackoff
+	if backoff <= 0 {
+		backoff = DefaultMinBackoff
+	}
+	maxBackoff := c.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultMaxBackoff
+	}
+	for {
+		err := c.c.Collect(span, anns...)
+		if err == nil {
+			return nil
+		}
+		c.log().Printf("Collect %v: %s (retrying in %s)", span, err, backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+func (c *Consumer) log() *log.Logger {
+	c.logMu.Lock()
+	defer c.logMu.Unlock()
+	if c.Log == nil {
+		c.Log = log.New(os.Stderr, "kafkacollector.Consumer: ", log.LstdFlags|log.Lmicroseconds)
+	}
+	return c.Log
+}
+
+// consumerHandler implements sarama.ConsumerGroupHandler for a Consumer.
+type consumerHandler struct {
+	*Consumer
+}
+
+// Setup implements sarama.ConsumerGroupHandler.
+func (h consumerHandler) Setup(sarama.ConsumerGroupSession) error { return nil }
+
+// Cleanup implements sarama.ConsumerGroupHandler.
+func (h consumerHandler) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+// ConsumeClaim implements sarama.ConsumerGroupHandler. A message is only
+// marked (and so committed) once its span was collected; if the session
+// ends first, the message is redelivered to the next owner of the
+// partition.
+func (h consumerHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for msg := range claim.Messages() {
+		p := &wire.CollectPacket{}
+		if err := proto.Unmarshal(msg.Value, p); err != nil {
+			atomic.AddUint64(&h.rejected, 1)
+			h.log().Printf("Partition %d: rejected message at offset %d: %s", msg.Partition, msg.Offset, err)
+			sess.MarkMessage(msg, "")
+			continue
+		}
+
+		span := packet.SpanID(p)
+		if h.Debug {
+			h.log().Printf("Partition %d: received span %v with %d annotations at offset %d", msg.Partition, span, len(p.Annotation), msg.Offset)
+		}
+		if err := h.collect(sess.Context(), span, packet.Annotations(p)); err != nil {
+			return err
+		}
+		sess.MarkMessage(msg, "")
+	}
+	return nil
+}
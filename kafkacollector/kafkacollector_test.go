@@ -0,0 +1,282 @@
+package kafkacollector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+
+	"sourcegraph.com/sourcegraph/appdash"
+)
+
+// fakeProducer records the messages sent to it.
+type fakeProducer struct {
+	sarama.SyncProducer
+	msgs []*sarama.ProducerMessage
+}
+
+func (p *fakeProducer) SendMessage(msg *sarama.ProducerMessage) (int32, int64, error) {
+	p.msgs = append(p.msgs, msg)
+	return 0, int64(len(p.msgs) - 1), nil
+}
+
+// fakeSession records the offsets of the messages marked in it.
+type fakeSession struct {
+	sarama.ConsumerGroupSession
+	ctx context.Context
+
+	mu     sync.Mutex
+	marked []int64
+}
+
+func (s *fakeSession) Context() context.Context { return s.ctx }
+
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.marked = append(s.marked, msg.Offset)
+}
+
+func (s *fakeSession) markedOffsets() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int64(nil), s.marked...)
+}
+
+// fakeClaim delivers the given messages.
+type fakeClaim struct {
+	sarama.ConsumerGroupClaim
+	msgs chan *sarama.ConsumerMessage
+}
+
+func newFakeClaim(msgs ...*sarama.ConsumerMessage) *fakeClaim {
+	c := &fakeClaim{msgs: make(chan *sarama.ConsumerMessage, len(msgs))}
+	for _, msg := range msgs {
+		c.msgs <- msg
+	}
+	close(c.msgs)
+	return c
+}
+
+func (c *fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return c.msgs }
+
+// consumerMessages converts the messages sent to a producer to the
+// messages that a consumer would receive.
+func consumerMessages(t *testing.T, msgs []*sarama.ProducerMessage) []*sarama.ConsumerMessage {
+	var cms []*sarama.ConsumerMessage
+	for i, msg := range msgs {
+		key, err := msg.Key.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, err := msg.Value.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cms = append(cms, &sarama.ConsumerMessage{Topic: msg.Topic, Key: key, Value: value, Offset: int64(i)})
+	}
+	return cms
+}
+
+func newTestConsumer(c appdash.Collector) *Consumer {
+	consumer := NewConsumer(nil, "spans", c)
+	consumer.MinBackoff = time.Millisecond
+	consumer.Log = log.New(ioutil.Discard, "", 0)
+	return consumer
+}
+
+func TestCollector(t *testing.T) {
+	producer := &fakeProducer{}
+	c := NewCollector(producer, "spans")
+	want := map[appdash.SpanID]appdash.Annotations{
+		{Trace: 1, Span: 2, Parent: 0}: {{Key: "k", Value: []byte("v")}, {Key: "empty"}},
+		{Trace: 1, Span: 3, Parent: 2}: {{Key: "k", Value: []byte("v2")}},
+		{Trace: 4, Span: 5, Parent: 0}: {{Key: "k", Value: []byte("v3")}},
+	}
+	for span, anns := range want {
+		if err := c.Collect(span, anns...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msgs := consumerMessages(t, producer.msgs)
+	for i, msg := range msgs {
+		if msg.Topic != "spans" {
+			t.Errorf("message %d: got topic %q, want %q", i, msg.Topic, "spans")
+		}
+		var trace appdash.ID
+		if _, err := fmt.Sscanf(string(msg.Key), "%x", &trace); err != nil || (trace != 1 && trace != 4) {
+			t.Errorf("message %d: got key %q, want a trace ID", i, msg.Key)
+		}
+	}
+
+	store := appdash.NewMemoryStore()
+	sess := &fakeSession{ctx: context.Background()}
+	if err := (consumerHandler{newTestConsumer(store)}).ConsumeClaim(sess, newFakeClaim(msgs...)); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := sess.markedOffsets(), []int64{0, 1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got marked offsets %v, want %v", got, want)
+	}
+	for span, anns := range want {
+		trace, err := store.Trace(span.Trace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sub := trace.FindSpan(span.Span)
+		if sub == nil {
+			t.Errorf("span %v not found", span)
+			continue
+		}
+		if !reflect.DeepEqual(sub.Annotations, anns) {
+			t.Errorf("span %v: got annotations %v, want %v", span, sub.Annotations, anns)
+		}
+	}
+}
+
+func TestConsumer_retry(t *testing.T) {
+	producer := &fakeProducer{}
+	if err := NewCollector(producer, "spans").Collect(appdash.SpanID{Trace: 1, Span: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	sess := &fakeSession{ctx: context.Background()}
+	calls := 0
+	c := collectorFunc(func(span appdash.SpanID, anns ...appdash.Annotation) error {
+		if len(sess.markedOffsets()) != 0 {
+			t.Error("message marked before it was collected")
+		}
+		if calls++; calls < 3 {
+			return errors.New("store unavailable")
+		}
+		return nil
+	})
+	if err := (consumerHandler{newTestConsumer(c)}).ConsumeClaim(sess, newFakeClaim(consumerMessages(t, producer.msgs)...)); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Errorf("got %d Collect calls, want 3", calls)
+	}
+	if got, want := sess.markedOffsets(), []int64{0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got marked offsets %v, want %v", got, want)
+	}
+}
+
+func TestConsumer_canceled(t *testing.T) {
+	producer := &fakeProducer{}
+	if err := NewCollector(producer, "spans").Collect(appdash.SpanID{Trace: 1, Span: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The session ends while the store is unavailable: the message is
+	// left unmarked, to be redelivered.
+	ctx, cancel := context.WithCancel(context.Background())
+	sess := &fakeSession{ctx: ctx}
+	c := collectorFunc(func(span appdash.SpanID, anns ...appdash.Annotation) error {
+		cancel()
+		return errors.New("store unavailable")
+	})
+	if err := (consumerHandler{newTestConsumer(c)}).ConsumeClaim(sess, newFakeClaim(consumerMessages(t, producer.msgs)...)); err != context.Canceled {
+		t.Errorf("got error %v, want context.Canceled", err)
+	}
+	if marked := sess.markedOffsets(); len(marked) != 0 {
+		t.Errorf("got marked offsets %v, want none", marked)
+	}
+}
+
+func TestConsumer_rejected(t *testing.T) {
+	producer := &fakeProducer{}
+	if err := NewCollector(producer, "spans").Collect(appdash.SpanID{Trace: 1, Span: 1}); err != nil {
+		t.Fatal(err)
+	}
+	msgs := []*sarama.ConsumerMessage{
+		{Value: []byte{0xff, 0xff, 0xff}, Offset: 0},
+		consumerMessages(t, producer.msgs)[0],
+	}
+	msgs[1].Offset = 1
+
+	store := appdash.NewMemoryStore()
+	consumer := newTestConsumer(store)
+	sess := &fakeSession{ctx: context.Background()}
+	if err := (consumerHandler{consumer}).ConsumeClaim(sess, newFakeClaim(msgs...)); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := sess.markedOffsets(), []int64{0, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got marked offsets %v, want %v", got, want)
+	}
+	if got := consumer.Rejected(); got != 1 {
+		t.Errorf("got %d rejected messages, want 1", got)
+	}
+	if _, err := store.Trace(1); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestIntegration publishes spans to and consumes them from the Kafka
+// brokers listed (comma-separated) in $APPDASH_KAFKA_BROKERS.
+func TestIntegration(t *testing.T) {
+	brokersEnv := os.Getenv("APPDASH_KAFKA_BROKERS")
+	if brokersEnv == "" {
+		t.Skip("skipping test; $APPDASH_KAFKA_BROKERS is not set")
+	}
+	brokers := strings.Split(brokersEnv, ",")
+	topic := fmt.Sprintf("appdash-test-%d", time.Now().UnixNano())
+	config := NewConfig()
+
+	producer, err := sarama.NewSyncProducer(brokers, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer producer.Close()
+	c := NewCollector(producer, topic)
+	var spans []appdash.SpanID
+	for i := 0; i < 10; i++ {
+		span := appdash.NewRootSpanID()
+		spans = append(spans, span)
+		if err := c.Collect(span, appdash.Annotation{Key: "k", Value: []byte("v")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	group, err := sarama.NewConsumerGroup(brokers, topic, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer group.Close()
+	store := appdash.NewMemoryStore()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- NewConsumer(group, topic, store).Run(ctx) }()
+
+	deadline := time.Now().Add(30 * time.Second)
+	for _, span := range spans {
+		for {
+			if _, err := store.Trace(span.Trace); err == nil {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("span %v: timed out waiting for it to be consumed", span)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Run: got error %v, want context.Canceled", err)
+	}
+}
+
+type collectorFunc func(appdash.SpanID, ...appdash.Annotation) error
+
+func (c collectorFunc) Collect(span appdash.SpanID, anns ...appdash.Annotation) error {
+	return c(span, anns...)
+}
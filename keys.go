@@ -0,0 +1,279 @@
+package appdash
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidKey is the error (wrapped by ValidateKey) of an annotation key
+// with characters that must be escaped.
+var ErrInvalidKey = errors.New("invalid annotation key")
+
+// reservedKeyPrefixes are the prefixes of the keys whose colon is legal.
+var reservedKeyPrefixes = []string{SchemaPrefix, TruncatedPrefix}
+
+// splitKey returns the reserved prefix of a key (or "" if it has none),
+// and the rest of it.
+func splitKey(key string) (prefix, name string) {
+	for _, p := range reservedKeyPrefixes {
+		if strings.HasPrefix(key, p) {
+			return p, key[len(p):]
+		}
+	}
+	return "", key
+}
+
+// legalKeyByte reports whether c may appear unescaped in a key (after its
+// reserved prefix).
+func legalKeyByte(c byte) bool {
+	return c > ' ' && c < 0x7f && c != '%' && c != ':' && c != '='
+}
+
+// escapeAt reports whether s[i] starts the escape of an illegal byte (or
+// of a dot in a map key, see EscapeMapKey).
+func escapeAt(s string, i int) bool {
+	if s[i] != '%' || i+2 >= len(s) {
+		return false
+	}
+	c, ok := unhex(s[i+1], s[i+2])
+	return ok && (!legalKeyByte(c) || c == '.')
+}
+
+// ValidKey reports whether key is legal, i.e. whether EscapeKey leaves it
+// as is.
+func ValidKey(key string) bool {
+	_, name := splitKey(key)
+	for i := 0; i < len(name); i++ {
+		if !legalKeyByte(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// recordedKey reports whether key is as recorded, i.e. legal except for
+// the escapes of illegal bytes (or of the dots of map keys) that it may
+// contain (see normalizeKey).
+func recordedKey(key string) bool {
+	_, name := splitKey(key)
+	for i := 0; i < len(name); i++ {
+		switch {
+		case escapeAt(name, i):
+			i += 2
+		case !legalKeyByte(name[i]):
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateKey returns an error wrapping ErrInvalidKey if key isn't legal
+// (see ValidKey).
+func ValidateKey(key string) error {
+	if !ValidKey(key) {
+		return fmt.Errorf("%w %q (escaped as %q)", ErrInvalidKey, key, EscapeKey(key))
+	}
+	return nil
+}
+
+const upperhex = "0123456789ABCDEF"
+
+// EscapeKey returns key with the bytes of its illegal characters escaped
+// as "%XX". It returns a legal key as is.
+//
+// The keys of the annotations are normalized before they are collected,
+// because some characters confuse the detection of the event schemas (and
+// some stores): a key may only contain printable ASCII characters other
+// than '%', ':' and '=', except for the colon of the reserved prefixes
+// (such as SchemaPrefix and TruncatedPrefix) that it may start with. The bytes
+// of the other characters are escaped as "%XX", their uppercase
+// hexadecimal value, for example "Fields.user id" is recorded as
+// "Fields.user%20id". Every '%' is escaped too, as "%25", so that
+// UnescapeKey returns the exact key; a key must thus only be escaped once.
+//
+// The Recorder escapes the keys of the annotations it collects (unless
+// its StrictKeys is set), and the stores keep them escaped. The read paths
+// unescape them (UnmarshalEvents, and the Get, Has and Map methods of
+// Annotations), so that the keys of the event fields and of the raw
+// annotations round-trip. Only the Key of an Annotation read from a store
+// remains escaped.
+func EscapeKey(key string) string {
+	if ValidKey(key) {
+		return key
+	}
+	return escapeKey(key, false)
+}
+
+// normalizeKey is like EscapeKey, but it keeps the escapes already in key,
+// for the keys that are partly escaped, such as those of the annotations
+// of MarshalEvent (whose map keys are escaped, see EscapeMapKey), or those
+// read from a store.
+func normalizeKey(key string) string {
+	if recordedKey(key) {
+		return key
+	}
+	return escapeKey(key, true)
+}
+
+// escapeKey escapes the illegal bytes of key, except for the escapes that
+// it contains if keepEscapes is true.
+func escapeKey(key string, keepEscapes bool) string {
+	prefix, name := splitKey(key)
+	var b strings.Builder
+	b.Grow(len(key) + 16)
+	b.WriteString(prefix)
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if keepEscapes && escapeAt(name, i) {
+			b.WriteString(name[i : i+3])
+			i += 2
+			continue
+		}
+		if legalKeyByte(c) {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(upperhex[c>>4])
+		b.WriteByte(upperhex[c&15])
+	}
+	return b.String()
+}
+
+// UnescapeKey returns the original key of a key escaped by EscapeKey. Only
+// the escapes of illegal bytes are decoded, so that a '%' that isn't part
+// of one (as in a key recorded before the keys were escaped) is kept.
+func UnescapeKey(key string) string {
+	if strings.IndexByte(key, '%') == -1 {
+		return key
+	}
+	var b strings.Builder
+	b.Grow(len(key))
+	for i := 0; i < len(key); i++ {
+		if escapeAt(key, i) {
+			c, _ := unhex(key[i+1], key[i+2])
+			b.WriteByte(c)
+			i += 2
+			continue
+		}
+		b.WriteByte(key[i])
+	}
+	return b.String()
+}
+
+// unhex decodes the byte with the uppercase hexadecimal digits h and l.
+func unhex(h, l byte) (byte, bool) {
+	hv, ok1 := unhexDigit(h)
+	lv, ok2 := unhexDigit(l)
+	return hv<<4 | lv, ok1 && ok2
+}
+
+func unhexDigit(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// EscapeMapKey returns the key of a map entry of an event as it appears in
+// the keys of the annotations of the event (e.g. "Fields.<key>", see
+// MarshalEvent): escaped like with EscapeKey, and with its dots escaped as
+// "%2E" too, so that it is a single component of the dotted key path.
+func EscapeMapKey(key string) string {
+	legal := func(c byte) bool { return legalKeyByte(c) && c != '.' }
+	first := 0
+	for first < len(key) && legal(key[first]) {
+		first++
+	}
+	if first == len(key) {
+		return key
+	}
+	var b strings.Builder
+	b.Grow(len(key) + 16)
+	b.WriteString(key[:first])
+	for i := first; i < len(key); i++ {
+		c := key[i]
+		if legal(c) {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(upperhex[c>>4])
+		b.WriteByte(upperhex[c&15])
+	}
+	return b.String()
+}
+
+// unescapeKeys returns as with their keys unescaped (see UnescapeKey), or
+// as itself if none of them is escaped.
+func unescapeKeys(as Annotations) Annotations {
+	for i, a := range as {
+		if strings.IndexByte(a.Key, '%') != -1 {
+			unescaped := make(Annotations, len(as))
+			copy(unescaped, as[:i])
+			for j := i; j < len(as); j++ {
+				unescaped[j] = Annotation{Key: UnescapeKey(as[j].Key), Value: as[j].Value}
+			}
+			return unescaped
+		}
+	}
+	return as
+}
+
+// escapedMap is like Annotations.StringMap, but with the keys escaped (see
+// normalizeKey), whether they were recorded by a Recorder or not, so that
+// the events are unmarshaled from them alike.
+func escapedMap(as Annotations) map[string]string {
+	m := make(map[string]string, len(as))
+	for _, a := range as {
+		m[normalizeKey(a.Key)] = string(a.Value)
+	}
+	return m
+}
+
+// escapeKeys returns as with their keys escaped (see EscapeKey), or as
+// itself if they are all legal. If recorded, the keys are partly escaped
+// already, like those of MarshalEvent, and their escapes are kept (see
+// normalizeKey). If strict, the annotations with illegal keys are dropped
+// instead, and the error of each is returned.
+func escapeKeys(as []Annotation, strict, recorded bool) ([]Annotation, []error) {
+	valid, escape := ValidKey, EscapeKey
+	if recorded {
+		valid, escape = recordedKey, normalizeKey
+	}
+	first := -1
+	for i, a := range as {
+		if !valid(a.Key) {
+			first = i
+			break
+		}
+	}
+	if first == -1 {
+		return as, nil
+	}
+
+	var errs []error
+	escaped := make([]Annotation, first, len(as))
+	copy(escaped, as[:first])
+	for _, a := range as[first:] {
+		if !valid(a.Key) {
+			if strict {
+				errs = append(errs, fmt.Errorf("%w %q (escaped as %q)", ErrInvalidKey, a.Key, escape(a.Key)))
+				continue
+			}
+			a.Key = escape(a.Key)
+		}
+		escaped = append(escaped, a)
+	}
+	return escaped, errs
+}
+
+// keyIs reports whether the recorded (escaped) key of an annotation is
+// key, given as recorded or unescaped.
+func keyIs(recorded, key string) bool {
+	return recorded == key || UnescapeKey(recorded) == key
+}
@@ -0,0 +1,148 @@
+package appdash
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEscapeKey(t *testing.T) {
+	tests := []struct {
+		key, escaped string
+	}{
+		{"Name", "Name"},
+		{"Client.Request.Headers.X-Req-Header", "Client.Request.Headers.X-Req-Header"},
+		{"_schema:HTTPServer", "_schema:HTTPServer"},
+		{"a=b", "a%3Db"},
+		{"a:b", "a%3Ab"},
+		{"_schema:a:b", "_schema:a%3Ab"},
+		{"line\nbreak", "line%0Abreak"},
+		{"user id", "user%20id"},
+		{"100%", "100%25"},
+		{"%41", "%2541"},
+		{"é", "%C3%A9"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		escaped := EscapeKey(test.key)
+		if escaped != test.escaped {
+			t.Errorf("EscapeKey(%q): got %q, want %q", test.key, escaped, test.escaped)
+		}
+		if !recordedKey(escaped) {
+			t.Errorf("EscapeKey(%q): got invalid key %q", test.key, escaped)
+		}
+		if valid := escaped == test.key; ValidKey(test.key) != valid {
+			t.Errorf("ValidKey(%q): got %v, want %v", test.key, !valid, valid)
+		}
+		if got := UnescapeKey(escaped); got != test.key {
+			t.Errorf("UnescapeKey(%q): got %q, want %q", escaped, got, test.key)
+		}
+	}
+
+	// The '%' of the keys recorded before they were escaped are kept,
+	// unless they happen to look like the escape of an illegal byte.
+	for _, key := range []string{"100%", "%41", "%4", "50%zz"} {
+		if got := UnescapeKey(key); got != key {
+			t.Errorf("UnescapeKey(%q): got %q, want it unchanged", key, got)
+		}
+	}
+
+	// The keys with a '%' round-trip, even if it looks like an escape.
+	for _, key := range []string{"a%20b", "rate%3A", "100%", "%41", "%25%"} {
+		if ValidKey(key) {
+			t.Errorf("ValidKey(%q): got true, want false", key)
+		}
+		if got := UnescapeKey(EscapeKey(key)); got != key {
+			t.Errorf("UnescapeKey(EscapeKey(%q)): got %q", key, got)
+		}
+	}
+
+	if err := ValidateKey("a=b"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("got error %v, want %v", err, ErrInvalidKey)
+	}
+	if err := ValidateKey("a.b"); err != nil {
+		t.Errorf("got error %v for a valid key", err)
+	}
+}
+
+func TestRecorder_escapesKeys(t *testing.T) {
+	var collected Annotations
+	r := NewRecorder(SpanID{Trace: 1, Span: 2}, collectorFunc(func(span SpanID, anns ...Annotation) error {
+		collected = append(collected, anns...)
+		return nil
+	}))
+	r.LogFields("user id", "u1", "a=b", "c")
+	r.Annotation(Annotation{Key: "raw:key", Value: []byte("v")})
+	r.Finish()
+	if errs := r.Errors(); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	for _, a := range collected {
+		if !recordedKey(a.Key) {
+			t.Errorf("collected invalid key %q", a.Key)
+		}
+	}
+	if got := string(collected.Get(EscapeKey("raw:key"))); got != "v" {
+		t.Errorf("got raw annotation value %q, want %q", got, "v")
+	}
+	logs := collected.FieldLogs()
+	if want := map[string]string{"user id": "u1", "a=b": "c"}; len(logs) != 1 || !reflect.DeepEqual(logs[0].Fields, want) {
+		t.Errorf("got field logs %+v, want fields %v", logs, want)
+	}
+}
+
+func TestRecorder_StrictKeys(t *testing.T) {
+	var collected Annotations
+	r := NewRecorder(SpanID{Trace: 1, Span: 2}, collectorFunc(func(span SpanID, anns ...Annotation) error {
+		collected = append(collected, anns...)
+		return nil
+	}))
+	r.StrictKeys = true
+	r.Annotation(Annotation{Key: "ok", Value: []byte("1")}, Annotation{Key: "not ok", Value: []byte("2")}, Annotation{Key: "a%20b", Value: []byte("3")})
+
+	errs := r.Errors()
+	if len(errs) != 2 || !errors.Is(errs[0], ErrInvalidKey) || !errors.Is(errs[1], ErrInvalidKey) {
+		t.Errorf("got errors %v, want two %v", errs, ErrInvalidKey)
+	}
+	if !collected.Has("ok") || collected.Has("not ok") || collected.Has(EscapeKey("not ok")) || collected.Has("a%20b") {
+		t.Errorf("got annotations %v, want only the valid one (and the error log)", collected)
+	}
+}
+
+func TestEscapedKeys_memoryStore(t *testing.T) {
+	ms := NewMemoryStore()
+	r := NewRecorder(SpanID{Trace: 1, Span: 2}, ms)
+	r.Annotation(Annotation{Key: "raw:key", Value: []byte("v")}, Annotation{Key: "100%", Value: []byte("full")}, Annotation{Key: "a%20b", Value: []byte("percent")}, Annotation{Key: "%41", Value: []byte("A")})
+	r.LogFields("user id", "u1")
+	r.Finish()
+
+	trace, err := ms.Trace(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	as := trace.Span.Annotations
+	var stored []string
+	for _, a := range as {
+		stored = append(stored, a.Key)
+	}
+	if !strings.Contains(strings.Join(stored, " "), "raw%3Akey") {
+		t.Errorf("got stored keys %q, want the raw key escaped", stored)
+	}
+	for key, want := range map[string]string{"raw:key": "v", "100%": "full", "a%20b": "percent", "%41": "A"} {
+		if got := string(as.Get(key)); got != want {
+			t.Errorf("Get(%q): got %q, want %q", key, got, want)
+		}
+		if got := string(as.Get(EscapeKey(key))); got != want {
+			t.Errorf("Get(%q): got %q, want %q", EscapeKey(key), got, want)
+		}
+		if got, ok := as.StringMap()[key]; !ok || got != want {
+			t.Errorf("StringMap()[%q]: got %q, want %q", key, got, want)
+		}
+	}
+	logs := as.FieldLogs()
+	if want := map[string]string{"user id": "u1"}; len(logs) != 1 || !reflect.DeepEqual(logs[0].Fields, want) {
+		t.Errorf("got field logs %+v, want fields %v", logs, want)
+	}
+}
@@ -0,0 +1,321 @@
+// Package leveldbstore implements an appdash.Store backed by a LevelDB
+// database (using the pure-Go goleveldb), for durable embedded deployments.
+//
+// Unlike a MemoryStore persisted with appdash.PersistEvery, which rewrites
+// the whole store on each snapshot and loses everything collected since the
+// last one on a crash, every Collect is durable once it returns and its cost
+// does not grow with the size of the store. The package's benchmarks compare
+// the two.
+//
+// Each Collect call is written as a single atomic batch. A span is stored as
+// a span key (trace ID, span ID) holding its parent ID, followed by one key
+// per annotation of the form trace ID/span ID/sequence number/annotation key,
+// holding the annotation's value; the sequence number preserves annotation
+// order and duplicate keys. A separate time index orders traces by the time
+// they were first collected, which is used to list the most recent traces.
+//
+// LevelDB recovers committed writes from its journal when reopened after a
+// crash. If the database's manifest is corrupted, Open rebuilds it from the
+// data files.
+package leveldbstore
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	lerrors "github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+
+	"sourcegraph.com/sourcegraph/appdash"
+	"sourcegraph.com/sourcegraph/appdash/internal/tracetree"
+)
+
+// Key prefixes.
+const (
+	spanPrefix  = 's' // trace ID + span ID -> parent ID; + seq + annotation key -> value
+	tracePrefix = 't' // trace ID -> time index key
+	timePrefix  = 'i' // first-collected time + trace ID -> nil
+)
+
+// Store is an appdash.Store and appdash.Queryer backed by a LevelDB
+// database.
+type Store struct {
+	// Sync, if true, makes Collect and Delete wait until their writes have
+	// been flushed to stable storage. Without it, writes are durable across
+	// process crashes but may be lost if the machine crashes.
+	Sync bool
+
+	db *leveldb.DB
+
+	// seq is the last annotation sequence number. It starts at the time the
+	// store was opened, so that it keeps increasing across restarts.
+	seq uint64
+
+	// mu serializes Collect's check for whether a trace is new with its
+	// write, so that each trace is indexed exactly once.
+	mu sync.Mutex
+}
+
+// Compile-time "implements" check.
+var _ interface {
+	appdash.DeleteStore
+	appdash.Queryer
+	appdash.TraceIterator
+} = (*Store)(nil)
+
+// Open opens (creating if needed) the LevelDB database in the directory at
+// path and returns a store backed by it. The store should be closed when no
+// longer needed.
+func Open(path string) (*Store, error) {
+	db, err := leveldb.OpenFile(path, nil)
+	if lerrors.IsCorrupted(err) {
+		db, err = leveldb.RecoverFile(path, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return New(db), nil
+}
+
+// New returns a store backed by an already opened LevelDB database.
+func New(db *leveldb.DB) *Store {
+	return &Store{db: db, seq: uint64(time.Now().UnixNano())}
+}
+
+// Close closes the underlying database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) writeOptions() *opt.WriteOptions {
+	return &opt.WriteOptions{Sync: s.Sync}
+}
+
+// Collect implements the appdash.Collector interface.
+func (s *Store) Collect(id appdash.SpanID, as ...appdash.Annotation) error {
+	var b leveldb.Batch
+	sk := spanKey(id.Trace, id.Span)
+	b.Put(sk, idBytes(id.Parent))
+	for _, a := range as {
+		k := make([]byte, len(sk)+8+len(a.Key))
+		n := copy(k, sk)
+		binary.BigEndian.PutUint64(k[n:], atomic.AddUint64(&s.seq, 1))
+		copy(k[n+8:], a.Key)
+		b.Put(k, a.Value)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tk := traceKey(id.Trace)
+	if ok, err := s.db.Has(tk, nil); err != nil {
+		return err
+	} else if !ok {
+		// Index the new trace by the time it was first collected.
+		ik := make([]byte, 17)
+		ik[0] = timePrefix
+		binary.BigEndian.PutUint64(ik[1:], uint64(time.Now().UnixNano()))
+		binary.BigEndian.PutUint64(ik[9:], uint64(id.Trace))
+		b.Put(ik, nil)
+		b.Put(tk, ik)
+	}
+	return s.db.Write(&b, s.writeOptions())
+}
+
+// Trace implements the appdash.Store interface.
+func (s *Store) Trace(id appdash.ID) (*appdash.Trace, error) {
+	snap, err := s.db.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Release()
+	return readTrace(snap, id)
+}
+
+// Traces implements the appdash.Queryer interface. Traces are returned most
+// recently collected first. If opts.Timespan is set, only traces first
+// collected within it are returned. The Matchers and MinDuration filters
+// aren't supported.
+func (s *Store) Traces(opts appdash.TracesOpts) ([]*appdash.Trace, error) {
+	if err := appdash.UnsupportedFilters(opts); err != nil {
+		return nil, err
+	}
+	snap, err := s.db.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Release()
+
+	var traces []*appdash.Trace
+	if len(opts.TraceIDs) > 0 {
+		for _, id := range opts.TraceIDs {
+			t, err := readTrace(snap, id)
+			if err == appdash.ErrTraceNotFound {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			traces = append(traces, t)
+			if opts.Limit > 0 && len(traces) >= opts.Limit {
+				break
+			}
+		}
+		return traces, nil
+	}
+
+	r := util.BytesPrefix([]byte{timePrefix})
+	if !opts.Timespan.S.IsZero() {
+		r.Start = timeKey(opts.Timespan.S.UnixNano())
+	}
+	if !opts.Timespan.E.IsZero() {
+		r.Limit = timeKey(opts.Timespan.E.UnixNano() + 1)
+	}
+	it := snap.NewIterator(r, nil)
+	defer it.Release()
+	for ok := it.Last(); ok; ok = it.Prev() {
+		t, err := readTrace(snap, appdash.ID(binary.BigEndian.Uint64(it.Key()[9:])))
+		if err != nil {
+			return nil, err
+		}
+		traces = append(traces, t)
+		if opts.Limit > 0 && len(traces) >= opts.Limit {
+			break
+		}
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	return traces, nil
+}
+
+// ForEachTrace implements the appdash.TraceIterator interface. Traces are
+// read one at a time, in order of trace ID, from a snapshot of the database
+// taken when ForEachTrace is called, so f may write to the store.
+func (s *Store) ForEachTrace(f func(*appdash.Trace) error) error {
+	snap, err := s.db.GetSnapshot()
+	if err != nil {
+		return err
+	}
+	defer snap.Release()
+
+	it := snap.NewIterator(util.BytesPrefix([]byte{tracePrefix}), nil)
+	defer it.Release()
+	for it.Next() {
+		t, err := readTrace(snap, appdash.ID(binary.BigEndian.Uint64(it.Key()[1:])))
+		if err == appdash.ErrTraceNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := f(t); err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
+
+// Delete implements the appdash.DeleteStore interface.
+func (s *Store) Delete(traces ...appdash.ID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var b leveldb.Batch
+	for _, id := range traces {
+		tk := traceKey(id)
+		ik, err := s.db.Get(tk, nil)
+		if err == leveldb.ErrNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+		b.Delete(ik)
+		b.Delete(tk)
+
+		it := s.db.NewIterator(util.BytesPrefix(spanKey(id, 0)[:9]), nil)
+		for it.Next() {
+			b.Delete(append([]byte(nil), it.Key()...))
+		}
+		it.Release()
+		if err := it.Error(); err != nil {
+			return err
+		}
+	}
+	return s.db.Write(&b, s.writeOptions())
+}
+
+// readTrace reads and assembles the trace with the given ID.
+func readTrace(snap *leveldb.Snapshot, id appdash.ID) (*appdash.Trace, error) {
+	it := snap.NewIterator(util.BytesPrefix(spanKey(id, 0)[:9]), nil)
+	defer it.Release()
+
+	var spans []appdash.Span
+	for it.Next() {
+		k, v := it.Key(), it.Value()
+		if len(k) < 17 {
+			return nil, errors.New("leveldbstore: corrupt span key")
+		}
+		spanID := appdash.ID(binary.BigEndian.Uint64(k[9:]))
+		if len(k) == 17 {
+			// Span key, which sorts before the span's annotations.
+			if len(v) != 8 {
+				return nil, errors.New("leveldbstore: corrupt parent ID")
+			}
+			spans = append(spans, appdash.Span{ID: appdash.SpanID{
+				Trace:  id,
+				Span:   spanID,
+				Parent: appdash.ID(binary.BigEndian.Uint64(v)),
+			}})
+			continue
+		}
+		if len(k) < 25 || len(spans) == 0 || spans[len(spans)-1].ID.Span != spanID {
+			return nil, errors.New("leveldbstore: corrupt annotation key")
+		}
+		a := appdash.Annotation{Key: string(k[25:])}
+		if len(v) > 0 {
+			a.Value = append([]byte(nil), v...)
+		}
+		span := &spans[len(spans)-1]
+		span.Annotations = append(span.Annotations, a)
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	if len(spans) == 0 {
+		return nil, appdash.ErrTraceNotFound
+	}
+	return tracetree.Build(spans), nil
+}
+
+// spanKey returns the key of the given span, which is also the prefix of the
+// keys of its annotations.
+func spanKey(trace, span appdash.ID) []byte {
+	k := make([]byte, 17)
+	k[0] = spanPrefix
+	binary.BigEndian.PutUint64(k[1:], uint64(trace))
+	binary.BigEndian.PutUint64(k[9:], uint64(span))
+	return k
+}
+
+func traceKey(trace appdash.ID) []byte {
+	return append([]byte{tracePrefix}, idBytes(trace)...)
+}
+
+// timeKey returns the smallest time index key for traces first collected at
+// the given time.
+func timeKey(nanos int64) []byte {
+	k := make([]byte, 9)
+	k[0] = timePrefix
+	binary.BigEndian.PutUint64(k[1:], uint64(nanos))
+	return k
+}
+
+// idBytes returns the big-endian encoding of id, so that keys sort by ID.
+func idBytes(id appdash.ID) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(id))
+	return b
+}
@@ -0,0 +1,149 @@
+package leveldbstore
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"sourcegraph.com/sourcegraph/appdash"
+	"sourcegraph.com/sourcegraph/appdash/internal/storetest"
+)
+
+func tempDir(t testing.TB) string {
+	dir, err := ioutil.TempDir("", "leveldbstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestStore(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	var n int
+	storetest.Test(t, func(t *testing.T) appdash.Store {
+		n++
+		s, err := Open(filepath.Join(dir, fmt.Sprint(n)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
+
+func TestStore_reopen(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anns := appdash.Annotations{{Key: "k", Value: []byte("v")}, {Key: "k", Value: []byte("v2")}}
+	if err := s.Collect(appdash.SpanID{Trace: 1, Span: 1}, anns[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.Collect(appdash.SpanID{Trace: 1, Span: 1}, anns[1]); err != nil {
+		t.Fatal(err)
+	}
+	tr, err := s.Trace(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tr.Annotations, anns) {
+		t.Errorf("got annotations %v, want %v", tr.Annotations, anns)
+	}
+}
+
+// benchmarkCollect measures the throughput of collecting spans of 10 spans
+// each into s.
+func benchmarkCollect(b *testing.B, s appdash.Collector) {
+	anns := appdash.Annotations{
+		{Key: "Name", Value: []byte("GET /users/123")},
+		{Key: "Span.Start", Value: []byte(time.Now().Format(time.RFC3339Nano))},
+		{Key: "Span.End", Value: []byte(time.Now().Format(time.RFC3339Nano))},
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		id := appdash.SpanID{Trace: appdash.ID(i/10 + 1), Span: appdash.ID(i%10 + 1)}
+		if i%10 != 0 {
+			id.Parent = 1
+		}
+		if err := s.Collect(id, anns...); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCollect(b *testing.B) {
+	dir := tempDir(b)
+	defer os.RemoveAll(dir)
+	s, err := Open(dir)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer s.Close()
+	benchmarkCollect(b, s)
+}
+
+func BenchmarkCollect_sync(b *testing.B) {
+	dir := tempDir(b)
+	defer os.RemoveAll(dir)
+	s, err := Open(dir)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer s.Close()
+	s.Sync = true
+	benchmarkCollect(b, s)
+}
+
+// BenchmarkCollect_memoryStorePersistEvery measures a MemoryStore that is
+// persisted continuously, as with appdash.PersistEvery, for comparison.
+func BenchmarkCollect_memoryStorePersistEvery(b *testing.B) {
+	dir := tempDir(b)
+	defer os.RemoveAll(dir)
+	ms := appdash.NewMemoryStore()
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+			f, err := os.Create(filepath.Join(dir, "store.gob"))
+			if err != nil {
+				b.Error(err)
+				return
+			}
+			if err := ms.Write(f); err != nil {
+				b.Error(err)
+			}
+			f.Close()
+		}
+	}()
+	defer func() {
+		close(done)
+		<-stopped
+	}()
+	benchmarkCollect(b, ms)
+}
@@ -0,0 +1,78 @@
+package appdash
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// A LogFieldsEvent is a structured log message, a set of key-value fields
+// (such as "cache" = "miss" and "elapsed_ms" = "12"), as recorded by
+// Recorder.LogFields and LogFieldMap. It is a RepeatedEvent, so a span may
+// have any number of them, and each field is recorded as its own
+// annotation (e.g. "logfields.0.Fields.cache").
+type LogFieldsEvent struct {
+	Fields map[string]string
+	Time   time.Time
+}
+
+func (LogFieldsEvent) Schema() string             { return "logfields" }
+func (LogFieldsEvent) RepeatedEvent()             {}
+func (e LogFieldsEvent) Timestamp() time.Time     { return e.Time }
+func (e LogFieldsEvent) AtTime(t time.Time) Event { e.Time = t; return e }
+
+var errOddLogFields = errors.New("odd number of LogFields arguments (the last key has no value)")
+
+// LogFields records a LogFieldsEvent with the current timestamp and the
+// fields given as alternating keys and values, for example:
+//
+//	rec.LogFields("cache", "miss", "key", key, "elapsed_ms", 12)
+//
+// The keys and values are formatted as with fmt.Sprint. If the last key
+// has no value, its value is empty, and an error is reported.
+func (r *Recorder) LogFields(keyvals ...interface{}) {
+	if !r.recording() {
+		return
+	}
+	fields := make(map[string]string, (len(keyvals)+1)/2)
+	for i := 0; i < len(keyvals); i += 2 {
+		var v string
+		if i+1 < len(keyvals) {
+			v = fmt.Sprint(keyvals[i+1])
+		}
+		fields[fmt.Sprint(keyvals[i])] = v
+	}
+	if len(keyvals)%2 != 0 {
+		r.error("LogFields", errOddLogFields)
+	}
+	r.Event(LogFieldsEvent{Fields: fields, Time: time.Now()})
+}
+
+// LogFieldMap records a LogFieldsEvent with the current timestamp and the
+// given fields, whose values are formatted as with fmt.Sprint.
+func (r *Recorder) LogFieldMap(fields map[string]interface{}) {
+	if !r.recording() {
+		return
+	}
+	m := make(map[string]string, len(fields))
+	for k, v := range fields {
+		m[k] = fmt.Sprint(v)
+	}
+	r.Event(LogFieldsEvent{Fields: m, Time: time.Now()})
+}
+
+// FieldLogs returns the structured log messages (LogFieldsEvents) of the
+// span, sorted by time.
+func (as Annotations) FieldLogs() []LogFieldsEvent {
+	var events []Event
+	UnmarshalEvents(as, &events)
+	var logs []LogFieldsEvent
+	for _, e := range events {
+		if e, ok := e.(LogFieldsEvent); ok {
+			logs = append(logs, e)
+		}
+	}
+	sort.SliceStable(logs, func(i, j int) bool { return logs[i].Time.Before(logs[j].Time) })
+	return logs
+}
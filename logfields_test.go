@@ -0,0 +1,42 @@
+package appdash
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRecorder_LogFields(t *testing.T) {
+	var anns Annotations
+	r := NewRecorder(SpanID{Trace: 1, Span: 2}, collectorFunc(func(_ SpanID, as ...Annotation) error {
+		anns = append(anns, as...)
+		return nil
+	}))
+	r.LogFields("cache", "miss", "key", "a.b", "elapsed_ms", 12)
+	r.LogFieldMap(map[string]interface{}{"cache": "hit", "size": 3})
+	r.LogFields("odd")
+	r.Finish()
+
+	if errs := r.Errors(); len(errs) != 1 || errs[0] != errOddLogFields {
+		t.Errorf("got errors %v, want [%v]", errs, errOddLogFields)
+	}
+	if got, want := string(anns.Get("logfields.0.Fields.elapsed_ms")), "12"; got != want {
+		t.Errorf("got annotation %q, want %q", got, want)
+	}
+
+	logs := anns.FieldLogs()
+	var got []map[string]string
+	for _, l := range logs {
+		if l.Time.IsZero() {
+			t.Errorf("got zero time for %+v", l)
+		}
+		got = append(got, l.Fields)
+	}
+	want := []map[string]string{
+		{"cache": "miss", "key": "a.b", "elapsed_ms": "12"},
+		{"cache": "hit", "size": "3"},
+		{"odd": ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got fields %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,139 @@
+package appdash
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A LogLevel is the severity of a LogLevelEvent.
+type LogLevel int
+
+// The log levels, from the least to the most severe.
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var logLevelNames = [...]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+// String returns the name of the level ("debug", "info", "warn" or
+// "error"), which is how it is recorded.
+func (l LogLevel) String() string {
+	if l >= 0 && int(l) < len(logLevelNames) {
+		return logLevelNames[l]
+	}
+	return fmt.Sprintf("LogLevel(%d)", int(l))
+}
+
+// ParseLogLevel parses the name of a log level (see LogLevel.String),
+// ignoring case.
+func ParseLogLevel(s string) (LogLevel, error) {
+	for l, name := range logLevelNames {
+		if strings.EqualFold(s, name) {
+			return LogLevel(l), nil
+		}
+	}
+	return 0, fmt.Errorf("appdash: unknown log level %q", s)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler (see ParseLogLevel).
+func (l *LogLevel) UnmarshalText(text []byte) error {
+	level, err := ParseLogLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*l = level
+	return nil
+}
+
+// A LogLevelEvent is a log message with a level, as recorded by
+// Recorder.Debugf, Infof, Warnf and Errorf. It is a RepeatedEvent, so a
+// span may have any number of them.
+type LogLevelEvent struct {
+	Level LogLevel
+	Msg   string
+	Time  time.Time
+}
+
+func (LogLevelEvent) Schema() string             { return "leveledlog" }
+func (LogLevelEvent) RepeatedEvent()             {}
+func (e LogLevelEvent) Timestamp() time.Time     { return e.Time }
+func (e LogLevelEvent) AtTime(t time.Time) Event { e.Time = t; return e }
+
+// Debugf records a LogLevelEvent at LevelDebug, with the current
+// timestamp and a message formatted as with fmt.Sprintf, unless the level
+// is below MinLogLevel.
+func (r *Recorder) Debugf(format string, args ...interface{}) {
+	r.logf(LevelDebug, format, args...)
+}
+
+// Infof records a LogLevelEvent at LevelInfo (see Debugf).
+func (r *Recorder) Infof(format string, args ...interface{}) {
+	r.logf(LevelInfo, format, args...)
+}
+
+// Warnf records a LogLevelEvent at LevelWarn (see Debugf).
+func (r *Recorder) Warnf(format string, args ...interface{}) {
+	r.logf(LevelWarn, format, args...)
+}
+
+// Errorf records a LogLevelEvent at LevelError (see Debugf). Unlike Error,
+// it doesn't record an ErrorEvent, so it doesn't mark the span as failed.
+func (r *Recorder) Errorf(format string, args ...interface{}) {
+	r.logf(LevelError, format, args...)
+}
+
+// logf records a LogLevelEvent at the level, unless it is below
+// MinLogLevel (in which case the message isn't even formatted).
+func (r *Recorder) logf(level LogLevel, format string, args ...interface{}) {
+	if level < r.MinLogLevel || !r.recording() {
+		return
+	}
+	r.Event(LogLevelEvent{Level: level, Msg: fmt.Sprintf(format, args...), Time: time.Now()})
+}
+
+// Logs returns the log events of the span, sorted by time: its
+// LogLevelEvents, and its Log events (recorded by Recorder.Log, without a
+// level), which are returned at LevelInfo.
+func (as Annotations) Logs() []LogLevelEvent {
+	var events []Event
+	UnmarshalEvents(as, &events)
+	var logs []LogLevelEvent
+	for _, e := range events {
+		switch e := e.(type) {
+		case LogLevelEvent:
+			logs = append(logs, e)
+		case logEvent:
+			logs = append(logs, LogLevelEvent{Level: LevelInfo, Msg: e.Msg, Time: e.Time})
+		}
+	}
+	sort.SliceStable(logs, func(i, j int) bool { return logs[i].Time.Before(logs[j].Time) })
+	return logs
+}
+
+// HasLogLevel returns a predicate, for NewFilterCollector, that keeps the
+// collections with a LogLevelEvent at the given level or above. For
+// example, to only keep the spans that logged warnings or errors:
+//
+//	c := appdash.NewFilterCollector(collector, appdash.HasLogLevel(appdash.LevelWarn))
+func HasLogLevel(min LogLevel) func(SpanID, Annotations) bool {
+	schema := LogLevelEvent{}.Schema()
+	return func(_ SpanID, anns Annotations) bool {
+		for _, inst := range repeatedInstances(anns, schema) {
+			var level LogLevel
+			if err := level.UnmarshalText(inst.anns.Get("Level")); err == nil && level >= min {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,100 @@
+package appdash
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRecorder_leveledLogs(t *testing.T) {
+	var anns Annotations
+	r := NewRecorder(SpanID{Trace: 1, Span: 2}, collectorFunc(func(_ SpanID, as ...Annotation) error {
+		anns = append(anns, as...)
+		return nil
+	}))
+	r.MinLogLevel = LevelInfo
+	r.Debugf("dropped %d", 1)
+	r.Infof("info %d", 2)
+	r.Warnf("warn %d", 3)
+	r.Errorf("error %d", 4)
+	r.Finish()
+
+	var events []Event
+	if err := UnmarshalEvents(anns, &events); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range events {
+		if e, ok := e.(LogLevelEvent); ok {
+			if e.Time.IsZero() {
+				t.Errorf("got zero time for %+v", e)
+			}
+			got = append(got, e.Level.String()+": "+e.Msg)
+		}
+	}
+	if want := []string{"info: info 2", "warn: warn 3", "error: error 4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got log events %q, want %q", got, want)
+	}
+
+	var raw []Event
+	if err := UnmarshalEventsTolerant(anns, &raw); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range raw {
+		if e, ok := e.(RawEvent); ok {
+			t.Errorf("got raw event %+v, want the log events decoded", e)
+		}
+	}
+}
+
+func TestAnnotations_Logs(t *testing.T) {
+	base := time.Unix(1500000000, 0).UTC()
+	var anns Annotations
+	for i, e := range []Event{
+		LogLevelEvent{Level: LevelWarn, Msg: "third", Time: base.Add(3 * time.Second)},
+		LogWithTimestamp("second", base.Add(2*time.Second)), // recorded without a level
+		LogLevelEvent{Level: LevelDebug, Msg: "first", Time: base.Add(time.Second)},
+	} {
+		var as Annotations
+		var err error
+		if _, ok := e.(RepeatedEvent); ok {
+			as, err = MarshalRepeatedEvent(e, i)
+		} else {
+			as, err = MarshalEvent(e)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		anns = append(anns, as...)
+	}
+
+	want := []LogLevelEvent{
+		{Level: LevelDebug, Msg: "first", Time: base.Add(time.Second)},
+		{Level: LevelInfo, Msg: "second", Time: base.Add(2 * time.Second)},
+		{Level: LevelWarn, Msg: "third", Time: base.Add(3 * time.Second)},
+	}
+	if got := anns.Logs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got logs %+v, want %+v", got, want)
+	}
+
+	for min, keep := range map[LogLevel]bool{LevelDebug: true, LevelWarn: true, LevelError: false} {
+		if got := HasLogLevel(min)(SpanID{}, anns); got != keep {
+			t.Errorf("HasLogLevel(%v): got %v, want %v", min, got, keep)
+		}
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	for _, l := range []LogLevel{LevelDebug, LevelInfo, LevelWarn, LevelError} {
+		got, err := ParseLogLevel(l.String())
+		if err != nil || got != l {
+			t.Errorf("%v: got %v, %v", l, got, err)
+		}
+	}
+	if got, err := ParseLogLevel("WARN"); err != nil || got != LevelWarn {
+		t.Errorf("got %v, %v, want %v", got, err, LevelWarn)
+	}
+	if _, err := ParseLogLevel("fatal"); err == nil {
+		t.Error("got no error for an unknown level")
+	}
+}
@@ -1,5 +1,13 @@
 package appdash
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
 // multiStore is like a normal store except all operations occur on the multiple
 // underlying stores.
 type multiStore struct {
@@ -49,7 +57,9 @@ type multiQueryer struct {
 }
 
 // Traces implements the Queryer interface by returning the union of all
-// underlying stores.
+// underlying stores, with the filters of opts. The union is limited to
+// opts.Limit traces, the most recent ones (by the start of their root
+// span) if there are more.
 //
 // It panics if any underlying store does not implement the appdash Queryer
 // interface.
@@ -58,8 +68,10 @@ func (mq *multiQueryer) Traces(opts TracesOpts) ([]*Trace, error) {
 		union = make(map[ID]struct{})
 		all   []*Trace
 	)
+	unlimited := opts
+	unlimited.Limit = 0
 	for _, q := range mq.queryers {
-		traces, err := q.Traces(TracesOpts{})
+		traces, err := q.Traces(unlimited)
 		if err != nil {
 			return nil, err
 		}
@@ -70,6 +82,16 @@ func (mq *multiQueryer) Traces(opts TracesOpts) ([]*Trace, error) {
 			}
 		}
 	}
+	if opts.Limit > 0 && len(all) > opts.Limit {
+		starts := make(map[*Trace]time.Time, len(all))
+		for _, t := range all {
+			starts[t], _, _ = t.times()
+		}
+		sort.SliceStable(all, func(i, j int) bool {
+			return starts[all[i]].After(starts[all[j]])
+		})
+		all = all[:opts.Limit]
+	}
 	return all, nil
 }
 
@@ -80,3 +102,220 @@ func MultiQueryer(q ...Queryer) Queryer {
 		queryers: q,
 	}
 }
+
+// teeStore is a store that writes to multiple underlying stores and reads
+// from a designated one.
+type teeStore struct {
+	read   Store
+	writes []Store
+}
+
+// NewMultiStore returns a store whose Collect (and Delete) calls are made on
+// each of the write stores, and whose Trace, Traces and Aggregate calls are
+// made on the read store. The read store is usually one of the write stores,
+// e.g. a local MemoryStore that also receives spans sent to a remote store.
+//
+// A failing write store does not prevent the call from being made on the
+// others; the returned error is then a MultiStoreError identifying each
+// store that failed. Delete is only called on the write stores that
+// implement DeleteStore.
+//
+// The returned store implements the DeleteStore, Queryer, Aggregator and
+// Counter interfaces; Traces, Aggregate and the counts return an error if
+// the read store does not implement Queryer, Aggregator or Counter,
+// respectively.
+func NewMultiStore(read Store, writes ...Store) Store {
+	return &teeStore{read: read, writes: writes}
+}
+
+// Compile-time "implements" check.
+var _ interface {
+	DeleteStore
+	Queryer
+	Aggregator
+	Counter
+} = (*teeStore)(nil)
+
+// Collect implements the Collector interface.
+func (ts *teeStore) Collect(id SpanID, anns ...Annotation) error {
+	var errs MultiStoreError
+	for i, s := range ts.writes {
+		if err := s.Collect(id, anns...); err != nil {
+			errs = append(errs, &StoreError{Index: i, Store: s, Err: err})
+		}
+	}
+	return errs.err()
+}
+
+// Trace implements the Store interface.
+func (ts *teeStore) Trace(id ID) (*Trace, error) {
+	return ts.read.Trace(id)
+}
+
+// Traces implements the Queryer interface.
+func (ts *teeStore) Traces(opts TracesOpts) ([]*Trace, error) {
+	return queryTraces(ts.read, opts)
+}
+
+// Aggregate implements the Aggregator interface.
+func (ts *teeStore) Aggregate(start, end time.Duration) ([]*AggregatedResult, error) {
+	return aggregate(ts.read, start, end)
+}
+
+// NumTraces implements the Counter interface.
+func (ts *teeStore) NumTraces() (int, error) {
+	return numTraces(ts.read)
+}
+
+// NumSpans implements the Counter interface.
+func (ts *teeStore) NumSpans() (int, error) {
+	return numSpans(ts.read)
+}
+
+// Delete implements the DeleteStore interface.
+func (ts *teeStore) Delete(traces ...ID) error {
+	var errs MultiStoreError
+	for i, s := range ts.writes {
+		ds, ok := s.(DeleteStore)
+		if !ok {
+			continue
+		}
+		if err := ds.Delete(traces...); err != nil {
+			errs = append(errs, &StoreError{Index: i, Store: s, Err: err})
+		}
+	}
+	return errs.err()
+}
+
+// A StoreError is the error returned by one of the write stores of a store
+// created by NewMultiStore.
+type StoreError struct {
+	Index int   // index of the store in NewMultiStore's writes
+	Store Store // the store that failed
+	Err   error // the error returned by the store
+}
+
+func (e *StoreError) Error() string {
+	return fmt.Sprintf("store %d (%T): %s", e.Index, e.Store, e.Err)
+}
+
+// A MultiStoreError is returned by stores created by NewMultiStore when some
+// of their write stores fail.
+type MultiStoreError []*StoreError
+
+func (e MultiStoreError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return "appdash: multi store: " + strings.Join(msgs, "; ")
+}
+
+// err returns e as an error, or nil if it is empty.
+func (e MultiStoreError) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// multiCollector is a collector that sends each collection to multiple
+// underlying collectors.
+type multiCollector struct {
+	collectors []Collector
+}
+
+// NewMultiCollector returns a collector whose Collect calls are made on each
+// of the given collectors, for example to send spans both to a local
+// appdash server and to a central one.
+//
+// A failing collector does not prevent the call from being made on the
+// others; the returned error is then a MultiCollectorError identifying each
+// collector that failed. To only count the errors of a collector whose
+// delivery is not essential, wrap it with NewBestEffortCollector.
+func NewMultiCollector(collectors ...Collector) Collector {
+	return &multiCollector{collectors: collectors}
+}
+
+// Collect implements the Collector interface.
+func (mc *multiCollector) Collect(id SpanID, anns ...Annotation) error {
+	var errs MultiCollectorError
+	for i, c := range mc.collectors {
+		if err := c.Collect(id, anns...); err != nil {
+			errs = append(errs, &CollectorError{Index: i, Collector: c, Err: err})
+		}
+	}
+	return errs.err()
+}
+
+// A CollectorError is the error returned by one of the collectors of a
+// collector created by NewMultiCollector.
+type CollectorError struct {
+	Index     int       // index of the collector in NewMultiCollector's collectors
+	Collector Collector // the collector that failed
+	Err       error     // the error returned by the collector
+}
+
+func (e *CollectorError) Error() string {
+	return fmt.Sprintf("collector %d (%T): %s", e.Index, e.Collector, e.Err)
+}
+
+// Unwrap returns the error returned by the collector.
+func (e *CollectorError) Unwrap() error { return e.Err }
+
+// A MultiCollectorError is returned by collectors created by
+// NewMultiCollector when some of their collectors fail.
+type MultiCollectorError []*CollectorError
+
+func (e MultiCollectorError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return "appdash: multi collector: " + strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the errors of the collectors that failed, so that
+// errors.Is and errors.As look into them.
+func (e MultiCollectorError) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// err returns e as an error, or nil if it is empty.
+func (e MultiCollectorError) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// NewBestEffortCollector returns a collector that passes the collections to
+// c, but counts its errors (see Errors) instead of returning them.
+func NewBestEffortCollector(c Collector) *BestEffortCollector {
+	return &BestEffortCollector{c: c}
+}
+
+// A BestEffortCollector is a collector whose errors are ignored. See
+// NewBestEffortCollector.
+type BestEffortCollector struct {
+	c      Collector
+	errors uint64 // accessed atomically
+}
+
+// Collect implements the Collector interface. It always returns nil.
+func (bc *BestEffortCollector) Collect(id SpanID, anns ...Annotation) error {
+	if err := bc.c.Collect(id, anns...); err != nil {
+		atomic.AddUint64(&bc.errors, 1)
+	}
+	return nil
+}
+
+// Errors returns the number of collections that the underlying collector
+// failed to collect.
+func (bc *BestEffortCollector) Errors() uint64 {
+	return atomic.LoadUint64(&bc.errors)
+}
@@ -0,0 +1,136 @@
+package appdash
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failingStore is a Store whose Collect always fails.
+type failingStore struct {
+	Store
+}
+
+func (failingStore) Collect(SpanID, ...Annotation) error {
+	return errors.New("backend down")
+}
+
+func TestNewMultiStore(t *testing.T) {
+	local, remote := NewMemoryStore(), NewMemoryStore()
+	s := NewMultiStore(local, failingStore{}, local, remote)
+
+	err := s.Collect(SpanID{Trace: 1, Span: 1, Parent: 0})
+	merr, ok := err.(MultiStoreError)
+	if !ok || len(merr) != 1 || merr[0].Index != 0 {
+		t.Fatalf("got error %v, want a MultiStoreError for store 0", err)
+	}
+	if !strings.Contains(err.Error(), "store 0") || !strings.Contains(err.Error(), "backend down") {
+		t.Errorf("got error message %q, want it to identify store 0", err)
+	}
+
+	// Writes to the other stores were not lost.
+	for _, ms := range []*MemoryStore{local, remote} {
+		if _, err := ms.Trace(1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	traces, err := s.(Queryer).Traces(TracesOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(traces) != 1 {
+		t.Errorf("got %d traces, want 1", len(traces))
+	}
+
+	if err := s.(DeleteStore).Delete(1); err != nil {
+		t.Fatal(err)
+	}
+	for _, ms := range []*MemoryStore{local, remote} {
+		if _, err := ms.Trace(1); err != ErrTraceNotFound {
+			t.Errorf("got error %v after Delete, want ErrTraceNotFound", err)
+		}
+	}
+}
+
+func TestMultiQueryer(t *testing.T) {
+	a, b := NewMemoryStore(), NewMemoryStore()
+	start := time.Now().Add(-time.Hour)
+	collect := func(s Collector, trace ID, at time.Duration) {
+		rec := NewRecorder(SpanID{Trace: trace, Span: trace}, s)
+		rec.Event(Timespan{S: start.Add(at), E: start.Add(at + time.Second)})
+		rec.Finish()
+	}
+	collect(a, 1, 0)
+	collect(a, 2, 2*time.Minute)
+	collect(b, 3, time.Minute)
+	collect(b, 4, 3*time.Minute)
+	collect(b, 2, 2*time.Minute)
+	q := MultiQueryer(a, b)
+
+	ids := func(opts TracesOpts) []ID {
+		t.Helper()
+		traces, err := q.Traces(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []ID
+		for _, t := range traces {
+			ids = append(ids, t.ID.Trace)
+		}
+		return ids
+	}
+	if got, want := ids(TracesOpts{Limit: 2}), []ID{4, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got traces %v with Limit, want the most recent ones %v", got, want)
+	}
+	if got, want := ids(TracesOpts{TraceIDs: []ID{1, 3}}), []ID{1, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got traces %v with TraceIDs, want %v", got, want)
+	}
+	ts := Timespan{S: start.Add(90 * time.Second), E: start.Add(150 * time.Second)}
+	if got, want := ids(TracesOpts{Timespan: ts}), []ID{2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got traces %v with Timespan, want %v", got, want)
+	}
+}
+
+func TestNewMultiCollector(t *testing.T) {
+	local, central := NewMemoryStore(), NewMemoryStore()
+
+	// One collector failing.
+	c := NewMultiCollector(local, failingStore{}, central)
+	err := c.Collect(SpanID{Trace: 1, Span: 1, Parent: 0})
+	merr, ok := err.(MultiCollectorError)
+	if !ok || len(merr) != 1 || merr[0].Index != 1 {
+		t.Fatalf("got error %v, want a MultiCollectorError for collector 1", err)
+	}
+	if !strings.Contains(err.Error(), "collector 1") || !strings.Contains(err.Error(), "backend down") {
+		t.Errorf("got error message %q, want it to identify collector 1", err)
+	}
+	// Delivery to the other collectors was not prevented.
+	for _, ms := range []*MemoryStore{local, central} {
+		if _, err := ms.Trace(1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// All collectors failing.
+	c = NewMultiCollector(failingStore{}, failingStore{})
+	err = c.Collect(SpanID{Trace: 2, Span: 2, Parent: 0})
+	if merr, ok := err.(MultiCollectorError); !ok || len(merr) != 2 || merr[0].Index != 0 || merr[1].Index != 1 {
+		t.Fatalf("got error %v, want a MultiCollectorError for collectors 0 and 1", err)
+	}
+
+	// Best-effort collectors only count their errors.
+	bc := NewBestEffortCollector(failingStore{})
+	c = NewMultiCollector(central, bc)
+	if err := c.Collect(SpanID{Trace: 3, Span: 3, Parent: 0}); err != nil {
+		t.Fatal(err)
+	}
+	if got := bc.Errors(); got != 1 {
+		t.Errorf("got %d best-effort errors, want 1", got)
+	}
+	if _, err := central.Trace(3); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,230 @@
+// Package natscollector provides a collector that publishes spans to a
+// NATS subject, and a subscriber that receives them into a store, for
+// infrastructures where NATS is already the transport for internal
+// messaging.
+//
+// On the client side, the collector is typically wrapped in a
+// ChunkedCollector, whose AfterFlush callback and LastError method report
+// the publish errors:
+//
+//	conn, err := natscollector.Connect("nats://nats.example.com:4222")
+//	if err != nil {
+//		// handle error
+//	}
+//	collector := appdash.NewChunkedCollector(natscollector.NewCollector(conn, "appdash.spans"))
+//
+// On the server side, the subscribers of several appdash servers can share
+// the load by using the same queue group:
+//
+//	s := natscollector.NewSubscriber(conn, "appdash.spans", "appdash", store)
+//	if err := s.Start(); err != nil {
+//		// handle error
+//	}
+package natscollector
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/nats-io/nats.go"
+
+	"sourcegraph.com/sourcegraph/appdash"
+	"sourcegraph.com/sourcegraph/appdash/internal/packet"
+	"sourcegraph.com/sourcegraph/appdash/internal/wire"
+)
+
+// DefaultFlushTimeout is the default timeout of Collector.Flush.
+const DefaultFlushTimeout = 5 * time.Second
+
+// Connect connects to the NATS server at url, like nats.Connect, except
+// that the connection tries to reconnect forever (instead of giving up
+// after nats.DefaultMaxReconnect attempts) when it is lost. The given
+// options are applied after that default, and so may override it.
+//
+// While it is reconnecting, the client buffers published messages (see
+// nats.ReconnectBufSize) and restores the subscriptions once reconnected.
+func Connect(url string, options ...nats.Option) (*nats.Conn, error) {
+	return nats.Connect(url, append([]nats.Option{nats.MaxReconnects(-1)}, options...)...)
+}
+
+// NewCollector creates a collector that publishes data to subject over
+// conn.
+func NewCollector(conn *nats.Conn, subject string) *Collector {
+	return &Collector{conn: conn, subject: subject}
+}
+
+// A Collector publishes each collection to a NATS subject, as messages
+// that each hold a CollectPacket (without the length prefix of the TCP
+// protocol). The annotations of a collection that would exceed the
+// maximum payload of the server are split over several messages for the
+// same span. A single annotation that exceeds it on its own is dropped,
+// and Collect returns appdash.ErrMessageTooLarge.
+//
+// Like nats.Conn.Publish, Collect does not wait for the messages to reach
+// the server. Call Flush (which a ChunkedCollector does after each of its
+// flushes) to make sure that they did. NATS delivers messages at most
+// once: those published while no subscriber is listening are lost.
+type Collector struct {
+	conn    *nats.Conn
+	subject string
+
+	// MaxMessageSize is the maximum size in bytes of a message.
+	//
+	// Default MaxMessageSize = the maximum payload of the server.
+	MaxMessageSize int
+
+	// FlushTimeout is the maximum time that Flush waits for the server to
+	// acknowledge the messages.
+	//
+	// Default FlushTimeout = DefaultFlushTimeout.
+	FlushTimeout time.Duration
+}
+
+// Collect implements the appdash.Collector interface by publishing the
+// events that occured in the span to the subject.
+func (c *Collector) Collect(span appdash.SpanID, anns ...appdash.Annotation) error {
+	maxSize := c.MaxMessageSize
+	if maxSize <= 0 {
+		maxSize = int(c.conn.MaxPayload())
+	}
+	var tooLarge bool
+	for _, p := range packet.Split(span, anns, maxSize) {
+		data, err := proto.Marshal(p)
+		if err != nil {
+			return err
+		}
+		if maxSize > 0 && len(data) > maxSize {
+			tooLarge = true
+			continue
+		}
+		if err := c.conn.Publish(c.subject, data); err != nil {
+			return err
+		}
+	}
+	if tooLarge {
+		return appdash.ErrMessageTooLarge
+	}
+	return nil
+}
+
+// Flush waits until the server has received all of the messages published
+// by Collect. While the connection is reconnecting, the messages are
+// buffered by the client and Flush returns immediately.
+func (c *Collector) Flush() error {
+	if c.conn.IsReconnecting() {
+		return nil
+	}
+	timeout := c.FlushTimeout
+	if timeout <= 0 {
+		timeout = DefaultFlushTimeout
+	}
+	if err := c.conn.FlushTimeout(timeout); err != nil {
+		return fmt.Errorf("natscollector: flush: %s", err)
+	}
+	return nil
+}
+
+// NewSubscriber creates a subscriber that receives the data published by
+// Collectors to subject over conn, and adds it to the collector c
+// (typically an appdash.Store). If queue is not empty, the subscribers
+// with the same queue group share the messages, each of which is received
+// by only one of them.
+//
+// Call the Subscriber's Start method to start receiving messages.
+func NewSubscriber(conn *nats.Conn, subject, queue string, c appdash.Collector) *Subscriber {
+	return &Subscriber{conn: conn, subject: subject, queue: queue, c: c}
+}
+
+// A Subscriber receives spans and annotations from a NATS subject and adds
+// them to a local collector. Messages that can't be decoded are counted
+// (see Rejected) and dropped.
+type Subscriber struct {
+	conn    *nats.Conn
+	subject string
+	queue   string
+	c       appdash.Collector
+
+	// Log is the logger to use for errors and warnings. If nil, a new
+	// logger is created.
+	Log   *log.Logger
+	logMu sync.Mutex
+
+	// Debug is whether to log debug messages.
+	Debug bool
+
+	mu  sync.Mutex         // guards sub
+	sub *nats.Subscription // the subscription, once started
+
+	rejected uint64 // number of rejected messages (accessed atomically)
+}
+
+// Start subscribes to the subject. The messages are received in the
+// background, until Close is called.
+func (s *Subscriber) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sub != nil {
+		return nil
+	}
+	var err error
+	if s.queue != "" {
+		s.sub, err = s.conn.QueueSubscribe(s.subject, s.queue, s.handle)
+	} else {
+		s.sub, err = s.conn.Subscribe(s.subject, s.handle)
+	}
+	return err
+}
+
+// Close unsubscribes from the subject. The messages that were already
+// received are still handled in the background. The connection is not
+// closed.
+func (s *Subscriber) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sub == nil {
+		return nil
+	}
+	err := s.sub.Drain()
+	s.sub = nil
+	return err
+}
+
+// Rejected returns the number of messages that the subscriber dropped
+// because they could not be decoded.
+func (s *Subscriber) Rejected() uint64 {
+	return atomic.LoadUint64(&s.rejected)
+}
+
+// handle is the nats.MsgHandler of the subscription.
+func (s *Subscriber) handle(msg *nats.Msg) {
+	p := &wire.CollectPacket{}
+	if err := proto.Unmarshal(msg.Data, p); err != nil {
+		atomic.AddUint64(&s.rejected, 1)
+		if s.Debug {
+			s.log().Printf("Rejected message of %d bytes: %s", len(msg.Data), err)
+		}
+		return
+	}
+
+	span := packet.SpanID(p)
+	if s.Debug {
+		s.log().Printf("Received span %v with %d annotations", span, len(p.Annotation))
+	}
+	if err := s.c.Collect(span, packet.Annotations(p)...); err != nil {
+		s.log().Printf("Collect %v: %s", span, err)
+	}
+}
+
+func (s *Subscriber) log() *log.Logger {
+	s.logMu.Lock()
+	defer s.logMu.Unlock()
+	if s.Log == nil {
+		s.Log = log.New(os.Stderr, fmt.Sprintf("natscollector.Subscriber[%s]: ", s.subject), log.LstdFlags|log.Lmicroseconds)
+	}
+	return s.Log
+}
@@ -0,0 +1,421 @@
+package natscollector
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"sourcegraph.com/sourcegraph/appdash"
+)
+
+// fakeServer is a minimal NATS server, which supports the parts of the
+// protocol used by the collector and the subscriber (without wildcards).
+type fakeServer struct {
+	l          net.Listener
+	maxPayload int
+
+	mu    sync.Mutex
+	conns map[net.Conn]bool
+	subs  []*fakeSub
+	next  map[string]int // next subscriber of each queue group
+	pubs  int            // number of messages published
+}
+
+type fakeSub struct {
+	conn                *fakeConn
+	subject, queue, sid string
+}
+
+type fakeConn struct {
+	net.Conn
+	mu sync.Mutex // guards writes
+}
+
+func (c *fakeConn) send(format string, args ...interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(c, format, args...)
+}
+
+func startFakeServer(t *testing.T, maxPayload int) *fakeServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{l: l, maxPayload: maxPayload, conns: map[net.Conn]bool{}, next: map[string]int{}}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns[c] = true
+			s.mu.Unlock()
+			go s.serve(&fakeConn{Conn: c})
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) url() string { return "nats://" + s.l.Addr().String() }
+
+// kick closes the connections of all clients (which then reconnect).
+func (s *fakeServer) kick() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		c.Close()
+	}
+}
+
+func (s *fakeServer) close() {
+	s.l.Close()
+	s.kick()
+}
+
+func (s *fakeServer) published() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pubs
+}
+
+func (s *fakeServer) serve(c *fakeConn) {
+	defer func() {
+		c.Close()
+		s.mu.Lock()
+		delete(s.conns, c.Conn)
+		var subs []*fakeSub
+		for _, sub := range s.subs {
+			if sub.conn != c {
+				subs = append(subs, sub)
+			}
+		}
+		s.subs = subs
+		s.mu.Unlock()
+	}()
+
+	c.send("INFO {\"server_id\":\"fake\",\"proto\":1,\"max_payload\":%d}\r\n", s.maxPayload)
+	r := bufio.NewReader(c)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		f := strings.Fields(line)
+		if len(f) == 0 {
+			continue
+		}
+		switch strings.ToUpper(f[0]) {
+		case "PING":
+			c.send("PONG\r\n")
+		case "SUB":
+			sub := &fakeSub{conn: c, subject: f[1], sid: f[len(f)-1]}
+			if len(f) == 4 {
+				sub.queue = f[2]
+			}
+			s.mu.Lock()
+			s.subs = append(s.subs, sub)
+			s.mu.Unlock()
+		case "UNSUB":
+			s.mu.Lock()
+			for i, sub := range s.subs {
+				if sub.conn == c && sub.sid == f[1] {
+					s.subs = append(s.subs[:i], s.subs[i+1:]...)
+					break
+				}
+			}
+			s.mu.Unlock()
+		case "PUB":
+			n, err := strconv.Atoi(f[len(f)-1])
+			if err != nil {
+				return
+			}
+			data := make([]byte, n+2) // with the trailing \r\n
+			if _, err := io.ReadFull(r, data); err != nil {
+				return
+			}
+			s.publish(f[1], data[:n])
+		}
+	}
+}
+
+// publish delivers a message to all of the subscribers of subject that
+// are not in a queue group, and to one subscriber of each queue group.
+func (s *fakeServer) publish(subject string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pubs++
+	queues := map[string][]*fakeSub{}
+	for _, sub := range s.subs {
+		if sub.subject != subject {
+			continue
+		}
+		if sub.queue != "" {
+			queues[sub.queue] = append(queues[sub.queue], sub)
+			continue
+		}
+		sub.conn.send("MSG %s %s %d\r\n%s\r\n", subject, sub.sid, len(data), data)
+	}
+	for queue, subs := range queues {
+		sub := subs[s.next[queue]%len(subs)]
+		s.next[queue]++
+		sub.conn.send("MSG %s %s %d\r\n%s\r\n", subject, sub.sid, len(data), data)
+	}
+}
+
+func connect(t *testing.T, s *fakeServer) *nats.Conn {
+	conn, err := Connect(s.url(), nats.ReconnectWait(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func startSubscriber(t *testing.T, conn *nats.Conn, queue string, c appdash.Collector) *Subscriber {
+	sub := NewSubscriber(conn, "spans", queue, c)
+	sub.Log = log.New(ioutil.Discard, "", 0)
+	if err := sub.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// Make sure that the server processed the subscription.
+	if err := conn.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return sub
+}
+
+// waitForAnnotations waits until the span in store has n annotations,
+// and returns them.
+func waitForAnnotations(t *testing.T, store *appdash.MemoryStore, span appdash.SpanID, n int) appdash.Annotations {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if trace, err := store.Trace(span.Trace); err == nil && len(trace.Annotations) >= n {
+			return trace.Annotations
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("span %v: timed out waiting for %d annotations", span, n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCollector(t *testing.T) {
+	s := startFakeServer(t, 512)
+	defer s.close()
+	conn := connect(t, s)
+	defer conn.Close()
+
+	store := appdash.NewMemoryStore()
+	sub := startSubscriber(t, conn, "", store)
+	defer sub.Close()
+
+	// The annotations don't fit in a single message.
+	c := NewCollector(conn, "spans")
+	span := appdash.SpanID{Trace: 1, Span: 2, Parent: 0}
+	var anns appdash.Annotations
+	for i := 0; i < 20; i++ {
+		anns = append(anns, appdash.Annotation{Key: fmt.Sprintf("k%d", i), Value: []byte(strings.Repeat("v", 50))})
+	}
+	if err := c.Collect(span, anns...); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := waitForAnnotations(t, store, span, len(anns)); !reflect.DeepEqual(got, anns) {
+		t.Errorf("got annotations %v, want %v", got, anns)
+	}
+	if n := s.published(); n < 2 {
+		t.Errorf("got %d messages published, want the annotations split over several", n)
+	}
+
+	// A single annotation that doesn't fit is dropped.
+	span2 := appdash.SpanID{Trace: 3, Span: 4, Parent: 0}
+	if err := c.Collect(span2, appdash.Annotation{Key: "big", Value: make([]byte, 600)}, appdash.Annotation{Key: "small"}); err != appdash.ErrMessageTooLarge {
+		t.Errorf("got error %v, want ErrMessageTooLarge", err)
+	}
+	if got, want := waitForAnnotations(t, store, span2, 1), (appdash.Annotations{{Key: "small"}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got annotations %v, want %v", got, want)
+	}
+
+	// Bad messages are rejected.
+	if err := conn.Publish("spans", []byte{0xff, 0xff, 0xff}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for sub.Rejected() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d rejected messages, want 1", sub.Rejected())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSubscriber_queue(t *testing.T) {
+	s := startFakeServer(t, 1024*1024)
+	defer s.close()
+
+	var (
+		mu       sync.Mutex
+		received = map[appdash.SpanID]int{}
+		counts   [2]int
+	)
+	for i := range counts {
+		i := i
+		conn := connect(t, s)
+		defer conn.Close()
+		sub := startSubscriber(t, conn, "appdash", collectorFunc(func(span appdash.SpanID, anns ...appdash.Annotation) error {
+			mu.Lock()
+			defer mu.Unlock()
+			received[span]++
+			counts[i]++
+			return nil
+		}))
+		defer sub.Close()
+	}
+
+	conn := connect(t, s)
+	defer conn.Close()
+	c := NewCollector(conn, "spans")
+	for i := appdash.ID(1); i <= 10; i++ {
+		if err := c.Collect(appdash.SpanID{Trace: i, Span: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(received)
+		mu.Unlock()
+		if n == 10 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d spans, want 10", n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for span, n := range received {
+		if n != 1 {
+			t.Errorf("span %v received %d times, want once", span, n)
+		}
+	}
+	if counts[0] == 0 || counts[1] == 0 {
+		t.Errorf("got %v spans per subscriber, want the load shared", counts)
+	}
+}
+
+func TestCollector_reconnect(t *testing.T) {
+	s := startFakeServer(t, 1024*1024)
+	defer s.close()
+	conn := connect(t, s)
+	defer conn.Close()
+
+	store := appdash.NewMemoryStore()
+	sub := startSubscriber(t, conn, "", store)
+	defer sub.Close()
+
+	// The client reconnects and restores the subscription.
+	s.kick()
+	deadline := time.Now().Add(5 * time.Second)
+	for !conn.IsConnected() || conn.Stats().Reconnects == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the client to reconnect")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	c := NewCollector(conn, "spans")
+	span := appdash.SpanID{Trace: 1, Span: 1}
+	if err := c.Collect(span, appdash.Annotation{Key: "k"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	waitForAnnotations(t, store, span, 1)
+}
+
+func TestCollector_error(t *testing.T) {
+	s := startFakeServer(t, 1024*1024)
+	defer s.close()
+	conn := connect(t, s)
+
+	// Publish errors are reported by the ChunkedCollector's flushes.
+	var flushErr error
+	cc := appdash.NewChunkedCollector(NewCollector(conn, "spans"))
+	cc.Log = nil
+	cc.AfterFlush = func(spans int, err error) { flushErr = err }
+	conn.Close()
+	if err := cc.Collect(appdash.SpanID{Trace: 1, Span: 1}); err != nil {
+		t.Fatal(err)
+	}
+	err := cc.Flush()
+	if err == nil || !strings.Contains(err.Error(), nats.ErrConnectionClosed.Error()) {
+		t.Errorf("got Flush error %v, want %v", err, nats.ErrConnectionClosed)
+	}
+	if flushErr != err {
+		t.Errorf("got AfterFlush error %v, want %v", flushErr, err)
+	}
+	cc.Stop()
+}
+
+// TestIntegration sends spans through the NATS server at $APPDASH_NATS_URL.
+func TestIntegration(t *testing.T) {
+	url := os.Getenv("APPDASH_NATS_URL")
+	if url == "" {
+		t.Skip("skipping test; $APPDASH_NATS_URL is not set")
+	}
+	conn, err := Connect(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	store := appdash.NewMemoryStore()
+	sub := NewSubscriber(conn, "appdash.test.spans", "appdash", store)
+	if err := sub.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	if err := conn.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCollector(conn, "appdash.test.spans")
+	span := appdash.NewRootSpanID()
+	anns := appdash.Annotations{{Key: "k", Value: []byte("v")}}
+	if err := c.Collect(span, anns...); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := waitForAnnotations(t, store, span, 1); !reflect.DeepEqual(got, anns) {
+		t.Errorf("got annotations %v, want %v", got, anns)
+	}
+}
+
+type collectorFunc func(appdash.SpanID, ...appdash.Annotation) error
+
+func (c collectorFunc) Collect(span appdash.SpanID, anns ...appdash.Annotation) error {
+	return c(span, anns...)
+}
@@ -0,0 +1,8 @@
+//go:build !race
+// +build !race
+
+package appdash
+
+// raceEnabled is whether this is a race build, whose instrumentation
+// allocates.
+const raceEnabled = false
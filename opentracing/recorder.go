@@ -67,13 +67,21 @@ func (r *Recorder) RecordSpan(sp basictracer.RawSpan) {
 		r.collectAnnotation(spanID, appdash.Annotation{Key: key, Value: val})
 	}
 
+	// Baggage items are recorded both under their plain keys, as they
+	// always have been here, and as those of appdash.Recorder are (see
+	// appdash.BaggagePrefix), so that the spans of both can be queried
+	// alike. The tracer carries them across process boundaries, in its own
+	// "ot-baggage-" prefixed headers.
 	for key, val := range sp.Context.Baggage {
-		r.collectAnnotation(spanID, appdash.Annotation{Key: key, Value: []byte(val)})
+		r.collectAnnotation(spanID,
+			appdash.Annotation{Key: key, Value: []byte(val)},
+			appdash.Annotation{Key: appdash.BaggagePrefix + key, Value: []byte(val)},
+		)
 	}
 
 	// Add the duration to the start time to get an approximate end time.
 	approxEndTime := sp.Start.Add(sp.Duration)
-	r.collectEvent(spanID, appdash.Timespan{S: sp.Start, E: approxEndTime})
+	r.collectEvent(spanID, appdash.Timespan{S: sp.Start, E: approxEndTime, D: sp.Duration})
 }
 
 // collectEvent marshals and collects the Event.
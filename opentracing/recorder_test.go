@@ -53,12 +53,12 @@ func TestOpentracingRecorder(t *testing.T) {
 	r.RecordSpan(raw)
 	r.RecordSpan(unsampledRaw)
 
-	tsAnnotations := marshalEvent(appdash.Timespan{raw.Start, raw.Start.Add(raw.Duration)})
+	tsAnnotations := marshalEvent(appdash.Timespan{S: raw.Start, E: raw.Start.Add(raw.Duration), D: raw.Duration})
 	want := []*wire.CollectPacket{
-		newCollectPacket(appdash.SpanID{1, 2, 3}, appdash.Annotations{{"tag", []byte("1")}}),
-		newCollectPacket(appdash.SpanID{1, 2, 3}, appdash.Annotations{{baggageKey, []byte(baggageVal)}}),
-		newCollectPacket(appdash.SpanID{1, 2, 3}, marshalEvent(appdash.SpanName(opName))),
-		newCollectPacket(appdash.SpanID{1, 2, 3}, tsAnnotations),
+		newCollectPacket(appdash.SpanID{Trace: 1, Span: 2, Parent: 3}, appdash.Annotations{{"tag", []byte("1")}}),
+		newCollectPacket(appdash.SpanID{Trace: 1, Span: 2, Parent: 3}, appdash.Annotations{{baggageKey, []byte(baggageVal)}, {appdash.BaggagePrefix + baggageKey, []byte(baggageVal)}}),
+		newCollectPacket(appdash.SpanID{Trace: 1, Span: 2, Parent: 3}, marshalEvent(appdash.SpanName(opName))),
+		newCollectPacket(appdash.SpanID{Trace: 1, Span: 2, Parent: 3}, tsAnnotations),
 	}
 
 	sort.Sort(byTraceID(packets))
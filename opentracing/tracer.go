@@ -60,6 +60,9 @@ func DefaultOptions() Options {
 //
 //   tracer := NewTracer(chunkedCollector)
 //
+// The chunked collector should be closed (with chunkedCollector.Close()) when
+// the program exits, so that the spans that are still buffered are written.
+//
 // If writing traces to a remote Appdash collector, an appdash.RemoteCollector would
 // be needed, for example:
 //
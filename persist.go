@@ -0,0 +1,174 @@
+package appdash
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// A file written by WriteFile consists of the data written by the store's
+// Write method, followed by a trailer holding the length of that data, its
+// CRC-32 checksum and persistMagic.
+var persistMagic = []byte("appdash-crc32\n")
+
+const persistTrailerSize = 8 + 4
+
+// prevFile returns the name of the file in which WriteFile keeps the
+// previous snapshot of file.
+func prevFile(file string) string {
+	return file + ".prev"
+}
+
+// WriteFile atomically persists s's data to file. The data, followed by a
+// checksum, is written to a temporary file in the same directory and
+// fsynced before it replaces file, so that file is never left partially
+// written, even if the machine loses power. The previous contents of file
+// are kept in file + ".prev", for ReadFile to fall back to.
+func WriteFile(s PersistentStore, file string) error {
+	f, err := ioutil.TempFile(filepath.Dir(file), "appdash")
+	if err != nil {
+		return err
+	}
+	if err := writeChecksummed(f, s); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := os.Rename(file, prevFile(file)); err != nil && !os.IsNotExist(err) {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), file); err != nil {
+		return err
+	}
+
+	// Make the renames durable. Not all platforms support syncing a
+	// directory, so errors are ignored.
+	if dir, err := os.Open(filepath.Dir(file)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+// writeChecksummed writes s's data to w, followed by the trailer.
+func writeChecksummed(w io.Writer, s PersistentStore) error {
+	sum := crc32.NewIEEE()
+	cw := &countingWriter{w: io.MultiWriter(w, sum)}
+	if err := s.Write(cw); err != nil {
+		return err
+	}
+	trailer := make([]byte, persistTrailerSize, persistTrailerSize+len(persistMagic))
+	binary.BigEndian.PutUint64(trailer[0:8], uint64(cw.n))
+	binary.BigEndian.PutUint32(trailer[8:12], sum.Sum32())
+	trailer = append(trailer, persistMagic...)
+	_, err := w.Write(trailer)
+	return err
+}
+
+// ReadFile loads the data persisted to file by WriteFile (or PersistEvery)
+// into s, and returns the number of traces read. It is not an error if
+// neither file nor a previous snapshot of it exists.
+//
+// If file is missing, truncated or fails its checksum, ReadFile logs the
+// problem and loads the previous snapshot (see WriteFile) instead; the data
+// persisted after it is lost. If strict is true, it instead returns an
+// error, so that the caller can decide what to do.
+//
+// Files written by older versions, without a checksum, are loaded as is.
+func ReadFile(s PersistentStore, file string, strict bool) (int64, error) {
+	n, err := readFile(s, file)
+	if err == nil {
+		return n, nil
+	}
+	if !os.IsNotExist(err) {
+		if strict {
+			return 0, err
+		}
+		log.Printf("%s; falling back to the previous snapshot", err)
+	}
+
+	prev := prevFile(file)
+	n, prevErr := readFile(s, prev)
+	if prevErr == nil {
+		if fi, err := os.Stat(prev); err == nil {
+			log.Printf("appdash: read %d traces from previous snapshot %s; data persisted after %s is lost", n, prev, fi.ModTime())
+		}
+		return n, nil
+	}
+	if os.IsNotExist(err) && os.IsNotExist(prevErr) {
+		return 0, nil
+	}
+	if strict {
+		return 0, prevErr
+	}
+	if !os.IsNotExist(prevErr) {
+		log.Print(prevErr)
+	}
+	log.Printf("appdash: no usable snapshot of %s, starting with an empty store", file)
+	return 0, nil
+}
+
+// readFile loads a single file written by WriteFile into s.
+func readFile(s PersistentStore, file string) (int64, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	size := fi.Size()
+	tail := int64(persistTrailerSize + len(persistMagic))
+	trailer := make([]byte, tail)
+	if size < tail {
+		trailer = nil
+	} else if _, err := f.ReadAt(trailer, size-tail); err != nil {
+		return 0, err
+	}
+	if trailer == nil || !bytes.Equal(trailer[persistTrailerSize:], persistMagic) {
+		// Written without a checksum (or truncated, in which case ReadFrom
+		// will most likely fail).
+		n, err := s.ReadFrom(f)
+		if err != nil {
+			return 0, fmt.Errorf("appdash: reading store file %s: %s", file, err)
+		}
+		return n, nil
+	}
+
+	length := binary.BigEndian.Uint64(trailer[0:8])
+	if length != uint64(size-tail) {
+		return 0, fmt.Errorf("appdash: store file %s is corrupt: got %d bytes of data, want %d", file, size-tail, length)
+	}
+	sum := crc32.NewIEEE()
+	if _, err := io.Copy(sum, io.NewSectionReader(f, 0, int64(length))); err != nil {
+		return 0, err
+	}
+	if got := sum.Sum32(); got != binary.BigEndian.Uint32(trailer[8:12]) {
+		return 0, fmt.Errorf("appdash: store file %s is corrupt: checksum mismatch", file)
+	}
+	n, err := s.ReadFrom(io.NewSectionReader(f, 0, int64(length)))
+	if err != nil {
+		return 0, fmt.Errorf("appdash: reading store file %s: %s", file, err)
+	}
+	return n, nil
+}
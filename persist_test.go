@@ -0,0 +1,97 @@
+package appdash
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFile_ReadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "appdash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "store.gob")
+
+	// Neither the file nor a previous snapshot exists yet.
+	if n, err := ReadFile(NewMemoryStore(), file, true); err != nil || n != 0 {
+		t.Fatalf("got %d traces and error %v, want 0 and no error", n, err)
+	}
+
+	ms := NewMemoryStore()
+	ms.Collect(SpanID{Trace: 1, Span: 1, Parent: 0})
+	if err := WriteFile(ms, file); err != nil {
+		t.Fatal(err)
+	}
+	ms.Collect(SpanID{Trace: 2, Span: 2, Parent: 0})
+	if err := WriteFile(ms, file); err != nil {
+		t.Fatal(err)
+	}
+
+	ms2 := NewMemoryStore()
+	if n, err := ReadFile(ms2, file, true); err != nil || n != 2 {
+		t.Fatalf("got %d traces and error %v, want 2 and no error", n, err)
+	}
+
+	// Corrupt a byte of the latest snapshot.
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)/2] ^= 0xff
+	if err := ioutil.WriteFile(file, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadFile(NewMemoryStore(), file, true); err == nil {
+		t.Error("got no error reading corrupt file in strict mode")
+	}
+	ms3 := NewMemoryStore()
+	if n, err := ReadFile(ms3, file, false); err != nil || n != 1 {
+		t.Fatalf("got %d traces and error %v, want 1 from the previous snapshot", n, err)
+	}
+	if _, err := ms3.Trace(1); err != nil {
+		t.Error(err)
+	}
+
+	// Truncated, as if written in place when the power was lost.
+	if err := ioutil.WriteFile(file, data[:len(data)/2], 0600); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := ReadFile(NewMemoryStore(), file, false); err != nil || n != 1 {
+		t.Fatalf("got %d traces and error %v, want 1 from the previous snapshot", n, err)
+	}
+
+	// Only the previous snapshot exists, as after a crash between
+	// WriteFile's renames.
+	os.Remove(file)
+	if n, err := ReadFile(NewMemoryStore(), file, true); err != nil || n != 1 {
+		t.Fatalf("got %d traces and error %v, want 1 from the previous snapshot", n, err)
+	}
+}
+
+func TestReadFile_noChecksum(t *testing.T) {
+	dir, err := ioutil.TempDir("", "appdash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "store.gob")
+
+	// Written by an older version of PersistEvery.
+	ms := NewMemoryStore()
+	ms.Collect(SpanID{Trace: 1, Span: 1, Parent: 0})
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.Write(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if n, err := ReadFile(NewMemoryStore(), file, true); err != nil || n != 1 {
+		t.Fatalf("got %d traces and error %v, want 1 and no error", n, err)
+	}
+}
@@ -0,0 +1,474 @@
+// Package pgstore implements an appdash.Store backed by PostgreSQL.
+//
+// Each span is stored as a row in the appdash_spans table, with its
+// annotations in a jsonb column. The schema, including its indexes, is
+// created and migrated automatically by New:
+//
+//  - a primary key on (trace_id, span_id), used to look up traces;
+//  - an index on start_time of root spans, used to list recent traces;
+//  - a GIN index on annotations, used by annotation filters (Query).
+//
+// Concurrent Collect calls are grouped into batches, each written in a single
+// transaction, so that the cost of a round trip and commit is shared among
+// them.
+package pgstore
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+
+	"sourcegraph.com/sourcegraph/appdash"
+	"sourcegraph.com/sourcegraph/appdash/internal/tracetree"
+)
+
+// migrations are the schema migrations, applied in order. The number of
+// migrations applied so far is recorded in the appdash_schema table.
+var migrations = []string{
+	`CREATE TABLE appdash_spans (
+		trace_id    bigint NOT NULL,
+		span_id     bigint NOT NULL,
+		parent_id   bigint NOT NULL,
+		start_time  timestamptz NOT NULL,
+		timed       boolean NOT NULL DEFAULT false, -- start_time is from a timespan annotation
+		annotations jsonb NOT NULL DEFAULT '[]',
+		PRIMARY KEY (trace_id, span_id)
+	);
+	CREATE INDEX appdash_spans_root_start_time ON appdash_spans (start_time) WHERE parent_id = 0;
+	CREATE INDEX appdash_spans_annotations ON appdash_spans USING gin (annotations jsonb_path_ops);`,
+}
+
+const (
+	// DefaultMaxBatchSize is the default maximum number of Collect calls
+	// written in a single batch.
+	DefaultMaxBatchSize = 1000
+
+	// DefaultMaxBatchDelay is the default maximum time a Collect call waits
+	// for other calls to join its batch.
+	DefaultMaxBatchDelay = 5 * time.Millisecond
+)
+
+// Store is an appdash.Store and appdash.Queryer backed by PostgreSQL.
+type Store struct {
+	// MaxBatchSize is the maximum number of Collect calls written in a
+	// single batch.
+	MaxBatchSize int
+
+	// MaxBatchDelay is the maximum time a Collect call waits for other calls
+	// to join its batch before the batch is written.
+	MaxBatchDelay time.Duration
+
+	db                     *sql.DB
+	upsertStmt, selectStmt *sql.Stmt
+
+	mu    sync.Mutex
+	batch *batch // batch being filled, if any
+}
+
+// Compile-time "implements" check.
+var _ interface {
+	appdash.DeleteStore
+	appdash.Queryer
+} = (*Store)(nil)
+
+// Open opens a PostgreSQL database using the lib/pq driver and the given
+// connection string, and returns a store backed by it.
+func Open(dataSourceName string) (*Store, error) {
+	db, err := sql.Open("postgres", dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+	s, err := New(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// New returns a store backed by an already opened PostgreSQL database,
+// migrating its schema if needed.
+func New(db *sql.DB) (*Store, error) {
+	s := &Store{
+		MaxBatchSize:  DefaultMaxBatchSize,
+		MaxBatchDelay: DefaultMaxBatchDelay,
+		db:            db,
+	}
+	if err := s.migrate(); err != nil {
+		return nil, err
+	}
+
+	var err error
+	s.upsertStmt, err = db.Prepare(`
+		INSERT INTO appdash_spans (trace_id, span_id, parent_id, start_time, timed, annotations)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (trace_id, span_id) DO UPDATE SET
+			parent_id = EXCLUDED.parent_id,
+			start_time = CASE WHEN EXCLUDED.timed THEN EXCLUDED.start_time ELSE appdash_spans.start_time END,
+			timed = appdash_spans.timed OR EXCLUDED.timed,
+			annotations = appdash_spans.annotations || EXCLUDED.annotations`)
+	if err != nil {
+		return nil, err
+	}
+	s.selectStmt, err = db.Prepare(`SELECT span_id, parent_id, annotations FROM appdash_spans WHERE trace_id = $1`)
+	if err != nil {
+		s.upsertStmt.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// migrate applies any schema migrations that have not been applied yet.
+func (s *Store) migrate() error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Serialize concurrent migrations from multiple processes.
+	if _, err := tx.Exec(`CREATE TABLE IF NOT EXISTS appdash_schema (version integer NOT NULL)`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`LOCK TABLE appdash_schema IN EXCLUSIVE MODE`); err != nil {
+		return err
+	}
+	var version int
+	err = tx.QueryRow(`SELECT version FROM appdash_schema`).Scan(&version)
+	if err == sql.ErrNoRows {
+		if _, err := tx.Exec(`INSERT INTO appdash_schema (version) VALUES (0)`); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("pgstore: database schema version %d is newer than supported version %d", version, len(migrations))
+	}
+	for _, m := range migrations[version:] {
+		if _, err := tx.Exec(m); err != nil {
+			return fmt.Errorf("pgstore: migrating schema: %s", err)
+		}
+	}
+	if _, err := tx.Exec(`UPDATE appdash_schema SET version = $1`, len(migrations)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Close closes the underlying database.
+func (s *Store) Close() error {
+	s.upsertStmt.Close()
+	s.selectStmt.Close()
+	return s.db.Close()
+}
+
+// span is a span waiting to be written in a batch.
+type span struct {
+	id    appdash.SpanID
+	start time.Time
+	timed bool
+	anns  appdash.Annotations
+}
+
+// batch is a group of Collect calls written in a single transaction.
+type batch struct {
+	spans map[appdash.SpanID]*span
+	order []*span
+	calls int
+	done  chan struct{}
+	err   error
+}
+
+// Collect implements the appdash.Collector interface. It returns once the
+// span has been written.
+func (s *Store) Collect(id appdash.SpanID, as ...appdash.Annotation) error {
+	now := time.Now()
+	start, timed := now, false
+	if ev, err := (&appdash.Trace{Span: appdash.Span{Annotations: as}}).TimespanEvent(); err == nil {
+		start, timed = ev.Start(), true
+	}
+
+	s.mu.Lock()
+	b := s.batch
+	if b == nil {
+		b = &batch{spans: map[appdash.SpanID]*span{}, done: make(chan struct{})}
+		s.batch = b
+		time.AfterFunc(s.MaxBatchDelay, func() { s.flush(b) })
+	}
+
+	// Merge calls for the same span, since a single statement may not
+	// update the same row twice.
+	if sp, ok := b.spans[id]; ok {
+		sp.anns = append(sp.anns, as...)
+		if timed {
+			sp.start, sp.timed = start, true
+		}
+	} else {
+		sp = &span{id: id, start: start, timed: timed, anns: append(appdash.Annotations(nil), as...)}
+		b.spans[id] = sp
+		b.order = append(b.order, sp)
+	}
+	b.calls++
+	full := b.calls >= s.MaxBatchSize
+	s.mu.Unlock()
+
+	if full {
+		s.flush(b)
+	}
+	<-b.done
+	return b.err
+}
+
+// flush writes the batch b, unless it has already been written.
+func (s *Store) flush(b *batch) {
+	s.mu.Lock()
+	if s.batch != b {
+		s.mu.Unlock()
+		return // already flushed
+	}
+	s.batch = nil
+	s.mu.Unlock()
+
+	b.err = s.write(b.order)
+	close(b.done)
+}
+
+// write writes the given spans in a single transaction.
+func (s *Store) write(spans []*span) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt := tx.Stmt(s.upsertStmt)
+	for _, sp := range spans {
+		anns, err := encodeAnnotations(sp.anns)
+		if err != nil {
+			return err
+		}
+		_, err = stmt.Exec(int64(sp.id.Trace), int64(sp.id.Span), int64(sp.id.Parent), sp.start, sp.timed, anns)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Trace implements the appdash.Store interface.
+func (s *Store) Trace(id appdash.ID) (*appdash.Trace, error) {
+	return s.trace(s.selectStmt, id)
+}
+
+// trace reads and assembles the trace with the given ID.
+func (s *Store) trace(stmt *sql.Stmt, id appdash.ID) (*appdash.Trace, error) {
+	rows, err := stmt.Query(int64(id))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var spans []appdash.Span
+	for rows.Next() {
+		var (
+			spanID, parentID int64
+			anns             []byte
+		)
+		if err := rows.Scan(&spanID, &parentID, &anns); err != nil {
+			return nil, err
+		}
+		as, err := decodeAnnotations(anns)
+		if err != nil {
+			return nil, err
+		}
+		spans = append(spans, appdash.Span{
+			ID:          appdash.SpanID{Trace: id, Span: appdash.ID(spanID), Parent: appdash.ID(parentID)},
+			Annotations: as,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(spans) == 0 {
+		return nil, appdash.ErrTraceNotFound
+	}
+	return tracetree.Build(spans), nil
+}
+
+// Query describes a set of traces to return from Store.Query.
+type Query struct {
+	appdash.TracesOpts
+
+	// Annotations, if non-empty, restricts the results to traces that
+	// contain a span with all of the given annotation key/value pairs. The
+	// keys are escaped as the Recorder escapes them (see
+	// appdash.EscapeKey).
+	Annotations map[string]string
+}
+
+// Traces implements the appdash.Queryer interface. It is the same as Query
+// without other annotation filters.
+func (s *Store) Traces(opts appdash.TracesOpts) ([]*appdash.Trace, error) {
+	return s.Query(Query{TracesOpts: opts})
+}
+
+// Query returns the traces matching q, whose root spans started most
+// recently first. If q.Timespan is set, only traces whose root span started
+// within it are returned.
+//
+// The matchers of q.Matchers are added to the annotation filters, so they
+// can't have the same key with different values (or a different value than
+// q.Annotations), and q.MinDuration isn't supported (the durations of the
+// spans aren't indexed): Query returns an *appdash.UnsupportedFilterError
+// for them.
+func (s *Store) Query(q Query) ([]*appdash.Trace, error) {
+	if q.MinDuration > 0 {
+		return nil, &appdash.UnsupportedFilterError{Filter: "MinDuration"}
+	}
+	if len(q.Matchers) > 0 {
+		filter := make(map[string]string, len(q.Annotations)+len(q.Matchers))
+		for k, v := range q.Annotations {
+			filter[k] = v
+		}
+		for _, m := range q.Matchers {
+			if v, ok := filter[m.Key]; ok && v != m.Value {
+				return nil, &appdash.UnsupportedFilterError{Filter: "Matchers", Reason: "different values for key " + m.Key}
+			}
+			filter[m.Key] = m.Value
+		}
+		q.Annotations = filter
+	}
+
+	var (
+		where []string
+		args  []interface{}
+	)
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	where = append(where, "parent_id = 0")
+	if len(q.TraceIDs) > 0 {
+		ids := make([]int64, len(q.TraceIDs))
+		for i, id := range q.TraceIDs {
+			ids[i] = int64(id)
+		}
+		where = append(where, "trace_id = ANY("+arg(pq.Array(ids))+")")
+	}
+	if !q.Timespan.S.IsZero() {
+		where = append(where, "start_time >= "+arg(q.Timespan.S))
+	}
+	if !q.Timespan.E.IsZero() {
+		where = append(where, "start_time <= "+arg(q.Timespan.E))
+	}
+	if len(q.Annotations) > 0 {
+		// Sorted by key, so that the same query gives the same SQL.
+		filter := make(map[string][]byte, len(q.Annotations))
+		for k, v := range q.Annotations {
+			filter[appdash.EscapeKey(k)] = []byte(v) // as recorded
+		}
+		b, err := encodeAnnotations(appdash.AnnotationsFromMap(filter))
+		if err != nil {
+			return nil, err
+		}
+		where = append(where, "trace_id IN (SELECT trace_id FROM appdash_spans WHERE annotations @> "+arg(string(b))+"::jsonb)")
+	}
+	query := "SELECT trace_id FROM appdash_spans WHERE " + strings.Join(where, " AND ") + " ORDER BY start_time DESC"
+	if q.Limit > 0 {
+		query += " LIMIT " + arg(q.Limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	var ids []appdash.ID
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, appdash.ID(id))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	traces := make([]*appdash.Trace, 0, len(ids))
+	for _, id := range ids {
+		t, err := s.trace(s.selectStmt, id)
+		if err == appdash.ErrTraceNotFound {
+			continue // deleted since the query
+		} else if err != nil {
+			return nil, err
+		}
+		traces = append(traces, t)
+	}
+	return traces, nil
+}
+
+// Delete implements the appdash.DeleteStore interface.
+func (s *Store) Delete(traces ...appdash.ID) error {
+	ids := make([]int64, len(traces))
+	for i, id := range traces {
+		ids[i] = int64(id)
+	}
+	_, err := s.db.Exec(`DELETE FROM appdash_spans WHERE trace_id = ANY($1)`, pq.Array(ids))
+	return err
+}
+
+// annotation is the JSON representation of an appdash.Annotation. Values
+// that are valid UTF-8 are stored as text (Value), so that they can be
+// matched by annotation filters; other values are stored base64-encoded
+// (Binary).
+type annotation struct {
+	Key    string `json:"k"`
+	Value  string `json:"v,omitempty"`
+	Binary string `json:"b,omitempty"`
+}
+
+func encodeAnnotations(as appdash.Annotations) ([]byte, error) {
+	js := make([]annotation, len(as))
+	for i, a := range as {
+		js[i].Key = a.Key
+		if utf8.Valid(a.Value) {
+			js[i].Value = string(a.Value)
+		} else {
+			js[i].Binary = base64.StdEncoding.EncodeToString(a.Value)
+		}
+	}
+	return json.Marshal(js)
+}
+
+func decodeAnnotations(b []byte) (appdash.Annotations, error) {
+	var js []annotation
+	if err := json.Unmarshal(b, &js); err != nil {
+		return nil, err
+	}
+	if len(js) == 0 {
+		return nil, nil
+	}
+	as := make(appdash.Annotations, len(js))
+	for i, a := range js {
+		as[i].Key = a.Key
+		switch {
+		case a.Binary != "":
+			v, err := base64.StdEncoding.DecodeString(a.Binary)
+			if err != nil {
+				return nil, err
+			}
+			as[i].Value = v
+		case a.Value != "":
+			as[i].Value = []byte(a.Value)
+		}
+	}
+	return as, nil
+}
@@ -0,0 +1,79 @@
+package pgstore
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/appdash"
+	"sourcegraph.com/sourcegraph/appdash/internal/storetest"
+)
+
+// openTestStore opens the PostgreSQL database given by the
+// APPDASH_TEST_POSTGRES environment variable (a lib/pq connection string),
+// with all spans deleted, or skips the test if it is not set.
+func openTestStore(t *testing.T) *Store {
+	dsn := os.Getenv("APPDASH_TEST_POSTGRES")
+	if dsn == "" {
+		t.Skip("APPDASH_TEST_POSTGRES not set")
+	}
+	s, err := Open(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.db.Exec(`TRUNCATE appdash_spans`); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestStore(t *testing.T) {
+	if os.Getenv("APPDASH_TEST_POSTGRES") == "" {
+		t.Skip("APPDASH_TEST_POSTGRES not set")
+	}
+	storetest.Test(t, func(t *testing.T) appdash.Store {
+		return openTestStore(t)
+	})
+}
+
+func TestStore_Query_annotations(t *testing.T) {
+	s := openTestStore(t)
+	defer s.Close()
+
+	collect := func(id appdash.SpanID, as ...appdash.Annotation) {
+		if err := s.Collect(id, as...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	collect(appdash.SpanID{Trace: 1, Span: 1})
+	collect(appdash.SpanID{Trace: 1, Span: 2, Parent: 1}, appdash.Annotation{Key: "Request-ID", Value: []byte("abc")})
+	collect(appdash.SpanID{Trace: 2, Span: 1}, appdash.Annotation{Key: "Request-ID", Value: []byte("def")})
+
+	traces, err := s.Query(Query{Annotations: map[string]string{"Request-ID": "abc"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(traces) != 1 || traces[0].Span.ID.Trace != 1 {
+		t.Errorf("got traces %v, want trace 1", traces)
+	}
+}
+
+func TestAnnotations_roundTrip(t *testing.T) {
+	as := appdash.Annotations{
+		{Key: "text", Value: []byte("héllo")},
+		{Key: "binary", Value: []byte{0xff, 0x00, 0xfe}},
+		{Key: "empty"},
+		{Key: "text", Value: []byte("duplicate key")},
+	}
+	b, err := encodeAnnotations(as)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := decodeAnnotations(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, as) {
+		t.Errorf("got %v, want %v", got, as)
+	}
+}
@@ -0,0 +1,101 @@
+package appdash
+
+import (
+	"errors"
+	"sync"
+)
+
+// recorderPool holds the released Recorders, for reuse by AcquireRecorder.
+var recorderPool sync.Pool
+
+// DebugRecorderPool is whether Release poisons the Recorders instead of
+// returning them to the pool used by AcquireRecorder, to find the code
+// that uses Recorders after releasing them: the SpanID of a poisoned
+// Recorder is all ones, and recording on it panics. It is meant for tests
+// and debugging, and should be set before any Recorders are released
+// (e.g., in TestMain).
+var DebugRecorderPool bool
+
+// errUseAfterRelease is the panic value of the Recorders used after
+// Release, if DebugRecorderPool is set.
+var errUseAfterRelease = errors.New("appdash: Recorder used after Release")
+
+// releasedSpanID is the SpanID of the Recorders released while
+// DebugRecorderPool is set, which poisons them (see Release).
+var releasedSpanID = SpanID{Trace: ^ID(0), Span: ^ID(0), Parent: ^ID(0)}
+
+// AcquireRecorder is like NewRecorder, except that the Recorder may be one
+// that was released (see Release), which is reset and reused, along with
+// its internal buffers. It saves allocations on hot paths that record many
+// short spans, as long as each Recorder is released once it is finished.
+//
+// The children of the Recorder (see Child) are acquired too, and may be
+// released independently of it.
+func AcquireRecorder(span SpanID, c Collector) *Recorder {
+	if c == nil {
+		panic("Collector is nil")
+	}
+	r, _ := recorderPool.Get().(*Recorder)
+	if r == nil {
+		r = &Recorder{}
+	}
+	r.init(span, c)
+	r.pooled = true
+	if r.annotations == nil && r.sizeHint > 0 {
+		r.annotations = make([]Annotation, 0, r.sizeHint)
+	}
+	return r
+}
+
+// Release resets the Recorder and returns it to the pool used by
+// AcquireRecorder. It is typically called right after Finish (the events
+// recorded but not finished are discarded). Any Recorder may be released,
+// including those created by NewRecorder.
+//
+// Release must not be called while events may still be recorded on r (for
+// example, by another goroutine, or with AllowEventsAfterFinish), and r
+// must not be used at all after it: the Recorder may already have been
+// acquired again for another span, which would then get the events. Set
+// DebugRecorderPool to find the code that does.
+//
+// The annotations handed to the collector by Finish are never reused,
+// since collectors may keep them, but the next span is given a buffer of
+// the same capacity up front.
+func (r *Recorder) Release() {
+	if DebugRecorderPool {
+		r.mu.Lock()
+		r.SpanID = releasedSpanID
+		r.annotations, r.lazy = nil, nil
+		r.mu.Unlock()
+		return
+	}
+
+	r.mu.Lock()
+	annotations, baggage, repeated, sizeHint := r.annotations[:0], r.baggage, r.repeated, r.sizeHint
+	r.mu.Unlock()
+	for k := range baggage {
+		delete(baggage, k)
+	}
+	for k := range repeated {
+		delete(repeated, k)
+	}
+	if cap(annotations) == 0 {
+		annotations = nil
+	}
+
+	*r = Recorder{
+		annotations: annotations,
+		baggage:     baggage,
+		repeated:    repeated,
+		sizeHint:    sizeHint,
+	}
+	recorderPool.Put(r)
+}
+
+// checkReleased panics if r was poisoned by Release (see
+// DebugRecorderPool).
+func (r *Recorder) checkReleased() {
+	if DebugRecorderPool && r.SpanID == releasedSpanID {
+		panic(errUseAfterRelease)
+	}
+}
@@ -0,0 +1,91 @@
+package appdash
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAcquireRecorder(t *testing.T) {
+	var collected []Annotations
+	c := collectorFunc(func(span SpanID, anns ...Annotation) error {
+		collected = append(collected, anns)
+		return nil
+	})
+
+	for i := 0; i < 3; i++ {
+		r := AcquireRecorder(SpanID{Trace: 1, Span: ID(i + 2)}, c)
+		if r.Service() != DefaultService || r.MaxSpanSize != 0 || r.ForceRecord || r.BaggageItem("k") != "" {
+			t.Fatalf("%d: recorder not reset: %+v", i, r)
+		}
+		r.Name("span")
+		r.Infof("message %d", i)
+		r.SetBaggageItem("k", "v")
+		r.ForceRecord = true
+		r.MaxSpanSize = 1 << 20
+		r.Finish()
+		r.Release()
+	}
+
+	if len(collected) != 3 {
+		t.Fatalf("got %d collections, want 3", len(collected))
+	}
+	for i, anns := range collected {
+		logs := anns.Logs()
+		if len(logs) != 1 || logs[0].Msg != fmt.Sprintf("message %d", i) {
+			t.Errorf("%d: got logs %+v", i, logs)
+		}
+		if got := string(anns.Get(BaggagePrefix + "k")); got != "v" {
+			t.Errorf("%d: got baggage item %q, want %q", i, got, "v")
+		}
+	}
+}
+
+func TestRecorder_Release_child(t *testing.T) {
+	c := collectorFunc(func(SpanID, ...Annotation) error { return nil })
+	r := AcquireRecorder(SpanID{Trace: 1, Span: 2}, c)
+	child := r.Child()
+	if !child.pooled {
+		t.Error("child of an acquired recorder isn't pooled")
+	}
+	child.Finish()
+	child.Release()
+	r.Finish()
+	r.Release()
+}
+
+func TestRecorder_Release_useAfterRelease(t *testing.T) {
+	defer func(v bool) { DebugRecorderPool = v }(DebugRecorderPool)
+	DebugRecorderPool = true
+
+	r := AcquireRecorder(SpanID{Trace: 1, Span: 2}, collectorFunc(func(SpanID, ...Annotation) error { return nil }))
+	r.Finish()
+	r.Release()
+	if r.SpanID != releasedSpanID {
+		t.Errorf("got SpanID %v, want the poisoned %v", r.SpanID, releasedSpanID)
+	}
+
+	defer func() {
+		if v := recover(); v != errUseAfterRelease {
+			t.Errorf("got panic %v, want %v", v, errUseAfterRelease)
+		}
+	}()
+	r.Msg("after release")
+}
+
+func benchmarkRecorder(b *testing.B, newRecorder func(SpanID, Collector) *Recorder, release bool) {
+	c := collectorFunc(func(SpanID, ...Annotation) error { return nil })
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r := newRecorder(SpanID{Trace: 1, Span: 2}, c)
+		r.Name("span")
+		r.Msg("message")
+		r.Finish()
+		if release {
+			r.Release()
+		}
+	}
+}
+
+func BenchmarkNewRecorder(b *testing.B) { benchmarkRecorder(b, NewRecorder, false) }
+
+func BenchmarkAcquireRecorder(b *testing.B) { benchmarkRecorder(b, AcquireRecorder, true) }
@@ -0,0 +1,122 @@
+package appdash
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// An AnnotationMatcher matches the spans that have an annotation with the
+// given key and value (see TracesOpts.Matchers). The key is escaped as the
+// Recorder escapes the keys it records (see EscapeKey).
+type AnnotationMatcher struct {
+	Key   string
+	Value string
+}
+
+// ErrUnsupportedFilter is the error of the queries with filters that the
+// store doesn't support. The errors returned by Queryer.Traces for them are
+// *UnsupportedFilterError, which errors.Is reports as ErrUnsupportedFilter.
+var ErrUnsupportedFilter = errors.New("unsupported trace filter")
+
+// An UnsupportedFilterError is the error of a query with a filter that the
+// store doesn't support (see TracesOpts).
+type UnsupportedFilterError struct {
+	Filter string // the TracesOpts field, such as "MinDuration"
+	Reason string // why it isn't supported, if not just because of the field
+}
+
+func (e *UnsupportedFilterError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("%s: %s", ErrUnsupportedFilter, e.Filter)
+	}
+	return fmt.Sprintf("%s: %s (%s)", ErrUnsupportedFilter, e.Filter, e.Reason)
+}
+
+// Is reports whether target is ErrUnsupportedFilter.
+func (e *UnsupportedFilterError) Is(target error) bool { return target == ErrUnsupportedFilter }
+
+// UnsupportedFilters returns an *UnsupportedFilterError if opts uses the
+// Matchers or MinDuration filters, and nil otherwise. It is for the stores
+// that support neither of them.
+func UnsupportedFilters(opts TracesOpts) error {
+	if len(opts.Matchers) > 0 {
+		return &UnsupportedFilterError{Filter: "Matchers"}
+	}
+	if opts.MinDuration > 0 {
+		return &UnsupportedFilterError{Filter: "MinDuration"}
+	}
+	return nil
+}
+
+// QueryTraces returns the traces of q that match opts. If q doesn't
+// support the Matchers or MinDuration filters of opts (see
+// ErrUnsupportedFilter), it calls q.Traces without them, and applies them
+// to the traces it returns, before opts.Limit.
+func QueryTraces(q Queryer, opts TracesOpts) ([]*Trace, error) {
+	traces, err := q.Traces(opts)
+	if !errors.Is(err, ErrUnsupportedFilter) {
+		return traces, err
+	}
+
+	unfiltered := opts
+	unfiltered.Matchers, unfiltered.MinDuration, unfiltered.Limit = nil, 0, 0
+	traces, err = q.Traces(unfiltered)
+	if err != nil {
+		return nil, err
+	}
+	matching := traces[:0]
+	for _, t := range traces {
+		if opts.match(t) {
+			matching = append(matching, t)
+		}
+	}
+	if opts.Limit > 0 && len(matching) > opts.Limit {
+		matching = matching[:opts.Limit]
+	}
+	return matching, nil
+}
+
+// match reports whether the trace matches the Matchers and MinDuration
+// filters of opts.
+func (opts *TracesOpts) match(t *Trace) bool {
+	if opts.MinDuration > 0 {
+		e, err := t.TimespanEvent()
+		if err != nil || EventDuration(e) < opts.MinDuration {
+			return false
+		}
+	}
+	return len(opts.Matchers) == 0 || matchSpans(t, opts.Matchers)
+}
+
+// matchSpans reports whether a span of the trace matches all of the
+// matchers.
+func matchSpans(t *Trace, matchers []AnnotationMatcher) bool {
+	match := true
+	for _, m := range matchers {
+		if !m.matches(t.Span.Annotations) {
+			match = false
+			break
+		}
+	}
+	if match {
+		return true
+	}
+	for _, sub := range t.Sub {
+		if matchSpans(sub, matchers) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether one of the annotations matches m.
+func (m AnnotationMatcher) matches(as Annotations) bool {
+	key := EscapeKey(m.Key)
+	for _, a := range as {
+		if a.Key == key && bytes.Equal(a.Value, []byte(m.Value)) {
+			return true
+		}
+	}
+	return false
+}
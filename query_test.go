@@ -0,0 +1,67 @@
+package appdash
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// plainQueryer is a Queryer that doesn't support the Matchers and
+// MinDuration filters.
+type plainQueryer struct{ ms *MemoryStore }
+
+func (q plainQueryer) Traces(opts TracesOpts) ([]*Trace, error) {
+	if err := UnsupportedFilters(opts); err != nil {
+		return nil, err
+	}
+	return q.ms.Traces(opts)
+}
+
+func TestQueryTraces_fallback(t *testing.T) {
+	ms := NewMemoryStore()
+	now := time.Now()
+	for i := 1; i <= 4; i++ {
+		start := now.Add(time.Duration(i) * time.Minute)
+		rec := NewRecorder(SpanID{Trace: ID(i), Span: 1}, ms)
+		rec.Event(Timespan{S: start, E: start.Add(time.Duration(i) * time.Second)})
+		if i%2 == 0 {
+			rec.Annotation(Annotation{Key: "user id", Value: []byte("alice")})
+		}
+		rec.Finish()
+	}
+
+	for _, q := range []Queryer{ms, plainQueryer{ms}} {
+		traces, err := QueryTraces(q, TracesOpts{
+			Matchers:    []AnnotationMatcher{{Key: "user id", Value: "alice"}},
+			MinDuration: 2 * time.Second,
+			Limit:       1,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []ID
+		for _, tr := range traces {
+			ids = append(ids, tr.Span.ID.Trace)
+		}
+		if want := []ID{4}; !reflect.DeepEqual(ids, want) {
+			t.Errorf("%T: got trace IDs %v, want %v", q, ids, want)
+		}
+	}
+}
+
+func TestUnsupportedFilterError(t *testing.T) {
+	var err error = &UnsupportedFilterError{Filter: "MinDuration"}
+	if !errors.Is(err, ErrUnsupportedFilter) {
+		t.Errorf("%v isn't ErrUnsupportedFilter", err)
+	}
+	if want := "unsupported trace filter: MinDuration"; err.Error() != want {
+		t.Errorf("got %q, want %q", err, want)
+	}
+	if err := UnsupportedFilters(TracesOpts{Limit: 1}); err != nil {
+		t.Errorf("got error %v without filters, want nil", err)
+	}
+	if err := UnsupportedFilters(TracesOpts{Matchers: []AnnotationMatcher{{Key: "k"}}}); !errors.Is(err, ErrUnsupportedFilter) {
+		t.Errorf("got error %v with Matchers, want ErrUnsupportedFilter", err)
+	}
+}
@@ -0,0 +1,54 @@
+package appdash
+
+import (
+	"math"
+	"time"
+)
+
+// A rateLimiter is a token bucket: tokens are added to it at a constant
+// rate, up to its burst size, and each event takes one token.
+type rateLimiter struct {
+	rate   float64   // tokens added per second
+	burst  float64   // maximum number of tokens
+	tokens float64   // number of tokens at last (negative if reserved)
+	last   time.Time // when tokens was last updated
+}
+
+// newRateLimiter creates a full rate limiter that allows rate events per
+// second, with bursts of up to burst events.
+func newRateLimiter(rate float64, burst int, now time.Time) *rateLimiter {
+	if burst < 1 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+	return &rateLimiter{rate: rate, burst: float64(burst), tokens: float64(burst), last: now}
+}
+
+// advance adds the tokens accumulated since the last update.
+func (l *rateLimiter) advance(now time.Time) {
+	if now.After(l.last) {
+		l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+		l.last = now
+	}
+}
+
+// allow takes a token and returns true if one is available at now.
+// Otherwise, it returns false and takes nothing.
+func (l *rateLimiter) allow(now time.Time) bool {
+	l.advance(now)
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// reserve takes a token, and returns how long to wait after now before
+// the event it is taken for may happen (zero if a token is available).
+func (l *rateLimiter) reserve(now time.Time) time.Duration {
+	l.advance(now)
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens * float64(time.Second) / l.rate)
+}
@@ -0,0 +1,71 @@
+package appdash
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_allow(t *testing.T) {
+	start := time.Unix(1000, 0)
+	l := newRateLimiter(10, 3, start)
+
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+	tests := []struct {
+		at    time.Time
+		allow bool
+	}{
+		// The bucket starts full.
+		{at(0), true},
+		{at(0), true},
+		{at(0), true},
+		{at(0), false},
+		{at(50 * time.Millisecond), false},
+		// One token is added every 100ms.
+		{at(100 * time.Millisecond), true},
+		{at(100 * time.Millisecond), false},
+		// Up to the burst size.
+		{at(10 * time.Second), true},
+		{at(10 * time.Second), true},
+		{at(10 * time.Second), true},
+		{at(10 * time.Second), false},
+		// Clocks going backwards add nothing.
+		{at(5 * time.Second), false},
+	}
+	for i, test := range tests {
+		if got := l.allow(test.at); got != test.allow {
+			t.Errorf("%d: at %s: got allow == %v, want %v", i, test.at.Sub(start), got, test.allow)
+		}
+	}
+}
+
+func TestRateLimiter_reserve(t *testing.T) {
+	start := time.Unix(1000, 0)
+	l := newRateLimiter(10, 2, start)
+
+	waits := []time.Duration{0, 0, 100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond}
+	for i, want := range waits {
+		if got := l.reserve(start); got != want {
+			t.Errorf("%d: got wait %s, want %s", i, got, want)
+		}
+	}
+	// After the reservations are used up, tokens accumulate again.
+	if got := l.reserve(start.Add(time.Second)); got != 0 {
+		t.Errorf("got wait %s, want 0", got)
+	}
+}
+
+func TestNewRateLimiter_defaultBurst(t *testing.T) {
+	tests := []struct {
+		rate  float64
+		burst float64
+	}{
+		{0.5, 1},
+		{10, 10},
+		{2.5, 3},
+	}
+	for _, test := range tests {
+		if got := newRateLimiter(test.rate, 0, time.Time{}).burst; got != test.burst {
+			t.Errorf("rate %v: got burst %v, want %v", test.rate, got, test.burst)
+		}
+	}
+}
@@ -4,12 +4,26 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"path/filepath"
+	"runtime"
+	"strconv"
 	"sync"
 	"time"
+	"unicode/utf8"
 )
 
+// DefaultErrorStackDepth is the default Recorder.ErrorStackDepth.
+const DefaultErrorStackDepth = 16
+
+// TruncatedPrefix is the prefix of the keys of the annotations that note
+// the truncation of other annotations (see Recorder.MaxAnnotationSize).
+// For example, if the value of the annotation "Body" is truncated, the
+// annotation "_truncated:Body" holds its original size in bytes.
+const TruncatedPrefix = "_truncated:"
+
 var (
 	errMultipleFinishCalls = errors.New("multiple Recorder.Finish calls")
+	errEventAfterFinish    = errors.New("event recorded after Recorder.Finish")
 )
 
 // A Recorder is associated with a span and records annotations on the
@@ -19,9 +33,85 @@ type Recorder struct {
 	// instead of being manually checked via the Error method.
 	Logger *log.Logger
 
-	SpanID                   // the span ID that annotations are about
-	annotations []Annotation // SpanID's annotations to be collected
-	finished    bool         // finished is whether Recorder.Finish was called
+	// ErrorStackDepth is the maximum number of stack frames recorded by
+	// Error. If negative, the stack isn't recorded.
+	//
+	// Default ErrorStackDepth = DefaultErrorStackDepth.
+	ErrorStackDepth int
+
+	// AllowEventsAfterFinish is whether the events recorded after Finish is
+	// called are collected right away (each in its own collection). By
+	// default they are dropped, and an error is reported instead.
+	AllowEventsAfterFinish bool
+
+	// MaxAnnotationSize is the maximum size in bytes of an annotation's
+	// value. Larger values are truncated (with a "…(truncated, N bytes)"
+	// suffix, and an annotation with the TruncatedPrefix noting it) before
+	// they are collected. If zero (the default), the values are never
+	// truncated.
+	//
+	// The programs that record large values (such as request bodies or
+	// SQL queries) should set it; 64 KiB is plenty for most annotations.
+	MaxAnnotationSize int
+
+	// MaxSpanSize is the maximum total size in bytes of the annotations
+	// (keys and values) of the span. Once the span exceeds it, the further
+	// annotations are dropped (see Dropped), and an error is reported. If
+	// zero (the default), the span's size is unlimited.
+	//
+	// The programs that record many events on a span (such as the logs of
+	// a long-running job) should set it; 1 MiB (DefaultMaxMessageSize) is
+	// a reasonable limit.
+	MaxSpanSize int
+
+	// MaxBaggageItems is the maximum number of baggage items (see
+	// SetBaggageItem), and MaxBaggageSize is their maximum total size in
+	// bytes (keys and values). If negative, the number (or size) of the
+	// items is unlimited.
+	//
+	// Default MaxBaggageItems = DefaultMaxBaggageItems, and
+	// MaxBaggageSize = DefaultMaxBaggageSize.
+	MaxBaggageItems int
+	MaxBaggageSize  int
+
+	// MinLogLevel is the minimum level of the log events recorded by
+	// Debugf, Infof, Warnf and Errorf. Those below it are dropped before
+	// their messages are formatted, so debug logging can be left in the
+	// code at little cost.
+	//
+	// Default MinLogLevel = LevelDebug (all of them are recorded).
+	MinLogLevel LogLevel
+
+	// ForceRecord is whether the span is collected even if its trace isn't
+	// sampled (see SpanID.Sampled and DefaultHeadSampler), for example to
+	// debug a request.
+	ForceRecord bool
+
+	// StrictKeys is whether the annotations with illegal keys (see
+	// ValidKey) are rejected, i.e. dropped with an error reported, instead
+	// of collected with their keys escaped (see EscapeKey). It is meant
+	// for tests, to catch the code that records such keys.
+	StrictKeys bool
+
+	SpanID // the span ID that annotations are about
+
+	mu           sync.Mutex        // protects annotations, baggage, service, repeated, added, interceptors, lazy, finished, finishedAt and sizeHint
+	annotations  []Annotation      // SpanID's annotations to be collected
+	baggage      map[string]string // baggage items, by key
+	service      string            // service name (see WithService)
+	repeated     map[string]int    // number of repeated events, by schema
+	added        map[string]string // annotations recorded by AddAnnotations, by key
+	interceptors []Interceptor     // see UseInterceptor
+	lazy         []func() Event    // lazy events to evaluate when collecting
+	finished     bool              // finished is whether Recorder.Finish was called
+	finishedAt   string            // file:line of the first Recorder.Finish call
+	sizeHint     int               // number of annotations collected by Finish, for AcquireRecorder
+	pooled       bool              // whether the recorder was acquired by AcquireRecorder
+
+	sizeMu  sync.Mutex // protects size, full and dropped
+	size    int        // total size of the annotations collected
+	full    bool       // whether the span exceeded MaxSpanSize
+	dropped uint64     // number of annotations dropped for MaxSpanSize
 
 	collector Collector // the collector to send to
 
@@ -35,16 +125,57 @@ func NewRecorder(span SpanID, c Collector) *Recorder {
 	if c == nil {
 		panic("Collector is nil")
 	}
-	return &Recorder{
-		SpanID:    span,
-		collector: c,
-	}
+	r := &Recorder{}
+	r.init(span, c)
+	return r
 }
 
-// Child creates a new Recorder with the same collector and a new
-// child SpanID whose parent is this recorder's SpanID.
+// init sets the span, collector and default configuration of a new (or
+// reset) recorder.
+func (r *Recorder) init(span SpanID, c Collector) {
+	r.SpanID = span
+	r.collector = c
+	r.service = DefaultService
+}
+
+// Child creates a new Recorder with the same collector, configuration
+// (Logger, ErrorStackDepth, AllowEventsAfterFinish, size limits,
+// MinLogLevel, ForceRecord, StrictKeys, service name and interceptors) and
+// baggage items (which are recorded on the child span too), and a new
+// child SpanID whose parent is this recorder's SpanID. The child records
+// (and must be finished) independently of r, and r remains usable
+// concurrently with it. If r was acquired by AcquireRecorder, so is the
+// child.
 func (r *Recorder) Child() *Recorder {
-	return NewRecorder(NewSpanID(r.SpanID), r.collector)
+	newRecorder := NewRecorder
+	if r.pooled {
+		newRecorder = AcquireRecorder
+	}
+	c := newRecorder(NewSpanID(r.SpanID), r.collector)
+	c.Logger = r.Logger
+	c.ErrorStackDepth = r.ErrorStackDepth
+	c.AllowEventsAfterFinish = r.AllowEventsAfterFinish
+	c.MaxAnnotationSize, c.MaxSpanSize = r.MaxAnnotationSize, r.MaxSpanSize
+	c.MaxBaggageItems, c.MaxBaggageSize = r.MaxBaggageItems, r.MaxBaggageSize
+	c.MinLogLevel = r.MinLogLevel
+	c.ForceRecord = r.ForceRecord
+	c.StrictKeys = r.StrictKeys
+	c.service = r.Service()
+	r.mu.Lock()
+	c.interceptors = r.interceptors[:len(r.interceptors):len(r.interceptors)]
+	r.mu.Unlock()
+	c.baggage = r.Baggage()
+	if len(c.baggage) > 0 {
+		c.annotations = append(c.annotations, baggageAnnotations(c.baggage)...)
+	}
+	return c
+}
+
+// ChildWithName is like Child, but also sets the name of the child span.
+func (r *Recorder) ChildWithName(name string) *Recorder {
+	c := r.Child()
+	c.Name(name)
+	return c
 }
 
 // Name sets the name of this span.
@@ -72,37 +203,324 @@ func (r *Recorder) LogWithTimestamp(msg string, timestamp time.Time) {
 // Event records any event that implements the Event, TimespanEvent, or
 // TimestampedEvent interfaces.
 func (r *Recorder) Event(e Event) {
-	as, err := MarshalEvent(e)
+	if !r.recording() {
+		return
+	}
+	if ts, ok := e.(Timespan); ok && ts.D == 0 {
+		// Measure the duration while S and E still hold their monotonic
+		// clock readings, which don't survive marshaling, and before the
+		// interceptors wrap the event (see AddAnnotations).
+		if d := ts.E.Sub(ts.S); d > 0 {
+			ts.D = d
+			e = ts
+		}
+	}
+	e, ok := r.intercept(e)
+	if !ok {
+		return
+	}
+	as, err := r.marshalEvent(e)
 	if err != nil {
 		r.error("Event", err)
 		return
 	}
-	r.annotations = append(r.annotations, as...)
+
+	r.mu.Lock()
+	if !r.finished {
+		r.annotations = append(r.annotations, as...)
+		r.mu.Unlock()
+		return
+	}
+	finishedAt := r.finishedAt
+	r.mu.Unlock()
+
+	if r.AllowEventsAfterFinish {
+		r.annotate(as, true)
+		return
+	}
+	r.error("Event", fmt.Errorf("%w (%s event dropped, finished at %s)", errEventAfterFinish, e.Schema(), finishedAt))
+}
+
+// marshalEvent marshals an event of the span, numbering its repeated
+// events (see RepeatedEvent), and adding the annotations of AddAnnotations
+// that the span doesn't have yet.
+func (r *Recorder) marshalEvent(e Event) (Annotations, error) {
+	if ae, ok := e.(annotatedEvent); ok {
+		as, err := r.marshalEvent(ae.Event)
+		if err != nil {
+			return nil, err
+		}
+		r.mu.Lock()
+		if r.added == nil {
+			r.added = map[string]string{}
+		}
+		for _, a := range ae.as {
+			if v, ok := r.added[a.Key]; !ok || v != string(a.Value) {
+				r.added[a.Key] = string(a.Value)
+				as = append(as, a)
+			}
+		}
+		r.mu.Unlock()
+		return as, nil
+	}
+	if _, ok := e.(RepeatedEvent); !ok {
+		return MarshalEvent(e)
+	}
+	schema := e.Schema()
+	r.mu.Lock()
+	if r.repeated == nil {
+		r.repeated = map[string]int{}
+	}
+	index := r.repeated[schema]
+	r.repeated[schema]++
+	r.mu.Unlock()
+	return MarshalRepeatedEvent(e, index)
+}
+
+// Error records an ErrorEvent for err on the span, with the stack of the
+// caller (see ErrorStackDepth). If err is nil, Error does nothing.
+func (r *Recorder) Error(err error) {
+	if err == nil {
+		return
+	}
+	depth := r.ErrorStackDepth
+	if depth == 0 {
+		depth = DefaultErrorStackDepth
+	}
+	r.Event(newErrorEvent(err, 1, depth))
+}
+
+// RecordPanic recovers from a panic, records it on the span as a
+// PanicEvent (with the stack of the panicking frame, see ErrorStackDepth),
+// and panics again with the same value, so that the panic is handled as if
+// RecordPanic wasn't there. It must be called directly by a defer
+// statement:
+//
+//	defer appdash.RecordPanic(rec)
+//
+// If the goroutine isn't panicking, RecordPanic does nothing.
+func RecordPanic(r *Recorder) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	depth := r.ErrorStackDepth
+	if depth == 0 {
+		depth = DefaultErrorStackDepth
+	} else if depth < 0 {
+		depth = 0
+	}
+	r.Event(PanicEvent{
+		Value: fmt.Sprintf("%v", v),
+		Stack: panicStack(depth),
+		Time:  time.Now(),
+	})
+	panic(v)
+}
+
+// LazyEvent records the event returned by f, which is only called (at most
+// once) when the span is collected by Finish, and not at all if the
+// collector is a SamplingCollector that drops the span. This avoids the
+// cost of producing expensive events for the spans that are sampled out.
+// If the collector isn't a SamplingCollector, f is called right away.
+//
+// The lazy events are collected after the other events of the span. If f
+// panics, the panic is reported as an error of the Recorder instead.
+func (r *Recorder) LazyEvent(f func() Event) {
+	if !r.recording() {
+		return
+	}
+	if _, ok := r.collector.(SamplingCollector); ok {
+		r.mu.Lock()
+		if !r.finished {
+			r.lazy = append(r.lazy, f)
+			r.mu.Unlock()
+			return
+		}
+		r.mu.Unlock()
+	}
+	if e, ok := r.evalLazy(f); ok {
+		r.Event(e)
+	}
+}
+
+// LazyLog records a Log event, with the current timestamp, whose message
+// is returned by f. See LazyEvent.
+func (r *Recorder) LazyLog(f func() string) {
+	t := time.Now()
+	r.LazyEvent(func() Event { return LogWithTimestamp(f(), t) })
+}
+
+// evalLazy calls f, recovering from any panic (reported with r.error).
+func (r *Recorder) evalLazy(f func() Event) (e Event, ok bool) {
+	defer func() {
+		if v := recover(); v != nil {
+			r.error("LazyEvent", fmt.Errorf("lazy event panicked: %v", v))
+			e, ok = nil, false
+		}
+	}()
+	return f(), true
 }
 
 // Finish finishes recording and saves the recorded information to the
 // underlying collector. If Finish is not called, then no data will be written
 // to the underlying collector.
-// Finish must be called once, otherwise r.error is called, this constraint
-// ensures that collector is called once per Recorder, in order to avoid
-// for performance reasons extra operations(span look up & span's annotations update)
-// within the collector.
+//
+// Only the first call to Finish collects the span, so that the collector is
+// called once per Recorder, in order to avoid for performance reasons extra
+// operations (span look up & span's annotations update) within the
+// collector. The later calls (including concurrent ones) are no-ops, except
+// that r.error is called with the locations of both calls, to help find
+// the code that finishes the span twice.
 func (r *Recorder) Finish() {
+	r.checkReleased()
+	caller := callerLine(1)
+
+	r.mu.Lock()
 	if r.finished {
-		r.error("Finish", errMultipleFinishCalls)
+		finishedAt := r.finishedAt
+		r.mu.Unlock()
+		r.error("Finish", fmt.Errorf("%w (first at %s, again at %s)", errMultipleFinishCalls, finishedAt, caller))
 		return
 	}
 	r.finished = true
-	r.Annotation(r.annotations...)
+	r.finishedAt = caller
+	as, lazy := r.annotations, r.lazy
+	r.annotations, r.lazy = nil, nil
+	if r.service != "" {
+		// First, so that it isn't dropped for MaxSpanSize.
+		as = append([]Annotation{{Key: ServiceKey, Value: []byte(r.service)}}, as...)
+	}
+	r.sizeHint = len(as) + len(lazy)
+	r.mu.Unlock()
+
+	if len(lazy) > 0 {
+		if keep, ok := sampled(r.collector, r.SpanID); ok && !keep {
+			lazy = nil // the span is dropped
+		}
+		for _, f := range lazy {
+			e, ok := r.evalLazy(f)
+			if !ok {
+				continue
+			}
+			if e, ok = r.intercept(e); !ok {
+				continue
+			}
+			eas, err := r.marshalEvent(e)
+			if err != nil {
+				r.error("LazyEvent", err)
+				continue
+			}
+			as = append(as, eas...)
+		}
+	}
+	r.annotate(as, true)
 }
 
-// Annotation records raw annotations on the span.
+// callerLine returns the file:line location of the frame skip levels above
+// the function that calls it (so 0 is that function itself).
+func callerLine(skip int) string {
+	_, file, line, ok := runtime.Caller(skip + 1)
+	if !ok {
+		return "unknown location"
+	}
+	return fmt.Sprintf("%s:%d", filepath.Base(file), line)
+}
+
+// Annotation records raw annotations on the span. Their keys are escaped
+// (see EscapeKey and StrictKeys), and they are subject to the
+// MaxAnnotationSize and MaxSpanSize limits, and are dropped if the span
+// isn't recorded (see ForceRecord).
 func (r *Recorder) Annotation(as ...Annotation) {
+	r.annotate(as, false)
+}
+
+// annotate is like Annotation, but if recorded, the keys of the annotations
+// are partly escaped already, like those of the events (see escapeKeys).
+func (r *Recorder) annotate(as []Annotation, recorded bool) {
+	if !r.recording() {
+		return
+	}
+	as, errs := escapeKeys(as, r.StrictKeys, recorded)
+	for _, err := range errs {
+		r.error("Annotation", err)
+	}
+	as = r.limit(as)
 	if err := r.failsafeAnnotation(as...); err != nil {
 		r.error("Annotation", err)
 	}
 }
 
+// limit applies the MaxAnnotationSize and MaxSpanSize limits to as, which
+// are about to be collected.
+func (r *Recorder) limit(as []Annotation) []Annotation {
+	if r.MaxAnnotationSize <= 0 && r.MaxSpanSize <= 0 {
+		return as
+	}
+
+	limited := make([]Annotation, 0, len(as))
+	var exceeded bool
+	r.sizeMu.Lock()
+	for i, a := range as {
+		group := []Annotation{a}
+		if r.MaxAnnotationSize > 0 && len(a.Value) > r.MaxAnnotationSize {
+			group = []Annotation{
+				{Key: a.Key, Value: truncateValue(a.Value, r.MaxAnnotationSize)},
+				{Key: TruncatedPrefix + a.Key, Value: []byte(strconv.Itoa(len(a.Value)))},
+			}
+		}
+
+		if r.MaxSpanSize > 0 {
+			size := 0
+			for _, a := range group {
+				size += len(a.Key) + len(a.Value)
+			}
+			if !r.full && r.size+size > r.MaxSpanSize {
+				r.full, exceeded = true, true
+			}
+			if r.full {
+				r.dropped += uint64(len(as) - i)
+				break
+			}
+			r.size += size
+		}
+		limited = append(limited, group...)
+	}
+	r.sizeMu.Unlock()
+
+	if exceeded {
+		r.error("Annotation", fmt.Errorf("span exceeds MaxSpanSize (%d bytes), dropping further annotations", r.MaxSpanSize))
+	}
+	return limited
+}
+
+// truncateValue truncates v to at most max bytes (at a UTF-8 character
+// boundary), and appends a suffix noting v's original size.
+func truncateValue(v []byte, max int) []byte {
+	n := max
+	for n > 0 && n < len(v) && !utf8.RuneStart(v[n]) {
+		n--
+	}
+	t := make([]byte, n, n+32)
+	copy(t, v)
+	return append(t, fmt.Sprintf("…(truncated, %d bytes)", len(v))...)
+}
+
+// recording reports whether the span is collected: if its trace is
+// sampled, or if ForceRecord is set.
+func (r *Recorder) recording() bool {
+	r.checkReleased()
+	return r.ForceRecord || r.SpanID.Sampled()
+}
+
+// Dropped returns the number of annotations that have been dropped because
+// the span exceeded MaxSpanSize.
+func (r *Recorder) Dropped() uint64 {
+	r.sizeMu.Lock()
+	defer r.sizeMu.Unlock()
+	return r.dropped
+}
+
 // Annotation records raw annotations on the span.
 func (r *Recorder) failsafeAnnotation(as ...Annotation) error {
 	return r.collector.Collect(r.SpanID, as...)
@@ -6,11 +6,12 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 )
 
 func TestRecorder(t *testing.T) {
-	id := SpanID{1, 2, 3}
+	id := SpanID{Trace: 1, Span: 2, Parent: 3}
 
 	calledCollect := 0
 	var anns Annotations
@@ -68,8 +69,263 @@ func TestRecorder_Errors(t *testing.T) {
 	}
 
 	r.Finish()
-	if errs := r.Errors(); len(errs) != 1 && errs[0] != errMultipleFinishCalls {
-		t.Errorf("got %d errors, want 1", len(errs))
+	if errs := r.Errors(); len(errs) != 1 || !errors.Is(errs[0], errMultipleFinishCalls) {
+		t.Errorf("got errors %v, want 1 %q", errs, errMultipleFinishCalls)
+	}
+}
+
+func TestRecorder_FinishTwice(t *testing.T) {
+	var mu sync.Mutex
+	var collected []Annotations
+	c := collectorFunc(func(spanID SpanID, as ...Annotation) error {
+		mu.Lock()
+		defer mu.Unlock()
+		collected = append(collected, as)
+		return nil
+	})
+	r := NewRecorder(SpanID{Trace: 1, Span: 2, Parent: 3}, c)
+	r.Msg("msg")
+
+	// Only one of the concurrent calls collects the span.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.Finish()
+		}()
+	}
+	wg.Wait()
+
+	var spans int
+	for _, anns := range collected {
+		if diff := diffAnnotationsFromEvent(anns, Msg("msg")); len(diff) == 0 {
+			spans++
+		}
+	}
+	if spans != 1 {
+		t.Errorf("got the span collected %d times, want 1", spans)
+	}
+	errs := r.Errors()
+	if len(errs) != 9 {
+		t.Fatalf("got %d errors, want 9", len(errs))
+	}
+	for _, err := range errs {
+		if !errors.Is(err, errMultipleFinishCalls) || !strings.Contains(err.Error(), "recorder_test.go:") {
+			t.Errorf("got error %q, want %q with the callers", err, errMultipleFinishCalls)
+		}
+	}
+}
+
+func TestRecorder_EventAfterFinish(t *testing.T) {
+	var collected []Annotations
+	c := collectorFunc(func(spanID SpanID, as ...Annotation) error {
+		collected = append(collected, as)
+		return nil
+	})
+
+	// By default, the event is dropped and an error reported.
+	r := NewRecorder(SpanID{Trace: 1, Span: 2, Parent: 3}, c)
+	r.Finish()
+	r.Msg("late")
+	if errs := r.Errors(); len(errs) != 1 || !errors.Is(errs[0], errEventAfterFinish) {
+		t.Errorf("got errors %v, want 1 %q", errs, errEventAfterFinish)
+	}
+	for _, anns := range collected {
+		if diff := diffAnnotationsFromEvent(anns, Msg("late")); len(diff) == 0 {
+			t.Errorf("got the late event collected, want it dropped")
+		}
+	}
+
+	// Otherwise, it is collected right away.
+	collected = nil
+	r = NewRecorder(SpanID{Trace: 1, Span: 2, Parent: 3}, c)
+	r.AllowEventsAfterFinish = true
+	r.Finish()
+	r.Msg("late")
+	if errs := r.Errors(); len(errs) != 0 {
+		t.Errorf("got errors %v, want none", errs)
+	}
+	if len(collected) != 2 {
+		t.Fatalf("got %d collections, want 2", len(collected))
+	}
+	if diff := diffAnnotationsFromEvent(collected[1], Msg("late")); len(diff) > 0 {
+		t.Errorf("got diff annotations for the late Msg event:\n%s", strings.Join(diff, "\n"))
+	}
+}
+
+func TestRecorder_Error(t *testing.T) {
+	var anns Annotations
+	c := collectorFunc(func(spanID SpanID, as ...Annotation) error {
+		anns = append(anns, as...)
+		return nil
+	})
+	r := NewRecorder(SpanID{Trace: 1, Span: 2, Parent: 3}, c)
+	r.Error(nil)
+	r.Finish()
+	if IsError(anns) {
+		t.Errorf("got IsError true after Error(nil), annotations %v", anns)
+	}
+
+	anns = nil
+	r = NewRecorder(SpanID{Trace: 1, Span: 2, Parent: 3}, c)
+	r.Error(errors.New("boom"))
+	r.Finish()
+	if !IsError(anns) {
+		t.Fatalf("got IsError false, annotations %v", anns)
+	}
+	var ev ErrorEvent
+	if err := UnmarshalEvent(anns, &ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev.Msg != "boom" || ev.Type != "*errors.errorString" {
+		t.Errorf("got error event %+v, want boom of type *errors.errorString", ev)
+	}
+	// The stack starts at the caller of Error.
+	if !strings.HasPrefix(ev.Stack, "sourcegraph.com/sourcegraph/appdash.TestRecorder_Error (recorder_test.go:") {
+		t.Errorf("got stack %q, want it to start in TestRecorder_Error", ev.Stack)
+	}
+
+	anns = nil
+	r = NewRecorder(SpanID{Trace: 1, Span: 2, Parent: 3}, c)
+	r.ErrorStackDepth = -1
+	r.Error(errors.New("boom"))
+	r.Finish()
+	if stack := anns.Get("Error.Stack"); len(stack) != 0 {
+		t.Errorf("got stack %q, want none", stack)
+	}
+}
+
+func panicky(v interface{}) {
+	panic(v)
+}
+
+func nilDeref() {
+	var p *int
+	_ = *p
+}
+
+func TestRecordPanic(t *testing.T) {
+	tests := []struct {
+		f     func()
+		value string
+		frame string // the first frame of the stack
+	}{
+		{f: func() { panicky("boom") }, value: "boom", frame: "sourcegraph.com/sourcegraph/appdash.panicky (recorder_test.go:"},
+		{f: nilDeref, value: "runtime error: invalid memory address or nil pointer dereference", frame: "sourcegraph.com/sourcegraph/appdash.nilDeref (recorder_test.go:"},
+	}
+	for _, test := range tests {
+		var anns Annotations
+		c := collectorFunc(func(spanID SpanID, as ...Annotation) error {
+			anns = append(anns, as...)
+			return nil
+		})
+		r := NewRecorder(SpanID{Trace: 1, Span: 2, Parent: 3}, c)
+
+		// The panic propagates with the same value, after being recorded.
+		var recovered interface{}
+		func() {
+			defer func() {
+				recovered = recover()
+				r.Finish()
+			}()
+			defer RecordPanic(r)
+			test.f()
+		}()
+		if recovered == nil || fmt.Sprint(recovered) != test.value {
+			t.Errorf("got %v recovered, want the panic %q", recovered, test.value)
+		}
+
+		var ev PanicEvent
+		if err := UnmarshalEvent(anns, &ev); err != nil {
+			t.Fatal(err)
+		}
+		if ev.Value != test.value || ev.Time.IsZero() {
+			t.Errorf("got panic event %+v, want value %q", ev, test.value)
+		}
+		if !strings.HasPrefix(ev.Stack, test.frame) {
+			t.Errorf("got stack %q, want it to start with %q", ev.Stack, test.frame)
+		}
+		if !IsError(anns) {
+			t.Error("got IsError false for a panicking span")
+		}
+	}
+
+	// Without a panic, nothing is recorded.
+	var anns Annotations
+	r := NewRecorder(SpanID{Trace: 1, Span: 2, Parent: 3}, collectorFunc(func(spanID SpanID, as ...Annotation) error {
+		anns = append(anns, as...)
+		return nil
+	}))
+	func() {
+		defer RecordPanic(r)
+	}()
+	r.Finish()
+	if IsError(anns) {
+		t.Errorf("got IsError true without a panic, annotations %v", anns)
+	}
+}
+
+func TestRecorder_LazyEvent(t *testing.T) {
+	var collected Annotations
+	c := collectorFunc(func(spanID SpanID, as ...Annotation) error {
+		collected = append(collected, as...)
+		return nil
+	})
+	tests := []struct {
+		c             Collector
+		before, after int  // calls to f before and after Finish
+		want          bool // whether the event is collected
+	}{
+		{c: c, before: 1, after: 1, want: true},
+		{c: NewSamplerCollector(c, 1), before: 0, after: 1, want: true},
+		{c: NewSamplerCollector(c, 0), before: 0, after: 0, want: false},
+		{c: &ChunkedCollector{Collector: NewSamplerCollector(c, 0)}, before: 0, after: 0, want: false},
+	}
+	for i, test := range tests {
+		collected = nil
+		calls := 0
+		r := NewRecorder(NewRootSpanID(), test.c)
+		r.LazyEvent(func() Event {
+			calls++
+			return Msg("lazy")
+		})
+		if calls != test.before {
+			t.Errorf("%d: got %d calls before Finish, want %d", i, calls, test.before)
+		}
+		r.Finish()
+		if calls != test.after {
+			t.Errorf("%d: got %d calls after Finish, want %d", i, calls, test.after)
+		}
+		if cc, ok := test.c.(*ChunkedCollector); ok {
+			cc.Stop()
+		}
+		if got := len(diffAnnotationsFromEvent(collected, Msg("lazy"))) == 0; got != test.want {
+			t.Errorf("%d: got lazy event collected %v, want %v", i, got, test.want)
+		}
+		if errs := r.Errors(); len(errs) != 0 {
+			t.Errorf("%d: got errors %v", i, errs)
+		}
+	}
+}
+
+func TestRecorder_LazyEventPanic(t *testing.T) {
+	var collected Annotations
+	c := collectorFunc(func(spanID SpanID, as ...Annotation) error {
+		collected = append(collected, as...)
+		return nil
+	})
+	r := NewRecorder(NewRootSpanID(), NewSamplerCollector(c, 1))
+	r.Name("name")
+	r.LazyLog(func() string { panic("boom") })
+	r.Finish()
+
+	errs := r.Errors()
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "boom") {
+		t.Errorf("got errors %v, want the panic", errs)
+	}
+	if diff := diffAnnotationsFromEvent(collected, SpanNameEvent{"name"}); len(diff) > 0 {
+		t.Errorf("got diff annotations for SpanNameEvent:\n%s", strings.Join(diff, "\n"))
 	}
 }
 
@@ -90,8 +346,164 @@ func diffAnnotationsFromEvent(anns Annotations, e Event) (diff []string) {
 
 	for _, ea := range eventAnns {
 		if !matchesEventAnns[ea.Key] {
-			diff = append(diff, fmt.Sprintf("key %s: %q != %q", ea.Key, ea.Value, anns.get(ea.Key)))
+			diff = append(diff, fmt.Sprintf("key %s: %q != %q", ea.Key, ea.Value, anns.Get(ea.Key)))
 		}
 	}
 	return diff
 }
+
+func TestRecorder_MaxAnnotationSize(t *testing.T) {
+	var anns Annotations
+	c := collectorFunc(func(span SpanID, as ...Annotation) error {
+		anns = append(anns, as...)
+		return nil
+	})
+	r := NewRecorder(SpanID{Trace: 1, Span: 2, Parent: 0}, c)
+	r.MaxAnnotationSize = 8
+
+	r.Annotation(
+		Annotation{Key: "Short", Value: []byte("12345678")},
+		Annotation{Key: "Body", Value: []byte("abcdefghijklmnop")},
+		Annotation{Key: "UTF8", Value: []byte("abcdefg√√")}, // √ is 3 bytes
+	)
+
+	want := map[string]string{
+		"Short":                  "12345678",
+		"Body":                   "abcdefgh…(truncated, 16 bytes)",
+		TruncatedPrefix + "Body": "16",
+		"UTF8":                   "abcdefg…(truncated, 13 bytes)",
+		TruncatedPrefix + "UTF8": "13",
+	}
+	if got := anns.StringMap(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+}
+
+func TestRecorder_MaxSpanSize(t *testing.T) {
+	var anns Annotations
+	c := collectorFunc(func(span SpanID, as ...Annotation) error {
+		anns = append(anns, as...)
+		return nil
+	})
+	r := NewRecorder(SpanID{Trace: 1, Span: 2, Parent: 0}, c)
+	r.MaxSpanSize = 10
+
+	r.Annotation(Annotation{Key: "A", Value: []byte("1234")}) // 5 bytes
+	r.Annotation(
+		Annotation{Key: "B", Value: []byte("1234")}, // 10 bytes
+		Annotation{Key: "C", Value: []byte("1")},    // over the limit
+		Annotation{Key: "D", Value: []byte("1")},
+	)
+	r.Annotation(Annotation{Key: "E"}) // the span is already full
+
+	var keys []string
+	for _, a := range anns {
+		if len(a.Key) == 1 { // not those of the error's log event
+			keys = append(keys, a.Key)
+		}
+	}
+	if want := []string{"A", "B"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("got keys %q, want %q", keys, want)
+	}
+	if got, want := r.Dropped(), uint64(3); got != want {
+		t.Errorf("got %d dropped, want %d", got, want)
+	}
+	if errs := r.Errors(); len(errs) != 1 {
+		t.Errorf("got errors %v, want 1 error", errs)
+	}
+}
+
+func TestRecorder_unlimited(t *testing.T) {
+	var anns Annotations
+	c := collectorFunc(func(span SpanID, as ...Annotation) error {
+		anns = append(anns, as...)
+		return nil
+	})
+	// The size of the spans of the recorders is unlimited by default.
+	r := NewRecorder(SpanID{Trace: 1, Span: 2, Parent: 0}, c)
+
+	big := bytes.Repeat([]byte("x"), 2<<20)
+	r.Annotation(Annotation{Key: "Big", Value: big})
+	if len(anns) != 1 || !bytes.Equal(anns[0].Value, big) {
+		t.Errorf("got %d annotations, want the value collected as is", len(anns))
+	}
+}
+
+func TestRecorder_Child(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		collected = map[SpanID]Annotations{}
+	)
+	c := collectorFunc(func(span SpanID, as ...Annotation) error {
+		mu.Lock()
+		defer mu.Unlock()
+		collected[span] = append(collected[span], as...)
+		return nil
+	})
+
+	r := NewRecorder(SpanID{Trace: 1, Span: 2, Parent: 0}, c)
+	r.ErrorStackDepth = 3
+	r.AllowEventsAfterFinish = true
+	r.MaxAnnotationSize, r.MaxSpanSize = 100, 1000
+
+	// Children can be created (and recorded) concurrently with the parent.
+	var wg sync.WaitGroup
+	children := make([]*Recorder, 10)
+	for i := range children {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			children[i] = r.ChildWithName(fmt.Sprintf("child %d", i))
+			children[i].Finish()
+		}(i)
+		r.Msg(fmt.Sprint(i))
+	}
+	wg.Wait()
+	r.Finish()
+
+	for i, child := range children {
+		if child.Trace != r.Trace || child.Parent != r.Span || child.Span == r.Span {
+			t.Errorf("got child span ID %v, want a child of %v", child.SpanID, r.SpanID)
+		}
+		if child.ErrorStackDepth != 3 || !child.AllowEventsAfterFinish || child.MaxAnnotationSize != 100 || child.MaxSpanSize != 1000 {
+			t.Errorf("got child %d with configuration %+v, want that of the parent", i, child)
+		}
+		span := Span{ID: child.SpanID, Annotations: collected[child.SpanID]}
+		if got, want := span.Name(), fmt.Sprintf("child %d", i); got != want {
+			t.Errorf("got child name %q, want %q", got, want)
+		}
+	}
+	if got := len(collected); got != len(children)+1 {
+		t.Errorf("got %d spans collected, want %d", got, len(children)+1)
+	}
+}
+
+func TestRecorder_unsampled(t *testing.T) {
+	var collected []SpanID
+	c := collectorFunc(func(spanID SpanID, as ...Annotation) error {
+		collected = append(collected, spanID)
+		return nil
+	})
+
+	root := NewRecorder(SpanID{Trace: 1, Span: 2, Flags: FlagSamplingDecided}, c)
+	child := root.Child()
+	child.Msg("msg")
+	child.LazyEvent(func() Event {
+		t.Error("lazy event of an unsampled span evaluated")
+		return Msg("lazy")
+	})
+	child.Finish()
+	root.Finish()
+	if len(collected) != 0 {
+		t.Errorf("got collected spans %v for an unsampled trace, want none", collected)
+	}
+
+	root = NewRecorder(SpanID{Trace: 1, Span: 2, Flags: FlagSamplingDecided}, c)
+	root.ForceRecord = true
+	child = root.Child()
+	child.Msg("msg")
+	child.Finish()
+	if len(collected) != 1 || collected[0] != child.SpanID {
+		t.Errorf("got collected spans %v with ForceRecord, want [%v]", collected, child.SpanID)
+	}
+}
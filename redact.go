@@ -0,0 +1,148 @@
+package appdash
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+)
+
+// A RedactAction is what a RedactingCollector does to the annotations that
+// match a RedactionRule.
+type RedactAction int
+
+const (
+	// RedactDrop removes the annotation.
+	RedactDrop RedactAction = iota
+
+	// RedactReplace replaces the value of the annotation (or the parts of
+	// it that match the rule's Value) with "[REDACTED]".
+	RedactReplace
+
+	// RedactHash replaces the value of the annotation (or the parts of it
+	// that match the rule's Value) with the hexadecimal SHA-256 hash of
+	// what it replaces, so that equal values can still be correlated.
+	// Beware that the hashes of values from a small set (like numbers or
+	// well-known email addresses) are easily reversed.
+	RedactHash
+)
+
+// redactedValue is the replacement of the values redacted by RedactReplace.
+var redactedValue = []byte("[REDACTED]")
+
+// A RedactionRule selects the annotations that a RedactingCollector
+// redacts: those that match all of its non-zero conditions.
+type RedactionRule struct {
+	// Key, if non-empty, is the key of the annotations to redact.
+	Key string
+
+	// KeyPattern, if non-empty, is a pattern that the key of the
+	// annotations must match, where '*' matches any sequence of characters
+	// and '?' any single character, for example "*.Headers.Cookie".
+	KeyPattern string
+
+	// Value, if non-nil, must match the value of the annotations. Unless
+	// Action is RedactDrop, only the parts of the value that match are
+	// redacted.
+	Value *regexp.Regexp
+
+	// Action is what is done to the matching annotations.
+	Action RedactAction
+}
+
+// NewRedactingCollector returns a collector that redacts the annotations
+// matching the rules before passing them to c. For example, to keep
+// authorization headers, cookies, and email addresses out of the traces:
+//
+//	c := appdash.NewRedactingCollector(collector, []appdash.RedactionRule{
+//		{KeyPattern: "*.Headers.Authorization", Action: appdash.RedactReplace},
+//		{KeyPattern: "*.Headers.Cookie", Action: appdash.RedactDrop},
+//		{KeyPattern: "*.Headers.Set-Cookie", Action: appdash.RedactDrop},
+//		{Value: regexp.MustCompile(`[\w.+-]+@[\w-]+\.[\w.-]+`), Action: appdash.RedactHash},
+//	})
+//
+// The first rule that matches an annotation applies to it. The annotations
+// passed to Collect are never modified: the redacted ones are copied.
+func NewRedactingCollector(c Collector, rules []RedactionRule) *RedactingCollector {
+	keys := make([]string, len(rules))
+	patterns := make([]*regexp.Regexp, len(rules))
+	for i, r := range rules {
+		keys[i] = EscapeKey(r.Key)
+		if r.KeyPattern != "" {
+			patterns[i] = globRegexp(EscapeKey(r.KeyPattern))
+		}
+	}
+	return &RedactingCollector{c: c, rules: rules, keys: keys, patterns: patterns}
+}
+
+// A RedactingCollector redacts annotations before passing them to its
+// underlying collector. See NewRedactingCollector.
+type RedactingCollector struct {
+	c        Collector
+	rules    []RedactionRule
+	keys     []string         // escaped rules[i].Key
+	patterns []*regexp.Regexp // compiled rules[i].KeyPattern
+}
+
+// Collect implements the Collector interface by passing the span and the
+// redacted annotations to the underlying collector.
+func (rc *RedactingCollector) Collect(span SpanID, anns ...Annotation) error {
+	// Most collections have nothing to redact, and are passed as is.
+	first := -1
+	for i := range anns {
+		if rc.match(&anns[i]) != nil {
+			first = i
+			break
+		}
+	}
+	if first == -1 {
+		return rc.c.Collect(span, anns...)
+	}
+
+	redacted := make(Annotations, first, len(anns))
+	copy(redacted, anns[:first])
+	for _, a := range anns[first:] {
+		r := rc.match(&a)
+		if r == nil {
+			redacted = append(redacted, a)
+			continue
+		}
+		if r.Action == RedactDrop {
+			continue
+		}
+		if r.Value != nil {
+			a.Value = r.Value.ReplaceAllFunc(a.Value, r.Action.redact)
+		} else {
+			a.Value = r.Action.redact(a.Value)
+		}
+		redacted = append(redacted, a)
+	}
+	return rc.c.Collect(span, redacted...)
+}
+
+// match returns the first rule that matches the annotation, or nil if none
+// does.
+func (rc *RedactingCollector) match(a *Annotation) *RedactionRule {
+	for i := range rc.rules {
+		r := &rc.rules[i]
+		if r.Key != "" && a.Key != rc.keys[i] {
+			continue
+		}
+		if rc.patterns[i] != nil && !rc.patterns[i].MatchString(a.Key) {
+			continue
+		}
+		if r.Value != nil && !r.Value.Match(a.Value) {
+			continue
+		}
+		return r
+	}
+	return nil
+}
+
+// redact returns the replacement of a redacted value.
+func (action RedactAction) redact(v []byte) []byte {
+	if action == RedactHash {
+		sum := sha256.Sum256(v)
+		return []byte(hex.EncodeToString(sum[:]))
+	}
+	return redactedValue
+}
@@ -0,0 +1,72 @@
+package appdash
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+var testRedactionRules = []RedactionRule{
+	{Key: "Server.Request.Headers.Authorization", Action: RedactReplace},
+	{KeyPattern: "*.Headers.Cookie", Action: RedactDrop},
+	{Value: regexp.MustCompile(`[\w.+-]+@[\w-]+\.[\w.-]+`), Action: RedactHash},
+}
+
+func TestRedactingCollector(t *testing.T) {
+	var got Annotations
+	rc := NewRedactingCollector(collectorFunc(func(span SpanID, anns ...Annotation) error {
+		got = anns
+		return nil
+	}), testRedactionRules)
+
+	anns := Annotations{
+		{Key: "Name", Value: []byte("GET /users")},
+		{Key: "Server.Request.Headers.Authorization", Value: []byte("Bearer secret")},
+		{Key: "Client.Request.Headers.Cookie", Value: []byte("session=secret")},
+		{Key: "Msg", Value: []byte("sent to bob@example.com")},
+	}
+	orig := make(Annotations, len(anns))
+	for i, a := range anns {
+		orig[i] = Annotation{Key: a.Key, Value: append([]byte(nil), a.Value...)}
+	}
+
+	// Pass the annotations through a Recorder, like instrumented code does.
+	rec := NewRecorder(NewRootSpanID(), rc)
+	rec.Annotation(anns...)
+
+	want := Annotations{
+		{Key: "Name", Value: []byte("GET /users")},
+		{Key: "Server.Request.Headers.Authorization", Value: []byte("[REDACTED]")},
+		{Key: "Msg", Value: []byte("sent to 5ff860bf1190596c7188ab851db691f0f3169c453936e9e1eba2f9a47f7a0018")},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got annotations %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(anns, orig) {
+		t.Errorf("the caller's annotations were modified: got %v, want %v", anns, orig)
+	}
+}
+
+func TestRedactingCollector_noMatch(t *testing.T) {
+	var got Annotations
+	rc := NewRedactingCollector(collectorFunc(func(span SpanID, anns ...Annotation) error {
+		got = anns
+		return nil
+	}), testRedactionRules)
+
+	span := NewRootSpanID()
+	anns := Annotations{
+		{Key: "Name", Value: []byte("GET /users")},
+		{Key: "Server.Request.Headers.Accept", Value: []byte("text/html")},
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		rc.Collect(span, anns...)
+	})
+	// The race detector's instrumentation allocates.
+	if allocs != 0 && !raceEnabled {
+		t.Errorf("got %v allocations per Collect, want 0", allocs)
+	}
+	if &got[0] != &anns[0] {
+		t.Error("got annotations copied, want them passed as is")
+	}
+}
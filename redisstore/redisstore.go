@@ -0,0 +1,304 @@
+// Package redisstore implements an appdash.Store backed by Redis, for
+// short-lived trace storage shared by multiple collector processes.
+//
+// Each span is stored in a hash holding its parent ID and its annotations,
+// each trace has a set listing the IDs of its spans, and a sorted set orders
+// trace IDs by the time they were first collected. All keys expire after the
+// store's TTL, which is refreshed whenever a span of the trace is collected.
+//
+// Because keys expire independently, a trace may be read while only some of
+// its span hashes have expired. Such traces are returned with the remaining
+// spans, assembled in the same way as traces whose root span has not been
+// collected yet.
+package redisstore
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+
+	"sourcegraph.com/sourcegraph/appdash"
+	"sourcegraph.com/sourcegraph/appdash/internal/tracetree"
+)
+
+const (
+	// DefaultTTL is the default time for which traces are kept after a span
+	// was last collected into them.
+	DefaultTTL = 30 * time.Minute
+
+	// DefaultPrefix is the default prefix of all keys used by the store.
+	DefaultPrefix = "appdash:"
+)
+
+// parentField is the field of a span hash that holds the span's parent ID.
+// Annotation fields are prefixed with "a" and sort in collection order.
+const parentField = "parent"
+
+// Store is an appdash.Store and appdash.Queryer backed by Redis.
+type Store struct {
+	// TTL is the time for which traces are kept after a span was last
+	// collected into them.
+	TTL time.Duration
+
+	// Prefix is prepended to all keys used by the store.
+	Prefix string
+
+	pool *redis.Pool
+}
+
+// Compile-time "implements" check.
+var _ interface {
+	appdash.DeleteStore
+	appdash.Queryer
+} = (*Store)(nil)
+
+// New returns a store that uses connections from the given pool, with the
+// default TTL and key prefix.
+func New(pool *redis.Pool) *Store {
+	return &Store{
+		TTL:    DefaultTTL,
+		Prefix: DefaultPrefix,
+		pool:   pool,
+	}
+}
+
+func (s *Store) spanKey(trace, span appdash.ID) string {
+	return fmt.Sprintf("%sspan:%s:%s", s.Prefix, trace, span)
+}
+
+func (s *Store) traceKey(trace appdash.ID) string {
+	return fmt.Sprintf("%strace:%s", s.Prefix, trace)
+}
+
+func (s *Store) recentKey() string {
+	return s.Prefix + "recent"
+}
+
+// Collect implements the appdash.Collector interface. All of its commands
+// are pipelined, so that it takes a single round trip.
+func (s *Store) Collect(id appdash.SpanID, as ...appdash.Annotation) error {
+	c := s.pool.Get()
+	defer c.Close()
+
+	now := time.Now()
+	ttl := int64(s.TTL / time.Second)
+	if ttl < 1 {
+		ttl = 1
+	}
+	spanKey, traceKey := s.spanKey(id.Trace, id.Span), s.traceKey(id.Trace)
+
+	args := redis.Args{spanKey, parentField, id.Parent.String()}
+	for i, a := range as {
+		// Field names sort in collection order (see readSpan).
+		args = append(args, fmt.Sprintf("a%020d%06d", now.UnixNano(), i), encodeAnnotation(a))
+	}
+	c.Send("MULTI")
+	c.Send("HSET", args...)
+	c.Send("EXPIRE", spanKey, ttl)
+	c.Send("SADD", traceKey, id.Span.String())
+	c.Send("EXPIRE", traceKey, ttl)
+	c.Send("ZADD", s.recentKey(), "NX", now.UnixNano(), id.Trace.String())
+	c.Send("ZREMRANGEBYSCORE", s.recentKey(), "-inf", now.Add(-s.TTL).UnixNano())
+	c.Send("EXPIRE", s.recentKey(), ttl)
+	_, err := c.Do("EXEC")
+	return err
+}
+
+// Trace implements the appdash.Store interface.
+func (s *Store) Trace(id appdash.ID) (*appdash.Trace, error) {
+	c := s.pool.Get()
+	defer c.Close()
+	return s.trace(c, id)
+}
+
+// trace reads and assembles the trace with the given ID, omitting any spans
+// whose hashes have expired.
+func (s *Store) trace(c redis.Conn, id appdash.ID) (*appdash.Trace, error) {
+	spanIDs, err := redis.Strings(c.Do("SMEMBERS", s.traceKey(id)))
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []appdash.ID
+	for _, str := range spanIDs {
+		spanID, err := appdash.ParseID(str)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, spanID)
+		c.Send("HGETALL", s.spanKey(id, spanID))
+	}
+	if err := c.Flush(); err != nil {
+		return nil, err
+	}
+
+	var spans []appdash.Span
+	for _, spanID := range ids {
+		fields, err := redis.StringMap(c.Receive())
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) == 0 {
+			continue // expired
+		}
+		span, err := readSpan(id, spanID, fields)
+		if err != nil {
+			return nil, err
+		}
+		spans = append(spans, span)
+	}
+	if len(spans) == 0 {
+		return nil, appdash.ErrTraceNotFound
+	}
+	return tracetree.Build(spans), nil
+}
+
+// readSpan decodes the fields of a span hash.
+func readSpan(trace, spanID appdash.ID, fields map[string]string) (appdash.Span, error) {
+	span := appdash.Span{ID: appdash.SpanID{Trace: trace, Span: spanID}}
+	if p, ok := fields[parentField]; ok {
+		parent, err := appdash.ParseID(p)
+		if err != nil {
+			return appdash.Span{}, err
+		}
+		span.ID.Parent = parent
+	}
+
+	var names []string
+	for name := range fields {
+		if strings.HasPrefix(name, "a") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		a, err := decodeAnnotation([]byte(fields[name]))
+		if err != nil {
+			return appdash.Span{}, err
+		}
+		span.Annotations = append(span.Annotations, a)
+	}
+	return span, nil
+}
+
+// Traces implements the appdash.Queryer interface. Traces are returned most
+// recently collected first. If opts.Timespan is set, only traces first
+// collected within it are returned. The Matchers and MinDuration filters
+// aren't supported.
+func (s *Store) Traces(opts appdash.TracesOpts) ([]*appdash.Trace, error) {
+	if err := appdash.UnsupportedFilters(opts); err != nil {
+		return nil, err
+	}
+	c := s.pool.Get()
+	defer c.Close()
+
+	ids := opts.TraceIDs
+	if len(ids) == 0 {
+		min, max := "-inf", "+inf"
+		if !opts.Timespan.S.IsZero() {
+			min = strconv.FormatInt(opts.Timespan.S.UnixNano(), 10)
+		}
+		if !opts.Timespan.E.IsZero() {
+			max = strconv.FormatInt(opts.Timespan.E.UnixNano(), 10)
+		}
+		args := redis.Args{s.recentKey(), max, min}
+		if opts.Limit > 0 {
+			args = append(args, "LIMIT", 0, opts.Limit)
+		}
+		strs, err := redis.Strings(c.Do("ZREVRANGEBYSCORE", args...))
+		if err != nil {
+			return nil, err
+		}
+		for _, str := range strs {
+			id, err := appdash.ParseID(str)
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+		}
+	}
+
+	var traces []*appdash.Trace
+	for _, id := range ids {
+		t, err := s.trace(c, id)
+		if err == appdash.ErrTraceNotFound {
+			continue // expired
+		} else if err != nil {
+			return nil, err
+		}
+		traces = append(traces, t)
+		if opts.Limit > 0 && len(traces) >= opts.Limit {
+			break
+		}
+	}
+	return traces, nil
+}
+
+// Delete implements the appdash.DeleteStore interface.
+func (s *Store) Delete(traces ...appdash.ID) error {
+	c := s.pool.Get()
+	defer c.Close()
+
+	for _, id := range traces {
+		c.Send("SMEMBERS", s.traceKey(id))
+	}
+	if err := c.Flush(); err != nil {
+		return err
+	}
+	keys := redis.Args{}
+	for _, id := range traces {
+		spanIDs, err := redis.Strings(c.Receive())
+		if err != nil {
+			return err
+		}
+		keys = append(keys, s.traceKey(id))
+		for _, str := range spanIDs {
+			spanID, err := appdash.ParseID(str)
+			if err != nil {
+				return err
+			}
+			keys = append(keys, s.spanKey(id, spanID))
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	members := redis.Args{s.recentKey()}
+	for _, id := range traces {
+		members = append(members, id.String())
+	}
+	c.Send("MULTI")
+	c.Send("DEL", keys...)
+	c.Send("ZREM", members...)
+	_, err := c.Do("EXEC")
+	return err
+}
+
+// encodeAnnotation encodes a as the uvarint length of its key, followed by
+// the key and then the value.
+func encodeAnnotation(a appdash.Annotation) []byte {
+	b := make([]byte, binary.MaxVarintLen64+len(a.Key)+len(a.Value))
+	n := binary.PutUvarint(b, uint64(len(a.Key)))
+	n += copy(b[n:], a.Key)
+	n += copy(b[n:], a.Value)
+	return b[:n]
+}
+
+func decodeAnnotation(b []byte) (appdash.Annotation, error) {
+	keyLen, n := binary.Uvarint(b)
+	if n <= 0 || uint64(len(b)-n) < keyLen {
+		return appdash.Annotation{}, errors.New("redisstore: corrupt annotation")
+	}
+	a := appdash.Annotation{Key: string(b[n : n+int(keyLen)])}
+	if v := b[n+int(keyLen):]; len(v) > 0 {
+		a.Value = append([]byte(nil), v...)
+	}
+	return a, nil
+}
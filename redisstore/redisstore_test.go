@@ -0,0 +1,69 @@
+package redisstore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gomodule/redigo/redis"
+
+	"sourcegraph.com/sourcegraph/appdash"
+	"sourcegraph.com/sourcegraph/appdash/internal/storetest"
+)
+
+func newTestStore(t *testing.T) (*Store, *miniredis.Miniredis) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := &redis.Pool{
+		Dial: func() (redis.Conn, error) { return redis.Dial("tcp", mr.Addr()) },
+	}
+	return New(pool), mr
+}
+
+func TestStore(t *testing.T) {
+	storetest.Test(t, func(t *testing.T) appdash.Store {
+		s, _ := newTestStore(t)
+		return s
+	})
+}
+
+func TestStore_expiry(t *testing.T) {
+	s, mr := newTestStore(t)
+	defer mr.Close()
+
+	collect := func(id appdash.SpanID, as ...appdash.Annotation) {
+		if err := s.Collect(id, as...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	collect(appdash.SpanID{Trace: 1, Span: 1}, appdash.Annotation{Key: "k", Value: []byte("v")})
+	collect(appdash.SpanID{Trace: 1, Span: 2, Parent: 1})
+	collect(appdash.SpanID{Trace: 1, Span: 3, Parent: 2})
+
+	// Expire the root and a middle span's hash while the trace's span set
+	// still exists: the remaining span must still be returned.
+	mr.Del(s.spanKey(1, 1))
+	mr.Del(s.spanKey(1, 2))
+	tr, err := s.Trace(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (appdash.SpanID{Trace: 1, Span: 3, Parent: 2}); tr.Span.ID != want || len(tr.Sub) != 0 {
+		t.Errorf("got partial trace %v, want just span %v", tr, want)
+	}
+
+	// Once everything has expired, the trace is gone.
+	mr.FastForward(DefaultTTL + time.Second)
+	if x, err := s.Trace(1); err != appdash.ErrTraceNotFound {
+		t.Errorf("Trace(1): got trace %+v and err %#v, want ErrTraceNotFound", x, err)
+	}
+	traces, err := s.Traces(appdash.TracesOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(traces) != 0 {
+		t.Errorf("got %d traces after expiry, want 0", len(traces))
+	}
+}
@@ -1,6 +1,7 @@
 package appdash
 
 import (
+	"encoding"
 	"fmt"
 	"reflect"
 	"sort"
@@ -10,23 +11,76 @@ import (
 	"time"
 )
 
-func flattenValue(prefix string, v reflect.Value, f func(k, v string)) {
+// maxFlattenDepth is the maximum nesting depth of the values flattened into
+// (and unflattened from) annotations.
+const maxFlattenDepth = 32
+
+// maxUnflattenSliceLen is the maximum length of a slice unflattened from
+// annotations, so that a key like "Items.999999999" can't exhaust memory.
+const maxUnflattenSliceLen = 1 << 16
+
+// flattenValue calls f with the dotted key path and string value of each
+// leaf of v (e.g. "Request.Headers.Accept" or "Items.0.SKU"). It returns an
+// error if v is nested deeper than maxFlattenDepth or holds a cycle of
+// pointers, in which case the values at that key path are omitted.
+func flattenValue(prefix string, v reflect.Value, f func(k, v string)) error {
+	return flattenValueDepth(prefix, v, f, 0, map[uintptr]bool{})
+}
+
+// flattenValueDepth flattens v, at the given depth, whose ancestors that
+// are pointers (or maps or slices) are in the path set.
+func flattenValueDepth(prefix string, v reflect.Value, f func(k, v string), depth int, path map[uintptr]bool) error {
+	if depth > maxFlattenDepth {
+		return fmt.Errorf("appdash: value at %q nested deeper than %d levels", prefix, maxFlattenDepth)
+	}
+	if !v.IsValid() {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+	}
+	if !v.CanInterface() {
+		return nil
+	}
+
 	switch o := v.Interface().(type) {
 	case time.Time:
 		f(prefix, o.Format(time.RFC3339Nano))
-		return
+		return nil
 	case time.Duration:
-		ms := float64(o.Nanoseconds()) / float64(time.Millisecond)
-		f(prefix, strconv.FormatFloat(ms, 'f', -1, 64))
-		return
+		f(prefix, formatDuration(o))
+		return nil
 	case fmt.Stringer:
 		f(prefix, o.String())
-		return
+		return nil
 	}
 
+	// Detect the cycles through the pointers (and reference types) on the
+	// path from the root to v.
 	switch v.Kind() {
-	case reflect.Ptr:
-		flattenValue(prefix, v.Elem(), f)
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		if v.Kind() != reflect.Slice || v.Len() > 0 {
+			ptr := v.Pointer()
+			if path[ptr] {
+				return fmt.Errorf("appdash: cycle in value at %q", prefix)
+			}
+			path[ptr] = true
+			defer delete(path, ptr)
+		}
+	}
+
+	var firstErr error
+	flatten := func(prefix string, v reflect.Value) {
+		if err := flattenValueDepth(prefix, v, f, depth+1, path); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		flatten(prefix, v.Elem())
 	case reflect.Bool:
 		f(prefix, strconv.FormatBool(v.Bool()))
 	case reflect.Float32, reflect.Float64:
@@ -39,23 +93,33 @@ func flattenValue(prefix string, v reflect.Value, f func(k, v string)) {
 		f(prefix, v.String())
 	case reflect.Struct:
 		for i, name := range fieldNames(v) {
-			flattenValue(nest(prefix, name), v.Field(i), f)
+			flatten(nest(prefix, name), v.Field(i))
 		}
 	case reflect.Map:
+		if v.Len() == 0 {
+			// So that an empty map isn't unflattened as a nil one.
+			f(prefix, "")
+			return nil
+		}
 		for _, key := range v.MapKeys() {
 			// small bit of cuteness here: use flattenValue on the key first,
 			// then on the value
 			flattenValue("", key, func(_, k string) {
-				flattenValue(nest(prefix, k), v.MapIndex(key), f)
+				flatten(nest(prefix, EscapeMapKey(k)), v.MapIndex(key))
 			})
 		}
 	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			f(prefix, string(v.Bytes()))
+			break
+		}
 		for i := 0; i < v.Len(); i++ {
-			flattenValue(nest(prefix, strconv.Itoa(i)), v.Index(i), f)
+			flatten(nest(prefix, strconv.Itoa(i)), v.Index(i))
 		}
 	default:
 		f(prefix, fmt.Sprintf("%+v", v.Interface()))
 	}
+	return firstErr
 }
 
 func mapToKVs(m map[string]string) *[][2]string {
@@ -73,12 +137,6 @@ func (v kvsByKey) Len() int           { return len(v) }
 func (v kvsByKey) Less(i, j int) bool { return v[i][0] < v[j][0] }
 func (v kvsByKey) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
 
-type structFieldsByName []reflect.StructField
-
-func (v structFieldsByName) Len() int           { return len(v) }
-func (v structFieldsByName) Less(i, j int) bool { return fieldName(v[i]) < fieldName(v[j]) }
-func (v structFieldsByName) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
-
 func parseValue(as reflect.Type, s string) (reflect.Value, error) {
 	vp, err := parseValueToPtr(as, s)
 	if err != nil {
@@ -90,6 +148,11 @@ func parseValue(as reflect.Type, s string) (reflect.Value, error) {
 	return vp.Elem(), nil
 }
 
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	stringerType        = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+)
+
 func parseValueToPtr(as reflect.Type, s string) (reflect.Value, error) {
 	switch [2]string{as.PkgPath(), as.Name()} {
 	case [2]string{"time", "Time"}:
@@ -99,15 +162,23 @@ func parseValueToPtr(as reflect.Type, s string) (reflect.Value, error) {
 		}
 		return reflect.ValueOf(&t), nil
 	case [2]string{"time", "Duration"}:
-		// Multiply by 1000 because flattenValue divides by 1000.
-		usec, err := strconv.ParseFloat(s, 64)
+		d, err := parseDuration(s)
 		if err != nil {
 			return reflect.Value{}, err
 		}
-		d := time.Duration(usec * float64(time.Millisecond))
 		return reflect.ValueOf(&d), nil
 	}
 
+	// Values that are flattened with their String method (see
+	// flattenValue) are parsed with their UnmarshalText method, if any.
+	if as.Kind() != reflect.Ptr && reflect.PtrTo(as).Implements(textUnmarshalerType) {
+		vp := reflect.New(as)
+		if err := vp.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+			return reflect.Value{}, err
+		}
+		return vp, nil
+	}
+
 	switch as.Kind() {
 	case reflect.Ptr:
 		return parseValueToPtr(as.Elem(), s)
@@ -118,7 +189,7 @@ func parseValueToPtr(as reflect.Type, s string) (reflect.Value, error) {
 		}
 		return reflect.ValueOf(&vv), nil
 	case reflect.Float32, reflect.Float64:
-		vv, err := strconv.ParseFloat(s, 32)
+		vv, err := strconv.ParseFloat(s, as.Bits())
 		if err != nil {
 			return reflect.Value{}, err
 		}
@@ -173,142 +244,279 @@ func parseValueToPtr(as reflect.Type, s string) (reflect.Value, error) {
 		}
 	case reflect.String:
 		return reflect.ValueOf(&s), nil
+	case reflect.Slice:
+		if as.Elem().Kind() == reflect.Uint8 {
+			b := reflect.New(as)
+			b.Elem().SetBytes([]byte(s))
+			return b, nil
+		}
 	}
 	return reflect.Value{}, nil
 }
 
-func unflattenValue(prefix string, v reflect.Value, t reflect.Type, kv *[][2]string) error {
+// unflattenValue sets v (which must be settable, or a pointer) from the
+// leaves at the dotted key paths under prefix in kv, which must be sorted
+// by key (see mapToKVs). It is the inverse of flattenValue. The keys that
+// don't match a field (or map key, or slice index) of v are ignored.
+func unflattenValue(prefix string, v reflect.Value, kv *[][2]string) error {
 	if !sort.IsSorted(kvsByKey(*kv)) {
 		panic("unflattenValue: kv must be sorted (using kvsByKey)")
 	}
-	if len(*kv) == 0 {
-		return nil
-	}
-	if !strings.HasPrefix((*kv)[0][0], prefix) && t.Kind() != reflect.Map { // map can have 0 fields
-		*kv = (*kv)[1:]
-		return unflattenValue(prefix, v, t, kv)
+	return unflattenValueDepth(prefix, v, *kv, 0)
+}
+
+// unflattenValueDepth unflattens v, at the given depth, from kv.
+func unflattenValueDepth(prefix string, v reflect.Value, kv [][2]string, depth int) error {
+	if depth > maxFlattenDepth {
+		return fmt.Errorf("appdash: key %q nested deeper than %d levels", prefix, maxFlattenDepth)
 	}
 
-	if v.IsValid() {
-		treatAsValue := false
-		switch v.Interface().(type) {
-		case time.Time:
-			treatAsValue = true
-		}
-		if treatAsValue {
-			vv, err := parseValue(v.Type(), (*kv)[0][1])
-			if err != nil {
-				return err
-			}
-			if vv.Type().AssignableTo(v.Type()) {
-				v.Set(vv)
+	// Find the value to set, allocating the nil pointers on the way (only
+	// if there are keys to set it from).
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			if v.Kind() == reflect.Interface || !v.CanSet() || !hasKeys(kv, prefix) {
+				return nil
 			}
-			*kv = (*kv)[1:]
-			return nil
+			v.Set(reflect.New(v.Type().Elem()))
 		}
+		v = v.Elem()
+	}
+	if !v.CanSet() {
+		return nil
 	}
 
-	switch t.Kind() {
-	case reflect.Ptr:
-		return unflattenValue(prefix, v, t.Elem(), kv)
-	case reflect.Interface:
-		return unflattenValue(prefix, v.Elem(), v.Type(), kv)
-	case reflect.Bool, reflect.Float32, reflect.Float64,
-		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
-		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
-		reflect.String:
-		vv, err := parseValue(v.Type(), (*kv)[0][1])
+	t := v.Type()
+	if isLeafType(t) {
+		s, ok := lookupKV(kv, prefix)
+		if !ok {
+			return nil
+		}
+		vv, err := parseValue(t, s)
 		if err != nil {
 			return err
 		}
-		v.Set(vv)
-		*kv = (*kv)[1:]
-	case reflect.Struct:
-		if v.Kind() == reflect.Ptr {
-			v = v.Elem()
+		if vv.IsValid() {
+			v.Set(vv)
 		}
-		var vtfs []reflect.StructField
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
 		for i := 0; i < t.NumField(); i++ {
 			f := t.Field(i)
-			if f.PkgPath == "" { // exported
-				vtfs = append(vtfs, f)
+			if f.PkgPath != "" || fieldOmitted(f) { // unexported or omitted
+				continue
 			}
-		}
-		sort.Sort(structFieldsByName(vtfs))
-		for _, vtf := range vtfs {
-			vf := v.FieldByIndex(vtf.Index)
-			if vf.IsValid() {
-				fieldPrefix := nest(prefix, fieldName(vtf))
-				if err := unflattenValue(fieldPrefix, vf, vtf.Type, kv); err != nil {
-					return err
-				}
+			fieldPrefix := nest(prefix, normalizeKey(fieldName(f)))
+			if err := unflattenValueDepth(fieldPrefix, v.Field(i), kv, depth+1); err != nil {
+				return err
 			}
 		}
 	case reflect.Map:
-		m := reflect.MakeMap(t)
-		keyPrefix := prefix + "."
-		found := 0
-		for _, kvv := range *kv {
-			key, val := kvv[0], kvv[1]
-			if key < keyPrefix {
-				continue
-			}
-			if key > keyPrefix && !strings.HasPrefix(key, keyPrefix) {
-				break
+		// The keys of maps of leaves are the rest of the key paths, which
+		// may contain dots in the annotations recorded before the map keys
+		// were escaped (see EscapeMapKey).
+		whole := isLeafType(t.Elem())
+		keys, kvs := childKeys(kv, prefix, whole)
+		if len(keys) == 0 {
+			if _, empty := lookupKV(kv, prefix); empty && v.IsNil() {
+				v.Set(reflect.MakeMap(t))
 			}
-			vv, err := parseValue(t.Elem(), val)
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(t))
+		}
+		for i, key := range keys {
+			kk, err := parseValue(t.Key(), UnescapeKey(key))
 			if err != nil {
 				return err
 			}
-			m.SetMapIndex(reflect.ValueOf(strings.TrimPrefix(key, keyPrefix)), vv)
-			*kv = (*kv)[1:]
-			found++
-		}
-		if found > 0 {
-			v.Set(m)
+			if !kk.IsValid() {
+				continue // unsupported key type
+			}
+			elem := reflect.New(t.Elem()).Elem()
+			if err := unflattenValueDepth(nest(prefix, key), elem, kvs[i], depth+1); err != nil {
+				return err
+			}
+			v.SetMapIndex(kk, elem)
 		}
 	case reflect.Slice, reflect.Array:
-		keyPrefix := prefix + "."
-		type elem struct {
-			i int
-			s string
-		}
-		var elems []elem
-		maxI := 0
-		for _, kvv := range *kv {
-			key, val := kvv[0], kvv[1]
-			if !strings.HasPrefix(key, keyPrefix) {
-				break
-			}
-
-			i, err := strconv.Atoi(strings.TrimPrefix(key, keyPrefix))
+		keys, kvs := childKeys(kv, prefix, false)
+		if len(keys) == 0 {
+			return nil
+		}
+		indexes := make([]int, len(keys))
+		n := 0
+		for i, key := range keys {
+			index, err := strconv.Atoi(key)
 			if err != nil {
 				return err
 			}
-
-			elems = append(elems, elem{i, val})
-			if i > maxI {
-				maxI = i
+			if index < 0 || index >= maxUnflattenSliceLen {
+				return fmt.Errorf("appdash: index of key %q out of range", nest(prefix, key))
+			}
+			indexes[i] = index
+			if index+1 > n {
+				n = index + 1
 			}
-
-			*kv = (*kv)[1:]
 		}
-
-		if v.Kind() == reflect.Slice {
-			v.Set(reflect.MakeSlice(t, maxI+1, maxI+1))
+		if t.Kind() == reflect.Slice {
+			v.Set(reflect.MakeSlice(t, n, n))
 		}
-		for _, e := range elems {
-			vv, err := parseValue(t.Elem(), e.s)
-			if err != nil {
+		for i, index := range indexes {
+			if index >= v.Len() {
+				continue // beyond the array
+			}
+			if err := unflattenValueDepth(nest(prefix, keys[i]), v.Index(index), kvs[i], depth+1); err != nil {
 				return err
 			}
-			v.Index(e.i).Set(vv)
 		}
 	}
+	return nil
+}
 
+// isLeafType reports whether values of type t are flattened into a single
+// annotation.
+func isLeafType(t reflect.Type) bool {
+	if t == reflect.TypeOf(time.Time{}) || t == reflect.TypeOf(time.Duration(0)) {
+		return true
+	}
+	if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+		return true // []byte
+	}
+	if t.Implements(stringerType) && reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return true // flattened with String, parsed with UnmarshalText
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.String:
+		return true
+	}
+	return false
+}
+
+// fieldType returns the leaf type (see isLeafType) of the values of type t
+// at the key path, as flattenValue flattens them, or nil if there is none.
+// The types of the values of interfaces are unknown.
+func fieldType(t reflect.Type, path string) reflect.Type {
+	for depth := 0; depth <= maxFlattenDepth; depth++ {
+		if isLeafType(t) || t.Implements(stringerType) {
+			if path != "" {
+				return nil
+			}
+			return t
+		}
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+			continue
+		}
+		if path == "" {
+			return nil
+		}
+		switch t.Kind() {
+		case reflect.Struct:
+			// The field names may contain dots (e.g. `trace:"Client.Send"`).
+			var next reflect.Type
+			for i := 0; i < t.NumField() && next == nil; i++ {
+				f := t.Field(i)
+				if f.PkgPath != "" || fieldOmitted(f) {
+					continue
+				}
+				switch name := fieldName(f); {
+				case path == name:
+					next, path = f.Type, ""
+				case strings.HasPrefix(path, name+"."):
+					next, path = f.Type, path[len(name)+1:]
+				}
+			}
+			if next == nil {
+				return nil
+			}
+			t = next
+		case reflect.Map:
+			if isLeafType(t.Elem()) {
+				path = "" // the rest of the path is the map key
+			} else {
+				_, path = splitPath(path)
+			}
+			t = t.Elem()
+		case reflect.Slice, reflect.Array:
+			index, rest := splitPath(path)
+			if _, err := strconv.Atoi(index); err != nil {
+				return nil
+			}
+			t, path = t.Elem(), rest
+		default:
+			return nil
+		}
+	}
 	return nil
 }
 
+// splitPath returns the first component of a key path, and the rest of it.
+func splitPath(path string) (first, rest string) {
+	if dot := strings.Index(path, "."); dot != -1 {
+		return path[:dot], path[dot+1:]
+	}
+	return path, ""
+}
+
+// lookupKV returns the value of the key in the sorted kv.
+func lookupKV(kv [][2]string, key string) (string, bool) {
+	i := sort.Search(len(kv), func(i int) bool { return kv[i][0] >= key })
+	if i < len(kv) && kv[i][0] == key {
+		return kv[i][1], true
+	}
+	return "", false
+}
+
+// hasKeys reports whether the sorted kv has the key prefix or keys nested
+// under it.
+func hasKeys(kv [][2]string, prefix string) bool {
+	if prefix == "" {
+		return len(kv) > 0
+	}
+	if _, ok := lookupKV(kv, prefix); ok {
+		return true
+	}
+	i := sort.Search(len(kv), func(i int) bool { return kv[i][0] >= prefix+"." })
+	return i < len(kv) && strings.HasPrefix(kv[i][0], prefix+".")
+}
+
+// childKeys returns the distinct child keys of prefix in the sorted kv
+// (the first component of the key paths after prefix, or all of the rest
+// if whole is true), and for each of them the part of kv under it.
+func childKeys(kv [][2]string, prefix string, whole bool) (keys []string, kvs [][][2]string) {
+	keyPrefix := prefix + "."
+	if prefix == "" {
+		keyPrefix = ""
+	}
+	index := map[string]int{} // child key -> index in keys
+	i := sort.Search(len(kv), func(i int) bool { return kv[i][0] >= keyPrefix })
+	for ; i < len(kv) && strings.HasPrefix(kv[i][0], keyPrefix); i++ {
+		key := kv[i][0][len(keyPrefix):]
+		if !whole {
+			if dot := strings.Index(key, "."); dot != -1 {
+				key = key[:dot]
+			}
+		}
+		j, ok := index[key]
+		if !ok {
+			j = len(keys)
+			index[key] = j
+			keys = append(keys, key)
+			kvs = append(kvs, nil)
+		}
+		kvs[j] = append(kvs[j], kv[i])
+	}
+	return keys, kvs
+}
+
 func fieldNames(v reflect.Value) map[int]string {
 	t := v.Type()
 
@@ -326,7 +534,7 @@ func fieldNames(v reflect.Value) map[int]string {
 	m = make(map[int]string, t.NumField())
 	for i := 0; i < t.NumField(); i++ {
 		fld := t.Field(i)
-		if fld.PkgPath != "" {
+		if fld.PkgPath != "" || fieldOmitted(fld) {
 			continue // ignore all unwant fields
 		}
 
@@ -337,6 +545,12 @@ func fieldNames(v reflect.Value) map[int]string {
 	return m
 }
 
+// fieldOmitted reports whether the field is omitted from the annotations,
+// with the tag `trace:"-"`.
+func fieldOmitted(f reflect.StructField) bool {
+	return f.Tag.Get("trace") == "-"
+}
+
 func fieldName(f reflect.StructField) string {
 	name := f.Tag.Get("trace")
 	if name == "" {
@@ -3,7 +3,9 @@ package appdash
 import (
 	"math"
 	"reflect"
+	"strings"
 	"testing"
+	"testing/quick"
 	"time"
 )
 
@@ -28,7 +30,7 @@ func TestFlattenBools(t *testing.T) {
 	}
 
 	var gotE T
-	if err := unflattenValue("", reflect.ValueOf(&gotE), reflect.TypeOf(&gotE), mapToKVs(want)); err != nil {
+	if err := unflattenValue("", reflect.ValueOf(&gotE), mapToKVs(want)); err != nil {
 		t.Fatal(err)
 	}
 	if !reflect.DeepEqual(gotE, e) {
@@ -57,7 +59,7 @@ func TestFlattenStrings(t *testing.T) {
 	}
 
 	var gotE T
-	if err := unflattenValue("", reflect.ValueOf(&gotE), reflect.TypeOf(&gotE), mapToKVs(want)); err != nil {
+	if err := unflattenValue("", reflect.ValueOf(&gotE), mapToKVs(want)); err != nil {
 		t.Fatal(err)
 	}
 	if !reflect.DeepEqual(gotE, e) {
@@ -86,7 +88,7 @@ func TestFlattenNamedValues(t *testing.T) {
 	}
 
 	var gotE T
-	if err := unflattenValue("", reflect.ValueOf(&gotE), reflect.TypeOf(&gotE), mapToKVs(want)); err != nil {
+	if err := unflattenValue("", reflect.ValueOf(&gotE), mapToKVs(want)); err != nil {
 		t.Fatal(err)
 	}
 	if !reflect.DeepEqual(gotE, e) {
@@ -115,7 +117,7 @@ func TestFlattenTime(t *testing.T) {
 	}
 
 	var gotE T
-	if err := unflattenValue("", reflect.ValueOf(&gotE), reflect.TypeOf(&gotE), mapToKVs(want)); err != nil {
+	if err := unflattenValue("", reflect.ValueOf(&gotE), mapToKVs(want)); err != nil {
 		t.Fatal(err)
 	}
 	if !reflect.DeepEqual(gotE, e) {
@@ -147,7 +149,7 @@ func TestFlattenFloats(t *testing.T) {
 	}
 
 	var gotE T
-	if err := unflattenValue("", reflect.ValueOf(&gotE), reflect.TypeOf(&gotE), mapToKVs(want)); err != nil {
+	if err := unflattenValue("", reflect.ValueOf(&gotE), mapToKVs(want)); err != nil {
 		t.Fatal(err)
 	}
 	if math.Abs(gotE.B-e.B) > 0.01 {
@@ -192,7 +194,7 @@ func TestFlattenInts(t *testing.T) {
 	}
 
 	var gotE T
-	if err := unflattenValue("", reflect.ValueOf(&gotE), reflect.TypeOf(&gotE), mapToKVs(want)); err != nil {
+	if err := unflattenValue("", reflect.ValueOf(&gotE), mapToKVs(want)); err != nil {
 		t.Fatal(err)
 	}
 	if !reflect.DeepEqual(gotE, e) {
@@ -233,7 +235,7 @@ func TestFlattenUints(t *testing.T) {
 	}
 
 	var gotE T
-	if err := unflattenValue("", reflect.ValueOf(&gotE), reflect.TypeOf(&gotE), mapToKVs(want)); err != nil {
+	if err := unflattenValue("", reflect.ValueOf(&gotE), mapToKVs(want)); err != nil {
 		t.Fatal(err)
 	}
 	if !reflect.DeepEqual(gotE, e) {
@@ -266,7 +268,7 @@ func TestFlattenMaps(t *testing.T) {
 	}
 
 	var gotE T
-	if err := unflattenValue("", reflect.ValueOf(&gotE), reflect.TypeOf(&gotE), mapToKVs(want)); err != nil {
+	if err := unflattenValue("", reflect.ValueOf(&gotE), mapToKVs(want)); err != nil {
 		t.Fatal(err)
 	}
 	if !reflect.DeepEqual(gotE, e) {
@@ -297,7 +299,7 @@ func TestFlattenSlices(t *testing.T) {
 	}
 
 	var gotE T
-	if err := unflattenValue("", reflect.ValueOf(&gotE), reflect.TypeOf(&gotE), mapToKVs(want)); err != nil {
+	if err := unflattenValue("", reflect.ValueOf(&gotE), mapToKVs(want)); err != nil {
 		t.Fatal(err)
 	}
 	if !reflect.DeepEqual(gotE, e) {
@@ -328,7 +330,7 @@ func TestFlattenArrays(t *testing.T) {
 	}
 
 	var gotE T
-	if err := unflattenValue("", reflect.ValueOf(&gotE), reflect.TypeOf(&gotE), mapToKVs(want)); err != nil {
+	if err := unflattenValue("", reflect.ValueOf(&gotE), mapToKVs(want)); err != nil {
 		t.Fatal(err)
 	}
 	if !reflect.DeepEqual(gotE, e) {
@@ -363,7 +365,7 @@ func TestFlattenStringers(t *testing.T) {
 	}
 
 	var gotE T
-	if err := unflattenValue("", reflect.ValueOf(&gotE), reflect.TypeOf(&gotE), mapToKVs(want)); err == nil {
+	if err := unflattenValue("", reflect.ValueOf(&gotE), mapToKVs(want)); err == nil {
 		t.Error("unexpectedly successful unflattening into stringer (want strconv error: parsing 'stringer': invalid syntax)")
 	}
 }
@@ -433,7 +435,7 @@ func TestFlattenCacheFields(t *testing.T) {
 	}
 
 	var gotE T
-	if err := unflattenValue("", reflect.ValueOf(&gotE), reflect.TypeOf(&gotE), mapToKVs(want)); err != nil {
+	if err := unflattenValue("", reflect.ValueOf(&gotE), mapToKVs(want)); err != nil {
 		t.Fatal(err)
 	}
 	if !reflect.DeepEqual(gotE, e) {
@@ -462,7 +464,7 @@ func TestFlattenDuration(t *testing.T) {
 	}
 
 	var gotE T
-	if err := unflattenValue("", reflect.ValueOf(&gotE), reflect.TypeOf(&gotE), mapToKVs(want)); err != nil {
+	if err := unflattenValue("", reflect.ValueOf(&gotE), mapToKVs(want)); err != nil {
 		t.Fatal(err)
 	}
 	if !reflect.DeepEqual(gotE, e) {
@@ -497,7 +499,7 @@ func TestFlattenPointers(t *testing.T) {
 	}
 
 	var gotE T
-	if err := unflattenValue("", reflect.ValueOf(&gotE), reflect.TypeOf(&gotE), mapToKVs(want)); err != nil {
+	if err := unflattenValue("", reflect.ValueOf(&gotE), mapToKVs(want)); err != nil {
 		t.Fatal(err)
 	}
 	if !reflect.DeepEqual(gotE, e) {
@@ -533,7 +535,7 @@ func TestUnflattenExtraValues(t *testing.T) {
 	}
 
 	var gotE T
-	if err := unflattenValue("", reflect.ValueOf(&gotE), reflect.TypeOf(&gotE), mapToKVs(m)); err != nil {
+	if err := unflattenValue("", reflect.ValueOf(&gotE), mapToKVs(m)); err != nil {
 		t.Fatal(err)
 	}
 	if !reflect.DeepEqual(gotE, want) {
@@ -558,7 +560,7 @@ func TestUnflatten_emptyMap(t *testing.T) {
 	}
 
 	var gotE T
-	if err := unflattenValue("", reflect.ValueOf(&gotE), reflect.TypeOf(&gotE), mapToKVs(m)); err != nil {
+	if err := unflattenValue("", reflect.ValueOf(&gotE), mapToKVs(m)); err != nil {
 		t.Fatal(err)
 	}
 	if !reflect.DeepEqual(gotE, want) {
@@ -567,6 +569,180 @@ func TestUnflatten_emptyMap(t *testing.T) {
 
 }
 
+type testItem struct {
+	SKU   string
+	Qty   int
+	Attrs map[string]string
+	Price *float64
+}
+
+type testOrderEvent struct {
+	Request struct {
+		Method  string
+		Headers map[string]string
+	}
+	Items    []testItem
+	ByRegion map[string][]testItem
+	Grid     [2][2]int
+	Tags     []string
+	Next     *testOrderEvent
+	Internal string `trace:"-"`
+	Renamed  string `trace:"Alias"`
+	When     time.Time
+}
+
+func flattenToMap(t *testing.T, v interface{}) map[string]string {
+	m := map[string]string{}
+	if err := flattenValue("", reflect.ValueOf(v), func(k, v string) { m[k] = v }); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestFlattenNested(t *testing.T) {
+	price := 9.99
+	e := testOrderEvent{
+		Items: []testItem{
+			{SKU: "a", Qty: 1, Attrs: map[string]string{"color": "red", "x.y": "z"}},
+			{SKU: "b", Qty: 2, Price: &price},
+		},
+		ByRegion: map[string][]testItem{"eu": {{SKU: "c"}}},
+		Grid:     [2][2]int{{1, 2}, {3, 4}},
+		Tags:     []string{"t1", "t2"},
+		Next:     &testOrderEvent{Renamed: "inner", Tags: []string{"t3"}},
+		Internal: "secret",
+		Renamed:  "r",
+		When:     time.Date(2016, 1, 2, 3, 4, 5, 6, time.UTC),
+	}
+	e.Request.Method = "GET"
+	e.Request.Headers = map[string]string{"Accept": "text/html"}
+
+	got := flattenToMap(t, e)
+	for k, v := range map[string]string{
+		"Request.Headers.Accept": "text/html",
+		"Items.0.SKU":            "a",
+		"Items.0.Attrs.x%2Ey":    "z",
+		"Items.1.Price":          "9.99",
+		"ByRegion.eu.0.SKU":      "c",
+		"Grid.1.0":               "3",
+		"Next.Alias":             "inner",
+		"Next.Tags.0":            "t3",
+		"Alias":                  "r",
+	} {
+		if got[k] != v {
+			t.Errorf("got %q = %q, want %q", k, got[k], v)
+		}
+	}
+	for k := range got {
+		if strings.Contains(k, "Internal") || strings.HasPrefix(k, "Next.Next") {
+			t.Errorf("got unexpected key %q", k)
+		}
+	}
+
+	var gotE testOrderEvent
+	if err := unflattenValue("", reflect.ValueOf(&gotE), mapToKVs(got)); err != nil {
+		t.Fatal(err)
+	}
+	e.Internal = ""
+	if !reflect.DeepEqual(gotE, e) {
+		t.Errorf("got %+v, want %+v", gotE, e)
+	}
+}
+
+func TestFlattenCycle(t *testing.T) {
+	type node struct {
+		Name string
+		Next *node
+	}
+	a := &node{Name: "a"}
+	a.Next = &node{Name: "b", Next: a}
+	got := map[string]string{}
+	if err := flattenValue("", reflect.ValueOf(a), func(k, v string) { got[k] = v }); err == nil {
+		t.Error("got no error flattening a cycle")
+	}
+	if want := map[string]string{"Name": "a", "Next.Name": "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// The same pointer may appear more than once without a cycle.
+	shared := &node{Name: "s"}
+	if err := flattenValue("", reflect.ValueOf([]*node{shared, shared}), func(k, v string) {}); err != nil {
+		t.Errorf("got error %q flattening a shared pointer", err)
+	}
+}
+
+func TestFlattenDepth(t *testing.T) {
+	type node struct {
+		Next *node
+		N    int
+	}
+	var deep *node
+	for i := 0; i < maxFlattenDepth+10; i++ {
+		deep = &node{Next: deep, N: i}
+	}
+	if err := flattenValue("", reflect.ValueOf(deep), func(k, v string) {}); err == nil {
+		t.Error("got no error flattening a too deeply nested value")
+	}
+
+	// Deeply nested keys are ignored when unflattening.
+	m := map[string]string{strings.Repeat("Next.", maxFlattenDepth+10) + "N": "1"}
+	var got node
+	if err := unflattenValue("", reflect.ValueOf(&got), mapToKVs(m)); err == nil {
+		t.Error("got no error unflattening a too deeply nested key")
+	}
+}
+
+func TestUnflatten_sliceIndexOutOfRange(t *testing.T) {
+	type T struct{ Items []int }
+	var got T
+	m := map[string]string{"Items.999999999": "1"}
+	if err := unflattenValue("", reflect.ValueOf(&got), mapToKVs(m)); err == nil {
+		t.Error("got no error unflattening a huge slice index")
+	}
+}
+
+// testQuickEvent is a nested struct type whose random values are
+// flattened and unflattened by TestFlattenRoundTrip.
+type testQuickEvent struct {
+	S     string
+	I     int64
+	U     uint8
+	F     float64
+	B     bool
+	Inner struct {
+		Strings []string
+		Ints    map[string]int
+		Ptr     *struct{ X, Y int }
+	}
+	Items []struct {
+		ID    uint32
+		Names map[string]string
+	}
+	Array [3]int16
+}
+
+func TestFlattenRoundTrip(t *testing.T) {
+	// The annotations of a random value are the same once unflattened (its
+	// empty slices, which have no annotations, become nil).
+	f := func(e testQuickEvent) bool {
+		want := flattenToMap(t, e)
+		var gotE testQuickEvent
+		if err := unflattenValue("", reflect.ValueOf(&gotE), mapToKVs(want)); err != nil {
+			t.Logf("unflattening %+v: %s", e, err)
+			return false
+		}
+		got := flattenToMap(t, gotE)
+		if !reflect.DeepEqual(got, want) {
+			t.Logf("got annotations %v, want %v", got, want)
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(f, &quick.Config{MaxCount: 500}); err != nil {
+		t.Error(err)
+	}
+}
+
 type testInnerEvent struct {
 	Days  map[string]int
 	Other []bool
@@ -0,0 +1,341 @@
+package appdash
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultEventRegistry is the registry of the event types registered with
+// RegisterEvent, which UnmarshalEvents uses.
+var DefaultEventRegistry = NewEventRegistry(nil)
+
+// RegisteredEvents returns the sorted schemas of the event types
+// registered with RegisterEvent.
+func RegisteredEvents() []string {
+	return DefaultEventRegistry.Events()
+}
+
+// NamespacedSchema returns the schema name in the given namespace, for
+// event types whose plain names (such as "query") are likely to collide
+// with those of other packages. The namespace is usually the name of the
+// package that defines the event type, as in:
+//
+//	func (QueryEvent) Schema() string { return appdash.NamespacedSchema("mydb", "query") }
+//
+// Annotations recorded with the plain name (before the event type was
+// namespaced) are still unmarshaled into the event type, as long as no
+// other registered event type has that plain name.
+func NamespacedSchema(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// schemaName returns the plain name of the (possibly namespaced) schema.
+func schemaName(schema string) string {
+	return schema[strings.LastIndex(schema, "/")+1:]
+}
+
+// An EventRegistry maps event schemas to the event types that
+// UnmarshalEvents decodes them into. It is safe for concurrent use.
+//
+// Most programs only use DefaultEventRegistry (through RegisterEvent and
+// UnmarshalEvents). Scoped registries, created with a parent, let tests
+// register throwaway event types without adding them to the parent.
+type EventRegistry struct {
+	parent *EventRegistry
+
+	mu     sync.RWMutex
+	events map[string]registeredEvent // event schema -> event type
+}
+
+// registeredEvent is an event type, and where it was registered.
+type registeredEvent struct {
+	e  Event
+	at string
+}
+
+func (re registeredEvent) String() string {
+	t := reflect.TypeOf(re.e)
+	name := t.String()
+	if t.PkgPath() != "" {
+		name = t.PkgPath() + "." + t.Name() // the full import path
+	}
+	return fmt.Sprintf("%s (registered at %s)", name, re.at)
+}
+
+// NewEventRegistry returns a new registry. If parent is non-nil, the new
+// registry also holds the event types of parent (and those later
+// registered with it).
+func NewEventRegistry(parent *EventRegistry) *EventRegistry {
+	return &EventRegistry{parent: parent, events: map[string]registeredEvent{}}
+}
+
+// Register registers an event type (that of e) with the registry. It
+// returns an error if e's schema is empty, or if an event type with the
+// same schema is already registered with r or its ancestors, which
+// identifies both event types.
+func (r *EventRegistry) Register(e Event) error {
+	return r.register(e, callerLine(1))
+}
+
+func (r *EventRegistry) register(e Event, at string) error {
+	schema := e.Schema()
+	if schema == "" {
+		return fmt.Errorf("appdash: event %T has an empty schema", e)
+	}
+	re := registeredEvent{e: e, at: at}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, present := r.events[schema]
+	if !present && r.parent != nil {
+		existing, present = r.parent.lookup(schema)
+	}
+	if present {
+		return fmt.Errorf("appdash: event schema %q is already registered by %s, can't register %s", schema, existing, re)
+	}
+	r.events[schema] = re
+	return nil
+}
+
+// lookup returns the event type registered with r or its ancestors for
+// the schema.
+func (r *EventRegistry) lookup(schema string) (registeredEvent, bool) {
+	for ; r != nil; r = r.parent {
+		r.mu.RLock()
+		re, ok := r.events[schema]
+		r.mu.RUnlock()
+		if ok {
+			return re, true
+		}
+	}
+	return registeredEvent{}, false
+}
+
+// all returns the event types registered with r and its ancestors, by
+// schema.
+func (r *EventRegistry) all() map[string]Event {
+	m := map[string]Event{}
+	for ; r != nil; r = r.parent {
+		r.mu.RLock()
+		for schema, re := range r.events {
+			if _, shadowed := m[schema]; !shadowed {
+				m[schema] = re.e
+			}
+		}
+		r.mu.RUnlock()
+	}
+	return m
+}
+
+// isImportant reports whether one of the event types registered with r or
+// its ancestors considers the annotation key important (see
+// ImportantEvent). Unlike all, it doesn't copy the registered event types.
+func (r *EventRegistry) isImportant(key string) bool {
+	for ; r != nil; r = r.parent {
+		r.mu.RLock()
+		important := false
+	events:
+		for _, re := range r.events {
+			i, ok := re.e.(ImportantEvent)
+			if !ok {
+				continue
+			}
+			for _, k := range i.Important() {
+				if k == key {
+					important = true
+					break events
+				}
+			}
+		}
+		r.mu.RUnlock()
+		if important {
+			return true
+		}
+	}
+	return false
+}
+
+// Events returns the sorted schemas of the event types registered with r
+// and its ancestors.
+func (r *EventRegistry) Events() []string {
+	all := r.all()
+	schemas := make([]string, 0, len(all))
+	for schema := range all {
+		schemas = append(schemas, schema)
+	}
+	sort.Strings(schemas)
+	return schemas
+}
+
+// Event returns (a zero value of) the event type that annotations with
+// the given schema are unmarshaled into, or nil if there is none.
+//
+// A plain (non-namespaced) schema that isn't registered resolves to the
+// only registered namespaced schema with that name, if there is exactly
+// one; see NamespacedSchema.
+func (r *EventRegistry) Event(schema string) Event {
+	if re, ok := r.lookup(schema); ok {
+		return re.e
+	}
+	if strings.Contains(schema, "/") {
+		return nil
+	}
+	var match Event
+	for s, e := range r.all() {
+		if strings.Contains(s, "/") && schemaName(s) == schema {
+			if match != nil {
+				return nil // ambiguous
+			}
+			match = e
+		}
+	}
+	return match
+}
+
+// UnmarshalEvents unmarshals all events found in anns into events, using
+// the event types registered with r. Any schemas found in anns that were
+// not registered are ignored; missing a schema is not an error. All of the
+// events of the schemas of RepeatedEvent types are unmarshaled.
+func (r *EventRegistry) UnmarshalEvents(anns Annotations, events *[]Event) error {
+	for _, schema := range anns.schemas() {
+		ev := r.Event(schema)
+		if ev == nil {
+			continue
+		}
+		if _, ok := ev.(RepeatedEvent); ok {
+			for _, inst := range repeatedInstances(anns, schema) {
+				e, _, err := newEvent(inst.anns, ev)
+				if err != nil {
+					return err
+				}
+				*events = append(*events, e)
+			}
+			continue
+		}
+		e, _, err := newEvent(anns, ev)
+		if err != nil {
+			return err
+		}
+		*events = append(*events, e)
+	}
+	return nil
+}
+
+// newEvent unmarshals anns into a new event of the same type as ev,
+// returning the error of unmarshaling any of its fields separately (see
+// unmarshalEvent).
+func newEvent(anns Annotations, ev Event) (e Event, fieldErr, err error) {
+	evv := reflect.New(reflect.TypeOf(ev))
+	fieldErr, err = unmarshalEvent(anns, evv.Interface().(Event))
+	if err != nil {
+		return nil, nil, err
+	}
+	return evv.Elem().Interface().(Event), fieldErr, nil
+}
+
+// UnmarshalEventsTolerant is like UnmarshalEvents, but returns the events
+// of the schemas that aren't registered (or that fail to unmarshal) as
+// RawEvents instead of skipping them, so that viewers can display the data
+// of event types they don't know about.
+//
+// It unmarshals all of the events it can, and returns an
+// *EventsUnmarshalError listing the schemas that failed to unmarshal, if
+// any.
+func UnmarshalEventsTolerant(anns Annotations, events *[]Event) error {
+	return DefaultEventRegistry.UnmarshalEventsTolerant(anns, events)
+}
+
+// UnmarshalEventsTolerant is like UnmarshalEvents, but returns the events
+// of the schemas that aren't registered with r as RawEvents (see the
+// UnmarshalEventsTolerant func).
+func (r *EventRegistry) UnmarshalEventsTolerant(anns Annotations, events *[]Event) error {
+	var (
+		unmarshalErr *EventsUnmarshalError
+		raw          []string            // schemas of the raw events
+		decoded      = map[string]bool{} // keys of the unmarshaled annotations
+	)
+	for _, schema := range anns.schemas() {
+		ev := r.Event(schema)
+		if ev == nil {
+			raw = append(raw, schema)
+			continue
+		}
+
+		// The annotations of each event of the schema (of which there are
+		// many only for repeated events), and their indexes.
+		instances := []repeatedInstance{{index: -1, anns: anns}}
+		if _, ok := ev.(RepeatedEvent); ok {
+			instances = repeatedInstances(anns, schema)
+		}
+		var failed bool
+		for _, inst := range instances {
+			e, fieldErr, err := newEvent(inst.anns, ev)
+			if err == nil {
+				err = fieldErr
+			}
+			if err != nil {
+				if unmarshalErr == nil {
+					unmarshalErr = &EventsUnmarshalError{}
+				}
+				unmarshalErr.Schemas = append(unmarshalErr.Schemas, schema)
+				unmarshalErr.Errors = append(unmarshalErr.Errors, err)
+				failed = true
+				continue
+			}
+			*events = append(*events, e)
+			var eanns Annotations
+			if inst.index < 0 {
+				eanns, err = MarshalEvent(e)
+			} else {
+				eanns, err = MarshalRepeatedEvent(e, inst.index)
+			}
+			if err == nil {
+				for _, a := range eanns {
+					decoded[normalizeKey(a.Key)] = true
+				}
+			}
+		}
+		if failed {
+			raw = append(raw, schema)
+		}
+	}
+
+	for _, schema := range raw {
+		fields := map[string]string{}
+		for _, a := range anns {
+			if decoded[a.Key] || strings.HasPrefix(a.Key, SchemaPrefix) {
+				continue
+			}
+			fields[UnescapeKey(a.Key)] = string(a.Value)
+		}
+		*events = append(*events, RawEvent{SchemaName: schema, Fields: fields})
+	}
+
+	if unmarshalErr != nil {
+		return unmarshalErr
+	}
+	return nil
+}
+
+// An EventsUnmarshalError is returned by UnmarshalEventsTolerant when the
+// annotations of some of the registered schemas fail to unmarshal.
+type EventsUnmarshalError struct {
+	Schemas []string // schemas that failed to unmarshal
+	Errors  []error  // the errors, in the same order as Schemas
+}
+
+func (e *EventsUnmarshalError) Error() string {
+	msgs := make([]string, len(e.Schemas))
+	for i, schema := range e.Schemas {
+		msgs[i] = fmt.Sprintf("%s: %s", schema, e.Errors[i])
+	}
+	return "appdash: failed to unmarshal events: " + strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the errors, for errors.Is and errors.As.
+func (e *EventsUnmarshalError) Unwrap() []error {
+	return e.Errors
+}
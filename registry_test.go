@@ -0,0 +1,185 @@
+package appdash
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testQueryEvent struct{ Query string }
+
+func (testQueryEvent) Schema() string { return "query" }
+
+type testNamespacedQueryEvent struct{ Query string }
+
+func (testNamespacedQueryEvent) Schema() string { return NamespacedSchema("testdb", "query") }
+
+type testOtherQueryEvent struct{ SQL string }
+
+func (testOtherQueryEvent) Schema() string { return NamespacedSchema("otherdb", "query") }
+
+func TestEventRegistry_duplicate(t *testing.T) {
+	r := NewEventRegistry(nil)
+	if err := r.Register(testQueryEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	err := r.Register(testQueryEvent{})
+	if err == nil {
+		t.Fatal("got no error registering a schema twice")
+	}
+	// The error identifies both registrants.
+	if got := err.Error(); strings.Count(got, "appdash.testQueryEvent") != 2 || strings.Count(got, "registry_test.go:") != 2 {
+		t.Errorf("got error %q, want it to identify both registrants", got)
+	}
+
+	if err := r.Register(testNamespacedQueryEvent{}); err != nil {
+		t.Errorf("namespaced schema: %s", err)
+	}
+}
+
+func TestEventRegistry_scoped(t *testing.T) {
+	parent := NewEventRegistry(nil)
+	if err := parent.Register(testQueryEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	r := NewEventRegistry(parent)
+	if err := r.Register(testQueryEvent{}); err == nil {
+		t.Error("got no error registering a schema that the parent registered")
+	}
+	if err := r.Register(testNamespacedQueryEvent{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := r.Events(), []string{"query", "testdb/query"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got events %q, want %q", got, want)
+	}
+	if got, want := parent.Events(), []string{"query"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got parent events %q, want %q", got, want)
+	}
+}
+
+// testImportantEvent is an event type with an important annotation key.
+type testImportantEvent struct{ Query string }
+
+func (testImportantEvent) Schema() string      { return "important" }
+func (testImportantEvent) Important() []string { return []string{"important.Query"} }
+
+func TestEventRegistry_isImportant(t *testing.T) {
+	parent := NewEventRegistry(nil)
+	if err := parent.Register(testImportantEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	r := NewEventRegistry(parent)
+	if err := r.Register(testQueryEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"important.Query", "query.Query", "Name"} {
+		if got, want := r.isImportant(key), key == "important.Query"; got != want {
+			t.Errorf("%s: got important %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestRegisteredEvents(t *testing.T) {
+	got := RegisteredEvents()
+	for _, want := range []string{"name", "msg", "error"} {
+		found := false
+		for _, schema := range got {
+			found = found || schema == want
+		}
+		if !found {
+			t.Errorf("schema %q not in %q", want, got)
+		}
+	}
+}
+
+func TestEventRegistry_legacySchema(t *testing.T) {
+	r := NewEventRegistry(nil)
+	if err := r.Register(testNamespacedQueryEvent{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, schema := range []string{"testdb/query", "query"} {
+		anns := Annotations{
+			{Key: "Query", Value: []byte("q")},
+			{Key: SchemaPrefix + schema},
+		}
+		var events []Event
+		if err := r.UnmarshalEvents(anns, &events); err != nil {
+			t.Fatal(err)
+		}
+		if want := []Event{testNamespacedQueryEvent{Query: "q"}}; !reflect.DeepEqual(events, want) {
+			t.Errorf("%s: got events %#v, want %#v", schema, events, want)
+		}
+	}
+
+	// The plain name is ambiguous once another namespace defines it.
+	if err := r.Register(testOtherQueryEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	if e := r.Event("query"); e != nil {
+		t.Errorf("got event %#v for an ambiguous plain schema, want nil", e)
+	}
+}
+
+type testFailingEvent struct{}
+
+func (testFailingEvent) Schema() string { return "failing" }
+
+func (testFailingEvent) UnmarshalEvent(Annotations) (Event, error) {
+	return nil, errors.New("bad annotations")
+}
+
+func TestUnmarshalEventsTolerant(t *testing.T) {
+	r := NewEventRegistry(nil)
+	if err := r.Register(testQueryEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(testFailingEvent{}); err != nil {
+		t.Fatal(err)
+	}
+
+	anns := Annotations{
+		{Key: "Query", Value: []byte("q")},
+		{Key: "Rows", Value: []byte("3")},
+		{Key: SchemaPrefix + "query"},
+		{Key: SchemaPrefix + "newer"},
+		{Key: SchemaPrefix + "failing"},
+	}
+
+	// The strict mode skips the unknown schema, and fails.
+	var events []Event
+	if err := r.UnmarshalEvents(anns, &events); err == nil {
+		t.Error("UnmarshalEvents: got no error")
+	}
+
+	events = nil
+	err := r.UnmarshalEventsTolerant(anns, &events)
+	uerr, ok := err.(*EventsUnmarshalError)
+	if !ok {
+		t.Fatalf("got error %v, want *EventsUnmarshalError", err)
+	}
+	if want := []string{"failing"}; !reflect.DeepEqual(uerr.Schemas, want) {
+		t.Errorf("got failed schemas %q, want %q", uerr.Schemas, want)
+	}
+
+	fields := map[string]string{"Rows": "3"}
+	want := []Event{
+		testQueryEvent{Query: "q"},
+		RawEvent{SchemaName: "newer", Fields: fields},
+		RawEvent{SchemaName: "failing", Fields: fields},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("got events %#v, want %#v", events, want)
+	}
+
+	// Raw events marshal back into their annotations.
+	as, err := MarshalEvent(events[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"Rows": "3", SchemaPrefix + "newer": ""}; !reflect.DeepEqual(as.StringMap(), want) {
+		t.Errorf("got annotations %#v, want %#v", as.StringMap(), want)
+	}
+}
@@ -0,0 +1,88 @@
+package appdash
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A RepeatedEvent is an event that a span may have any number of, such as
+// a log message. Each of them is recorded with the keys of its annotations
+// under its own index prefix, "<schema>.<index>." (see
+// MarshalRepeatedEvent), so that the annotations of the events of a span
+// don't collide, and UnmarshalEvents decodes all of them, in the order of
+// their indexes.
+type RepeatedEvent interface {
+	Event
+
+	// RepeatedEvent is a marker method, which does nothing.
+	RepeatedEvent()
+}
+
+// MarshalRepeatedEvent marshals an event into annotations, like
+// MarshalEvent, except that their keys (other than that of the schema
+// annotation) are under the index prefix of the event, so that it doesn't
+// collide with the other events of the schema on the span, whose indexes
+// must differ. Recorder.Event numbers the repeated events of a span from 0.
+//
+// For example, the LogLevelEvent with index 2 is recorded as the
+// annotations "leveledlog.2.Level", "leveledlog.2.Msg",
+// "leveledlog.2.Time".
+func MarshalRepeatedEvent(e Event, index int) (Annotations, error) {
+	as, err := MarshalEvent(e)
+	if err != nil {
+		return nil, err
+	}
+	prefix := repeatedPrefix(e.Schema(), index)
+	for i, a := range as {
+		if !strings.HasPrefix(a.Key, SchemaPrefix) {
+			as[i].Key = prefix + a.Key
+		}
+	}
+	return as, nil
+}
+
+// repeatedPrefix returns the prefix of the keys of the repeated event of
+// the schema with the given index.
+func repeatedPrefix(schema string, index int) string {
+	return schema + "." + strconv.Itoa(index) + "."
+}
+
+// A repeatedInstance holds the annotations of one of the repeated events
+// of a schema, with the index prefix removed from their keys.
+type repeatedInstance struct {
+	index int
+	anns  Annotations
+}
+
+// repeatedInstances returns the annotations of each of the repeated events
+// of the schema in as, in the order of their indexes. The annotations of
+// each include the schema annotation, so that they can be unmarshaled
+// with UnmarshalEvent.
+func repeatedInstances(as Annotations, schema string) []repeatedInstance {
+	schema = EscapeKey(schema) // as recorded
+	byIndex := map[int]Annotations{}
+	for _, a := range as {
+		if !strings.HasPrefix(a.Key, schema+".") {
+			continue
+		}
+		rest := a.Key[len(schema)+1:]
+		dot := strings.Index(rest, ".")
+		if dot <= 0 {
+			continue
+		}
+		index, err := strconv.Atoi(rest[:dot])
+		if err != nil || index < 0 {
+			continue
+		}
+		byIndex[index] = append(byIndex[index], Annotation{Key: rest[dot+1:], Value: a.Value})
+	}
+
+	instances := make([]repeatedInstance, 0, len(byIndex))
+	for index, anns := range byIndex {
+		anns = append(anns, Annotation{Key: SchemaPrefix + schema})
+		instances = append(instances, repeatedInstance{index: index, anns: anns})
+	}
+	sort.Slice(instances, func(i, j int) bool { return instances[i].index < instances[j].index })
+	return instances
+}
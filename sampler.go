@@ -0,0 +1,648 @@
+package appdash
+
+import (
+	"container/list"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultSamplerCacheSize is the default number of traces whose sampling
+// decision is remembered by a RateSamplerCollector.
+const DefaultSamplerCacheSize = 10000
+
+// DefaultMaxPendingSpans is the default number of collections held back by
+// a RuleSamplerCollector until the root span of their trace is seen.
+const DefaultMaxPendingSpans = 10000
+
+// DefaultMaxPendingTime is the default time for which a RuleSamplerCollector
+// holds back the collections of a trace until its root span is seen.
+const DefaultMaxPendingTime = 30 * time.Second
+
+// A SamplingCollector is a collector that may drop spans, and that can
+// tell beforehand whether it keeps the collections of a span. Recorders use
+// it to avoid evaluating the lazy events of the spans that are dropped (see
+// Recorder.LazyEvent).
+type SamplingCollector interface {
+	Collector
+
+	// Sampled reports whether the collections of span are kept. If the
+	// decision can't be known until the span (or another span of its
+	// trace) is collected, ok is false.
+	Sampled(span SpanID) (keep, ok bool)
+}
+
+// sampled reports whether c (if it is a SamplingCollector) keeps the
+// collections of span.
+func sampled(c Collector, span SpanID) (keep, ok bool) {
+	if sc, isSampling := c.(SamplingCollector); isSampling {
+		return sc.Sampled(span)
+	}
+	return false, false
+}
+
+// A HeadSampler decides whether a new trace, identified by its root span
+// ID, is sampled. See DefaultHeadSampler.
+type HeadSampler func(root SpanID) bool
+
+// DefaultHeadSampler, if non-nil, decides whether the traces whose root
+// span IDs are created by NewRootSpanID are sampled. Unlike the decisions
+// of the sampling collectors, which are made wherever spans are collected,
+// the decision is made once, at the root, and carried by the flags of the
+// span IDs of the trace (see SpanID.Sampled) to the other processes that
+// record its spans. Recorders don't collect the spans of the traces that
+// aren't sampled (see Recorder.ForceRecord).
+//
+// If DefaultHeadSampler is nil, the root span IDs have no flags, and all
+// traces are sampled. It should be set before any spans are created
+// (e.g., at the start of main).
+var DefaultHeadSampler HeadSampler
+
+// RateHeadSampler returns a HeadSampler that samples roughly the given
+// fraction of traces (from 0 to 1). Like NewSamplerCollector, it decides
+// by a hash of the trace ID, so a trace sampled at some rate is also
+// sampled at any higher rate.
+func RateHeadSampler(rate float64) HeadSampler {
+	return func(root SpanID) bool { return sampleTrace(root.Trace, rate) }
+}
+
+// NewSamplerCollector returns a collector that passes the spans of roughly
+// the given fraction of traces (from 0 to 1) to c, and drops the others. For
+// example, to keep 1% of the traces recorded by a Recorder:
+//
+//	c := appdash.NewSamplerCollector(appdash.NewRemoteCollector(addr), 0.01)
+//	rec := appdash.NewRecorder(appdash.NewRootSpanID(), c)
+//
+// The decision to keep a trace is derived from a hash of its ID, so all of
+// the spans of a trace are either kept or dropped, even when they are
+// recorded by different processes sampling at the same rate. A trace kept at
+// some rate is also kept at any higher rate.
+func NewSamplerCollector(c Collector, rate float64) *SamplerCollector {
+	return &SamplerCollector{c: c, rate: rate}
+}
+
+// A SamplerCollector passes the spans of a fraction of traces to its
+// underlying collector. See NewSamplerCollector.
+type SamplerCollector struct {
+	c    Collector
+	rate float64
+
+	kept, dropped uint64 // accessed atomically
+}
+
+// Collect implements the Collector interface by passing the span to the
+// underlying collector if its trace is sampled, and dropping it otherwise.
+func (sc *SamplerCollector) Collect(span SpanID, anns ...Annotation) error {
+	if !sampleTrace(span.Trace, sc.rate) {
+		atomic.AddUint64(&sc.dropped, 1)
+		return nil
+	}
+	atomic.AddUint64(&sc.kept, 1)
+	return sc.c.Collect(span, anns...)
+}
+
+// Sampled implements the SamplingCollector interface. The decision for a
+// span is always known, since it only depends on its trace ID.
+func (sc *SamplerCollector) Sampled(span SpanID) (keep, ok bool) {
+	return sampleTrace(span.Trace, sc.rate), true
+}
+
+// Kept returns the number of collections passed to the underlying
+// collector.
+func (sc *SamplerCollector) Kept() uint64 {
+	return atomic.LoadUint64(&sc.kept)
+}
+
+// Dropped returns the number of collections dropped because their trace
+// wasn't sampled.
+func (sc *SamplerCollector) Dropped() uint64 {
+	return atomic.LoadUint64(&sc.dropped)
+}
+
+// sampleTrace reports whether the trace is kept when sampling at the given
+// rate. The decision is deterministic: the trace is kept if a hash of its
+// ID, as a fraction of the range of the hash, is below rate.
+func sampleTrace(trace ID, rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	threshold := rate * (1 << 64)
+	if threshold >= 1<<64 {
+		return true
+	}
+	return traceHash(trace) < uint64(threshold)
+}
+
+// traceHash mixes the bits of a trace ID (with the finalizer of
+// SplitMix64), so that sampling is uniform even for IDs that aren't
+// uniformly distributed, like sequential ones generated by other clients.
+func traceHash(trace ID) uint64 {
+	x := uint64(trace)
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// NewRateSamplerCollector returns a collector that passes the spans of at
+// most tracesPerSecond new traces per second (on average) to c, and drops
+// the others. Once a trace is admitted, all of its later spans are passed,
+// and once it is dropped, all of them are dropped, as long as the trace is
+// still in the collector's cache (see CacheSize).
+//
+// Unlike NewSamplerCollector, the decision depends on when each process
+// first sees the trace, so the spans of a trace recorded by several
+// processes may be sampled differently by each of them.
+func NewRateSamplerCollector(c Collector, tracesPerSecond float64) *RateSamplerCollector {
+	return &RateSamplerCollector{c: c, rate: tracesPerSecond, now: time.Now}
+}
+
+// A RateSamplerCollector passes the spans of a limited number of new traces
+// per second to its underlying collector. See NewRateSamplerCollector.
+type RateSamplerCollector struct {
+	c    Collector
+	rate float64
+
+	// Burst is the maximum number of new traces admitted at once, after a
+	// period without any.
+	//
+	// Default Burst = the rate, rounded up.
+	Burst int
+
+	// CacheSize is the maximum number of traces whose sampling decision is
+	// remembered. The decision for the trace that was least recently seen
+	// is forgotten first, and made again if more of its spans are
+	// collected.
+	//
+	// Default CacheSize = DefaultSamplerCacheSize.
+	CacheSize int
+
+	now func() time.Time // the clock of the rate limiter (for tests)
+
+	mu        sync.Mutex   // guards limiter and decisions
+	limiter   *rateLimiter // created on first use
+	decisions *idLRU       // trace ID -> whether the trace is kept
+
+	kept, dropped uint64 // accessed atomically
+}
+
+// Collect implements the Collector interface by passing the span to the
+// underlying collector if its trace is admitted, and dropping it otherwise.
+func (sc *RateSamplerCollector) Collect(span SpanID, anns ...Annotation) error {
+	sc.mu.Lock()
+	if sc.limiter == nil {
+		size := sc.CacheSize
+		if size <= 0 {
+			size = DefaultSamplerCacheSize
+		}
+		sc.limiter = newRateLimiter(sc.rate, sc.Burst, sc.now())
+		sc.decisions = newIDLRU(size)
+	}
+	keep, ok := sc.decisions.get(span.Trace)
+	if !ok {
+		keep = sc.limiter.allow(sc.now())
+		sc.decisions.add(span.Trace, keep)
+	}
+	sc.mu.Unlock()
+
+	if !keep {
+		atomic.AddUint64(&sc.dropped, 1)
+		return nil
+	}
+	atomic.AddUint64(&sc.kept, 1)
+	return sc.c.Collect(span, anns...)
+}
+
+// Sampled implements the SamplingCollector interface. The decision for a
+// span is known once a span of its trace was collected (and as long as the
+// trace is still in the cache).
+func (sc *RateSamplerCollector) Sampled(span SpanID) (keep, ok bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.decisions == nil {
+		return false, false
+	}
+	return sc.decisions.get(span.Trace)
+}
+
+// Kept returns the number of collections passed to the underlying
+// collector.
+func (sc *RateSamplerCollector) Kept() uint64 {
+	return atomic.LoadUint64(&sc.kept)
+}
+
+// Dropped returns the number of collections dropped because their trace
+// wasn't admitted.
+func (sc *RateSamplerCollector) Dropped() uint64 {
+	return atomic.LoadUint64(&sc.dropped)
+}
+
+// A SamplingRule is a rule of a RuleSamplerCollector, which sets the
+// sampling rate of the traces whose root span matches all of its non-zero
+// conditions.
+type SamplingRule struct {
+	// Name, if non-empty, is a pattern that the span name (see Span.Name)
+	// must match, where '*' matches any sequence of characters and '?' any
+	// single character, for example "GET /health*".
+	Name string
+
+	// NameRegexp, if non-nil, must match the span name.
+	NameRegexp *regexp.Regexp
+
+	// Annotation, if non-empty, is the key of an annotation that the span
+	// must have, for example the key of an error annotation.
+	Annotation string
+
+	// Root is whether only root spans match. It only makes a difference for
+	// the traces whose root span isn't seen (see
+	// RuleSamplerCollector.MaxPendingSpans).
+	Root bool
+
+	// Rate is the fraction of the matching traces that are kept, from 0
+	// to 1.
+	Rate float64
+}
+
+// matches reports whether the rule matches a span, given the name pattern
+// compiled to a regexp (nil if the rule has none).
+func (r *SamplingRule) matches(span SpanID, anns Annotations, name *regexp.Regexp) bool {
+	if r.Root && !span.IsRoot() {
+		return false
+	}
+	if r.Annotation != "" && !anns.Has(EscapeKey(r.Annotation)) {
+		return false
+	}
+	if name != nil || r.NameRegexp != nil {
+		if !anns.Has("Name") {
+			return false
+		}
+		spanName := string(anns.Get("Name"))
+		if name != nil && !name.MatchString(spanName) {
+			return false
+		}
+		if r.NameRegexp != nil && !r.NameRegexp.MatchString(spanName) {
+			return false
+		}
+	}
+	return true
+}
+
+// globRegexp compiles a SamplingRule name pattern.
+func globRegexp(pattern string) *regexp.Regexp {
+	var re []string
+	for _, c := range pattern {
+		switch c {
+		case '*':
+			re = append(re, ".*")
+		case '?':
+			re = append(re, ".")
+		default:
+			re = append(re, regexp.QuoteMeta(string(c)))
+		}
+	}
+	return regexp.MustCompile("^(?s:" + strings.Join(re, "") + ")$")
+}
+
+// NewRuleSamplerCollector returns a collector that passes the spans of a
+// fraction of traces to c, and drops the others, like NewSamplerCollector,
+// except that the rate is set by the first of the rules that matches the
+// root span of the trace (or defaultRate, if none does). For example, to
+// keep all of the traces with errors, 0.1% of the health checks, and 5% of
+// the rest:
+//
+//	c := appdash.NewRuleSamplerCollector(collector, []appdash.SamplingRule{
+//		{Annotation: "Error", Rate: 1},
+//		{Name: "GET /health*", Rate: 0.001},
+//	}, 0.05)
+//
+// Since the root span of a trace is usually collected after its children
+// (when its Recorder is finished), the collections of the traces whose root
+// span hasn't been seen yet are held back until it is (see MaxPendingSpans
+// and MaxPendingTime), unless the sampling decision for the trace is
+// carried by their span IDs (see SpanID.Flags). Once a trace is decided,
+// its later collections follow the decision, as long as the trace is still
+// in the collector's cache (see CacheSize). Call Close to decide the
+// traces that are still held back, for example when the program exits.
+func NewRuleSamplerCollector(c Collector, rules []SamplingRule, defaultRate float64) *RuleSamplerCollector {
+	names := make([]*regexp.Regexp, len(rules))
+	for i, r := range rules {
+		if r.Name != "" {
+			names[i] = globRegexp(r.Name)
+		}
+	}
+	return &RuleSamplerCollector{c: c, rules: rules, names: names, defaultRate: defaultRate, now: time.Now}
+}
+
+// A RuleSamplerCollector passes the spans of a fraction of traces, set by
+// rules, to its underlying collector. See NewRuleSamplerCollector.
+type RuleSamplerCollector struct {
+	c           Collector
+	rules       []SamplingRule
+	names       []*regexp.Regexp // compiled rules[i].Name
+	defaultRate float64
+
+	// CacheSize is the maximum number of traces whose sampling decision is
+	// remembered. The decision for the trace that was least recently seen
+	// is forgotten first.
+	//
+	// Default CacheSize = DefaultSamplerCacheSize.
+	CacheSize int
+
+	// MaxPendingSpans is the maximum number of collections held back until
+	// the root span of their trace is seen. When it is exceeded, the trace
+	// that has been held back the longest is decided by applying the rules
+	// to its first collection instead (which is also how the traces whose
+	// root span is recorded by another process end up being decided, if
+	// their span IDs don't carry the decision).
+	//
+	// Default MaxPendingSpans = DefaultMaxPendingSpans.
+	MaxPendingSpans int
+
+	// MaxPendingTime is the maximum time for which the collections of a
+	// trace are held back until its root span is seen. The traces held
+	// back for longer are decided like when MaxPendingSpans is exceeded,
+	// by Collect, and by Flush (see Start).
+	//
+	// Default MaxPendingTime = DefaultMaxPendingTime.
+	MaxPendingTime time.Duration
+
+	// Log, if non-nil, is used to log the errors of the underlying
+	// collector when the traces held back are decided in the background
+	// (see Start).
+	Log *log.Logger
+
+	now func() time.Time // the clock (for tests)
+
+	mu         sync.Mutex // guards the fields below
+	decisions  *idLRU     // trace ID -> whether the trace is kept
+	pending    *list.List // *pendingTrace, held back the longest first
+	pendingBy  map[ID]*list.Element
+	numPending int           // number of collections held back
+	stopChan   chan struct{} // closed to stop the background decisions
+
+	kept, dropped uint64 // accessed atomically
+}
+
+// A pendingTrace holds the collections of a trace whose root span hasn't
+// been seen yet.
+type pendingTrace struct {
+	trace ID
+	spans []queuedSpan
+	first time.Time // when the first collection was held back
+}
+
+// A sampledTrace is the decision for a trace and its collections that
+// are to be kept or dropped accordingly.
+type sampledTrace struct {
+	keep  bool
+	spans []queuedSpan
+}
+
+// Collect implements the Collector interface by passing the span to the
+// underlying collector if its trace is sampled, dropping it if it isn't, or
+// holding it back until the root span of its trace is seen.
+func (sc *RuleSamplerCollector) Collect(span SpanID, anns ...Annotation) error {
+	now := sc.now()
+
+	sc.mu.Lock()
+	sc.initNoLock()
+	var decided []sampledTrace
+	if keep, ok := sc.decisions.get(span.Trace); ok {
+		decided = append(decided, sampledTrace{keep, []queuedSpan{{span, anns}}})
+	} else if span.Flags&FlagSamplingDecided != 0 {
+		// The decision was made at the root, by a HeadSampler.
+		var spans []queuedSpan
+		if e, ok := sc.pendingBy[span.Trace]; ok {
+			spans = sc.removePendingNoLock(e).spans
+		}
+		sc.decisions.add(span.Trace, span.Sampled())
+		decided = append(decided, sampledTrace{span.Sampled(), append(spans, queuedSpan{span, anns})})
+	} else if span.IsRoot() {
+		var spans []queuedSpan
+		if e, ok := sc.pendingBy[span.Trace]; ok {
+			spans = sc.removePendingNoLock(e).spans
+		}
+		root := queuedSpan{span, anns}
+		decided = append(decided, sc.decideNoLock(root, append(spans, root)))
+	} else {
+		e, ok := sc.pendingBy[span.Trace]
+		if !ok {
+			e = sc.pending.PushBack(&pendingTrace{trace: span.Trace, first: now})
+			sc.pendingBy[span.Trace] = e
+		}
+		t := e.Value.(*pendingTrace)
+		t.spans = append(t.spans, queuedSpan{span, anns})
+		sc.numPending++
+
+		max := sc.MaxPendingSpans
+		if max <= 0 {
+			max = DefaultMaxPendingSpans
+		}
+		for sc.numPending > max {
+			t := sc.removePendingNoLock(sc.pending.Front())
+			decided = append(decided, sc.decideNoLock(t.spans[0], t.spans))
+		}
+	}
+	decided = append(decided, sc.decidePendingNoLock(now, false)...)
+	sc.mu.Unlock()
+
+	return sc.collect(decided)
+}
+
+// initNoLock initializes the decisions and the traces held back, on first
+// use. The sc.mu lock must be held.
+func (sc *RuleSamplerCollector) initNoLock() {
+	if sc.decisions != nil {
+		return
+	}
+	size := sc.CacheSize
+	if size <= 0 {
+		size = DefaultSamplerCacheSize
+	}
+	sc.decisions = newIDLRU(size)
+	sc.pending = list.New()
+	sc.pendingBy = map[ID]*list.Element{}
+}
+
+// decidePendingNoLock decides the traces held back for longer than
+// MaxPendingTime, or all of them if all is true, by applying the rules to
+// their first collection. The sc.mu lock must be held.
+func (sc *RuleSamplerCollector) decidePendingNoLock(now time.Time, all bool) []sampledTrace {
+	maxTime := sc.MaxPendingTime
+	if maxTime <= 0 {
+		maxTime = DefaultMaxPendingTime
+	}
+	var decided []sampledTrace
+	for sc.pending.Len() > 0 {
+		e := sc.pending.Front()
+		if !all && now.Sub(e.Value.(*pendingTrace).first) < maxTime {
+			break
+		}
+		t := sc.removePendingNoLock(e)
+		decided = append(decided, sc.decideNoLock(t.spans[0], t.spans))
+	}
+	return decided
+}
+
+// collect passes the collections of the kept traces to the underlying
+// collector, counts the dropped ones, and returns the first error.
+func (sc *RuleSamplerCollector) collect(decided []sampledTrace) error {
+	var firstErr error
+	for _, t := range decided {
+		if !t.keep {
+			atomic.AddUint64(&sc.dropped, uint64(len(t.spans)))
+			continue
+		}
+		for _, s := range t.spans {
+			atomic.AddUint64(&sc.kept, 1)
+			if err := sc.c.Collect(s.span, s.anns...); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// Flush decides the traces held back for longer than MaxPendingTime,
+// passing the collections of the ones that are kept to the underlying
+// collector. It is called periodically once Start is called.
+func (sc *RuleSamplerCollector) Flush() error {
+	return sc.flush(false)
+}
+
+// flush decides the traces held back for too long, or all of them if all
+// is true.
+func (sc *RuleSamplerCollector) flush(all bool) error {
+	now := sc.now()
+	sc.mu.Lock()
+	sc.initNoLock()
+	decided := sc.decidePendingNoLock(now, all)
+	sc.mu.Unlock()
+	return sc.collect(decided)
+}
+
+// Start decides the traces held back for too long every interval in the
+// background (see Flush), so that they are passed on even if no more
+// spans are collected, until Close is called.
+func (sc *RuleSamplerCollector) Start(interval time.Duration) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.stopChan != nil {
+		return
+	}
+	stop := make(chan struct{})
+	sc.stopChan = stop
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if err := sc.Flush(); err != nil && sc.Log != nil {
+					sc.Log.Printf("RuleSamplerCollector: %s", err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops deciding the traces in the background, and decides all of
+// the traces that are still held back, passing the collections of the
+// ones that are kept to the underlying collector.
+func (sc *RuleSamplerCollector) Close() error {
+	sc.mu.Lock()
+	if sc.stopChan != nil {
+		close(sc.stopChan)
+		sc.stopChan = nil
+	}
+	sc.mu.Unlock()
+	return sc.flush(true)
+}
+
+// decideNoLock decides whether to keep the trace of the given collections
+// by applying the rules to one of them, and remembers the decision. The
+// sc.mu lock must be held.
+func (sc *RuleSamplerCollector) decideNoLock(by queuedSpan, spans []queuedSpan) sampledTrace {
+	rate := sc.defaultRate
+	for i := range sc.rules {
+		if sc.rules[i].matches(by.span, by.anns, sc.names[i]) {
+			rate = sc.rules[i].Rate
+			break
+		}
+	}
+	keep := sampleTrace(by.span.Trace, rate)
+	sc.decisions.add(by.span.Trace, keep)
+	return sampledTrace{keep, spans}
+}
+
+// removePendingNoLock stops holding back a trace. The sc.mu lock must be
+// held.
+func (sc *RuleSamplerCollector) removePendingNoLock(e *list.Element) *pendingTrace {
+	t := sc.pending.Remove(e).(*pendingTrace)
+	delete(sc.pendingBy, t.trace)
+	sc.numPending -= len(t.spans)
+	return t
+}
+
+// Kept returns the number of collections passed to the underlying
+// collector.
+func (sc *RuleSamplerCollector) Kept() uint64 {
+	return atomic.LoadUint64(&sc.kept)
+}
+
+// Dropped returns the number of collections dropped because their trace
+// wasn't sampled.
+func (sc *RuleSamplerCollector) Dropped() uint64 {
+	return atomic.LoadUint64(&sc.dropped)
+}
+
+// An idLRU maps IDs to booleans, and holds at most a fixed number of them,
+// evicting the least recently used one when it is full. It is not safe for
+// concurrent use.
+type idLRU struct {
+	max   int
+	ll    *list.List // *idLRUEntry, most recently used first
+	elems map[ID]*list.Element
+}
+
+type idLRUEntry struct {
+	id    ID
+	value bool
+}
+
+func newIDLRU(max int) *idLRU {
+	return &idLRU{max: max, ll: list.New(), elems: map[ID]*list.Element{}}
+}
+
+// get returns the value of id, and whether it is present.
+func (c *idLRU) get(id ID) (value, ok bool) {
+	e, ok := c.elems[id]
+	if !ok {
+		return false, false
+	}
+	c.ll.MoveToFront(e)
+	return e.Value.(*idLRUEntry).value, true
+}
+
+// add sets the value of id, evicting the least recently used ID if the
+// cache is full.
+func (c *idLRU) add(id ID, value bool) {
+	if e, ok := c.elems[id]; ok {
+		e.Value.(*idLRUEntry).value = value
+		c.ll.MoveToFront(e)
+		return
+	}
+	c.elems[id] = c.ll.PushFront(&idLRUEntry{id: id, value: value})
+	if c.ll.Len() > c.max {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.elems, oldest.Value.(*idLRUEntry).id)
+	}
+}
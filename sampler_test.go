@@ -0,0 +1,297 @@
+package appdash
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestSamplerCollector(t *testing.T) {
+	for _, rate := range []float64{0, 0.01, 0.1, 0.5, 1} {
+		var collected int
+		sc := NewSamplerCollector(collectorFunc(func(span SpanID, anns ...Annotation) error {
+			collected++
+			return nil
+		}), rate)
+
+		const n = 10000
+		for i := 0; i < n; i++ {
+			// Sequential trace IDs are sampled as uniformly as random ones.
+			if err := sc.Collect(SpanID{Trace: ID(i), Span: ID(i)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		want := int(rate * n)
+		if rate == 0 || rate == 1 {
+			if collected != want {
+				t.Errorf("rate %v: got %d spans collected, want %d", rate, collected, want)
+			}
+		} else if tolerance := n / 50; collected < want-tolerance || collected > want+tolerance {
+			t.Errorf("rate %v: got %d spans collected, want %d±%d", rate, collected, want, tolerance)
+		}
+		if sc.Kept() != uint64(collected) || sc.Dropped() != uint64(n-collected) {
+			t.Errorf("rate %v: got %d kept and %d dropped, want %d and %d", rate, sc.Kept(), sc.Dropped(), collected, n-collected)
+		}
+	}
+}
+
+func TestSamplerCollector_wholeTraces(t *testing.T) {
+	kept := map[ID]int{}
+	newSampler := func() *SamplerCollector {
+		return NewSamplerCollector(collectorFunc(func(span SpanID, anns ...Annotation) error {
+			kept[span.Trace]++
+			return nil
+		}), 0.3)
+	}
+	// Two processes, sampling the same traces independently.
+	a, b := newSampler(), newSampler()
+
+	var traces []ID
+	for i := 0; i < 1000; i++ {
+		root := NewRootSpanID()
+		traces = append(traces, root.Trace)
+		a.Collect(root)
+		a.Collect(NewSpanID(root))
+		b.Collect(NewSpanID(root))
+	}
+	for _, trace := range traces {
+		if n := kept[trace]; n != 0 && n != 3 {
+			t.Errorf("trace %v: got %d of 3 spans kept", trace, n)
+		}
+	}
+
+	// A trace kept at some rate is also kept at higher rates.
+	for _, trace := range traces {
+		if kept[trace] != 0 && !sampleTrace(trace, 0.5) {
+			t.Errorf("trace %v: kept at rate 0.3 but not at 0.5", trace)
+		}
+	}
+}
+
+func TestRateSamplerCollector(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	var kept []SpanID
+	sc := NewRateSamplerCollector(collectorFunc(func(span SpanID, anns ...Annotation) error {
+		kept = append(kept, span)
+		return nil
+	}), 2)
+	sc.now = clock.now
+
+	// Only the first 2 new traces are admitted.
+	for i := ID(1); i <= 5; i++ {
+		sc.Collect(SpanID{Trace: i, Span: i, Parent: 0})
+	}
+	// Even once the bucket is refilled, the later spans of the admitted
+	// traces are kept, and the ones of the dropped traces are dropped.
+	clock.advance(time.Second)
+	for i := ID(1); i <= 5; i++ {
+		sc.Collect(SpanID{Trace: i, Span: 10 + i, Parent: i})
+	}
+	sc.Collect(SpanID{Trace: 6, Span: 6, Parent: 0})
+
+	want := []SpanID{{Trace: 1, Span: 1, Parent: 0}, {Trace: 2, Span: 2, Parent: 0}, {Trace: 1, Span: 11, Parent: 1}, {Trace: 2, Span: 12, Parent: 2}, {Trace: 6, Span: 6, Parent: 0}}
+	if !reflect.DeepEqual(kept, want) {
+		t.Errorf("got kept spans %v, want %v", kept, want)
+	}
+	if sc.Kept() != 5 || sc.Dropped() != 6 {
+		t.Errorf("got %d kept and %d dropped, want 5 and 6", sc.Kept(), sc.Dropped())
+	}
+
+	// The decisions are known for the traces that were seen.
+	for _, test := range []struct {
+		trace    ID
+		keep, ok bool
+	}{{1, true, true}, {3, false, true}, {7, false, false}} {
+		if keep, ok := sc.Sampled(SpanID{Trace: test.trace, Span: 100}); keep != test.keep || ok != test.ok {
+			t.Errorf("trace %v: got Sampled %v, %v, want %v, %v", test.trace, keep, ok, test.keep, test.ok)
+		}
+	}
+}
+
+func TestIDLRU(t *testing.T) {
+	c := newIDLRU(2)
+	c.add(1, true)
+	c.add(2, false)
+	c.get(1) // 2 is now the least recently used
+	c.add(3, true)
+	if _, ok := c.get(2); ok {
+		t.Error("got 2 present, want evicted")
+	}
+	for _, id := range []ID{1, 3} {
+		if v, ok := c.get(id); !ok || !v {
+			t.Errorf("got %v = %v, %v, want true, true", id, v, ok)
+		}
+	}
+}
+
+func TestRuleSamplerCollector(t *testing.T) {
+	errorRule := SamplingRule{Annotation: "Error", Rate: 1}
+	healthRule := SamplingRule{Name: "GET /health*", Rate: 0}
+	tests := []struct {
+		rules []SamplingRule
+		name  string
+		err   bool
+		keep  bool
+	}{
+		{rules: []SamplingRule{errorRule, healthRule}, name: "GET /healthz", keep: false},
+		{rules: []SamplingRule{errorRule, healthRule}, name: "GET /healthz", err: true, keep: true},
+		{rules: []SamplingRule{errorRule, healthRule}, name: "GET /users", keep: true},
+		// The first matching rule wins.
+		{rules: []SamplingRule{healthRule, errorRule}, name: "GET /healthz", err: true, keep: false},
+		{rules: []SamplingRule{{NameRegexp: regexp.MustCompile("^GET "), Rate: 0}}, name: "GET /users", keep: false},
+		{rules: []SamplingRule{{NameRegexp: regexp.MustCompile("^GET "), Rate: 0}}, name: "POST /users", keep: true},
+	}
+	for _, test := range tests {
+		var kept []SpanID
+		sc := NewRuleSamplerCollector(collectorFunc(func(span SpanID, anns ...Annotation) error {
+			kept = append(kept, span)
+			return nil
+		}), test.rules, 1)
+
+		// The children are collected before the root span, like with
+		// Recorders.
+		root := NewRootSpanID()
+		child, grandchild := NewSpanID(root), NewSpanID(root)
+		grandchild.Parent = child.Span
+		rootAnns := Annotations{{Key: "Name", Value: []byte(test.name)}}
+		if test.err {
+			rootAnns = append(rootAnns, Annotation{Key: "Error", Value: []byte("boom")})
+		}
+		sc.Collect(grandchild, Annotation{Key: "Name", Value: []byte("db")})
+		sc.Collect(child)
+		if len(kept) != 0 {
+			t.Fatalf("%+v: got spans %v kept before the root span", test, kept)
+		}
+		sc.Collect(root, rootAnns...)
+		// Later collections follow the decision.
+		sc.Collect(child)
+
+		var want []SpanID
+		if test.keep {
+			want = []SpanID{grandchild, child, root, child}
+		}
+		if !reflect.DeepEqual(kept, want) {
+			t.Errorf("%+v: got kept spans %v, want %v", test, kept, want)
+		}
+		if got := sc.Kept() + sc.Dropped(); got != 4 {
+			t.Errorf("%+v: got %d spans kept or dropped, want 4", test, got)
+		}
+	}
+}
+
+func TestRuleSamplerCollector_MaxPendingSpans(t *testing.T) {
+	var kept []SpanID
+	sc := NewRuleSamplerCollector(collectorFunc(func(span SpanID, anns ...Annotation) error {
+		kept = append(kept, span)
+		return nil
+	}), []SamplingRule{{Name: "drop*", Rate: 0}}, 1)
+	sc.MaxPendingSpans = 2
+
+	// The root spans of these traces are never seen, so once there are too
+	// many pending spans, the trace held back the longest is decided using
+	// its first span.
+	a1, a2 := SpanID{Trace: 1, Span: 11, Parent: 1}, SpanID{Trace: 1, Span: 12, Parent: 1}
+	b1, c1 := SpanID{Trace: 2, Span: 21, Parent: 2}, SpanID{Trace: 3, Span: 31, Parent: 3}
+	sc.Collect(a1, Annotation{Key: "Name", Value: []byte("keep")})
+	sc.Collect(b1, Annotation{Key: "Name", Value: []byte("drop")})
+	sc.Collect(c1) // a is decided
+	sc.Collect(a2)
+	sc.Collect(SpanID{Trace: 4, Span: 41, Parent: 4}) // b is decided
+	if want := []SpanID{a1, a2}; !reflect.DeepEqual(kept, want) {
+		t.Errorf("got kept spans %v, want %v", kept, want)
+	}
+	if sc.Dropped() != 1 {
+		t.Errorf("got %d spans dropped, want 1", sc.Dropped())
+	}
+}
+
+func TestRuleSamplerCollector_MaxPendingTime(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	var kept []SpanID
+	sc := NewRuleSamplerCollector(collectorFunc(func(span SpanID, anns ...Annotation) error {
+		kept = append(kept, span)
+		return nil
+	}), []SamplingRule{{Name: "drop*", Rate: 0}}, 1)
+	sc.now = clock.now
+	sc.MaxPendingTime = time.Minute
+
+	// The root spans of these traces are recorded by another process, so
+	// they are decided using their first span once they have been held
+	// back for too long.
+	a1, b1 := SpanID{Trace: 1, Span: 11, Parent: 1}, SpanID{Trace: 2, Span: 21, Parent: 2}
+	sc.Collect(a1, Annotation{Key: "Name", Value: []byte("keep")})
+	clock.advance(30 * time.Second)
+	sc.Collect(b1, Annotation{Key: "Name", Value: []byte("keep")})
+	if err := sc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(kept) != 0 {
+		t.Fatalf("got spans %v kept before MaxPendingTime", kept)
+	}
+	clock.advance(30 * time.Second)
+	if err := sc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []SpanID{a1}; !reflect.DeepEqual(kept, want) {
+		t.Errorf("got kept spans %v, want %v", kept, want)
+	}
+
+	// Collect decides them too.
+	c1 := SpanID{Trace: 3, Span: 31, Parent: 3}
+	clock.advance(30 * time.Second)
+	sc.Collect(c1, Annotation{Key: "Name", Value: []byte("drop")})
+	if want := []SpanID{a1, b1}; !reflect.DeepEqual(kept, want) {
+		t.Errorf("got kept spans %v, want %v", kept, want)
+	}
+
+	// Close decides all of them.
+	if err := sc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []SpanID{a1, b1}; !reflect.DeepEqual(kept, want) || sc.Dropped() != 1 {
+		t.Errorf("got kept spans %v and %d dropped, want %v and 1", kept, sc.Dropped(), want)
+	}
+}
+
+func TestRuleSamplerCollector_headDecision(t *testing.T) {
+	var kept []SpanID
+	sc := NewRuleSamplerCollector(collectorFunc(func(span SpanID, anns ...Annotation) error {
+		kept = append(kept, span)
+		return nil
+	}), nil, 0)
+
+	// The children of the traces decided at the root aren't held back,
+	// and their decision overrides the rules.
+	sampled := SpanID{Trace: 1, Span: 11, Parent: 1, Flags: FlagSampled | FlagSamplingDecided}
+	notSampled := SpanID{Trace: 2, Span: 21, Parent: 2, Flags: FlagSamplingDecided}
+	sc.Collect(sampled)
+	sc.Collect(notSampled)
+	sc.Collect(SpanID{Trace: 1, Span: 1, Flags: FlagSampled | FlagSamplingDecided})
+	if want := []SpanID{sampled, {Trace: 1, Span: 1, Flags: FlagSampled | FlagSamplingDecided}}; !reflect.DeepEqual(kept, want) {
+		t.Errorf("got kept spans %v, want %v", kept, want)
+	}
+	if sc.Dropped() != 1 {
+		t.Errorf("got %d spans dropped, want 1", sc.Dropped())
+	}
+}
+
+func TestGlobRegexp(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		match      bool
+	}{
+		{"GET /health*", "GET /healthz", true},
+		{"GET /health*", "GET /health/db", true},
+		{"GET /health*", "POST /healthz", false},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"a.c", "abc", false},
+	}
+	for _, test := range tests {
+		if got := globRegexp(test.pattern).MatchString(test.s); got != test.match {
+			t.Errorf("%q matching %q: got %v, want %v", test.pattern, test.s, got, test.match)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package appdash
+
+import "os"
+
+// ServiceKey is the key of the annotation that holds the name of the
+// service that recorded a span (see Recorder.WithService and
+// Span.Service).
+const ServiceKey = "_service"
+
+// ServiceEnv is the name of the environment variable that DefaultService
+// is initialized from.
+const ServiceEnv = "APPDASH_SERVICE"
+
+// DefaultService is the name of the service of the recorders created by
+// NewRecorder (see Recorder.WithService). It is initially the value of the
+// APPDASH_SERVICE environment variable, so that the service of a program
+// can be set without changing its code.
+var DefaultService = os.Getenv(ServiceEnv)
+
+// WithService sets the name of the service that records the span, which is
+// recorded (as the ServiceKey annotation) when the span is finished, on it
+// and on the spans of the recorders created by r.Child afterwards. An
+// empty name records no service. It returns r, so that it can be chained:
+//
+//	rec := appdash.NewRecorder(span, collector).WithService("frontend")
+func (r *Recorder) WithService(name string) *Recorder {
+	r.mu.Lock()
+	r.service = name
+	r.mu.Unlock()
+	return r
+}
+
+// Service returns the name of the service that records the span (see
+// WithService).
+func (r *Recorder) Service() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.service
+}
+
+// Service returns the name of the service that recorded the span (see
+// Recorder.WithService), or "" if it is unknown.
+func (s *Span) Service() string {
+	return string(s.Annotations.Get(ServiceKey))
+}
@@ -0,0 +1,42 @@
+package appdash
+
+import "testing"
+
+func TestRecorder_WithService(t *testing.T) {
+	defer func(s string) { DefaultService = s }(DefaultService)
+	DefaultService = "default"
+
+	ms := NewMemoryStore()
+	root := NewRecorder(SpanID{Trace: 1, Span: 2}, ms)
+	defaultChild := root.Child()
+	root.WithService("api")
+	child := root.Child()
+	grandchild := child.Child().WithService("db")
+	unnamed := root.Child().WithService("")
+	for _, r := range []*Recorder{unnamed, grandchild, child, defaultChild, root} {
+		r.Finish()
+	}
+
+	trace, err := ms.Trace(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for r, want := range map[*Recorder]string{
+		root:         "api",
+		defaultChild: "default",
+		child:        "api",
+		grandchild:   "db",
+		unnamed:      "",
+	} {
+		span := trace.FindSpan(r.Span)
+		if span == nil {
+			t.Fatalf("span %v not collected", r.SpanID)
+		}
+		if got := span.Service(); got != want {
+			t.Errorf("%v: got service %q, want %q", r.SpanID, got, want)
+		}
+		if got := r.Service(); got != want {
+			t.Errorf("%v: got recorder service %q, want %q", r.SpanID, got, want)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package appdash
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sketchGamma is the ratio of the bounds of the consecutive buckets of a
+// LatencySketch. The quantiles it returns are within
+// (sketchGamma-1)/(sketchGamma+1), i.e. 1%, of the actual durations.
+const sketchGamma = 1.02
+
+var logSketchGamma = math.Log(sketchGamma)
+
+// A LatencySketch summarizes a distribution of durations in bounded memory,
+// to estimate its quantiles, such as the 99th percentile latency (see
+// Quantile). The durations are counted in buckets whose bounds grow
+// exponentially, so that the estimates are within 1% of the actual
+// durations, whatever their scale, and a sketch of durations from 1ns to
+// a day never holds more than about 1600 buckets.
+//
+// Sketches can be merged (see Merge), and are marshaled as text (see
+// String and UnmarshalText), so that they can be recorded in annotations.
+// The zero LatencySketch is empty and ready to use.
+type LatencySketch struct {
+	counts map[int]uint64 // number of durations, by bucket (see sketchBucket)
+	n      uint64         // total number of durations
+}
+
+// sketchBucket returns the bucket of a duration: the bucket i holds the
+// durations in (gamma^(i-1), gamma^i] nanoseconds, and the bucket 0 the
+// durations of 1ns or less.
+func sketchBucket(d time.Duration) int {
+	if d <= 1 {
+		return 0
+	}
+	return int(math.Ceil(math.Log(float64(d)) / logSketchGamma))
+}
+
+// sketchValue returns the estimate of the durations in bucket i, which is
+// within 1% of all of them.
+func sketchValue(i int) time.Duration {
+	if i == 0 {
+		return 1
+	}
+	return time.Duration(math.Round(2 * math.Pow(sketchGamma, float64(i)) / (sketchGamma + 1)))
+}
+
+// Add adds a duration to the sketch.
+func (s *LatencySketch) Add(d time.Duration) {
+	if s.counts == nil {
+		s.counts = map[int]uint64{}
+	}
+	s.counts[sketchBucket(d)]++
+	s.n++
+}
+
+// Merge adds the durations of o to the sketch.
+func (s *LatencySketch) Merge(o LatencySketch) {
+	if o.n == 0 {
+		return
+	}
+	if s.counts == nil {
+		s.counts = make(map[int]uint64, len(o.counts))
+	}
+	for i, c := range o.counts {
+		s.counts[i] += c
+	}
+	s.n += o.n
+}
+
+// Count returns the number of durations added to the sketch.
+func (s LatencySketch) Count() uint64 { return s.n }
+
+// Quantile returns the estimate of the q-quantile (0 <= q <= 1) of the
+// durations, for example Quantile(0.99) for the 99th percentile. It
+// returns 0 if the sketch is empty.
+func (s LatencySketch) Quantile(q float64) time.Duration {
+	if s.n == 0 {
+		return 0
+	}
+	switch {
+	case q < 0:
+		q = 0
+	case q > 1:
+		q = 1
+	}
+	rank := uint64(q * float64(s.n-1))
+	var seen uint64
+	for _, i := range s.buckets() {
+		seen += s.counts[i]
+		if seen > rank {
+			return sketchValue(i)
+		}
+	}
+	return 0 // unreachable
+}
+
+// buckets returns the (non-empty) buckets of the sketch, in order.
+func (s LatencySketch) buckets() []int {
+	buckets := make([]int, 0, len(s.counts))
+	for i := range s.counts {
+		buckets = append(buckets, i)
+	}
+	sort.Ints(buckets)
+	return buckets
+}
+
+// String returns the text encoding of the sketch: the comma-separated
+// counts of its buckets, as "bucket:count". UnmarshalText decodes it.
+func (s LatencySketch) String() string {
+	var b strings.Builder
+	for _, i := range s.buckets() {
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.Itoa(i))
+		b.WriteByte(':')
+		b.WriteString(strconv.FormatUint(s.counts[i], 10))
+	}
+	return b.String()
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface by
+// decoding the text encoding returned by String.
+func (s *LatencySketch) UnmarshalText(text []byte) error {
+	*s = LatencySketch{}
+	if len(text) == 0 {
+		return nil
+	}
+	s.counts = map[int]uint64{}
+	for _, f := range strings.Split(string(text), ",") {
+		kv := strings.SplitN(f, ":", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("appdash: bad latency sketch bucket %q", f)
+		}
+		i, err := strconv.Atoi(kv[0])
+		if err != nil || i < 0 {
+			return fmt.Errorf("appdash: bad latency sketch bucket %q", f)
+		}
+		c, err := strconv.ParseUint(kv[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("appdash: bad latency sketch bucket %q", f)
+		}
+		s.counts[i] += c
+		s.n += c
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package appdash
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestLatencySketch_accuracy(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	distributions := map[string]func() time.Duration{
+		"uniform": func() time.Duration { return time.Duration(1 + rng.Int63n(int64(time.Second))) },
+		"exponential": func() time.Duration {
+			return time.Duration(rng.ExpFloat64() * float64(50*time.Millisecond))
+		},
+		"lognormal": func() time.Duration {
+			return time.Duration(math.Exp(rng.NormFloat64()*2) * float64(time.Millisecond))
+		},
+	}
+	for name, next := range distributions {
+		var s LatencySketch
+		ds := make([]time.Duration, 100000)
+		for i := range ds {
+			ds[i] = next()
+			s.Add(ds[i])
+		}
+		sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+
+		if s.Count() != uint64(len(ds)) {
+			t.Errorf("%s: got count %d, want %d", name, s.Count(), len(ds))
+		}
+		for _, q := range []float64{0, 0.5, 0.95, 0.99, 0.999, 1} {
+			want := ds[int(q*float64(len(ds)-1))]
+			got := s.Quantile(q)
+			if err := math.Abs(float64(got-want)) / float64(want); err > 0.01 {
+				t.Errorf("%s: got quantile %v = %s, want %s (error %.2f%%)", name, q, got, want, err*100)
+			}
+		}
+	}
+}
+
+func TestLatencySketch_text(t *testing.T) {
+	var s, empty LatencySketch
+	if q := empty.Quantile(0.5); q != 0 {
+		t.Errorf("got empty quantile %s, want 0", q)
+	}
+	for _, d := range []time.Duration{0, time.Microsecond, time.Millisecond, time.Millisecond, time.Hour} {
+		s.Add(d)
+	}
+
+	var got LatencySketch
+	if err := got.UnmarshalText([]byte(s.String())); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != s.String() || got.Count() != s.Count() {
+		t.Errorf("got sketch %q (%d durations), want %q (%d)", got, got.Count(), s, s.Count())
+	}
+	if err := got.UnmarshalText([]byte("1:2,x")); err == nil {
+		t.Error("got no error for a bad sketch")
+	}
+
+	// Merging keeps the quantiles.
+	var merged LatencySketch
+	merged.Merge(s)
+	merged.Merge(empty)
+	merged.Merge(s)
+	if merged.Count() != 2*s.Count() || merged.Quantile(0.5) != s.Quantile(0.5) {
+		t.Errorf("got merged sketch %q, want the durations of %q twice", merged, s)
+	}
+}
@@ -5,12 +5,20 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 
+	"github.com/gogo/protobuf/proto"
 	"sourcegraph.com/sourcegraph/appdash/internal/wire"
 )
 
 // A SpanID refers to a single span.
+//
+// The TraceHigh and Flags fields come after the Trace, Span and Parent
+// fields, and are zero for 64-bit trace IDs without a sampling decision.
+// Since unkeyed struct literals must list every field, SpanID literals
+// should be keyed, as in SpanID{Trace: 1, Span: 2, Parent: 3}.
 type SpanID struct {
 	// Trace is the root ID of the tree that contains all of the spans
 	// related to this one.
@@ -22,6 +30,38 @@ type SpanID struct {
 
 	// Parent is the ID of the parent span, if any.
 	Parent ID
+
+	// TraceHigh holds the high 64 bits of 128-bit trace IDs (see
+	// Use128BitTraceIDs), and is zero for 64-bit trace IDs.
+	TraceHigh ID `json:",omitempty"`
+
+	// Flags are the flags of the trace, such as whether it is sampled
+	// (see Sampled). They are set when the root span ID is created, and
+	// propagate to all of the span IDs of the trace.
+	Flags SpanFlags `json:",omitempty"`
+}
+
+// SpanFlags is a bitset of the flags of a trace.
+type SpanFlags uint8
+
+const (
+	// FlagSampled is set if the trace is sampled, in which case its spans
+	// are recorded (see Recorder.ForceRecord). It is only meaningful
+	// together with FlagSamplingDecided.
+	FlagSampled SpanFlags = 1 << 0
+
+	// FlagSamplingDecided is set if the sampling decision for the trace was
+	// made when its root span ID was created (see DefaultHeadSampler), and
+	// is held by FlagSampled. The traces of span IDs without it (such as
+	// those parsed from strings without flags) are sampled.
+	FlagSamplingDecided SpanFlags = 1 << 1
+)
+
+// Sampled reports whether the trace is sampled: if its sampling decision
+// was made (see FlagSamplingDecided) and FlagSampled is set, or if none
+// was made.
+func (id SpanID) Sampled() bool {
+	return id.Flags&FlagSamplingDecided == 0 || id.Flags&FlagSampled != 0
 }
 
 var (
@@ -29,16 +69,45 @@ var (
 	ErrBadSpanID = errors.New("bad span ID")
 )
 
+// Use128BitTraceIDs is whether NewRootSpanID generates 128-bit trace IDs
+// (with a nonzero TraceHigh), as other tracing systems such as Jaeger and
+// OpenTelemetry do. It should be set before any spans are created (e.g.,
+// at the start of main). The 64-bit trace IDs of existing spans keep
+// working regardless.
+//
+// The stores identify traces by their low 64 bits (SpanID.Trace) only, like
+// the IDs that their methods take: the spans of 128-bit trace IDs that
+// differ only in their high bits are stored as a single trace. The low bits
+// of the trace IDs generated by NewRootSpanID are random, so this is as
+// unlikely as for 64-bit trace IDs, but it isn't for trace IDs from other
+// systems whose low bits aren't random.
+var Use128BitTraceIDs bool
+
 // String returns the SpanID as a slash-separated, set of hex-encoded
-// parameters (root, ID, parent). If the SpanID has no parent, that value is
-// elided.
+// parameters (root, ID, parent, flags). If the SpanID has no parent and no
+// flags, the parent is elided, and if it has no flags, they are elided.
+// The root is 32 hex digits long if the trace ID is 128 bits wide (i.e.
+// TraceHigh is nonzero), and 16 otherwise. The flags are 2 hex digits
+// long.
 func (id SpanID) String() string {
+	if id.Flags != 0 {
+		return fmt.Sprintf(
+			"%s%s%s%s%s%s%02x",
+			id.traceString(),
+			SpanIDDelimiter,
+			id.Span,
+			SpanIDDelimiter,
+			id.Parent,
+			SpanIDDelimiter,
+			uint8(id.Flags),
+		)
+	}
 	if id.Parent == 0 {
-		return fmt.Sprintf("%s%s%s", id.Trace, SpanIDDelimiter, id.Span)
+		return fmt.Sprintf("%s%s%s", id.traceString(), SpanIDDelimiter, id.Span)
 	}
 	return fmt.Sprintf(
 		"%s%s%s%s%s",
-		id.Trace,
+		id.traceString(),
 		SpanIDDelimiter,
 		id.Span,
 		SpanIDDelimiter,
@@ -54,6 +123,14 @@ func (id SpanID) Format(s string, args ...interface{}) string {
 	return fmt.Sprintf(s, args...)
 }
 
+// traceString returns the hex-encoded (64 or 128-bit) trace ID.
+func (id SpanID) traceString() string {
+	if id.TraceHigh == 0 {
+		return id.Trace.String()
+	}
+	return id.TraceHigh.String() + id.Trace.String()
+}
+
 // IsRoot returns whether id is the root ID of a trace.
 func (id SpanID) IsRoot() bool {
 	return id.Parent == 0
@@ -61,19 +138,31 @@ func (id SpanID) IsRoot() bool {
 
 // wire returns the span ID as it's protobuf definition.
 func (id SpanID) wire() *wire.CollectPacket_SpanID {
-	return &wire.CollectPacket_SpanID{
+	w := &wire.CollectPacket_SpanID{
 		Trace:  (*uint64)(&id.Trace),
 		Span:   (*uint64)(&id.Span),
 		Parent: (*uint64)(&id.Parent),
 	}
+	if id.TraceHigh != 0 {
+		// Omitted otherwise, so that the packets of 64-bit trace IDs are
+		// the same as in versions of the protocol before 1.3.
+		w.TraceHigh = (*uint64)(&id.TraceHigh)
+	}
+	if id.Flags != 0 {
+		// Likewise (before 1.4).
+		w.Flags = proto.Uint32(uint32(id.Flags))
+	}
+	return w
 }
 
 // spanIDFromWire returns a SpanID from it's protobuf definition.
 func spanIDFromWire(w *wire.CollectPacket_SpanID) SpanID {
 	return SpanID{
-		Trace:  ID(*w.Trace),
-		Span:   ID(*w.Span),
-		Parent: ID(*w.Parent),
+		Trace:     ID(w.GetTrace()),
+		TraceHigh: ID(w.GetTraceHigh()), // optional (since protocol version 1.3)
+		Span:      ID(w.GetSpan()),
+		Parent:    ID(w.GetParent()),       // optional
+		Flags:     SpanFlags(w.GetFlags()), // optional (since protocol version 1.4)
 	}
 }
 
@@ -81,11 +170,24 @@ func spanIDFromWire(w *wire.CollectPacket_SpanID) SpanID {
 // only be used to generate entries for spans caused exclusively by
 // spans which are outside of your system as a whole (e.g., a root
 // span for the first time you see a user request).
+//
+// The trace ID is 128 bits wide if Use128BitTraceIDs is set, and
+// DefaultHeadSampler (if set) decides whether the trace is sampled.
 func NewRootSpanID() SpanID {
-	return SpanID{
+	id := SpanID{
 		Trace: generateID(),
 		Span:  generateID(),
 	}
+	if Use128BitTraceIDs {
+		id.TraceHigh = generateID()
+	}
+	if sample := DefaultHeadSampler; sample != nil {
+		id.Flags |= FlagSamplingDecided
+		if sample(id) {
+			id.Flags |= FlagSampled
+		}
+	}
+	return id
 }
 
 // NewSpanID returns a new ID for an span which is the child of the
@@ -93,9 +195,11 @@ func NewRootSpanID() SpanID {
 // between spans.
 func NewSpanID(parent SpanID) SpanID {
 	return SpanID{
-		Trace:  parent.Trace,
-		Span:   generateID(),
-		Parent: parent.Span,
+		Trace:     parent.Trace,
+		TraceHigh: parent.TraceHigh,
+		Span:      generateID(),
+		Parent:    parent.Span,
+		Flags:     parent.Flags,
 	}
 }
 
@@ -106,11 +210,23 @@ const (
 )
 
 // ParseSpanID parses the given string as a slash-separated set of parameters.
+// The root may be a 64-bit (up to 16 hex digits) or a 128-bit (32 hex
+// digits) trace ID. The parent and flags are optional (see
+// SpanID.String), so strings in the format of older versions, which had
+// no flags, parse as span IDs of sampled traces.
 func ParseSpanID(s string) (*SpanID, error) {
 	parts := strings.Split(s, SpanIDDelimiter)
-	if len(parts) != 2 && len(parts) != 3 {
+	if len(parts) < 2 || len(parts) > 4 {
 		return nil, ErrBadSpanID
 	}
+	var rootHigh ID
+	if len(parts[0]) == 32 {
+		i, err := ParseID(parts[0][:16])
+		if err != nil {
+			return nil, ErrBadSpanID
+		}
+		rootHigh, parts[0] = i, parts[0][16:]
+	}
 	root, err := ParseID(parts[0])
 	if err != nil {
 		return nil, ErrBadSpanID
@@ -120,20 +236,122 @@ func ParseSpanID(s string) (*SpanID, error) {
 		return nil, ErrBadSpanID
 	}
 	var parent ID
-	if len(parts) == 3 {
+	if len(parts) >= 3 {
 		i, err := ParseID(parts[2])
 		if err != nil {
 			return nil, ErrBadSpanID
 		}
 		parent = i
 	}
+	var flags SpanFlags
+	if len(parts) == 4 {
+		f, err := strconv.ParseUint(parts[3], 16, 8)
+		if err != nil {
+			return nil, ErrBadSpanID
+		}
+		flags = SpanFlags(f)
+	}
 	return &SpanID{
-		Trace:  root,
-		Span:   id,
-		Parent: parent,
+		Trace:     root,
+		TraceHigh: rootHigh,
+		Span:      id,
+		Parent:    parent,
+		Flags:     flags,
 	}, nil
 }
 
+// ErrBadTraceparent is returned (wrapped, with the reason) when a W3C
+// Trace Context traceparent value cannot be parsed.
+var ErrBadTraceparent = errors.New("bad traceparent")
+
+// FormatTraceparent returns id as a W3C Trace Context traceparent value
+// (https://www.w3.org/TR/trace-context/), with version 00, for propagating
+// the span to systems such as OpenTelemetry. The sampled flag is set if
+// the trace is sampled (see SpanID.Sampled).
+//
+// A 64-bit trace ID is zero-padded to the 128-bit trace-id field, and
+// the span ID is the parent-id field (the span is the parent of the
+// spans of the systems the value is sent to).
+func FormatTraceparent(id SpanID) string {
+	flags := "00"
+	if id.Sampled() {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s%s-%s-%s", id.TraceHigh, id.Trace, id.Span, flags)
+}
+
+// ParseTraceparent parses a W3C Trace Context traceparent value into the
+// span ID of the span it refers to (whose children are created with
+// NewSpanID). The span ID's Trace and TraceHigh are the low and high 64
+// bits of the trace-id field, its Span is the parent-id field, and it has
+// no Parent. Its Flags hold the sampling decision of the sampled flag
+// (see FlagSamplingDecided); the other trace flags are ignored.
+//
+// Values with versions later than 00 are parsed as version 00 values
+// (ignoring any fields that follow the flags), as the specification
+// requires.
+func ParseTraceparent(s string) (SpanID, error) {
+	bad := func(format string, args ...interface{}) (SpanID, error) {
+		return SpanID{}, fmt.Errorf("%w: %s", ErrBadTraceparent, fmt.Sprintf(format, args...))
+	}
+
+	const size = 55 // 2 + 1 + 32 + 1 + 16 + 1 + 2
+	if len(s) < size {
+		return bad("too short (%d bytes)", len(s))
+	}
+	if s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return bad("malformed %q", s)
+	}
+	version, traceID, parentID, flags := s[:2], s[3:35], s[36:52], s[53:55]
+	for _, f := range []string{version, traceID, parentID, flags} {
+		if !isLowerHex(f) {
+			return bad("field %q is not lowercase hex", f)
+		}
+	}
+	switch {
+	case version == "ff":
+		return bad("invalid version ff")
+	case version == "00" && len(s) != size:
+		return bad("version 00 value of %d bytes, want %d", len(s), size)
+	case len(s) > size && s[size] != '-':
+		return bad("malformed %q", s)
+	}
+
+	if strings.Trim(traceID, "0") == "" {
+		return bad("zero trace-id")
+	}
+	if strings.Trim(parentID, "0") == "" {
+		return bad("zero parent-id")
+	}
+	traceHigh, err := ParseID(traceID[:16])
+	if err != nil {
+		return bad("trace-id: %s", err)
+	}
+	trace, err := ParseID(traceID[16:])
+	if err != nil {
+		return bad("trace-id: %s", err)
+	}
+	span, err := ParseID(parentID)
+	if err != nil {
+		return bad("parent-id: %s", err)
+	}
+	id := SpanID{Trace: trace, TraceHigh: traceHigh, Span: span, Flags: FlagSamplingDecided}
+	if f, _ := strconv.ParseUint(flags, 16, 8); f&0x01 != 0 {
+		id.Flags |= FlagSampled
+	}
+	return id, nil
+}
+
+// isLowerHex reports whether s consists of lowercase hex digits.
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
 // Span is a span ID and its annotations.
 type Span struct {
 	// ID probabilistically uniquely identifies this span.
@@ -154,12 +372,7 @@ func (s *Span) String() string {
 // Name returns a span's name if it has a name annotation, and ""
 // otherwise.
 func (s *Span) Name() string {
-	for _, ann := range s.Annotations {
-		if ann.Key == "Name" {
-			return string(ann.Value)
-		}
-	}
-	return ""
+	return string(s.Annotations.Get("Name"))
 }
 
 // Annotations is a list of annotations (on a span).
@@ -179,18 +392,7 @@ type Annotation struct {
 // Important determines if this annotation's key is considered important to any
 // of the registered event types.
 func (a Annotation) Important() bool {
-	for _, ev := range registeredEvents {
-		i, ok := ev.(ImportantEvent)
-		if !ok {
-			continue
-		}
-		for _, k := range i.Important() {
-			if a.Key == k {
-				return true
-			}
-		}
-	}
-	return false
+	return DefaultEventRegistry.isImportant(a.Key)
 }
 
 // String returns a formatted list of annotations.
@@ -202,40 +404,111 @@ func (as Annotations) String() string {
 	return buf.String()
 }
 
-// schemas returns a list of schema types in the annotations.
+// schemas returns a list of schema types in the annotations (once each,
+// even though the schema annotation of a repeated event is recorded with
+// each of the events).
 func (as Annotations) schemas() []string {
 	var schemas []string
+	seen := map[string]bool{}
 	for _, a := range as {
 		if strings.HasPrefix(a.Key, SchemaPrefix) {
-			schemas = append(schemas, a.Key[len(SchemaPrefix):])
+			schema := UnescapeKey(a.Key[len(SchemaPrefix):])
+			if !seen[schema] {
+				seen[schema] = true
+				schemas = append(schemas, schema)
+			}
 		}
 	}
 	return schemas
 }
 
-// get gets the value of the first annotation with the given key, or
+// Get gets the value of the first annotation with the given key, or
 // nil if none exists. There may be multiple annotations with the key;
-// only the first's value is returned.
-func (as Annotations) get(key string) []byte {
+// only the first's value is returned. The key may be given as recorded
+// or unescaped (see EscapeKey).
+func (as Annotations) Get(key string) []byte {
 	for _, a := range as {
-		if a.Key == key {
+		if keyIs(a.Key, key) {
 			return a.Value
 		}
 	}
 	return nil
 }
 
-// StringMap returns the annotations as a key-value map. Only one
-// annotation for a key appears in the map, and it is chosen
-// arbitrarily among the annotations with the same key.
-func (as Annotations) StringMap() map[string]string {
+// Has reports whether there is an annotation with the given key (even if
+// its value is empty). Like Get, it accepts the key escaped or not.
+func (as Annotations) Has(key string) bool {
+	for _, a := range as {
+		if keyIs(a.Key, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// A DuplicatePolicy determines the value that Annotations.Map gives a key
+// that several of the annotations have (as when a span is collected
+// several times, or records an event twice).
+type DuplicatePolicy int
+
+const (
+	// FirstWins keeps the value of the first annotation with the key.
+	FirstWins DuplicatePolicy = iota
+
+	// LastWins keeps the value of the last annotation with the key.
+	LastWins
+
+	// JoinValues joins the values of all the annotations with the key, in
+	// order, separated by JoinSeparator.
+	JoinValues
+)
+
+// JoinSeparator separates the values of an annotation key that the
+// JoinValues policy joins.
+const JoinSeparator = ","
+
+// Map returns the annotations as a key-value map, by their unescaped keys
+// (see UnescapeKey), with the value of each key that several annotations
+// have chosen by the policy.
+func (as Annotations) Map(policy DuplicatePolicy) map[string]string {
 	m := make(map[string]string, len(as))
 	for _, a := range as {
-		m[a.Key] = string(a.Value)
+		key := UnescapeKey(a.Key)
+		v, dup := m[key]
+		switch {
+		case !dup:
+			m[key] = string(a.Value)
+		case policy == LastWins:
+			m[key] = string(a.Value)
+		case policy == JoinValues:
+			m[key] = v + JoinSeparator + string(a.Value)
+		}
 	}
 	return m
 }
 
+// StringMap returns the annotations as a key-value map. Only one
+// annotation for a key appears in the map, the last one (see Map and
+// LastWins).
+func (as Annotations) StringMap() map[string]string {
+	return as.Map(LastWins)
+}
+
+// AnnotationsFromMap returns the annotations of the key-value map, sorted
+// by key, so that the same map always gives the same annotations.
+func AnnotationsFromMap(m map[string][]byte) Annotations {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	as := make(Annotations, len(keys))
+	for i, k := range keys {
+		as[i] = Annotation{Key: k, Value: m[k]}
+	}
+	return as
+}
+
 // wire returns the set of annotations as their protobuf definitions.
 func (as Annotations) wire() (w []*wire.CollectPacket_Annotation) {
 	for _, a := range as {
@@ -2,7 +2,11 @@ package appdash
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -155,6 +159,169 @@ func TestParseSpanIDBadParent(t *testing.T) {
 	}
 }
 
+func TestSpanID128(t *testing.T) {
+	id := SpanID{Trace: 100, TraceHigh: 7, Span: 300, Parent: 150}
+	s := id.String()
+	if want := "00000000000000070000000000000064/000000000000012c/0000000000000096"; s != want {
+		t.Errorf("got %q, want %q", s, want)
+	}
+	parsed, err := ParseSpanID(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *parsed != id {
+		t.Errorf("got %+v, want %+v", *parsed, id)
+	}
+
+	if got := spanIDFromWire(id.wire()); got != id {
+		t.Errorf("got %+v from the wire, want %+v", got, id)
+	}
+	if w := (SpanID{Trace: 1, Span: 2}).wire(); w.TraceHigh != nil {
+		t.Errorf("got trace_high %d on the wire for a 64-bit trace ID, want it omitted", *w.TraceHigh)
+	}
+
+	b, err := json.Marshal(SpanID{Trace: 1, Span: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"Trace":"0000000000000001","Span":"0000000000000002","Parent":"0000000000000000"}`; string(b) != want {
+		t.Errorf("got JSON %s, want %s", b, want)
+	}
+}
+
+func TestNewRootSpanID128(t *testing.T) {
+	defer func(v bool) { Use128BitTraceIDs = v }(Use128BitTraceIDs)
+	Use128BitTraceIDs = true
+
+	root := NewRootSpanID()
+	if root.TraceHigh == 0 {
+		t.Errorf("got 64-bit trace ID %v, want 128 bits", root)
+	}
+	if child := NewSpanID(root); child.TraceHigh != root.TraceHigh {
+		t.Errorf("got child trace ID high bits %v, want %v", child.TraceHigh, root.TraceHigh)
+	}
+	if got := len(strings.Split(root.String(), SpanIDDelimiter)[0]); got != 32 {
+		t.Errorf("got trace ID of %d hex digits, want 32", got)
+	}
+}
+
+func TestSpanIDFlags(t *testing.T) {
+	tests := []struct {
+		id      SpanID
+		str     string
+		sampled bool
+	}{
+		{SpanID{Trace: 100, Span: 300, Parent: 150}, "0000000000000064/000000000000012c/0000000000000096", true},
+		{SpanID{Trace: 100, Span: 300, Parent: 150, Flags: FlagSamplingDecided | FlagSampled}, "0000000000000064/000000000000012c/0000000000000096/03", true},
+		{SpanID{Trace: 100, Span: 300, Flags: FlagSamplingDecided}, "0000000000000064/000000000000012c/0000000000000000/02", false},
+	}
+	for _, test := range tests {
+		if s := test.id.String(); s != test.str {
+			t.Errorf("%+v: got %q, want %q", test.id, s, test.str)
+		}
+		parsed, err := ParseSpanID(test.str)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *parsed != test.id {
+			t.Errorf("%q: got %+v, want %+v", test.str, *parsed, test.id)
+		}
+		if got := spanIDFromWire(test.id.wire()); got != test.id {
+			t.Errorf("%+v: got %+v from the wire", test.id, got)
+		}
+		if got := test.id.Sampled(); got != test.sampled {
+			t.Errorf("%+v: got sampled %v, want %v", test.id, got, test.sampled)
+		}
+	}
+
+	if _, err := ParseSpanID("0000000000000064/000000000000012c/0000000000000096/zz"); err != ErrBadSpanID {
+		t.Errorf("got error %v for bad flags, want %v", err, ErrBadSpanID)
+	}
+}
+
+func TestNewRootSpanID_headSampler(t *testing.T) {
+	defer func(s HeadSampler) { DefaultHeadSampler = s }(DefaultHeadSampler)
+
+	for _, rate := range []float64{0, 1} {
+		DefaultHeadSampler = RateHeadSampler(rate)
+		root := NewRootSpanID()
+		if got, want := root.Sampled(), rate == 1; got != want {
+			t.Errorf("rate %v: got sampled %v, want %v", rate, got, want)
+		}
+		if child := NewSpanID(NewSpanID(root)); child.Flags != root.Flags {
+			t.Errorf("rate %v: got grandchild flags %v, want %v", rate, child.Flags, root.Flags)
+		}
+	}
+
+	DefaultHeadSampler = nil
+	if root := NewRootSpanID(); root.Flags != 0 {
+		t.Errorf("got flags %v without a head sampler, want none", root.Flags)
+	}
+}
+
+func TestFormatTraceparent(t *testing.T) {
+	id := SpanID{Trace: 0xa3ce929d0e0e4736, Span: 0x00f067aa0ba902b7, Parent: 1}
+	got := FormatTraceparent(id)
+	if want := "00-0000000000000000a3ce929d0e0e4736-00f067aa0ba902b7-01"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	parsed, err := ParseTraceparent(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (SpanID{Trace: id.Trace, Span: id.Span, Flags: FlagSamplingDecided | FlagSampled}); parsed != want {
+		t.Errorf("got round-tripped span ID %+v, want %+v", parsed, want)
+	}
+
+	id.Flags = FlagSamplingDecided // not sampled
+	if got, want := FormatTraceparent(id), "00-0000000000000000a3ce929d0e0e4736-00f067aa0ba902b7-00"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	// The valid values are from the W3C Trace Context specification.
+	want := SpanID{Trace: 0xa3ce929d0e0e4736, TraceHigh: 0x4bf92f3577b34da6, Span: 0x00f067aa0ba902b7}
+	for s, sampled := range map[string]bool{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01":                              true,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00":                              false,
+		"cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-what-the-future-will-be-like": true,
+	} {
+		got, err := ParseTraceparent(s)
+		if err != nil {
+			t.Errorf("%q: %s", s, err)
+			continue
+		}
+		want.Flags = FlagSamplingDecided
+		if sampled {
+			want.Flags |= FlagSampled
+		}
+		if got != want {
+			t.Errorf("%q: got %+v, want %+v", s, got, want)
+		}
+	}
+}
+
+func TestParseTraceparentMalformed(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00_4bf92f3577b34da6a3ce929d0e0e4736_00f067aa0ba902b7_01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473g-00f067aa0ba902b7-01",
+		"cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01.what",
+	} {
+		if id, err := ParseTraceparent(s); !errors.Is(err, ErrBadTraceparent) {
+			t.Errorf("%q: got %+v, %v, want ErrBadTraceparent", s, id, err)
+		}
+	}
+}
+
 func TestSpan_Name(t *testing.T) {
 	namedSpan := &Span{Annotations: Annotations{{Key: "Name", Value: []byte("foo")}}}
 	if want := "foo"; namedSpan.Name() != want {
@@ -167,6 +334,55 @@ func TestSpan_Name(t *testing.T) {
 	}
 }
 
+func TestAnnotations_Map(t *testing.T) {
+	as := Annotations{
+		{Key: "a", Value: []byte("1")},
+		{Key: "b", Value: []byte("x")},
+		{Key: "a", Value: []byte("2")},
+		{Key: "a", Value: []byte("3")},
+	}
+	for policy, want := range map[DuplicatePolicy]map[string]string{
+		FirstWins:  {"a": "1", "b": "x"},
+		LastWins:   {"a": "3", "b": "x"},
+		JoinValues: {"a": "1,2,3", "b": "x"},
+	} {
+		if got := as.Map(policy); !reflect.DeepEqual(got, want) {
+			t.Errorf("policy %d: got %v, want %v", policy, got, want)
+		}
+	}
+	if got, want := as.StringMap(), as.Map(LastWins); !reflect.DeepEqual(got, want) {
+		t.Errorf("got StringMap %v, want %v", got, want)
+	}
+
+	if got := string(as.Get("a")); got != "1" {
+		t.Errorf("got Get %q, want the first value %q", got, "1")
+	}
+	if got := as.Get("c"); got != nil {
+		t.Errorf("got Get %q of a missing key, want nil", got)
+	}
+	empty := Annotations{{Key: "e"}}
+	if !empty.Has("e") || as.Has("e") {
+		t.Errorf("got Has %v, %v, want true, false", empty.Has("e"), as.Has("e"))
+	}
+}
+
+func TestAnnotationsFromMap(t *testing.T) {
+	m := map[string][]byte{"c": []byte("3"), "a": []byte("1"), "b": nil}
+	want := Annotations{
+		{Key: "a", Value: []byte("1")},
+		{Key: "b"},
+		{Key: "c", Value: []byte("3")},
+	}
+	for i := 0; i < 10; i++ {
+		if got := AnnotationsFromMap(m); !reflect.DeepEqual(got, want) {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+	if got := AnnotationsFromMap(nil); len(got) != 0 {
+		t.Errorf("got %v for a nil map, want none", got)
+	}
+}
+
 type annotations Annotations
 
 func (a annotations) Len() int           { return len(a) }
@@ -0,0 +1,253 @@
+package appdash
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// DefaultMaxSpillSize is the default ChunkedCollector.MaxSpillSize.
+const DefaultMaxSpillSize = 1 << 30 // 1 GB
+
+// ErrSpillFull is the error returned by ChunkedCollector.Flush (and
+// Collect) when collections were dropped instead of being spilled to disk,
+// because the spill directory reached MaxSpillSize.
+var ErrSpillFull = errors.New("ChunkedCollector spill directory full (collections dropped)")
+
+var spillMagic = []byte("appdash-spill\n")
+
+// spillSuffix is the file name suffix of spill segments, whose names are
+// their (zero-padded, hexadecimal) sequence numbers.
+const spillSuffix = ".spill"
+
+// A queuedSpan is a span and the annotations queued for it (for example,
+// to be spilled to disk).
+type queuedSpan struct {
+	span SpanID
+	anns Annotations
+}
+
+// A spillQueue is a first-in, first-out queue of collections, stored in
+// the segment files of a directory. Each segment holds the collections
+// spilled at once, as checksummed records in the format of the journal of
+// a JournalStore.
+type spillQueue struct {
+	dir     string
+	maxSize int64
+
+	drainMu sync.Mutex // serializes drains
+
+	mu       sync.Mutex // guards the fields below
+	segments []string   // segment files, oldest first
+	offset   int64      // offset of the next record to send in segments[0] (0 for the first)
+	size     int64      // total size of the segment files
+	next     uint64     // sequence number of the next segment
+	dropped  uint64     // number of collections dropped
+}
+
+// openSpillQueue opens the spill queue stored in dir (creating dir if
+// needed), whose segments may total at most maxSize bytes. The records
+// left by a previous process are kept, and partially written or corrupted
+// ones at the end of a segment are discarded.
+func openSpillQueue(dir string, maxSize int64) (*spillQueue, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	names, err := filepath.Glob(filepath.Join(dir, "*"+spillSuffix))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names) // in sequence order, since they are zero-padded
+
+	q := &spillQueue{dir: dir, maxSize: maxSize}
+	for _, name := range names {
+		var seq uint64
+		if _, err := fmt.Sscanf(filepath.Base(name), "%x"+spillSuffix, &seq); err != nil {
+			continue // not a segment
+		}
+		if seq >= q.next {
+			q.next = seq + 1
+		}
+		size, err := recoverSpillSegment(name)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			if err := os.Remove(name); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		q.segments = append(q.segments, name)
+		q.size += size
+	}
+	return q, nil
+}
+
+// recoverSpillSegment checks the records of a segment file, truncates it
+// after the last valid one, and returns its size (or 0 if it has no valid
+// records).
+func recoverSpillSegment(name string) (int64, error) {
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	header := make([]byte, len(spillMagic))
+	if _, err := io.ReadFull(r, header); err != nil || !bytes.Equal(header, spillMagic) {
+		return 0, nil
+	}
+	offset, records := int64(len(header)), 0
+	for {
+		rec, err := readJournalRecord(r)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			log.Printf("ChunkedCollector: discarding spill segment %s after offset %d: %s", name, offset, err)
+			if err := f.Truncate(offset); err != nil {
+				return 0, err
+			}
+			break
+		}
+		offset += int64(journalRecordHeaderSize + len(rec))
+		records++
+	}
+	if records == 0 {
+		return 0, nil
+	}
+	return offset, nil
+}
+
+// spill writes the spans to a new segment, behind the ones already queued.
+// The spans that don't fit within the maximum size are dropped, in which
+// case it returns ErrSpillFull.
+func (q *spillQueue) spill(spans []queuedSpan) error {
+	if len(spans) == 0 {
+		return nil
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var buf, rec bytes.Buffer
+	buf.Write(spillMagic)
+	var dropped uint64
+	for _, s := range spans {
+		rec.Reset()
+		encodeJournalCollect(&rec, s.span, s.anns)
+		if q.size+int64(buf.Len()+journalRecordHeaderSize+rec.Len()) > q.maxSize {
+			dropped++
+			continue
+		}
+		writeJournalRecord(&buf, rec.Bytes())
+	}
+	q.dropped += dropped
+
+	if spilled := uint64(len(spans)) - dropped; spilled > 0 {
+		name := filepath.Join(q.dir, fmt.Sprintf("%016x%s", q.next, spillSuffix))
+		q.next++
+		if err := ioutil.WriteFile(name, buf.Bytes(), 0600); err != nil {
+			os.Remove(name)
+			q.dropped += spilled
+			return err
+		}
+		q.segments = append(q.segments, name)
+		q.size += int64(buf.Len())
+	}
+	if dropped > 0 {
+		return ErrSpillFull
+	}
+	return nil
+}
+
+// drain sends the queued collections to c, oldest first, until the queue
+// is empty, c fails (in which case it returns the error, and the failed
+// collection is sent again by the next drain), or stop returns true.
+func (q *spillQueue) drain(c Collector, stop func() bool) error {
+	q.drainMu.Lock()
+	defer q.drainMu.Unlock()
+
+	for !stop() {
+		q.mu.Lock()
+		if len(q.segments) == 0 {
+			q.mu.Unlock()
+			return nil
+		}
+		name, offset := q.segments[0], q.offset
+		q.mu.Unlock()
+
+		// Segments are never modified once written, so they can be read
+		// without holding q.mu.
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			q.removeHead(0)
+			return err
+		}
+		if offset == 0 {
+			offset = int64(len(spillMagic))
+		}
+		r := bytes.NewReader(data[offset:])
+		for {
+			rec, err := readJournalRecord(r)
+			if err != nil {
+				break // io.EOF, since the records were checked on open
+			}
+			if span, anns, err := decodeJournalCollect(bytes.NewReader(rec)); err == nil {
+				if err := c.Collect(span, anns...); err != nil {
+					q.setOffset(offset)
+					return err
+				}
+			}
+			offset += int64(journalRecordHeaderSize + len(rec))
+			if stop() && r.Len() > 0 {
+				q.setOffset(offset)
+				return nil
+			}
+		}
+		q.removeHead(int64(len(data)))
+		os.Remove(name)
+	}
+	return nil
+}
+
+// setOffset records the offset of the next record to send in the oldest
+// segment.
+func (q *spillQueue) setOffset(offset int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.offset = offset
+}
+
+// removeHead removes the oldest segment, of the given size, from the
+// queue.
+func (q *spillQueue) removeHead(size int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.segments = q.segments[1:]
+	q.offset = 0
+	q.size -= size
+}
+
+// empty reports whether there are no queued collections.
+func (q *spillQueue) empty() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.segments) == 0
+}
+
+// droppedCount returns the number of collections that the queue dropped.
+func (q *spillQueue) droppedCount() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dropped
+}
@@ -0,0 +1,189 @@
+package appdash
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// switchCollector is a collector that records the spans it receives, and
+// fails while it is down.
+type switchCollector struct {
+	mu    sync.Mutex
+	down  bool
+	spans []SpanID
+}
+
+var errCollectorDown = errors.New("collector down")
+
+func (c *switchCollector) Collect(span SpanID, anns ...Annotation) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.down {
+		return errCollectorDown
+	}
+	c.spans = append(c.spans, span)
+	return nil
+}
+
+func (c *switchCollector) setDown(down bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.down = down
+}
+
+func (c *switchCollector) received() []SpanID {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.spans
+}
+
+func spanIDsUpTo(n ID) []SpanID {
+	var spans []SpanID
+	for i := ID(1); i <= n; i++ {
+		spans = append(spans, SpanID{Trace: i, Span: i, Parent: 0})
+	}
+	return spans
+}
+
+func tempSpillDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "appdash-spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestChunkedCollector_Spill(t *testing.T) {
+	dir := tempSpillDir(t)
+	defer os.RemoveAll(dir)
+
+	c := &switchCollector{down: true}
+	cc := &ChunkedCollector{
+		Collector:    c,
+		MinInterval:  time.Hour,
+		MaxQueueSize: 3 * 3 * 8, // 3 spans without annotations
+		SpillDir:     dir,
+	}
+	defer cc.Stop()
+
+	// While the collector is down, the full queue and the failed flushes
+	// are spilled instead of being dropped.
+	for i := ID(1); i <= 20; i++ {
+		if err := cc.Collect(SpanID{Trace: i, Span: i, Parent: 0}); err != nil {
+			t.Fatal(err)
+		}
+		if i%7 == 0 {
+			if err := cc.Flush(); err == nil {
+				t.Fatal("got no flush error while down")
+			}
+		}
+	}
+	if got := c.received(); len(got) != 0 {
+		t.Fatalf("got spans %v while down, want none", got)
+	}
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+spillSuffix))
+	if len(segments) == 0 {
+		t.Fatal("got no spill segments")
+	}
+
+	// Once the collector is back, the spilled spans are sent first, in
+	// order.
+	c.setDown(false)
+	if err := cc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := c.received(), spanIDsUpTo(20); !reflect.DeepEqual(got, want) {
+		t.Errorf("got spans %v, want %v", got, want)
+	}
+	if got := cc.Dropped(); got != 0 {
+		t.Errorf("got %d collections dropped, want 0", got)
+	}
+	if segments, _ := filepath.Glob(filepath.Join(dir, "*"+spillSuffix)); len(segments) != 0 {
+		t.Errorf("got spill segments %v after draining, want none", segments)
+	}
+}
+
+func TestChunkedCollector_SpillRecovery(t *testing.T) {
+	dir := tempSpillDir(t)
+	defer os.RemoveAll(dir)
+
+	// The spans that can't be sent when closing are left on disk.
+	c := &switchCollector{down: true}
+	cc := &ChunkedCollector{Collector: c, MinInterval: time.Hour, SpillDir: dir}
+	for _, span := range spanIDsUpTo(5) {
+		if err := cc.Collect(span); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cc.Close(); err == nil {
+		t.Fatal("got no close error while down")
+	}
+
+	// Simulate a crash while writing a segment.
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+spillSuffix))
+	if len(segments) != 1 {
+		t.Fatalf("got spill segments %v, want 1", segments)
+	}
+	f, err := os.OpenFile(segments[0], os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte{0, 0, 0, 30, 1, 2, 3, 4, 5}); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	// The next collector sends them before its own spans, without the
+	// partial record.
+	c = &switchCollector{}
+	cc = &ChunkedCollector{Collector: c, MinInterval: time.Hour, SpillDir: dir}
+	defer cc.Stop()
+	if err := cc.Collect(SpanID{Trace: 6, Span: 6, Parent: 0}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := c.received(), spanIDsUpTo(6); !reflect.DeepEqual(got, want) {
+		t.Errorf("got spans %v, want %v", got, want)
+	}
+}
+
+func TestChunkedCollector_MaxSpillSize(t *testing.T) {
+	dir := tempSpillDir(t)
+	defer os.RemoveAll(dir)
+
+	c := &switchCollector{down: true}
+	cc := &ChunkedCollector{
+		Collector:    c,
+		MinInterval:  time.Hour,
+		SpillDir:     dir,
+		MaxSpillSize: 100, // the segment header and 2 spans without annotations
+	}
+	defer cc.Stop()
+	for _, span := range spanIDsUpTo(5) {
+		if err := cc.Collect(span); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cc.Flush(); err == nil {
+		t.Fatal("got no flush error while down")
+	}
+	if got := cc.Dropped(); got != 3 {
+		t.Errorf("got %d collections dropped, want 3", got)
+	}
+
+	c.setDown(false)
+	if err := cc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := c.received(), spanIDsUpTo(2); !reflect.DeepEqual(got, want) {
+		t.Errorf("got spans %v, want %v", got, want)
+	}
+}
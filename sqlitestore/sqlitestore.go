@@ -0,0 +1,390 @@
+// Package sqlitestore implements an appdash.Store backed by an SQLite
+// database, for small deployments that want durable, queryable storage
+// without running a database server.
+//
+// The package uses database/sql and does not import an SQLite driver itself;
+// import one in your program and pass its name to Open, e.g.:
+//
+//  import _ "modernc.org/sqlite"         // pure Go, driver name "sqlite"
+//  import _ "github.com/mattn/go-sqlite3" // cgo, driver name "sqlite3"
+//
+// Spans are stored in a spans table (one row per span, with its start time
+// and duration taken from its timespan annotations, or its collection time
+// if it has none) and their annotations in an annotations table. The schema
+// is created and migrated automatically by Open and New.
+package sqlitestore
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"sourcegraph.com/sourcegraph/appdash"
+	"sourcegraph.com/sourcegraph/appdash/internal/tracetree"
+)
+
+// migrations are the schema migrations, applied in order. The number of
+// migrations applied so far is recorded in the database's user_version.
+var migrations = []string{
+	`CREATE TABLE spans (
+		trace_id   INTEGER NOT NULL,
+		span_id    INTEGER NOT NULL,
+		parent_id  INTEGER NOT NULL,
+		start_time INTEGER NOT NULL, -- UnixNano
+		duration   INTEGER NOT NULL, -- nanoseconds
+		PRIMARY KEY (trace_id, span_id)
+	);
+	CREATE INDEX spans_start_time ON spans (start_time);
+	CREATE TABLE annotations (
+		id       INTEGER PRIMARY KEY AUTOINCREMENT,
+		trace_id INTEGER NOT NULL,
+		span_id  INTEGER NOT NULL,
+		key      TEXT NOT NULL,
+		value    BLOB
+	);
+	CREATE INDEX annotations_trace_id ON annotations (trace_id, span_id);`,
+}
+
+// Store is an appdash.Store and appdash.Queryer backed by an SQLite
+// database.
+type Store struct {
+	db *sql.DB
+
+	// writeMu serializes writes, so that concurrent Collect calls use a
+	// single writer instead of contending for SQLite's database lock.
+	writeMu sync.Mutex
+}
+
+// Compile-time "implements" check.
+var _ interface {
+	appdash.DeleteStore
+	appdash.Queryer
+	appdash.TraceIterator
+	appdash.Counter
+} = (*Store)(nil)
+
+// Open opens the SQLite database given by the driver name and data source
+// name (usually a file path), migrates its schema and returns a store backed
+// by it.
+func Open(driverName, dataSourceName string) (*Store, error) {
+	db, err := sql.Open(driverName, dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+	s, err := New(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// New returns a store backed by an already opened SQLite database, migrating
+// its schema if needed.
+func New(db *sql.DB) (*Store, error) {
+	s := &Store{db: db}
+	if err := s.migrate(); err != nil {
+		return nil, err
+	}
+
+	// Let readers proceed while a write is in progress.
+	if _, err := db.Exec(`PRAGMA journal_mode = WAL`); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// migrate applies any schema migrations that have not been applied yet.
+func (s *Store) migrate() error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var version int
+	if err := tx.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("sqlitestore: database schema version %d is newer than supported version %d", version, len(migrations))
+	}
+	if version == len(migrations) {
+		return nil
+	}
+	for _, m := range migrations[version:] {
+		if _, err := tx.Exec(m); err != nil {
+			return fmt.Errorf("sqlitestore: migrating schema: %s", err)
+		}
+	}
+	if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, len(migrations))); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Close closes the underlying database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Collect implements the appdash.Collector interface.
+func (s *Store) Collect(id appdash.SpanID, as ...appdash.Annotation) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT OR IGNORE INTO spans (trace_id, span_id, parent_id, start_time, duration) VALUES (?, ?, ?, ?, 0)`,
+		int64(id.Trace), int64(id.Span), int64(id.Parent), time.Now().UnixNano())
+	if err != nil {
+		return err
+	}
+	if ev, err := (&appdash.Trace{Span: appdash.Span{Annotations: as}}).TimespanEvent(); err == nil {
+		_, err = tx.Exec(`UPDATE spans SET start_time = ?, duration = ? WHERE trace_id = ? AND span_id = ?`,
+			ev.Start().UnixNano(), int64(appdash.EventDuration(ev)), int64(id.Trace), int64(id.Span))
+		if err != nil {
+			return err
+		}
+	}
+	if len(as) > 0 {
+		stmt, err := tx.Prepare(`INSERT INTO annotations (trace_id, span_id, key, value) VALUES (?, ?, ?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, a := range as {
+			if _, err := stmt.Exec(int64(id.Trace), int64(id.Span), a.Key, a.Value); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// Trace implements the appdash.Store interface.
+func (s *Store) Trace(id appdash.ID) (*appdash.Trace, error) {
+	return s.trace(s.db, id)
+}
+
+// queryer is implemented by *sql.DB and *sql.Tx.
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// trace reads and assembles the trace with the given ID.
+func (s *Store) trace(q queryer, id appdash.ID) (*appdash.Trace, error) {
+	rows, err := q.Query(`SELECT span_id, parent_id FROM spans WHERE trace_id = ?`, int64(id))
+	if err != nil {
+		return nil, err
+	}
+	var spans []appdash.Span
+	index := map[appdash.ID]int{}
+	for rows.Next() {
+		var spanID, parentID int64
+		if err := rows.Scan(&spanID, &parentID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		index[appdash.ID(spanID)] = len(spans)
+		spans = append(spans, appdash.Span{ID: appdash.SpanID{Trace: id, Span: appdash.ID(spanID), Parent: appdash.ID(parentID)}})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(spans) == 0 {
+		return nil, appdash.ErrTraceNotFound
+	}
+
+	rows, err = q.Query(`SELECT span_id, key, value FROM annotations WHERE trace_id = ? ORDER BY id`, int64(id))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			spanID int64
+			a      appdash.Annotation
+		)
+		if err := rows.Scan(&spanID, &a.Key, &a.Value); err != nil {
+			return nil, err
+		}
+		if len(a.Value) == 0 {
+			a.Value = nil
+		}
+		if i, ok := index[appdash.ID(spanID)]; ok {
+			spans[i].Annotations = append(spans[i].Annotations, a)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return tracetree.Build(spans), nil
+}
+
+// Traces implements the appdash.Queryer interface. It returns the traces
+// whose root spans started most recently first. If opts.Timespan is set, only
+// traces whose root span started within it are returned. The Matchers and
+// MinDuration filters aren't supported.
+func (s *Store) Traces(opts appdash.TracesOpts) ([]*appdash.Trace, error) {
+	if err := appdash.UnsupportedFilters(opts); err != nil {
+		return nil, err
+	}
+	var (
+		where = []string{"parent_id = 0"}
+		args  []interface{}
+	)
+	if len(opts.TraceIDs) > 0 {
+		ids := make([]string, len(opts.TraceIDs))
+		for i, id := range opts.TraceIDs {
+			ids[i] = "?"
+			args = append(args, int64(id))
+		}
+		where = append(where, "trace_id IN ("+strings.Join(ids, ", ")+")")
+	}
+	if !opts.Timespan.S.IsZero() {
+		where = append(where, "start_time >= ?")
+		args = append(args, opts.Timespan.S.UnixNano())
+	}
+	if !opts.Timespan.E.IsZero() {
+		where = append(where, "start_time <= ?")
+		args = append(args, opts.Timespan.E.UnixNano())
+	}
+	query := "SELECT trace_id FROM spans WHERE " + strings.Join(where, " AND ") + " ORDER BY start_time DESC"
+	if opts.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", opts.Limit)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	var ids []appdash.ID
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, appdash.ID(id))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	traces := make([]*appdash.Trace, 0, len(ids))
+	for _, id := range ids {
+		t, err := s.trace(tx, id)
+		if err == appdash.ErrTraceNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		traces = append(traces, t)
+	}
+	return traces, nil
+}
+
+// forEachPageSize is the number of trace IDs ForEachTrace reads at a time.
+const forEachPageSize = 100
+
+// ForEachTrace implements the appdash.TraceIterator interface. Traces are
+// read one at a time, in order of trace ID, paging through the trace IDs in
+// the spans table's primary key, so f may write to the store.
+func (s *Store) ForEachTrace(f func(*appdash.Trace) error) error {
+	var (
+		after int64
+		first = true
+	)
+	for {
+		query := `SELECT DISTINCT trace_id FROM spans ORDER BY trace_id LIMIT ?`
+		args := []interface{}{forEachPageSize}
+		if !first {
+			query = `SELECT DISTINCT trace_id FROM spans WHERE trace_id > ? ORDER BY trace_id LIMIT ?`
+			args = []interface{}{after, forEachPageSize}
+		}
+		rows, err := s.db.Query(query, args...)
+		if err != nil {
+			return err
+		}
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			t, err := s.trace(s.db, appdash.ID(id))
+			if err == appdash.ErrTraceNotFound {
+				continue // deleted since its ID was read
+			} else if err != nil {
+				return err
+			}
+			if err := f(t); err != nil {
+				return err
+			}
+		}
+		if len(ids) < forEachPageSize {
+			return nil
+		}
+		after, first = ids[len(ids)-1], false
+	}
+}
+
+// NumTraces implements the appdash.Counter interface, by counting the
+// trace IDs in the spans table's primary key.
+func (s *Store) NumTraces() (int, error) {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(DISTINCT trace_id) FROM spans`).Scan(&n)
+	return n, err
+}
+
+// NumSpans implements the appdash.Counter interface.
+func (s *Store) NumSpans() (int, error) {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM spans`).Scan(&n)
+	return n, err
+}
+
+// Delete implements the appdash.DeleteStore interface.
+func (s *Store) Delete(traces ...appdash.ID) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, id := range traces {
+		if _, err := tx.Exec(`DELETE FROM annotations WHERE trace_id = ?`, int64(id)); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM spans WHERE trace_id = ?`, int64(id)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
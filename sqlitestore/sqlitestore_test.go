@@ -0,0 +1,134 @@
+package sqlitestore
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"sourcegraph.com/sourcegraph/appdash"
+	"sourcegraph.com/sourcegraph/appdash/internal/storetest"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "sqlitestore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestStore(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	var n int
+	storetest.Test(t, func(t *testing.T) appdash.Store {
+		n++
+		s, err := Open("sqlite3", filepath.Join(dir, fmt.Sprintf("%d.db", n)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
+
+func TestStore_migrateTwice(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "appdash.db")
+
+	s, err := Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Collect(appdash.SpanID{Trace: 1, Span: 1}); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	s, err = Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.Trace(1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStore_concurrentWriters(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	s, err := Open("sqlite3", filepath.Join(dir, "appdash.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	const writers, traces = 8, 20
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < traces; i++ {
+				id := appdash.ID(w*traces + i + 1)
+				if err := s.Collect(appdash.SpanID{Trace: id, Span: 1}); err != nil {
+					t.Error(err)
+				}
+				if _, err := s.Traces(appdash.TracesOpts{Limit: 5}); err != nil {
+					t.Error(err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	all, err := s.Traces(appdash.TracesOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != writers*traces {
+		t.Errorf("got %d traces, want %d", len(all), writers*traces)
+	}
+}
+
+func TestStore_Traces_timespan(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	s, err := Open("sqlite3", filepath.Join(dir, "appdash.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	start := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 1; i <= 3; i++ {
+		span := start.Add(time.Duration(i) * time.Hour)
+		anns, err := appdash.MarshalEvent(appdash.Timespan{S: span, E: span.Add(time.Second)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Collect(appdash.SpanID{Trace: appdash.ID(i), Span: 1}, anns...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	traces, err := s.Traces(appdash.TracesOpts{
+		Timespan: appdash.Timespan{S: start.Add(90 * time.Minute), E: start.Add(4 * time.Hour)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(traces) != 2 || traces[0].Span.ID.Trace != 3 || traces[1].Span.ID.Trace != 2 {
+		t.Errorf("got traces %v, want traces 3 and 2 (newest first)", traces)
+	}
+}
@@ -2,6 +2,7 @@
 package sqltrace
 
 import (
+	"context"
 	"time"
 
 	"sourcegraph.com/sourcegraph/appdash"
@@ -14,6 +15,10 @@ type SQLEvent struct {
 	Tag        string
 	ClientSend time.Time
 	ClientRecv time.Time
+
+	// D is the duration of the query, measured with the monotonic clock
+	// (see appdash.Timespan), or 0 if it wasn't.
+	D time.Duration `trace:"Duration"`
 }
 
 // Schema implements the appdash Event interface by returning this event's
@@ -32,4 +37,38 @@ func (e SQLEvent) Start() time.Time { return e.ClientSend }
 // which the SQL query returned / was received.
 func (e SQLEvent) End() time.Time { return e.ClientRecv }
 
+// Duration implements the appdash DurationEvent interface by returning the
+// recorded duration of the query.
+func (e SQLEvent) Duration() time.Duration { return e.D }
+
+// AtTime implements the appdash RetimableEvent interface by returning the
+// event of the same query sent at t.
+func (e SQLEvent) AtTime(t time.Time) appdash.Event {
+	e.ClientSend, e.ClientRecv = t, t.Add(e.ClientRecv.Sub(e.ClientSend))
+	return e
+}
+
 func init() { appdash.RegisterEvent(SQLEvent{}) }
+
+// StartQuery starts a span for an SQL query, a child of the current span
+// of ctx (see appdash.StartSpanFromContext), and returns the context of
+// the query, whose current span it is, and a function to call once the
+// query returns, which records the SQLEvent and finishes the span:
+//
+//	ctx, done := sqltrace.StartQuery(ctx, query, "users")
+//	rows, err := db.QueryContext(ctx, query, args...)
+//	done()
+func StartQuery(ctx context.Context, sql, tag string) (context.Context, func()) {
+	name := "SQL"
+	if tag != "" {
+		name += " " + tag
+	}
+	rec, ctx := appdash.StartSpanFromContext(ctx, name)
+	e := SQLEvent{SQL: sql, Tag: tag, ClientSend: time.Now()}
+	return ctx, func() {
+		e.ClientRecv = time.Now()
+		e.D = e.ClientRecv.Sub(e.ClientSend)
+		rec.Event(e)
+		rec.Finish()
+	}
+}
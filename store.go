@@ -1,13 +1,18 @@
 package appdash
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"container/list"
 	"encoding/gob"
 	"errors"
+	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
-	"os"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -33,6 +38,23 @@ type TracesOpts struct {
 
 	// TraceIDs filters the returned traces to just the ones with the given IDs.
 	TraceIDs []ID
+
+	// Limit, if non-zero, is the maximum number of traces to return. Stores
+	// that index traces by time return the most recent ones.
+	Limit int
+
+	// Matchers, if non-empty, restricts the traces to those with a span
+	// that matches all of them.
+	Matchers []AnnotationMatcher
+
+	// MinDuration, if positive, restricts the traces to those whose root
+	// span lasted at least as long (see EventDuration). The traces whose
+	// root span has no timespan event don't match.
+	//
+	// The stores that can't apply the Matchers or MinDuration filters
+	// return an *UnsupportedFilterError from Traces, rather than ignoring
+	// them (see QueryTraces).
+	MinDuration time.Duration
 }
 
 // A Queryer indexes spans and makes them queryable.
@@ -54,12 +76,19 @@ type AggregatedResult struct {
 	// that were aggregated to produce this result, respectively.
 	Average, Min, Max, StdDev time.Duration
 
+	// P50, P95 and P99 are the estimated 50th, 95th and 99th percentiles
+	// of the total trace times (see LatencySketch), which show the tail
+	// latencies that the average hides.
+	P50, P95, P99 time.Duration
+
 	// Samples is the number of traces that were sampled in order to produce
 	// this result.
 	Samples int64
 
 	// Slowest is the N-slowest trace IDs that were part of this group, such
-	// that these are the most valuable/slowest traces for inspection.
+	// that these are the most valuable/slowest traces for inspection. An
+	// AggregateStore may select other exemplar traces instead (see its
+	// ExemplarStrategy).
 	Slowest []ID
 }
 
@@ -75,78 +104,233 @@ type Aggregator interface {
 	Aggregate(start, end time.Duration) ([]*AggregatedResult, error)
 }
 
+// An AggregatedBucket is the aggregation of the traces with a root span
+// name that started within a bucket of time (see SeriesAggregator).
+type AggregatedBucket struct {
+	Start time.Time     // the start of the bucket
+	Size  time.Duration // the duration of the bucket
+
+	AggregatedResult
+}
+
+// A Counter is a store that counts the traces and spans it holds cheaply,
+// without reading them, for example for capacity planning.
+type Counter interface {
+	// NumTraces returns the number of traces in the store.
+	NumTraces() (int, error)
+
+	// NumSpans returns the number of spans in the store.
+	NumSpans() (int, error)
+}
+
+// A SeriesAggregator is an Aggregator that also returns the aggregations
+// of the traces by bucket of time, to show their trends.
+type SeriesAggregator interface {
+	Aggregator
+
+	// AggregateSeries returns the aggregations of the traces with the
+	// root span name, per bucket of time, for the buckets that overlap
+	// with the time range (relative to now, as with Aggregate), oldest
+	// first. The buckets without any trace are omitted.
+	AggregateSeries(name string, start, end time.Duration) ([]*AggregatedBucket, error)
+}
+
+// DefaultMemoryStoreShards is the number of shards of a MemoryStore created
+// by NewMemoryStore.
+const DefaultMemoryStoreShards = 16
+
 // NewMemoryStore creates a new in-memory store
 func NewMemoryStore() *MemoryStore {
-	return &MemoryStore{
-		trace: map[ID]*Trace{},
-		span:  map[ID]map[ID]*Trace{},
+	return NewShardedMemoryStore(DefaultMemoryStoreShards)
+}
+
+// NewShardedMemoryStore creates a new in-memory store whose traces are
+// split by trace ID into the given number of shards (rounded up to a power
+// of two), each with its own lock, so that spans of different traces can be
+// collected concurrently.
+func NewShardedMemoryStore(shards int) *MemoryStore {
+	n := 1
+	for n < shards {
+		n *= 2
 	}
+	ms := &MemoryStore{
+		shards: make([]*memoryShard, n),
+		mask:   uint64(n - 1),
+		lru:    list.New(),
+	}
+	for i := range ms.shards {
+		ms.shards[i] = newMemoryShard(ms)
+	}
+	return ms
 }
 
 // A MemoryStore is an in-memory Store that also implements the PersistentStore
 // interface.
 type MemoryStore struct {
+	// spans and bytes are the total number and estimated size of the spans
+	// held, traces is the number of traces, and maxSpans and maxBytes bound
+	// the spans (zero disables). They are accessed atomically, and come
+	// first so that they are 64-bit aligned.
+	spans, bytes, traces int64
+	maxSpans, maxBytes   int64
+
+	shards []*memoryShard // traces, by trace ID & mask
+	mask   uint64
+
+	lruMu sync.Mutex // protects lru and the elements of traceUsage
+	lru   *list.List // trace IDs, most recently collected or read first
+
+	maxAge        time.Duration // evict spans older than this (zero disables)
+	sweepInterval time.Duration // how often the eviction sweeper runs
+
+	// stop and done are the channels used to stop the eviction sweeper,
+	// and that it closes when it exits. They are nil if it is not running.
+	stop, done chan struct{}
+
+	compressionLevel int // gzip level used by Write (gzip.NoCompression disables)
+
+	sync.Mutex // protects the eviction and compression settings
+
+	log bool
+}
+
+// A memoryShard holds the traces of a MemoryStore whose IDs map to it.
+type memoryShard struct {
+	store *MemoryStore
+
 	trace map[ID]*Trace        // trace ID -> trace tree
 	span  map[ID]map[ID]*Trace // trace ID -> span ID -> trace (sub)tree
 
-	sync.Mutex // protects trace
+	// collected maps trace ID -> span ID -> the UnixNano time the span was
+	// first collected. It is used for age-based eviction of spans that do
+	// not carry timespan annotations.
+	collected map[ID]map[ID]int64
 
-	log bool
+	// start maps trace ID -> the time the trace started, used to query
+	// traces by time (see Traces).
+	start map[ID]traceStart
+
+	usage map[ID]*traceUsage // trace ID -> span count and size of the trace
+
+	// RWMutex protects all of the above. Read-only operations (Trace,
+	// Traces, etc.) take the read lock, so that they proceed concurrently
+	// with each other.
+	sync.RWMutex
+}
+
+func newMemoryShard(ms *MemoryStore) *memoryShard {
+	return &memoryShard{
+		store:     ms,
+		trace:     map[ID]*Trace{},
+		span:      map[ID]map[ID]*Trace{},
+		collected: map[ID]map[ID]int64{},
+		start:     map[ID]traceStart{},
+		usage:     map[ID]*traceUsage{},
+	}
+}
+
+// shard returns the shard holding the given trace.
+func (ms *MemoryStore) shard(id ID) *memoryShard {
+	return ms.shards[uint64(id)&ms.mask]
+}
+
+// lockAll locks all of the shards, so that the store can be read or
+// replaced as a whole.
+func (ms *MemoryStore) lockAll() {
+	for _, sh := range ms.shards {
+		sh.Lock()
+	}
+}
+
+func (ms *MemoryStore) unlockAll() {
+	for _, sh := range ms.shards {
+		sh.Unlock()
+	}
+}
+
+// rlockAll read-locks all of the shards.
+func (ms *MemoryStore) rlockAll() {
+	for _, sh := range ms.shards {
+		sh.RLock()
+	}
+}
+
+func (ms *MemoryStore) runlockAll() {
+	for _, sh := range ms.shards {
+		sh.RUnlock()
+	}
 }
 
 // Compile-time "implements" check.
 var _ interface {
-	Store
+	TraceIterator
+	BatchDeleteStore
 	Queryer
+	Counter
 } = (*MemoryStore)(nil)
 
 // Collect implements the Collector interface by collecting the events that
 // occured in the span in-memory.
 func (ms *MemoryStore) Collect(id SpanID, as ...Annotation) error {
-	ms.Lock()
-	defer ms.Unlock()
-	return ms.collectNoLock(id, as...)
+	sh := ms.shard(id.Trace)
+	sh.Lock()
+	err := sh.collectNoLock(id, as...)
+	if err == nil {
+		sh.touchNoLock(id.Trace)
+	}
+	sh.Unlock()
+	if err != nil {
+		return err
+	}
+	ms.enforceLimits()
+	return nil
 }
 
 // collectNoLock is the same as Collect, but it does not grab the lock.
-func (ms *MemoryStore) collectNoLock(id SpanID, as ...Annotation) error {
-	if ms.log {
+func (sh *memoryShard) collectNoLock(id SpanID, as ...Annotation) error {
+	if sh.store.log {
 		log.Printf("Collect %v", id)
 	}
 
 	// Initialize span map if needed.
-	if _, present := ms.span[id.Trace]; !present {
-		ms.span[id.Trace] = map[ID]*Trace{}
+	if _, present := sh.span[id.Trace]; !present {
+		sh.span[id.Trace] = map[ID]*Trace{}
 	}
 
 	// Create or update span.
-	s, present := ms.span[id.Trace][id.Span]
+	s, present := sh.span[id.Trace][id.Span]
 	if !present {
 		s = &Trace{Span: Span{ID: id, Annotations: as}}
-		ms.span[id.Trace][id.Span] = s
+		sh.span[id.Trace][id.Span] = s
+		sh.markCollectedNoLock(id, time.Now().UnixNano())
+		sh.accountNoLock(id.Trace, 1, spanSize(as))
 	} else {
-		if ms.log {
+		if sh.store.log {
 			if len(as) > 0 {
 				log.Printf("Add %d annotations to %v", len(as), id)
 			}
 		}
 		s.Annotations = append(s.Annotations, as...)
+		sh.accountNoLock(id.Trace, 0, annotationsSize(as))
+		sh.indexStartNoLock(id, as)
 		return nil
 	}
+	sh.indexStartNoLock(id, as)
 
 	// Create trace tree if it doesn't already exist.
-	root, present := ms.trace[id.Trace]
+	root, present := sh.trace[id.Trace]
 	if !present {
 		// Root span hasn't been seen yet, so make this the temporary
 		// root (until we collect the actual root).
-		if ms.log {
+		if sh.store.log {
 			if id.IsRoot() {
 				log.Printf("Create trace %v root %v", id.Trace, id)
 			} else {
 				log.Printf("Create temporary trace %v root %v", id.Trace, id)
 			}
 		}
-		ms.trace[id.Trace] = s
+		sh.trace[id.Trace] = s
+		atomic.AddInt64(&sh.store.traces, 1)
 		root = s
 	}
 
@@ -156,23 +340,23 @@ func (ms *MemoryStore) collectNoLock(id SpanID, as ...Annotation) error {
 	if isRoot, isTempRootParent := id.IsRoot(), root.Span.ID.Parent == id.Span; s != root && (isRoot || isTempRootParent) {
 		oldRoot := root
 		root = s
-		if ms.log {
+		if sh.store.log {
 			if isRoot {
 				log.Printf("Set real root %v and move temp root %v", root.Span.ID, oldRoot.Span.ID)
 			} else {
 				log.Printf("Set new temp root %v and move previous temp root %v (child of new temp root)", root.Span.ID, oldRoot.Span.ID)
 			}
 		}
-		ms.trace[id.Trace] = root // set new root
-		ms.reattachChildren(root, oldRoot)
-		ms.insert(root, oldRoot) // reinsert the old root
+		sh.trace[id.Trace] = root // set new root
+		sh.reattachChildren(root, oldRoot)
+		sh.insert(root, oldRoot) // reinsert the old root
 
 		// Move the old temp root's temp children to the new
 		// (possibly temp) root.
 		var sub2 []*Trace
 		for _, c := range oldRoot.Sub {
 			if c.Span.ID.Parent != oldRoot.Span.ID.Span {
-				if ms.log {
+				if sh.store.log {
 					log.Printf("Move %v from old root %v to new (possibly temp) root %v", c.Span.ID, oldRoot.Span.ID, root.Span.ID)
 				}
 				root.Sub = append(root.Sub, c)
@@ -186,13 +370,13 @@ func (ms *MemoryStore) collectNoLock(id SpanID, as ...Annotation) error {
 	// Insert into trace tree. (We inserted the trace root span
 	// above.)
 	if !id.IsRoot() && s != root {
-		ms.insert(root, s)
+		sh.insert(root, s)
 	}
 
 	// See if we're the parent of any of the root's temporary
 	// children.
 	if s != root {
-		ms.reattachChildren(s, root)
+		sh.reattachChildren(s, root)
 	}
 
 	return nil
@@ -200,17 +384,17 @@ func (ms *MemoryStore) collectNoLock(id SpanID, as ...Annotation) error {
 
 // insert inserts t into the trace tree whose root (or temp root) is
 // root.
-func (ms *MemoryStore) insert(root, t *Trace) {
-	p, present := ms.span[t.ID.Trace][t.ID.Parent]
+func (sh *memoryShard) insert(root, t *Trace) {
+	p, present := sh.span[t.ID.Trace][t.ID.Parent]
 	if present {
-		if ms.log {
+		if sh.store.log {
 			log.Printf("Add %v as a child of parent %v", t.Span.ID, p.Span.ID)
 		}
 		p.Sub = append(p.Sub, t)
 	} else {
 		// Add as temporary child of the root for now. When the
 		// real parent is added, we'll fix it up later.
-		if ms.log {
+		if sh.store.log {
 			log.Printf("Add %v as a temporary child of root %v", t.Span.ID, root.Span.ID)
 		}
 		root.Sub = append(root.Sub, t)
@@ -219,14 +403,14 @@ func (ms *MemoryStore) insert(root, t *Trace) {
 
 // reattachChildren moves temporary children of src to dst, if dst is
 // the node's parent.
-func (ms *MemoryStore) reattachChildren(dst, src *Trace) {
+func (sh *memoryShard) reattachChildren(dst, src *Trace) {
 	if dst == src {
 		panic("dst == src")
 	}
 	var sub2 []*Trace
 	for _, c := range src.Sub {
 		if c.Span.ID.Parent == dst.Span.ID.Span {
-			if ms.log {
+			if sh.store.log {
 				log.Printf("Move %v from src %v to dst %v", c.Span.ID, src.Span.ID, dst.Span.ID)
 			}
 			dst.Sub = append(dst.Sub, c)
@@ -241,49 +425,189 @@ func (ms *MemoryStore) reattachChildren(dst, src *Trace) {
 // spans) for the given trace span ID or, if no such trace exists, by returning
 // ErrTraceNotFound.
 func (ms *MemoryStore) Trace(id ID) (*Trace, error) {
-	ms.Lock()
-	defer ms.Unlock()
+	sh := ms.shard(id)
+	sh.RLock()
+	defer sh.RUnlock()
+
+	sh.touchNoLock(id)
+	return sh.traceNoLock(id)
+}
 
-	return ms.traceNoLock(id)
+// containsTrace reports whether the trace exists, without reading it or
+// marking it as used.
+func (ms *MemoryStore) containsTrace(id ID) bool {
+	sh := ms.shard(id)
+	sh.RLock()
+	defer sh.RUnlock()
+	_, present := sh.trace[id]
+	return present
 }
 
-func (ms *MemoryStore) traceNoLock(id ID) (*Trace, error) {
-	t, present := ms.trace[id]
+func (sh *memoryShard) traceNoLock(id ID) (*Trace, error) {
+	t, present := sh.trace[id]
 	if !present {
 		return nil, ErrTraceNotFound
 	}
 	return t, nil
 }
 
-// Traces implements the Queryer interface.
+// Traces implements the Queryer interface: it supports all of the
+// filters. Traces are returned by the time they started, most recent
+// first. If opts.Timespan is set, only traces that started within it are
+// returned.
+//
+// The start time of a trace is the start of its root span's timespan
+// annotations or, if it has none (or its root span has not been collected
+// yet), the time the trace was first collected.
 func (ms *MemoryStore) Traces(opts TracesOpts) ([]*Trace, error) {
-	ms.Lock()
-	defer ms.Unlock()
+	var s, e int64
+	if !opts.Timespan.S.IsZero() {
+		s = opts.Timespan.S.UnixNano()
+	}
+	if !opts.Timespan.E.IsZero() {
+		e = opts.Timespan.E.UnixNano()
+	}
 
-	var ts []*Trace
-	for id := range ms.trace {
-		t, err := ms.traceNoLock(id)
-		if err != nil {
-			return nil, err
+	var only map[ID]bool
+	if len(opts.TraceIDs) > 0 {
+		only = make(map[ID]bool, len(opts.TraceIDs))
+		for _, id := range opts.TraceIDs {
+			only[id] = true
 		}
-		ts = append(ts, t)
+	}
+
+	var (
+		ids    []ID
+		starts = map[ID]traceStart{}
+		traces = map[ID]*Trace{}
+	)
+	for _, sh := range ms.shards {
+		sh.RLock()
+		for id, t := range sh.trace {
+			start := sh.start[id]
+			if (s != 0 && start.nano < s) || (e != 0 && start.nano > e) {
+				continue
+			}
+			if (only != nil && !only[id]) || !opts.match(t) {
+				continue
+			}
+			ids = append(ids, id)
+			starts[id] = start
+			traces[id] = t
+		}
+		sh.RUnlock()
+	}
+	sort.Sort(idsByStart{ids, starts})
+	if opts.Limit > 0 && len(ids) > opts.Limit {
+		ids = ids[:opts.Limit]
+	}
+
+	ts := make([]*Trace, 0, len(ids))
+	for _, id := range ids {
+		ts = append(ts, traces[id])
 	}
 	return ts, nil
 }
 
+// traceStart is the time a trace started (see MemoryStore.Traces).
+type traceStart struct {
+	nano  int64 // UnixNano time
+	timed bool  // whether nano is from the root span's timespan annotations
+}
+
+// idsByStart sorts trace IDs by start time, most recent first.
+type idsByStart struct {
+	ids   []ID
+	start map[ID]traceStart
+}
+
+func (v idsByStart) Len() int      { return len(v.ids) }
+func (v idsByStart) Swap(i, j int) { v.ids[i], v.ids[j] = v.ids[j], v.ids[i] }
+func (v idsByStart) Less(i, j int) bool {
+	si, sj := v.start[v.ids[i]].nano, v.start[v.ids[j]].nano
+	if si != sj {
+		return si > sj
+	}
+	return v.ids[i] < v.ids[j]
+}
+
+// indexStartNoLock updates the start time of the given span's trace after
+// the annotations as were collected for the span.
+func (sh *memoryShard) indexStartNoLock(id SpanID, as Annotations) {
+	if sh.start == nil {
+		sh.start = map[ID]traceStart{}
+	}
+	st, ok := sh.start[id.Trace]
+	if !ok {
+		st = traceStart{nano: time.Now().UnixNano()}
+	}
+	if id.IsRoot() && len(as) > 0 {
+		if ev, err := (&Trace{Span: Span{Annotations: as}}).TimespanEvent(); err == nil {
+			if nano := ev.Start().UnixNano(); !st.timed || nano < st.nano {
+				st = traceStart{nano: nano, timed: true}
+			}
+		}
+	}
+	sh.start[id.Trace] = st
+}
+
 // Delete implements the DeleteStore interface by deleting the traces given by
 // their span ID's from this in-memory store.
 func (ms *MemoryStore) Delete(traces ...ID) error {
-	ms.Lock()
-	defer ms.Unlock()
-	return ms.deleteNoLock(traces...)
+	_, err := ms.DeleteTraces(traces...)
+	return err
+}
+
+// DeleteTraces implements the BatchDeleteStore interface by deleting the
+// given traces under a single acquisition of each shard's lock. It returns
+// the number of traces that were deleted; IDs of traces that do not exist
+// are ignored.
+func (ms *MemoryStore) DeleteTraces(traces ...ID) (deleted int, err error) {
+	byShard := make([][]ID, len(ms.shards))
+	for _, id := range traces {
+		i := uint64(id) & ms.mask
+		byShard[i] = append(byShard[i], id)
+	}
+	for i, ids := range byShard {
+		if len(ids) == 0 {
+			continue
+		}
+		sh := ms.shards[i]
+		sh.Lock()
+		for _, id := range ids {
+			if _, ok := sh.trace[id]; ok {
+				deleted++
+			}
+		}
+		err = sh.deleteNoLock(ids...)
+		sh.Unlock()
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
 }
 
 // deleteNoLock is the same as Delete, but it doesn't grab the lock.
-func (ms *MemoryStore) deleteNoLock(traces ...ID) error {
+func (sh *memoryShard) deleteNoLock(traces ...ID) error {
 	for _, id := range traces {
-		delete(ms.trace, id)
-		delete(ms.span, id)
+		if _, ok := sh.trace[id]; ok {
+			atomic.AddInt64(&sh.store.traces, -1)
+		}
+		delete(sh.trace, id)
+		delete(sh.span, id)
+		delete(sh.collected, id)
+		delete(sh.start, id)
+		if u, ok := sh.usage[id]; ok {
+			atomic.AddInt64(&sh.store.spans, -int64(u.spans))
+			atomic.AddInt64(&sh.store.bytes, -u.bytes)
+			if u.elem != nil {
+				sh.store.lruMu.Lock()
+				sh.store.lru.Remove(u.elem)
+				sh.store.lruMu.Unlock()
+			}
+			delete(sh.usage, id)
+		}
 	}
 	return nil
 }
@@ -294,16 +618,19 @@ func (ms *MemoryStore) deleteNoLock(traces ...ID) error {
 // TODO(slimsag): not general purpose / cannot handle removal of deep subspans
 // (e.g. Root->Sub->Sub). This is not important for our uses in AggregateStore,
 // however, as it uses only one level deep subspans.
-func (ms *MemoryStore) deleteSubNoLock(s SpanID, annotationsOnly bool) bool {
-	if sub, ok := ms.span[s.Trace]; ok {
+func (sh *memoryShard) deleteSubNoLock(s SpanID, annotationsOnly bool) bool {
+	if sub, ok := sh.span[s.Trace]; ok {
 		if tr, ok := sub[s.Span]; ok {
+			sh.accountNoLock(s.Trace, 0, -annotationsSize(tr.Annotations))
 			tr.Annotations = nil
 
 			if !annotationsOnly {
 				delete(sub, s.Span)
+				delete(sh.collected[s.Trace], s.Span)
+				sh.accountNoLock(s.Trace, -1, -spanSize(nil))
 
 				// Remove from root *Trace.Sub slice, too.
-				root := ms.trace[s.Trace]
+				root := sh.trace[s.Trace]
 				for i, t := range root.Sub {
 					if t != tr {
 						continue
@@ -317,34 +644,614 @@ func (ms *MemoryStore) deleteSubNoLock(s SpanID, annotationsOnly bool) bool {
 	return false
 }
 
+// markCollectedNoLock records that the given span was first collected at
+// the given UnixNano time.
+func (sh *memoryShard) markCollectedNoLock(id SpanID, nano int64) {
+	if sh.collected == nil {
+		sh.collected = map[ID]map[ID]int64{}
+	}
+	spans, ok := sh.collected[id.Trace]
+	if !ok {
+		spans = map[ID]int64{}
+		sh.collected[id.Trace] = spans
+	}
+	spans[id.Span] = nano
+}
+
+const (
+	// defaultSweepInterval is the interval at which the eviction sweeper
+	// runs when no interval has been set via SetSweepInterval.
+	defaultSweepInterval = time.Minute
+
+	// evictBatchSize is the number of traces examined by the eviction
+	// sweeper per acquisition of the store's lock.
+	evictBatchSize = 256
+)
+
+// SetMaxAge sets the maximum age of spans held in the store. When d is
+// non-zero, a background goroutine periodically deletes spans older than d
+// (see SetSweepInterval). A d of zero disables age-based eviction and stops
+// the background goroutine, as Close does.
+//
+// The age of a span is determined by the end time of its timespan
+// annotations, or the time it was first collected if it has none. Spans
+// that still have younger descendants are kept so that the trace tree stays
+// intact; a trace is deleted entirely once all of its spans have expired.
+func (ms *MemoryStore) SetMaxAge(d time.Duration) {
+	ms.Lock()
+	ms.maxAge = d
+	if d > 0 {
+		if ms.stop == nil {
+			ms.startSweeperNoLock()
+		}
+		ms.Unlock()
+		return
+	}
+	stop, done := ms.stopSweeperNoLock()
+	ms.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// SetSweepInterval sets how often the eviction sweeper started by SetMaxAge
+// runs. The default is one minute.
+func (ms *MemoryStore) SetSweepInterval(interval time.Duration) {
+	ms.Lock()
+	ms.sweepInterval = interval
+	stop, done := ms.stopSweeperNoLock()
+	if stop != nil {
+		ms.startSweeperNoLock() // with the new interval
+	}
+	ms.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// Close stops the eviction sweeper started by SetMaxAge, if it is running,
+// and waits for it to exit. The store can still be used afterwards, but
+// its spans are no longer evicted by age until SetMaxAge is called again.
+// A MemoryStore with a non-zero max age must be closed once it is no
+// longer used, or the sweeper keeps running.
+func (ms *MemoryStore) Close() error {
+	ms.SetMaxAge(0)
+	return nil
+}
+
+// startSweeperNoLock starts the eviction sweeper. The ms.Mutex lock must
+// be held, and the sweeper must not be running.
+func (ms *MemoryStore) startSweeperNoLock() {
+	interval := ms.sweepInterval
+	if interval <= 0 {
+		interval = defaultSweepInterval
+	}
+	ms.stop, ms.done = make(chan struct{}), make(chan struct{})
+	go ms.sweep(interval, ms.stop, ms.done)
+}
+
+// stopSweeperNoLock forgets the channels of the eviction sweeper (which
+// are nil if it isn't running) and returns them. The caller must then
+// close stop and wait for done, after releasing the ms.Mutex lock, which
+// the sweeper acquires. The lock must be held.
+func (ms *MemoryStore) stopSweeperNoLock() (stop, done chan struct{}) {
+	stop, done = ms.stop, ms.done
+	ms.stop, ms.done = nil, nil
+	return stop, done
+}
+
+// sweep evicts the spans older than the store's max age every interval
+// until stop is closed, and then closes done.
+func (ms *MemoryStore) sweep(interval time.Duration, stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		ms.Lock()
+		maxAge := ms.maxAge
+		ms.Unlock()
+		if maxAge <= 0 {
+			continue // being stopped by SetMaxAge
+		}
+
+		start := time.Now()
+		n := ms.evictBefore(start.Add(-maxAge))
+		if ms.log && n > 0 {
+			log.Printf("MemoryStore: evicted %d spans older than %s (took %s)", n, maxAge, time.Since(start))
+		}
+	}
+}
+
+// evictBefore deletes all spans whose age (see SetMaxAge) is before t, and
+// returns the number of spans deleted. The lock is acquired and released
+// once per batch of traces so that reads are not blocked for the entire
+// sweep.
+func (ms *MemoryStore) evictBefore(t time.Time) int {
+	cutoff := t.UnixNano()
+	var evicted int
+	for _, sh := range ms.shards {
+		sh.RLock()
+		ids := make([]ID, 0, len(sh.trace))
+		for id := range sh.trace {
+			ids = append(ids, id)
+		}
+		sh.RUnlock()
+
+		for len(ids) > 0 {
+			batch := ids
+			if len(batch) > evictBatchSize {
+				batch = batch[:evictBatchSize]
+			}
+			ids = ids[len(batch):]
+
+			sh.Lock()
+			for _, id := range batch {
+				evicted += sh.evictTraceNoLock(id, cutoff)
+			}
+			sh.Unlock()
+		}
+	}
+	return evicted
+}
+
+// evictTraceNoLock deletes the spans of the given trace that are older than
+// cutoff (a UnixNano time) and have no younger descendants. It returns the
+// number of spans deleted.
+func (sh *memoryShard) evictTraceNoLock(id ID, cutoff int64) int {
+	root, ok := sh.trace[id]
+	if !ok {
+		return 0
+	}
+
+	var evicted int
+
+	// prune removes expired children from t.Sub and reports whether t and
+	// all of its descendants have expired.
+	var prune func(t *Trace) bool
+	prune = func(t *Trace) bool {
+		expired := true
+		var keep []*Trace
+		for i, c := range t.Sub {
+			if !prune(c) {
+				expired = false
+				if keep != nil {
+					keep = append(keep, c)
+				}
+				continue
+			}
+			if keep == nil {
+				keep = append([]*Trace{}, t.Sub[:i]...)
+			}
+			delete(sh.span[id], c.Span.ID.Span)
+			delete(sh.collected[id], c.Span.ID.Span)
+			sh.accountNoLock(id, -1, -spanSize(c.Span.Annotations))
+			evicted++
+		}
+		if keep != nil {
+			t.Sub = keep
+		}
+		return expired && sh.spanTimeNoLock(t) < cutoff
+	}
+	if prune(root) {
+		sh.deleteNoLock(id)
+		evicted++
+	}
+	return evicted
+}
+
+// spanTimeNoLock returns the UnixNano time used to determine the age of the
+// given span: the end of its timespan annotations if present, otherwise the
+// time it was first collected.
+func (sh *memoryShard) spanTimeNoLock(t *Trace) int64 {
+	if ev, err := t.TimespanEvent(); err == nil {
+		return ev.End().UnixNano()
+	}
+	if nano, ok := sh.collected[t.Span.ID.Trace][t.Span.ID.Span]; ok {
+		return nano
+	}
+	return time.Now().UnixNano()
+}
+
+// spanOverheadBytes is the estimated in-memory size of a span, excluding
+// its annotations.
+const spanOverheadBytes = 128
+
+// spanSize returns the estimated in-memory size of a span with the given
+// annotations.
+func spanSize(as Annotations) int64 {
+	return spanOverheadBytes + annotationsSize(as)
+}
+
+// annotationsSize returns the estimated in-memory size of the given
+// annotations.
+func annotationsSize(as Annotations) int64 {
+	var n int64
+	for _, a := range as {
+		n += int64(len(a.Key) + len(a.Value))
+	}
+	return n
+}
+
+// traceUsage tracks the number of spans and estimated size of a single trace
+// in a MemoryStore.
+type traceUsage struct {
+	spans int
+	bytes int64
+	elem  *list.Element // element in MemoryStore.lru
+}
+
+// MemoryStoreUsage describes the amount of data held in a MemoryStore.
+type MemoryStoreUsage struct {
+	Traces int   // number of traces
+	Spans  int   // number of spans
+	Bytes  int64 // estimated size of the spans and their annotations
+}
+
+// Usage returns the current amount of data held in the store.
+func (ms *MemoryStore) Usage() MemoryStoreUsage {
+	return MemoryStoreUsage{
+		Traces: int(atomic.LoadInt64(&ms.traces)),
+		Spans:  int(atomic.LoadInt64(&ms.spans)),
+		Bytes:  atomic.LoadInt64(&ms.bytes),
+	}
+}
+
+// NumTraces implements the Counter interface. The count is maintained as
+// traces are collected, deleted and evicted, so it doesn't read them.
+func (ms *MemoryStore) NumTraces() (int, error) {
+	return int(atomic.LoadInt64(&ms.traces)), nil
+}
+
+// NumSpans implements the Counter interface, like NumTraces.
+func (ms *MemoryStore) NumSpans() (int, error) {
+	return int(atomic.LoadInt64(&ms.spans)), nil
+}
+
+// SetMaxSpans bounds the total number of spans held in the store. When the
+// bound is exceeded, whole traces are deleted in least-recently-used order
+// (a trace is used when it is collected into or read via Trace) until the
+// store is back under the bound. The most recently used trace is never
+// deleted. A max of zero disables the bound.
+func (ms *MemoryStore) SetMaxSpans(max int) {
+	atomic.StoreInt64(&ms.maxSpans, int64(max))
+	ms.enforceLimits()
+}
+
+// SetMaxBytes is like SetMaxSpans, but bounds the estimated total size of the
+// spans and their annotations held in the store.
+func (ms *MemoryStore) SetMaxBytes(max int64) {
+	atomic.StoreInt64(&ms.maxBytes, max)
+	ms.enforceLimits()
+}
+
+// accountNoLock adjusts the span count and size of the given trace (and of
+// the store as a whole) by the given deltas.
+func (sh *memoryShard) accountNoLock(id ID, spans int, bytes int64) {
+	u, ok := sh.usage[id]
+	if !ok {
+		u = &traceUsage{}
+		sh.usage[id] = u
+	}
+	u.spans += spans
+	u.bytes += bytes
+	atomic.AddInt64(&sh.store.spans, int64(spans))
+	atomic.AddInt64(&sh.store.bytes, bytes)
+}
+
+// touchNoLock marks the given trace as the most recently used one. Only the
+// shard's read lock need be held, since the LRU list is protected by its own
+// lock.
+func (sh *memoryShard) touchNoLock(id ID) {
+	u, ok := sh.usage[id]
+	if !ok {
+		return
+	}
+	sh.store.lruMu.Lock()
+	if u.elem == nil {
+		u.elem = sh.store.lru.PushFront(id)
+	} else {
+		sh.store.lru.MoveToFront(u.elem)
+	}
+	sh.store.lruMu.Unlock()
+}
+
+// enforceLimits deletes least-recently-used traces until the store is within
+// its span and byte bounds, or only a single trace remains. No shard's lock
+// may be held while calling enforceLimits.
+func (ms *MemoryStore) enforceLimits() {
+	for {
+		maxSpans, maxBytes := atomic.LoadInt64(&ms.maxSpans), atomic.LoadInt64(&ms.maxBytes)
+		if !(maxSpans > 0 && atomic.LoadInt64(&ms.spans) > maxSpans) && !(maxBytes > 0 && atomic.LoadInt64(&ms.bytes) > maxBytes) {
+			return
+		}
+		ms.lruMu.Lock()
+		if ms.lru.Len() <= 1 {
+			ms.lruMu.Unlock()
+			return
+		}
+		id := ms.lru.Back().Value.(ID)
+		ms.lruMu.Unlock()
+
+		// The trace may have been used (or evicted by another call) since
+		// the LRU list was unlocked, so only delete it if it is still the
+		// least recently used one.
+		sh := ms.shard(id)
+		sh.Lock()
+		ms.lruMu.Lock()
+		lru := ms.lru.Len() > 1 && ms.lru.Back().Value.(ID) == id
+		ms.lruMu.Unlock()
+		if lru {
+			if ms.log {
+				log.Printf("MemoryStore: evicting least recently used trace %v", id)
+			}
+			sh.deleteNoLock(id)
+		}
+		sh.Unlock()
+	}
+}
+
+// memoryStoreData is the format written by MemoryStore.Write before it
+// streamed traces, which ReadFrom still reads.
 type memoryStoreData struct {
 	Trace map[ID]*Trace
 	Span  map[ID]map[ID]*Trace
 }
 
-// Write implements the PersistentStore interface by gob-encoding and writing
-// ms's internal data structures out to w.
-func (ms *MemoryStore) Write(w io.Writer) error {
+// streamMagic starts the data written by MemoryStore.WriteTo, which is
+// followed by a gob stream of streamRecords: one per trace, and then one
+// with a nil Trace marking the end of the data.
+var streamMagic = []byte("appdash-stream1\n")
+
+// streamRecord is a record of the data written by MemoryStore.WriteTo.
+type streamRecord struct {
+	Trace *Trace
+}
+
+// SetCompressionLevel sets the gzip compression level used by Write, e.g.
+// gzip.BestSpeed or gzip.DefaultCompression. The default level,
+// gzip.NoCompression, writes uncompressed data. ReadFrom detects compressed
+// data automatically, regardless of the level set here.
+func (ms *MemoryStore) SetCompressionLevel(level int) error {
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		return fmt.Errorf("appdash: invalid compression level %d", level)
+	}
 	ms.Lock()
 	defer ms.Unlock()
+	ms.compressionLevel = level
+	return nil
+}
 
-	data := memoryStoreData{ms.trace, ms.span}
-	return gob.NewEncoder(w).Encode(data)
+// Write implements the PersistentStore interface by writing ms's traces
+// to w, as WriteTo does.
+func (ms *MemoryStore) Write(w io.Writer) error {
+	_, err := ms.WriteTo(w)
+	return err
 }
 
-// ReadFrom implements the PersistentStore interface by using gob-decoding to
-// load ms's internal data structures from the reader r.
-func (ms *MemoryStore) ReadFrom(r io.Reader) (int64, error) {
+// WriteTo writes ms's traces to w one at a time, so that the memory needed
+// is proportional to the largest trace rather than the whole store, and
+// returns the number of bytes written. If a compression level has been set
+// via SetCompressionLevel, the data is gzip-compressed.
+//
+// Collect may be called concurrently. Each trace is written as it was at
+// some point during the call, and traces created after the call started are
+// not written.
+func (ms *MemoryStore) WriteTo(w io.Writer) (int64, error) {
+	return ms.writeTraces(w, ms.ForEachTrace)
+}
+
+// writeTraces is like WriteTo, but it writes the traces iterated over by
+// forEach (see TraceIterator).
+func (ms *MemoryStore) writeTraces(w io.Writer, forEach func(func(*Trace) error) error) (int64, error) {
 	ms.Lock()
-	defer ms.Unlock()
+	level := ms.compressionLevel
+	ms.Unlock()
+
+	cw := &countingWriter{w: w}
+	var (
+		dst io.Writer = cw
+		gz  *gzip.Writer
+	)
+	if level != gzip.NoCompression {
+		var err error
+		if gz, err = gzip.NewWriterLevel(cw, level); err != nil {
+			return 0, err
+		}
+		dst = gz
+	}
+	if _, err := dst.Write(streamMagic); err != nil {
+		return cw.n, err
+	}
+	enc := gob.NewEncoder(dst)
+	err := forEach(func(t *Trace) error {
+		return enc.Encode(streamRecord{Trace: t})
+	})
+	if err != nil {
+		return cw.n, err
+	}
+	if err := enc.Encode(streamRecord{}); err != nil {
+		return cw.n, err
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return cw.n, err
+		}
+	}
+	return cw.n, nil
+}
+
+// ForEachTrace implements the TraceIterator interface. It iterates over the
+// traces that were in the store when it was called, skipping any that are
+// deleted before they are reached. Each trace is copied under its shard's
+// lock, which is not held while calling f, so f may use the store and
+// spans may be collected concurrently.
+func (ms *MemoryStore) ForEachTrace(f func(*Trace) error) error {
+	// Take the set of traces from all shards at once.
+	var ids []ID
+	ms.rlockAll()
+	for _, sh := range ms.shards {
+		for id := range sh.trace {
+			ids = append(ids, id)
+		}
+	}
+	ms.runlockAll()
+
+	for _, id := range ids {
+		t, ok := ms.copyTrace(id)
+		if !ok {
+			continue // deleted since the call started
+		}
+		if err := f(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyTrace returns a copy (see copyTree) of the trace with the given ID,
+// and whether it exists.
+func (ms *MemoryStore) copyTrace(id ID) (*Trace, bool) {
+	sh := ms.shard(id)
+	sh.RLock()
+	defer sh.RUnlock()
+	t, ok := sh.trace[id]
+	if !ok {
+		return nil, false
+	}
+	return copyTree(t), true
+}
+
+// copyTraces returns copies (see copyTree) of all of the traces, as they
+// were at the same point in time.
+func (ms *MemoryStore) copyTraces() []*Trace {
+	ms.rlockAll()
+	defer ms.runlockAll()
+	var traces []*Trace
+	for _, sh := range ms.shards {
+		for _, t := range sh.trace {
+			traces = append(traces, copyTree(t))
+		}
+	}
+	return traces
+}
+
+// copyTree returns a copy of the trace tree t that is not modified when
+// spans are collected into t. Annotations are shared, since collecting
+// annotations only appends to them.
+func copyTree(t *Trace) *Trace {
+	c := &Trace{Span: t.Span}
+	if len(t.Sub) > 0 {
+		c.Sub = make([]*Trace, len(t.Sub))
+		for i, sub := range t.Sub {
+			c.Sub[i] = copyTree(sub)
+		}
+	}
+	return c
+}
+
+// countingWriter counts the bytes written to an underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// ReadFrom implements the PersistentStore interface by replacing ms's
+// traces with the ones read from r, and returns the number of traces read.
+// It reads data written by WriteTo one trace at a time, as well as data
+// written by older versions of Write. Data written with compression enabled
+// is detected and decompressed transparently.
+func (ms *MemoryStore) ReadFrom(r io.Reader) (int64, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return 0, err
+		}
+		defer gz.Close()
+		br = bufio.NewReader(gz)
+	}
 
 	var data memoryStoreData
-	if err := gob.NewDecoder(r).Decode(&data); err != nil {
+	if magic, err := br.Peek(len(streamMagic)); err == nil && bytes.Equal(magic, streamMagic) {
+		if _, err := br.Discard(len(streamMagic)); err != nil {
+			return 0, err
+		}
+		data.Trace = map[ID]*Trace{}
+		data.Span = map[ID]map[ID]*Trace{}
+		dec := gob.NewDecoder(br)
+		for {
+			var rec streamRecord
+			if err := dec.Decode(&rec); err == io.EOF {
+				return 0, io.ErrUnexpectedEOF
+			} else if err != nil {
+				return 0, err
+			}
+			if rec.Trace == nil {
+				break
+			}
+			id := rec.Trace.Span.ID.Trace
+			data.Trace[id] = rec.Trace
+			spans := map[ID]*Trace{}
+			indexSpans(spans, rec.Trace)
+			data.Span[id] = spans
+		}
+	} else if err := gob.NewDecoder(br).Decode(&data); err != nil {
 		return 0, err
 	}
-	ms.trace = data.Trace
-	ms.span = data.Span
-	return int64(len(ms.trace)), nil
+
+	ms.lockAll()
+	defer ms.unlockAll()
+	for _, sh := range ms.shards {
+		sh.trace = map[ID]*Trace{}
+		sh.span = map[ID]map[ID]*Trace{}
+		sh.collected = map[ID]map[ID]int64{}
+		sh.start = map[ID]traceStart{}
+		sh.usage = map[ID]*traceUsage{}
+	}
+	ms.lruMu.Lock()
+	ms.lru = list.New()
+	ms.lruMu.Unlock()
+	atomic.StoreInt64(&ms.spans, 0)
+	atomic.StoreInt64(&ms.bytes, 0)
+	atomic.StoreInt64(&ms.traces, int64(len(data.Trace)))
+
+	// Collection times are not persisted, so treat every loaded span as
+	// having been collected now for the purpose of age-based eviction.
+	now := time.Now().UnixNano()
+	for id, t := range data.Trace {
+		sh := ms.shard(id)
+		sh.trace[id] = t
+		sh.span[id] = data.Span[id]
+		for _, st := range data.Span[id] {
+			sh.markCollectedNoLock(st.Span.ID, now)
+			sh.accountNoLock(id, 1, spanSize(st.Annotations))
+		}
+		sh.indexStartNoLock(t.Span.ID, t.Annotations)
+		sh.touchNoLock(id)
+	}
+	return int64(len(data.Trace)), nil
+}
+
+// indexSpans adds t and its descendants to spans, keyed by span ID.
+func indexSpans(spans map[ID]*Trace, t *Trace) {
+	t.Walk(func(t *Trace) error {
+		spans[t.Span.ID.Span] = t
+		return nil
+	})
 }
 
 // PersistentStore is a Store that can persist its data and read it
@@ -355,23 +1262,12 @@ type PersistentStore interface {
 	Store
 }
 
-// PersistEvery persists s's data to a file periodically.
+// PersistEvery persists s's data to a file periodically, using WriteFile.
+// Use ReadFile to load it.
 func PersistEvery(s PersistentStore, interval time.Duration, file string) error {
 	for {
 		time.Sleep(interval)
-
-		f, err := ioutil.TempFile("", "appdash")
-		if err != nil {
-			return err
-		}
-		if err := s.Write(f); err != nil {
-			f.Close()
-			return err
-		}
-		if err := f.Close(); err != nil {
-			return err
-		}
-		if err := os.Rename(f.Name(), file); err != nil {
+		if err := WriteFile(s, file); err != nil {
 			return err
 		}
 	}
@@ -385,6 +1281,28 @@ type DeleteStore interface {
 	Delete(...ID) error
 }
 
+// A BatchDeleteStore is a DeleteStore that can efficiently delete many
+// traces at once.
+type BatchDeleteStore interface {
+	DeleteStore
+
+	// DeleteTraces deletes traces given their trace IDs, and returns the
+	// number of traces that existed and were deleted.
+	DeleteTraces(...ID) (deleted int, err error)
+}
+
+// A TraceIterator is a Store that can iterate over all of its traces
+// without reading them all into memory at once, e.g. to export the store or
+// copy it to another one.
+type TraceIterator interface {
+	Store
+
+	// ForEachTrace calls f with each trace in the store, in no particular
+	// order. If f returns an error, iteration stops and ForEachTrace
+	// returns that error.
+	ForEachTrace(f func(*Trace) error) error
+}
+
 // A RecentStore wraps another store and deletes old traces after a
 // specified amount of time.
 type RecentStore struct {
@@ -398,13 +1316,55 @@ type RecentStore struct {
 	// Debug is whether to log debug messages.
 	Debug bool
 
+	// EvictInterval, if non-zero, is how often old traces are evicted by a
+	// background goroutine, which is started by the first call to Collect
+	// and stopped by Close. Collect then only records when each trace was
+	// first seen, keeping eviction off its path, and traces are evicted
+	// even when no new spans arrive.
+	//
+	// If zero, Collect itself evicts old traces, at most once every
+	// MinEvictAge, and no goroutine runs between calls.
+	EvictInterval time.Duration
+
+	// OnEvict, if set, is called with the IDs of the traces evicted because
+	// of their age, after they have been deleted from the underlying store
+	// (see EvictHook).
+	OnEvict EvictHook
+
+	// EvictPayloads is whether to read evicted traces from the underlying
+	// store just before deleting them, and pass them to OnEvict.
+	EvictPayloads bool
+
+	evictNotifier evictNotifier
+
 	// created maps trace ID to the UnixNano time it was first seen.
 	created map[ID]int64
 
 	// lastEvicted is the last time the eviction process was run.
 	lastEvicted time.Time
 
-	mu sync.Mutex // mu guards created and lastEvicted
+	// stop and done are the channels used to stop the background eviction
+	// goroutine, and that it closes when it exits. They are nil if it is not
+	// running.
+	stop, done chan struct{}
+	closed     bool // whether Close has been called
+
+	mu sync.Mutex // mu guards created, lastEvicted, stop, done and closed
+}
+
+// DefaultRecentEvictInterval is a suitable EvictInterval for the
+// RecentStores that must evict old traces even when no new spans arrive,
+// as `appdash serve` does.
+const DefaultRecentEvictInterval = time.Minute
+
+// NewRecentStore returns a RecentStore that evicts traces older than
+// minEvictAge from s. Like a RecentStore created as a struct literal, it
+// evicts them on Collect until EvictInterval is set.
+func NewRecentStore(s DeleteStore, minEvictAge time.Duration) *RecentStore {
+	return &RecentStore{
+		MinEvictAge: minEvictAge,
+		DeleteStore: s,
+	}
 }
 
 // Collect calls the underlying store's Collect and records the time
@@ -417,17 +1377,73 @@ func (rs *RecentStore) Collect(id SpanID, anns ...Annotation) error {
 	if _, present := rs.created[id.Trace]; !present {
 		rs.created[id.Trace] = time.Now().UnixNano()
 	}
-	if time.Since(rs.lastEvicted) > rs.MinEvictAge {
-		rs.evictBefore(time.Now().Add(-1 * rs.MinEvictAge))
+	if rs.EvictInterval > 0 {
+		if rs.stop == nil && !rs.closed {
+			rs.stop, rs.done = make(chan struct{}), make(chan struct{})
+			go rs.evictEvery(rs.EvictInterval, rs.stop, rs.done)
+		}
+	} else if time.Since(rs.lastEvicted) > rs.MinEvictAge {
+		before := time.Now().Add(-1 * rs.MinEvictAge)
+		if toEvict := rs.evictBefore(before); len(toEvict) > 0 {
+			// Spawn separate goroutine so we don't hold the rs.mu lock.
+			go rs.deleteTraces(toEvict, before)
+		}
 	}
 	rs.mu.Unlock()
 
 	return rs.DeleteStore.Collect(id, anns...)
 }
 
-// evictBefore evicts traces that were created before t. The rs.mu lock
-// must be held while calling evictBefore.
-func (rs *RecentStore) evictBefore(t time.Time) {
+// evictEvery evicts old traces every interval until stop is closed, and
+// then closes done.
+func (rs *RecentStore) evictEvery(interval time.Duration, stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		before := time.Now().Add(-1 * rs.MinEvictAge)
+		rs.mu.Lock()
+		toEvict := rs.evictBefore(before)
+		rs.mu.Unlock()
+		if len(toEvict) > 0 {
+			rs.deleteTraces(toEvict, before)
+		}
+	}
+}
+
+// Close stops the background eviction goroutine, if it is running, and
+// waits for it to exit. It does not close the underlying store. After Close,
+// Collect no longer evicts traces in the background, and OnEvict is no
+// longer called once the evictions already notified have been delivered.
+func (rs *RecentStore) Close() error {
+	rs.mu.Lock()
+	stop, done := rs.stop, rs.done
+	rs.stop, rs.done, rs.closed = nil, nil, true
+	rs.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+	rs.evictNotifier.close()
+	return nil
+}
+
+// DroppedEvictNotifications returns the number of evicted traces that
+// OnEvict was not called with because it fell too far behind.
+func (rs *RecentStore) DroppedEvictNotifications() int64 {
+	return rs.evictNotifier.droppedTraces()
+}
+
+// evictBefore removes the traces that were created before t from
+// rs.created and returns their IDs, which the caller must then delete from
+// the underlying store (see deleteTraces). The rs.mu lock must be held while
+// calling evictBefore.
+func (rs *RecentStore) evictBefore(t time.Time) []ID {
 	evictStart := time.Now()
 	rs.lastEvicted = evictStart
 	tnano := t.UnixNano()
@@ -438,24 +1454,68 @@ func (rs *RecentStore) evictBefore(t time.Time) {
 			delete(rs.created, id)
 		}
 	}
-	if len(toEvict) == 0 {
-		return
+	if len(toEvict) > 0 && rs.Debug {
+		log.Printf("RecentStore: deleting %d traces created before %s (age check took %s)", len(toEvict), t, time.Since(evictStart))
 	}
+	return toEvict
+}
 
+// deleteTraces deletes the given traces, which were created before t, from
+// the underlying store.
+func (rs *RecentStore) deleteTraces(toEvict []ID, t time.Time) {
+	deleteStart := time.Now()
+	var payloads []*Trace
+	if rs.OnEvict != nil && rs.EvictPayloads {
+		payloads = readTraces(rs.DeleteStore, toEvict)
+	}
+	var err error
+	if bds, ok := rs.DeleteStore.(BatchDeleteStore); ok {
+		_, err = bds.DeleteTraces(toEvict...)
+	} else {
+		err = rs.DeleteStore.Delete(toEvict...)
+	}
+	if err != nil {
+		log.Printf("RecentStore: failed to delete traces: %s", err)
+	} else if rs.OnEvict != nil {
+		rs.evictNotifier.notify(rs.OnEvict, toEvict, payloads)
+	}
 	if rs.Debug {
-		log.Printf("RecentStore: deleting %d traces created before %s (age check took %s)", len(toEvict), t, time.Since(evictStart))
+		log.Printf("RecentStore: finished deleting %d traces created before %s (took %s)", len(toEvict), t, time.Since(deleteStart))
 	}
+}
 
-	// Spawn separate goroutine so we don't hold the rs.mu lock.
-	go func() {
-		deleteStart := time.Now()
-		if err := rs.DeleteStore.Delete(toEvict...); err != nil {
-			log.Printf("RecentStore: failed to delete traces: %s", err)
-		}
-		if rs.Debug {
-			log.Printf("RecentStore: finished deleting %d traces created before %s (took %s)", len(toEvict), t, time.Since(deleteStart))
-		}
-	}()
+// Traces implements the Queryer interface by calling the underlying store's
+// Traces method. It returns an error if the underlying store does not
+// implement Queryer.
+func (rs *RecentStore) Traces(opts TracesOpts) ([]*Trace, error) {
+	return queryTraces(rs.DeleteStore, opts)
+}
+
+// containsTrace implements the traceContainer interface for the underlying
+// store.
+func (rs *RecentStore) containsTrace(id ID) bool {
+	return containsTrace(rs.DeleteStore, id)
+}
+
+// Aggregate implements the Aggregator interface by calling the underlying
+// store's Aggregate method. It returns an error if the underlying store does
+// not implement Aggregator.
+func (rs *RecentStore) Aggregate(start, end time.Duration) ([]*AggregatedResult, error) {
+	return aggregate(rs.DeleteStore, start, end)
+}
+
+// NumTraces implements the Counter interface by calling the underlying
+// store's NumTraces method. It returns an error if the underlying store
+// does not implement Counter.
+func (rs *RecentStore) NumTraces() (int, error) {
+	return numTraces(rs.DeleteStore)
+}
+
+// NumSpans implements the Counter interface by calling the underlying
+// store's NumSpans method. It returns an error if the underlying store does
+// not implement Counter.
+func (rs *RecentStore) NumSpans() (int, error) {
+	return numSpans(rs.DeleteStore)
 }
 
 // A LimitStore wraps another store and deletes the oldest trace when
@@ -464,15 +1524,48 @@ type LimitStore struct {
 	// Max is the maximum number of traces that the store should keep.
 	Max int
 
+	// MaxSpansPerTrace, if non-zero, is the maximum number of spans that the
+	// store should keep per trace. Once a trace has reached it, new spans of
+	// the trace are dropped (while the root span and spans already collected
+	// still accept annotations), and the trace's root span is annotated with
+	// TraceTruncatedKey.
+	MaxSpansPerTrace int
+
 	// DeleteStore is the underlying store that spans are saved to and
 	// deleted from.
 	DeleteStore
 
+	// OnEvict, if set, is called with the IDs of the traces evicted because
+	// the store reached its capacity, after they have been deleted from the
+	// underlying store (see EvictHook).
+	OnEvict EvictHook
+
+	// EvictPayloads is whether to read evicted traces from the underlying
+	// store just before deleting them, and pass them to OnEvict.
+	EvictPayloads bool
+
+	evictNotifier evictNotifier
+
 	mu            sync.Mutex
 	traces        map[ID]struct{} // set of traces to quickly determine which traces exist in ring already.
 	ring          []int64         // ring is a circular list of trace IDs in insertion order.
 	nextInsertIdx int             // nextInsertIdx is the ring index for the next insertion.
 
+	spans   map[ID]*limitTrace // trace ID -> spans collected (only if MaxSpansPerTrace is set)
+	dropped int64              // number of spans dropped due to MaxSpansPerTrace
+}
+
+// TraceTruncatedKey is the key of the annotation that LimitStore adds to the
+// root span of traces that some spans were dropped from, with the value
+// "true".
+const TraceTruncatedKey = "Trace.Truncated"
+
+// limitTrace records the spans of a trace collected by a LimitStore.
+type limitTrace struct {
+	spans     map[ID]struct{} // IDs of the spans collected
+	root      ID              // root span ID, if collected
+	truncated bool            // whether any spans were dropped
+	marked    bool            // whether the root span was annotated as truncated
 }
 
 // Collect calls the underlying store's Collect, deleting the oldest
@@ -491,22 +1584,266 @@ func (ls *LimitStore) Collect(id SpanID, anns ...Annotation) error {
 	// Check if the trace already exists in the ring. Otherwise, we would evict
 	// an old trace upon each annotation collection, rather than upon each new
 	// trace.
-	if _, ok := ls.traces[id.Trace]; ok {
-		return ls.DeleteStore.Collect(id, anns...)
+	if _, ok := ls.traces[id.Trace]; !ok {
+		if nextInsert := ls.ring[ls.nextInsertIdx]; nextInsert != 0 {
+			// Store is at capacity (we know this because the next insert
+			// slot already contains trace); delete oldest.
+			old := ID(ls.ring[ls.nextInsertIdx])
+			delete(ls.traces, old)
+			delete(ls.spans, old)
+			var payloads []*Trace
+			if ls.OnEvict != nil && ls.EvictPayloads {
+				payloads = readTraces(ls.DeleteStore, []ID{old})
+			}
+			if err := ls.DeleteStore.Delete(old); err != nil {
+				return err
+			}
+			if ls.OnEvict != nil {
+				ls.evictNotifier.notify(ls.OnEvict, []ID{old}, payloads)
+			}
+		}
+		ls.traces[id.Trace] = struct{}{}
+		ls.ring[ls.nextInsertIdx] = int64(id.Trace)
+		ls.nextInsertIdx = (ls.nextInsertIdx + 1) % ls.Max // increment & wrap
 	}
 
-	if nextInsert := ls.ring[ls.nextInsertIdx]; nextInsert != 0 {
-		// Store is at capacity (we know this because the next insert
-		// slot already contains trace); delete oldest.
-		old := ID(ls.ring[ls.nextInsertIdx])
-		delete(ls.traces, old)
-		if err := ls.DeleteStore.Delete(old); err != nil {
-			return err
+	if ls.MaxSpansPerTrace > 0 {
+		return ls.collectLimitedNoLock(id, anns...)
+	}
+	return ls.DeleteStore.Collect(id, anns...)
+}
+
+// collectLimitedNoLock calls the underlying store's Collect unless the span
+// is a new span of a trace that already has MaxSpansPerTrace spans. The
+// ls.mu lock must be held while calling collectLimitedNoLock.
+func (ls *LimitStore) collectLimitedNoLock(id SpanID, anns ...Annotation) error {
+	if ls.spans == nil {
+		ls.spans = map[ID]*limitTrace{}
+	}
+	lt, ok := ls.spans[id.Trace]
+	if !ok {
+		lt = &limitTrace{spans: map[ID]struct{}{}}
+		ls.spans[id.Trace] = lt
+	}
+	if _, seen := lt.spans[id.Span]; !seen {
+		if !id.IsRoot() && len(lt.spans) >= ls.MaxSpansPerTrace {
+			ls.dropped++
+			lt.truncated = true
+			return ls.markTruncatedNoLock(id.Trace, lt)
 		}
+		lt.spans[id.Span] = struct{}{}
 	}
-	ls.traces[id.Trace] = struct{}{}
-	ls.ring[ls.nextInsertIdx] = int64(id.Trace)
-	ls.nextInsertIdx = (ls.nextInsertIdx + 1) % ls.Max // increment & wrap
+	if id.IsRoot() {
+		lt.root = id.Span
+	}
+	if err := ls.DeleteStore.Collect(id, anns...); err != nil {
+		return err
+	}
+	return ls.markTruncatedNoLock(id.Trace, lt)
+}
 
-	return ls.DeleteStore.Collect(id, anns...)
+// markTruncatedNoLock annotates the root span of a trace that spans were
+// dropped from, once both have happened. The ls.mu lock must be held while
+// calling markTruncatedNoLock.
+func (ls *LimitStore) markTruncatedNoLock(trace ID, lt *limitTrace) error {
+	if !lt.truncated || lt.marked || lt.root == 0 {
+		return nil
+	}
+	lt.marked = true
+	return ls.DeleteStore.Collect(SpanID{Trace: trace, Span: lt.root}, Annotation{Key: TraceTruncatedKey, Value: []byte("true")})
+}
+
+// DroppedSpans returns the number of spans that were dropped because their
+// trace had reached MaxSpansPerTrace spans.
+func (ls *LimitStore) DroppedSpans() int64 {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	return ls.dropped
+}
+
+// DroppedEvictNotifications returns the number of evicted traces that
+// OnEvict was not called with because it fell too far behind.
+func (ls *LimitStore) DroppedEvictNotifications() int64 {
+	return ls.evictNotifier.droppedTraces()
+}
+
+// Traces implements the Queryer interface by calling the underlying store's
+// Traces method. It returns an error if the underlying store does not
+// implement Queryer.
+func (ls *LimitStore) Traces(opts TracesOpts) ([]*Trace, error) {
+	return queryTraces(ls.DeleteStore, opts)
+}
+
+// containsTrace implements the traceContainer interface for the underlying
+// store.
+func (ls *LimitStore) containsTrace(id ID) bool {
+	return containsTrace(ls.DeleteStore, id)
+}
+
+// Aggregate implements the Aggregator interface by calling the underlying
+// store's Aggregate method. It returns an error if the underlying store does
+// not implement Aggregator.
+func (ls *LimitStore) Aggregate(start, end time.Duration) ([]*AggregatedResult, error) {
+	return aggregate(ls.DeleteStore, start, end)
+}
+
+// NumTraces implements the Counter interface by calling the underlying
+// store's NumTraces method. It returns an error if the underlying store
+// does not implement Counter.
+func (ls *LimitStore) NumTraces() (int, error) {
+	return numTraces(ls.DeleteStore)
+}
+
+// NumSpans implements the Counter interface by calling the underlying
+// store's NumSpans method. It returns an error if the underlying store does
+// not implement Counter.
+func (ls *LimitStore) NumSpans() (int, error) {
+	return numSpans(ls.DeleteStore)
+}
+
+// Compile-time "implements" checks.
+var (
+	_ interface {
+		DeleteStore
+		Queryer
+		Aggregator
+		Counter
+	} = (*RecentStore)(nil)
+	_ interface {
+		DeleteStore
+		Queryer
+		Aggregator
+		Counter
+	} = (*LimitStore)(nil)
+)
+
+// An EvictHook is called by a RecentStore or LimitStore with the IDs of the
+// traces it evicted. If the store's EvictPayloads field is set, traces holds
+// the evicted traces, as read just before they were deleted (with nil
+// entries for traces that could not be read); otherwise it is nil.
+//
+// Hooks are called from a separate goroutine, never while the store's lock
+// is held, one batch of evicted traces at a time. Up to evictQueueSize
+// batches are queued while a hook runs; beyond that, batches are dropped
+// rather than holding up eviction, and counted by the store's
+// DroppedEvictNotifications method.
+type EvictHook func(ids []ID, traces []*Trace)
+
+// evictQueueSize is the number of batches of evicted traces queued for an
+// EvictHook.
+const evictQueueSize = 64
+
+type evictBatch struct {
+	ids    []ID
+	traces []*Trace
+}
+
+// An evictNotifier calls an EvictHook from its own goroutine, which is
+// started on the first notification.
+type evictNotifier struct {
+	mu      sync.Mutex
+	ch      chan evictBatch
+	closed  bool
+	dropped int64 // number of traces in dropped batches
+}
+
+// notify queues a call of f with the given batch, or drops it if the queue
+// is full.
+func (n *evictNotifier) notify(f EvictHook, ids []ID, traces []*Trace) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return
+	}
+	if n.ch == nil {
+		n.ch = make(chan evictBatch, evictQueueSize)
+		go func(ch <-chan evictBatch) {
+			for b := range ch {
+				f(b.ids, b.traces)
+			}
+		}(n.ch)
+	}
+	select {
+	case n.ch <- evictBatch{ids: ids, traces: traces}:
+	default:
+		n.dropped += int64(len(ids))
+	}
+}
+
+// close stops the goroutine once it has delivered the queued batches.
+func (n *evictNotifier) close() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.ch != nil && !n.closed {
+		close(n.ch)
+	}
+	n.closed = true
+}
+
+func (n *evictNotifier) droppedTraces() int64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.dropped
+}
+
+// readTraces reads the given traces from s, leaving nil entries for traces
+// that could not be read.
+func readTraces(s Store, ids []ID) []*Trace {
+	traces := make([]*Trace, len(ids))
+	for i, id := range ids {
+		traces[i], _ = s.Trace(id)
+	}
+	return traces
+}
+
+// queryTraces calls s's Traces method, for stores that wrap another store.
+func queryTraces(s Store, opts TracesOpts) ([]*Trace, error) {
+	q, ok := s.(Queryer)
+	if !ok {
+		return nil, fmt.Errorf("appdash: %T does not implement Queryer", s)
+	}
+	return q.Traces(opts)
+}
+
+// aggregate calls s's Aggregate method, for stores that wrap another store.
+func aggregate(s Store, start, end time.Duration) ([]*AggregatedResult, error) {
+	a, ok := s.(Aggregator)
+	if !ok {
+		return nil, fmt.Errorf("appdash: %T does not implement Aggregator", s)
+	}
+	return a.Aggregate(start, end)
+}
+
+// A traceContainer is a store that reports whether it holds a trace
+// cheaply, without reading it (see containsTrace).
+type traceContainer interface {
+	containsTrace(ID) bool
+}
+
+// containsTrace reports whether s holds the trace: cheaply if it is a
+// traceContainer, and by reading the trace otherwise.
+func containsTrace(s Store, id ID) bool {
+	if c, ok := s.(traceContainer); ok {
+		return c.containsTrace(id)
+	}
+	_, err := s.Trace(id)
+	return err != ErrTraceNotFound
+}
+
+// numTraces calls s's NumTraces method, for stores that wrap another store.
+func numTraces(s Store) (int, error) {
+	c, ok := s.(Counter)
+	if !ok {
+		return 0, fmt.Errorf("appdash: %T does not implement Counter", s)
+	}
+	return c.NumTraces()
+}
+
+// numSpans calls s's NumSpans method, for stores that wrap another store.
+func numSpans(s Store) (int, error) {
+	c, ok := s.(Counter)
+	if !ok {
+		return 0, fmt.Errorf("appdash: %T does not implement Counter", s)
+	}
+	return c.NumSpans()
 }
@@ -0,0 +1,14 @@
+package appdash_test
+
+import (
+	"testing"
+
+	"sourcegraph.com/sourcegraph/appdash"
+	"sourcegraph.com/sourcegraph/appdash/internal/storetest"
+)
+
+func TestMemoryStore_conformance(t *testing.T) {
+	storetest.Test(t, func(t *testing.T) appdash.Store {
+		return appdash.NewMemoryStore()
+	})
+}
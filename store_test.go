@@ -2,6 +2,8 @@ package appdash
 
 import (
 	"bytes"
+	"compress/gzip"
+	"encoding/gob"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -10,6 +12,8 @@ import (
 	"reflect"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -26,22 +30,69 @@ func TestMemoryStore_Collect_one(t *testing.T) {
 	ms := storeT{t, NewMemoryStore()}
 
 	t.Log("collect trace 1")
-	ms.MustCollect(SpanID{1, 1, 0})
-	want1 := &Trace{Span: Span{ID: SpanID{1, 1, 0}}}
+	ms.MustCollect(SpanID{Trace: 1, Span: 1, Parent: 0})
+	want1 := &Trace{Span: Span{ID: SpanID{Trace: 1, Span: 1, Parent: 0}}}
 	if x := ms.MustTrace(1); !reflect.DeepEqual(x, want1) {
 		t.Errorf("Trace(1): got trace %+v, want %+v", x, want1)
 	}
 }
 
+func TestMemoryStore_Collect_128BitTraceID(t *testing.T) {
+	ms := storeT{t, NewMemoryStore()}
+
+	root := SpanID{Trace: 1, TraceHigh: 9, Span: 1}
+	child := SpanID{Trace: 1, TraceHigh: 9, Span: 2, Parent: 1}
+	ms.MustCollect(root)
+	ms.MustCollect(child)
+	want := &Trace{
+		Span: Span{ID: root},
+		Sub:  []*Trace{{Span: Span{ID: child}}},
+	}
+	if x := ms.MustTrace(1); !reflect.DeepEqual(x, want) {
+		t.Errorf("Trace(1): got trace %+v, want %+v", x, want)
+	}
+
+	// The high bits survive persistence.
+	var buf bytes.Buffer
+	if err := ms.Store.(*MemoryStore).Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	ms2 := NewMemoryStore()
+	if _, err := ms2.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if x, err := ms2.Trace(1); err != nil || !reflect.DeepEqual(x, want) {
+		t.Errorf("Trace(1) after ReadFrom: got trace %+v (error %v), want %+v", x, err, want)
+	}
+}
+
+func TestMemoryStore_Collect_128BitTraceIDSameLowBits(t *testing.T) {
+	ms := storeT{t, NewMemoryStore()}
+
+	// Traces are keyed by the low 64 bits of their IDs only (see
+	// Use128BitTraceIDs), so these spans of two traces are merged.
+	root := SpanID{Trace: 1, Span: 1, TraceHigh: 9}
+	other := SpanID{Trace: 1, Span: 2, Parent: 1, TraceHigh: 8}
+	ms.MustCollect(root)
+	ms.MustCollect(other)
+	want := &Trace{
+		Span: Span{ID: root},
+		Sub:  []*Trace{{Span: Span{ID: other}}},
+	}
+	if x := ms.MustTrace(1); !reflect.DeepEqual(x, want) {
+		t.Errorf("Trace(1): got trace %+v, want %+v", x, want)
+	}
+}
+
 func TestMemoryStore_Collect_collectSameTwice(t *testing.T) {
 	ms := storeT{t, NewMemoryStore()}
 
 	t.Log("collect trace 1")
-	ms.MustCollect(SpanID{1, 1, 0})
+	ms.MustCollect(SpanID{Trace: 1, Span: 1, Parent: 0})
 
 	t.Log("collect trace 1 again")
-	ms.MustCollect(SpanID{1, 1, 0})
-	want1 := &Trace{Span: Span{ID: SpanID{1, 1, 0}}}
+	ms.MustCollect(SpanID{Trace: 1, Span: 1, Parent: 0})
+	want1 := &Trace{Span: Span{ID: SpanID{Trace: 1, Span: 1, Parent: 0}}}
 	if x := ms.MustTrace(1); !reflect.DeepEqual(x, want1) {
 		t.Errorf("Trace(1): got trace %+v, want %+v", x, want1)
 	}
@@ -51,15 +102,15 @@ func TestMemoryStore_Collect_collectSameChildTwice(t *testing.T) {
 	ms := storeT{t, NewMemoryStore()}
 
 	t.Log("collect trace 1")
-	ms.MustCollect(SpanID{1, 1, 0})
+	ms.MustCollect(SpanID{Trace: 1, Span: 1, Parent: 0})
 
 	t.Log("collect trace 2")
-	ms.MustCollect(SpanID{1, 2, 1}, Annotation{Key: "k1"})
-	ms.MustCollect(SpanID{1, 2, 1}, Annotation{Key: "k2"})
+	ms.MustCollect(SpanID{Trace: 1, Span: 2, Parent: 1}, Annotation{Key: "k1"})
+	ms.MustCollect(SpanID{Trace: 1, Span: 2, Parent: 1}, Annotation{Key: "k2"})
 	want1 := &Trace{
-		Span: Span{ID: SpanID{1, 1, 0}},
+		Span: Span{ID: SpanID{Trace: 1, Span: 1, Parent: 0}},
 		Sub: []*Trace{
-			{Span: Span{SpanID{1, 2, 1}, Annotations{{Key: "k1"}, {Key: "k2"}}}},
+			{Span: Span{SpanID{Trace: 1, Span: 2, Parent: 1}, Annotations{{Key: "k1"}, {Key: "k2"}}}},
 		},
 	}
 	if x := ms.MustTrace(1); !reflect.DeepEqual(x, want1) {
@@ -71,16 +122,16 @@ func TestMemoryStore_Collect_collectTwo(t *testing.T) {
 	ms := storeT{t, NewMemoryStore()}
 
 	t.Log("collect trace 1")
-	ms.MustCollect(SpanID{1, 1, 0})
+	ms.MustCollect(SpanID{Trace: 1, Span: 1, Parent: 0})
 
 	t.Log("collect trace 2")
-	ms.MustCollect(SpanID{2, 1, 0})
-	want2 := &Trace{Span: Span{ID: SpanID{2, 1, 0}}}
+	ms.MustCollect(SpanID{Trace: 2, Span: 1, Parent: 0})
+	want2 := &Trace{Span: Span{ID: SpanID{Trace: 2, Span: 1, Parent: 0}}}
 	if x := ms.MustTrace(2); !reflect.DeepEqual(x, want2) {
 		t.Errorf("Trace(2): got trace %+v, want %+v", x, want2)
 	}
 
-	want1 := &Trace{Span: Span{ID: SpanID{1, 1, 0}}}
+	want1 := &Trace{Span: Span{ID: SpanID{Trace: 1, Span: 1, Parent: 0}}}
 	if x := ms.MustTrace(1); !reflect.DeepEqual(x, want1) {
 		t.Errorf("Trace(1): got trace %+v, want %+v", x, want1)
 	}
@@ -93,16 +144,16 @@ func TestMemoryStore_Collect_oneChild(t *testing.T) {
 	ms := storeT{t, NewMemoryStore()}
 
 	t.Log("collect trace 1")
-	ms.MustCollect(SpanID{1, 1, 0})
+	ms.MustCollect(SpanID{Trace: 1, Span: 1, Parent: 0})
 
 	t.Log("collect trace 1 child")
-	ms.MustCollect(SpanID{1, 2, 1})
+	ms.MustCollect(SpanID{Trace: 1, Span: 2, Parent: 1})
 
 	want1 := &Trace{
-		Span: Span{ID: SpanID{1, 1, 0}},
+		Span: Span{ID: SpanID{Trace: 1, Span: 1, Parent: 0}},
 		Sub: []*Trace{
 			{
-				Span: Span{ID: SpanID{1, 2, 1}},
+				Span: Span{ID: SpanID{Trace: 1, Span: 2, Parent: 1}},
 			},
 		},
 	}
@@ -116,21 +167,22 @@ func TestMemoryStore_deleteSubNoLock(t *testing.T) {
 	ms := storeT{t, s}
 
 	// Collect trace / root span.
-	ms.MustCollect(SpanID{1, 1, 0})
+	ms.MustCollect(SpanID{Trace: 1, Span: 1, Parent: 0})
 
 	// Collect child span.
-	childSpanID := SpanID{1, 2, 1}
+	childSpanID := SpanID{Trace: 1, Span: 2, Parent: 1}
 	ms.MustCollect(childSpanID)
 
 	// Validate that removal of the child span functions properly.
-	s.Lock()
-	if !s.deleteSubNoLock(childSpanID, false) {
+	sh := s.shard(1)
+	sh.Lock()
+	if !sh.deleteSubNoLock(childSpanID, false) {
 		t.Fatal("failed to delete subspan")
 	}
-	s.Unlock()
+	sh.Unlock()
 
 	want1 := &Trace{
-		Span: Span{ID: SpanID{1, 1, 0}},
+		Span: Span{ID: SpanID{Trace: 1, Span: 1, Parent: 0}},
 		Sub:  []*Trace{},
 	}
 	if x := ms.MustTrace(1); !reflect.DeepEqual(x, want1) {
@@ -142,20 +194,20 @@ func TestMemoryStore_Collect_childCollectedBeforeRoot(t *testing.T) {
 	ms := storeT{t, NewMemoryStore()}
 
 	t.Log("collect trace 1 child")
-	ms.MustCollect(SpanID{1, 2, 1})
-	want1 := &Trace{Span: Span{ID: SpanID{1, 2, 1}}}
+	ms.MustCollect(SpanID{Trace: 1, Span: 2, Parent: 1})
+	want1 := &Trace{Span: Span{ID: SpanID{Trace: 1, Span: 2, Parent: 1}}}
 	if x := ms.MustTrace(1); !reflect.DeepEqual(x, want1) {
 		t.Errorf("Trace(1): got trace %+v, want %+v", x, want1)
 	}
 
 	t.Log("collect trace 1 root")
-	ms.MustCollect(SpanID{1, 1, 0})
+	ms.MustCollect(SpanID{Trace: 1, Span: 1, Parent: 0})
 
 	want1 = &Trace{
-		Span: Span{ID: SpanID{1, 1, 0}},
+		Span: Span{ID: SpanID{Trace: 1, Span: 1, Parent: 0}},
 		Sub: []*Trace{
 			{
-				Span: Span{ID: SpanID{1, 2, 1}},
+				Span: Span{ID: SpanID{Trace: 1, Span: 2, Parent: 1}},
 			},
 		},
 	}
@@ -168,19 +220,19 @@ func TestMemoryStore_Collect_childrenCollectedInReverse(t *testing.T) {
 	ms := storeT{t, NewMemoryStore()}
 
 	t.Log("collect trace 1 child 4")
-	ms.MustCollect(SpanID{1, 4, 3})
-	want4 := &Trace{Span: Span{ID: SpanID{1, 4, 3}}}
+	ms.MustCollect(SpanID{Trace: 1, Span: 4, Parent: 3})
+	want4 := &Trace{Span: Span{ID: SpanID{Trace: 1, Span: 4, Parent: 3}}}
 	if x := ms.MustTrace(1); !reflect.DeepEqual(x, want4) {
 		t.Errorf("Trace(1): got trace %+v, want %+v", x, want4)
 	}
 
 	t.Log("collect trace 1 child 3")
-	ms.MustCollect(SpanID{1, 3, 2})
+	ms.MustCollect(SpanID{Trace: 1, Span: 3, Parent: 2})
 	want3 := &Trace{
-		Span: Span{ID: SpanID{1, 3, 2}},
+		Span: Span{ID: SpanID{Trace: 1, Span: 3, Parent: 2}},
 		Sub: []*Trace{
 			{
-				Span: Span{ID: SpanID{1, 4, 3}},
+				Span: Span{ID: SpanID{Trace: 1, Span: 4, Parent: 3}},
 			},
 		},
 	}
@@ -189,15 +241,15 @@ func TestMemoryStore_Collect_childrenCollectedInReverse(t *testing.T) {
 	}
 
 	t.Log("collect trace 1 child 2")
-	ms.MustCollect(SpanID{1, 2, 1})
+	ms.MustCollect(SpanID{Trace: 1, Span: 2, Parent: 1})
 	want2 := &Trace{
-		Span: Span{ID: SpanID{1, 2, 1}},
+		Span: Span{ID: SpanID{Trace: 1, Span: 2, Parent: 1}},
 		Sub: []*Trace{
 			{
-				Span: Span{ID: SpanID{1, 3, 2}},
+				Span: Span{ID: SpanID{Trace: 1, Span: 3, Parent: 2}},
 				Sub: []*Trace{
 					{
-						Span: Span{ID: SpanID{1, 4, 3}},
+						Span: Span{ID: SpanID{Trace: 1, Span: 4, Parent: 3}},
 					},
 				},
 			},
@@ -208,19 +260,19 @@ func TestMemoryStore_Collect_childrenCollectedInReverse(t *testing.T) {
 	}
 
 	t.Log("collect trace 1 root")
-	ms.MustCollect(SpanID{1, 1, 0})
+	ms.MustCollect(SpanID{Trace: 1, Span: 1, Parent: 0})
 
 	want1 := &Trace{
-		Span: Span{ID: SpanID{1, 1, 0}},
+		Span: Span{ID: SpanID{Trace: 1, Span: 1, Parent: 0}},
 		Sub: []*Trace{
 			{
-				Span: Span{ID: SpanID{1, 2, 1}},
+				Span: Span{ID: SpanID{Trace: 1, Span: 2, Parent: 1}},
 				Sub: []*Trace{
 					{
-						Span: Span{ID: SpanID{1, 3, 2}},
+						Span: Span{ID: SpanID{Trace: 1, Span: 3, Parent: 2}},
 						Sub: []*Trace{
 							{
-								Span: Span{ID: SpanID{1, 4, 3}},
+								Span: Span{ID: SpanID{Trace: 1, Span: 4, Parent: 3}},
 							},
 						},
 					},
@@ -247,7 +299,7 @@ func TestMemoryStore_Collect_fuzz(t *testing.T) {
 		if i != 0 {
 			parent = ID(rand.Intn(n) + 1)
 		}
-		spanIDs[i] = SpanID{1, ID(i + 1), parent}
+		spanIDs[i] = SpanID{Trace: 1, Span: ID(i + 1), Parent: parent}
 	}
 
 	t.Logf("collecting %d spans, checking for errors and panics", n)
@@ -256,7 +308,7 @@ func TestMemoryStore_Collect_fuzz(t *testing.T) {
 	}
 
 	x := ms.MustTrace(1)
-	if want := (SpanID{1, 1, 0}); x.Span.ID != want {
+	if want := (SpanID{Trace: 1, Span: 1, Parent: 0}); x.Span.ID != want {
 		t.Errorf("Trace(1): got SpanID %+v, want %+v", x.Span.ID, want)
 	}
 }
@@ -299,7 +351,7 @@ func TestMemoryStore_Collect_traceTreeRearrangement(t *testing.T) {
 				} else {
 					parent = ID(n / 2) // fixed parent
 				}
-				id := SpanID{1, ID(j + 1), parent}
+				id := SpanID{Trace: 1, Span: ID(j + 1), Parent: parent}
 				spanIDs[perm[j]] = id
 				traces[id.Span] = &Trace{Span: Span{ID: id}}
 			}
@@ -347,8 +399,8 @@ func TestRecentStore(t *testing.T) {
 	ms := NewMemoryStore()
 	rs := &storeT{t, &RecentStore{DeleteStore: ms, MinEvictAge: age}}
 
-	rs.MustCollect(SpanID{1, 2, 3})
-	rs.MustCollect(SpanID{2, 3, 4})
+	rs.MustCollect(SpanID{Trace: 1, Span: 2, Parent: 3})
+	rs.MustCollect(SpanID{Trace: 2, Span: 3, Parent: 4})
 
 	traces, _ := ms.Traces(TracesOpts{})
 	if len(traces) != 2 {
@@ -356,17 +408,187 @@ func TestRecentStore(t *testing.T) {
 	}
 
 	time.Sleep(2 * age)
-	rs.MustCollect(SpanID{3, 4, 5})
+	rs.MustCollect(SpanID{Trace: 3, Span: 4, Parent: 5})
 	time.Sleep(2 * age)
 	traces, _ = ms.Traces(TracesOpts{})
 	if len(traces) != 1 {
 		t.Errorf("got traces %v, want %d total", traces, 1)
 	}
-	if trace, want := traces[0].ID, (SpanID{3, 4, 5}); trace != want {
+	if trace, want := traces[0].ID, (SpanID{Trace: 3, Span: 4, Parent: 5}); trace != want {
 		t.Errorf("got trace %v, want %v", trace, want)
 	}
 }
 
+func TestNewRecentStore(t *testing.T) {
+	const age = time.Millisecond * 10
+
+	// Without an EvictInterval, traces are evicted on Collect, and no
+	// goroutine is started.
+	ms := NewMemoryStore()
+	s := NewRecentStore(ms, age)
+	rs := &storeT{t, s}
+
+	rs.MustCollect(SpanID{Trace: 1, Span: 2, Parent: 3})
+	time.Sleep(2 * age)
+	rs.MustCollect(SpanID{Trace: 2, Span: 3, Parent: 4})
+	time.Sleep(2 * age)
+	if u := ms.Usage(); u.Traces != 1 {
+		t.Errorf("got %d traces, want 1", u.Traces)
+	}
+	s.mu.Lock()
+	running := s.stop != nil
+	s.mu.Unlock()
+	if running {
+		t.Error("got the eviction goroutine running, want none")
+	}
+}
+
+func TestRecentStore_EvictInterval(t *testing.T) {
+	const age = time.Millisecond * 10
+
+	ms := NewMemoryStore()
+	s := NewRecentStore(ms, age)
+	s.EvictInterval = age
+	rs := &storeT{t, s}
+
+	rs.MustCollect(SpanID{Trace: 1, Span: 2, Parent: 3})
+	rs.MustCollect(SpanID{Trace: 2, Span: 3, Parent: 4})
+
+	// Traces are evicted without any further calls to Collect.
+	deadline := time.Now().Add(time.Second)
+	for {
+		if u := ms.Usage(); u.Traces == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d traces, want all evicted", ms.Usage().Traces)
+		}
+		time.Sleep(age)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// No longer evicted once closed.
+	rs.MustCollect(SpanID{Trace: 3, Span: 4, Parent: 5})
+	time.Sleep(4 * age)
+	if u := ms.Usage(); u.Traces != 1 {
+		t.Errorf("got %d traces after Close, want 1", u.Traces)
+	}
+}
+
+// evictRecorder records the calls of an EvictHook.
+type evictRecorder struct {
+	mu     sync.Mutex
+	count  map[ID]int
+	traces map[ID]*Trace
+}
+
+func (r *evictRecorder) hook(ids []ID, traces []*Trace) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.count == nil {
+		r.count, r.traces = map[ID]int{}, map[ID]*Trace{}
+	}
+	for i, id := range ids {
+		r.count[id]++
+		if traces != nil {
+			r.traces[id] = traces[i]
+		}
+	}
+}
+
+// wait waits until n traces have been evicted, and returns how many times
+// each was.
+func (r *evictRecorder) wait(t *testing.T, n int) map[ID]int {
+	deadline := time.Now().Add(time.Second)
+	for {
+		r.mu.Lock()
+		got := len(r.count)
+		r.mu.Unlock()
+		if got >= n || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond) // catch extra calls
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.count
+}
+
+func TestRecentStore_OnEvict(t *testing.T) {
+	const age = time.Millisecond * 10
+
+	var r evictRecorder
+	s := NewRecentStore(NewMemoryStore(), age)
+	s.EvictInterval = age
+	s.OnEvict = r.hook
+	s.EvictPayloads = true
+	defer s.Close()
+	rs := &storeT{t, s}
+
+	rs.MustCollect(SpanID{Trace: 1, Span: 1, Parent: 0})
+	rs.MustCollect(SpanID{Trace: 2, Span: 2, Parent: 0})
+	rs.MustCollect(SpanID{Trace: 2, Span: 3, Parent: 2})
+
+	if got, want := r.wait(t, 2), map[ID]int{1: 1, 2: 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got evictions %v, want %v", got, want)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if tr := r.traces[2]; tr == nil || len(tr.Sub) != 1 {
+		t.Errorf("got evicted trace %v, want trace 2 with 1 child", tr)
+	}
+}
+
+func TestLimitStore_OnEvict(t *testing.T) {
+	var r evictRecorder
+	s := &LimitStore{DeleteStore: NewMemoryStore(), Max: 2, OnEvict: r.hook, EvictPayloads: true}
+	ls := &storeT{t, s}
+	for i := ID(1); i <= 5; i++ {
+		ls.MustCollect(SpanID{Trace: i, Span: i, Parent: 0})
+		ls.MustCollect(SpanID{Trace: i, Span: i + 100, Parent: i})
+	}
+
+	if got, want := r.wait(t, 3), map[ID]int{1: 1, 2: 1, 3: 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got evictions %v, want %v", got, want)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, tr := range r.traces {
+		if tr == nil || tr.Span.ID.Trace != id || len(tr.Sub) != 1 {
+			t.Errorf("got evicted trace %v, want trace %v with 1 child", tr, id)
+		}
+	}
+	if n := s.DroppedEvictNotifications(); n != 0 {
+		t.Errorf("got %d dropped notifications, want 0", n)
+	}
+}
+
+func TestLimitStore_OnEvict_slow(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	s := &LimitStore{DeleteStore: NewMemoryStore(), Max: 1, OnEvict: func([]ID, []*Trace) { <-block }}
+
+	// Eviction isn't held up by a hook that doesn't return.
+	n := evictQueueSize + 10
+	for i := 1; i <= n+1; i++ {
+		if err := s.Collect(SpanID{Trace: ID(i), Span: 1, Parent: 0}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// evictQueueSize batches are queued, plus one being delivered if the
+	// hook's goroutine got to run.
+	if got, max := s.DroppedEvictNotifications(), int64(n-evictQueueSize); got < max-1 || got > max {
+		t.Errorf("got %d dropped notifications, want %d or %d", got, max-1, max)
+	}
+}
+
 func TestLimitStore(t *testing.T) {
 	const age = time.Millisecond * 10
 
@@ -377,20 +599,20 @@ func TestLimitStore(t *testing.T) {
 		t.Errorf("got traces %v, want %d total", traces, 0)
 	}
 
-	rs.MustCollect(SpanID{1, 2, 3})
+	rs.MustCollect(SpanID{Trace: 1, Span: 2, Parent: 3})
 
 	if traces, _ := ms.Traces(TracesOpts{}); len(traces) != 1 {
 		t.Errorf("got traces %v, want %d total", traces, 1)
 	}
 
-	rs.MustCollect(SpanID{2, 3, 4})
+	rs.MustCollect(SpanID{Trace: 2, Span: 3, Parent: 4})
 
 	if traces, _ := ms.Traces(TracesOpts{}); len(traces) != 2 {
 		t.Errorf("got traces %v, want %d total", traces, 2)
 	}
 
-	rs.MustCollect(SpanID{3, 4, 5})
-	rs.MustCollect(SpanID{3, 5, 6})
+	rs.MustCollect(SpanID{Trace: 3, Span: 4, Parent: 5})
+	rs.MustCollect(SpanID{Trace: 3, Span: 5, Parent: 6})
 
 	if traces, _ := ms.Traces(TracesOpts{}); len(traces) != 2 {
 		t.Errorf("got traces %v, want %d total", traces, 2)
@@ -398,11 +620,11 @@ func TestLimitStore(t *testing.T) {
 
 	traces, _ := ms.Traces(TracesOpts{})
 	want := []*Trace{
-		{Span: Span{ID: SpanID{2, 3, 4}}},
+		{Span: Span{ID: SpanID{Trace: 2, Span: 3, Parent: 4}}},
 		{
-			Span: Span{ID: SpanID{3, 5, 6}},
+			Span: Span{ID: SpanID{Trace: 3, Span: 5, Parent: 6}},
 			Sub: []*Trace{
-				{Span: Span{ID: SpanID{3, 4, 5}}},
+				{Span: Span{ID: SpanID{Trace: 3, Span: 4, Parent: 5}}},
 			},
 		},
 	}
@@ -412,6 +634,470 @@ func TestLimitStore(t *testing.T) {
 	}
 }
 
+func TestRecentStore_Queryer(t *testing.T) {
+	const age = time.Millisecond * 10
+
+	var s Store = &RecentStore{DeleteStore: NewMemoryStore(), MinEvictAge: age}
+	q, ok := s.(Queryer)
+	if !ok {
+		t.Fatal("RecentStore does not implement Queryer")
+	}
+
+	ms := storeT{t, s}
+	ms.MustCollect(SpanID{Trace: 1, Span: 2, Parent: 0})
+	time.Sleep(2 * age)
+	ms.MustCollect(SpanID{Trace: 3, Span: 4, Parent: 0})
+	time.Sleep(2 * age)
+
+	traces, err := q.Traces(TracesOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(traces) != 1 || traces[0].ID != (SpanID{Trace: 3, Span: 4, Parent: 0}) {
+		t.Errorf("got traces %v, want only trace 3", traces)
+	}
+}
+
+func TestLimitStore_Queryer(t *testing.T) {
+	var s Store = &LimitStore{DeleteStore: NewMemoryStore(), Max: 1}
+	q, ok := s.(Queryer)
+	if !ok {
+		t.Fatal("LimitStore does not implement Queryer")
+	}
+
+	ms := storeT{t, s}
+	ms.MustCollect(SpanID{Trace: 1, Span: 2, Parent: 0})
+	ms.MustCollect(SpanID{Trace: 3, Span: 4, Parent: 0})
+
+	traces, err := q.Traces(TracesOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(traces) != 1 || traces[0].ID != (SpanID{Trace: 3, Span: 4, Parent: 0}) {
+		t.Errorf("got traces %v, want only trace 3", traces)
+	}
+
+	if _, err := s.(Aggregator).Aggregate(-time.Hour, 0); err == nil {
+		t.Error("got nil error aggregating a MemoryStore, want an error")
+	}
+}
+
+func TestLimitStore_MaxSpansPerTrace(t *testing.T) {
+	ms := NewMemoryStore()
+	ls := &LimitStore{DeleteStore: ms, Max: 10, MaxSpansPerTrace: 2}
+	s := storeT{t, ls}
+
+	// Children before the root; the root is accepted beyond the limit.
+	s.MustCollect(SpanID{Trace: 1, Span: 2, Parent: 1})
+	s.MustCollect(SpanID{Trace: 1, Span: 3, Parent: 1})
+	s.MustCollect(SpanID{Trace: 1, Span: 4, Parent: 1}) // dropped
+	s.MustCollect(SpanID{Trace: 1, Span: 1, Parent: 0})
+	s.MustCollect(SpanID{Trace: 1, Span: 5, Parent: 1}) // dropped
+
+	// Spans already collected still accept annotations.
+	s.MustCollect(SpanID{Trace: 1, Span: 3, Parent: 1}, Annotation{Key: "k", Value: []byte("v")})
+	s.MustCollect(SpanID{Trace: 2, Span: 2, Parent: 0})
+
+	if got, want := ls.DroppedSpans(), int64(2); got != want {
+		t.Errorf("got %d dropped spans, want %d", got, want)
+	}
+
+	tr := s.MustTrace(1)
+	if len(tr.Sub) != 2 {
+		t.Errorf("got %d child spans, want 2", len(tr.Sub))
+	}
+	want := Annotations{{Key: TraceTruncatedKey, Value: []byte("true")}}
+	if !reflect.DeepEqual(tr.Annotations, want) {
+		t.Errorf("got root annotations %v, want %v", tr.Annotations, want)
+	}
+	if sub := tr.FindSpan(3); sub == nil || len(sub.Annotations) != 1 {
+		t.Errorf("got span 3 %v, want it to accept annotations", sub)
+	}
+	if tr := s.MustTrace(2); len(tr.Annotations) != 0 {
+		t.Errorf("got annotations %v on untruncated trace", tr.Annotations)
+	}
+}
+
+func TestMemoryStore_Traces_timespan(t *testing.T) {
+	ms := NewMemoryStore()
+	s := storeT{t, ms}
+
+	base := time.Date(2016, 6, 1, 12, 0, 0, 0, time.UTC)
+	for i := 1; i <= 3; i++ {
+		start := base.Add(time.Duration(i) * time.Hour)
+		anns, err := MarshalEvent(Timespan{S: start, E: start.Add(time.Second)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.MustCollect(SpanID{Trace: ID(i), Span: ID(i)}, anns...)
+	}
+	// Trace 4 has no timespan annotations, so its collection time is used.
+	before := time.Now()
+	s.MustCollect(SpanID{Trace: 4, Span: 4})
+
+	tests := []struct {
+		opts TracesOpts
+		want []ID
+	}{
+		{TracesOpts{}, []ID{4, 3, 2, 1}},
+		{TracesOpts{Limit: 2}, []ID{4, 3}},
+		{TracesOpts{Timespan: Timespan{S: base.Add(90 * time.Minute), E: base.Add(3 * time.Hour)}}, []ID{3, 2}},
+		{TracesOpts{Timespan: Timespan{E: base.Add(2 * time.Hour)}, Limit: 1}, []ID{2}},
+		{TracesOpts{Timespan: Timespan{S: before}}, []ID{4}},
+	}
+	for _, test := range tests {
+		traces, err := ms.Traces(test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []ID
+		for _, tr := range traces {
+			got = append(got, tr.ID.Trace)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%+v: got traces %v, want %v", test.opts, got, test.want)
+		}
+	}
+
+	// The start time index is kept up to date on deletion.
+	if err := ms.Delete(3); err != nil {
+		t.Fatal(err)
+	}
+	if traces, _ := ms.Traces(TracesOpts{Timespan: Timespan{S: base, E: base.Add(5 * time.Hour)}}); len(traces) != 2 {
+		t.Errorf("got %d traces after deletion, want 2", len(traces))
+	}
+}
+
+func TestMemoryStore_DeleteTraces(t *testing.T) {
+	ms := NewMemoryStore()
+	s := storeT{t, ms}
+	s.MustCollect(SpanID{Trace: 1, Span: 1, Parent: 0})
+	s.MustCollect(SpanID{Trace: 2, Span: 2, Parent: 0})
+	s.MustCollect(SpanID{Trace: 2, Span: 3, Parent: 2})
+	s.MustCollect(SpanID{Trace: 3, Span: 3, Parent: 0})
+
+	deleted, err := ms.DeleteTraces(1, 2, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 2 {
+		t.Errorf("got %d deleted, want 2", deleted)
+	}
+	if traces, _ := ms.Traces(TracesOpts{}); len(traces) != 1 || traces[0].ID.Trace != 3 {
+		t.Errorf("got traces %v, want only trace 3", traces)
+	}
+	if u := ms.Usage(); u.Traces != 1 || u.Spans != 1 {
+		t.Errorf("got usage %+v, want 1 trace with 1 span", u)
+	}
+}
+
+func TestMemoryStore_evictBefore(t *testing.T) {
+	s := NewMemoryStore()
+	ms := storeT{t, s}
+
+	now := time.Now()
+	old, err := MarshalEvent(Timespan{S: now.Add(-2 * time.Hour), E: now.Add(-time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recent, err := MarshalEvent(Timespan{S: now.Add(-time.Minute), E: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Trace 1 is partially expired: the old child (and its old child) should
+	// be dropped, while the root is kept alive by its recent child.
+	ms.MustCollect(SpanID{Trace: 1, Span: 1, Parent: 0}, old...)
+	ms.MustCollect(SpanID{Trace: 1, Span: 2, Parent: 1}, old...)
+	ms.MustCollect(SpanID{Trace: 1, Span: 3, Parent: 2}, old...)
+	ms.MustCollect(SpanID{Trace: 1, Span: 4, Parent: 1}, recent...)
+
+	// Trace 2 is entirely expired.
+	ms.MustCollect(SpanID{Trace: 2, Span: 1, Parent: 0}, old...)
+	ms.MustCollect(SpanID{Trace: 2, Span: 2, Parent: 1}, old...)
+
+	// Trace 3 has no timespan annotations and was just collected.
+	ms.MustCollect(SpanID{Trace: 3, Span: 1, Parent: 0})
+
+	if n, want := s.evictBefore(now.Add(-30*time.Minute)), 4; n != want {
+		t.Errorf("evictBefore: got %d spans evicted, want %d", n, want)
+	}
+
+	want1 := &Trace{
+		Span: Span{ID: SpanID{Trace: 1, Span: 1, Parent: 0}, Annotations: old},
+		Sub: []*Trace{
+			{Span: Span{ID: SpanID{Trace: 1, Span: 4, Parent: 1}, Annotations: recent}},
+		},
+	}
+	if x := ms.MustTrace(1); !reflect.DeepEqual(x, want1) {
+		t.Errorf("Trace(1): got trace %+v, want %+v", x, want1)
+	}
+	if x, err := s.Trace(2); err != ErrTraceNotFound {
+		t.Errorf("Trace(2): got trace %+v and err %#v, want ErrTraceNotFound", x, err)
+	}
+	ms.MustTrace(3)
+
+	// Spans without timespan annotations fall back to their collection time.
+	if n, want := s.evictBefore(time.Now().Add(time.Second)), 3; n != want {
+		t.Errorf("evictBefore: got %d spans evicted, want %d", n, want)
+	}
+	if traces, _ := s.Traces(TracesOpts{}); len(traces) != 0 {
+		t.Errorf("got traces %v, want %d total", traces, 0)
+	}
+}
+
+func TestMemoryStore_SetMaxAge(t *testing.T) {
+	const age = time.Millisecond * 10
+
+	s := NewMemoryStore()
+	ms := storeT{t, s}
+	s.SetSweepInterval(age)
+	s.SetMaxAge(age)
+	defer s.Close()
+
+	ms.MustCollect(SpanID{Trace: 1, Span: 2, Parent: 3})
+	time.Sleep(5 * age)
+	ms.MustCollect(SpanID{Trace: 2, Span: 3, Parent: 4})
+
+	traces, _ := s.Traces(TracesOpts{})
+	if len(traces) != 1 {
+		t.Fatalf("got traces %v, want %d total", traces, 1)
+	}
+	if trace, want := traces[0].ID, (SpanID{Trace: 2, Span: 3, Parent: 4}); trace != want {
+		t.Errorf("got trace %v, want %v", trace, want)
+	}
+}
+
+func TestMemoryStore_Close(t *testing.T) {
+	s := NewMemoryStore()
+	s.SetMaxAge(time.Hour)
+	s.Lock()
+	done := s.done
+	s.Unlock()
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	default:
+		t.Error("got the sweeper still running after Close, want it stopped")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemoryStore_SetMaxSpans(t *testing.T) {
+	s := NewMemoryStore()
+	ms := storeT{t, s}
+	s.SetMaxSpans(4)
+
+	ms.MustCollect(SpanID{Trace: 1, Span: 1, Parent: 0})
+	ms.MustCollect(SpanID{Trace: 1, Span: 2, Parent: 1})
+	ms.MustCollect(SpanID{Trace: 2, Span: 1, Parent: 0})
+	ms.MustCollect(SpanID{Trace: 2, Span: 2, Parent: 1})
+	if u, want := s.Usage(), (MemoryStoreUsage{Traces: 2, Spans: 4, Bytes: 4 * spanOverheadBytes}); u != want {
+		t.Errorf("got usage %+v, want %+v", u, want)
+	}
+
+	// Trace 1 is being viewed, so trace 2 is the least recently used and
+	// should be evicted when trace 3 arrives.
+	ms.MustTrace(1)
+	ms.MustCollect(SpanID{Trace: 3, Span: 1, Parent: 0})
+
+	ms.MustTrace(1)
+	ms.MustTrace(3)
+	if x, err := s.Trace(2); err != ErrTraceNotFound {
+		t.Errorf("Trace(2): got trace %+v and err %#v, want ErrTraceNotFound", x, err)
+	}
+	if u, want := s.Usage(), (MemoryStoreUsage{Traces: 2, Spans: 3, Bytes: 3 * spanOverheadBytes}); u != want {
+		t.Errorf("got usage %+v, want %+v", u, want)
+	}
+
+	// A single trace larger than the bound is kept.
+	for i := ID(2); i < 10; i++ {
+		ms.MustCollect(SpanID{Trace: 3, Span: i, Parent: 1})
+	}
+	if u, want := s.Usage(), (MemoryStoreUsage{Traces: 1, Spans: 9, Bytes: 9 * spanOverheadBytes}); u != want {
+		t.Errorf("got usage %+v, want %+v", u, want)
+	}
+}
+
+func TestMemoryStore_SetMaxBytes(t *testing.T) {
+	s := NewMemoryStore()
+	ms := storeT{t, s}
+
+	ann := Annotation{Key: "k", Value: []byte("0123456789")}
+	ms.MustCollect(SpanID{Trace: 1, Span: 1, Parent: 0}, ann)
+	ms.MustCollect(SpanID{Trace: 2, Span: 1, Parent: 0}, ann)
+	ms.MustCollect(SpanID{Trace: 2, Span: 1, Parent: 0}, ann)
+	if u, want := s.Usage(), (MemoryStoreUsage{Traces: 2, Spans: 2, Bytes: 2*spanOverheadBytes + 3*11}); u != want {
+		t.Errorf("got usage %+v, want %+v", u, want)
+	}
+
+	s.SetMaxBytes(spanOverheadBytes + 22)
+	if x, err := s.Trace(1); err != ErrTraceNotFound {
+		t.Errorf("Trace(1): got trace %+v and err %#v, want ErrTraceNotFound", x, err)
+	}
+	ms.MustTrace(2)
+}
+
+func TestMemoryStore_persistence(t *testing.T) {
+	for _, level := range []int{gzip.NoCompression, gzip.BestSpeed, gzip.DefaultCompression} {
+		s := NewMemoryStore()
+		if err := s.SetCompressionLevel(level); err != nil {
+			t.Fatal(err)
+		}
+		ms := storeT{t, s}
+		ms.MustCollect(SpanID{Trace: 1, Span: 1, Parent: 0}, Annotation{Key: "k1", Value: []byte("v1")})
+		ms.MustCollect(SpanID{Trace: 1, Span: 2, Parent: 1}, Annotation{Key: "k2", Value: []byte("v2")})
+
+		var buf bytes.Buffer
+		if err := s.Write(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if compressed := bytes.HasPrefix(buf.Bytes(), []byte{0x1f, 0x8b}); compressed != (level != gzip.NoCompression) {
+			t.Errorf("level %d: got compressed %v", level, compressed)
+		}
+
+		s2 := NewMemoryStore()
+		n, err := s2.ReadFrom(&buf)
+		if err != nil {
+			t.Fatalf("level %d: %s", level, err)
+		}
+		if n != 1 {
+			t.Errorf("level %d: got %d traces read, want %d", level, n, 1)
+		}
+		if x, want := (storeT{t, s2}).MustTrace(1), ms.MustTrace(1); !reflect.DeepEqual(x, want) {
+			t.Errorf("level %d: Trace(1): got trace %+v, want %+v", level, x, want)
+		}
+	}
+}
+
+func TestMemoryStore_ReadFrom_legacy(t *testing.T) {
+	s := NewMemoryStore()
+	ms := storeT{t, s}
+	ms.MustCollect(SpanID{Trace: 1, Span: 1, Parent: 0}, Annotation{Key: "k1", Value: []byte("v1")})
+	ms.MustCollect(SpanID{Trace: 1, Span: 2, Parent: 1}, Annotation{Key: "k2", Value: []byte("v2")})
+
+	// Data written by Write before it streamed traces.
+	var buf bytes.Buffer
+	sh := s.shard(1)
+	if err := gob.NewEncoder(&buf).Encode(memoryStoreData{sh.trace, sh.span}); err != nil {
+		t.Fatal(err)
+	}
+
+	s2 := NewMemoryStore()
+	if _, err := s2.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if x, want := (storeT{t, s2}).MustTrace(1), ms.MustTrace(1); !reflect.DeepEqual(x, want) {
+		t.Errorf("Trace(1): got trace %+v, want %+v", x, want)
+	}
+}
+
+func TestMemoryStore_ReadFrom_truncated(t *testing.T) {
+	s := NewMemoryStore()
+	ms := storeT{t, s}
+	for i := ID(1); i <= 10; i++ {
+		ms.MustCollect(SpanID{Trace: i, Span: i, Parent: 0}, Annotation{Key: "k", Value: []byte("v")})
+	}
+	var buf bytes.Buffer
+	if _, err := s.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewMemoryStore().ReadFrom(bytes.NewReader(buf.Bytes()[:buf.Len()-1])); err == nil {
+		t.Error("got nil error reading truncated data")
+	}
+}
+
+func TestMemoryStore_WriteTo_concurrentCollect(t *testing.T) {
+	s := NewMemoryStore()
+	ms := storeT{t, s}
+	for i := ID(1); i <= 100; i++ {
+		ms.MustCollect(SpanID{Trace: i, Span: i, Parent: 0})
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := ID(1); i <= 100; i++ {
+			s.Collect(SpanID{Trace: i, Span: i + 1000, Parent: i}, Annotation{Key: "k", Value: []byte("v")})
+			s.Collect(SpanID{Trace: i + 1000, Span: i + 1000, Parent: 0})
+		}
+	}()
+	var buf bytes.Buffer
+	n, err := s.WriteTo(&buf)
+	<-done
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("got %d bytes written, want %d", n, buf.Len())
+	}
+
+	s2 := NewMemoryStore()
+	read, err := s2.ReadFrom(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read < 100 {
+		t.Errorf("got %d traces read, want at least 100", read)
+	}
+	for i := ID(1); i <= 100; i++ {
+		tr, err := s2.Trace(i)
+		if err != nil {
+			t.Fatalf("Trace(%d): %s", i, err)
+		}
+		if len(tr.Sub) > 1 {
+			t.Errorf("Trace(%d): got %d children, want at most 1", i, len(tr.Sub))
+		}
+	}
+}
+
+func TestMemoryStore_concurrentReadWrite(t *testing.T) {
+	s := NewMemoryStore()
+	s.SetMaxSpans(500)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				id := ID(w*1000 + i/4 + 1)
+				if err := s.Collect(SpanID{Trace: id, Span: ID(i + 1), Parent: 0}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(w)
+	}
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				id := ID(r*1000 + i/4 + 1)
+				if tr, err := s.Trace(id); err == nil && tr.Span.ID.Trace != id {
+					t.Errorf("Trace(%v): got trace %v", id, tr.Span.ID.Trace)
+				} else if err != nil && err != ErrTraceNotFound {
+					t.Error(err)
+				}
+				if _, err := s.Traces(TracesOpts{Limit: 10}); err != nil {
+					t.Error(err)
+				}
+				s.Usage()
+			}
+		}(r)
+	}
+	wg.Wait()
+
+	if u := s.Usage(); u.Spans > 500 {
+		t.Errorf("got %d spans, want at most 500", u.Spans)
+	}
+}
+
 func compareTraces(a, b *Trace) (diff []string) {
 	var cmp func(parent ID, a, b *Trace)
 	cmp = func(parent ID, a, b *Trace) {
@@ -464,7 +1150,7 @@ func benchmarkMemoryStoreN(b *testing.B, n int) {
 	for i := 0; i < b.N; i++ {
 		for c := 0; c < n; c++ {
 			x++
-			err := ms.Collect(SpanID{x, x + 1, x + 2})
+			err := ms.Collect(SpanID{Trace: x, Span: x + 1, Parent: x + 2})
 			if err != nil {
 				b.Fatal(err)
 			}
@@ -484,12 +1170,71 @@ func BenchmarkMemoryStore1000(b *testing.B) {
 	benchmarkMemoryStoreN(b, 1000)
 }
 
+// BenchmarkMemoryStoreCollectParallel measures collecting spans of distinct
+// traces from many goroutines at once.
+func BenchmarkMemoryStoreCollectParallel(b *testing.B) {
+	ms := NewMemoryStore()
+	anns := []Annotation{{Key: "k", Value: []byte("v")}}
+	var n uint64
+	b.SetParallelism(8)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			x := ID(atomic.AddUint64(&n, 1))
+			if err := ms.Collect(SpanID{Trace: x/10 + 1, Span: x, Parent: 0}, anns...); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkMemoryStoreTraceParallel measures reading traces from many
+// goroutines at once while spans are being collected.
+func BenchmarkMemoryStoreTraceParallel(b *testing.B) {
+	ms := NewMemoryStore()
+	anns := []Annotation{{Key: "k", Value: []byte("v")}}
+	for i := ID(1); i <= 1000; i++ {
+		if err := ms.Collect(SpanID{Trace: i, Span: i, Parent: 0}, anns...); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for x := ID(1); ; x++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			ms.Collect(SpanID{Trace: x%1000 + 1, Span: x + 1000, Parent: x%1000 + 1}, anns...)
+		}
+	}()
+	defer func() {
+		close(done)
+		<-stopped
+	}()
+
+	var n uint64
+	b.SetParallelism(8)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			id := ID(atomic.AddUint64(&n, 1)%1000 + 1)
+			if _, err := ms.Trace(id); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
 func BenchmarkMemoryStoreWrite1000(b *testing.B) {
 	ms := NewMemoryStore()
 	var x ID
 	for c := 0; c < 1000; c++ {
 		x++
-		err := ms.Collect(SpanID{x, x + 1, x + 2})
+		err := ms.Collect(SpanID{Trace: x, Span: x + 1, Parent: x + 2})
 		if err != nil {
 			b.Fatal(err)
 		}
@@ -503,12 +1248,56 @@ func BenchmarkMemoryStoreWrite1000(b *testing.B) {
 	}
 }
 
+func benchmarkMemoryStoreWriteCompressed(b *testing.B, level int) {
+	ms := NewMemoryStore()
+	if err := ms.SetCompressionLevel(level); err != nil {
+		b.Fatal(err)
+	}
+	var x ID
+	for c := 0; c < 1000; c++ {
+		x++
+		err := ms.Collect(SpanID{Trace: x, Span: x + 1, Parent: x + 2},
+			Annotation{Key: "Name", Value: []byte("GET /api/repos")},
+			Annotation{Key: "_schema:HTTPClient", Value: nil},
+			Annotation{Key: "Client.Request.Method", Value: []byte("GET")},
+			Annotation{Key: "Client.Request.URI", Value: []byte(fmt.Sprintf("/api/repos/%d", c))},
+			Annotation{Key: "Client.Request.Headers.User-Agent", Value: []byte("Go-http-client/1.1")},
+			Annotation{Key: "Client.Send", Value: []byte(time.Now().Format(time.RFC3339Nano))},
+		)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		err := ms.Write(&buf)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.Logf("compression level %d: wrote %d bytes", level, buf.Len())
+}
+
+func BenchmarkMemoryStoreWriteUncompressed1000(b *testing.B) {
+	benchmarkMemoryStoreWriteCompressed(b, gzip.NoCompression)
+}
+
+func BenchmarkMemoryStoreWriteBestSpeed1000(b *testing.B) {
+	benchmarkMemoryStoreWriteCompressed(b, gzip.BestSpeed)
+}
+
+func BenchmarkMemoryStoreWriteDefaultCompression1000(b *testing.B) {
+	benchmarkMemoryStoreWriteCompressed(b, gzip.DefaultCompression)
+}
+
 func BenchmarkMemoryStoreReadFrom1000(b *testing.B) {
 	ms := NewMemoryStore()
 	var x ID
 	for c := 0; c < 1000; c++ {
 		x++
-		err := ms.Collect(SpanID{x, x + 1, x + 2})
+		err := ms.Collect(SpanID{Trace: x, Span: x + 1, Parent: x + 2})
 		if err != nil {
 			b.Fatal(err)
 		}
@@ -528,6 +1317,65 @@ func BenchmarkMemoryStoreReadFrom1000(b *testing.B) {
 	}
 }
 
+// benchmarkMemoryStoreDelete10k measures deleting 10k traces using the given
+// delete function, while spans are collected concurrently.
+func benchmarkMemoryStoreDelete10k(b *testing.B, del func(ms *MemoryStore, ids []ID)) {
+	const n = 10000
+	ids := make([]ID, n)
+	for i := range ids {
+		ids[i] = ID(i + 1)
+	}
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		ms := NewMemoryStore()
+		for _, id := range ids {
+			if err := ms.Collect(SpanID{Trace: id, Span: id, Parent: 0}); err != nil {
+				b.Fatal(err)
+			}
+		}
+		done := make(chan struct{})
+		var wg sync.WaitGroup
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for x := ID(n * (g + 1)); ; x++ {
+					select {
+					case <-done:
+						return
+					default:
+					}
+					ms.Collect(SpanID{Trace: x, Span: x, Parent: 0})
+				}
+			}(g + 1)
+		}
+		b.StartTimer()
+		del(ms, ids)
+		b.StopTimer()
+		close(done)
+		wg.Wait()
+		b.StartTimer()
+	}
+}
+
+func BenchmarkMemoryStoreDelete10k(b *testing.B) {
+	benchmarkMemoryStoreDelete10k(b, func(ms *MemoryStore, ids []ID) {
+		for _, id := range ids {
+			if err := ms.Delete(id); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkMemoryStoreDeleteTraces10k(b *testing.B) {
+	benchmarkMemoryStoreDelete10k(b, func(ms *MemoryStore, ids []ID) {
+		if _, err := ms.DeleteTraces(ids...); err != nil {
+			b.Fatal(err)
+		}
+	})
+}
+
 func BenchmarkRecentStore500(b *testing.B) {
 	const (
 		nCollections = 500
@@ -545,7 +1393,7 @@ func BenchmarkRecentStore500(b *testing.B) {
 			for a := range anns {
 				anns[a] = Annotation{"k1", []byte("v1")}
 			}
-			err := rs.Collect(SpanID{x, 2, 3}, anns...)
+			err := rs.Collect(SpanID{Trace: x, Span: 2, Parent: 3}, anns...)
 			if err != nil {
 				b.Fatal(err)
 			}
@@ -570,10 +1418,114 @@ func BenchmarkLimitStore500(b *testing.B) {
 			for a := range anns {
 				anns[a] = Annotation{"k1", []byte("v1")}
 			}
-			err := rs.Collect(SpanID{x, 2, 3}, anns...)
+			err := rs.Collect(SpanID{Trace: x, Span: 2, Parent: 3}, anns...)
 			if err != nil {
 				b.Fatal(err)
 			}
 		}
 	}
 }
+
+// countTraces counts the traces and spans of the store by reading them all,
+// to check the counts of the Counter interface.
+func countTraces(t *testing.T, s TraceIterator) (traces, spans int) {
+	err := s.ForEachTrace(func(tr *Trace) error {
+		traces++
+		return tr.Walk(func(*Trace) error { spans++; return nil })
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return traces, spans
+}
+
+func TestMemoryStore_counts(t *testing.T) {
+	s := NewMemoryStore()
+	ms := storeT{t, s}
+	rnd := rand.New(rand.NewSource(1))
+	now := time.Now()
+	old, err := MarshalEvent(Timespan{S: now.Add(-2 * time.Hour), E: now.Add(-time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2000; i++ {
+		trace := ID(rnd.Intn(50) + 1)
+		var op string
+		switch r := rnd.Intn(20); {
+		case r < 14:
+			op = "collect"
+			span := ID(rnd.Intn(5) + 1)
+			var parent ID
+			if span > 1 {
+				parent = ID(rnd.Intn(int(span)-1) + 1)
+			}
+			var anns Annotations
+			if rnd.Intn(4) == 0 {
+				anns = old
+			}
+			ms.MustCollect(SpanID{Trace: trace, Span: span, Parent: parent}, anns...)
+		case r < 17:
+			op = "delete"
+			if _, err := s.DeleteTraces(trace, trace+1); err != nil {
+				t.Fatal(err)
+			}
+		case r < 18:
+			op = "evict by age"
+			s.evictBefore(now.Add(-30 * time.Minute))
+		case r < 19:
+			op = "evict by spans"
+			s.SetMaxSpans(rnd.Intn(100) + 1)
+			s.SetMaxSpans(0)
+		default:
+			op = "reload"
+			var buf bytes.Buffer
+			if err := s.Write(&buf); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.ReadFrom(&buf); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		traces, spans := countTraces(t, s)
+		if n, _ := s.NumTraces(); n != traces {
+			t.Fatalf("%d: after %s: got %d traces, want %d", i, op, n, traces)
+		}
+		if n, _ := s.NumSpans(); n != spans {
+			t.Fatalf("%d: after %s: got %d spans, want %d", i, op, n, spans)
+		}
+	}
+}
+
+func TestLimitStore_counts(t *testing.T) {
+	ms := NewMemoryStore()
+	ls := &storeT{t, &LimitStore{DeleteStore: NewRecentStore(ms, time.Hour), Max: 2}}
+	c := ls.Store.(Counter)
+	check := func(traces, spans int) {
+		t.Helper()
+		if n, err := c.NumTraces(); err != nil || n != traces {
+			t.Errorf("got %d traces and error %v, want %d", n, err, traces)
+		}
+		if n, err := c.NumSpans(); err != nil || n != spans {
+			t.Errorf("got %d spans and error %v, want %d", n, err, spans)
+		}
+	}
+
+	ls.MustCollect(SpanID{Trace: 1, Span: 1})
+	ls.MustCollect(SpanID{Trace: 1, Span: 2, Parent: 1})
+	ls.MustCollect(SpanID{Trace: 2, Span: 1})
+	check(2, 3)
+	ls.MustCollect(SpanID{Trace: 3, Span: 1}) // evicts trace 1
+	check(2, 2)
+	if err := ls.Store.(DeleteStore).Delete(2); err != nil {
+		t.Fatal(err)
+	}
+	check(1, 1)
+
+	// The underlying store must implement Counter.
+	noCounts := struct{ DeleteStore }{NewMemoryStore()}
+	if _, err := (&LimitStore{DeleteStore: noCounts}).NumTraces(); err == nil {
+		t.Error("got nil error counting the traces of a store without counts, want an error")
+	}
+}
@@ -0,0 +1,352 @@
+package appdash
+
+import (
+	"container/list"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTailQuietPeriod is the default TailSampler.QuietPeriod.
+	DefaultTailQuietPeriod = 2 * time.Second
+
+	// DefaultTailMaxWait is the default TailSampler.MaxWait.
+	DefaultTailMaxWait = 30 * time.Second
+
+	// DefaultTailMaxTraces is the default TailSampler.MaxTraces.
+	DefaultTailMaxTraces = 10000
+
+	// DefaultTailMaxSpans is the default TailSampler.MaxSpans.
+	DefaultTailMaxSpans = 100000
+)
+
+// NewTailSampler returns a TailSampler that collects the traces it keeps
+// into s. Call its Start method to decide the complete traces in the
+// background.
+func NewTailSampler(s Store) *TailSampler {
+	return &TailSampler{Store: s, now: time.Now}
+}
+
+// A TailSampler is a store that buffers the spans of each trace in memory
+// until the trace is complete, and then decides whether to keep it (by
+// collecting all of its spans into the underlying store) or to drop it.
+// Unlike the sampling collectors, which decide when the first span of a
+// trace is seen, it can keep all of the slow or failed traces, and only
+// those.
+//
+// A trace is complete once its root span has a timespan event (i.e. it has
+// ended) and no spans were collected for QuietPeriod, or at the latest
+// MaxWait after its first span was collected. A complete trace is kept if
+// it has an ErrorAnnotation, if it lasted at least MinDuration, or else
+// with probability Rate.
+//
+// The decisions for the traces are remembered (see CacheSize), so that the
+// spans of a trace that are collected after it was decided follow the
+// decision, rather than being buffered and decided on their own.
+//
+// The traces that are still buffered aren't returned by the Store methods.
+type TailSampler struct {
+	// Store is the underlying store, into which the kept traces are
+	// collected.
+	Store
+
+	// MinDuration, if non-zero, is the duration (from the start of the
+	// earliest timespan event of the trace to the end of the latest one)
+	// above which a trace is always kept.
+	MinDuration time.Duration
+
+	// ErrorAnnotation, if non-empty, is the key of an annotation that marks
+	// a span as failed. The traces with such a span are always kept.
+	ErrorAnnotation string
+
+	// Rate is the fraction of the other traces that are kept, from 0 to 1
+	// (see NewSamplerCollector).
+	Rate float64
+
+	// QuietPeriod is how long after the last span of a trace whose root
+	// span has ended the trace is considered complete.
+	//
+	// Default QuietPeriod = DefaultTailQuietPeriod.
+	QuietPeriod time.Duration
+
+	// MaxWait is how long after its first span a trace is considered
+	// complete, even if its root span hasn't ended.
+	//
+	// Default MaxWait = DefaultTailMaxWait.
+	MaxWait time.Duration
+
+	// MaxTraces and MaxSpans are the maximum numbers of traces and spans
+	// (collections) that are buffered. When either is exceeded, the trace
+	// that was buffered first is evicted: it is kept if KeepEvicted is
+	// true, and dropped otherwise.
+	//
+	// Default MaxTraces = DefaultTailMaxTraces.
+	// Default MaxSpans = DefaultTailMaxSpans.
+	MaxTraces, MaxSpans int
+
+	// KeepEvicted is whether the traces evicted from the buffer are kept
+	// (without evaluating them) rather than dropped.
+	KeepEvicted bool
+
+	// CacheSize is the maximum number of traces whose decision is
+	// remembered after they were decided. The decision for the trace that
+	// was least recently seen is forgotten first.
+	//
+	// Default CacheSize = DefaultSamplerCacheSize.
+	CacheSize int
+
+	// Log, if non-nil, is used to log the errors of the underlying store
+	// when the complete traces are decided in the background.
+	Log *log.Logger
+
+	now func() time.Time // the clock (for tests)
+
+	mu        sync.Mutex           // guards the fields below
+	traces    *list.List           // *tailTrace, oldest first
+	byID      map[ID]*list.Element // trace ID -> element of traces
+	decisions *idLRU               // trace ID -> whether the decided trace is kept
+	numSpans  int                  // number of buffered collections
+	stats     TailSamplerStats
+	stopChan  chan struct{} // closed to stop the background decisions
+}
+
+// TailSamplerStats counts the traces decided by a TailSampler.
+type TailSamplerStats struct {
+	Kept, Dropped uint64 // complete traces kept and dropped
+
+	// ForcedKept and ForcedDropped count the traces evicted from the
+	// buffer before they were complete (see TailSampler.KeepEvicted).
+	ForcedKept, ForcedDropped uint64
+}
+
+// A tailTrace is a trace buffered by a TailSampler.
+type tailTrace struct {
+	id          ID
+	spans       []queuedSpan
+	first, last time.Time // when the first and last spans were collected
+	rootEnded   bool      // whether the root span has a timespan event
+}
+
+// Collect implements the Collector interface by buffering the span until
+// its trace is complete.
+func (ts *TailSampler) Collect(span SpanID, anns ...Annotation) error {
+	now := ts.now()
+
+	ts.mu.Lock()
+	ts.initNoLock()
+	if keep, ok := ts.decisions.get(span.Trace); ok {
+		// The trace was already decided.
+		ts.mu.Unlock()
+		if !keep {
+			return nil
+		}
+		return ts.Store.Collect(span, anns...)
+	}
+	e, ok := ts.byID[span.Trace]
+	if !ok {
+		e = ts.traces.PushBack(&tailTrace{id: span.Trace, first: now})
+		ts.byID[span.Trace] = e
+	}
+	t := e.Value.(*tailTrace)
+	t.spans = append(t.spans, queuedSpan{span, anns})
+	t.last = now
+	if span.IsRoot() && !t.rootEnded {
+		t.rootEnded = hasTimespanEvent(anns)
+	}
+	ts.numSpans++
+
+	maxTraces, maxSpans := ts.MaxTraces, ts.MaxSpans
+	if maxTraces <= 0 {
+		maxTraces = DefaultTailMaxTraces
+	}
+	if maxSpans <= 0 {
+		maxSpans = DefaultTailMaxSpans
+	}
+	var keep []*tailTrace
+	for ts.traces.Len() > maxTraces || ts.numSpans > maxSpans {
+		t := ts.removeNoLock(ts.traces.Front())
+		ts.decisions.add(t.id, ts.KeepEvicted)
+		if ts.KeepEvicted {
+			ts.stats.ForcedKept++
+			keep = append(keep, t)
+		} else {
+			ts.stats.ForcedDropped++
+		}
+	}
+	ts.mu.Unlock()
+
+	return ts.collect(keep)
+}
+
+// initNoLock initializes the buffer and the decisions, on first use. The
+// ts.mu lock must be held.
+func (ts *TailSampler) initNoLock() {
+	if ts.byID != nil {
+		return
+	}
+	size := ts.CacheSize
+	if size <= 0 {
+		size = DefaultSamplerCacheSize
+	}
+	ts.traces = list.New()
+	ts.byID = map[ID]*list.Element{}
+	ts.decisions = newIDLRU(size)
+}
+
+// Flush decides the traces that are complete, collecting the ones that are
+// kept into the underlying store. It is called periodically once Start is
+// called.
+func (ts *TailSampler) Flush() error {
+	return ts.decide(false)
+}
+
+// decide decides the complete traces, or all of them if all is true.
+func (ts *TailSampler) decide(all bool) error {
+	now := ts.now()
+	quiet, maxWait := ts.QuietPeriod, ts.MaxWait
+	if quiet <= 0 {
+		quiet = DefaultTailQuietPeriod
+	}
+	if maxWait <= 0 {
+		maxWait = DefaultTailMaxWait
+	}
+
+	var keep []*tailTrace
+	ts.mu.Lock()
+	ts.initNoLock()
+	for e := ts.traces.Front(); e != nil; {
+		t, next := e.Value.(*tailTrace), e.Next()
+		if all || (t.rootEnded && now.Sub(t.last) >= quiet) || now.Sub(t.first) >= maxWait {
+			ts.removeNoLock(e)
+			kept := ts.keep(t)
+			ts.decisions.add(t.id, kept)
+			if kept {
+				ts.stats.Kept++
+				keep = append(keep, t)
+			} else {
+				ts.stats.Dropped++
+			}
+		}
+		e = next
+	}
+	ts.mu.Unlock()
+
+	return ts.collect(keep)
+}
+
+// keep evaluates whether to keep a complete trace.
+func (ts *TailSampler) keep(t *tailTrace) bool {
+	if ts.ErrorAnnotation != "" {
+		for _, s := range t.spans {
+			if s.anns.Has(EscapeKey(ts.ErrorAnnotation)) {
+				return true
+			}
+		}
+	}
+	if ts.MinDuration > 0 && traceDuration(t.spans) >= ts.MinDuration {
+		return true
+	}
+	return sampleTrace(t.id, ts.Rate)
+}
+
+// traceDuration returns the time between the start of the earliest
+// timespan event of the spans and the end of the latest one (or 0 if there
+// are none).
+func traceDuration(spans []queuedSpan) time.Duration {
+	// The annotations of an event may be split over several collections
+	// of its span, so group them by span first.
+	bySpan := map[SpanID]Annotations{}
+	for _, s := range spans {
+		bySpan[s.span] = append(bySpan[s.span], s.anns...)
+	}
+	var events []Event
+	for _, anns := range bySpan {
+		UnmarshalEvents(anns, &events)
+	}
+	start, end, ok := findTraceTimes(events)
+	if !ok {
+		return 0
+	}
+	return end.Sub(start)
+}
+
+// hasTimespanEvent reports whether anns hold a timespan event.
+func hasTimespanEvent(anns Annotations) bool {
+	var events []Event
+	UnmarshalEvents(anns, &events)
+	for _, e := range events {
+		if _, ok := e.(TimespanEvent); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// removeNoLock removes a trace from the buffer. The ts.mu lock must be
+// held.
+func (ts *TailSampler) removeNoLock(e *list.Element) *tailTrace {
+	t := ts.traces.Remove(e).(*tailTrace)
+	delete(ts.byID, t.id)
+	ts.numSpans -= len(t.spans)
+	return t
+}
+
+// collect collects the spans of the kept traces into the underlying store,
+// and returns the first error.
+func (ts *TailSampler) collect(traces []*tailTrace) error {
+	var firstErr error
+	for _, t := range traces {
+		for _, s := range t.spans {
+			if err := ts.Store.Collect(s.span, s.anns...); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// Stats returns the numbers of traces decided so far.
+func (ts *TailSampler) Stats() TailSamplerStats {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.stats
+}
+
+// Start decides the complete traces every interval in the background,
+// until Close is called.
+func (ts *TailSampler) Start(interval time.Duration) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.stopChan != nil {
+		return
+	}
+	stop := make(chan struct{})
+	ts.stopChan = stop
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if err := ts.Flush(); err != nil && ts.Log != nil {
+					ts.Log.Printf("TailSampler: %s", err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops deciding the traces in the background, and decides all of
+// the buffered traces as if they were complete.
+func (ts *TailSampler) Close() error {
+	ts.mu.Lock()
+	if ts.stopChan != nil {
+		close(ts.stopChan)
+		ts.stopChan = nil
+	}
+	ts.mu.Unlock()
+	return ts.decide(true)
+}
@@ -0,0 +1,126 @@
+package appdash
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTailSampler(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	ms := NewMemoryStore()
+	ts := NewTailSampler(ms)
+	ts.now = clock.now
+	ts.MinDuration = time.Second
+	ts.ErrorAnnotation = "Error"
+	ts.QuietPeriod = 2 * time.Second
+	ts.MaxWait = 10 * time.Second
+
+	start := time.Unix(2000, 0)
+	collectTrace := func(trace ID, d time.Duration, childErr bool) {
+		root := SpanID{Trace: trace, Span: trace}
+		child := SpanID{Trace: trace, Span: trace + 1, Parent: trace}
+		var childAnns Annotations
+		if childErr {
+			childAnns = append(childAnns, Annotation{Key: "Error", Value: []byte("boom")})
+		}
+		ts.Collect(child, childAnns...)
+		if d > 0 {
+			anns, err := MarshalEvent(Timespan{S: start, E: start.Add(d)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ts.Collect(root, anns...)
+		}
+	}
+	collectTrace(10, 10*time.Millisecond, false) // fast: dropped
+	collectTrace(20, 2*time.Second, false)       // slow: kept
+	collectTrace(30, 10*time.Millisecond, true)  // failed: kept
+	collectTrace(40, 0, false)                   // root never ends: dropped after MaxWait
+
+	stored := func() []ID {
+		var ids []ID
+		for _, id := range []ID{10, 20, 30, 40} {
+			if _, err := ms.Trace(id); err == nil {
+				ids = append(ids, id)
+			}
+		}
+		return ids
+	}
+
+	// Nothing is decided before the quiet period.
+	clock.advance(time.Second)
+	if err := ts.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := ts.Stats(); got != (TailSamplerStats{}) {
+		t.Errorf("got stats %+v before the quiet period, want none", got)
+	}
+
+	clock.advance(time.Second)
+	if err := ts.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := stored(), []ID{20, 30}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got stored traces %v, want %v", got, want)
+	}
+	if got, want := ts.Stats(), (TailSamplerStats{Kept: 2, Dropped: 1}); got != want {
+		t.Errorf("got stats %+v, want %+v", got, want)
+	}
+	if trace, err := ms.Trace(30); err != nil || len(trace.Sub) != 1 {
+		t.Errorf("got trace %v (%v), want the root span with its child", trace, err)
+	}
+
+	// The spans collected after their trace was decided follow the
+	// decision, rather than being buffered and decided on their own.
+	ts.Collect(SpanID{Trace: 30, Span: 32, Parent: 30})
+	ts.Collect(SpanID{Trace: 10, Span: 12, Parent: 10})
+	if trace, err := ms.Trace(30); err != nil || len(trace.Sub) != 2 {
+		t.Errorf("got trace %v (%v), want the root span with its late child", trace, err)
+	}
+	if _, err := ms.Trace(10); err != ErrTraceNotFound {
+		t.Errorf("got the late child of a dropped trace stored (err %v)", err)
+	}
+
+	// The incomplete trace is decided after MaxWait.
+	clock.advance(8 * time.Second)
+	if err := ts.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ts.Stats(), (TailSamplerStats{Kept: 2, Dropped: 2}); got != want {
+		t.Errorf("got stats %+v after MaxWait, want %+v", got, want)
+	}
+}
+
+func TestTailSampler_evict(t *testing.T) {
+	for _, keepEvicted := range []bool{false, true} {
+		ms := NewMemoryStore()
+		ts := NewTailSampler(ms)
+		ts.MaxTraces = 2
+		ts.MaxSpans = 2
+		ts.KeepEvicted = keepEvicted
+
+		ts.Collect(SpanID{Trace: 1, Span: 11, Parent: 1})
+		ts.Collect(SpanID{Trace: 2, Span: 21, Parent: 2})
+		ts.Collect(SpanID{Trace: 3, Span: 31, Parent: 3}) // evicts trace 1 (too many traces)
+		ts.Collect(SpanID{Trace: 3, Span: 32, Parent: 3}) // evicts trace 2 (too many spans)
+
+		var want TailSamplerStats
+		if keepEvicted {
+			want.ForcedKept = 2
+		} else {
+			want.ForcedDropped = 2
+		}
+		if got := ts.Stats(); got != want {
+			t.Errorf("keepEvicted %v: got stats %+v, want %+v", keepEvicted, got, want)
+		}
+		for _, id := range []ID{1, 2} {
+			if _, err := ms.Trace(id); (err == nil) != keepEvicted {
+				t.Errorf("keepEvicted %v: trace %v: got error %v", keepEvicted, id, err)
+			}
+		}
+		if _, err := ms.Trace(3); err != ErrTraceNotFound {
+			t.Errorf("keepEvicted %v: got trace 3 stored while buffered (err %v)", keepEvicted, err)
+		}
+	}
+}
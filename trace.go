@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sort"
 	"strings"
 	"time"
 )
@@ -39,6 +40,53 @@ func (t *Trace) FindSpan(spanID ID) *Trace {
 	return nil
 }
 
+// Walk calls f with t and each of its descendants, depth first, each span
+// before its children, which are visited in the order of Sub. If f returns
+// an error, the walk stops, and Walk returns it.
+func (t *Trace) Walk(f func(*Trace) error) error {
+	if err := f(t); err != nil {
+		return err
+	}
+	for _, sub := range t.Sub {
+		if err := sub.Walk(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flatten returns t and all of its descendants, ordered by their start
+// time (see TimespanEvent), and then by their span ID. The spans without
+// timespan events come last, ordered by span ID.
+func (t *Trace) Flatten() []*Trace {
+	type node struct {
+		t     *Trace
+		start time.Time
+		timed bool
+	}
+	var nodes []node
+	t.Walk(func(t *Trace) error {
+		start, _, ok := t.times()
+		nodes = append(nodes, node{t: t, start: start, timed: ok})
+		return nil
+	})
+	sort.SliceStable(nodes, func(i, j int) bool {
+		a, b := nodes[i], nodes[j]
+		if a.timed != b.timed {
+			return a.timed
+		}
+		if !a.start.Equal(b.start) {
+			return a.start.Before(b.start)
+		}
+		return a.t.Span.ID.Span < b.t.Span.ID.Span
+	})
+	flat := make([]*Trace, len(nodes))
+	for i, n := range nodes {
+		flat[i] = n.t
+	}
+	return flat
+}
+
 // TreeString returns the Trace as a formatted string that visually
 // represents the trace's tree.
 func (t *Trace) TreeString() string {
@@ -59,6 +107,108 @@ func (t *Trace) TimespanEvent() (TimespanEvent, error) {
 	return timespanEvent{S: start, E: end}, nil
 }
 
+// Duration returns the duration of the span, from the start of its first
+// timespan event to the end of its last one (see TimespanEvent), and
+// false if it has none.
+func (t *Trace) Duration() (time.Duration, bool) {
+	start, end, ok := t.times()
+	if !ok {
+		return 0, false
+	}
+	return end.Sub(start), true
+}
+
+// SelfTime returns the time spent in the span itself, excluding the time
+// spent in its children: its duration minus the union of the intervals of
+// its children (within the span), so that the time of the children that
+// overlap is only subtracted once, and the gaps between them count as
+// self time. The children without timespan events are skipped. It returns
+// false if the span itself has none.
+func (t *Trace) SelfTime() (time.Duration, bool) {
+	start, end, ok := t.times()
+	if !ok {
+		return 0, false
+	}
+
+	type interval struct{ start, end time.Time }
+	var children []interval
+	for _, sub := range t.Sub {
+		s, e, ok := sub.times()
+		if !ok {
+			continue
+		}
+		if s.Before(start) {
+			s = start
+		}
+		if e.After(end) {
+			e = end
+		}
+		if e.After(s) {
+			children = append(children, interval{s, e})
+		}
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].start.Before(children[j].start) })
+
+	self := end.Sub(start)
+	var covered time.Time // the end of the union of the intervals so far
+	for _, c := range children {
+		if c.start.Before(covered) {
+			if !c.end.After(covered) {
+				continue
+			}
+			c.start = covered
+		}
+		self -= c.end.Sub(c.start)
+		covered = c.end
+	}
+	return self, true
+}
+
+// CriticalPath returns the chain of spans from t to a leaf that blocked
+// its completion the longest: t, then its child that ended last, then
+// that child's child that ended last, and so on (preferring the one that
+// started first when several end at the same time). The spans without
+// timespan events are skipped, and it returns nil if t has none.
+func (t *Trace) CriticalPath() []*Trace {
+	if _, _, ok := t.times(); !ok {
+		return nil
+	}
+	path := []*Trace{t}
+	for cur := t; ; {
+		var (
+			next       *Trace
+			start, end time.Time
+		)
+		for _, sub := range cur.Sub {
+			s, e, ok := sub.times()
+			if !ok {
+				continue
+			}
+			if next == nil || e.After(end) || (e.Equal(end) && s.Before(start)) {
+				next, start, end = sub, s, e
+			}
+		}
+		if next == nil {
+			return path
+		}
+		path = append(path, next)
+		cur = next
+	}
+}
+
+// times returns the start and end of the span (see TimespanEvent), and
+// false if it has no timespan events.
+func (t *Trace) times() (start, end time.Time, ok bool) {
+	e, err := t.TimespanEvent()
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	if end = e.End(); end.Before(e.Start()) {
+		end = e.Start()
+	}
+	return e.Start(), end, true
+}
+
 func (t *Trace) treeString(w io.Writer, depth int) {
 	const indent1 = "    "
 	indent := strings.Repeat(indent1, depth)
@@ -92,6 +242,8 @@ func (t *Trace) treeString(w io.Writer, depth int) {
 
 // findTraceTimes finds the minimum and maximum timespan event times for the
 // given set of events, or returns ok == false if there are no such events.
+// The end of an event with a recorded duration is its start plus the
+// duration (see EventDuration).
 func findTraceTimes(events []Event) (start, end time.Time, ok bool) {
 	// Find the start and end time of the trace.
 	var (
@@ -106,13 +258,13 @@ func findTraceTimes(events []Event) (start, end time.Time, ok bool) {
 		if !haveTimes {
 			haveTimes = true
 			eStart = e.Start()
-			eEnd = e.End()
+			eEnd = eventEnd(e)
 			continue
 		}
 		if v := e.Start(); v.UnixNano() < eStart.UnixNano() {
 			eStart = v
 		}
-		if v := e.End(); v.UnixNano() > eEnd.UnixNano() {
+		if v := eventEnd(e); v.UnixNano() > eEnd.UnixNano() {
 			eEnd = v
 		}
 	}
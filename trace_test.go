@@ -1,25 +1,30 @@
 package appdash
 
-import "testing"
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
 
 func TestTrace_TreeString(t *testing.T) {
 	t.Skip("TODO")
 
 	x := &Trace{
 		Span: Span{
-			ID:          SpanID{1, 1, 0},
+			ID:          SpanID{Trace: 1, Span: 1, Parent: 0},
 			Annotations: []Annotation{{Key: "k", Value: []byte("v")}},
 		},
 		Sub: []*Trace{
 			{
 				Span: Span{
-					ID:          SpanID{1, 2, 1},
+					ID:          SpanID{Trace: 1, Span: 2, Parent: 1},
 					Annotations: []Annotation{{Key: "k", Value: []byte("v")}},
 				},
 				Sub: []*Trace{
 					{
 						Span: Span{
-							ID:          SpanID{1, 3, 2},
+							ID:          SpanID{Trace: 1, Span: 3, Parent: 2},
 							Annotations: []Annotation{{Key: "k", Value: []byte("v")}},
 						},
 					},
@@ -27,19 +32,19 @@ func TestTrace_TreeString(t *testing.T) {
 			},
 			{
 				Span: Span{
-					ID:          SpanID{1, 4, 1},
+					ID:          SpanID{Trace: 1, Span: 4, Parent: 1},
 					Annotations: []Annotation{{Key: "k", Value: []byte("v")}},
 				},
 				Sub: []*Trace{
 					{
 						Span: Span{
-							ID:          SpanID{1, 5, 4},
+							ID:          SpanID{Trace: 1, Span: 5, Parent: 4},
 							Annotations: []Annotation{{Key: "k", Value: []byte("v")}},
 						},
 					},
 					{
 						Span: Span{
-							ID:          SpanID{1, 6, 4},
+							ID:          SpanID{Trace: 1, Span: 6, Parent: 4},
 							Annotations: []Annotation{{Key: "k", Value: []byte("v")}},
 						},
 					},
@@ -58,19 +63,19 @@ func TestTrace_TreeString(t *testing.T) {
 func TestTrace_FindSpan(t *testing.T) {
 	x := &Trace{
 		Span: Span{
-			ID:          SpanID{1, 1, 0},
+			ID:          SpanID{Trace: 1, Span: 1, Parent: 0},
 			Annotations: []Annotation{{Key: "k", Value: []byte("v")}},
 		},
 		Sub: []*Trace{
 			{
 				Span: Span{
-					ID:          SpanID{1, 2, 1},
+					ID:          SpanID{Trace: 1, Span: 2, Parent: 1},
 					Annotations: []Annotation{{Key: "k", Value: []byte("v")}},
 				},
 				Sub: []*Trace{
 					{
 						Span: Span{
-							ID:          SpanID{1, 3, 2},
+							ID:          SpanID{Trace: 1, Span: 3, Parent: 2},
 							Annotations: []Annotation{{Key: "k", Value: []byte("v")}},
 						},
 					},
@@ -90,3 +95,195 @@ func TestTrace_FindSpan(t *testing.T) {
 		}
 	}
 }
+
+// timedTrace returns a trace whose span has a timespan event from start to
+// end (in milliseconds after t0), with the children.
+func timedTrace(span ID, start, end int, sub ...*Trace) *Trace {
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	anns, err := MarshalEvent(Timespan{S: t0.Add(time.Duration(start) * time.Millisecond), E: t0.Add(time.Duration(end) * time.Millisecond)})
+	if err != nil {
+		panic(err)
+	}
+	return &Trace{Span: Span{ID: SpanID{Trace: 1, Span: span}, Annotations: anns}, Sub: sub}
+}
+
+// untimedTrace returns a trace whose span has no timespan events.
+func untimedTrace(span ID, sub ...*Trace) *Trace {
+	return &Trace{Span: Span{ID: SpanID{Trace: 1, Span: span}, Annotations: Annotations{{Key: "Name", Value: []byte("x")}}}, Sub: sub}
+}
+
+func TestTrace_Duration(t *testing.T) {
+	if d, ok := timedTrace(1, 10, 110).Duration(); !ok || d != 100*time.Millisecond {
+		t.Errorf("got duration %s (%v), want 100ms", d, ok)
+	}
+	if d, ok := untimedTrace(1).Duration(); ok {
+		t.Errorf("got duration %s of an untimed span, want none", d)
+	}
+}
+
+func TestTrace_SelfTime(t *testing.T) {
+	tests := []struct {
+		name  string
+		trace *Trace
+		want  time.Duration
+	}{
+		{"no children", timedTrace(1, 0, 100), 100 * time.Millisecond},
+		{"gapped children", timedTrace(1, 0, 100, timedTrace(2, 10, 20), timedTrace(3, 50, 80)), 60 * time.Millisecond},
+		{"overlapping children", timedTrace(1, 0, 100, timedTrace(2, 10, 50), timedTrace(3, 30, 60)), 50 * time.Millisecond},
+		{"nested children", timedTrace(1, 0, 100, timedTrace(2, 40, 50), timedTrace(3, 10, 90), timedTrace(4, 20, 30)), 20 * time.Millisecond},
+		{"children outside of the span", timedTrace(1, 0, 100, timedTrace(2, -20, 10), timedTrace(3, 90, 150), timedTrace(4, 200, 300)), 80 * time.Millisecond},
+		{"untimed children", timedTrace(1, 0, 100, untimedTrace(2), timedTrace(3, 0, 40)), 60 * time.Millisecond},
+		{"fully covered", timedTrace(1, 0, 100, timedTrace(2, 0, 60), timedTrace(3, 60, 100)), 0},
+		{"grandchildren", timedTrace(1, 0, 100, timedTrace(2, 0, 10, timedTrace(3, 0, 100))), 90 * time.Millisecond},
+	}
+	for _, test := range tests {
+		if got, ok := test.trace.SelfTime(); !ok || got != test.want {
+			t.Errorf("%s: got self time %s (%v), want %s", test.name, got, ok, test.want)
+		}
+	}
+	if d, ok := untimedTrace(1, timedTrace(2, 0, 10)).SelfTime(); ok {
+		t.Errorf("got self time %s of an untimed span, want none", d)
+	}
+}
+
+func TestTrace_CriticalPath(t *testing.T) {
+	spans := func(path []*Trace) []ID {
+		var ids []ID
+		for _, t := range path {
+			ids = append(ids, t.Span.ID.Span)
+		}
+		return ids
+	}
+	tests := []struct {
+		name  string
+		trace *Trace
+		want  []ID
+	}{
+		{"single span", timedTrace(1, 0, 100), []ID{1}},
+		{"last to end", timedTrace(1, 0, 100,
+			timedTrace(2, 0, 90, timedTrace(5, 0, 80)),
+			timedTrace(3, 50, 95, timedTrace(6, 50, 60), timedTrace(7, 60, 70)),
+			timedTrace(4, 10, 30),
+		), []ID{1, 3, 7}},
+		{"same end", timedTrace(1, 0, 100, timedTrace(2, 50, 100), timedTrace(3, 20, 100)), []ID{1, 3}},
+		{"untimed children", timedTrace(1, 0, 100, untimedTrace(2, timedTrace(4, 0, 100)), timedTrace(3, 0, 50)), []ID{1, 3}},
+		{"untimed root", untimedTrace(1, timedTrace(2, 0, 100)), nil},
+	}
+	for _, test := range tests {
+		if got := spans(test.trace.CriticalPath()); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got critical path %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+// deepTrace returns a chain of n spans, each the child of the previous one,
+// and each starting 1ms after it.
+func deepTrace(n int) *Trace {
+	root := timedTrace(1, 0, n)
+	for cur, i := root, 2; i <= n; i++ {
+		sub := timedTrace(ID(i), i-1, n)
+		cur.Sub = []*Trace{sub}
+		cur = sub
+	}
+	return root
+}
+
+// wideTrace returns a span with n children, in reverse order of their
+// start times, with every other one starting with the previous one.
+func wideTrace(n int) *Trace {
+	root := timedTrace(1, 0, n)
+	for i := n + 1; i >= 2; i-- {
+		root.Sub = append(root.Sub, timedTrace(ID(i), i/2, n))
+	}
+	return root
+}
+
+func TestTrace_Walk(t *testing.T) {
+	x := timedTrace(1, 0, 100,
+		timedTrace(2, 50, 60, timedTrace(4, 50, 55)),
+		timedTrace(3, 10, 20),
+	)
+	var got []ID
+	if err := x.Walk(func(t *Trace) error {
+		got = append(got, t.Span.ID.Span)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []ID{1, 2, 4, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got spans %v, want %v (depth first)", got, want)
+	}
+
+	stop := errors.New("stop")
+	got = nil
+	err := x.Walk(func(t *Trace) error {
+		got = append(got, t.Span.ID.Span)
+		if t.Span.ID.Span == 2 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Errorf("got error %v, want %v", err, stop)
+	}
+	if want := []ID{1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got spans %v, want %v (stopped)", got, want)
+	}
+
+	var n int
+	deepTrace(1000).Walk(func(*Trace) error { n++; return nil })
+	if n != 1000 {
+		t.Errorf("walked %d spans of the deep trace, want 1000", n)
+	}
+}
+
+func TestTrace_Flatten(t *testing.T) {
+	spans := func(flat []*Trace) []ID {
+		var ids []ID
+		for _, t := range flat {
+			ids = append(ids, t.Span.ID.Span)
+		}
+		return ids
+	}
+	if got, want := spans(timedTrace(1, 0, 10).Flatten()), []ID{1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("single span: got %v, want %v", got, want)
+	}
+	if got, want := spans(untimedTrace(1).Flatten()), []ID{1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("single untimed span: got %v, want %v", got, want)
+	}
+
+	deep := spans(deepTrace(100).Flatten())
+	for i, id := range deep {
+		if id != ID(i+1) {
+			t.Fatalf("deep trace: got %v, want the spans in order", deep)
+		}
+	}
+
+	// Spans 2 and 3 both start at 1ms, 4 and 5 at 2ms, and so on.
+	wide := spans(wideTrace(9).Flatten())
+	if want := []ID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}; !reflect.DeepEqual(wide, want) {
+		t.Errorf("wide trace: got %v, want %v", wide, want)
+	}
+
+	mixed := timedTrace(1, 0, 100,
+		untimedTrace(5, timedTrace(2, 30, 40)),
+		timedTrace(4, 10, 20),
+		untimedTrace(3),
+	)
+	if got, want := spans(mixed.Flatten()), []ID{1, 4, 2, 3, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("untimed spans: got %v, want %v (last)", got, want)
+	}
+}
+
+func TestTrace_FindSpan_deepAndWide(t *testing.T) {
+	for name, x := range map[string]*Trace{"deep": deepTrace(100), "wide": wideTrace(99)} {
+		for _, id := range []ID{1, 50, 100} {
+			if s := x.FindSpan(id); s == nil || s.Span.ID.Span != id {
+				t.Errorf("%s trace: got span %v, want %v", name, s, id)
+			}
+		}
+		if s := x.FindSpan(101); s != nil {
+			t.Errorf("%s trace: got span %v, want none", name, s)
+		}
+	}
+}
@@ -7,10 +7,12 @@ import (
 )
 
 // aggItem represents a set of traces with the name (label) and their cumulative
-// time.
+// time, and the number of their spans with the name that failed (see
+// appdash.IsError).
 type aggItem struct {
-	Label string `json:"label"`
-	Value int64  `json:"value"`
+	Label  string `json:"label"`
+	Value  int64  `json:"value"`
+	Errors int64  `json:"errors"`
 }
 
 type aggMode int
@@ -19,6 +21,7 @@ const (
 	traceOnly aggMode = iota
 	spanOnly
 	traceAndSpan
+	serviceOnly
 )
 
 // parseAggMode parses an aggregation mode:
@@ -26,6 +29,7 @@ const (
 //  "trace-only" -> traceOnly
 //  "span-only" -> spanOnly
 //  "trace-and-span" -> traceAndSpan
+//  "service" -> serviceOnly
 //
 func parseAggMode(s string) aggMode {
 	switch s {
@@ -35,6 +39,8 @@ func parseAggMode(s string) aggMode {
 		return spanOnly
 	case "trace-and-span":
 		return traceAndSpan
+	case "service":
+		return serviceOnly
 	default:
 		return traceOnly
 	}
@@ -44,8 +50,9 @@ func parseAggMode(s string) aggMode {
 func (a *App) aggregate(traces []*appdash.Trace, mode aggMode) ([]*aggItem, error) {
 	aggregated := make(map[string]*aggItem)
 
-	// up updates the aggregated map with the given label and value.
-	up := func(label string, value int64) {
+	// up updates the aggregated map with the given label and value, for a
+	// span that failed or not.
+	up := func(label string, value int64, failed bool) {
 		// Grab the aggregation item for the named trace, or create a new one if it
 		// does not already exist.
 		i, ok := aggregated[label]
@@ -55,6 +62,9 @@ func (a *App) aggregate(traces []*appdash.Trace, mode aggMode) ([]*aggItem, erro
 		}
 
 		// Perform aggregation.
+		if failed {
+			i.Errors++
+		}
 		i.Value += value
 		if i.Value == 0 {
 			i.Value = 1 // Must be positive values or else d3pie won't render.
@@ -70,14 +80,24 @@ func (a *App) aggregate(traces []*appdash.Trace, mode aggMode) ([]*aggItem, erro
 		}
 
 		if mode == traceOnly {
-			up(childProf.Name, childProf.TimeCum)
+			up(childProf.Name, childProf.TimeCum, childProf.Error)
 		} else if mode == spanOnly {
 			for _, spanProf := range profiles[1:] {
-				up(spanProf.Name, spanProf.Time)
+				up(spanProf.Name, spanProf.Time, spanProf.Error)
 			}
 		} else if mode == traceAndSpan {
 			for _, spanProf := range profiles[1:] {
-				up(fmt.Sprintf("%s: %s", childProf.Name, spanProf.Name), spanProf.Time)
+				up(fmt.Sprintf("%s: %s", childProf.Name, spanProf.Name), spanProf.Time, spanProf.Error)
+			}
+		} else if mode == serviceOnly {
+			// The time of all spans (including the root span), by the
+			// service that recorded them.
+			for _, spanProf := range profiles {
+				service := spanProf.Service
+				if service == "" {
+					service = "(unknown service)"
+				}
+				up(service, spanProf.Time, spanProf.Error)
 			}
 		}
 	}
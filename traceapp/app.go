@@ -27,6 +27,7 @@ import (
 	"path"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
 
@@ -87,6 +88,7 @@ func New(r *Router, base *url.URL) (*App, error) {
 	r.r.Get(TracesRoute).Handler(handlerFunc(app.serveTraces))
 	r.r.Get(DashboardRoute).Handler(handlerFunc(app.serveDashboard))
 	r.r.Get(DashboardDataRoute).Handler(handlerFunc(app.serveDashboardData))
+	r.r.Get(DashboardSeriesRoute).Handler(handlerFunc(app.serveDashboardSeries))
 	r.r.Get(AggregateRoute).Handler(handlerFunc(app.serveAggregate))
 
 	// Static file serving.
@@ -126,7 +128,7 @@ func (a *App) serveTrace(w http.ResponseWriter, r *http.Request) error {
 	}
 
 	// Look in the store for the trace.
-	traceID, err := appdash.ParseID(v["Trace"])
+	traceID, err := appdash.ParseIDLenient(v["Trace"], true)
 	if err != nil {
 		return err
 	}
@@ -138,7 +140,7 @@ func (a *App) serveTrace(w http.ResponseWriter, r *http.Request) error {
 
 	// Get sub-span if the Span route var is present.
 	if spanIDStr := v["Span"]; spanIDStr != "" {
-		spanID, err := appdash.ParseID(spanIDStr)
+		spanID, err := appdash.ParseIDLenient(spanIDStr, true)
 		if err != nil {
 			return err
 		}
@@ -225,16 +227,27 @@ func (a *App) serveTraces(w http.ResponseWriter, r *http.Request) error {
 	var showJust []appdash.ID
 	if show := r.URL.Query().Get("show"); len(show) > 0 {
 		for _, idStr := range strings.Split(show, ",") {
-			id, err := appdash.ParseID(idStr)
+			id, err := appdash.ParseIDLenient(idStr, true)
 			if err == nil {
 				showJust = append(showJust, id)
 			}
 		}
 	}
 
-	traces, err := a.Queryer.Traces(appdash.TracesOpts{
-		TraceIDs: showJust,
-	})
+	opts := appdash.TracesOpts{TraceIDs: showJust}
+
+	// Parse the filters: the minimum duration of the traces, and the
+	// annotations (as "key=value") that one of their spans must have.
+	if d, err := time.ParseDuration(r.URL.Query().Get("min-duration")); err == nil {
+		opts.MinDuration = d
+	}
+	for _, kv := range r.URL.Query()["annotation"] {
+		if i := strings.Index(kv, "="); i > 0 {
+			opts.Matchers = append(opts.Matchers, appdash.AnnotationMatcher{Key: kv[:i], Value: kv[i+1:]})
+		}
+	}
+
+	traces, err := appdash.QueryTraces(a.Queryer, opts)
 	if err != nil {
 		return err
 	}
@@ -253,7 +266,7 @@ func (a *App) serveTraces(w http.ResponseWriter, r *http.Request) error {
 
 func (a *App) serveAggregate(w http.ResponseWriter, r *http.Request) error {
 	// By default we display all traces.
-	traces, err := a.Queryer.Traces(appdash.TracesOpts{})
+	traces, err := appdash.QueryTraces(a.Queryer, appdash.TracesOpts{})
 	if err != nil {
 		return err
 	}
@@ -266,7 +279,7 @@ func (a *App) serveAggregate(w http.ResponseWriter, r *http.Request) error {
 	if len(selection) > 0 {
 		var selected []*appdash.Trace
 		for _, idStr := range strings.Split(selection, ",") {
-			id, err := appdash.ParseID(idStr)
+			id, err := appdash.ParseIDLenient(idStr, true)
 			if err != nil {
 				return err
 			}
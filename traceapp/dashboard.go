@@ -9,16 +9,28 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"sourcegraph.com/sourcegraph/appdash"
 )
 
 // dashboardRow represents a single row in the dashboard. It is encoded to JSON.
 type dashboardRow struct {
 	Name                      string
 	Average, Min, Max, StdDev time.Duration
+	P50, P95, P99             time.Duration
 	Timespans                 int
 	URL                       string
 }
 
+// seriesPoint represents a single bucket of time in the time series of a
+// root span name. It is encoded to JSON.
+type seriesPoint struct {
+	Start                     time.Time
+	Average, Min, Max, StdDev time.Duration
+	P50, P95, P99             time.Duration
+	Timespans                 int
+}
+
 // serverDashboard serves the dashboard page.
 func (a *App) serveDashboard(w http.ResponseWriter, r *http.Request) error {
 	if a.Aggregator == nil {
@@ -32,13 +44,30 @@ func (a *App) serveDashboard(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
+	// Show the number of traces and spans in the store, if it counts them.
+	var (
+		numTraces, numSpans int
+		haveCounts          bool
+	)
+	if c, ok := a.Store.(appdash.Counter); ok {
+		var errTraces, errSpans error
+		numTraces, errTraces = c.NumTraces()
+		numSpans, errSpans = c.NumSpans()
+		haveCounts = errTraces == nil && errSpans == nil
+	}
+
 	return a.renderTemplate(w, r, "dashboard.html", http.StatusOK, &struct {
 		TemplateCommon
-		DataURL       string
-		HaveDashboard bool
+		DataURL             string
+		HaveDashboard       bool
+		HaveCounts          bool
+		NumTraces, NumSpans int
 	}{
 		DataURL:       uData.String(),
 		HaveDashboard: a.Aggregator != nil,
+		HaveCounts:    haveCounts,
+		NumTraces:     numTraces,
+		NumSpans:      numSpans,
 	})
 }
 
@@ -97,6 +126,9 @@ func (a *App) serveDashboardData(w http.ResponseWriter, r *http.Request) error {
 			Min:       r.Min / time.Millisecond,
 			Max:       r.Max / time.Millisecond,
 			StdDev:    r.StdDev / time.Millisecond,
+			P50:       r.P50 / time.Millisecond,
+			P95:       r.P95 / time.Millisecond,
+			P99:       r.P99 / time.Millisecond,
 			Timespans: int(r.Samples),
 			URL:       tracesURL.String(),
 		}
@@ -112,3 +144,53 @@ func (a *App) serveDashboardData(w http.ResponseWriter, r *http.Request) error {
 	_, err = io.Copy(w, bytes.NewReader(j))
 	return err
 }
+
+// serveDashboardSeries serves the JSON time series of the aggregations of
+// the root span with the given name, per bucket of time, over the given
+// window (6 hours by default), so that its trends can be charted.
+func (a *App) serveDashboardSeries(w http.ResponseWriter, r *http.Request) error {
+	sa, ok := a.Aggregator.(appdash.SeriesAggregator)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "Dashboard time series are disabled.")
+		return nil
+	}
+
+	query := r.URL.Query()
+	name := query.Get("name")
+	if name == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "The name of the root span is required.")
+		return nil
+	}
+	window := 6 * time.Hour
+	if s := query.Get("window"); len(s) > 0 {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		window = d
+	}
+
+	buckets, err := sa.AggregateSeries(name, -window, 0)
+	if err != nil {
+		return err
+	}
+	points := make([]*seriesPoint, len(buckets))
+	for i, b := range buckets {
+		points[i] = &seriesPoint{
+			Start:     b.Start,
+			Average:   b.Average / time.Millisecond,
+			Min:       b.Min / time.Millisecond,
+			Max:       b.Max / time.Millisecond,
+			StdDev:    b.StdDev / time.Millisecond,
+			P50:       b.P50 / time.Millisecond,
+			P95:       b.P95 / time.Millisecond,
+			P99:       b.P99 / time.Millisecond,
+			Timespans: int(b.Samples),
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(points)
+}
@@ -12,8 +12,10 @@ import (
 
 type profile struct {
 	Name                        string
+	Service                     string // see appdash.Recorder.WithService
 	URL                         string
 	Time, TimeChildren, TimeCum int64
+	Error                       bool // whether the span has an appdash.ErrorEvent
 }
 
 // calcProfile calculates a profile for the given trace and appends it to the
@@ -44,8 +46,10 @@ func (a *App) calcProfile(buf []*profile, t *appdash.Trace) (prof []*profile, ch
 	// Initialize the span's profile structure. We use either the span's given
 	// name, or it's ID as a string if it has no given name.
 	p := &profile{
-		Name: t.Span.Name(),
-		URL:  u.String(),
+		Name:    t.Span.Name(),
+		Service: t.Span.Service(),
+		URL:     u.String(),
+		Error:   appdash.IsError(t.Span.Annotations),
 	}
 	if len(p.Name) == 0 {
 		p.Name = t.Span.ID.Span.String()
@@ -59,7 +63,7 @@ func (a *App) calcProfile(buf []*profile, t *appdash.Trace) (prof []*profile, ch
 			continue
 		}
 		// To match the timeline properly we use floats and round up.
-		msf := float64(ts.End().Sub(ts.Start())) / float64(time.Millisecond)
+		msf := float64(appdash.EventDuration(ts)) / float64(time.Millisecond)
 		ms := int64(msf + 0.5)
 		if ms > p.Time {
 			p.Time = ms
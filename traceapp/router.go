@@ -20,6 +20,7 @@ const (
 	TracesRoute           = "traceapp.traces"             // route name for traces page
 	DashboardRoute        = "traceapp.dashboard"          // route name for dashboard page
 	DashboardDataRoute    = "traceapp.dashboard.data"     // route name for dashboard JSON data
+	DashboardSeriesRoute  = "traceapp.dashboard.series"   // route name for dashboard JSON time series
 	AggregateRoute        = "traceapp.aggregate"          // route name for aggregate trace view
 )
 
@@ -42,6 +43,7 @@ func NewRouter(base *mux.Router) *Router {
 	base.Path("/traces").Methods("GET").Name(TracesRoute)
 	base.Path("/dashboard").Methods("GET").Name(DashboardRoute)
 	base.Path("/dashboard/data").Methods("GET").Name(DashboardDataRoute)
+	base.Path("/dashboard/series").Methods("GET").Name(DashboardSeriesRoute)
 	base.Path("/aggregate").Methods("GET").Name(AggregateRoute)
 	return &Router{base}
 }
@@ -10,8 +10,10 @@ import (
 	"net/url"
 
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"sourcegraph.com/sourcegraph/appdash"
 	"sourcegraph.com/sourcegraph/appdash/traceapp/tmpl"
@@ -92,6 +94,11 @@ func (a *App) parseHTMLTemplates(sets [][]string) error {
 			"str":               func(v interface{}) string { return fmt.Sprintf("%s", v) },
 			"durationClass":     durationClass,
 			"filterAnnotations": filterAnnotations,
+			"isError":           appdash.IsError,
+			"isErrorAnnotation": isErrorAnnotation,
+			"rawEvents":         rawEvents,
+			"logLevelLabel":     logLevelLabel,
+			"fieldLogTable":     newFieldLogTable,
 			"descendTraces":     func() bool { return false },
 			"dict":              dict,
 		})
@@ -148,6 +155,7 @@ func filterAnnotations(anns appdash.Annotations) appdash.Annotations {
 	var anns2 appdash.Annotations
 	for _, ann := range anns {
 		if ann.Key != "" && !strings.HasPrefix(ann.Key, "_") {
+			ann.Key = appdash.UnescapeKey(ann.Key)
 			anns2 = append(anns2, ann)
 		}
 	}
@@ -155,6 +163,82 @@ func filterAnnotations(anns appdash.Annotations) appdash.Annotations {
 
 }
 
+// isErrorAnnotation reports whether ann is one of the annotations of an
+// appdash.ErrorEvent, which are highlighted in the span views.
+func isErrorAnnotation(ann appdash.Annotation) bool {
+	return strings.HasPrefix(ann.Key, "Error.")
+}
+
+// rawEvents returns the events of anns whose schemas aren't registered (or
+// that fail to unmarshal), which the span views display generically.
+func rawEvents(anns appdash.Annotations) []appdash.RawEvent {
+	var events []appdash.Event
+	appdash.UnmarshalEventsTolerant(anns, &events)
+	var raw []appdash.RawEvent
+	for _, e := range events {
+		if e, ok := e.(appdash.RawEvent); ok {
+			raw = append(raw, e)
+		}
+	}
+	return raw
+}
+
+// logLevelLabel returns the Bootstrap label class of a log level.
+func logLevelLabel(l appdash.LogLevel) string {
+	switch {
+	case l >= appdash.LevelError:
+		return "danger"
+	case l >= appdash.LevelWarn:
+		return "warning"
+	case l >= appdash.LevelInfo:
+		return "info"
+	}
+	return "default"
+}
+
+// A fieldLogTable is a table of the structured log messages of a span
+// (see appdash.LogFieldsEvent), with a column for each of their field
+// keys.
+type fieldLogTable struct {
+	Columns []string
+	Rows    []fieldLogRow
+}
+
+// A fieldLogRow is a structured log message, with the values of its fields
+// in the order of the columns of its table ("" for the missing fields).
+type fieldLogRow struct {
+	Time   time.Time
+	Values []string
+}
+
+// newFieldLogTable returns the table of the structured log messages of anns,
+// sorted by time, or nil if there are none.
+func newFieldLogTable(anns appdash.Annotations) *fieldLogTable {
+	logs := anns.FieldLogs()
+	if len(logs) == 0 {
+		return nil
+	}
+	t := &fieldLogTable{}
+	seen := map[string]bool{}
+	for _, l := range logs {
+		for k := range l.Fields {
+			if !seen[k] {
+				seen[k] = true
+				t.Columns = append(t.Columns, k)
+			}
+		}
+	}
+	sort.Strings(t.Columns)
+	for _, l := range logs {
+		row := fieldLogRow{Time: l.Time, Values: make([]string, len(t.Columns))}
+		for i, k := range t.Columns {
+			row.Values[i] = l.Fields[k]
+		}
+		t.Rows = append(t.Rows, row)
+	}
+	return t
+}
+
 // dict builds a map of paired items, allowing you to invoke a template with
 // multiple parameters.
 func dict(pairs ...interface{}) (map[string]interface{}, error) {
@@ -33,15 +33,15 @@ var Data = func() http.FileSystem {
 		},
 		"/aggregate.html": &_vfsgen_compressedFileInfo{
 			name:              "aggregate.html",
-			modTime:           mustUnmarshalTextTime("2015-10-04T03:50:12Z"),
-			compressedContent: []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\xa4\x57\x6d\x73\x13\x39\x12\xfe\x8c\x7f\x45\xa3\x04\x62\x73\x9e\x99\x98\x2b\xee\xc0\xd8\x4e\x71\x70\xc5\x5d\xd5\x51\xb9\x4b\xb8\xe5\x03\xc5\x07\x79\xa6\x3d\x16\x91\xa5\x59\x49\xe3\xc4\xeb\x9d\xff\xbe\x2d\x8d\xe7\xc5\x24\x6c\xed\x16\x5b\xb5\x8e\xdd\x6a\x3d\xdd\xfd\xf4\x9b\x18\xec\xf7\x19\xae\x84\x42\x60\x1f\x85\x93\xc8\xaa\xea\x4d\x9e\x1b\xcc\xb9\x43\xf8\x49\xe0\x2d\x44\xc0\x8b\x22\xe3\x76\xbd\xdf\xa3\xca\xaa\xaa\x77\xe3\x03\x17\x8a\x2e\x0c\x06\x33\xeb\x76\x12\xc1\xed\x0a\x9c\x33\x87\x77\x2e\x49\xad\x65\x8b\x01\xc0\xda\x6d\xe4\x78\xa9\xb3\x1d\xec\xe9\x17\x40\xf2\x0c\xde\x09\xcb\x97\xa4\xbd\x45\xe3\x44\xca\x25\xd8\xd4\x68\x29\x97\xdc\x40\x56\x12\x88\x86\x94\xab\x2d\xb7\xb0\x44\xa1\x72\xaf\xb6\x03\xa9\x55\x1e\xc3\xb3\x24\x60\x68\x12\xad\xa4\xbe\x8d\x76\x53\x58\x8b\x2c\x43\xf5\x9a\xe4\x15\xfd\x7f\xe2\x74\x11\x19\x91\xaf\x5d\xb4\x74\xca\x1e\x6c\x6e\xb8\xc9\x85\x8a\xe8\x6c\x0a\xcf\x5f\x14\x77\xad\x76\x21\xf0\xed\x9a\x1b\x77\xd0\xbb\x15\x99\x5b\x4f\xe1\xe5\xf9\x79\xad\x43\xde\xa3\xc7\x9a\xc2\xdf\x3a\xd1\x01\x4c\xe2\x8a\xe4\xbc\x74\xfa\x48\x6c\x6a\xfd\x5a\x7e\x08\x38\xfc\x01\x78\x5b\x07\x25\x6c\x17\xd1\x18\xac\x86\x5b\x04\xbd\x5a\x59\x74\x20\x1c\x2c\x77\x30\xf1\xb6\x62\xf8\x84\x90\xea\x52\x66\xb0\xe6\x2a\x27\x56\xd6\x78\xa0\xe5\x00\x67\xc5\x2f\x08\xcb\x32\xdc\xba\x0d\x8a\xb8\x5a\x61\xea\xc4\x16\xe5\x0e\x88\xd1\x02\x34\x9d\x5a\xbd\xf1\xf8\xe1\xbe\xe4\x4b\x94\x16\x28\x3d\x94\x48\x4f\x2d\x29\xdc\x72\x93\x1d\x10\x57\x46\x6f\x6a\x3b\x9e\x93\x20\x3c\x10\x5e\x68\x2b\x9c\xd0\x6a\x0a\x06\x25\xf7\x26\xea\xa0\x03\xa3\xd1\xa4\x21\xa7\x1a\xcc\x92\x50\x08\x0b\xaa\x88\xc7\x51\x54\xd7\xcf\x07\x9d\x21\x6c\x50\x95\x10\x45\x8b\xc1\x2c\x13\x5b\x48\x25\xb7\x76\xce\x28\x45\x51\x6e\x74\x59\x40\x51\x4a\x59\x73\xc7\x80\x6a\x81\x8a\x28\xc8\x19\x70\x23\x78\x14\xfc\x9e\xb3\x38\x8e\x19\x88\x8c\x0a\xec\x28\xc9\xa1\xcc\x66\xc4\x84\xd3\xea\x50\x81\xf5\x0f\xd6\xb3\x03\xde\x16\x95\x2d\x2f\xa5\x83\x8c\xc8\xc9\xf4\xad\xaf\x88\x3c\xa7\x92\x87\x8c\x3b\x7e\xf8\x31\x67\xcd\xe9\xc1\x38\xde\x15\x5c\x65\x48\x66\x57\x5c\x5a\x52\x76\xbe\x4d\xe6\x2c\x5d\x6b\x6d\xeb\xbc\xf0\xa6\x61\xb2\x80\x04\x5b\x0a\xdb\xd3\xbb\xa1\xc8\x83\x77\xd0\x63\x62\x66\x09\xaf\xf1\x2c\xe5\x06\x1d\x5b\x10\x6d\x24\x0c\x71\x24\xb5\xef\xe1\x7b\x29\x1b\xbd\xd6\x63\xcf\x63\x43\x51\xf8\x5e\xc3\xcf\xa4\x58\xcc\x38\xac\x0d\xae\xe6\xec\xa4\x66\xc9\x7b\x11\x79\x17\x22\x67\x78\x8a\x91\x56\x72\xd7\x7a\xdf\xba\x0c\xe1\x90\x10\xb5\x8b\x82\x67\x8a\x6f\xd0\x42\x50\x5e\x5c\x91\x14\xae\x49\x6a\x67\x09\x27\x2f\xc9\xca\x1f\x30\xe7\x61\x7e\xdf\x9a\x2d\x97\xf7\x8d\x5d\x97\xcb\x3f\x6f\xab\x0e\x8d\x12\x14\xf0\x1e\x30\xc8\xa5\x6c\x8c\xb6\x06\xd9\xe2\x0d\x49\xef\xd9\x9a\x25\xa5\xa4\x02\x4d\xa8\x42\x7d\x01\xaf\x27\x8b\x37\x5d\x62\x7d\x02\x67\x09\xc9\x06\x75\x09\x7b\x37\x9a\xf1\xe1\x13\x78\xb8\x44\xa3\x4c\x14\xd4\x75\x26\x9d\xb3\xfd\x3e\xfe\x07\xb7\xf8\xff\xab\xff\x54\x95\x75\xd4\x36\x69\xb2\x44\x75\x83\xa8\x92\xec\xaf\x74\xb7\xfe\x8c\x37\x42\xc5\x5f\x6d\x28\x82\x70\x79\xd1\xa2\xf4\xc6\xe9\x57\x4e\x9d\x1f\xa4\x21\xe3\xa7\x43\x2a\x30\x2a\x88\x51\x2c\x35\xcf\x86\xab\x52\xa5\xbe\x3f\x87\xa3\x66\xca\x26\xf0\xde\xf0\xe5\x83\xd5\xd9\xb6\xb9\xc3\x4d\x21\x3d\x47\x05\x37\x44\x8b\x43\x33\x06\x6d\x40\x84\x61\x61\x90\x26\xd5\xe0\xd1\x23\x42\x52\x5a\xe1\x18\x56\xfc\x86\xb0\x68\xec\x28\xea\x92\x1a\x09\x25\x52\x0d\x3a\x58\xd1\x2d\x0f\x48\xd1\xd4\xb3\xc3\xcf\x70\xeb\x04\x91\x6c\x68\xd2\xa0\x89\x83\x53\x5b\x3f\xe0\xfd\xbd\x39\x10\x35\x1d\xb7\x55\x55\x4f\x13\xb1\x1a\xfa\xe3\x58\xa2\xca\xdd\x1a\xe6\x73\x38\x6f\xe2\x81\xe6\xe2\xe7\x3d\x0b\xd3\x80\x4d\x81\x29\x5d\x67\xd6\x7a\x73\x6d\x94\x6c\x0c\x6c\xcb\x65\x89\xa4\x32\xa9\xbe\xd4\xd0\xb4\xa2\x42\x28\x6f\x0d\x86\x2a\xec\x3b\xdb\x39\xe7\x45\x73\x50\xd4\xa9\x21\x33\xc3\x2e\xc1\xe3\xd6\x0f\xe6\xe7\x2e\x41\x37\xbf\x49\x52\x8f\xe5\x7f\x85\x55\xc1\xc2\xfa\x18\x7f\x7b\xf8\xc9\x6f\x96\x7b\x67\x04\xff\x6f\xa5\xd0\x5c\xf1\x4c\x94\xd6\x87\xf4\xf2\xfc\x09\x6b\x14\xaa\xe6\x0b\xcd\x3b\x2d\x9d\x28\xec\xb1\x59\x54\x7e\x8b\x66\x24\x74\xa6\xc4\x1e\xac\x2f\x1b\x0f\x46\xc9\x4d\x71\xad\x25\x25\x80\xf5\x8e\xad\x33\x94\x43\xaf\xb0\x0f\x54\x56\xb4\xe1\xf7\x81\xb1\x6a\x63\xfd\xf7\x02\x4d\x4a\x69\xe5\x39\x56\x4f\x8e\x2f\xd2\x68\x3f\x76\x82\xa4\x4b\x9e\xde\xf8\x61\xad\xb2\xcb\x82\xa7\xc2\xed\x48\xe1\x3c\xfe\xfb\x8b\x56\xa7\xba\x17\x8f\xcf\xe5\x71\x2c\x56\x1b\x77\x69\xbc\xa3\xd3\x43\xf6\x68\x58\xdb\xf4\xc8\xfa\x86\x5a\xf9\x1a\x73\x5f\x71\xef\xfd\x72\xa8\x83\x38\xf2\xe5\x7b\x94\x40\xaf\x24\xee\x4b\x3f\x36\x7c\xb5\x71\xb3\x23\xa5\xb6\xe0\x2e\x7d\x5f\xc0\x90\x48\xa0\x92\xa3\xb5\x0c\x93\x27\xa3\x63\xd5\x54\x4b\x1d\x62\x38\x49\xc3\x7f\xac\x63\xa1\x5f\x13\x5a\xd1\x06\xf6\xb5\xe2\x99\x18\xf4\x69\xaa\x46\x61\x91\x8e\xc2\xe3\x81\x0a\xf6\x1a\x91\x9e\x50\xae\x98\x26\xb4\x59\x89\xe9\xe6\xe9\x13\xa7\x7a\x93\xfc\x5c\xa2\xf5\x6d\x6f\x93\x17\xaf\x5e\xbd\x9a\x4c\x5e\x26\x3c\xcb\x22\x6d\xa2\x92\xde\x6b\x0e\x23\x3a\x37\xbb\xa8\xce\x77\xd4\x36\x39\x01\x37\xf3\x02\x6a\xc5\xff\x79\xbd\xeb\xa0\xf6\xdf\x46\x6b\x58\x1a\x31\x86\x1b\xdc\x8d\x21\x90\xd4\x74\xa2\xef\x13\xd3\xb4\xc9\x15\xe6\xff\xbc\x2b\x86\x6c\xf8\xf9\xe2\xe9\x97\x11\x83\xbf\xf8\x0b\xf4\xc9\xe6\xf1\xb3\x8b\xe1\xd3\x5f\x4f\x47\xbe\x1b\x05\x1b\xbd\x6e\xef\x5a\xf4\x8e\x38\x9a\x18\x73\x20\x13\x31\x8d\x31\xbc\xbb\x5c\x0d\xcf\x2e\xce\x46\xf0\x98\x7a\x3e\x9a\xc0\x05\xb0\xa7\x0c\x88\xc5\x0b\xd6\x4c\x06\xf0\xfe\xc4\x1b\xee\xd2\xf5\xd0\xe0\xa8\x9b\x0b\xb4\x3f\x4b\xa3\x02\x94\xc1\x50\xf1\x74\x3e\x86\xb3\xd3\xc9\x59\xcf\x1d\xef\x5a\x08\x83\xfe\x9e\x9d\x3e\x3f\x1b\x35\x63\xc1\x7f\xd2\x9b\x08\x1f\xc0\x23\xd5\xce\xd9\x07\xa0\x3a\x88\x6a\xd0\xe7\xd4\x2f\x27\xbf\xe9\x87\x7e\xd7\xf4\x69\x2b\x7d\xc8\xdf\x27\xbc\x9e\xe8\x34\xd0\x53\xee\x71\x62\xbf\xf1\xfc\x2c\x6b\x76\x1d\x51\x19\x10\x3b\x4a\x1e\xba\x41\x1c\x42\xd9\xd1\xf3\xa0\x0a\x69\x7c\xe3\xfc\xe9\x90\x9d\x3c\xf8\x5e\x18\xc5\xa9\x14\xe9\x4d\xb7\x61\xda\x88\x30\x2e\x0c\x6e\xa9\x8c\xdf\xd5\xaf\xaa\x61\x93\xe4\x26\x7c\xd6\x87\xa9\xab\xfa\x9e\xa5\xee\xa9\xf0\x23\x86\x7a\x28\xdf\xb1\xf3\xcd\x33\xe1\xc7\xa3\xea\xa0\x0e\x16\xbb\xed\x3d\x68\xfe\x9d\xf4\x5b\x00\x00\x00\xff\xff\x5c\xee\xf8\x38\x5b\x0d\x00\x00"),
-			uncompressedSize:  3419,
+			modTime:           mustUnmarshalTextTime("2026-10-17T12:00:00Z"),
+			compressedContent: []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\xa4\x57\x5d\x93\xdb\xb6\x15\x7d\x0e\x7f\xc5\x31\xbc\xf6\x4a\xb6\x48\xae\xd2\x71\x6b\x2b\xa2\x76\x5c\xa7\x93\x76\xa6\x99\x6d\x77\xd3\xe6\x21\x93\x07\x88\xb8\x12\x91\x85\x00\x06\x00\xa5\x55\x55\xfe\xf7\x0e\x40\x51\x1f\xde\xb5\xdb\xc6\x7e\xb0\x29\xe0\xe2\xdc\x73\x0f\xee\x07\x9c\xec\x76\x82\x16\x52\x13\xd8\x0f\xd2\x2b\x62\x6d\xfb\x7e\xb9\xb4\xb4\xe4\x9e\xf0\x4f\x49\x1b\xa4\xe0\x75\x2d\xb8\xab\x76\x3b\xd2\xa2\x6d\x4f\x4e\x7c\xcf\xa5\x66\x6d\x9b\x24\x53\xe7\xb7\x8a\xe0\xb7\x35\x15\xcc\xd3\x83\xcf\x4b\xe7\xd8\x2c\x01\x2a\xbf\x52\xa3\xb9\x11\x5b\xec\x12\x00\xc8\x5f\xe1\x5b\xe9\xf8\x5c\x11\xd6\x64\xbd\x2c\xb9\x82\x2b\xad\x51\x6a\xce\x2d\x44\x43\xf0\x06\x25\xd7\x6b\xee\x30\x27\xa9\x97\xc1\x6c\x0b\x65\xf4\x32\xc3\xab\x3c\x62\x98\x35\xd9\x85\x32\x9b\x74\x3b\x41\x25\x85\x20\xfd\x4d\x02\xb4\x09\xf0\xdc\x9b\x3a\xb5\x72\x59\xf9\x74\xee\xb5\xdb\xfb\x5c\x71\xbb\x94\x3a\xf5\xa6\x9e\xe0\xeb\x37\xf5\xc3\xc1\xba\x96\xf4\xa1\xe2\xd6\xef\xed\x36\x52\xf8\x6a\x82\xb7\x57\x57\x9d\x0d\x50\x51\xc0\x9a\xe0\xf7\xc7\xa5\x3d\x98\xa2\x85\x9f\x80\x37\xde\x9c\x2d\xdb\xce\xbe\x5b\xdf\x07\x1c\xff\x01\x3e\x74\x41\x49\x77\x8c\x68\x04\x67\xb0\x21\x98\xc5\xc2\x91\x87\xf4\x98\x6f\x31\x0e\xbe\x32\xfc\x48\x28\x4d\xa3\x04\x2a\xae\x97\x04\x5f\xd1\x5e\x96\x3d\x9c\x93\xff\x22\xcc\x9b\x78\x6a\x13\x0d\x69\xb1\xa0\xd2\xcb\x35\xa9\x2d\x4a\x6b\x6a\x98\xc6\xc3\x99\x55\xc0\x8f\xe7\x15\x9f\x93\x72\xa0\x07\x4f\x5a\x04\x69\x4d\xe3\x37\xdc\x8a\x3d\xe2\xc2\x9a\x55\xe7\x27\x68\x12\x17\xf7\x82\xd7\xc6\x49\x2f\x8d\x9e\xc0\x92\xe2\xc1\x45\x17\x74\x54\x34\x1d\xf7\xe2\xb4\xc9\x34\x8f\x89\x30\x4b\x92\xe9\xb3\x34\xed\xf2\xe7\x7b\x23\x08\x2b\xd2\x0d\xd2\x74\x96\x4c\x85\x5c\xa3\x54\xdc\xb9\x82\xcd\xbd\x4e\x97\xd6\x34\x35\xea\x46\xa9\x4e\x3b\x06\x6b\x14\x15\x2c\xae\x33\x70\x2b\x79\x1a\x79\x17\x2c\xcb\x32\x06\x29\x0a\x76\x7e\xc9\x31\xcd\xa6\xf3\xc6\x7b\xa3\xf7\x19\xd8\xfd\x60\x27\x7e\x10\x7c\x09\x5a\xf0\x46\x79\x08\x6b\x6a\x61\x36\x21\x23\x96\x4b\x45\x0c\x82\x7b\xbe\xff\x51\xb0\x7e\x77\xef\x9c\x1e\x6a\xae\x05\x89\x82\x2d\xb8\x72\xc4\xe0\x43\x99\x14\xac\xac\x8c\x71\xdd\xbd\xf0\xbe\x60\x44\x44\xc2\x5a\xd2\x26\xc8\xbb\x32\x82\x22\x3b\x9c\x28\x31\x75\x35\xd7\x3d\xb3\x92\x5b\xf2\x6c\x36\xcd\xc3\x62\x8c\x23\xef\xb8\xc7\xef\x46\xf5\x76\x07\xc6\x41\xc7\x5e\xa2\xf8\xdd\xc1\x4f\x95\x9c\x4d\x39\x2a\x4b\x8b\x82\x3d\xef\x54\x0a\x2c\xd2\x40\x21\xf5\x96\x97\x94\x1a\xad\xb6\x07\xf6\x07\xca\x88\x9b\xb0\xc6\xf8\x34\x32\xd3\x7c\x45\x0e\xd1\x78\x76\x6b\x8c\xc7\x5d\xcd\xb5\x9b\xe6\x7c\x36\xcd\x95\xfc\x5f\xdc\x05\x98\xcf\x7b\x73\xcd\xfc\xb1\xb3\xbb\x66\xfe\xff\xfb\xea\x42\xe3\x5a\x44\xbc\x27\x1c\x72\xa5\x7a\xa7\x07\x87\x6c\xf6\x5e\xa9\xdf\x10\x17\xd9\xb5\x2c\xe9\xbf\x3a\x71\xa1\x8a\x43\x5e\xec\x0f\xc0\x57\xdc\xc3\x52\x69\xac\x20\x11\x76\x56\x6c\x76\xd7\xed\x9d\x11\x98\xe6\x8d\x9a\x25\xd3\x5c\xc8\x75\xa8\xa0\x6a\x3c\x7b\x7f\xcc\xac\x90\x41\xd3\xbc\x1a\xcf\x92\xae\x86\x02\xb7\xbe\x7f\xb1\xd9\xe1\x90\x2b\xad\xac\x3d\x9c\x2d\x0b\xb6\xdb\x65\x7f\xe4\x8e\xfe\x71\xfb\xd7\xb6\x75\x9e\x7b\x59\xe6\x73\xd2\xf7\x44\x3a\x17\xbf\xab\x25\x75\x7f\x67\x2b\xa9\xb3\x5f\x5c\xcc\xc2\x78\x78\x76\x40\x39\xe9\xe7\xbf\xf0\x35\xef\x56\x63\xca\x5d\x0c\x36\x52\x0b\xb3\x19\x66\xca\x70\x31\x58\x34\xba\x0c\x0d\x62\x30\xec\xdb\x7c\x8e\xef\x2c\x9f\x3f\x59\x1e\x87\x3e\xe3\x69\x55\x2b\xee\x09\x35\xb7\x7c\x45\x9e\xec\x08\xc6\x42\xc6\x6e\x65\x09\xd2\x25\x5f\x7d\x95\xe7\xd0\x46\xd3\x08\x0b\x7e\x4f\xe0\x70\x52\x2f\x15\x75\x48\xa4\x68\x45\xda\x63\x61\x6c\x04\xac\xe5\xbe\x79\xc1\x1b\x38\x2f\x95\x82\x25\x2d\xc8\x66\x09\x00\xac\xb9\xed\xce\x15\xd8\xed\xb2\xa3\xb6\x6d\xdb\xb5\x33\xb9\x18\x84\xed\x4c\x91\x5e\xfa\x0a\x45\x81\xab\x3e\x1e\xf4\x07\x7f\xda\xb1\xd8\x8e\xd8\x04\x4c\x9b\xee\xd6\x5d\x70\x77\x88\x92\x8d\xc0\xd6\x5c\x35\xc4\x26\x18\xb7\x3f\x77\xd0\x6d\xd2\x85\xf2\xc1\x52\x2c\x83\x53\xb2\x47\x72\x61\xa9\x80\xa6\x0d\xe2\xcd\x0c\x8e\x17\x3c\x3a\xf0\x60\xa1\xf1\xb3\xc9\xe1\x37\xc0\xba\xb9\xf0\xe7\x38\xab\x58\x9c\x5f\xa3\x8f\x37\x7f\x0c\xa3\xed\xd1\x5e\x2d\xe9\x2f\x5a\x93\xbd\xe5\x42\x36\x2e\x84\xf4\xf6\xea\x05\xeb\x0d\xda\xfe\x83\x79\x63\x94\x97\xb5\x3b\x77\x4b\x3a\x8c\x71\xc1\x26\xf0\xb6\xa1\x13\xd8\x90\x36\x01\xac\x56\xbc\xa4\xca\x28\x41\x96\x9d\x6c\x3b\x6f\xa5\x5e\x06\x83\x5d\x94\xb2\x45\x8a\x5d\x54\xac\x5d\xb9\xf0\x5d\x93\x2d\x49\x7b\xbe\xa4\xf6\xc5\xf9\xc1\xad\xa2\x73\x12\x00\x9b\xf3\xf2\x3e\x4c\x0b\x2d\x6e\x6a\x5e\x4a\xbf\x65\x13\x5c\x65\x7f\x78\x73\xb0\x69\x1f\xc5\x13\xee\xf2\x3c\x16\x67\xac\xbf\xb1\x81\xe8\x64\x7f\x7b\xa9\x20\x57\x9e\x79\x5f\x71\xa5\xee\x68\x19\x32\xee\xbb\x30\x9d\xba\x20\xce\xb8\x7c\x4a\x12\x9c\xa4\xc4\xe3\xd5\x1f\x7a\xbd\x0e\x71\xb3\x33\xa3\x43\xc2\xdd\x84\xba\xc0\x40\x91\x73\xf0\x15\xd7\x18\xbf\x18\x9e\x9b\x96\x46\x99\x18\xc3\xf3\x32\xfe\x61\x47\x15\x4e\x73\xc2\x68\x4f\x3a\xe4\x4a\x50\x22\x39\x95\xa9\x1d\xc6\x49\x3e\x8c\xaf\x97\x3c\xc7\x1d\x11\x2a\xef\xeb\x49\x9e\x3b\xcf\xcb\xfb\xfe\xed\x95\x95\x66\x95\xff\xda\x90\x0b\x65\xef\xf2\x37\xef\xde\xbd\x1b\x8f\xdf\xe6\x5c\x88\xd4\xd8\xb4\xa9\x05\xf7\x94\xfe\xda\x90\xdd\xa6\xdd\x7d\xa7\x87\x22\x4f\x80\xbe\x5f\xa0\x33\xfc\x7b\xb0\xbb\x8b\x66\x7f\xeb\xad\x06\x8d\x95\x23\xdc\xd3\x76\x84\x28\x52\x5f\x89\xa1\x4e\x6c\x5f\x26\xb7\xb4\xfc\xd3\x43\x3d\x60\x83\x9f\xae\x5f\xfe\x3c\x64\x78\x1d\x0e\xe0\x35\x58\x91\xbd\xba\x1e\xbc\xfc\xf7\xc5\x30\x54\xa3\x64\xc3\x6f\x0e\x67\x1d\x05\x22\xde\x58\x14\x68\xac\xcc\xa4\x16\xf4\x70\xb3\x18\x5c\x5e\x5f\x0e\xf1\xac\x28\x90\x8e\x71\x0d\xf6\x92\x61\x02\x76\xcd\xfa\xce\x80\xc0\x27\x5b\x71\x5f\x56\x03\x4b\xc3\x63\x5f\xb0\xe4\x1b\xab\x23\x94\xa5\x98\xf1\x03\x4b\x23\x5c\x5e\x8c\x2f\x4f\xe8\x04\x6a\x31\x0c\xbc\xc6\xe5\xc5\xd7\x97\xc3\xbe\x2d\x00\x00\x29\x47\x4f\xe0\xe1\xf5\x09\xd9\x27\xa0\x8e\x10\x6d\x72\xaa\x69\x98\x58\xe1\xa9\x31\x08\xc3\xee\x54\xb6\x06\xc5\xe7\x04\xef\x3a\x7a\xa6\x4c\xc9\x03\x4e\x16\xc6\xe0\x08\xc7\x01\xc8\x46\x71\x7c\x0e\x8f\x92\x3c\x75\x02\xcf\x0a\x34\x47\x79\x9e\x34\x29\xd0\x7c\x44\xfe\x62\xc0\x9e\x3f\xf9\x60\x19\x66\xa5\x92\xe5\xfd\x71\xc2\x1c\x22\xa2\xac\xb6\xb4\x26\xed\xbf\xed\x9e\x75\x83\xfe\x92\xfb\xf0\xd9\x29\x4c\x97\xd5\x8f\x3c\x1d\xdf\x2a\x5f\xe2\xe8\x04\xe5\x13\x7e\x3e\x7a\xa7\x7c\x79\x54\x47\xa8\x4f\x45\xb6\x7f\xad\x7c\x51\x5c\x3d\xc6\xde\xc7\xf1\x85\x90\xf4\xff\x19\xfc\xcf\x00\xdf\x70\x7c\x68\x40\x0e\x00\x00"),
+			uncompressedSize:  3648,
 		},
 		"/dashboard.html": &_vfsgen_compressedFileInfo{
 			name:              "dashboard.html",
-			modTime:           mustUnmarshalTextTime("2016-05-31T20:47:03Z"),
-			compressedContent: []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\xa4\x57\x5b\x6f\xdb\xbe\x15\x7f\xf7\xa7\x38\xe3\xbf\x43\xec\xce\x92\x9c\x04\x45\x80\x34\xf6\xd0\x2d\x1b\x56\x60\xbd\x60\x71\xf7\x52\xf4\x81\x96\x8e\x25\x36\x92\xa8\x91\x94\x2f\x33\xfc\xdd\xf7\x23\x25\x5f\x92\x74\x0f\x5b\x8a\x22\x11\x0f\x0f\xcf\xe5\x77\xae\xd9\xed\x32\x5e\xaa\x9a\x49\xcc\x95\x2b\x59\xec\xf7\xf7\xd2\x16\x0b\x2d\x4d\x46\x11\xc9\xa6\xc9\x70\xdc\xed\xb8\xce\xf6\xfb\xc1\xe0\xc4\xfd\x49\xaa\x5a\x78\xd2\x9d\x4d\x8d\x6a\x1c\x59\x93\x4e\xc5\x6e\x17\xff\x49\x5a\xfe\xf6\x8f\xbf\xef\xf7\xd6\x49\xa7\xd2\xc4\xb2\xda\x1a\x25\x93\x85\xd6\xce\x3a\x23\x9b\xc8\x96\x2a\x63\xf3\x82\x10\x57\xaa\x8e\x7f\x5a\x31\xbb\x4b\x3a\x91\xb3\xc1\x5d\xa9\xea\x47\x2a\x0c\x2f\x5f\x29\x3a\xb5\x56\x90\xe1\x72\x2a\xac\xdb\x96\x6c\x0b\x66\x27\x66\x03\x6f\xbd\x3f\xcf\x06\xbf\x65\xd2\xc9\xb9\x5c\xe0\xdb\xf9\x9f\xb4\x1b\x10\x25\x6f\xe9\xc1\x19\x76\x69\x41\x32\x35\xda\x5a\x4a\x75\xed\xe0\x38\x1b\x7a\x9b\x80\xa1\xd1\x56\x39\xa5\xeb\x5b\x92\x0b\xab\xcb\xd6\xf1\x7b\x50\x9d\x6e\x6e\x69\xe2\xbf\x16\xda\x39\x5d\xf5\x87\x92\x97\xae\xff\x34\x2a\x2f\xba\x6f\x1c\x2a\x69\x72\x55\xf7\x37\x8d\xcc\x32\x55\xe7\xe1\x04\x70\x93\xb7\xa0\xfd\x55\x6d\xd8\x92\xb2\xb6\x65\x5a\x17\x6c\x98\xd2\x52\xa5\x8f\x60\x23\x5d\x93\x84\x51\x65\x5b\x41\x2b\x59\x6d\x1c\x2d\xb6\xa4\x1c\xad\x75\x5b\x66\x94\xca\xd6\x32\xb9\x82\x3b\x9e\x1a\xc2\xd6\x2a\x73\x85\x67\xfe\xd9\x56\x0d\x65\x10\x89\x6f\x69\x8c\x5e\x53\xa6\xd7\x75\xd2\x36\xa4\xe0\x25\x15\x72\xe5\x15\xc8\xee\xc1\x00\xee\x9e\x20\x22\xdb\xc8\x3a\xd6\x06\xc8\x06\x9c\x32\x65\x9b\x52\x6e\x6f\x49\xd5\x08\x18\x47\x8b\x52\xa7\x8f\xef\x0f\xca\x0e\xbe\x9c\xbd\xdf\x3d\xc1\x0e\x71\x41\x38\x57\x27\xec\xa2\xeb\x77\xcd\x26\xbc\x89\x9d\xaa\xd8\xcb\x0c\x4f\x1c\x6f\x5c\x24\x4b\x95\xe3\x51\xca\xb5\x63\xe3\x99\x4e\x3c\x71\x17\xed\xc0\xdb\xab\xbe\x9c\x4c\x7e\xef\x99\x90\x53\x5d\xa0\x07\x77\xbf\x8b\x22\xc0\x9c\xc3\x71\x9f\xf0\x14\x45\xc8\xb3\xe2\x72\x76\x4c\xfb\xbb\x04\x27\xf0\x65\x6a\x05\xa0\xa5\xb5\x53\x71\xd0\x80\x94\x21\xf2\x02\xf0\x8b\x68\xfe\xe5\xfe\xcb\x10\x2a\x2b\x2b\xf3\xd1\x2d\x7d\xc8\x73\xc3\xb9\x74\xfc\xe0\x34\x62\xa4\x2c\xd5\xda\xc1\x39\x24\xa2\x4a\x1d\x67\x1e\xe8\x9b\xab\xa8\xd0\xad\xb1\x63\xc4\x0a\x71\x51\x36\x08\xb2\x85\x8f\x56\x7d\x81\xe0\x31\xb1\x42\xbc\x4c\x8c\x0b\x6f\x19\xd4\x15\xd7\xb3\x79\xaf\x1f\x50\x46\x37\x57\x14\x44\x90\xcc\x35\x4c\xbd\x0e\x3c\xaa\x6e\x5a\x47\x2a\x43\x7e\x07\x08\x04\xb9\x6d\xc3\x30\x1c\x88\x89\x83\x17\x3e\x6a\x57\x82\x56\xb2\x6c\x71\x25\xc8\xc7\xa3\x2f\x90\x08\xb5\x37\x15\x93\x67\x34\xb9\x99\x8a\x9b\xab\xa7\x44\xeb\xb8\x99\x8a\xcb\xa7\xc4\x5e\xe4\xf7\xc9\xf8\xe6\xea\x87\x48\x00\x68\x02\xf4\x3c\x88\x85\x49\x0e\x58\x7a\xeb\x8e\x29\xd0\x21\xd9\x95\x5a\x90\xe4\x74\x9e\x97\xde\xe2\x70\xdb\xd1\x5a\x53\x86\xba\xbf\xc7\x21\xd4\xfd\xd1\x95\xee\x61\xf8\x19\x21\x5b\x33\xae\x2d\x67\x22\x80\xd9\xd9\x85\x4a\x88\x6a\x59\x41\xe0\x87\x15\x1b\x44\xfb\xec\xf2\x5f\x2d\x9b\x6d\xd4\x48\x23\x2b\x88\x0a\xa7\xaf\xe1\x70\x2e\x80\xa5\x49\x0b\x28\x32\xed\xf9\x53\x44\x6a\x1d\xa1\x1d\x21\xaa\xff\xe5\xb2\x2b\x34\xfb\xf2\xd2\x5b\x14\x4a\x06\x28\xb0\x4d\x7b\x00\x0a\x96\xd9\x2c\x70\xdd\x39\xd3\x7d\x04\xf2\xe9\x91\xf7\xb1\x97\xd6\x11\x97\x8a\x4b\x40\xf9\x19\xde\xa1\x57\xfa\xa0\x76\x99\xdc\x91\x48\x2f\x43\xc1\x1b\xb4\xc0\x50\xa7\x34\xe4\x38\x8f\x69\xa9\x0d\xfd\x6d\x3e\xff\x8a\x84\x84\xc7\xd6\xd9\x9e\x0b\x3d\x6b\x24\x66\xfe\x25\x4a\x04\xec\xe8\xbe\xae\xf8\x9f\x0c\x39\x00\xfc\xd4\x96\x9e\x9a\x54\x1c\x68\x15\x87\xcb\x92\xeb\xdc\x15\x62\xd6\xdf\xd2\xb0\xb2\xa3\xff\x57\xef\x27\x0c\xa0\xa7\x3a\x41\x51\x55\x5b\x25\xb6\x92\x25\x9a\xbc\x7b\xa9\x17\x1c\xaf\xd3\x29\x37\xcf\x75\xca\x4d\xd0\x59\xa2\x8b\xff\x5a\xa5\xdc\xbc\x4a\xe5\x83\xcb\xee\x79\xf5\x4c\xeb\x83\x93\x75\xe6\x47\x74\xc6\x2b\x25\x7d\x1b\x0d\x71\x7f\xae\x1b\x6f\x63\xba\x3f\xb2\xbc\xc6\x8c\x79\x2f\xdb\x3e\xcf\xb9\xb6\x5a\xa0\xe5\x9e\x69\xf7\x9d\xa9\xef\x84\x99\x98\x1d\xdf\xbd\x50\x8c\xaf\x90\xf1\x9e\xd2\x57\xc1\x9d\x5b\xe8\x6c\x7b\xb4\xcb\x77\xea\xbf\x6c\x64\xd5\xf4\x4d\x82\x30\xcd\x96\x6d\x19\x72\xb9\x31\x70\x8b\xd7\x7e\x46\xf9\x44\xee\x1a\xc2\xb7\x8f\x47\x97\x8e\xc5\xe4\x0f\xd9\x2c\x71\x55\xf3\xc7\xa5\xd6\x53\xef\x19\x34\x66\x4f\xaf\x2f\x27\xef\x26\x2f\xa9\xd7\x93\xc9\x2f\xa8\x57\xcf\xc9\x07\x47\xfc\xbf\xbe\x67\x27\x47\x47\xf0\x19\xb6\x8a\x53\x4b\x3c\x2c\x37\x44\xcb\xb6\x4e\x43\x60\xce\x7a\xd0\x70\x14\xc6\x17\xa1\x4d\x1b\x72\x34\xa5\x37\x43\xf1\x5b\xdf\xd4\x47\xfd\x80\x1b\x5e\xe4\xec\xfe\xe9\x7b\xee\xc5\xe8\x7d\x60\xc6\x92\xd2\x9a\x9a\x76\x58\x6f\xa4\x71\xe2\x96\xdc\xf7\xc9\x8f\x31\x09\xac\x6d\xe1\x70\xf9\x63\xef\x19\xf7\x7e\xdf\x48\x12\xfa\x58\x63\xf4\x62\x90\xfe\x1b\xa3\xbc\x5b\x90\x06\x27\x85\x75\x5b\x96\x9e\xf9\x57\x8a\x77\x4e\xeb\xd2\x29\xcc\x68\x51\x80\x20\xf6\xa3\x58\xd7\x43\x91\x16\xb2\x46\x07\x18\x1f\x3d\x1a\xf2\xb9\x1b\x2b\x48\xe5\x38\x0c\x89\xb8\xe6\x75\xb0\xbc\xb3\x1b\x3a\x4e\xe3\xbb\xb8\x86\xa2\xc2\x55\xe5\x50\x9c\x06\x9e\xa0\x3f\xd0\x0a\xce\xe0\x97\x88\xba\xc3\x65\x38\x9c\xa6\xa0\x18\x0d\x82\x30\x38\xe6\xb7\x52\xbf\xa0\x61\x6f\xf1\x62\xd1\xdd\x08\xb9\xc2\x25\xb6\xa0\x35\xfe\xab\xb2\xf4\x23\x56\xda\xc7\x2e\x6f\xa4\x0b\xc9\x63\xd9\xa0\x1f\x61\xff\xa1\xaa\x4d\x8b\x83\xac\xca\x4f\x71\xf0\xd4\x7e\x9f\xaa\x99\x33\xb4\x4c\x1d\x87\xdb\xb4\xc4\x78\x98\x77\x0a\x86\xae\x8f\x81\xc7\xce\xb2\x3b\x90\x8f\x50\x1c\x90\xf0\xde\x5e\x9c\x2d\x41\x21\x2f\x2e\x46\xf1\x71\x59\x0d\xe4\xa1\xe8\xc7\x0b\xd0\xdc\x1d\xf3\xce\x2a\x94\x34\x36\x46\x9f\xbd\xe3\x9e\xba\xef\xf5\xee\xc7\x7e\xcb\x09\x07\x4f\x0a\x91\x7b\xa1\x3c\x2c\x92\xfe\xdf\x9f\x9f\xac\x8e\xa1\xaa\xba\xda\xf1\x1b\x60\x00\xc8\x70\xa6\x0c\xa7\x8e\xb6\xba\xf5\x3b\x4b\x28\x2f\x23\x53\xec\xa0\x7e\x6d\x1a\xfb\x75\xc5\xd7\x5d\x2f\xf0\x67\x6b\x3b\x14\x3f\x63\x1b\xd0\xeb\xd0\x03\x3b\x6e\x5f\xa6\x01\xe3\x1c\x63\xa6\xe9\x90\x0b\x6b\x73\x97\x5b\xcf\x90\x10\x21\x95\x2e\xc2\x6a\x1b\xc1\x98\x78\x61\xe3\x0e\xa2\x53\x5a\x61\x96\x8d\xbd\xa1\x63\x7a\xc3\x25\x57\x80\xe4\x04\x2e\x4c\xc2\x02\x1b\x63\xf5\x0c\xcd\x2e\xf6\x7f\x35\x20\x22\x5e\x12\x76\x87\x1e\xaa\x1e\xa5\xc1\xe9\x4f\x8c\xc1\xe1\x6f\x9b\xff\x04\x00\x00\xff\xff\x44\x93\x97\x2b\x09\x0d\x00\x00"),
-			uncompressedSize:  3337,
+			modTime:           mustUnmarshalTextTime("2026-10-17T12:00:00Z"),
+			compressedContent: []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\xa4\x57\x51\x6f\xdb\x38\x12\x7e\xd7\xaf\x98\xe3\xf6\x10\xbb\x6b\x49\x4e\x82\xa0\x88\x2b\xe9\xb0\xb7\xb9\xc3\x2e\xb0\xed\x16\x1b\xf7\x5e\x8a\x3e\xd0\xe2\x58\x62\x4b\x91\x2a\x39\xb2\x93\x33\xfc\xdf\x0f\xa4\x64\xd9\x71\x7a\x38\xdc\xc6\x0f\x86\x38\x1c\xce\x37\xf3\x71\xc8\x19\xee\x76\x02\xd7\x52\x23\xb0\xa5\x24\x85\x6c\xbf\xbf\xe3\xae\x5e\x19\x6e\x05\xc4\xc0\xdb\x56\x70\x57\xef\x76\xa8\xc5\x7e\x1f\x45\x47\xed\x77\x5c\x6a\xe6\x45\x99\x2b\xad\x6c\x09\x9c\x2d\x73\xb6\xdb\x25\x7f\xe7\x0e\x3f\xfe\xf1\xdb\x7e\xef\x88\x93\x2c\x53\x87\xf2\xd1\x4a\x9e\xae\x8c\x21\x47\x96\xb7\xb1\x53\x52\xa0\x7d\x26\x48\x1a\xa9\x93\x2f\x8e\x15\x59\xda\x9b\x2c\xa2\x4c\x49\xfd\x15\x6a\x8b\xeb\x17\x9a\x2e\x9d\x63\x60\x51\xe5\xcc\xd1\xa3\x42\x57\x23\x12\x2b\x22\xef\xbd\x1f\x17\xd1\x0f\x82\x13\x5f\xf2\x95\xc2\x82\xfc\x3f\xec\x22\x80\xf4\x35\xdc\x93\x45\x2a\x6b\xe0\xa5\x35\xce\x41\x69\x34\x71\xa9\xd1\xc2\xeb\x34\x02\x68\x8d\x93\x24\x8d\x5e\x00\x5f\x39\xa3\x3a\xc2\xb7\x11\x00\x99\x76\x01\x73\xff\xb5\x32\x44\xa6\x19\x06\x0a\xd7\x34\x7c\x5a\x59\xd5\xfd\x77\x04\xd0\x70\x5b\x49\x3d\xcc\xb4\x5c\x08\xa9\xab\x30\xda\x47\x51\xfa\x3a\x02\xf8\xa7\x7c\x40\x07\xd2\xb9\x0e\x61\x5b\xa3\x45\x28\x95\x2c\xbf\x4a\x5d\x81\xd1\xc0\xa1\x34\xaa\x6b\x80\x0c\x38\x63\x09\x56\x8f\x20\x09\xb6\xa6\x53\x02\x4a\xde\x39\x04\xaa\xb1\xd7\xd1\x11\xc0\x56\x0a\xaa\xbd\xf2\x97\xae\x69\x41\x74\xe8\xbf\xb9\xb5\x66\x0b\xc2\x6c\x75\xda\xb5\x20\x4b\xa3\xa1\xe6\x1b\x0f\xc0\xfb\x05\xd1\xeb\xf4\x84\x22\x70\x2d\xd7\x89\xb1\x02\x6d\xe0\x49\x48\xd7\x2a\xfe\xb8\x00\xa9\x95\xd4\x18\xaf\x94\x29\xbf\xbe\x3d\x80\x1d\x62\x39\x59\xbf\x7b\xc2\x9d\x45\xc5\x49\x6e\x8e\xdc\xc5\xd7\x37\xed\x43\x58\x93\x90\x6c\xd0\xdb\x0c\x4b\x08\x1f\x28\xe6\x4a\x56\x7a\x01\x25\x6a\x42\xeb\x95\x8e\x3a\x49\xbf\xdb\xb0\x3b\x42\x5f\xce\xe7\x7f\xf5\x4a\x59\x3a\x6c\x74\x94\xfd\x25\x8e\xa1\xe5\x15\x02\xf9\x84\x87\x38\x2e\xa2\xac\xbe\x2c\xc6\xb4\xcf\xd2\xfa\xb2\x88\x76\x3b\xb9\x86\xe4\x17\xbe\xc1\x9f\x4d\xa7\xc9\xed\xf7\x51\xd6\x42\xa9\xb8\x73\x39\x0b\x8e\x34\x1d\xa1\x60\xc5\x6e\x97\xbc\xef\x9a\xa5\xe5\x25\xba\xfd\x1e\x28\x7c\x00\xd7\x02\xfa\x99\xfb\x96\x6b\x3f\xe1\x39\x73\x20\x75\xd8\x0e\x47\xc6\x62\x92\xa5\x6d\x11\x8d\x67\x2b\x13\x72\x33\x02\x0c\x21\xb1\x22\x02\xf0\x1e\x47\x00\x00\xcb\xdf\xef\x7e\x9f\x38\x25\x1b\xc7\xab\xe9\x02\x7e\xaa\x2a\x8b\x15\x27\xbc\xf7\xd6\x40\x3a\xd0\x86\xc0\xa2\x23\x2b\x4b\x42\xe1\x77\xf6\xcd\x55\x5c\x9b\xce\xba\x19\x38\x03\x54\x4b\x17\x0c\xb9\xda\xa7\x87\xbe\x20\x58\x21\xa0\xa4\x1a\x6d\x12\x41\xa0\x02\x20\xab\xaf\x8b\xe5\x80\xbf\x80\x79\xfc\xe6\x0a\x82\x09\xe0\x95\xc9\xd2\xfa\x3a\xe8\x48\xdd\x76\x04\x52\xe4\xac\xe7\x9c\x01\x3d\xb6\xd8\x33\xc3\x0e\x51\xf8\x90\xaf\x18\x6c\xb8\xea\x30\x67\x0c\x7c\x02\x0c\x27\x32\x6e\xa4\xce\xd9\xfc\x4c\xc6\x1f\x72\xf6\xe6\xea\xa9\xd0\x11\xb6\x39\xbb\x7c\x2a\x1c\x4c\x7e\x9a\xcf\xde\x5c\x7d\x66\x69\x11\x65\xa9\x90\x1b\xbf\xbb\xb5\x4d\x8b\x81\x4b\xef\xdd\x98\x73\x3d\x93\xfd\xd9\x0e\x96\xc8\x54\x95\xf2\x1e\x87\xd9\x5e\xd6\x59\x15\x2e\x9a\x3b\x4e\x3c\x5c\x34\x63\x28\xfd\xc2\xf0\x1f\x97\x46\x0b\xd4\x0e\x05\x0b\x64\xf6\x7e\x19\x4b\xb1\xe6\x0d\xe6\xec\xa7\x0d\x5a\x5e\xe1\xc9\xe4\xb7\x0e\xed\x63\xdc\x72\xcb\x1b\x97\xb3\x30\xfa\x10\x06\xa7\x06\x90\xdb\xb2\xce\x19\xd9\xee\x74\xa9\xab\xcd\x36\xb6\xb8\xb6\xe8\xfe\xcb\x64\x7f\xb2\xdd\xf3\x49\xef\x51\x38\xa3\x39\x13\xe8\xca\x81\x80\x1a\xb9\x28\x82\x56\x46\xb6\xff\x08\xe2\xe3\x22\x1f\xe3\x60\xad\x17\xae\x25\x2a\x91\xb3\xf7\xbc\x41\x56\x64\x7e\x53\xfb\xa3\xd3\x8b\xc0\xac\x43\x4a\x5b\x63\x28\x24\x39\x4c\x30\xa9\x12\x58\x1b\x0b\xbf\x2c\x97\x1f\xc0\xe2\xb7\x0e\x1d\xb9\x41\xab\x23\x9c\xb2\xc2\xaf\xcc\x52\xaf\x5e\x64\x29\xd5\xff\x97\x23\x07\x82\x9f\xfa\x32\x48\xd3\x06\x83\xac\xc1\x30\xa9\x50\x57\x54\xb3\x62\x98\x85\x49\xe3\xa6\x7f\x16\xf7\x9d\xd4\x67\x98\xef\xa4\x96\x4d\xd7\xa4\xae\xe1\x4a\xa1\xa3\xe7\xb8\xef\xa4\x7e\x19\x26\x7f\x38\xc7\xe4\x0f\x01\x53\x71\x5b\x7d\x1f\x92\x3f\xbc\x08\xf2\x9e\xc4\x1d\x6e\xce\x50\xef\x89\x6b\xc1\xad\x00\x81\x1b\xc9\xfd\xbd\x1d\xf6\xfd\x1c\xfb\x9e\x44\x02\x77\xa3\xca\x4b\xdc\xf8\x70\x33\x3f\x8f\x1c\x85\xf4\xe9\x75\x33\xa7\x1a\x5a\xb4\xbe\x04\x48\x85\xd3\xe7\x6e\xb4\x37\xf3\x97\x61\xdf\xde\x9c\x61\xdf\xde\x3c\xc1\xfc\x0e\xe4\xed\xcd\x0b\x21\x6f\xcf\x21\x6f\xff\x27\xe4\xed\x8b\x20\x97\x83\x41\x77\x7e\xaa\xbb\x66\x85\xf6\x74\x7f\xfd\xdd\x3f\xd4\x1a\xc1\x8a\x71\xdd\x33\xe0\x2c\xed\xef\x94\x2c\x1d\xef\x99\x8c\x56\x46\x3c\x8e\x7e\xf9\xe2\xfb\x8f\x07\xde\xb4\xc3\x35\x0c\x9d\xc3\x75\xa7\xc2\x6d\xd1\x5a\xdc\x48\xdc\xfa\xb6\x83\xea\xe1\xb2\x85\x8f\xbf\x8e\x21\x8d\xd7\x95\x1f\x88\x22\xa5\xa6\xfd\xdb\xda\x98\xdc\x47\x96\xa5\x24\x9e\x4e\x5f\xce\x6f\xe6\xcf\xa5\xd7\xf3\xf9\x77\xa4\x57\xe7\xe2\x43\x20\x00\x63\x55\x4c\xc7\x40\xb2\x34\xb8\x76\x52\x74\x0e\xfd\x2a\xc0\xba\xd3\x65\x48\xfd\x93\x5b\x7e\x32\x0d\x1d\x09\xc0\x86\x5b\x20\xc8\xe1\xd5\x84\xfd\x30\x94\xcd\xe9\xd0\xb3\x4c\x2e\x2a\xa4\x7f\xf9\xaa\x76\x31\x7d\x1b\x94\x2d\x52\x67\x35\xec\x98\x23\x6e\x89\x2d\x80\x3e\xcd\x3f\xcf\x80\xa1\x16\x61\x70\xf9\x79\xef\x15\xf7\x51\x04\x90\xa6\xf0\xab\x96\x24\xb9\x92\xff\x46\x18\x7a\xde\xe8\x08\xa8\x3b\xa5\xbc\xf2\xf7\x80\x77\x64\x8c\x22\xd9\x2e\x80\xd5\x52\x20\xdb\x4f\x13\xa3\x27\xac\xac\xb9\xae\x90\xcd\xc6\x88\x26\x78\x1a\xc6\x06\x72\xc0\x24\x94\xe1\x44\xe3\x36\x78\xde\xfb\xfd\x6a\xc2\x8e\x1d\x59\x7d\xcd\xa6\x49\x4d\x8d\x9a\xb0\x63\x4b\xc1\xe0\x47\xd8\x7c\x9a\x7f\x86\x1f\x81\xc5\xfd\xe0\x32\x0c\x8e\x7d\x06\x9b\x46\xc1\x58\x9a\x82\x7f\x68\x10\x97\x1a\x78\x48\x47\xd3\x11\x18\x0b\xa8\x1c\xc2\x16\x61\x2b\x95\x82\x15\x02\x77\x5f\xfb\xbc\xe1\xd4\x37\x58\x68\x37\x68\x41\x18\x68\xba\xb2\x3e\xd8\x6a\x8c\x45\xaf\xa3\x41\x12\x68\x44\xe1\x80\x4c\x12\x66\x4b\x85\xdc\x2e\x7b\x80\x09\x0d\x7b\xe0\xb9\x73\x48\x07\xf1\x48\xc5\x81\x09\x1f\xed\xc5\x49\x5f\x1b\xf2\xe2\x62\x9a\x8c\xef\x8f\x20\x9e\xb0\xa1\x80\xb3\xd9\xb8\x0e\xc0\x49\x85\x9a\x16\xe0\xb3\x77\x36\x48\xf7\x03\xee\x7e\xe6\x1b\xd7\x30\xf0\xa2\xb0\x73\xcf\xc0\xc3\xdb\xc0\xff\x7e\x7e\xf2\x1a\x08\xa7\xaa\x3f\x3b\xbe\xa9\x0f\x04\x59\x14\xd2\x62\x49\xf0\x68\x3a\x20\xd3\x1f\xaf\xbe\x51\xf5\x9d\xf0\x0c\x7c\x27\x21\x75\x35\x18\xfc\xd2\xb9\x9e\xc5\xf7\xb1\x53\x66\x1b\xaa\x4c\xaf\xed\x8f\x69\xe0\xb8\xb2\xa6\x6b\x7b\xe6\xc2\x4b\xa8\xcf\xad\x33\x26\x58\x48\xa5\x8b\xf0\x5a\x89\xad\xd9\x26\x2b\x97\xf4\x14\x1d\xd3\x0a\x26\x38\xf3\x8e\xce\xe0\x15\x2a\x6c\x50\xd3\x91\xdc\xad\xd4\xc2\x6c\x13\x65\xca\x50\x4e\x12\xff\x10\x84\xdc\x6b\x27\x1f\xff\xf8\x6d\xa0\x6a\x60\x29\x3a\xbe\x1a\xc7\x96\xfa\x3f\x03\x00\x95\x4c\x3c\x13\xdc\x0e\x00\x00"),
+			uncompressedSize:  3804,
 		},
 		"/layout.html": &_vfsgen_compressedFileInfo{
 			name:              "layout.html",
@@ -57,9 +57,9 @@ var Data = func() http.FileSystem {
 		},
 		"/trace.html": &_vfsgen_compressedFileInfo{
 			name:              "trace.html",
-			modTime:           mustUnmarshalTextTime("2016-04-28T10:40:52Z"),
-			compressedContent: []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\xec\x3c\xfd\x77\xe3\x36\x72\xbf\xfb\xaf\x40\xb8\xe9\x89\x4a\x24\xda\xde\xcd\xb5\x3d\xd9\x56\x5f\x6e\x3f\x9a\xbd\x4b\xb2\x79\xf1\x66\xaf\xad\xb3\x2f\x0f\x12\x21\x89\x6b\x8a\xe4\x11\x90\x65\x65\x4f\xff\x7b\x67\x06\x1f\x04\x28\xca\x96\x7d\x49\xda\xd7\xeb\xbe\x44\x96\x40\x60\x30\x18\xcc\x37\x06\xfc\xf8\x31\x15\xb3\xac\x10\x2c\x7a\x9b\xa9\x5c\x44\xdb\xed\xc7\x8f\xd9\x8c\x25\x6f\x6b\x3e\x15\xc9\xeb\x17\xc9\x77\xbc\x16\x85\xda\x6e\x65\xc5\x0b\xf6\xf1\x63\xf3\xe0\x12\x1a\xb6\x5b\x36\x84\x46\x51\xa4\xf0\x4d\xe1\x93\xa0\x0b\x7d\xa1\x3e\xbc\xaa\x52\x2e\x17\xa6\xeb\xd1\x51\x33\xed\x37\x3c\x2b\x22\x6c\x3a\x97\xd3\x3a\xab\x14\x93\xf5\xf4\x22\x02\x28\x7f\xe4\x52\xfc\xf0\xfd\xd7\x30\xb3\xe2\x2a\x9b\x1e\x3f\xe7\x73\x91\x1e\xa7\xcf\x86\x2a\xab\x8e\xb3\x22\x15\xb7\xc9\x07\x19\x8d\xcf\x8f\xf5\xb8\xf1\xd1\x79\x9e\x15\xd7\xac\x16\xf9\x45\x24\xd5\x26\x17\x72\x21\x84\x8a\xd8\xa2\x16\xb3\xfb\x01\x8a\x5b\xbe\xac\x72\x31\xd4\x23\x93\xa9\x04\xd0\x88\x13\xfe\x1c\x1f\x31\xf6\x64\x5a\x56\x9b\xe1\x07\x59\x16\xa3\x45\x79\x23\x6a\xf6\x11\x1a\x19\x9b\xae\x6a\x59\xd6\x23\x56\x95\x59\xa1\x44\x7d\x06\x8d\xdb\x23\x40\x49\x0f\x3b\x3a\x5f\x9c\x8e\xdf\xee\x23\x0b\xf4\x25\x5a\x17\xa5\xea\xa0\x37\x81\x3f\x27\xaa\x13\xb4\x8b\x68\x56\x16\x6a\x28\xb3\x9f\xc5\x88\x9d\x3e\xad\x6e\xcf\x18\xa0\x01\xeb\xe0\xf9\x90\xe7\xd9\xbc\x18\xb1\x65\x96\xa6\xb9\x38\x8b\xc6\x34\x96\xb1\xd8\xfc\xd5\x50\xb2\xf4\x22\xa2\x45\x54\xa2\x5e\x72\xa4\xd5\x70\x9a\x67\x95\xeb\x0d\xfd\x78\x47\xa7\x88\xa5\x5c\x71\xea\x3a\x29\x79\x9d\x0e\x95\xb8\x55\x44\xcf\xef\x6c\x97\xed\xd6\xa3\xb2\xdf\x3a\x76\x3f\xce\x8f\xb9\x9d\x07\xa8\x03\xe8\xd8\x5f\x7f\xeb\xc6\x11\x09\x6d\xd0\xf3\xb1\xc2\xe6\xfd\x08\xfd\xe9\xf2\xcd\xb7\x86\xb6\xd1\xf8\xe5\x6d\x55\xd6\x8a\x71\xc9\xb0\x19\xe7\x0f\x27\xee\x1f\xb5\x91\xb1\xcc\x79\x7e\x0c\xbb\x06\x7b\xf7\xc9\x70\xc8\xde\x02\xec\x2f\x6b\xc1\x59\x5c\x00\x42\xaf\x72\xe0\xe1\x3e\x9b\xf1\x3c\x9f\xf0\xe9\x35\x9b\x95\x35\x7b\x0e\x78\x7d\xfe\x1d\x97\x4a\xb0\x72\x46\x73\x69\x41\x90\x6c\x38\x1c\x03\x9f\x2b\x01\x7c\xc5\xe1\x69\xf4\x7a\x89\x18\x69\xbc\x60\x11\xd9\x54\x41\xdb\x8b\x88\x79\x2b\xc6\xa5\x44\x56\x14\x59\xf4\x83\x14\x6c\xaa\xea\xfc\xf3\x29\x83\x99\xa6\xe5\x72\xc9\x8b\x14\x7e\xa8\x92\xe1\x18\xa6\x16\xc2\x9b\x91\x4d\x44\x5e\xae\x47\x30\xee\x1d\xcf\x57\x30\x3e\xae\x6a\xe0\xca\x19\x8b\xae\xfe\x49\xbe\x8f\x2c\x8f\x5d\x2a\x68\x9d\xf7\x7d\x91\x53\x9b\x0a\xf8\x0b\x27\x3f\xfe\xc0\x6f\xb8\x6e\x25\xc6\x88\x67\xab\x62\xaa\xb2\xb2\x88\xfb\x86\xe3\x6f\x38\x60\x92\x67\xc0\xa3\xec\x82\x15\x62\xcd\xfe\x4b\xd4\xe5\x73\xbb\x19\x31\x4b\xcb\xe9\x6a\x09\x4f\x93\xb9\x50\x2f\x73\x81\x5f\xff\xb8\x79\x9d\xc6\xde\x06\xf6\x59\xff\xec\x48\x8b\x0f\x01\x4a\x00\x7c\x04\x44\x4e\x37\xd1\x80\xb9\x09\x19\xb5\xbc\xbc\xc1\x99\xec\xe4\xc1\x08\x3e\x03\x89\x43\xa8\xc1\x28\xd1\x1a\xc0\x18\xcf\x41\x4e\xe2\x88\x08\xa5\x85\x11\x06\x65\x22\x25\x32\x5a\xc4\x93\xa8\x7f\x66\x46\x6c\xcd\xb7\xad\xc5\xf2\xf8\x98\xbd\x29\x18\x2f\x36\xe1\x5a\x99\xa8\x6b\xd8\x16\xa4\xf2\x92\xd7\x59\xbe\x61\xeb\x85\x28\x18\x31\x09\xcb\x24\xc9\x35\x50\x33\xcb\xf9\x24\x17\x7d\xb6\x16\x16\x98\xe3\x1f\x40\x60\x25\x61\x33\x68\x23\x41\x2b\x15\x29\x82\xc5\x7d\x00\x25\xc0\x93\x36\x89\x68\x3e\x7f\xb1\x62\x87\x2e\xa9\x90\xaa\x2e\x37\x71\xdf\x34\x7f\x1a\x47\x4f\x3c\xc2\x27\xd0\x6d\x7a\xbd\xbb\xa9\x3b\x5d\xb5\xec\xf5\x93\x45\x96\x8a\xd8\x51\xa6\xdd\x89\xd8\x15\x80\x96\x79\xce\x2b\x29\xe2\x48\x2e\xca\x75\x74\x67\x77\x96\xd8\xe5\xc1\xc0\x19\xf0\x8a\x8c\xfb\x89\x14\xb9\x98\xaa\xf8\xce\x1d\xf8\xb6\x6c\xe8\x86\xc4\x15\x22\x85\x2d\x44\x09\x44\xe2\x39\x75\xc5\xe2\x89\x98\xf2\x15\x08\x0e\x36\x53\x4b\xa6\x00\xfe\x0c\x07\x61\x93\x05\xd2\x4f\x1c\x3b\xbb\xc1\xcf\x1f\xcd\xd7\x8d\xba\x24\xe6\x46\xc8\x2d\xa8\x0f\x61\x72\x47\x36\x0f\x6c\x7b\xeb\x84\xbf\x77\x22\xa9\x6a\x62\xfc\x17\x62\xc6\x57\x79\x07\x29\xbb\xf1\x79\xa0\x08\x39\x75\xde\x29\x41\x3f\x16\x3f\x16\x6f\x81\xc2\x60\x63\x2d\xcd\xa7\x60\xb2\xc0\xbe\x6b\xca\x03\xd0\xac\x16\x5a\x57\x0d\x58\x59\x80\xc0\xc8\x05\x70\x02\x74\x66\xeb\x4c\x2d\xd8\xac\x06\xc4\x52\xf9\x49\xb7\x28\xe2\x27\xae\xab\x31\xf8\x47\xe7\x69\x76\x33\xa6\x4f\x32\x11\x4f\x08\xf4\xb0\xc3\xd4\x46\x80\x26\x97\x12\x74\x1c\xf5\x50\xd9\x52\xc0\x32\x04\x7a\x0f\x21\x08\xb2\xed\xdf\x0b\x49\xca\x8f\x5a\xcd\x40\xe0\xf1\xb2\x16\xe9\x8b\xec\xc6\x0d\x32\x1d\x70\x58\xc1\x97\xa2\xab\x1d\x30\x05\xd9\x10\xe9\x4f\x60\xb2\xbc\xd9\x82\x3f\x47\xcd\xec\x48\x2e\x90\x8e\x6f\x44\xb1\x72\x18\xa7\x75\x59\xa5\xe5\xba\x80\xdf\x82\xd7\xb3\xec\x56\xa3\xb6\xca\xdb\x1d\x86\x4b\x1a\x06\x13\x82\x2e\xd7\xdf\x41\x2b\xf1\x21\xa8\x1f\x81\x38\x4c\x36\x4d\x5f\x3d\x83\xf1\x2b\xd2\x4c\x82\x85\xda\x8c\x26\x79\x39\xbd\x3e\xab\x4a\x99\x21\x1b\x8c\xb4\x97\x74\x06\xaa\x6d\x9e\x15\xc3\x49\xa9\x54\xb9\x1c\xfd\x1e\xfc\x0e\xe3\x31\x80\xbb\x65\x26\x03\xde\x93\xb0\xb9\x1c\x87\x39\xbc\x91\x24\xcc\xe1\xb6\x00\x36\x17\x35\x52\x20\xcf\xc6\x47\x76\x3c\xda\x76\xc5\x27\xe4\xcc\x5d\x44\xc3\x53\x63\xda\x39\xf1\xe1\x05\x69\x93\xe1\x74\x91\xe5\x29\xb8\x44\xd6\xc5\x78\x62\x3a\xa9\x72\x3e\xc7\xc9\x55\x59\xe6\xe0\xc0\x99\x56\x58\xc8\x94\x64\xf3\x22\xaa\xb3\xf9\x02\x8c\xa9\x42\x5b\xaa\x61\x01\x1b\x03\xd5\x0c\x3c\x6d\x2d\x81\x31\x41\x2f\xa0\x0f\x10\x8d\x2f\xb1\xcb\x73\xf3\x58\x3b\x0c\x88\xec\x61\xb8\xa2\xa2\xfc\xa5\x70\x45\x58\xf7\xe0\xfa\x15\x76\x79\x2c\xae\xb3\x2c\x07\xb1\xff\x05\x08\x7a\xdc\x81\x29\x38\xd9\x29\x08\x37\xe3\xcc\x4c\x33\x7e\x45\x7f\x1b\x24\xf7\x63\x19\x22\x64\xd1\x9d\xe6\xa5\x04\xe1\x79\x8e\x7f\xfc\xa5\x9e\x1f\xaf\xf2\x3b\xa4\x48\x4f\xfb\x7f\x42\x96\x76\xc5\x88\xbc\x65\x4f\xd2\x22\xeb\xdd\x8e\x98\x25\x77\x48\xea\xac\xa8\x56\xbe\xa3\xe7\x60\xeb\x5d\x42\x43\xba\x1c\x22\xe5\x00\x8d\xc7\x31\x04\xc2\x86\x5d\xbf\x16\x9b\xd1\x0d\xfa\x9f\xac\xe2\x59\x0d\x5e\x53\xca\x70\x4d\x12\xd5\x3f\xcc\x03\x16\x03\x62\xc1\x5c\xfb\xae\x96\x11\x09\xe6\xa2\xcc\x61\x6d\x17\x3d\x07\x20\x49\x92\xde\x6f\xc0\x32\x86\x0e\x37\x99\x58\x7f\x53\xa6\x42\xb3\xc4\x64\x05\x5b\xa4\xe3\x91\x89\x2a\x2e\xc1\x63\xbf\x04\xa7\x45\xbd\x05\xc3\xe1\x28\x07\x0f\x18\xfc\x3f\x4c\xb5\xcd\x05\x05\x82\x01\xc7\x1f\x37\xe8\xc9\xc1\x17\x34\x32\xe7\xc7\x1a\xd0\x1e\x98\x2f\x8b\xf4\x30\x88\x60\x16\x0f\x81\xf7\x62\x55\x87\x8c\xb3\x17\x60\x6a\x7a\xde\x03\xf0\x6b\xe4\xf7\xfb\xa1\x91\x58\x34\xa0\x1a\xfa\x92\x54\xf8\xe1\x85\x8e\xab\x19\x4b\xf8\x2d\xe8\xb2\x8a\xab\xc5\xc0\xfd\x42\x8b\x6c\x7c\x0e\x60\x8c\x7c\x04\x0e\x74\x21\xb4\xfd\x47\xa7\xf6\x1a\xe2\xde\x09\x30\xca\xb5\x69\x5a\xf0\x4a\x0c\x41\xe5\x00\xd3\x80\x0b\x3d\x62\xe0\x14\xc8\xea\x65\x3a\x17\x52\x47\xe1\x16\x2c\x79\x9d\x06\x2c\x46\xd0\x33\xbe\x04\x5f\x7d\xc4\x24\x2f\xe4\x50\xc2\xe0\xd9\x59\xf3\xd0\x84\xd7\x27\x20\x9a\x16\x88\x75\x16\xb4\xf0\x3f\x14\xd2\xd3\x06\xd2\x13\x0b\xe9\xa9\xc1\x4c\x83\x02\x97\xa4\x90\x28\x7e\x23\xfd\x15\x83\xc5\x18\x10\x18\x3c\x83\x0f\xe3\xff\x0c\x97\x72\x78\x4f\x3f\x76\xfc\x19\x7b\xfd\x92\xfd\x81\x7d\x76\xac\x87\xac\xc5\xe4\x3a\x53\x87\x0c\xbb\xe4\x33\xd0\x6e\x24\xaa\xcf\x17\x75\x09\x76\xdb\xc2\x28\x0f\x19\xfe\x06\x3c\x4b\xee\x86\x2c\xcb\x9f\x0f\x19\xf4\x0a\x5c\xc1\x59\x79\xab\x87\x11\x75\xac\xeb\xc5\x92\xc6\xd7\x32\x24\x5a\x08\xd4\x34\xa3\xa7\xb8\x2d\xe0\x2a\xa6\x6a\x61\xbe\xcf\xf2\x92\xab\x51\x2e\x66\xea\x6c\x07\xcc\x13\xf2\x40\x34\x00\xab\x96\x59\x56\xd0\x56\x6a\xf5\x4c\x8f\x8c\x4e\x46\x18\x23\x76\x92\x3c\x13\x4b\x07\xca\x73\xc7\x06\xee\x57\x63\x56\x1e\xc9\x0a\xe0\x89\x5b\xb3\xc0\xf8\x44\x96\xf9\x4a\x19\x2e\x77\x58\x36\x8c\xff\xf3\x90\x74\x1d\xb2\xe4\x49\x17\x5e\x2c\x09\x4c\xd6\x18\xd4\x9c\x4e\xd4\x85\x00\xbd\xf5\x56\x3c\x4d\x49\x5e\x9e\x55\xb7\xec\xe9\x89\xc5\x89\x2c\x22\x74\x2c\xd5\xc2\xc3\x7c\xad\x09\xcf\xbe\xd0\xb3\x33\x92\xd1\xa1\xd9\x0e\x76\x9a\x7c\xf1\xf4\x5f\x7f\xff\x2f\xa7\x5f\x3c\x33\x30\x70\xdf\x46\xec\xc9\xb3\x67\xa6\x61\xbd\xc8\x94\x18\x02\x42\x53\x81\x8b\x5a\xd7\xbc\xda\xc9\x90\x3d\x32\x05\x81\xea\x1e\x02\x35\xf0\xf5\xdf\x65\xf2\x05\xfc\xd8\x6e\xcf\xdc\x43\xf4\x4d\xde\x1a\x61\x7b\xbe\x40\x65\x4c\x3d\x2f\xdb\xcd\xfe\x18\x62\x2b\xe8\x07\xb1\x57\x62\xc2\x16\x30\x4d\xfd\x84\xda\x63\x2f\x10\x15\x4b\x0c\x6b\x30\xf7\xa6\xc3\x1a\x6d\x59\xe3\xac\xc0\x27\xab\x02\x22\x9f\x3e\x5a\xb9\x2a\xbb\x15\xb9\xd4\x0d\x24\x5a\xb5\x50\xab\x1a\x42\xa1\x4c\xe9\xc8\xd3\x2e\x0b\x86\xc5\x62\xf9\x83\x1e\x68\x43\x2e\xc4\x08\x77\xe0\x12\x58\x07\x90\xaa\x78\x2d\xc5\x2b\x64\xf6\xf8\xd3\xb8\x37\x29\xd3\x4d\xaf\x8f\x39\xca\xb8\xe7\x18\xac\xd7\x77\x51\x93\x9e\xa9\x19\xff\x19\x33\xf0\x4d\x30\xe5\x96\x52\xac\x96\xaf\x40\xde\x5f\x7a\xd8\xe1\x8a\xa0\x79\x82\x2e\x01\x3c\x32\x81\x5b\x8a\xb9\x2d\x8a\xb3\x4b\x85\x61\x1c\xb8\x7c\x1b\x36\xe7\xf5\x84\xcf\x5d\x56\x43\x52\x5e\x69\x00\xb1\xe8\x3c\x61\x91\xd5\x75\xaf\x95\x58\xfe\x74\xfa\xc5\x17\xcf\x22\x36\x1c\x33\xfc\x12\x2e\xbe\x41\x21\x06\x00\x0d\x01\xcc\x1a\x68\xe1\xaf\x0b\x85\x0f\x93\x25\x57\xd3\x45\x7c\x1c\xff\x98\x7e\xde\xff\xf4\xb8\x7f\x75\xf2\x7e\x00\x72\xd1\x6f\xaf\xea\x35\x2c\x15\x30\xc4\x95\x4f\xca\x52\xc1\x48\x5e\x31\xe3\xc4\x48\x4d\x7b\x20\xe2\x55\xa7\x8f\xf3\x1e\xe8\x6a\xbe\xfb\x7b\x2e\x85\xb2\xce\x36\xb0\x5b\x36\x01\xa3\xb6\xe6\xf9\x35\x92\xab\x2e\x57\xf3\x05\xd1\x86\x58\x12\x77\x7a\x06\x32\x2b\x43\xb7\x18\xd8\x63\x9a\xaf\x50\xf0\x2c\x48\x90\x4d\xc5\x21\xcc\x06\x51\x87\x7d\x37\xe4\x9d\x67\x10\x7a\x93\x8b\x0f\xb1\x2b\x7b\xad\x50\x3b\xc1\x2c\x82\x4f\x17\xd8\x11\xb3\x99\x37\x66\xfe\x58\xd5\xe0\x63\x95\xb5\x97\x54\x92\xa2\xdf\x62\xad\x5d\xbc\x63\x0d\x7c\x60\xe1\x78\x49\x87\x04\xa7\x89\x71\x15\x5e\x32\x20\x83\x48\x1d\x30\xab\xfd\x6c\x40\x36\x8b\xa9\x2d\xa9\x28\x57\x7d\x49\x10\xd9\x27\x17\x06\x71\xbf\xab\xdd\xc8\x26\x25\xb4\x75\xdf\x34\x0c\xbb\x9e\x0b\x8b\x51\xd3\xb5\x03\x7b\x3d\xa6\xbd\x86\x9d\x74\x81\xdb\x38\x70\x04\x0b\xf1\x66\xf2\xe1\xdb\xf2\x05\x70\x82\xfe\x29\x3d\x52\x97\x93\x0f\x62\x0a\xd2\x8b\x9b\x05\x7b\x90\xa9\x9e\x44\x0f\x56\x4b\x2c\x79\xa1\xb2\x8f\x1b\x61\xe1\xf9\x62\x42\xc0\x06\x0c\xbc\x1e\x9d\xbe\x40\x18\x34\xd6\xa8\x0f\x4c\xec\xa5\x38\x6b\x9c\xf4\x61\x20\x39\xb9\x29\x75\xb5\xd0\x56\xe8\xbc\xc8\x29\x18\x3b\x99\xb0\xb7\x18\xdd\xc1\x7f\x2b\x29\x66\x10\x91\xd8\x34\xd6\x2b\xca\x65\xd5\x82\x2b\x83\x19\xcd\x45\x70\x81\x1b\xf8\x74\x0a\xbe\x75\x59\x4b\x0b\x32\x2b\x40\xf7\xc8\xd5\x64\xa8\x57\x26\x31\x71\xad\x40\x6d\x83\xcd\x22\xa1\x45\xc4\x01\x4c\x9b\x51\x42\x3a\xc5\x65\xa8\x89\x0a\x4d\x3d\x50\xa2\xdb\xb3\x90\x5b\x4a\x8f\x55\xae\x61\x43\xfc\xbd\xd7\xa3\xae\xae\x13\xb3\xf6\xf8\xf8\xc7\xe4\x78\x3e\xe8\xfd\xd4\xeb\xbf\xc7\xed\xde\xc9\x50\x19\x99\xd7\xe3\xda\x3b\xa9\x63\x05\xcb\x0f\xaf\x56\x3f\xff\xbc\x41\x52\x49\x43\xa0\x12\xf0\x80\x26\xb0\xbd\xbc\x9e\x2e\x76\xe5\x32\x76\xa2\x5c\x89\x69\x36\xc3\x63\x93\x7c\x33\xd0\xea\x0e\xfc\x04\xbd\xe1\x8a\xcf\x41\x16\xf1\x1b\x06\xb6\x2d\x11\x16\x3a\xe9\x87\x7b\xcf\x15\x6c\x80\x53\xa2\x25\x8a\x29\x68\xa6\x16\x49\x3b\x10\x76\xc2\xa7\x9f\x35\xc4\x02\x30\xb4\x8c\x05\x6e\x29\xec\xd6\x32\xd3\x11\x20\xf2\xe4\xb3\xa7\x80\x03\xaf\x21\xb4\x01\x9d\x6c\x96\x07\x8e\x33\xfc\x2a\x8c\xce\x95\x03\x26\x4b\xb6\x16\xec\xc3\x4a\xaa\x06\xa2\xcc\xb3\x29\x51\x06\x20\x80\xfa\x81\xc0\x1c\xba\x2d\x05\xea\x11\x8a\xc5\x24\x5b\x02\xe7\xb1\x18\xac\x34\x80\x5c\x97\xab\x3c\x65\x3e\xcf\x95\xac\xe6\x99\x14\x0d\x40\xf0\x2b\xc4\xed\x54\x54\x88\x99\x61\x20\x66\x96\x02\xfb\xa9\xbf\x24\x34\x6b\x7c\x32\x80\x59\xad\x02\xa5\xc1\xdf\x0b\x3c\x2b\x03\xa1\x03\x26\x04\xda\x4e\xd1\xa8\x10\xb3\x92\x72\xd3\xe7\x5c\x60\x9f\x51\x68\xcc\x06\xe0\x57\xa7\xf9\x6c\x5e\xa1\x01\x58\xae\x1c\x39\x40\x7e\x20\x1e\x91\x89\xc7\xb2\x76\x8a\x0b\xb0\x30\x79\x6e\x39\xac\x69\x75\x5c\xeb\xeb\xb0\x20\x1d\x7e\xb0\x3a\x24\x6c\x9e\x2f\x04\x26\xf4\x91\x35\x28\x99\x8f\xeb\x59\x8b\x1e\xd0\x37\x2f\xcb\x6b\x5a\x95\x42\xe9\xe6\x9a\xa1\x42\x85\xaf\x71\x08\x01\x22\x84\xc4\x6b\xda\xab\x74\xf7\x2d\xa0\x91\xa8\x33\xaf\x6d\x7b\x14\x4e\xf3\x9d\xa8\xd1\x51\xc7\x74\x0d\x89\x94\xa1\x28\xb0\x9e\xcb\x36\xc9\x1e\x29\x9e\x84\xfd\x05\x64\xa9\xd4\xed\xdc\x1c\x6f\xe4\xf9\x2e\xd6\x12\xd8\xf8\x06\xfc\xa2\x14\x3d\x05\x90\x33\xad\xb6\x50\x2d\x59\xd8\x03\xda\x62\xe2\xb2\x35\x47\x91\xb2\x42\x49\x5d\x43\x88\xfe\x38\x9f\x1e\xb8\xc9\xc8\x76\x6d\xcd\x45\x34\xaa\xf9\x1a\x7d\xc2\xfe\x59\x6b\xc0\x0c\xa7\xd4\xe9\x7d\x9c\x3d\xbe\xaa\xc1\x85\x08\x49\x86\x72\x72\x29\x0a\xf4\xd0\x6f\xc0\x6b\x25\xb3\x3a\x08\x7a\x00\x9b\x82\xa8\x60\xec\x8b\xe1\xcd\xaa\xf5\x14\x34\x8f\x90\x98\xcb\xa0\x68\x62\xd0\x2c\xe4\x4b\xe0\x84\x35\x66\x40\x6c\x07\x64\x07\x92\x40\x94\xe2\xa9\x1a\x00\xcf\xcf\x01\x79\x6c\xce\x41\xa9\x27\x01\x58\x24\xcc\x88\xbd\x21\xa5\x9e\xe0\x8f\xb8\xee\x0f\x10\x2c\xae\x13\x64\x4f\xe4\xa9\xdc\x4b\xab\xed\x0e\x21\x8c\xc4\x90\x20\x48\x91\xe8\x51\xb1\x51\x4b\x67\x2d\x1e\x79\x21\x2a\x10\x1a\xe4\x61\x60\x8b\xf5\x42\x20\x89\xf1\x40\x12\x39\x80\xd2\x38\xfb\x38\x87\x21\xf7\x81\xd8\xae\xaa\x10\x20\x1e\xa5\x19\x0c\x06\x8d\xb8\x64\x8d\x73\x03\xc0\x41\x01\x00\x03\xf9\xab\x68\xfb\x0b\x56\xea\x73\x51\xcc\xc1\x24\x8e\xd9\xc9\x2e\xe2\x9e\x9e\x21\xd9\xc4\x89\xc0\xc4\x5b\xa5\xee\x83\x37\xba\x21\x70\x31\x3c\xba\x35\x34\xdc\x86\xca\x24\x0e\xba\xee\x33\x58\xbf\x91\xbf\x48\x16\xd1\xa6\x5e\x91\x1f\xd0\x81\xd4\x5a\x54\xeb\x1d\xec\x6b\x41\xf2\x80\xe0\xb0\x9b\x89\x79\x72\xe4\x58\x56\xb3\xa6\xdd\x5b\xd8\x21\x5d\xb6\x91\xb2\xc9\x46\xe7\xfa\x20\xca\xc8\x91\xaf\x4d\x0b\x86\x80\x05\x2d\x8a\xb3\xbf\xae\x20\x58\x30\x5e\x54\x1b\x32\xfb\xb3\xd8\x8c\x22\x71\x0b\x72\xef\xfa\x44\xad\x3e\xaf\x00\x29\x53\x96\x31\x6a\x0f\xff\x16\x6c\xf6\x28\xfa\x5e\xfc\x15\x1c\x34\xd5\x1e\xf8\x7a\xd6\x90\x20\x2d\x85\x6c\x4c\x34\x11\x8d\x4f\xca\x1b\x2b\x74\xc6\x5f\x40\xde\x36\x36\x75\xb0\x67\xff\x64\x06\x7c\xa6\xc0\x78\xe1\x01\xa2\x64\xf6\xfc\x16\xc5\x67\xa8\x8d\x93\x2f\x06\x00\xf0\x4e\x77\xe0\x2e\x4f\xe0\x1d\xc4\x2e\x78\x5e\xe4\xa5\x48\x7d\xcb\x06\x21\x7d\x66\xb2\x10\x9e\xd5\xc5\xc6\x38\x1a\x35\x47\x67\x60\x2f\xbc\x9e\x56\x48\xc0\x5e\x3c\xf5\x8d\x04\x4c\xf7\x4d\x26\xe9\x0c\x5a\x6f\x1d\x1e\xa8\x06\x9b\x3e\x08\x8e\xab\x03\x51\x07\xfc\x3c\x09\x3a\xc0\xdf\x69\xa4\x29\x34\x4c\x5b\x6f\x79\xd7\xec\xc2\x5f\x22\x04\x79\x67\xde\xd3\x9b\xd6\xd3\xd3\xf7\xde\x7a\x6f\xa0\x33\xac\xf0\x82\xf5\xa2\x1e\xfb\xdb\xdf\xd8\xcd\xd5\x8d\x59\xf7\xf0\xd4\x3d\xd8\xb3\x7a\x9f\x59\xff\x67\x89\x00\x48\x61\x89\x46\x05\x46\x80\xa7\xd6\x1d\x82\x18\x36\xcb\x1d\x9e\x52\xc7\xe6\x84\xec\xc8\x52\x07\x5d\x6a\xe3\x7d\x9d\x82\x27\xee\x56\xde\xa8\xf3\xdf\x2c\xc2\xf3\x09\xac\x1d\xa3\x6c\xd6\xe8\x79\xed\xe4\xa2\xee\x70\x41\x16\xca\xf9\x14\x85\x8b\xa4\x94\x2c\x0d\x78\x77\x21\xef\x7b\x58\x19\xf3\x7e\x75\x0d\x71\xc4\x45\x18\x74\xec\x9a\x09\x34\xd1\x1e\x72\xe0\xc7\x4b\x71\xe7\x00\x32\xf9\x5d\x01\x6b\x4b\x84\xc3\x58\xb4\xb5\xbb\xbb\xa1\xe8\x5f\xb0\x38\x04\x89\x00\x1a\xa3\xd6\x67\x22\x26\x14\xa5\x63\x0a\x66\xb3\xef\xba\x93\xc9\xf1\xb1\x25\x25\x1f\xc1\xb7\xa7\xa3\xb6\x4c\xa1\x17\xe6\x4c\x82\x98\xe6\x78\x7e\x6e\x3d\x32\x0e\x3c\x09\x1b\x86\xaa\xa3\xc9\x00\x18\xc3\x47\xc8\x06\x50\x01\x98\x58\x82\x29\x6c\xec\xc1\x5f\x57\xd9\xf4\x1a\x36\x81\xa6\x6a\x23\x81\x13\xac\x05\xd8\xa8\x58\x0a\x53\x6a\xb4\x13\x44\xaa\x5b\xcc\x49\x7e\x49\xbf\x68\x51\x7e\x95\xc2\xfe\x1a\x05\x5d\xee\xd0\x1c\x7d\x87\x65\x27\x5b\x9b\xb1\x09\xf2\x9e\xfc\xaa\xe3\xc0\x07\xb3\x37\x58\xd6\x40\xa5\x12\xd1\xa0\x03\x21\x2f\xa7\x13\x3c\xc4\xd4\x20\x9d\xa9\x9a\x2a\x91\x0c\xad\xce\xd2\x1e\xc4\xb9\x32\x13\x9f\x20\xe0\x46\xe0\xa8\x23\xc7\xe7\xc6\x50\x20\x53\x07\xc7\xb3\x66\x67\xe5\x5d\xd4\xb2\xf3\xc7\xa2\x23\x33\xd3\x49\xd7\xb3\xc0\x24\x90\x7c\x5e\x74\x50\x12\xa9\x14\x47\xf8\xa9\x7d\x47\x68\xd2\xbd\xed\xf8\x03\x52\x44\xa6\xa7\x4d\xe9\x7d\x85\x19\xf6\x78\x87\xbf\x75\x11\xcb\x02\x96\x9f\x63\x6c\x89\x24\xd3\x7e\x87\xcf\x44\xb8\xce\x63\xa2\x8e\x26\x4a\x72\xc8\xe6\x86\x75\x00\xed\x4d\x0e\x2a\x62\xf6\x53\x15\xd5\x40\xdf\x89\xe5\x3d\x33\x86\xa7\xf9\x8f\x9c\x51\x67\xe4\x82\x22\xa6\x80\x46\x8e\xab\x8c\xab\x22\x57\x13\xa4\xd1\x41\x24\x31\x27\xa7\x77\x62\xd6\xd8\x13\xad\x60\x28\xd7\x51\x62\x05\x4f\xb0\x27\xc9\xdd\x5c\xd6\x40\x79\xa1\x4f\x13\xb4\x22\xf7\x71\x0d\x24\xd8\x3b\x1f\x49\xe8\x64\x1a\xa4\x59\x2d\xf3\xb8\xc5\x9a\xe1\xc3\x7e\x97\x2e\xf0\x0e\xf0\x75\xb2\xbb\x51\xda\xee\x60\x23\xa2\x93\x8d\xa8\x09\xc1\xf4\x39\xce\xae\x1c\xe0\xf8\x08\x1f\x46\xfd\xa6\xb3\x2a\xab\xbd\x7d\xe1\x59\xd4\xdf\x49\x51\x79\xdb\xe2\x2f\x54\x6f\x47\xaf\x5d\xc9\xe6\x6f\xfd\x57\x56\xa9\x9a\xdd\x36\x50\x86\x86\x92\xba\x76\xb0\xd3\x3c\x4c\x3d\xf3\xb0\xc3\x1c\x1e\x16\x07\xa9\xc4\x2e\x0e\x39\x48\x33\x07\xbb\x11\xe8\x67\x6f\x91\xa1\x8d\xc3\x33\x1d\x49\x39\x27\x45\x36\xdd\x84\x61\x8e\x04\xc4\x82\xfa\xf8\xc4\x95\x09\x08\x53\x28\xe0\xdc\x70\x30\x7d\xed\x82\x01\x2a\x22\xe8\x2a\x8f\x01\x02\xf3\x7a\x2e\x94\x97\x3c\xb9\x6f\xc3\xc0\x0d\x59\x55\x9d\x55\x75\xe0\x6d\x08\x7c\xfc\xbc\x84\x8d\x03\xd7\xe7\xf4\x99\xef\x67\x18\xa7\x47\x57\x26\x2a\x8d\x73\xb2\xeb\xc9\x7d\xd5\x65\x4a\x07\x6c\x5e\xf3\x49\x1b\x5f\x86\x2a\x57\x87\x83\x7a\x91\x38\xaa\x15\xa7\xfe\xbd\xca\x7e\x4f\x10\xf2\x69\x8c\x2e\x44\x3f\x01\x5f\x0c\x44\xf1\x01\x7b\xbf\xcf\x28\x58\x96\x68\x1b\xbb\x37\x15\xcc\x0a\xaa\x11\x50\x5c\x2d\x07\x98\x7d\x6f\x17\x3d\xde\x37\xdf\x01\x8b\xd6\x70\xf7\x0c\x08\xf5\x0e\xe1\x91\xd0\xc1\xfe\x1d\x33\x3c\x4c\xf7\x80\x34\xf1\xb9\xf8\x8f\x96\x96\xd1\xad\xff\xb9\xa3\x50\xec\x59\x5d\xe3\x73\x6e\x5b\xa4\x6b\x51\xd8\xd7\xeb\x24\x6e\xb5\x98\xac\x60\x3f\x6d\x19\xb1\xed\x4e\x42\x32\x9d\x96\x2b\x30\x38\x68\x68\xa6\x60\x75\xe6\x42\x92\x2f\xb9\x5c\x49\x68\xcc\x6a\xf8\x14\xcb\x4a\x6d\x1a\x88\x99\xc2\x32\x73\xf0\x7d\x94\xc8\x37\x9e\x76\x4f\x5a\x85\x93\xfd\x84\x06\xc6\x81\x81\xc0\x52\x78\xca\x41\x13\x22\x2e\xb5\x60\x0e\x22\x4c\xca\x82\xb2\x1e\x88\x50\xc5\x75\xe4\x45\x5a\x81\x6e\x61\x68\xd8\x3e\xaf\x1b\x18\x2f\xf4\x61\xef\xd5\xfb\xb3\x7b\x23\x19\x9f\xa3\x48\x86\x3f\x81\xa6\x64\xc7\xa5\xf2\x44\xb8\xc3\xd1\xf7\xa6\x4d\xaa\x95\x5c\xc4\x3e\x43\x6d\xfd\x10\xdb\xef\x69\x42\x6c\x88\x48\x4e\x3a\x34\x85\xd3\x0d\xde\xf2\xa8\x56\xe1\xad\x3e\x6e\x74\x99\x6a\xef\x39\x92\x04\x65\x94\xb6\xde\x4f\x5a\xe3\x19\x50\x56\x0c\xe8\x60\x40\x0d\x18\xd5\x08\xb4\xd6\xad\xbb\x84\x2b\xa6\xc4\x78\x76\x43\xba\xa3\xe7\x2a\x25\x7a\x3b\xd9\x41\x3a\xc8\xc7\xe4\x20\xc1\xd7\xf5\x18\x32\x0e\xba\x01\x98\x04\xf3\x56\x71\xcf\x2b\xd7\xb0\x87\xd2\x18\x28\xcf\x6b\x60\xbd\x74\x48\x0f\x7b\x03\x03\x32\xd6\x98\xee\x81\x44\x15\x1b\x78\x00\x0b\xa2\xe7\x53\xf6\x8a\x46\xbd\x4f\x66\x40\x9f\xaf\x03\x59\xed\x1e\xcf\x95\xaa\xc1\x80\xd3\x25\x8a\x01\xeb\x00\x64\x05\xde\x83\x02\x3b\xa0\x55\xc2\xc1\xf3\xe2\x08\xf4\x4c\x49\x77\x0e\x48\x6d\x04\x87\xde\xd1\xe7\x7a\xb1\x57\x27\xef\xfb\x77\xc6\x9f\x34\x75\xab\xce\x7e\xdb\x66\x97\xf0\x5c\x3b\x10\x74\xbd\x49\x1e\xdb\x4c\x4d\xc9\x43\xfa\xcc\x15\x2f\xb9\x0b\x01\xe1\x3f\x53\xdd\x40\x9f\x7b\x7a\x48\x05\x9b\xb9\x6f\xb8\x2e\x9e\x89\x3f\x92\xe6\x13\xcb\xf8\x9f\xfb\x03\x46\x55\x81\xa3\x93\x01\xe9\x3d\xf8\x63\xaa\x1d\x4f\xb6\x7b\x60\x10\x1b\x3a\x0b\xcc\xe2\x14\xf8\xd9\x58\x08\x74\xaf\x03\x19\xa0\x43\xef\x86\xed\xd1\xb9\xde\x83\x58\x09\x1e\x48\xb9\x52\x87\xc2\xd5\x69\xfe\x03\x00\x87\x55\xf8\x6d\xa8\x9d\x63\x18\x5b\x03\x27\x94\xeb\x04\xcc\x05\x85\x93\x09\x16\x2d\xe2\xfe\x90\xf5\x59\xd5\xf9\xd9\x9e\x71\xc7\xc7\xba\xf0\x1e\xaf\xae\x24\xfa\xac\x2f\x9b\x6d\x8c\xd5\x32\x49\x90\x01\xa9\x8d\x01\x7b\x1a\x4a\x55\xf3\x6f\x1b\xe8\x68\x9f\x89\xb4\xe2\x09\xf4\x4d\x65\xd9\xa6\x8a\x8d\x1c\xf5\xa8\xf8\x0f\x24\xb8\xa7\x6f\xca\xf5\x3c\xd3\x5f\x25\xe5\x6c\x06\x01\x64\x7c\x35\x3c\x85\x9d\x26\x46\xf7\x3d\x95\x9b\xb9\x06\x67\xbc\xe2\x0e\x2b\x02\xae\x1d\xa6\xd0\x23\xe8\x1a\x59\xc1\x25\x6e\x04\xc1\xdd\xcb\x95\x09\x11\xc0\x97\x54\xd0\x3b\xe0\x10\xc6\xb4\x7d\x9d\x23\xa8\xdc\x28\x8e\x70\xaf\x67\xe0\x2b\x02\xf4\xc8\x0c\x8f\x3a\xfb\x13\x38\x58\x60\xb8\xa0\xe6\xac\xd3\x2a\x62\x54\x55\x7d\x5f\xef\x32\x6a\xb2\xb6\xe0\x9c\x9d\x7e\x81\xcc\x66\xac\x3c\x3e\x3a\xf3\xec\x8c\xd7\x9c\x40\x1c\x00\x3b\x8c\x07\xa7\xe8\x68\x7e\xce\xa2\x24\x49\x22\x67\x35\xfc\x68\xff\x53\x52\x5f\xd2\xd4\x2a\x85\x24\xd5\xb0\xc2\x92\xc5\x28\x60\x80\x6f\xf8\xb5\xee\x85\x27\x35\x14\xa0\xbb\xb1\xe6\x84\x9b\x11\x8f\x0f\xf1\xd6\x52\x12\x18\xe6\x0f\x92\xd2\xe9\x45\xcf\x3f\x64\x16\x62\x89\xae\x06\x1d\xf9\x71\xb6\xc6\xf8\x10\x0b\x10\x2a\xba\x7d\x47\x99\x29\xc1\x65\xd6\x38\x13\x26\x4d\xaf\xfd\x97\xe6\x40\x71\x82\x09\x55\xe4\x12\xe7\xc7\x20\x8a\x06\xa3\x01\x1d\x91\xd8\x27\x18\xac\x38\x5c\x41\xfb\x7a\x27\xd4\x97\xef\xfe\x1d\x88\x3a\x55\x7d\xed\x49\x63\x6e\x96\x4a\x88\xec\x50\xf0\x9b\xcd\x71\x37\x9e\xca\x62\xc9\x29\x56\x95\xb6\x8a\x95\xa2\x7e\x17\xae\x78\xb3\x05\x24\x41\xd9\xea\x28\x72\x67\xf4\x99\xae\xae\x02\x03\x5d\xaf\x7d\x19\x4c\x5d\xfa\x7e\xc1\x5e\x2f\x8a\xcd\xc7\xe6\x06\x15\x79\x33\x9d\xb7\xb2\x70\xc3\x35\xec\x0b\xbf\x56\xca\x7a\xec\x48\x0b\x27\xa9\x59\xda\xf3\x95\x00\x0e\xd5\x35\xab\x17\x96\x67\x8c\x45\xf3\x2c\x5f\x23\x9d\x04\xd0\x93\x05\x0a\x1b\xb5\x1e\x05\xa9\xf1\x43\xc7\xb6\xa2\xbb\x4b\x45\x93\x09\x0c\x0e\xa0\xf7\xcc\xb1\x52\xad\x29\xee\xd6\xd0\x1a\x6e\x07\xb4\x9d\x40\xb7\x8d\xed\x1e\x65\xdc\x61\xf7\x5b\x9a\x79\xdb\xef\xa4\x9b\x76\x26\x0e\x25\xdc\x01\xc4\xfa\x55\x49\x44\xbe\x95\xd6\x63\x1a\xf3\x24\x2b\x0a\x51\x7f\xf5\xf6\x9b\xaf\x21\xf2\x73\x3d\xbd\x58\xbe\x16\xa6\x6e\x41\xc7\x44\x94\xac\x88\xa9\xc8\x8f\x2c\xbd\xd6\x16\x7d\x73\x69\x0c\x82\x8b\xb2\xd2\xe3\x7c\x58\x41\x0e\xb0\x2c\x9c\xff\x42\x71\x2f\x0a\x2c\xc4\x26\xb9\x48\x02\xd6\x25\x25\x1f\xd8\x8f\x90\xe9\xd1\xaf\xd2\xc1\x5f\xdf\x3b\x24\x42\x39\xbb\xd2\x1e\x19\x2d\xef\xbd\x49\x7f\x34\xc8\xef\x24\xf0\x8c\x16\xee\x0e\x51\x77\xd9\xa2\x1f\x1c\xa7\xb7\x04\xf1\x57\x9c\xab\x75\xa2\x00\x2e\x3e\x85\x52\x9f\xe8\xb8\x81\xfd\xee\x77\xbb\x65\xaf\x0d\xeb\xdf\x93\xbb\x95\x9c\x4e\x44\xe9\xe4\xa0\xac\xb5\x9e\x93\xa0\xc0\x8f\xec\x66\x60\x0b\x55\xfb\x5f\x38\x90\xe8\x6c\x8f\x58\xaf\x67\x03\x5d\x73\x1c\x0e\xaa\xf6\x4d\x9d\x8a\xba\x55\x3a\xa1\x0b\x2d\xed\x13\x4b\x13\x84\xd1\x36\x9f\x40\x4e\x8a\xd1\xe9\xc0\x8e\x3a\x84\xde\xb2\x7b\xae\x9f\x9e\xb5\x9f\xb5\xf0\xd8\x3d\xd0\x71\x76\xf7\xb4\xf3\xcc\x6a\x0f\x90\x4f\xba\xda\xcf\x76\x51\x6f\xf5\xe8\x0a\x39\xd9\xf0\xf4\xce\x80\xa0\x0b\x3d\xff\xef\xd6\x2b\x4c\xc5\x3d\x99\x98\x2b\x27\x30\xe7\x4f\xb8\xd1\xad\xfc\x01\x51\x3e\xb8\xc2\x12\x87\xe5\x7d\x08\xc4\x2e\xd3\x6e\x74\xe2\x6d\x58\xdc\x23\xf0\x04\xbb\x71\xff\x90\xfb\x12\x1c\xda\x18\x2e\x70\x46\x27\xad\xf3\xd5\x1b\x7d\x98\x9d\xb9\xca\x2d\x43\xaa\x4d\x25\xc0\x82\x72\x72\x55\xa4\x3e\x9b\xd5\x89\x02\x3a\xb9\x35\x8f\x27\x1d\x8f\xfb\x5d\x44\x44\x90\x06\x56\x13\x86\x43\x1c\x8e\xb0\x26\x1d\xed\x01\x10\x1f\x5d\xc7\xf4\x2d\xa8\xa0\x61\x92\x80\xc6\xe0\xda\x4d\xf6\x3c\xea\xdc\xf2\x86\xc6\x9f\x75\x6d\xff\x9d\x53\x8d\x1f\x39\xd5\x21\x4c\x76\xd2\xc1\x64\x07\x1e\xf8\x58\xde\xd3\xdc\x7e\x27\xe7\x99\x8b\x4e\x0f\xe6\x3b\x00\xfd\x8f\xce\x75\x1e\x75\x43\x9e\xf3\x1e\xfc\x02\x1c\xe7\x4f\x33\x7e\xd4\x34\xbf\x11\xb7\xd9\x9b\x6b\xfb\x58\xcd\xde\x81\x7b\x30\xaf\x59\xc0\xff\xc0\xbc\x66\x49\x10\x32\x9a\x6d\xfd\x05\xb8\xcc\x4d\x30\x7e\xf8\x04\xbf\x11\x7f\xe9\x88\x89\xe7\xd5\x02\xbe\x28\x5d\x27\xee\xdc\xa0\x86\xcd\xbe\x36\x81\x55\xe3\x8e\x3f\x8c\xdb\x68\x9a\x5f\x9a\xd5\x34\xee\xc4\x4b\x3a\x5b\x14\xb2\xda\xee\xe3\x87\x70\x89\x8e\x16\x54\xf9\x35\x56\xb1\x3e\xe7\x12\xb5\xf9\xb9\x85\x1a\xb6\x3f\x9e\x53\xba\x26\x19\x3f\x66\x92\x5f\x9b\x5b\x84\x76\x90\x31\xec\x51\x98\xf1\x30\x35\x1e\xf4\x1c\x53\xc1\x3b\xb7\x86\xed\x0b\x3c\x3a\xdc\x31\x57\x93\xe0\x86\xd9\x8b\xc1\xbb\x83\xcc\x93\xdd\x21\xee\xee\xef\xee\x18\xfb\x68\x77\x90\xbe\xdf\xbb\x3b\xa2\xc9\x76\xef\xbc\x73\xc3\xbc\x17\x89\xde\xa3\xf3\x16\x73\x44\xf4\x9e\xa3\x3b\x6e\xfa\xda\x8b\xd5\x66\x07\xcc\xfd\xc3\x21\x9d\x8a\x9d\xea\xdb\x96\x4d\xab\x49\x16\xdb\x07\x74\xdd\xb1\xaa\x4b\x08\x58\xc5\x3b\x80\x33\x60\x4f\x60\x3b\x26\xa5\xa4\x20\x09\x5b\xda\x37\x1d\xed\xd5\x49\xba\xba\x3b\xcb\x6e\x45\x3a\x54\x88\xe5\xd0\xdd\xe9\x33\x23\x26\xa5\x8e\x45\x82\x01\xd4\x15\x22\x00\xff\x6a\xa7\xbd\x03\xa9\x4b\x27\xda\x5d\x53\xc7\x58\x6b\x00\x38\x9c\xd4\x82\x5f\x8f\x18\xfd\x19\xf2\xdc\x74\xf7\xae\x3b\x22\xf1\xfe\xb4\x92\x2a\x9b\xe1\xfb\x53\x6a\x9e\x66\xe5\xd0\xf0\x8e\x2e\x3b\x5c\x67\xa6\x02\x0e\xb4\xcf\x5a\x40\x28\xed\xca\x84\x0d\x1d\x18\x12\x54\xbf\x5d\xaa\xeb\xfe\x3a\xdd\xd0\xc6\xc3\x97\xaa\xf9\x36\xfc\xe0\x66\x6c\xda\x6e\x65\xeb\x9e\xbf\x41\x23\xa2\x0b\xe0\x84\x59\x69\xae\x60\x9e\x6b\xcd\xd1\xba\x06\xae\xdf\x7b\xb4\x61\x58\x70\x70\x23\xec\x9b\x0c\xfc\x17\x0d\x10\x90\x88\xc2\x34\x8d\x60\x64\x2f\x97\xdb\xed\x8b\x74\xfd\xdf\x45\x44\x47\x7c\xd4\x32\x76\x5f\xcf\x8f\x09\x98\xbe\xb8\x4f\x28\xdc\x8b\xcc\xc3\xb0\x78\x17\xf2\x92\x43\xc6\xb4\x33\x0f\xa9\x9d\xa6\x5f\x1d\xb9\xef\x1a\xb6\x77\x88\x99\x36\x83\x93\xff\xab\x0b\x1d\x7b\x0f\x1f\x99\xee\x88\xfd\x89\xdf\xf0\x4b\x7d\xd9\x76\x8a\x7c\x82\x49\x5b\x7a\x7d\x07\xb0\x16\xbd\x1d\xc5\x9d\xce\x1e\xb7\x58\x2d\x0d\xeb\xff\xb3\xe9\xe2\x48\x73\xae\xab\x59\x94\x26\x79\x2b\xd2\x23\xad\x0d\xee\xbb\xd4\x8b\xc9\x50\xc7\xb1\x84\xf9\x48\x53\x02\x74\x11\x1d\x54\xc7\xdd\x86\x35\x4b\x29\xed\xad\x73\x2e\xfa\xb8\x20\x4b\x83\xa2\x67\xec\x71\xc1\x02\x1e\x6b\xbf\xe5\x2a\x75\x0f\xf4\x01\x5e\x93\x62\x69\x9b\x8a\x56\xef\xf0\x94\xce\xe5\x0c\x82\x59\xdb\x3c\xd5\x9e\xfc\xa6\xfd\xfc\x10\x1c\x76\x07\x1d\x82\x8a\xcf\x41\x6d\x34\x2a\xff\xd9\x21\x28\x84\x03\xda\xd3\xeb\xf4\x94\xff\x6a\x26\xb2\x12\xba\x92\x12\x0c\x0a\xde\x5c\x20\xde\xc2\x4d\x07\x97\x68\x53\x82\x04\x10\xab\xac\x72\x62\x78\x47\xe5\xe0\x4d\x4d\xe6\x3d\x4c\x79\x16\xb4\x6a\x11\xc1\xdc\x61\xf3\xae\x27\x2c\x51\x6e\xde\x4a\x19\xd9\x37\xfa\x35\xaf\xb2\xc4\x1b\x03\xee\xad\x8a\xaa\x2e\xf1\x44\x40\xbf\xb8\xc4\x7b\x5f\x14\x8e\x74\x3f\xf5\x08\xd4\xdd\xd8\xdb\xbd\x23\x10\x48\xf3\x30\x38\x0e\xab\x1d\x50\xfa\x5d\x98\x6d\x4c\x69\x29\x5f\x16\x45\xa9\x8b\x4f\xa5\x9d\x4d\x5b\x1c\x4b\x08\x6d\x7e\xac\x69\x4b\x45\x81\x57\x10\xf4\x6f\x74\xee\x2a\x91\xba\x37\x3b\x7e\xfc\x58\xa3\x48\x31\x93\xf7\xf5\x40\xef\x9b\xb2\xbf\x6d\x0e\xa9\x34\x6a\xaf\xed\x36\x7a\x4f\x10\xa7\x7a\x7c\xae\x16\xb8\xd6\x3f\x8b\x0d\xae\x10\x7e\x9c\xab\x14\x1a\x00\x09\x96\xd0\x8b\x08\xa9\x39\x1d\xc3\x47\x3d\xf6\xa0\xea\xd5\xef\xfe\x82\x7e\xb8\x8a\x90\x48\xa4\xd5\x32\x54\x69\xf8\x02\x97\x86\xbb\x8c\x60\xdc\xcd\x5b\x6d\xe9\xf9\x7f\x16\xfb\x5f\xc6\x62\x8f\x65\xa3\x47\xb3\x8d\x6f\xdf\x02\x8e\xb1\xef\x90\xf2\xb5\x1d\xf1\x87\x26\x46\xf8\xce\x00\x6c\x32\x3e\xd4\xaa\xce\xf5\xdb\x4f\xf5\x38\x7a\xcd\x6c\x74\x27\x21\xcd\x40\xfd\x2e\x8d\x8b\xe8\xe9\x1f\xfe\x60\xdd\x03\x85\x6f\x79\x72\x6f\x4b\xf5\x85\xe6\x1c\x6f\x7e\xe3\x28\x0c\x3d\x10\x1c\x72\xeb\xca\xe2\x40\x97\x00\x2f\xa2\x6f\xe9\x75\x50\xf8\x49\x64\x7c\xd8\x60\x8a\x3a\xc6\xf8\xc9\xe2\xa5\xec\x3f\x12\x82\x2d\x30\x34\x90\x3e\x6f\x4a\xe1\xff\x1e\xa0\xab\x65\x34\x86\x8f\x55\xce\xd1\xdf\x64\x9d\x48\x36\xdc\x81\xad\x8e\x8e\xe7\x0a\xdf\x99\xe1\x3a\x21\x1b\xbc\xd4\x37\xcb\xb4\xe6\x30\x77\xee\xa9\x2c\xad\x16\xc8\x15\xee\x18\x9a\xf6\xee\x87\xd7\xdd\xdb\x91\x8e\x8f\xd5\xb2\xfa\xb7\x59\x59\x5e\x20\xd2\xc4\xa0\xc1\xe3\xd3\x93\xdf\x9f\xec\xb6\x3e\x3b\x39\xe9\x68\x7d\xda\x6e\xf6\x59\x1d\xb9\xd3\xb4\xd9\xa5\x38\x8e\x0f\xfd\x3c\x3a\xb7\xa3\x80\xce\x78\x6c\xdc\xb2\xfb\x90\xd8\x5d\xaf\xa8\x2e\xd7\x54\x0a\x88\xf7\x6f\xb1\xea\x0f\x6f\x7b\x8b\x34\xc3\xb3\x38\xa0\x06\xd3\x85\xba\x47\x38\xb2\xd2\xa5\xe9\x43\x3a\xab\xc3\x22\xc6\xe4\x70\x1f\xcf\xf7\x1a\x4c\xc8\x14\xd1\x21\x59\x4f\xd7\x18\x00\x16\xc9\x44\xea\x07\xbd\xe6\xac\x8c\xe1\xa1\x18\x61\xf8\xa9\x39\xe7\xb7\xee\x0b\x15\xb6\x85\xe7\xb7\xf8\x12\x29\x73\x5e\x84\x63\x12\x90\xbd\xc6\xd9\xd9\x73\xd8\x6b\xfa\xd9\xa8\x7e\xc7\x7b\xb1\xfa\xe3\xbf\x03\x00\x00\xff\xff\x00\x13\x40\x2c\x1e\x5b\x00\x00"),
-			uncompressedSize:  23326,
+			modTime:           mustUnmarshalTextTime("2026-10-17T12:00:00Z"),
+			compressedContent: []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\xec\x7c\xfb\x93\x1b\xb7\xd1\xe0\xef\xfb\x57\xb4\x47\xba\x8f\xc3\x98\x1c\xee\x4a\xf6\xdd\x85\xbb\xe4\x55\xa2\xc7\x59\xf9\x24\xdb\x65\xc9\xfe\xee\x6e\xa3\x4a\x81\x33\x4d\x12\xda\xe1\x60\x02\x60\xc8\xa5\x37\xfc\xdf\xaf\xba\x81\x79\x72\xb8\x5a\x29\x8a\xbf\xba\x4b\x5c\xe5\xd5\x10\x8f\x46\xa3\xd1\x2f\x34\x1a\xb8\xbb\x4b\x70\x29\x33\x84\xe0\x9d\xb4\x29\x06\x87\xc3\xdd\x9d\x5c\x42\xf4\x4e\x8b\x18\xa3\x57\xcf\xa3\x1f\x85\xc6\xcc\x1e\x0e\x26\x17\x19\xdc\xdd\xd5\x15\x6f\x73\x91\x1d\x0e\x30\x86\xbb\x3b\xcc\x92\xc3\x01\x2c\xd5\xb4\x9a\xf0\x07\xb7\x11\x79\x9e\x08\xb3\xf6\x4d\xcf\xce\xea\x61\xdf\x08\x99\x05\x54\x74\x65\x62\x2d\x73\x0b\x46\xc7\xb3\xe0\xee\x2e\xfa\xa3\x30\xf8\xf3\x4f\xaf\x0f\x07\x63\x85\x95\xf1\xe4\x99\x58\x61\x32\x49\x9e\x8e\xad\xcc\x27\x32\x4b\xf0\x36\xfa\x60\x82\xf9\xd5\xc4\xf5\x9b\x9f\x5d\xa5\x32\xbb\x01\x8d\xe9\x2c\x30\x76\x9f\xa2\x59\x23\xda\x00\xd6\x1a\x97\x1f\x07\x88\xb7\x62\x93\xa7\x38\x76\x3d\xa3\xd8\x98\x60\x4e\x38\xd1\xcf\xf9\x19\xc0\xa3\x58\xe5\xfb\xf1\x07\xa3\xb2\xe9\x5a\x6d\x51\xc3\xdd\x19\x00\x40\x5c\x68\xa3\xf4\x14\x72\x25\x33\x8b\xfa\xf2\x0c\xe0\x70\x76\x35\xf1\xdd\xce\xae\xd6\x17\xf3\x77\xa7\xc8\x72\x06\xc0\xb4\xce\x94\xed\xa1\x37\x83\xbf\x62\xaa\x33\xb4\x59\xb0\x54\x99\x1d\x1b\xf9\x2b\x4e\xe1\xe2\x49\x7e\x7b\x09\x5b\xd4\x56\xc6\x22\x1d\x8b\x54\xae\xb2\x29\x6c\x64\x92\xa4\x78\x19\xcc\xb9\x2f\x40\xe8\xff\x75\x50\x64\x32\x0b\x78\x12\x39\xea\x8d\x20\x5a\x8d\xe3\x54\xe6\x55\x6b\x80\x2b\xd1\xd3\x28\x80\x44\x58\xc1\x4d\x17\x4a\xe8\x64\x6c\xf1\xd6\x32\x3d\x7f\x2c\x9b\x1c\x0e\x0d\x2a\x37\x4b\xe7\xd5\x8f\xab\x89\x28\xc7\xb9\x9a\x10\x3a\xe5\xaf\xbf\xf5\xe3\x48\x84\xf6\xe8\x5d\x89\x76\xf1\x69\x84\xfe\xf4\xf6\x87\xef\x3d\x6d\x83\xf9\x8b\xdb\x5c\x69\x0b\xc2\x00\x15\xd3\xf8\xed\x81\x87\x67\x5d\x64\x4a\xe6\xbc\x9a\xac\x2f\x68\xed\xbe\x1a\x8f\xe1\x1d\xde\xda\x3f\x68\x14\x10\x66\x2a\x1b\xbf\x4c\x85\x59\x0f\x61\x29\xd2\x74\x21\xe2\x1b\x58\x2a\x0d\xcf\x54\xbe\xff\xfa\x47\x61\x2c\x82\x5a\xf2\x58\x4e\x10\x0c\x8c\xc7\xf3\xb3\xbb\x3b\x8b\x9b\x3c\x15\x16\x21\x78\xb5\x21\x8c\x1c\x5e\x01\x24\x32\xb6\x10\xbc\x7a\x1e\x40\x63\xc6\x34\x95\xa0\x14\x45\x08\x7e\x36\x08\xb1\xd5\xe9\xd7\x31\x28\x0d\xb1\xda\x6c\x44\x96\x7c\x1d\x83\x55\x40\x7d\xc0\xae\xb1\x31\x22\x2c\x30\x55\xbb\x69\x00\xc1\x2f\x22\x2d\x30\x80\x30\xd7\x32\xb3\x4b\x08\xae\xff\x8b\x79\x1f\x94\x3c\xf6\xd6\x6a\x99\xad\x86\x4d\x91\xb3\xfb\x1c\x67\x01\x0d\x3e\xf9\x20\xb6\xc2\x95\x32\x63\x84\xcb\x22\x8b\xad\x54\x59\x38\xf4\x1c\xbf\x15\x1a\xe2\x54\x62\x66\x61\x06\x19\xee\xe0\xff\xa0\x56\xcf\xca\xc5\x08\x21\x51\x71\xb1\xc1\xcc\x46\x2b\xb4\x2f\x52\xa4\xcf\x3f\xee\x5f\x25\x61\x63\x01\x87\x30\xbc\x3c\x73\xe2\xc3\x80\x22\x95\x85\x81\x46\x91\xec\x83\x11\x54\x03\x02\x97\xbc\xd8\xd2\x48\xe5\xe0\xad\x1e\x62\x69\x51\x13\xd4\x56\x2f\xec\x74\x00\x10\x29\x6a\x1b\x06\x4c\x28\x27\x8c\xb1\xca\x25\x26\x4c\xc6\x12\xf1\x28\x18\x5e\xfa\x1e\x07\xff\x75\x28\xb1\x9c\x4c\xe0\x87\x0c\x44\xb6\x6f\xcf\x15\x50\x6b\xa5\x99\xca\x1b\xa1\x65\xba\x87\xdd\x1a\x33\x60\x26\x01\x69\x58\xae\xc5\x56\xc8\x54\x2c\x52\x1c\xc2\x0e\x4b\x60\x15\xff\x58\x05\x85\x91\xd9\x8a\x17\xd2\x58\x91\x25\x04\x96\xd6\x41\x68\x14\x51\x97\x44\x3c\x5e\x73\xb2\x78\x44\x97\x04\x8d\xd5\x6a\x1f\x0e\x7d\xf1\xe3\x30\x78\xd4\x20\x7c\x14\xa7\x32\xbe\x39\x5e\xd4\xa3\xa6\x4e\xf6\x86\xd1\x5a\x26\x18\x0e\x2f\x4f\x34\x62\x76\x1d\x46\xb1\x4a\x53\x91\x1b\x0c\x03\xb3\x56\xbb\xe0\xde\xe6\x10\x95\xd3\x0b\x86\xd1\x52\xc5\x85\x09\x87\x91\xc1\x14\x63\x1b\xde\xbb\x02\xdf\xab\x9a\x6e\x44\x5c\xc4\x04\x13\x96\x40\x22\x5e\xa5\xae\x20\x5c\x60\x2c\x0a\x83\x5c\xcc\x25\xd2\x1a\x4c\x97\xd4\x89\x8a\x4a\x20\xc3\xa8\x62\xe7\xaa\xf3\xb3\xcf\xe6\xeb\x5a\x5d\x32\x73\x03\x40\x17\xea\xa7\x30\x79\x45\xb6\x06\xd8\xee\xd2\x35\xd6\x1e\x00\xa3\x5c\x33\xe3\x3f\xc7\xa5\x28\xd2\x1e\x52\xf6\xe3\xf3\x89\x22\x54\xa9\xf3\x5e\x09\xfa\x73\xf6\xe7\xec\xdd\x1a\xe1\xe7\x9f\x5e\x97\x34\x8f\x55\x66\x85\xcc\x1c\xe5\x31\xb3\x52\xa3\xd3\x55\x23\x50\x59\xba\x07\xb3\x16\x1a\x41\x5a\xd8\x49\xbb\x86\xa5\x96\x98\x25\xe6\xab\x7e\x51\xa4\xbf\x34\xaf\xda\xe0\x9f\x5d\x25\x72\x3b\xe7\xbf\x6c\x22\x1e\x31\xe8\x71\x8f\xa9\x0d\x20\x4e\x85\x31\xb3\xc0\xb5\xb0\x72\x83\xa9\xcc\x90\xbc\x87\x36\x08\xb6\xed\x3f\xa1\x61\xe5\xc7\xa5\xbe\x63\xac\x52\xa5\x31\x79\x2e\xb7\x55\x27\x80\xaa\x5b\x26\x36\xd8\x57\x6e\x62\xad\xd2\x14\x93\xbf\x24\xc2\x36\x46\x6b\xfd\x73\x56\x8f\x4e\xe4\xc2\x5b\xfb\x06\xb3\xa2\xc2\x38\xd1\x2a\x4f\xd4\x2e\x83\x38\x45\xa1\x97\xf2\xd6\xa1\x56\xa4\xdd\x06\xe3\x0d\x77\xd3\x8a\x7c\x05\xf7\x2d\xb4\x14\xe3\x54\x2c\x90\x70\x58\xec\xeb\xb6\x6e\x04\xef\x57\x24\xd2\xe4\xa9\xd8\x4f\x17\xa9\x8a\x6f\x2e\x73\x65\x24\xb1\xc1\xd4\x79\x49\x97\x1b\xa1\x57\x32\x1b\x2f\x94\xb5\x6a\x33\xfd\x36\xbf\x2d\xfd\x8b\xab\x54\xfa\xc1\x72\x8d\x06\x33\x6a\x4e\xd6\xd9\xa3\x45\x24\x81\x0a\xb7\x35\x8a\x04\x35\x51\x20\x95\xf3\xb3\xb2\x3f\xd9\x76\x2b\x16\xec\xcc\xcd\x82\xf1\x85\x37\xed\x82\xf9\x70\xc6\xda\x64\x1c\xaf\x65\x9a\x68\xcc\x4a\x17\xe3\x91\x6f\x64\xd5\x6a\x45\x83\x5b\xa5\x52\x2b\x73\x5f\x9a\xa7\x22\x66\xd9\x9c\x05\x5a\xae\xd6\x36\x00\x4b\xb6\xd4\xc1\x02\x91\xa6\x50\xc2\x73\xd6\x12\xec\x5a\x1a\x20\x1f\x20\x98\xbf\xa5\x26\xcf\x7c\xb5\x73\x18\x08\xd9\x87\xe1\x4a\x8a\xf2\x4b\xe1\x4a\xb0\x3e\x82\xeb\x77\xd4\xe4\x73\x71\x5d\xca\xd4\xa2\xfe\x02\x04\x9d\xf4\x60\x2a\x0c\x26\xa0\x32\x10\xe0\x87\x99\xbf\xe4\x7f\x6b\x24\x4f\x63\xd9\x46\xa8\x44\x37\x4e\x95\xc1\x60\xfe\x8c\xfe\x69\x4e\xf5\x6a\x52\xa4\xf7\x48\x91\x1b\xf6\xff\x0b\x59\x3a\x16\x23\xe2\x82\xa6\xa4\x05\xa5\x77\x3b\x85\x92\xdc\x6d\x52\xcb\x2c\x2f\x9a\x8e\x5e\x05\xdb\xad\x12\x19\xd2\xcd\x98\x28\xa7\x55\xfa\x79\x0c\x41\xb0\x41\xc0\x0d\xee\xa7\x5b\xf2\x3f\x21\x17\x52\x83\xc8\x12\xa0\x39\x19\x40\xda\x20\x81\x55\xb4\x17\x4c\x9d\xef\x5a\x32\x22\xc3\x5c\xab\x34\x41\x3d\x1b\x54\x00\xa2\x28\x1a\xfc\x06\x2c\xe3\xe9\xb0\x95\xb8\x7b\xa3\x12\x74\x2c\xb1\x28\xac\x55\x6e\x3f\xb2\xb0\xd9\x5b\xa5\xed\x5b\x2b\xb4\x7d\x27\x37\x58\x51\x6e\x61\x33\x58\xd8\x6c\x9c\x38\x9b\x1b\xcc\xa9\x19\xfc\x71\x0f\x86\x9a\x02\x19\x99\xab\x89\x03\x74\x02\xe6\x8b\x2c\x79\x18\x44\xcc\x92\x87\xc0\x7b\x5e\xe8\x36\xe3\x9c\x04\x98\xf8\x96\x1f\x01\xf8\x9a\xf8\xfd\xe3\xd0\x58\x2c\x6a\x50\x35\x7d\x59\x2a\x9a\xdb\x0b\xb7\xaf\x06\x88\xc4\xad\x34\x90\x0b\xbb\x1e\x55\xbf\xc8\x22\x7b\x9f\x63\x29\xd3\x74\x0a\x99\xca\xd0\xd9\x7f\x72\x6a\x6f\x70\x0a\x8b\x54\xc4\x37\xbe\x68\x2d\x72\x1c\x6b\xcc\x12\xa4\xfd\xcc\x14\x62\x2d\x4d\xfe\x22\x59\xa1\x71\xbb\xf0\x12\x2c\x8d\x5b\x82\xa5\x1d\xf4\x52\x6c\x64\xba\x9f\x82\x11\x99\x19\x1b\xd4\x72\x79\x59\x57\xfa\xed\xf5\x79\x7e\x5b\x01\x29\x9d\x05\x27\xfc\x9f\x0a\xe9\x49\x0d\xe9\x51\x09\xe9\x89\xc7\xcc\x81\xb2\x5a\x64\x86\xc4\x6f\xea\x3e\x69\xb3\x18\x9e\xe7\xb7\xa3\xa7\xe7\xf9\xad\xf7\x7f\xc6\x1b\x33\xfe\x48\x3b\x98\xfc\x0e\x5e\xbd\x80\xdf\xc3\xef\x26\xae\xcb\x0e\x17\x37\xd2\x3e\xa4\xdb\x5b\xb1\x14\x5a\xb2\xa8\x3e\x5b\x6b\xb5\xc1\x0a\x86\x7a\x48\xf7\x1f\x72\xd4\xa2\xea\xb2\x51\xbf\x3e\xa4\xd3\x4b\xa9\x71\xa9\x6e\x5d\x37\xa6\x4e\xe9\x7a\x41\x54\xfb\x5a\x9e\x44\x6b\x24\x4d\x33\x7d\x42\xcb\x02\x3b\x99\xd8\xb5\xff\x5e\xa6\x4a\xd8\x69\x8a\x4b\x7b\x79\x04\xe6\x11\x7b\x20\x0e\x40\xa9\x96\x41\x66\xbc\x94\x4e\x3d\x73\x95\xd7\xc9\x04\x63\x0a\xe7\xd1\x53\xdc\x54\xa0\x1a\xee\xd8\xa8\xfa\x55\x9b\x95\xcf\x64\x05\x80\xca\x2c\x80\x58\x18\x95\x16\x16\x2f\xdb\x58\xd6\x8c\xff\xeb\x98\x75\x1d\xb1\xe4\x79\x1f\x5e\x10\xb5\x4c\xd6\x3c\x95\x73\x17\xa8\x6b\x03\x6c\xcc\x37\x17\x49\xc2\xf2\xf2\x34\xbf\x85\x27\xe7\x25\x4e\x6c\x11\xa7\xb0\x50\x76\xdd\xc0\x7c\xe7\x08\x0f\xdf\xb8\xd1\x81\x65\x74\xec\x97\x03\x2e\xa2\x6f\x9e\xfc\xf7\x6f\xff\xdb\xc5\x37\x4f\x3d\x0c\x5a\xb7\x29\x3c\x7a\xfa\xd4\x17\xec\xd6\xd2\xe2\xd8\xe4\x22\x46\x9a\xd4\x4e\x8b\xfc\x28\x42\xf6\x99\x21\x08\x52\xf7\x30\xa3\xb0\xda\x2f\xd2\x3c\x17\x56\x1c\x0e\x97\x55\x25\xf9\x26\xef\xbc\xb0\x3d\x5b\x0b\x6d\x5d\xcb\xb7\xdd\xe2\x66\x1f\x66\x2b\x98\xd1\xde\x2b\xf2\xdb\x16\xd4\xc1\x30\xe2\xf2\xb0\xb1\x11\xc5\x0d\x6d\x6b\x28\xf6\xe6\xb6\x35\xce\xb2\x86\x32\xa3\x9a\x22\x93\xd6\x0c\xc1\x2a\xc8\xe5\x2d\xa6\xc6\x15\xb0\x68\x69\xb4\x85\xce\x0c\x48\xeb\x76\x9e\xe5\xb4\x00\x37\x21\x6e\x7e\x76\x1d\xdd\x04\x1d\x46\xb4\x02\x6f\xe5\xaf\x08\x33\xc8\x85\x36\xf8\x92\x98\x3d\x7c\x1c\x0e\x16\x2a\xd9\x0f\x86\x14\xa3\x0c\x07\x15\x83\x0d\x86\xd5\xae\xc9\x8d\x54\xf7\xff\x1d\x78\xf8\xae\xc1\xa1\x9a\x4a\x56\x6c\x5e\x6a\xb5\x79\xd1\xc0\x8e\x66\x94\x15\x9b\x05\x6a\x58\x6a\xb5\xf1\x1b\xb7\x04\xd4\x92\x3f\x73\x65\x69\x1b\x27\xd2\x74\x0f\x2b\xa1\x17\x62\x55\x45\x35\x0c\xc7\x95\x46\x80\xd1\x2a\x82\xa0\xd4\x75\xaf\x2c\x6e\xfe\x72\xf1\xcd\x37\x4f\x03\x18\xcf\x81\x3e\xda\x93\xaf\x51\x08\x8d\xd5\x35\x01\xfc\x1c\x78\xe2\xaf\x32\x4b\x95\xd1\x46\xd8\x78\x1d\x4e\xc2\x3f\x27\x5f\x0f\x1f\x4f\x86\xd7\xe7\xef\x47\x70\x71\x3e\xec\xce\xea\x55\x26\x09\x43\x9a\xf9\x42\x29\x6b\xac\x16\x39\x78\x27\xc6\x38\xda\x3f\x0e\x07\xd7\xbd\x3e\xce\xfb\xc1\x30\xf2\xdf\xcd\x35\x37\x68\x4b\x67\xfb\x17\x69\xe4\x22\x45\xd8\x89\xf4\x86\xc8\xa5\x55\xb1\x5a\x33\x6d\x08\x20\xaf\xf4\x52\x66\x89\x69\xbb\xc5\xa1\xcc\xe2\xb4\x20\xc1\x2b\x41\x26\x92\x02\x3e\x16\x54\x86\x66\x58\x92\x77\x25\xb7\x98\xb1\x8b\xff\xea\x79\x04\xaf\x2c\x69\xa7\x1b\x03\x28\xe2\x35\x35\x04\x61\x60\xeb\xc7\x0f\xad\x2e\x10\x94\x6e\x04\x95\x0c\x0e\x3b\xac\x75\x8c\x77\xe8\x80\x8f\x4a\x38\x8d\xa0\x43\x44\xc3\x84\x34\x8b\x46\x30\x40\x8e\x40\xd9\x35\x36\x56\x06\x40\x2e\x43\x2e\x8b\x72\x8e\x55\xbf\x65\x88\xf0\xd5\xcc\x23\xde\x6c\x5a\x2e\x64\x1d\x12\x3a\x54\x5f\x0e\x46\x39\x9f\x59\x89\x51\xdd\xb4\x07\x7b\xd7\xa7\x3b\x87\xa3\x70\x41\xb5\x70\x71\xaa\x32\xfc\x61\xf1\xe1\x7b\xf5\x5c\x59\xe3\x7e\x9a\x06\xa9\xd5\xe2\x03\xc6\x16\x42\x5a\x2c\xb5\x04\x69\x07\x86\x3c\x58\x27\xb1\xec\x85\x9a\x21\x2d\x44\x09\xaf\x29\x26\x0c\x6c\x04\x8b\xc2\x87\x2f\x08\x06\xf7\xf5\xea\x83\x02\x7b\x09\x8d\x1a\x46\x43\xd0\xc8\x4e\x6e\xc2\x4d\x4b\x68\x05\x39\x2f\x26\x56\x1a\x4d\x04\xef\x68\x77\x27\x0d\x14\x06\x97\x45\x0a\x65\x18\xeb\x25\xfd\xb1\x1a\x85\xf5\x98\xf1\x58\x0c\x57\x18\x10\x71\x8c\xc6\x28\x6d\x4a\x90\x32\xb3\x0a\x4c\xb1\x18\xbb\x99\x19\x08\x33\x65\x21\x95\x16\x35\x0b\x2d\x21\x7e\x83\xfb\x2e\xa3\xb4\xe9\x14\xaa\xb6\x26\xca\xb8\x94\x94\xe8\xe1\xb2\xcd\x2d\xaa\xc1\x2a\x37\x23\xd8\xd6\xfd\xc0\xf7\xba\xbe\x89\xfc\xdc\xc3\xc9\x9f\xa3\xc9\x6a\x34\xf8\xcb\x60\xf8\x9e\x96\xbb\xb3\x68\x95\xcc\xbb\x7e\xdd\x95\x74\x7b\x85\x92\x1f\x5e\x16\xbf\xfe\xba\x27\x52\x19\x4f\x20\x05\x4b\x2a\x1a\x1b\x14\x3a\x5e\x1f\xcb\x65\x58\x89\x72\x8e\xb1\x5c\xd2\xb1\x49\xba\x1f\x71\x3d\xf9\x09\x6e\xc1\xad\x58\x99\x21\x7f\xd1\xc6\xb6\x23\xc2\xe8\x82\x7e\xb4\xf6\xc2\x42\xa2\x2a\x25\xaa\x48\x4c\x6d\xbc\xee\x90\xb4\x07\xe1\x4a\xf8\x5c\x5d\x4d\xac\xc9\xc4\x4d\x63\x4d\x4b\x0a\xa9\xdc\x48\xb7\x03\x04\xb5\x84\xa7\x4f\x20\x5e\x0b\x2d\x62\x8b\x1a\xfc\xf4\x72\x61\x2d\xea\xcc\xeb\x5c\x33\x02\xa3\x60\x87\xf0\xa1\x30\xb6\x86\x68\x52\x19\x33\x65\x9e\x3e\x01\x99\xc5\xc2\x20\x18\xb5\x41\x95\xa1\xdb\x8b\x19\xd8\x28\x8d\x10\xee\xd6\x32\x5e\xc3\x4e\x15\x69\x02\x4d\x9e\x53\xa0\x85\x34\x58\x03\x14\x19\xe0\x6d\x8c\x39\x61\xe6\x19\x08\xfc\x54\x60\xe6\x3f\x22\x1e\x35\x3c\x1f\xc1\xd3\x27\xa5\x02\xe5\xce\x3f\x21\x9d\x95\xc9\x2d\xa6\x7b\x48\xd0\xc4\x98\x25\x8e\x59\x59\xb9\xb9\x73\xae\xb5\xda\x91\xd0\xf8\x05\xa0\xcf\x4a\xf3\x95\x71\x85\x1a\xa0\x2a\x2a\x72\x68\x34\x45\x6a\x4d\xd4\x60\xd9\x72\x88\x19\x64\x45\x9a\x96\x1c\x56\x97\x56\x5c\xdb\xd4\x61\xad\x70\xf8\x83\xd5\x21\x63\xf3\x6c\x8d\xf1\x8d\x63\x0d\x0e\xe6\xd3\x7c\x76\x38\xd0\x08\xa9\x52\x37\x3c\x2b\x0b\xd2\x80\x70\x0c\xd5\x56\xf8\x0e\x87\x36\x40\x82\x10\x35\x8a\x4e\x2a\xdd\x53\x13\xe8\x53\xbe\x95\x40\x55\xc3\xfc\x88\x9a\x1c\x75\x10\x4e\x7e\x4a\x8a\xaa\xac\x8e\x36\x99\x01\x2b\x9e\x08\xfe\x03\x21\x51\xae\x5c\xf8\xe3\x8d\x34\x3d\xc6\xda\xc0\x5a\x6c\x11\x64\x42\x9e\x42\x2c\xbc\x52\xb4\xaa\x86\x3d\xe2\x25\x66\x2e\xdb\x09\x12\xa9\x52\x28\xb9\x69\x1b\x62\xb3\x5f\x93\x1e\xb4\xc8\xc4\x76\x5d\xcd\xc5\x34\xd2\x62\x47\x3e\xe1\xf0\xb2\xd3\x61\x49\x43\xba\xf0\x3e\x8d\x1e\x5e\xeb\xf7\xa3\x0e\xc9\x48\x4e\xde\x62\x46\x1e\xfa\x16\xa7\xce\xac\x8e\x5a\x2d\xcc\x9a\x44\x85\xf6\xbe\xb4\xbd\x29\x3a\xb5\x76\xad\xd1\x50\x2c\x83\x77\x13\xa3\x7a\x22\x7f\x80\x54\xed\x50\xd7\x0d\x40\x7a\x09\x24\x29\x8e\xed\x08\xd6\x72\xb5\x46\x4d\xc5\x29\x1a\x13\xb5\xc0\x12\x61\xa6\xf0\x03\x2b\xf5\x88\x7e\x84\x7a\x38\x22\xb0\x34\x4f\x58\x4a\x4c\x13\x73\x92\x56\x87\x23\x42\x78\x89\x61\x41\x30\x18\xb9\x5e\xa1\x57\x4b\x97\x1d\x1e\x79\x8e\x39\x66\x2c\x8e\x2a\xa3\x33\x2e\x22\x31\x28\xcd\x1c\xc0\x61\x9c\x53\x9c\x03\xc4\x7d\x98\x40\x91\xb7\x01\xd2\x51\x9a\xc7\x60\x54\x8b\x8b\xac\x9d\x1b\xa5\x49\x01\x24\xd8\x9a\x45\xd7\x5f\x28\xa5\x3e\xc5\x6c\x65\xd7\x30\x87\xf3\x63\xc4\x1b\x7a\x86\x65\x93\x06\x1a\x98\x4a\xa9\x37\xc1\x7b\xdd\xd0\x72\x31\x1a\x74\xab\x69\x78\x68\x2b\x93\xb0\xd5\xf4\x94\xc1\xfa\x8d\xfc\x45\xb6\x88\x65\xe8\x15\xac\x62\x07\xd2\x69\x51\x86\xcd\x6d\x4b\x90\xa2\x45\xf0\x4c\xf9\x8d\xc9\x64\x72\x56\xb1\xac\x63\xcd\x72\x6d\xa5\x01\x97\xb6\x91\xc0\x62\xef\x62\x7d\xb0\x54\x29\xf1\xb5\x2f\xa1\x2d\x60\xc6\x93\x12\xf0\xd7\x42\x59\xf4\x5e\x54\x17\x32\xfc\x3b\xee\xa7\x01\xde\xe6\x18\x57\x6d\x82\x4e\x9b\x97\x4a\x83\x4f\xcb\x98\x76\xbb\x7f\x2f\x36\x38\x0d\x7e\xc2\xbf\x16\x68\x6c\xb7\xe3\xab\x65\x4d\x82\x44\xa1\xa9\x4d\x34\x13\x4d\x2c\xd4\xb6\x14\x3a\xef\x2f\x10\x6f\x7b\x9b\x3a\x3a\xb1\x7e\x46\xa6\x98\xd9\x74\xcf\x07\x88\x06\xca\xf3\x5b\x12\x9f\xb1\x33\x4e\x4d\x31\x90\xd9\xea\x5e\x77\xe0\x3e\x4f\xe0\x17\x91\xca\x44\x58\x6c\x84\x48\x9b\x96\xcd\xe4\xa9\xf4\x51\x88\x86\xd5\xa5\xc2\x30\x98\xd6\x47\x67\x72\x19\x36\x5a\x96\x42\xf2\xd5\x0c\x9e\xd4\x83\xf1\x70\x6f\xa4\xe1\x33\x68\xb7\x74\x4b\xa5\xdb\x8b\x3e\x6a\x1d\x57\x37\xe7\x48\xf8\x35\x24\xe8\x01\xfe\xce\xe5\x59\xbf\x61\x3a\x34\xa6\x77\x03\xb3\xe6\x14\xaf\xcf\xdf\x5f\x36\x6a\xb7\x9d\xda\x8b\xf7\x8d\xf9\x6e\xaf\xcf\xdf\xc3\x57\xb3\x19\x0c\x82\x01\xfc\xed\x6f\xb0\xbd\xde\xfa\x79\x8f\x2f\xaa\x8a\x13\xb3\x6f\x32\xeb\x7f\x2e\x11\x26\x13\xa0\x14\x8d\x1c\x52\x14\x49\xe9\x0e\x59\x2d\x64\x5a\xe1\x69\xdc\xde\x9c\x91\x9d\x96\xd4\x21\x97\xda\x7b\x5f\x17\x23\xa8\x67\x5e\xab\xf3\xdf\x6c\x87\x77\x76\xe4\x18\xc9\x65\xad\xe7\x9d\x93\x4b\xba\xa3\xda\x64\x91\x9c\xc7\x24\x5c\x2c\xa5\x6c\x69\x0a\xdd\xe1\xfd\x06\x56\xde\xbc\x5f\xdf\xbc\x87\xd9\xac\xbd\xe9\x38\x36\x13\x64\xa2\x1b\xc8\x01\xa6\x06\xef\xed\xc0\x26\xbf\x6f\xc3\xda\x11\xe1\xf6\x5e\xb4\xb3\xba\xc7\x5b\xd1\xff\x58\x63\xc6\x44\x28\x0c\x6a\x77\x26\xe2\xb7\xa2\x7c\x4c\x01\x65\xf4\xdd\x35\xf2\x31\x3e\xd8\x70\xf0\x71\x87\xbc\x23\x01\x69\xc9\x0b\xab\x4c\x02\xc6\xa9\xd0\x58\x79\x64\x02\x0c\xe6\x42\x0b\x8b\x8d\x08\x80\x37\x7c\x8c\x6c\x0b\x2a\x48\x8b\x1b\x03\x71\x6d\x0f\xfe\x5a\xc8\xf8\x26\xdd\xbb\xa1\xba\x48\xd0\x00\x3b\x4c\x53\x08\x0d\xfa\x54\xa3\xa3\x4d\xa4\xbd\xa5\x98\xe4\x1f\xf8\x17\x4f\xaa\x99\xa5\x70\x3a\x47\xc1\xa5\x3b\xd4\x47\xdf\xed\xb4\x93\x43\x19\xb1\x69\xb6\x01\x71\xdd\x73\xe0\x43\xd1\x1b\x4a\x6b\xe0\x54\x89\x60\xd4\x83\x50\x23\xa6\xd3\xaa\xa4\xd0\x20\x9f\xa9\xfa\x2c\x11\xb9\xc9\xdd\x76\xcf\x6d\xc3\xca\x34\x93\x26\x41\x06\x06\xa8\xd7\x59\xc5\xe7\xde\x50\x10\x53\xb7\x8e\x67\xfd\xca\x9a\xfb\xa8\x55\x8e\x1f\x62\x4f\x64\xa6\x97\xae\x97\x2d\x93\xc0\xf2\x39\xeb\xa1\x24\x51\x29\x0c\xe8\xaf\xf3\x1d\x83\xa1\xe7\xd8\xcb\xb3\x93\x41\x96\x6e\x78\xc5\xb7\x2c\x43\x7a\xdf\x51\x84\x3d\x3c\xe2\x6f\x97\xc4\xb2\x16\x59\x92\xa2\x36\x4c\x32\xe7\x77\x34\x99\x88\xe6\x39\x61\xea\x38\xa2\x44\x0f\x59\xdc\x76\x1e\x40\x77\x91\x5b\x19\x31\xa7\xa9\x4a\x6a\x60\x58\x89\xe5\x47\x46\x6c\x9f\xe6\x7f\xe6\x88\x2e\x22\xd7\x4a\x62\x6a\xd1\xa8\xe2\x2a\xef\xaa\x98\x62\x41\x34\x7a\x10\x49\x5c\x97\xfb\x31\xab\xed\x89\x53\x30\x34\x54\xa6\x28\x83\xa7\xb5\x26\xd1\xfd\x5c\x56\x43\x79\xee\x4e\x13\x9c\x22\x6f\xe2\xda\x92\xe0\xc6\xf9\x48\xc4\x27\xd3\xc3\x68\x6d\x37\x69\xd8\x61\xcd\x76\xe5\x70\x78\x79\x1f\xa4\xc0\x05\xbb\x6b\xa5\x5d\x1d\x6c\x04\x7c\xb2\x11\xd4\x5b\x30\x77\x8e\x73\x2c\x07\xd4\x3f\xa0\xca\x60\x58\x37\xb6\x2a\x3f\xd9\xd6\xaa\x3c\x18\x1e\x85\xa8\x1a\xcb\xd2\x9c\xa8\x5b\x8e\x41\x37\x93\xad\xb9\xf4\xdf\x95\x4a\xd5\xb5\x2d\x97\x60\xec\x29\xe9\x72\x07\x7b\xcd\x43\xdc\x30\x0f\xd1\xd9\x69\x2c\x1e\xa4\x12\xfb\x38\xe4\x41\x9a\xb9\xb5\x1a\x2d\xfd\x3c\xbc\x3c\x61\xe3\xe8\x4c\xc7\x70\xcc\xc9\xb2\x4d\xf7\xdb\xb0\x8a\x04\x04\xd6\x1f\x9f\x54\x69\x02\xe8\x13\x05\x2a\x37\x7c\x87\x47\x09\x03\x60\x55\x7f\x7a\x0c\x82\x15\x7a\x85\xb6\x11\x3c\xf9\xd8\x82\xdd\xe0\xbe\xc8\x7b\xb3\xea\xe4\x32\x44\xaa\x7e\xa6\x12\x24\xd7\xe7\xe2\x69\x5d\x57\x39\x3d\x2e\x33\xd1\x3a\x9c\xa3\x63\x4f\xee\xbb\x3e\x53\x3a\x82\x95\x16\x8b\x2e\xbe\x40\x2a\xd7\x6d\x07\xdd\x24\xd7\x58\xcd\x30\xfa\x42\xca\xfe\xc4\x26\xe4\x71\x48\x2e\xc4\x30\xda\x0a\x12\xc5\x4f\x58\xfb\x53\x46\xa1\x64\x89\xae\xb1\xfb\x21\xc7\x8c\x54\x63\x22\x6c\xb1\x19\x51\xf4\xbd\x9b\xf4\xf8\xb1\xf1\x1e\x30\x69\x07\xf7\x44\x87\xb6\xde\x61\x3c\x22\x3e\xd8\xbf\x67\x84\x4f\xd3\x3d\x18\xe5\x62\x85\xff\xab\xa3\x65\x5c\xe9\xff\x3e\x15\xf3\x6e\xf8\x9c\x87\x0e\xe9\x3a\x14\x6e\xea\x75\x16\x37\x8d\x8b\x42\xa6\x49\x99\x46\x5c\x36\x67\x21\x89\x63\x55\x64\x96\x0d\x4d\xbc\x16\xd9\x0a\x0d\xfb\x92\x9b\xc2\x58\x58\x4a\x6d\x2c\xe0\x26\xb7\xfb\x1a\xa2\xb4\x94\x66\x9e\xa7\x68\x31\xdd\x37\xb4\x7b\xd4\x49\x9c\x1c\x46\xdc\x31\x6c\x19\x08\x4a\x85\xe7\x18\x34\x23\x52\x85\x16\xfc\x41\x84\x0f\x59\x24\x1c\xaf\x52\x1a\x72\x61\x4c\xa5\x15\x92\xa7\x15\xec\x26\xaf\x7b\x18\xcf\xdd\x61\xef\xf5\xfb\xcb\x8f\xee\x64\x9a\x1c\xc5\x32\xfc\x95\x5a\x7c\x88\x8e\x5c\xaa\xfb\x4f\xa6\x1a\xc3\x46\x79\x61\xd6\x61\x93\xa1\x0e\xcd\x2d\x76\xb3\xa5\xdf\x62\xcf\x66\x70\xde\xa3\x29\xce\x3a\x9b\x23\x9a\x1e\xe7\x2a\xbc\x73\xc7\x8d\x55\xa4\xba\x51\x4f\x24\x21\x19\xe5\xa5\x6f\x06\xad\xe9\x0c\x48\x66\x23\x3e\x18\xb0\x23\xe0\x1c\x81\xce\xbc\x5d\x93\xf6\x8c\x09\x66\x22\xb7\xac\x3b\x06\x55\xa6\xc4\xe0\x28\x3a\xc8\x07\xf9\x06\x66\x0e\xbe\xcb\xc7\x30\x61\xab\x59\x22\xb7\x11\xc5\xad\xc2\x41\x23\x5d\xa3\x3c\x94\xa6\x8d\xf2\x4a\xab\x22\x4b\xc6\x5c\x39\x18\x79\x90\xa1\xc3\xf4\x04\x24\xce\xd8\xa0\x03\x58\xbc\xb5\x4d\xca\x5e\x73\xaf\xf7\xd1\xb2\x48\xd3\xd7\x2d\x59\xed\xef\x2f\xac\xd5\x61\xc0\x69\x69\xc1\x08\x7a\x00\x95\x02\xdf\x80\x62\x65\xee\x54\xc2\x83\xc7\xa5\x1e\xe4\x99\xb2\xee\x1c\xb1\xda\x68\x1d\x7a\x07\x5f\xbb\xc9\x5e\x9f\xbf\x1f\xde\xbb\xff\xe4\xa1\x3b\x79\xf6\x87\x2e\xbb\xb4\xcf\xb5\x5b\x82\xee\x16\xa9\xc1\x36\xb1\x4f\x79\x48\x9e\x56\xc9\x4b\xd5\x85\x80\xf6\x7f\x3e\xbb\x81\xff\x9e\x68\x61\xac\x88\x6f\x4e\x75\x77\xc9\x33\xe1\x1d\x6b\x3e\xdc\x84\xff\x75\x38\x02\xce\x0a\x9c\x9e\x8f\x58\xef\x9d\x8f\xc0\x67\x3b\x9e\x1f\x4e\xc0\x60\x36\xac\x2c\x30\x84\xc9\x08\xa4\xb7\x10\x43\xb8\x6b\xcb\x00\x1f\x7a\xd7\x6c\x3f\x84\x53\x40\x37\xaa\x30\xa8\x0a\xfb\x50\xb8\x2e\xcc\xff\x00\xc0\xed\x2c\xfc\x2e\xd4\xde\x3e\x00\x3b\x99\x25\x6a\x17\xa5\x2a\xe6\xed\x64\x44\x49\x8b\x30\x73\xbd\xa2\x42\xa7\x97\x27\xfa\x4d\x26\x2e\xf1\x9e\xae\xae\x44\xee\xac\x4f\x2e\xf7\xde\x6a\xf9\x20\xc8\x88\xd5\xc6\x08\x9e\xb4\xa5\xaa\x1d\xfc\xef\x67\x22\xa7\x78\x5a\xfa\x26\x2f\xd9\x26\x0f\xbd\x1c\x0d\x38\xf9\x6f\x30\x82\x81\xbb\x29\x37\x68\x98\xfe\x3c\x52\xcb\xa5\x41\x1b\x5e\x8f\x2f\xce\x47\xc0\x8c\xde\x00\x67\xb6\x2b\x07\xce\x7b\xc5\x3d\x56\x44\xe4\x74\xb4\x10\x06\x66\xbb\x0a\x4a\xc1\x65\x6e\x0c\x46\x70\x92\x2b\x23\x26\x40\x53\x52\x87\x11\x9d\xe7\x86\xbc\x7c\xbd\x3d\x38\xdd\x28\x0c\x68\xad\x97\xa9\xda\x05\x23\x08\x7c\xf7\xa0\xb7\x3d\x83\xb3\x32\x6f\x4f\xa8\x3e\xeb\x2c\x15\x31\xa9\xaa\x61\x53\xef\x02\x17\x95\xb6\xe0\x0a\x2e\xbe\x21\x66\xf3\x56\x9e\xaa\x2e\x1b\x76\xa6\x51\x1c\x99\x62\x61\xac\xa6\x83\x53\x72\x34\xbf\x86\x20\x8a\xa2\xa0\xb2\x1a\xcd\xdd\xfe\x63\x56\x5f\xc6\xe7\x2a\xb5\x49\xea\x60\xb5\x53\x16\x83\x16\x03\xbc\x11\x37\xae\x15\xa8\xcc\x6d\xd0\xab\xbe\xfe\x84\x1b\x98\xc7\xc7\x74\x6b\x29\x6a\x19\xe6\x0f\x86\xc3\xe9\xd9\xa0\x79\xc8\x8c\xb8\x01\xab\xdc\x91\x9f\x80\x1d\xed\x0f\x15\x98\x22\xe7\xdb\x77\xa4\x1a\x01\x85\x91\xb5\x33\x31\x99\x54\x1f\xcd\x03\xc5\xc5\x1e\x1c\x97\x54\x7e\x0c\xa1\xe8\x31\x1a\xf1\x11\x49\x59\x43\x9b\x95\xb2\x06\x42\xbb\x6e\x9c\x50\xbf\xfd\xe5\x7f\x82\xc6\xd8\x0e\x9d\x27\x4d\xb1\x59\x4e\x21\x2a\xbb\xbe\x7a\x5e\x1e\x77\xd3\xa9\xac\x81\x54\x52\x56\x69\x27\x59\x29\x18\xf6\xe1\x4a\x37\x5b\x52\x61\x6c\x99\x1d\xc5\xee\x8c\x3b\xd3\x75\x59\x60\x09\xde\x3a\x5f\x46\x15\x2d\xc7\xe5\xb4\x17\x05\xab\xb9\xbf\x41\xc5\xde\x4c\xef\xad\x2c\x5a\x70\x07\x7b\xd6\xcc\x95\x2a\x3d\x76\xa2\x45\x25\xa9\x32\x19\x34\x95\x00\x75\x65\x06\x20\x4e\xe1\x0f\xe3\x2d\x5a\xc3\xf2\xd5\xd2\xc9\x00\xcf\x1a\x32\x40\xdb\x46\xa7\x47\xb7\xd8\xba\x76\xd6\x55\x74\xf7\xa9\x68\x36\x81\xad\x03\xe8\x13\x63\x14\xb6\x33\xc4\xfd\x1a\xda\xc1\xed\x81\x76\xb4\xd1\xed\x62\x7b\x42\x19\xf7\xd8\xfd\x8e\x66\x3e\x0c\x7b\xe9\xe6\x9c\x89\x87\x12\xee\x01\xc4\xfa\x87\x92\x88\x7d\x2b\xa7\xc7\x1c\xe6\x91\xcc\x32\xd4\xdf\xbd\x7b\xf3\x7a\x38\x6c\x05\xee\xcb\xbd\xbc\x46\x9f\xb7\xe0\xf6\x44\x1c\xac\x08\x39\xc9\x8f\x2d\xbd\xd3\x16\x43\x7f\x69\x6c\x87\xa0\x72\xd7\xaf\x09\xab\x15\x03\x54\x59\xe5\xbf\x10\xee\x2c\xb0\x22\x5b\xa5\x18\xb5\x58\x97\x95\x7c\xcb\x7e\xb4\x99\x9e\xfc\x2a\xb7\xf9\x1b\x36\x0e\x89\x48\xce\xae\x9d\x47\xc6\xd3\x7b\xef\xc3\x1f\x35\xf2\x47\x01\x3c\xaf\x85\xfb\xb7\xa8\xc7\x6c\x31\x6c\x1d\xa7\x77\x04\xf1\x1f\x38\x56\xe7\x44\x41\x2e\x79\xfb\x43\x91\x09\x72\x00\xe0\xdf\xfe\xed\x38\xed\xb5\x66\xfd\x8f\xc4\x6e\x8d\xe0\x13\x51\x3e\x39\x50\xda\xe9\x39\xa3\xb4\x3d\xab\xf5\x88\xb1\x9c\xed\x3f\xab\x40\x92\xb3\x3d\x85\xc1\x60\xd4\x3e\x0e\x97\xd9\xea\x07\x9d\xa0\xee\xa4\x4e\xb8\x44\xcb\xb2\xa6\xa4\x09\xc1\xe8\x9a\xcf\xb5\x34\xbc\x47\xe7\x03\x3b\x6e\xd0\xf6\x96\xab\x7a\x57\x7b\xd9\xad\xeb\xe0\x71\x7c\xa0\x53\xd9\xdd\x8b\xde\x33\xab\x13\x40\xbe\xea\x2b\xbf\x3c\x46\xbd\xd3\xa2\x6f\xcb\x09\xe3\x8b\x7b\x37\x04\x7d\xe8\x35\xff\x3d\x34\x12\x53\x69\x4d\x16\xfe\xca\x89\xcc\x56\x7f\xa1\x85\xee\xc4\x0f\x98\xf2\xad\x2b\x2c\x61\x3b\xbd\x8f\x80\x94\xd3\x2c\x17\x3a\x6a\x2c\x58\x38\x60\xf0\x0c\xbb\x76\xff\x88\xfb\x22\xea\x5a\x1b\x2e\x31\x82\x45\xe7\x7c\x75\xeb\x0e\xb3\xa5\xca\xda\xa4\xda\xe7\xa8\x96\x20\xd8\x55\x31\xee\x6c\xd6\x05\x0a\xf8\xe4\xd6\x57\x2f\x7a\xaa\x87\x7d\x44\x24\x90\x1e\x56\xbd\x0d\x9f\xc1\x39\xc1\x5a\xf4\x94\xb7\x80\x34\xd1\xad\x98\xbe\x03\xf5\xfa\xfc\x7d\xd4\xa2\x31\x5c\xc1\xe2\x44\x55\xef\x92\xd7\x34\xfe\x5d\xdf\xf2\xdf\x3b\xd4\xfc\x33\x87\x7a\x08\x93\x9d\xf7\x30\xd9\x03\x0f\x7c\x4a\xde\x73\xdc\x7e\x2f\xe7\xf9\x8b\x4e\x9f\xcc\x77\x98\x25\xff\xec\x5c\xd7\xa0\x6e\x9b\xe7\x1a\x15\x5f\x80\xe3\x9a\xc3\xcc\x3f\x6b\x98\xdf\x88\xdb\xca\x9b\x6b\xa7\x58\xad\xbc\x03\xf7\xc9\xbc\x56\x02\xfe\x27\xe6\xb5\x92\x04\x6d\x46\x2b\x4b\xbf\x00\x97\x55\x03\xcc\x3f\x7d\x80\xdf\x88\xbf\xdc\x8e\x49\xa4\xf9\x5a\x2c\xd0\xba\x3c\xf1\xca\x0d\xaa\xd9\xec\xb5\xdf\x58\xd5\xee\xf8\xa7\x71\x1b\x0f\xf3\xa5\x59\xcd\xe1\xce\xbc\xe4\xa2\x45\x6d\x56\x3b\xae\xfe\x14\x2e\xe1\xde\x91\x55\xaf\x29\x8b\xf5\x99\x30\xa4\xcd\xaf\x60\xd1\x57\xfe\xf9\x9c\xd2\x37\xc8\xfc\x73\x06\xf9\x47\x73\x0b\x3a\x07\x19\x70\x8b\x16\xac\x2a\x73\x3c\xce\xca\x13\xa4\xa3\x5b\xc3\xe5\x03\x1e\x3d\xee\xd8\xf0\xb2\xdb\xad\xbc\x18\x7c\xdc\xc9\xd7\x1c\x77\xa9\xee\xfe\x1e\xf7\x29\xab\x8e\x3b\xb9\xfb\xbd\xc7\x3d\xea\x68\xf7\xd1\x9b\x1b\xfe\x5d\x24\x0a\x64\xc0\x3b\x8a\x11\xf1\x3b\x47\xf7\xdc\xf4\x2d\x2f\x56\xc3\x5d\xf3\xfe\xe1\x98\x4f\xc5\x2e\xdc\x6d\xcb\xba\xd4\x07\x8b\xcb\x0a\xbe\xee\x98\x6b\xb5\x94\x29\xfe\x22\x71\x37\x82\x47\x5b\xd4\x0b\x65\x78\x93\x44\x25\x70\xd7\x7f\x75\x92\x7a\x46\x4b\x79\x8b\xc9\xd8\x12\x96\xe3\xea\x4e\x9f\xef\xb1\x50\x6e\x2f\xd2\xea\xc0\x4d\xc1\xae\xe1\xee\xf8\x0e\xa4\x4b\x9d\xe8\x36\x4d\x7c\x53\x80\x9d\xd2\xc9\x78\xa1\x51\xdc\x4c\x81\xff\x19\x8b\x34\x3d\xba\xee\x48\xc4\xfb\x53\x61\xac\x5c\x4a\x4c\x40\x8b\x44\xaa\xb1\xe7\x1d\x97\x76\xb8\x93\x3e\x03\x6e\x81\x76\x87\x98\xd5\x69\xc2\x9e\x0e\x40\x04\x75\xaf\x4b\xf5\xdd\x5f\xe7\x1b\xda\x74\xf8\x92\xd7\x5f\xe3\x0f\xd5\x88\x75\xd9\xad\xe9\xdc\xf3\xf7\x68\x04\x7c\x01\x9c\x31\x53\xfe\x0a\xe6\x95\xd3\x1c\x9d\x6b\xe0\xee\xdd\xa3\x3d\x50\xc2\xc1\x16\xcb\x97\x0c\x9a\x0f\x0d\x30\x90\x80\xb7\x69\x0e\xc1\xa0\xbc\x5c\x5e\x2e\x5f\xe0\xf2\xff\x66\x01\x15\x00\x97\xcc\xab\xcf\xab\x09\x03\x63\x0c\x26\x8c\xc2\x47\x91\xf9\x34\x2c\x7e\x69\xf3\x52\x85\x8c\x2f\x87\x06\x52\x47\x45\xff\x70\xe4\x7e\xac\xd9\xbe\x42\xcc\x97\x79\x9c\x9a\xbf\xfa\xd0\x29\xef\xe1\x13\xd3\x9d\xc1\x9f\xc4\x56\xbc\x65\x29\x86\x98\xf8\xc4\x2a\x97\xe8\x47\xac\x45\x91\x83\xfa\x74\x76\xd2\x61\xb5\xa4\x9d\xff\x2f\xe3\xf5\x99\xe3\xdc\x2a\x67\xd1\xf8\xe0\x2d\x26\x67\x4e\x1b\x7c\xec\x52\x2f\x05\x43\x2b\x8e\x65\xcc\xa7\x8e\x12\xc3\xc8\x1d\x54\x87\xfd\x86\x55\x26\x1c\xf6\x76\x31\x17\x77\x5c\x20\x93\x56\xd2\x33\xb5\x98\x41\x8b\xc7\xba\xaf\x5c\x25\x55\x85\x3b\xc0\xab\xba\x1f\x99\x8a\x4e\xeb\xf6\x29\xdd\xe1\xac\x6f\xd4\x2e\x4f\x75\x07\xdf\x76\xeb\x1f\x82\xc3\x71\xa7\x87\xa0\xd2\xe4\xa0\x2e\x1a\x79\xb3\xee\x21\x28\xb4\x3b\x74\x87\x77\xe1\xa9\xe6\xd3\x4c\x6c\x25\x5c\x26\xa5\xd2\x7c\x73\x81\x79\x8b\x16\x1d\x52\xb1\x57\x85\x75\x2a\xac\x48\x99\xe1\x2b\x2a\xb7\x5e\x6a\xf2\xef\x30\xa5\xb2\x55\xea\x44\x84\x62\x87\xf5\x5b\x4f\x94\xa2\x5c\xbf\x4a\x19\x94\x2f\xfa\xd5\x4f\x59\xd2\x8d\x81\xea\x55\x45\xab\x55\xb6\x2a\x1f\x2e\x69\xbc\x17\x45\x3d\xef\xee\x5a\x3d\xae\x26\xae\x75\x09\x91\x48\xf3\x69\x70\x2a\xac\x8e\x40\xf1\x73\x83\xee\x9b\x6f\x75\x96\x73\x41\xbd\x95\x31\xb6\xde\x80\xf4\xf3\x77\xea\x85\xff\x8e\x65\xb6\x54\xd5\xeb\x2b\x44\x6a\xe3\xfa\xb9\x73\x09\x8d\x31\x59\xb8\xa4\xf9\x6a\xd0\xdd\x5d\x74\x38\xf8\x87\x62\x7a\x70\x90\x4b\x90\xe6\x05\x3f\x6a\xd7\xa4\xea\x1f\xb2\x4c\xb9\x3c\x58\xf3\x31\x94\x12\x12\x5d\x1d\xcc\xf9\xa5\xba\xbe\x81\x8e\x96\xe5\xd4\x08\xce\xbc\x96\xab\xce\x3f\x2a\x3b\x9e\x60\x66\x30\xf1\xbf\xc9\x93\xcd\x31\xf1\x2b\x4e\xc0\x35\x21\x01\x3e\xc8\xdd\x00\x7d\x6a\xc8\xe1\xa1\x3e\x91\x73\xa8\xbd\x2a\x79\xb6\x51\x43\x38\xe9\x26\x8d\x6a\x08\x10\x1d\x0e\x25\xaa\x9e\x02\x7e\xbe\xf3\x2b\xbb\x26\xaa\xff\x3b\xee\x89\xf0\x76\x3d\xbf\xb2\xc9\xfc\xee\xce\x58\x0d\x11\xbf\xd2\xc8\xc5\xc9\xfc\x6a\x62\xf5\xbc\x81\x45\xbd\x2c\xed\x5f\x57\x13\x9e\x75\x2f\x51\x5b\x2c\xd4\x99\x63\xf4\x5a\xad\xfe\x7e\xda\x5e\x59\xcd\x33\x7a\xc7\x4f\xd1\xf0\x6c\xd6\xf3\xd7\xb8\xc5\xb4\xfa\xf5\x06\x8d\x11\x2b\x5f\xdb\x98\x54\xb9\x2c\x51\x83\xa4\x0e\x5c\xc2\x92\x22\x37\x18\xbd\x24\x0f\xcb\x42\x70\xf1\xed\xf4\xfc\x9b\xe9\xf9\xb7\xd1\xf9\xf9\x79\x50\x12\x88\xfe\x3f\xc5\x76\x77\x77\xa9\x5a\x31\x1e\x6e\x5b\x16\xf1\xb7\x17\x42\xff\xed\xb9\xb1\x02\x76\x77\x17\xbd\x31\xab\x1e\xf2\x7f\x12\xb9\x43\xbe\x79\xf7\x5a\xad\x9c\x2b\xfc\x11\x0e\xfb\x82\x94\xaf\xe8\xf9\x4c\xa5\xc5\x86\xe4\xc6\xb3\x9a\xe7\x33\x8f\x6c\xef\x12\xfc\xa4\x76\xe6\x33\x97\xa1\x82\xc1\xcc\xcb\xa3\x26\xd5\xa8\x49\xff\xa8\x0f\x23\xa7\x97\x5a\x2d\x76\x9c\x24\xfd\x51\x69\xbd\xca\x4f\xf3\x43\xf9\x40\x51\x4b\x39\xc6\x6b\xdc\x08\x77\x6c\x2b\x8d\x3f\xae\xf2\xaf\x74\x6a\x5c\x49\x63\x51\xfb\xeb\xf9\xae\x05\x59\x2a\xd2\x65\xf4\x70\x08\xf7\xad\xec\x81\xe3\xa3\x7c\xfe\x85\x34\xd5\xe3\x1b\xdc\x8f\xe0\x31\xbb\x78\x30\x9d\x41\xf4\x92\x6f\x73\x1e\xad\x10\x2d\x2a\xb5\x6d\x69\x12\xd7\xed\x73\xd8\x18\xc0\xbd\x8a\xe5\xde\xc4\xaa\x0d\xb6\xf7\x35\xee\x37\xd7\x5d\x87\xe4\x5f\x56\xfb\x5f\x56\xfb\x3f\xcf\x6a\x7f\x41\xcb\x2c\x97\x80\x7f\x05\x2a\x86\x80\x81\x45\x6f\x29\x01\x8e\xf4\x5f\xae\xf1\xc8\x74\xbb\x32\xc7\x5d\xed\xba\x5a\x15\xfe\x1d\xe6\xe5\x5f\xd6\xfc\x5f\xd6\xfc\xff\x2d\x6b\x7e\xca\xaa\x34\x23\x0a\x2d\x83\x52\xbe\xda\xd9\xdc\x5f\xb2\xf9\x60\xe0\x9d\x97\x28\xa9\xc8\x47\xad\x0a\x9d\xba\xf7\xe6\x5d\x3f\x7e\xd8\x3f\xb8\x77\x31\x7c\x47\xf7\x7a\xd9\x2c\x78\xf2\xfb\xdf\x97\x01\x19\xbb\x46\x91\x34\x17\xa7\x41\xcd\xb5\xeb\x45\xc1\x5e\x02\x47\xc6\xac\x28\x71\x60\x76\x99\x05\xdf\xf3\x03\x9c\xf4\x97\x17\xeb\xd3\x3a\x7b\xb3\x11\xcc\xfd\xc7\x67\x80\xe0\x50\x31\x33\x13\x84\x1b\x33\xfc\x4c\x08\xe5\xad\x10\x0f\xe9\xeb\xfa\xfe\xe2\xdf\x03\xb4\xd8\x04\xf3\x67\xc5\xa6\x48\x05\x05\x09\xa1\x17\xc9\x9a\xc1\xae\x26\x8d\xa5\xb8\xb2\xf4\xd0\x59\xd5\x88\x38\xe9\x85\x7b\x0e\x80\x87\x29\x1f\x4a\xe2\xbb\x04\x1a\x89\xb1\xaa\xdc\x41\x5e\xfe\x9f\x5f\xf5\xaf\x68\x32\x9f\xd8\x4d\xfe\x3f\x96\x4a\xcd\x08\x69\x66\xf5\x56\xf5\x52\xab\xcc\x62\x96\x1c\xd7\x5c\x9c\x7f\x7b\x7e\x5c\xfa\xf4\xfc\xbc\xa7\xf4\x49\xb7\xb8\x29\x47\xc4\xfa\xbe\xac\x9c\x64\x25\x4e\xed\xb0\x1d\xa7\x61\x71\x7c\xde\x07\xe0\x44\x29\x4b\x63\x9a\xb2\x9f\xab\x56\x3b\xbe\xd9\x41\xcf\xa9\x80\xb4\x60\x15\x68\x4c\xa4\xc6\xd8\x42\x61\xc0\xdd\xbb\x3a\xa3\x9e\xb9\xbb\x69\x38\x66\xed\x4b\x77\x52\xa2\x87\x87\xec\x9a\x41\x20\x1f\x01\x0f\x38\xe7\x69\xe0\x52\x46\xb5\xda\x45\x0b\xe3\x2a\x06\x75\xea\x13\x50\x8e\x13\x63\xf8\xd8\xa7\x6d\x96\xd1\x28\xbe\xa7\xd0\x4e\xc7\xa3\x37\x41\x7d\xfa\x0f\xf5\x89\x7e\xfe\xe9\xf5\xb0\x8e\xb1\xf7\xe7\xee\xf9\x76\x97\x67\x27\x82\x51\xa5\x72\xfa\xbf\x03\x00\xf3\x74\xa8\xef\xed\x64\x00\x00"),
+			uncompressedSize:  25837,
 		},
 		"/traces.html": &_vfsgen_compressedFileInfo{
 			name:              "traces.html",
@@ -75,7 +75,7 @@ func (a *App) d3timelineInner(t *appdash.Trace, depth int) ([]timelineItem, erro
 	item := timelineItem{
 		Label:     t.Span.Name(),
 		FullLabel: t.Span.Name(),
-		Data:      t.Annotations.StringMap(),
+		Data:      t.Annotations.Map(appdash.LastWins),
 		SpanID:    t.Span.ID.Span.String(),
 		URL:       u.String(),
 	}
@@ -102,7 +102,9 @@ func (a *App) d3timelineInner(t *appdash.Trace, depth int) ([]timelineItem, erro
 				continue
 			}
 			start := e.Start().UnixNano() / int64(time.Millisecond)
-			end := e.End().UnixNano() / int64(time.Millisecond)
+			// Prefer the recorded duration to the wall-clock end, which
+			// may be off if the clock jumped during the span.
+			end := e.Start().Add(appdash.EventDuration(e)).UnixNano() / int64(time.Millisecond)
 			ts := timelineItemTimespan{
 				Start: start,
 				End:   end,
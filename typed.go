@@ -0,0 +1,173 @@
+package appdash
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A ValueType is the type of a typed annotation value, i.e. of the value
+// of an event field of a numeric, boolean, duration or time type, which
+// MarshalEvent encodes as follows (see ParseTypedValue):
+//
+//	IntValue       decimal integer, e.g. "-42"
+//	UintValue      decimal integer, e.g. "42"
+//	FloatValue     shortest decimal representation, e.g. "0.25" (never in
+//	               exponent form)
+//	BoolValue      "true" or "false"
+//	DurationValue  decimal number of milliseconds, e.g. "1500" or "0.25"
+//	TimeValue      RFC 3339 time with nanoseconds
+//
+// The types aren't recorded: they are those of the fields of the
+// registered event types (see RegisterEvent), which the schemas of the
+// annotations identify.
+type ValueType string
+
+// The types of the typed annotation values.
+const (
+	IntValue      ValueType = "int"
+	UintValue     ValueType = "uint"
+	FloatValue    ValueType = "float"
+	BoolValue     ValueType = "bool"
+	DurationValue ValueType = "duration"
+	TimeValue     ValueType = "time"
+)
+
+// Type returns the type of the value of the annotation with the given
+// key, or "" if the value is untyped (i.e. a string, or the value of an
+// event type that isn't registered with DefaultEventRegistry).
+func (as Annotations) Type(key string) ValueType {
+	return DefaultEventRegistry.ValueType(as, key)
+}
+
+// TypedValues returns the values of the typed annotations, parsed (see
+// ParseTypedValue), by (unescaped) key, using the event types registered
+// with DefaultEventRegistry. The values that fail to parse are omitted.
+func (as Annotations) TypedValues() map[string]interface{} {
+	return DefaultEventRegistry.TypedValues(as)
+}
+
+// ValueType returns the type of the value of the annotation of anns with
+// the given key: that of the field of the event type registered with r
+// for one of the schemas of anns, at the key path, or "" if there is no
+// such field or it is untyped.
+func (r *EventRegistry) ValueType(anns Annotations, key string) ValueType {
+	return r.valueType(anns.schemas(), UnescapeKey(key))
+}
+
+// TypedValues is like Annotations.TypedValues, but uses the event types
+// registered with r.
+func (r *EventRegistry) TypedValues(anns Annotations) map[string]interface{} {
+	schemas := anns.schemas()
+	m := map[string]interface{}{}
+	for _, a := range anns {
+		key := UnescapeKey(a.Key)
+		t := r.valueType(schemas, key)
+		if t == "" {
+			continue
+		}
+		if v, err := ParseTypedValue(t, a.Value); err == nil {
+			m[key] = v
+		}
+	}
+	return m
+}
+
+// valueType returns the type of the value at the (unescaped) key of the
+// events of the schemas.
+func (r *EventRegistry) valueType(schemas []string, key string) ValueType {
+	for _, schema := range schemas {
+		ev := r.Event(schema)
+		if ev == nil {
+			continue
+		}
+		if _, ok := ev.(EventMarshaler); ok {
+			continue // not marshaled by reflection
+		}
+		path := key
+		if _, ok := ev.(RepeatedEvent); ok {
+			// Remove the index prefix (see MarshalRepeatedEvent).
+			if !strings.HasPrefix(path, schema+".") {
+				continue
+			}
+			index, rest := splitPath(path[len(schema)+1:])
+			if _, err := strconv.Atoi(index); err != nil {
+				continue
+			}
+			path = rest
+		}
+		if t := fieldType(reflect.TypeOf(ev), path); t != nil {
+			return leafValueType(t)
+		}
+	}
+	return ""
+}
+
+// leafValueType returns the type of the values of the leaf type t (see
+// fieldType), or "" if they are untyped.
+func leafValueType(t reflect.Type) ValueType {
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		return TimeValue
+	case t == reflect.TypeOf(time.Duration(0)):
+		return DurationValue
+	case t.Implements(stringerType):
+		return "" // flattened with String
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return BoolValue
+	case reflect.Float32, reflect.Float64:
+		return FloatValue
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return IntValue
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return UintValue
+	}
+	return ""
+}
+
+// ParseTypedValue parses an annotation value of the given type, and returns
+// it as an int64, uint64, float64, bool, time.Duration or time.Time.
+func ParseTypedValue(t ValueType, value []byte) (interface{}, error) {
+	s := string(value)
+	switch t {
+	case IntValue:
+		return strconv.ParseInt(s, 10, 64)
+	case UintValue:
+		return strconv.ParseUint(s, 10, 64)
+	case FloatValue:
+		return strconv.ParseFloat(s, 64)
+	case BoolValue:
+		return strconv.ParseBool(s)
+	case DurationValue:
+		return parseDuration(s)
+	case TimeValue:
+		return time.Parse(time.RFC3339Nano, s)
+	}
+	return nil, fmt.Errorf("appdash: unknown annotation value type %q", t)
+}
+
+// formatDuration formats a duration as a decimal number of milliseconds,
+// as flattenValue encodes them.
+func formatDuration(d time.Duration) string {
+	ms := float64(d.Nanoseconds()) / float64(time.Millisecond)
+	return strconv.FormatFloat(ms, 'f', -1, 64)
+}
+
+// parseDuration parses a duration formatted by formatDuration. Its
+// fractional digits are parsed exactly (down to the nanosecond), so that
+// the durations of up to 2^52 nanoseconds (about 52 days) round-trip
+// exactly.
+func parseDuration(s string) (time.Duration, error) {
+	if d, err := time.ParseDuration(s + "ms"); err == nil {
+		return d, nil
+	}
+	ms, err := strconv.ParseFloat(s, 64) // e.g. in exponent form
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(ms * float64(time.Millisecond)), nil
+}
@@ -0,0 +1,164 @@
+package appdash
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testTypedEvent struct {
+	Count   int
+	Size    uint32
+	Ratio   float64
+	OK      bool
+	Elapsed time.Duration
+	At      time.Time
+	Name    string
+}
+
+func (testTypedEvent) Schema() string { return "testTyped" }
+
+func TestMarshalEvent_typed(t *testing.T) {
+	r := NewEventRegistry(DefaultEventRegistry)
+	if err := r.Register(testTypedEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	e := testTypedEvent{
+		Count:   -3,
+		Size:    42,
+		Ratio:   0.25,
+		OK:      true,
+		Elapsed: 1500*time.Millisecond + 7,
+		At:      time.Date(2015, 1, 2, 3, 4, 5, 6, time.UTC),
+		Name:    "n",
+	}
+	anns, err := MarshalEvent(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The types are those of the fields of the registered event type, and
+	// aren't recorded.
+	if len(anns) != 8 {
+		t.Errorf("got annotations %v, want one per field and the schema", anns)
+	}
+	wantTypes := map[string]ValueType{
+		"Count":   IntValue,
+		"Size":    UintValue,
+		"Ratio":   FloatValue,
+		"OK":      BoolValue,
+		"Elapsed": DurationValue,
+		"At":      TimeValue,
+		"Name":    "",
+		"Missing": "",
+	}
+	for k, want := range wantTypes {
+		if got := r.ValueType(anns, k); got != want {
+			t.Errorf("%s: got type %q, want %q", k, got, want)
+		}
+	}
+	if got := anns.Type("Count"); got != "" {
+		t.Errorf("got type %q from the default registry, want none", got)
+	}
+	if got, want := string(anns.Get("Elapsed")), "1500.000007"; got != want {
+		t.Errorf("got Elapsed %q, want %q", got, want)
+	}
+
+	wantValues := map[string]interface{}{
+		"Count":   int64(-3),
+		"Size":    uint64(42),
+		"Ratio":   0.25,
+		"OK":      true,
+		"Elapsed": e.Elapsed,
+		"At":      e.At,
+	}
+	if got := r.TypedValues(anns); !reflect.DeepEqual(got, wantValues) {
+		t.Errorf("got typed values %#v, want %#v", got, wantValues)
+	}
+
+	var got testTypedEvent
+	if err := UnmarshalEvent(anns, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, e) {
+		t.Errorf("got %#v, want %#v", got, e)
+	}
+}
+
+func TestAnnotations_Type(t *testing.T) {
+	start := time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)
+	var anns Annotations
+	for _, e := range []Event{
+		Timespan{S: start, E: start.Add(time.Second), D: time.Second},
+		SpanName("s"),
+	} {
+		as, err := MarshalEvent(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		anns = append(anns, as...)
+	}
+	as, err := MarshalRepeatedEvent(LogLevelEvent{Level: LevelWarn, Msg: "m", Time: start}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anns = append(anns, as...)
+
+	wantTypes := map[string]ValueType{
+		"Span.Start":         TimeValue,
+		"Span.Duration":      DurationValue,
+		"Name":               "",
+		"leveledlog.2.Time":  TimeValue,
+		"leveledlog.2.Level": "", // a Stringer
+		"leveledlog.x.Time":  "",
+	}
+	for k, want := range wantTypes {
+		if got := anns.Type(k); got != want {
+			t.Errorf("%s: got type %q, want %q", k, got, want)
+		}
+	}
+}
+
+func TestDuration_roundTrip(t *testing.T) {
+	for _, d := range []time.Duration{0, 1, 999, 1500*time.Millisecond + 7, -3 * time.Second, 24*time.Hour - 1, 50*24*time.Hour + 123456789} {
+		got, err := parseDuration(formatDuration(d))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != d {
+			t.Errorf("%d: got %d (from %q)", d, got, formatDuration(d))
+		}
+	}
+}
+
+func TestParseTypedValue(t *testing.T) {
+	tests := []struct {
+		typ   ValueType
+		value string
+		want  interface{}
+	}{
+		{IntValue, "-7", int64(-7)},
+		{UintValue, "18446744073709551615", uint64(18446744073709551615)},
+		{FloatValue, "1.5", 1.5},
+		{BoolValue, "false", false},
+		{DurationValue, "0.001", time.Microsecond},
+		{TimeValue, "2015-01-02T03:04:05Z", time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		got, err := ParseTypedValue(test.typ, []byte(test.value))
+		if err != nil {
+			t.Errorf("%s %q: %s", test.typ, test.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s %q: got %#v, want %#v", test.typ, test.value, got, test.want)
+		}
+	}
+
+	if _, err := ParseTypedValue("complex", []byte("1i")); err == nil {
+		t.Error("got no error for an unknown type")
+	}
+	if _, err := ParseTypedValue(IntValue, []byte("x")); err == nil {
+		t.Error("got no error for an invalid int")
+	}
+}
@@ -0,0 +1,202 @@
+package appdash
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gogo/protobuf/proto"
+	"sourcegraph.com/sourcegraph/appdash/internal/wire"
+)
+
+// DefaultMaxPacketSize is the default maximum size of the datagrams sent by
+// a UDPCollector. It leaves room for the IP and UDP headers (and some
+// tunneling overhead) within the usual Ethernet MTU of 1500 bytes, so that
+// datagrams are not fragmented.
+const DefaultMaxPacketSize = 1400
+
+// maxDatagramSize is the maximum size of a UDP datagram (over IPv4).
+const maxDatagramSize = 65507
+
+// NewUDPCollector creates a collector that sends data to a UDP collector
+// server (created with NewUDPServer), one datagram per collection.
+func NewUDPCollector(addr string) *UDPCollector {
+	return &UDPCollector{addr: addr}
+}
+
+// A UDPCollector sends data to a UDP collector server, for hot paths where
+// spans must be emitted with no connection state and where losing some of
+// them is acceptable (like with statsd).
+//
+// Each datagram holds a single CollectPacket (without the length prefix of
+// the TCP protocol) of at most MaxPacketSize bytes. The annotations of a
+// collection that would exceed it are split over several datagrams for the
+// same span. A collection with a single annotation that exceeds it on its
+// own is dropped, and Collect returns ErrMessageTooLarge.
+//
+// Delivery is not confirmed: Collect only returns the errors reported by
+// the local network stack, and datagrams may be lost, duplicated or
+// reordered on the way.
+type UDPCollector struct {
+	addr string
+
+	// MaxPacketSize is the maximum size in bytes of a datagram. It may be
+	// raised up to 65507 bytes on networks where fragmentation is not a
+	// concern (e.g. over the loopback interface).
+	//
+	// Default MaxPacketSize = DefaultMaxPacketSize.
+	MaxPacketSize int
+
+	mu   sync.Mutex // guards conn
+	conn net.Conn   // the UDP socket, once dialed
+}
+
+// Collect implements the Collector interface by sending the events that
+// occured in the span to the UDP collector server.
+func (uc *UDPCollector) Collect(span SpanID, anns ...Annotation) error {
+	conn, err := uc.dial()
+	if err != nil {
+		return err
+	}
+
+	maxSize := uc.MaxPacketSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxPacketSize
+	}
+	var tooLarge bool
+	for _, anns := range splitAnnotations(anns, maxSize) {
+		data, err := proto.Marshal(newCollectPacket(span, anns))
+		if err != nil {
+			return err
+		}
+		if len(data) > maxSize {
+			tooLarge = true
+			continue
+		}
+		if _, err := conn.Write(data); err != nil {
+			return err
+		}
+	}
+	if tooLarge {
+		return ErrMessageTooLarge
+	}
+	return nil
+}
+
+// dial returns the UDP socket, creating it if needed. Since UDP is
+// connectionless, this only resolves the address.
+func (uc *UDPCollector) dial() (net.Conn, error) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	if uc.conn == nil {
+		c, err := net.Dial("udp", uc.addr)
+		if err != nil {
+			return nil, err
+		}
+		uc.conn = c
+	}
+	return uc.conn, nil
+}
+
+// Close closes the UDP socket. A later call to Collect creates a new one.
+func (uc *UDPCollector) Close() error {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	if uc.conn == nil {
+		return nil
+	}
+	err := uc.conn.Close()
+	uc.conn = nil
+	return err
+}
+
+// NewUDPServer creates a server that receives the datagrams sent by
+// UDPCollectors on conn and adds them to the collector c.
+//
+// Call the UDPServer's Start method to start receiving datagrams.
+func NewUDPServer(conn net.PacketConn, c Collector) *UDPServer {
+	return &UDPServer{c: c, conn: conn}
+}
+
+// A UDPServer receives spans and annotations in UDP datagrams and adds them
+// to a local collector. Datagrams that can't be decoded are counted (see
+// Rejected) and dropped.
+type UDPServer struct {
+	c    Collector
+	conn net.PacketConn
+
+	// Log is the logger to use for errors and warnings. If nil, a new
+	// logger is created.
+	Log   *log.Logger
+	logMu sync.Mutex
+
+	// Debug is whether to log debug messages.
+	Debug bool
+
+	// Trace is whether to log all data that is received.
+	Trace bool
+
+	rejected uint64 // number of rejected datagrams (accessed atomically)
+	closed   int32  // whether Close was called (accessed atomically)
+}
+
+// Start starts the server. It returns after Close is called.
+func (us *UDPServer) Start() {
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, addr, err := us.conn.ReadFrom(buf)
+		if err != nil {
+			if atomic.LoadInt32(&us.closed) != 0 {
+				return
+			}
+			us.log().Printf("ReadFrom: %s", err)
+			continue
+		}
+
+		p := &wire.CollectPacket{}
+		if err := proto.Unmarshal(buf[:n], p); err != nil {
+			atomic.AddUint64(&us.rejected, 1)
+			if us.Debug {
+				us.log().Printf("Client %s: rejected datagram of %d bytes: %s", addr, n, err)
+			}
+			continue
+		}
+
+		spanID := spanIDFromWire(p.Spanid)
+		if us.Debug || us.Trace {
+			us.log().Printf("Client %s: received span %v with %d annotations", addr, spanID, len(p.Annotation))
+		}
+		if us.Trace {
+			for i, ann := range p.Annotation {
+				us.log().Printf("Client %s: span %v: annotation %d: %s=%q", addr, spanID.Span, i, *ann.Key, ann.Value)
+			}
+		}
+		if err := us.c.Collect(spanID, annotationsFromWire(p.Annotation)...); err != nil {
+			us.log().Printf("Client %s: Collect %v: %s", addr, spanID, err)
+		}
+	}
+}
+
+// Close stops the server and closes its connection.
+func (us *UDPServer) Close() error {
+	atomic.StoreInt32(&us.closed, 1)
+	return us.conn.Close()
+}
+
+// Rejected returns the number of datagrams that the server dropped because
+// they could not be decoded.
+func (us *UDPServer) Rejected() uint64 {
+	return atomic.LoadUint64(&us.rejected)
+}
+
+func (us *UDPServer) log() *log.Logger {
+	us.logMu.Lock()
+	defer us.logMu.Unlock()
+	if us.Log == nil {
+		us.Log = log.New(os.Stderr, fmt.Sprintf("UDPServer[%s]: ", us.conn.LocalAddr()), log.LstdFlags|log.Lmicroseconds)
+	}
+	return us.Log
+}
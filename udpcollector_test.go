@@ -0,0 +1,166 @@
+package appdash
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"sourcegraph.com/sourcegraph/appdash/internal/wire"
+)
+
+// startUDPServer starts a UDP server that adds to c.
+func startUDPServer(t testing.TB, c Collector) *UDPServer {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	us := NewUDPServer(conn, c)
+	us.Log = log.New(ioutil.Discard, "", 0)
+	go us.Start()
+	return us
+}
+
+// waitForAnnotations waits until the trace of span in store has n
+// annotations, and returns them.
+func waitForAnnotations(t *testing.T, store *MemoryStore, span SpanID, n int) Annotations {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if trace, err := store.Trace(span.Trace); err == nil && len(trace.Annotations) >= n {
+			return trace.Annotations
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("span %v: timed out waiting for %d annotations", span, n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestUDPCollector(t *testing.T) {
+	store := NewMemoryStore()
+	us := startUDPServer(t, store)
+	defer us.Close()
+
+	uc := NewUDPCollector(us.conn.LocalAddr().String())
+	uc.MaxPacketSize = 512
+	defer uc.Close()
+
+	// The annotations don't fit in a single datagram.
+	span := SpanID{Trace: 1, Span: 2, Parent: 3}
+	var anns Annotations
+	for i := 0; i < 20; i++ {
+		anns = append(anns, Annotation{Key: fmt.Sprintf("k%d", i), Value: bytes.Repeat([]byte{'v'}, 50)})
+	}
+	if err := uc.Collect(span, anns...); err != nil {
+		t.Fatal(err)
+	}
+	got := waitForAnnotations(t, store, span, len(anns))
+	if !reflect.DeepEqual(got, anns) {
+		t.Errorf("got annotations %v, want %v", got, anns)
+	}
+
+	// A single annotation that doesn't fit is dropped.
+	span2 := SpanID{Trace: 4, Span: 5, Parent: 0}
+	if err := uc.Collect(span2, Annotation{Key: "big", Value: make([]byte, 600)}, Annotation{Key: "small"}); err != ErrMessageTooLarge {
+		t.Errorf("got error %v, want ErrMessageTooLarge", err)
+	}
+	if got, want := waitForAnnotations(t, store, span2, 1), (Annotations{{Key: "small"}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got annotations %v, want %v", got, want)
+	}
+}
+
+func TestUDPServer_rejected(t *testing.T) {
+	store := NewMemoryStore()
+	us := startUDPServer(t, store)
+	defer us.Close()
+
+	c, err := net.Dial("udp", us.conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	noParent, err := proto.Marshal(&wire.CollectPacket{
+		Spanid: &wire.CollectPacket_SpanID{Trace: proto.Uint64(1), Span: proto.Uint64(1)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid, err := proto.Marshal(newCollectPacket(SpanID{Trace: 2, Span: 2, Parent: 0}, Annotations{{Key: "k", Value: []byte("v")}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad := [][]byte{
+		{},
+		{0xff, 0xff, 0xff},
+		valid[:len(valid)-3], // truncated
+		bytes.Repeat([]byte{0x0b}, 100),
+	}
+	for _, b := range bad {
+		if _, err := c.Write(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, b := range [][]byte{noParent, valid} {
+		if _, err := c.Write(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The server survives the bad datagrams.
+	waitForAnnotations(t, store, SpanID{Trace: 2, Span: 2, Parent: 0}, 1)
+	if _, err := store.Trace(1); err != nil {
+		t.Errorf("span without a parent: %s", err)
+	}
+	if got, want := us.Rejected(), uint64(len(bad)); got != want {
+		t.Errorf("got %d rejected datagrams, want %d", got, want)
+	}
+}
+
+// BenchmarkCollectorTransports compares the per-span overhead of the
+// collector transports, as seen by the caller of Collect.
+func BenchmarkCollectorTransports(b *testing.B) {
+	discard := collectorFunc(func(span SpanID, anns ...Annotation) error {
+		return nil
+	})
+	anns := make([]Annotation, 10)
+	for a := range anns {
+		anns[a] = Annotation{"k1", []byte("v1")}
+	}
+	bench := func(b *testing.B, c Collector) {
+		for n := 0; n < b.N; n++ {
+			if err := c.Collect(NewRootSpanID(), anns...); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	b.Run("RemoteCollector", func(b *testing.B) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			b.Fatal(err)
+		}
+		kl := &killableListener{Listener: l}
+		defer kl.kill()
+		cs := NewServer(kl, discard)
+		cs.Log = log.New(ioutil.Discard, "", 0)
+		go cs.Start()
+
+		rc := NewRemoteCollector(l.Addr().String())
+		defer rc.Close()
+		bench(b, rc)
+	})
+	b.Run("UDPCollector", func(b *testing.B) {
+		us := startUDPServer(b, discard)
+		defer us.Close()
+
+		uc := NewUDPCollector(us.conn.LocalAddr().String())
+		defer uc.Close()
+		bench(b, uc)
+	})
+}